@@ -0,0 +1,64 @@
+// Command rebuild-items replays the item event log and rewrites the item
+// projection table to match it. Run it after changing how events are
+// projected, or to repair a projection that has drifted from the events.
+// Stop the server or enable read-only mode first: writes made during a
+// rebuild may be overwritten.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/items"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	ctx := context.Background()
+
+	configFile := flag.String("config", "", "YAML config file; environment variables take precedence (default $CONFIG_FILE)")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	awsClients, err := aws.NewClients(ctx, logger, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize AWS clients: %w", err)
+	}
+
+	logger.Info("rebuilding item projection",
+		"events_table", cfg.Items.EventsTable,
+		"table", cfg.Items.Table,
+	)
+
+	store := items.NewEventStore(awsClients.InternalDynamoDB, cfg.Items.EventsTable, cfg.Items.Table)
+	result, err := store.Rebuild(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild item projection: %w", err)
+	}
+
+	logger.Info("item projection rebuilt",
+		"events", result.Events,
+		"items", result.Items,
+		"removed", result.Removed,
+	)
+	return nil
+}
@@ -2,17 +2,33 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/pmollerus23/go-aws-server/internal/aws"
 	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/database"
+	"github.com/pmollerus23/go-aws-server/internal/diagnostics"
+	"github.com/pmollerus23/go-aws-server/internal/preflight"
+	"github.com/pmollerus23/go-aws-server/internal/requestid"
 	"github.com/pmollerus23/go-aws-server/internal/server"
+	"github.com/pmollerus23/go-aws-server/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 
-	_ "github.com/pmollerus23/go-aws-server/docs" // Swagger docs
+	"github.com/pmollerus23/go-aws-server/docs" // Swagger docs
 )
 
+// tracingShutdownTimeout bounds how long exiting waits to export the spans
+// still buffered.
+const tracingShutdownTimeout = 5 * time.Second
+
 //	@title						AWS Go Server API
 //	@version					1.0
 //	@description				A production-grade Go web server with AWS Cognito authentication and AWS service integration.
@@ -31,22 +47,40 @@ import (
 //	@description				JWT Bearer token authentication via AWS Cognito. Use format: "Bearer {access_token}"
 
 func main() {
-	if err := run(); err != nil {
+	if err := run(context.Background(), os.Stdout, os.Args); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
 }
 
-func run() error {
-	ctx := context.Background()
+// run starts the server with the command line args, logging to w, until ctx
+// is cancelled or an interrupt arrives.
+func run(ctx context.Context, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(w)
+	mockMode := flags.Bool("mock", false, "serve example responses from the OpenAPI document without calling AWS")
+	skipPreflight := flags.Bool("skip-preflight", false, "start without checking that the Cognito user pool, DynamoDB table, and S3 buckets are reachable")
+	configFile := flags.String("config", "", "YAML config file; environment variables take precedence (default $CONFIG_FILE)")
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
 
-	// Create logger
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+	// Create logger, keeping recent lines in memory for support bundles and
+	// tagging lines logged for a request with its ID
+	logs := diagnostics.NewLogBuffer(1000)
+	logger := slog.New(requestid.NewHandler(slog.NewJSONHandler(io.MultiWriter(w, logs), &slog.HandlerOptions{
 		Level: slog.LevelInfo,
-	}))
+	})))
+
+	if *mockMode {
+		return server.RunMock(ctx, logger, config.LoadServer(), []byte(docs.SwaggerInfo.ReadDoc()))
+	}
 
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(*configFile)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
@@ -57,13 +91,79 @@ func run() error {
 		"aws_region", cfg.AWS.Region,
 	)
 
+	// Trace requests and the AWS calls they make, if a collector is
+	// configured. The admin API adjusts which requests are sampled
+	sampler := tracing.NewSampler(cfg.Tracing.SampleRate)
+	if cfg.Tracing.Enabled() {
+		provider, err := tracing.NewProvider(ctx, sampler)
+		if err != nil {
+			return fmt.Errorf("failed to set up tracing: %w", err)
+		}
+		defer func() {
+			// Flush the spans still buffered
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tracingShutdownTimeout)
+			defer cancel()
+			if err := provider.Shutdown(ctx); err != nil {
+				logger.Error("failed to flush traces", "error", err)
+			}
+		}()
+
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			logger.Warn("tracing error", "error", err)
+		}))
+		logger.Info("tracing enabled",
+			"otlp_endpoint", cfg.Tracing.OTLPEndpoint,
+			"sample_rate", cfg.Tracing.SampleRate,
+		)
+	}
+
 	// Initialize AWS clients
-	awsClients, err := aws.NewClients(ctx, logger, cfg.AWS)
+	awsClients, err := aws.NewClients(ctx, logger, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to initialize AWS clients: %w", err)
 	}
 
+	// Read the Cognito client secret from Secrets Manager, if configured
+	if cfg.Auth.Provider == config.AuthProviderCognito && cfg.Cognito.ClientSecretARN != "" {
+		secret, err := aws.ReadSecret(ctx, awsClients.SecretsManager, cfg.Cognito.ClientSecretARN, config.CognitoClientSecretKey)
+		if err != nil {
+			return fmt.Errorf("failed to read AWS_COGNITO_CLIENT_SECRET_ARN: %w", err)
+		}
+		cfg.Cognito.ClientSecret = secret
+	}
+
+	// Check dependencies now rather than on the first request that needs them
+	if *skipPreflight {
+		logger.Warn("skipping preflight checks")
+	} else if err := preflight.Run(ctx, logger, cfg, awsClients); err != nil {
+		return err
+	}
+
+	// Connect to Postgres and bring its schema up to date, if configured
+	var db *sql.DB
+	if cfg.Postgres.Enabled() {
+		db, err = database.Open(cfg.Postgres, awsClients.Config)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if cfg.Postgres.Migrate {
+			err = database.Migrate(ctx, db, logger)
+		} else {
+			err = db.PingContext(ctx)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to prepare Postgres database: %w", err)
+		}
+	}
+
 	// Create and run server
-	srv := server.New(logger, cfg, awsClients)
+	srv, err := server.New(logger, cfg, awsClients, logs, db, sampler)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
 	return srv.Run(ctx)
 }
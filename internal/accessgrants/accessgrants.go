@@ -0,0 +1,278 @@
+// Package accessgrants provisions S3 Access Grants for users' prefixes and
+// vends temporary credentials for them, so the SPA can read and write S3
+// directly with least-privilege credentials instead of proxying through
+// the server.
+//
+// Every grant is made to the server's IAM role and scoped to a prefix under
+// a user's home, users/{userID}/, in the configured location. The server
+// only requests credentials within the caller's own home, and S3 Access
+// Grants only vends them where a grant covers the requested prefix.
+package accessgrants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/aws/smithy-go"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+var (
+	// ErrNoGrant is returned when no grant covers the requested prefix.
+	ErrNoGrant = errors.New("no access grant covers the prefix")
+	// ErrGrantNotFound is returned when deleting a grant that doesn't exist.
+	ErrGrantNotFound = errors.New("access grant not found")
+	// ErrInvalidPrefix is returned for prefixes that could escape a user's home.
+	ErrInvalidPrefix = errors.New("prefix must be relative, end with /, and not contain . or .. segments")
+)
+
+// Grant is an access grant for a prefix in a user's home.
+type Grant struct {
+	ID     string `json:"id" example:"a1b2c3d4-5678-90ab-cdef-EXAMPLE11111"`
+	UserID string `json:"user_id" example:"12345678-1234-1234-1234-123456789012"`
+	// Prefix is relative to the user's home; empty means the whole home.
+	Prefix     string    `json:"prefix" example:"reports/"`
+	Permission string    `json:"permission" example:"READ"`
+	Scope      string    `json:"scope" example:"s3://my-bucket/users/12345678-1234-1234-1234-123456789012/reports/*"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Credentials are temporary credentials for a prefix.
+type Credentials struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expiration      time.Time `json:"expiration"`
+	// Bucket and Prefix are where the credentials may be used.
+	Bucket string `json:"bucket" example:"my-bucket"`
+	Prefix string `json:"prefix" example:"users/12345678-1234-1234-1234-123456789012/reports/"`
+}
+
+// Service manages access grants in one location.
+type Service struct {
+	client *s3control.Client
+	cfg    config.AccessGrantsConfig
+	logger *slog.Logger
+
+	// mu guards scope, the location's bucket and prefix, e.g.
+	// "s3://my-bucket/", which is looked up on first use.
+	mu    sync.Mutex
+	scope string
+}
+
+// New returns a Service, or nil if access grants are disabled.
+func New(client *s3control.Client, cfg config.AccessGrantsConfig, logger *slog.Logger) *Service {
+	if cfg.LocationID == "" {
+		return nil
+	}
+	return &Service{client: client, cfg: cfg, logger: logger}
+}
+
+// CreateGrant grants the server permission to prefix in userID's home.
+func (s *Service) CreateGrant(ctx context.Context, userID, prefix string, permission types.Permission) (*Grant, error) {
+	if err := validPrefix(prefix); err != nil {
+		return nil, err
+	}
+	scope, err := s.locationScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.client.CreateAccessGrant(ctx, &s3control.CreateAccessGrantInput{
+		AccountId:              aws.String(s.cfg.AccountID),
+		AccessGrantsLocationId: aws.String(s.cfg.LocationID),
+		AccessGrantsLocationConfiguration: &types.AccessGrantsLocationConfiguration{
+			S3SubPrefix: aws.String(homePrefix(userID) + prefix + "*"),
+		},
+		Grantee: &types.Grantee{
+			GranteeType:       types.GranteeTypeIam,
+			GranteeIdentifier: aws.String(s.cfg.GranteeARN),
+		},
+		Permission: permission,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create access grant: %w", err)
+	}
+
+	s.logger.Info("access grant created", "grant_id", aws.ToString(result.AccessGrantId), "user_id", userID, "prefix", prefix, "permission", permission)
+	return s.newGrant(scope, aws.ToString(result.AccessGrantId), aws.ToString(result.GrantScope), result.Permission, result.CreatedAt), nil
+}
+
+// ListGrants returns the grants in the location, or only userID's if it
+// isn't empty.
+func (s *Service) ListGrants(ctx context.Context, userID string) ([]Grant, error) {
+	scope, err := s.locationScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := []Grant{}
+	paginator := s3control.NewListAccessGrantsPaginator(s.client, &s3control.ListAccessGrantsInput{
+		AccountId:         aws.String(s.cfg.AccountID),
+		GranteeType:       types.GranteeTypeIam,
+		GranteeIdentifier: aws.String(s.cfg.GranteeARN),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list access grants: %w", err)
+		}
+		for _, entry := range page.AccessGrantsList {
+			if aws.ToString(entry.AccessGrantsLocationId) != s.cfg.LocationID {
+				continue
+			}
+			grant := s.newGrant(scope, aws.ToString(entry.AccessGrantId), aws.ToString(entry.GrantScope), entry.Permission, entry.CreatedAt)
+			if grant.UserID == "" || (userID != "" && grant.UserID != userID) {
+				continue
+			}
+			grants = append(grants, *grant)
+		}
+	}
+
+	return grants, nil
+}
+
+// DeleteGrant deletes a grant. Credentials already vended for it stay valid
+// until they expire.
+func (s *Service) DeleteGrant(ctx context.Context, id string) error {
+	_, err := s.client.DeleteAccessGrant(ctx, &s3control.DeleteAccessGrantInput{
+		AccountId:     aws.String(s.cfg.AccountID),
+		AccessGrantId: aws.String(id),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchAccessGrant" {
+			return ErrGrantNotFound
+		}
+		return fmt.Errorf("delete access grant: %w", err)
+	}
+
+	s.logger.Info("access grant deleted", "grant_id", id)
+	return nil
+}
+
+// GetDataAccess vends credentials for prefix in userID's home, scoped to
+// exactly that prefix. It returns ErrNoGrant unless a grant with the
+// permission covers it.
+func (s *Service) GetDataAccess(ctx context.Context, userID, prefix string, permission types.Permission) (*Credentials, error) {
+	if err := validPrefix(prefix); err != nil {
+		return nil, err
+	}
+	scope, err := s.locationScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	target := scope + homePrefix(userID) + prefix
+	result, err := s.client.GetDataAccess(ctx, &s3control.GetDataAccessInput{
+		AccountId:       aws.String(s.cfg.AccountID),
+		Target:          aws.String(target + "*"),
+		Permission:      permission,
+		Privilege:       types.PrivilegeMinimal,
+		DurationSeconds: aws.Int32(int32(s.cfg.Duration.Seconds())),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied" {
+			return nil, ErrNoGrant
+		}
+		return nil, fmt.Errorf("get data access: %w", err)
+	}
+
+	s.logger.Info("data access credentials vended", "user_id", userID, "prefix", prefix, "permission", permission, "matched_grant", aws.ToString(result.MatchedGrantTarget))
+	bucket := bucketOf(target)
+	return &Credentials{
+		AccessKeyID:     aws.ToString(result.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(result.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(result.Credentials.SessionToken),
+		Expiration:      aws.ToTime(result.Credentials.Expiration),
+		Bucket:          bucket,
+		Prefix:          strings.TrimPrefix(target, "s3://"+bucket+"/"),
+	}, nil
+}
+
+// locationScope returns the location's scope as "s3://bucket/" or
+// "s3://bucket/prefix/".
+func (s *Service) locationScope(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scope != "" {
+		return s.scope, nil
+	}
+
+	result, err := s.client.GetAccessGrantsLocation(ctx, &s3control.GetAccessGrantsLocationInput{
+		AccountId:              aws.String(s.cfg.AccountID),
+		AccessGrantsLocationId: aws.String(s.cfg.LocationID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("get access grants location: %w", err)
+	}
+
+	scope := strings.TrimSuffix(aws.ToString(result.LocationScope), "*")
+	if bucketOf(scope) == "" {
+		return "", fmt.Errorf("access grants location %s must be scoped to a bucket, not %q", s.cfg.LocationID, aws.ToString(result.LocationScope))
+	}
+	if !strings.HasSuffix(scope, "/") {
+		scope += "/"
+	}
+
+	s.scope = scope
+	return s.scope, nil
+}
+
+// newGrant converts a grant's scope back to the user and prefix it covers.
+// UserID is empty for grants outside users' homes.
+func (s *Service) newGrant(scope, id, grantScope string, permission types.Permission, createdAt *time.Time) *Grant {
+	grant := &Grant{
+		ID:         id,
+		Permission: string(permission),
+		Scope:      grantScope,
+		CreatedAt:  aws.ToTime(createdAt),
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSuffix(grantScope, "*"), scope+"users/")
+	if !ok {
+		return grant
+	}
+	grant.UserID, grant.Prefix, ok = strings.Cut(rest, "/")
+	if !ok {
+		grant.UserID = ""
+	}
+	return grant
+}
+
+// homePrefix returns the prefix of a user's home, relative to the location.
+func homePrefix(userID string) string {
+	return "users/" + userID + "/"
+}
+
+// bucketOf returns the bucket in an S3 URI, or "" if there is none.
+func bucketOf(uri string) string {
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+	return bucket
+}
+
+// validPrefix checks that prefix is empty or a relative prefix ending in
+// "/" that stays within the directory it's appended to.
+func validPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") || strings.ContainsAny(prefix, "*\\") {
+		return ErrInvalidPrefix
+	}
+	for _, segment := range strings.Split(strings.TrimSuffix(prefix, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidPrefix
+		}
+	}
+	return nil
+}
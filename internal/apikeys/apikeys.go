@@ -0,0 +1,228 @@
+// Package apikeys mints, revokes, and verifies API keys for machine
+// clients, as an alternative to identity provider tokens.
+//
+// A key has the form "ak_{id}.{secret}". Only the SHA-256 hash of the
+// secret is stored, in a DynamoDB table keyed by id, along with the roles
+// the key grants. The full key is shown once, when it is minted.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pmollerus23/go-aws-server/internal/store"
+)
+
+const (
+	// keyPrefix marks API keys so they are easy to recognize in logs and
+	// secret scanners.
+	keyPrefix = "ak_"
+	// cacheTTL is how long a verified key is trusted without reading the
+	// table again. Revocations take up to this long to reach other instances.
+	cacheTTL = time.Minute
+)
+
+var (
+	// ErrInvalidKey is returned for keys that are malformed, unknown,
+	// revoked, or expired.
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrKeyNotFound is returned when revoking a key that doesn't exist.
+	ErrKeyNotFound = errors.New("API key not found")
+)
+
+// Key is an API key's metadata. The secret is never stored.
+type Key struct {
+	ID        string     `json:"id" dynamodbav:"id" example:"01J9Z6M3T4V5W6X7Y8Z9A0B1C2"`
+	Name      string     `json:"name" dynamodbav:"name" example:"nightly-export"`
+	Roles     []string   `json:"roles" dynamodbav:"roles" example:"editor"`
+	CreatedBy string     `json:"created_by" dynamodbav:"created_by"`
+	CreatedAt time.Time  `json:"created_at" dynamodbav:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" dynamodbav:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" dynamodbav:"revoked_at,omitempty"`
+
+	SecretHash string `json:"-" dynamodbav:"secret_hash"`
+}
+
+// active reports whether the key can authenticate at now.
+func (k *Key) active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// cachedKey is a verified key and when it was read.
+type cachedKey struct {
+	key      *Key
+	loadedAt time.Time
+}
+
+// Service manages API keys in one table.
+type Service struct {
+	client *dynamodb.Client
+	table  string
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedKey // Keyed by ID
+}
+
+// New returns a Service, or nil if API keys are disabled.
+func New(client *dynamodb.Client, table string, logger *slog.Logger) *Service {
+	if table == "" {
+		return nil
+	}
+	return &Service{
+		client: client,
+		table:  table,
+		logger: logger,
+		cache:  make(map[string]cachedKey),
+	}
+}
+
+// Mint creates a key granting roles and returns it with the full key,
+// which can't be recovered later.
+func (s *Service) Mint(ctx context.Context, name string, roles []string, expiresAt *time.Time, createdBy string) (*Key, string, error) {
+	secret := rand.Text()
+	key := &Key{
+		ID:         store.NewULID(),
+		Name:       name,
+		Roles:      roles,
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now().UTC(),
+		ExpiresAt:  expiresAt,
+		SecretHash: hashSecret(secret),
+	}
+
+	item, err := attributevalue.MarshalMap(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshal API key: %w", err)
+	}
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("put API key to %s: %w", s.table, err)
+	}
+
+	s.logger.Info("API key minted", "key_id", key.ID, "name", name, "roles", roles, "created_by", createdBy)
+	return key, keyPrefix + key.ID + "." + secret, nil
+}
+
+// List returns every key, including revoked and expired ones.
+func (s *Service) List(ctx context.Context) ([]Key, error) {
+	keys := []Key{}
+
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(s.table),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", s.table, err)
+		}
+		var pageKeys []Key
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageKeys); err != nil {
+			return nil, fmt.Errorf("unmarshal API keys: %w", err)
+		}
+		keys = append(keys, pageKeys...)
+	}
+
+	return keys, nil
+}
+
+// Revoke marks a key revoked. It stays listed for auditing.
+func (s *Service) Revoke(ctx context.Context, id string) error {
+	now, err := attributevalue.Marshal(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.table),
+		Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+		UpdateExpression:          aws.String("SET revoked_at = if_not_exists(revoked_at, :now)"),
+		ConditionExpression:       aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":now": now},
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrKeyNotFound
+		}
+		return fmt.Errorf("revoke API key in %s: %w", s.table, err)
+	}
+
+	s.mu.Lock()
+	delete(s.cache, id)
+	s.mu.Unlock()
+
+	s.logger.Info("API key revoked", "key_id", id)
+	return nil
+}
+
+// Verify returns the key a request presented, or ErrInvalidKey.
+func (s *Service) Verify(ctx context.Context, presented string) (*Key, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(presented, keyPrefix), ".")
+	if !ok || !strings.HasPrefix(presented, keyPrefix) || id == "" || secret == "" {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := s.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashSecret(secret))) != 1 || !key.active(time.Now()) {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// load returns a key from the cache or the table.
+func (s *Service) load(ctx context.Context, id string) (*Key, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[id]
+	s.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < cacheTTL {
+		return cached.key, nil
+	}
+
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.table),
+		Key:       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get API key from %s: %w", s.table, err)
+	}
+	if result.Item == nil {
+		return nil, ErrInvalidKey
+	}
+
+	var key Key
+	if err := attributevalue.UnmarshalMap(result.Item, &key); err != nil {
+		return nil, fmt.Errorf("unmarshal API key: %w", err)
+	}
+
+	s.mu.Lock()
+	s.cache[id] = cachedKey{key: &key, loadedAt: time.Now()}
+	s.mu.Unlock()
+	return &key, nil
+}
+
+// hashSecret returns the stored form of a key's secret. The secret is
+// random, so a plain hash is enough.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
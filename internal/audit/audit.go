@@ -0,0 +1,223 @@
+// Package audit records authentication events, such as logins and password
+// resets, for incident investigation.
+//
+// Every event is logged. When a table is configured, events are also
+// written to DynamoDB, partitioned by UTC date and sorted by ID, and expire
+// after the retention period through the table's TTL attribute.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/store"
+)
+
+// writeTimeout bounds writing an event, which happens after the response.
+const writeTimeout = 5 * time.Second
+
+// EventType is the kind of authentication event.
+type EventType string
+
+const (
+	EventSignUp         EventType = "signup"
+	EventLogin          EventType = "login"
+	EventRefresh        EventType = "refresh"
+	EventLogout         EventType = "logout"
+	EventForgotPassword EventType = "forgot_password"
+	EventResetPassword  EventType = "reset_password"
+	EventChangePassword EventType = "change_password"
+	EventImpersonate    EventType = "impersonate"
+)
+
+// Outcomes of an event.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// OutcomeChallenge is a login that needs another step, such as MFA.
+	OutcomeChallenge = "challenge"
+)
+
+// Event is an authentication attempt.
+type Event struct {
+	Date      string    `json:"-" dynamodbav:"date"`
+	ID        string    `json:"id" dynamodbav:"id" example:"01J9Z6M3T4V5W6X7Y8Z9A0B1C2"`
+	Type      EventType `json:"type" dynamodbav:"type" example:"login"`
+	Email     string    `json:"email,omitempty" dynamodbav:"email,omitempty" example:"user@example.com"`
+	UserID    string    `json:"user_id,omitempty" dynamodbav:"user_id,omitempty"`
+	IP        string    `json:"ip" dynamodbav:"ip" example:"203.0.113.10"`
+	UserAgent string    `json:"user_agent,omitempty" dynamodbav:"user_agent,omitempty"`
+	Outcome   string    `json:"outcome" dynamodbav:"outcome" example:"failure"`
+	// Reason explains a failure, names the challenge, or gives the admin's
+	// reason for impersonating a user.
+	Reason    string    `json:"reason,omitempty" dynamodbav:"reason,omitempty" example:"invalid email or password"`
+	Time      time.Time `json:"time" dynamodbav:"time"`
+	ExpiresAt int64     `json:"-" dynamodbav:"expires_at"`
+}
+
+// NewEvent returns an event of type typ for email, failed if err is set.
+func NewEvent(typ EventType, email string, err error) Event {
+	if err != nil {
+		return Event{Type: typ, Email: email, Outcome: OutcomeFailure, Reason: err.Error()}
+	}
+	return Event{Type: typ, Email: email, Outcome: OutcomeSuccess}
+}
+
+// Filter narrows a query to one day's events. Empty fields match anything.
+type Filter struct {
+	Date    time.Time
+	Email   string
+	IP      string
+	Type    EventType
+	Outcome string
+}
+
+// Log records authentication events.
+type Log struct {
+	client    *dynamodb.Client
+	table     string
+	retention time.Duration
+	logger    *slog.Logger
+}
+
+// New returns a Log. Events are only logged if cfg has no table.
+func New(client *dynamodb.Client, cfg config.AuditConfig, logger *slog.Logger) *Log {
+	return &Log{
+		client:    client,
+		table:     cfg.Table,
+		retention: cfg.Retention,
+		logger:    logger,
+	}
+}
+
+// Enabled reports whether events are stored and can be queried.
+func (l *Log) Enabled() bool {
+	return l.table != ""
+}
+
+// Record records event as made by r's client. Storing it doesn't hold up
+// the response; failures are logged.
+func (l *Log) Record(r *http.Request, event Event) {
+	now := time.Now().UTC()
+	event.ID = store.NewULID()
+	event.Date = now.Format(time.DateOnly)
+	event.Time = now
+	event.ExpiresAt = now.Add(l.retention).Unix()
+	event.IP = clientIP(r)
+	event.UserAgent = r.UserAgent()
+	if event.UserID == "" {
+		event.UserID, _ = auth.GetUserID(r.Context())
+	}
+
+	l.logger.InfoContext(r.Context(), "auth event",
+		"event", event.Type,
+		"outcome", event.Outcome,
+		"reason", event.Reason,
+		"email", event.Email,
+		"user_id", event.UserID,
+		"ip", event.IP,
+		"user_agent", event.UserAgent,
+	)
+
+	if !l.Enabled() {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), writeTimeout)
+		defer cancel()
+		if err := l.put(ctx, event); err != nil {
+			l.logger.ErrorContext(ctx, "failed to store auth event", "error", err, "event_id", event.ID)
+		}
+	}()
+}
+
+// put writes an event to the table.
+func (l *Log) put(ctx context.Context, event Event) error {
+	item, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		return fmt.Errorf("marshal auth event: %w", err)
+	}
+	_, err = l.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("put auth event to %s: %w", l.table, err)
+	}
+	return nil
+}
+
+// Query returns up to limit events matching filter, newest first.
+func (l *Log) Query(ctx context.Context, filter Filter, limit int) ([]Event, error) {
+	// date, type, and others are reserved words, so every attribute goes
+	// through a name placeholder.
+	names := map[string]string{"#date": "date"}
+	values := map[string]types.AttributeValue{
+		":date": &types.AttributeValueMemberS{Value: filter.Date.UTC().Format(time.DateOnly)},
+	}
+	var conditions []string
+	for _, f := range []struct{ attr, value string }{
+		{"email", filter.Email},
+		{"ip", filter.IP},
+		{"type", string(filter.Type)},
+		{"outcome", filter.Outcome},
+	} {
+		if f.value == "" {
+			continue
+		}
+		names["#"+f.attr] = f.attr
+		values[":"+f.attr] = &types.AttributeValueMemberS{Value: f.value}
+		conditions = append(conditions, "#"+f.attr+" = :"+f.attr)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(l.table),
+		KeyConditionExpression:    aws.String("#date = :date"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+	}
+	if len(conditions) > 0 {
+		input.FilterExpression = aws.String(strings.Join(conditions, " AND "))
+	}
+
+	events := []Event{}
+	paginator := dynamodb.NewQueryPaginator(l.client, input)
+	for paginator.HasMorePages() && len(events) < limit {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", l.table, err)
+		}
+		var pageEvents []Event
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageEvents); err != nil {
+			return nil, fmt.Errorf("unmarshal auth events: %w", err)
+		}
+		events = append(events, pageEvents...)
+	}
+
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// clientIP returns the address of r's client, or of the load balancer in
+// front of the server if it isn't a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
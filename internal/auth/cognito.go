@@ -5,35 +5,54 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
-	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/pmollerus23/go-aws-server/internal/config"
 )
 
 var (
-	ErrInvalidCredentials   = errors.New("invalid email or password")
-	ErrUserAlreadyExists    = errors.New("user already exists")
-	ErrUserNotConfirmed     = errors.New("user email not verified")
-	ErrInvalidVerification  = errors.New("invalid verification code")
+	ErrInvalidCredentials    = errors.New("invalid email or password")
+	ErrUserAlreadyExists     = errors.New("user already exists")
+	ErrUserNotConfirmed      = errors.New("user email not verified")
+	ErrInvalidVerification   = errors.New("invalid verification code")
 	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrIncorrectPassword     = errors.New("current password is incorrect")
+	ErrInvalidPassword       = errors.New("password does not meet the password policy")
+	ErrTooManyAttempts       = errors.New("too many attempts, try again later")
+	ErrInvalidAttribute      = errors.New("invalid user attribute")
+	ErrEmailInUse            = errors.New("email is already in use")
+	ErrSessionExpired        = errors.New("session expired, log in again")
 )
 
 // CognitoService handles AWS Cognito authentication operations.
 type CognitoService struct {
-	client       *cognito.Client
-	cfg          config.CognitoConfig
-	logger       *slog.Logger
-	jwksCache    jwk.Set
-	jwksURL      string
-	cacheExpiry  time.Time
+	client *cognito.Client
+	cfg    config.CognitoConfig
+	logger *slog.Logger
+	keys   *jwksCache
+	legacy LegacyDirectory
+	// http calls the hosted UI's token endpoint for federated sign-in.
+	http *http.Client
+	// secret is the app client secret, replaced when it is rotated.
+	secret atomic.Pointer[string]
+
+	// policyMu guards the cached password policy.
+	policyMu       sync.Mutex
+	policy         *PasswordPolicy
+	policyLoadedAt time.Time
 }
 
 // NewCognitoService creates a new Cognito service.
@@ -41,12 +60,32 @@ func NewCognitoService(client *cognito.Client, cfg config.CognitoConfig, logger
 	jwksURL := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s/.well-known/jwks.json",
 		cfg.Region, cfg.UserPoolID)
 
-	return &CognitoService{
-		client:  client,
-		cfg:     cfg,
-		logger:  logger,
-		jwksURL: jwksURL,
+	s := &CognitoService{
+		client: client,
+		cfg:    cfg,
+		logger: logger,
+		keys:   newJWKSCache(jwksURL, cfg.JWKSMaxStaleness, logger),
+		http:   &http.Client{Timeout: 10 * time.Second},
 	}
+	s.SetClientSecret(cfg.ClientSecret)
+	return s
+}
+
+// SetClientSecret replaces the app client secret, such as after it is
+// rotated in Secrets Manager.
+func (s *CognitoService) SetClientSecret(secret string) {
+	s.secret.Store(&secret)
+}
+
+// clientSecret returns the app client secret.
+func (s *CognitoService) clientSecret() string {
+	return *s.secret.Load()
+}
+
+// Start keeps the token verification keys warm in the background until ctx
+// is cancelled, so requests never wait on the JWKS endpoint.
+func (s *CognitoService) Start(ctx context.Context) {
+	s.keys.start(ctx)
 }
 
 // SignUp registers a new user with Cognito.
@@ -111,57 +150,128 @@ func (s *CognitoService) ConfirmSignUp(ctx context.Context, email, code string)
 	return nil
 }
 
-// Login authenticates a user and returns JWT tokens.
-func (s *CognitoService) Login(ctx context.Context, email, password string) (*CognitoTokens, error) {
-	secretHash := s.calculateSecretHash(email)
+// Login authenticates a user and returns JWT tokens, or the challenge the
+// user must answer first when Cognito requires one, such as an SMS MFA code.
+// The password is sent to Cognito, or proven with SRP, per the configured
+// auth flow. Logins with a remembered device's credentials skip MFA when the
+// user pool allows. With a legacy directory set, users missing from the user
+// pool are migrated from it first.
+func (s *CognitoService) Login(ctx context.Context, email, password string, device *DeviceCredentials) (*Tokens, *Challenge, error) {
+	return s.login(ctx, email, password, device, s.legacy != nil)
+}
 
-	input := &cognito.InitiateAuthInput{
-		AuthFlow: types.AuthFlowTypeUserPasswordAuth,
-		ClientId: aws.String(s.cfg.ClientID),
-		AuthParameters: map[string]string{
+// login authenticates a user, migrating them from the legacy directory if
+// migrate is set and Cognito doesn't know them.
+func (s *CognitoService) login(ctx context.Context, email, password string, device *DeviceCredentials, migrate bool) (*Tokens, *Challenge, error) {
+	var result *cognito.InitiateAuthOutput
+	var err error
+	if s.cfg.AuthFlow == config.CognitoAuthFlowSRP {
+		result, err = s.srpAuth(ctx, email, password, device)
+	} else {
+		params := map[string]string{
 			"USERNAME":    email,
 			"PASSWORD":    password,
-			"SECRET_HASH": secretHash,
-		},
+			"SECRET_HASH": s.calculateSecretHash(email),
+		}
+		if device != nil {
+			params["DEVICE_KEY"] = device.Key
+		}
+		result, err = s.client.InitiateAuth(ctx, &cognito.InitiateAuthInput{
+			AuthFlow:       types.AuthFlowTypeUserPasswordAuth,
+			ClientId:       aws.String(s.cfg.ClientID),
+			AuthParameters: params,
+		})
+	}
+	if err == nil && result.ChallengeName == types.ChallengeNameTypeDeviceSrpAuth {
+		result, err = s.deviceSRPAuth(ctx, result, device)
 	}
-
-	result, err := s.client.InitiateAuth(ctx, input)
 	if err != nil {
 		var notAuthorized *types.NotAuthorizedException
 		var userNotConfirmed *types.UserNotConfirmedException
 		var passwordReset *types.PasswordResetRequiredException
+		var userNotFound *types.UserNotFoundException
 
 		if errors.As(err, &notAuthorized) {
-			return nil, ErrInvalidCredentials
+			return nil, nil, ErrInvalidCredentials
+		}
+		if errors.As(err, &userNotFound) {
+			if !migrate {
+				return nil, nil, ErrInvalidCredentials
+			}
+			if err := s.migrateUser(ctx, email, password); err != nil {
+				return nil, nil, err
+			}
+			return s.login(ctx, email, password, device, false)
 		}
 		if errors.As(err, &userNotConfirmed) {
-			return nil, ErrUserNotConfirmed
+			return nil, nil, ErrUserNotConfirmed
 		}
 		if errors.As(err, &passwordReset) {
-			return nil, ErrPasswordResetRequired
+			return nil, nil, ErrPasswordResetRequired
 		}
 
-		return nil, fmt.Errorf("cognito login failed: %w", err)
+		return nil, nil, fmt.Errorf("cognito login failed: %w", err)
 	}
 
-	if result.AuthenticationResult == nil {
-		return nil, fmt.Errorf("authentication result is nil")
+	if result.ChallengeName != "" {
+		s.logger.Info("login challenge issued", "email", email, "challenge", result.ChallengeName)
+		return nil, newChallenge(result.ChallengeName, result.Session, result.ChallengeParameters), nil
 	}
 
-	tokens := &CognitoTokens{
-		AccessToken:  aws.ToString(result.AuthenticationResult.AccessToken),
-		IDToken:      aws.ToString(result.AuthenticationResult.IdToken),
-		RefreshToken: aws.ToString(result.AuthenticationResult.RefreshToken),
-		ExpiresIn:    result.AuthenticationResult.ExpiresIn,
-		TokenType:    aws.ToString(result.AuthenticationResult.TokenType),
+	if result.AuthenticationResult == nil {
+		return nil, nil, fmt.Errorf("authentication result is nil")
 	}
 
 	s.logger.Info("user logged in successfully", "email", email)
-	return tokens, nil
+	return newTokens(result.AuthenticationResult), nil, nil
+}
+
+// RespondToSMSMFA completes a login that returned an SMS_MFA challenge with
+// the code texted to the user.
+func (s *CognitoService) RespondToSMSMFA(ctx context.Context, email, session, code string) (*Tokens, error) {
+	input := &cognito.RespondToAuthChallengeInput{
+		ChallengeName: types.ChallengeNameTypeSmsMfa,
+		ClientId:      aws.String(s.cfg.ClientID),
+		Session:       aws.String(session),
+		ChallengeResponses: map[string]string{
+			"USERNAME":     email,
+			"SMS_MFA_CODE": code,
+			"SECRET_HASH":  s.calculateSecretHash(email),
+		},
+	}
+
+	result, err := s.client.RespondToAuthChallenge(ctx, input)
+	if err != nil {
+		var codeExpired *types.ExpiredCodeException
+		var codeMismatch *types.CodeMismatchException
+		var notAuthorized *types.NotAuthorizedException
+		var tooManyAttempts *types.TooManyFailedAttemptsException
+
+		if errors.As(err, &codeExpired) || errors.As(err, &codeMismatch) {
+			return nil, ErrInvalidVerification
+		}
+		if errors.As(err, &notAuthorized) {
+			// Sessions are single-use and expire after a few minutes.
+			return nil, ErrSessionExpired
+		}
+		if errors.As(err, &tooManyAttempts) {
+			return nil, ErrTooManyAttempts
+		}
+
+		return nil, fmt.Errorf("cognito respond to MFA challenge failed: %w", err)
+	}
+
+	if result.AuthenticationResult == nil {
+		return nil, fmt.Errorf("authentication result is nil")
+	}
+
+	s.logger.Info("user logged in successfully", "email", email, "mfa", true)
+	return newTokens(result.AuthenticationResult), nil
 }
 
 // RefreshToken refreshes access and ID tokens using a refresh token.
-func (s *CognitoService) RefreshToken(ctx context.Context, refreshToken, email string) (*CognitoTokens, error) {
+// Tokens issued to a tracked device must be refreshed with its device key.
+func (s *CognitoService) RefreshToken(ctx context.Context, refreshToken, email, deviceKey string) (*Tokens, error) {
 	secretHash := s.calculateSecretHash(email)
 
 	input := &cognito.InitiateAuthInput{
@@ -172,6 +282,9 @@ func (s *CognitoService) RefreshToken(ctx context.Context, refreshToken, email s
 			"SECRET_HASH":   secretHash,
 		},
 	}
+	if deviceKey != "" {
+		input.AuthParameters["DEVICE_KEY"] = deviceKey
+	}
 
 	result, err := s.client.InitiateAuth(ctx, input)
 	if err != nil {
@@ -182,7 +295,7 @@ func (s *CognitoService) RefreshToken(ctx context.Context, refreshToken, email s
 		return nil, fmt.Errorf("authentication result is nil")
 	}
 
-	tokens := &CognitoTokens{
+	tokens := &Tokens{
 		AccessToken: aws.ToString(result.AuthenticationResult.AccessToken),
 		IDToken:     aws.ToString(result.AuthenticationResult.IdToken),
 		ExpiresIn:   result.AuthenticationResult.ExpiresIn,
@@ -193,17 +306,45 @@ func (s *CognitoService) RefreshToken(ctx context.Context, refreshToken, email s
 	return tokens, nil
 }
 
+// RevokeToken revokes a refresh token and the access tokens issued with it,
+// without signing the user out of other devices. Access tokens keep
+// passing ValidateToken, which checks signatures locally, until they expire.
+func (s *CognitoService) RevokeToken(ctx context.Context, refreshToken string) error {
+	_, err := s.client.RevokeToken(ctx, &cognito.RevokeTokenInput{
+		Token:        aws.String(refreshToken),
+		ClientId:     aws.String(s.cfg.ClientID),
+		ClientSecret: aws.String(s.clientSecret()),
+	})
+	if err != nil {
+		var unsupportedToken *types.UnsupportedTokenTypeException
+		var unsupportedOperation *types.UnsupportedOperationException
+
+		if errors.As(err, &unsupportedToken) {
+			return ErrInvalidToken
+		}
+		if errors.As(err, &unsupportedOperation) {
+			// Token revocation is disabled on the app client.
+			return ErrNotSupported
+		}
+		return fmt.Errorf("cognito revoke token failed: %w", err)
+	}
+
+	s.logger.Info("refresh token revoked")
+	return nil
+}
+
 // ValidateToken validates a JWT token from Cognito using JWKS.
 func (s *CognitoService) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
-	// Refresh JWKS cache if expired
-	if err := s.refreshJWKSCache(ctx); err != nil {
+	// Load verification keys, refreshing them if expired
+	keys, err := s.keys.currentKeys(ctx)
+	if err != nil {
 		return nil, fmt.Errorf("failed to refresh JWKS cache: %w", err)
 	}
 
 	// Parse and validate token
 	token, err := jwt.Parse(
 		[]byte(tokenString),
-		jwt.WithKeySet(s.jwksCache),
+		jwt.WithKeyProvider(keys),
 		jwt.WithValidate(true),
 	)
 	if err != nil {
@@ -218,19 +359,38 @@ func (s *CognitoService) ValidateToken(ctx context.Context, tokenString string)
 		return nil, ErrInvalidToken
 	}
 
-	// Verify token use (should be "access" for access tokens)
-	tokenUse, ok := token.Get("token_use")
-	if !ok || tokenUse != "access" {
+	// Verify token use: access tokens, or, if accepted, ID tokens issued
+	// to this app client
+	tokenUse, _ := token.Get("token_use")
+	switch {
+	case tokenUse == "access":
+	case tokenUse == "id" && s.cfg.AcceptIDTokens:
+		if !slices.Contains(token.Audience(), s.cfg.ClientID) {
+			return nil, ErrInvalidToken
+		}
+	default:
 		return nil, ErrInvalidToken
 	}
 
 	// Extract claims
 	claims := &Claims{
 		UserID:    token.Subject(),
+		TokenUse:  tokenUse.(string),
 		ExpiresAt: token.Expiration().Unix(),
 		IssuedAt:  token.IssuedAt().Unix(),
 	}
 
+	// Extract scopes, which access tokens carry
+	if scope, ok := token.Get("scope"); ok {
+		claims.Scopes = tokenScopes(scope)
+	}
+
+	// Tokens from the client credentials grant are issued to the app client
+	// itself: their subject is the client's ID
+	if clientID, ok := token.Get("client_id"); ok && clientID == token.Subject() {
+		claims.Client = true
+	}
+
 	// Extract cognito:username
 	if username, ok := token.Get("cognito:username"); ok {
 		if usernameStr, ok := username.(string); ok {
@@ -238,19 +398,30 @@ func (s *CognitoService) ValidateToken(ctx context.Context, tokenString string)
 		}
 	}
 
-	// Extract email
+	// Extract email and name, which only ID tokens carry
 	if email, ok := token.Get("email"); ok {
 		if emailStr, ok := email.(string); ok {
 			claims.Email = emailStr
 		}
 	}
+	if name, ok := token.Get("name"); ok {
+		if nameStr, ok := name.(string); ok {
+			claims.Name = nameStr
+		}
+	}
 
-	// Extract cognito:groups (roles)
+	// Extract cognito:groups (roles). Cognito puts federated users in a
+	// group named after the user pool and their identity provider, e.g.
+	// "us-east-1_abc123_Google", which names the provider rather than a role.
 	if groups, ok := token.Get("cognito:groups"); ok {
 		if groupsSlice, ok := groups.([]interface{}); ok {
 			roles := make([]string, 0, len(groupsSlice))
 			for _, g := range groupsSlice {
 				if role, ok := g.(string); ok {
+					if provider, ok := strings.CutPrefix(role, s.cfg.UserPoolID+"_"); ok {
+						claims.Provider = provider
+						continue
+					}
 					roles = append(roles, role)
 				}
 			}
@@ -314,45 +485,207 @@ func (s *CognitoService) ConfirmForgotPassword(ctx context.Context, email, code,
 	return nil
 }
 
+// ChangePassword changes the password of the user the access token belongs to.
+func (s *CognitoService) ChangePassword(ctx context.Context, accessToken, currentPassword, newPassword string) error {
+	input := &cognito.ChangePasswordInput{
+		AccessToken:      aws.String(accessToken),
+		PreviousPassword: aws.String(currentPassword),
+		ProposedPassword: aws.String(newPassword),
+	}
+
+	_, err := s.client.ChangePassword(ctx, input)
+	if err != nil {
+		var notAuthorized *types.NotAuthorizedException
+		var invalidPassword *types.InvalidPasswordException
+		var limitExceeded *types.LimitExceededException
+		var tooManyRequests *types.TooManyRequestsException
+
+		if errors.As(err, &notAuthorized) {
+			return ErrIncorrectPassword
+		}
+		if errors.As(err, &invalidPassword) {
+			return ErrInvalidPassword
+		}
+		if errors.As(err, &limitExceeded) || errors.As(err, &tooManyRequests) {
+			return ErrTooManyAttempts
+		}
+
+		return fmt.Errorf("cognito change password failed: %w", err)
+	}
+
+	s.logger.Info("password changed successfully")
+	return nil
+}
+
+// UpdateUserAttributes updates attributes of the user the access token belongs
+// to. It returns the attributes Cognito sent a verification code for, such as
+// email when the address changes.
+func (s *CognitoService) UpdateUserAttributes(ctx context.Context, accessToken string, attributes map[string]string) ([]string, error) {
+	input := &cognito.UpdateUserAttributesInput{
+		AccessToken:    aws.String(accessToken),
+		UserAttributes: make([]types.AttributeType, 0, len(attributes)),
+	}
+	for name, value := range attributes {
+		input.UserAttributes = append(input.UserAttributes, types.AttributeType{
+			Name:  aws.String(name),
+			Value: aws.String(value),
+		})
+	}
+
+	result, err := s.client.UpdateUserAttributes(ctx, input)
+	if err != nil {
+		var invalidParameter *types.InvalidParameterException
+		var aliasExists *types.AliasExistsException
+		var limitExceeded *types.LimitExceededException
+		var tooManyRequests *types.TooManyRequestsException
+
+		if errors.As(err, &invalidParameter) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAttribute, aws.ToString(invalidParameter.Message))
+		}
+		if errors.As(err, &aliasExists) {
+			return nil, ErrEmailInUse
+		}
+		if errors.As(err, &limitExceeded) || errors.As(err, &tooManyRequests) {
+			return nil, ErrTooManyAttempts
+		}
+
+		return nil, fmt.Errorf("cognito update user attributes failed: %w", err)
+	}
+
+	pending := make([]string, 0, len(result.CodeDeliveryDetailsList))
+	for _, details := range result.CodeDeliveryDetailsList {
+		pending = append(pending, aws.ToString(details.AttributeName))
+	}
+
+	s.logger.Info("user attributes updated", "count", len(attributes), "pending_verification", pending)
+	return pending, nil
+}
+
+// VerifyUserAttribute confirms a changed attribute, such as a new email
+// address, with the code Cognito sent to it.
+func (s *CognitoService) VerifyUserAttribute(ctx context.Context, accessToken, attribute, code string) error {
+	input := &cognito.VerifyUserAttributeInput{
+		AccessToken:   aws.String(accessToken),
+		AttributeName: aws.String(attribute),
+		Code:          aws.String(code),
+	}
+
+	_, err := s.client.VerifyUserAttribute(ctx, input)
+	if err != nil {
+		var codeExpired *types.ExpiredCodeException
+		var codeMismatch *types.CodeMismatchException
+		var limitExceeded *types.LimitExceededException
+
+		if errors.As(err, &codeExpired) || errors.As(err, &codeMismatch) {
+			return ErrInvalidVerification
+		}
+		if errors.As(err, &limitExceeded) {
+			return ErrTooManyAttempts
+		}
+
+		return fmt.Errorf("cognito verify user attribute failed: %w", err)
+	}
+
+	s.logger.Info("user attribute verified", "attribute", attribute)
+	return nil
+}
+
+// RespondToNewPasswordRequired completes a login that returned a
+// NEW_PASSWORD_REQUIRED challenge, as it does for admin-created users with a
+// temporary password, by setting a permanent password. Attributes supplies
+// any the challenge listed as required. Cognito may answer with a further
+// challenge, such as SMS MFA, instead of tokens.
+func (s *CognitoService) RespondToNewPasswordRequired(ctx context.Context, email, session, newPassword string, attributes map[string]string) (*Tokens, *Challenge, error) {
+	responses := map[string]string{
+		"USERNAME":     email,
+		"NEW_PASSWORD": newPassword,
+		"SECRET_HASH":  s.calculateSecretHash(email),
+	}
+	for name, value := range attributes {
+		responses["userAttributes."+name] = value
+	}
+
+	input := &cognito.RespondToAuthChallengeInput{
+		ChallengeName:      types.ChallengeNameTypeNewPasswordRequired,
+		ClientId:           aws.String(s.cfg.ClientID),
+		Session:            aws.String(session),
+		ChallengeResponses: responses,
+	}
+
+	result, err := s.client.RespondToAuthChallenge(ctx, input)
+	if err != nil {
+		var invalidPassword *types.InvalidPasswordException
+		var invalidParameter *types.InvalidParameterException
+		var notAuthorized *types.NotAuthorizedException
+
+		if errors.As(err, &invalidPassword) {
+			return nil, nil, ErrInvalidPassword
+		}
+		if errors.As(err, &invalidParameter) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrInvalidAttribute, aws.ToString(invalidParameter.Message))
+		}
+		if errors.As(err, &notAuthorized) {
+			return nil, nil, ErrSessionExpired
+		}
+
+		return nil, nil, fmt.Errorf("cognito respond to new password challenge failed: %w", err)
+	}
+
+	if result.ChallengeName != "" {
+		s.logger.Info("login challenge issued", "email", email, "challenge", result.ChallengeName)
+		return nil, newChallenge(result.ChallengeName, result.Session, result.ChallengeParameters), nil
+	}
+
+	if result.AuthenticationResult == nil {
+		return nil, nil, fmt.Errorf("authentication result is nil")
+	}
+
+	s.logger.Info("user set new password and logged in", "email", email)
+	return newTokens(result.AuthenticationResult), nil, nil
+}
+
 // calculateSecretHash calculates the secret hash required for Cognito API calls.
 func (s *CognitoService) calculateSecretHash(username string) string {
 	message := username + s.cfg.ClientID
-	key := []byte(s.cfg.ClientSecret)
+	key := []byte(s.clientSecret())
 	h := hmac.New(sha256.New, key)
 	h.Write([]byte(message))
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
-// refreshJWKSCache refreshes the JWKS cache if it's expired or not yet loaded.
-func (s *CognitoService) refreshJWKSCache(ctx context.Context) error {
-	// Check if cache is still valid
-	if s.jwksCache != nil && time.Now().Before(s.cacheExpiry) {
-		return nil
+// newTokens converts a Cognito authentication result to tokens.
+func newTokens(result *types.AuthenticationResultType) *Tokens {
+	tokens := &Tokens{
+		AccessToken:  aws.ToString(result.AccessToken),
+		IDToken:      aws.ToString(result.IdToken),
+		RefreshToken: aws.ToString(result.RefreshToken),
+		ExpiresIn:    result.ExpiresIn,
+		TokenType:    aws.ToString(result.TokenType),
 	}
-
-	// Fetch JWKS
-	cache := jwk.NewCache(ctx)
-	if err := cache.Register(s.jwksURL); err != nil {
-		return fmt.Errorf("failed to register JWKS URL: %w", err)
+	if d := result.NewDeviceMetadata; d != nil {
+		tokens.NewDevice = &NewDevice{
+			DeviceKey:      aws.ToString(d.DeviceKey),
+			DeviceGroupKey: aws.ToString(d.DeviceGroupKey),
+		}
 	}
+	return tokens
+}
 
-	cached, err := cache.Refresh(ctx, s.jwksURL)
-	if err != nil {
-		return fmt.Errorf("failed to refresh JWKS: %w", err)
+// newChallenge converts a Cognito challenge to a Challenge.
+func newChallenge(name types.ChallengeNameType, session *string, params map[string]string) *Challenge {
+	challenge := &Challenge{
+		Name:        string(name),
+		Session:     aws.ToString(session),
+		Destination: params["CODE_DELIVERY_DESTINATION"],
 	}
 
-	s.jwksCache = cached
-	s.cacheExpiry = time.Now().Add(1 * time.Hour) // Cache for 1 hour
-
-	s.logger.Info("JWKS cache refreshed")
-	return nil
-}
+	// requiredAttributes is a JSON array of names like "userAttributes.name".
+	var required []string
+	if err := json.Unmarshal([]byte(params["requiredAttributes"]), &required); err == nil {
+		for _, attr := range required {
+			challenge.RequiredAttributes = append(challenge.RequiredAttributes, strings.TrimPrefix(attr, "userAttributes."))
+		}
+	}
 
-// CognitoTokens represents tokens returned from Cognito authentication.
-type CognitoTokens struct {
-	AccessToken  string `json:"access_token"`
-	IDToken      string `json:"id_token"`
-	RefreshToken string `json:"refresh_token,omitempty"`
-	ExpiresIn    int32  `json:"expires_in"`
-	TokenType    string `json:"token_type"`
+	return challenge
 }
@@ -9,12 +9,14 @@ import (
 type contextKey string
 
 const (
-	userContextKey contextKey = "user"
+	userContextKey        contextKey = "user"
+	accessTokenContextKey contextKey = "access_token"
 )
 
 // Errors
 var (
-	ErrNoUserInContext = errors.New("no user found in context")
+	ErrNoUserInContext        = errors.New("no user found in context")
+	ErrNoAccessTokenInContext = errors.New("no access token found in context")
 )
 
 // WithUser adds a user to the request context.
@@ -22,6 +24,21 @@ func WithUser(ctx context.Context, user *User) context.Context {
 	return context.WithValue(ctx, userContextKey, user)
 }
 
+// WithAccessToken adds the caller's validated access token to the request context.
+func WithAccessToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, accessTokenContextKey, token)
+}
+
+// GetAccessToken retrieves the caller's access token from the request context,
+// for Cognito calls that act on behalf of the user.
+func GetAccessToken(ctx context.Context) (string, error) {
+	token, ok := ctx.Value(accessTokenContextKey).(string)
+	if !ok || token == "" {
+		return "", ErrNoAccessTokenInContext
+	}
+	return token, nil
+}
+
 // GetUser retrieves the user from the request context.
 func GetUser(ctx context.Context) (*User, error) {
 	user, ok := ctx.Value(userContextKey).(*User)
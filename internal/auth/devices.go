@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+// ErrDeviceNotFound is returned when forgetting a device the user doesn't have.
+var ErrDeviceNotFound = errors.New("device not found")
+
+// NewDevice identifies a device Cognito started tracking at login. It can
+// be remembered with RememberDevice.
+type NewDevice struct {
+	DeviceKey      string `json:"device_key" example:"us-east-1_a1b2c3d4-5678-90ab-cdef-EXAMPLE11111"`
+	DeviceGroupKey string `json:"device_group_key" example:"-abcdEFGH"`
+}
+
+// DeviceCredentials let a remembered device skip MFA on login. The client
+// keeps them and sends them with later logins; the password is generated
+// by the server and known only to the client and Cognito's verifier.
+type DeviceCredentials struct {
+	Key      string `json:"device_key" example:"us-east-1_a1b2c3d4-5678-90ab-cdef-EXAMPLE11111"`
+	GroupKey string `json:"device_group_key" example:"-abcdEFGH"`
+	Password string `json:"device_password"`
+}
+
+// Device is a device Cognito tracks for a user.
+type Device struct {
+	Key                 string    `json:"device_key" example:"us-east-1_a1b2c3d4-5678-90ab-cdef-EXAMPLE11111"`
+	Name                string    `json:"name,omitempty" example:"Firefox on Linux"`
+	Remembered          bool      `json:"remembered"`
+	LastIPUsed          string    `json:"last_ip_used,omitempty" example:"203.0.113.10"`
+	CreatedAt           time.Time `json:"created_at"`
+	LastAuthenticatedAt time.Time `json:"last_authenticated_at"`
+}
+
+// RememberDevice confirms a device returned at login and marks it
+// remembered, so logins from it skip MFA when the user pool allows. It
+// returns the credentials the device must present on later logins.
+func (s *CognitoService) RememberDevice(ctx context.Context, accessToken string, device NewDevice, name string) (*DeviceCredentials, error) {
+	secret := make([]byte, 40)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate device password: %w", err)
+	}
+	password := base64.StdEncoding.EncodeToString(secret)
+
+	verifier, salt, err := srpVerifier(device.DeviceGroupKey, device.DeviceKey, password)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &cognito.ConfirmDeviceInput{
+		AccessToken: aws.String(accessToken),
+		DeviceKey:   aws.String(device.DeviceKey),
+		DeviceSecretVerifierConfig: &types.DeviceSecretVerifierConfigType{
+			PasswordVerifier: aws.String(base64.StdEncoding.EncodeToString(srpPad(verifier))),
+			Salt:             aws.String(base64.StdEncoding.EncodeToString(srpPad(salt))),
+		},
+	}
+	if name != "" {
+		input.DeviceName = aws.String(name)
+	}
+	if _, err := s.client.ConfirmDevice(ctx, input); err != nil {
+		return nil, deviceError("confirm device", err)
+	}
+
+	_, err = s.client.UpdateDeviceStatus(ctx, &cognito.UpdateDeviceStatusInput{
+		AccessToken:            aws.String(accessToken),
+		DeviceKey:              aws.String(device.DeviceKey),
+		DeviceRememberedStatus: types.DeviceRememberedStatusTypeRemembered,
+	})
+	if err != nil {
+		return nil, deviceError("update device status", err)
+	}
+
+	s.logger.Info("device remembered", "device_key", device.DeviceKey)
+	return &DeviceCredentials{
+		Key:      device.DeviceKey,
+		GroupKey: device.DeviceGroupKey,
+		Password: password,
+	}, nil
+}
+
+// ListDevices returns the devices Cognito tracks for the user.
+func (s *CognitoService) ListDevices(ctx context.Context, accessToken string) ([]Device, error) {
+	devices := []Device{}
+
+	input := &cognito.ListDevicesInput{AccessToken: aws.String(accessToken)}
+	for {
+		result, err := s.client.ListDevices(ctx, input)
+		if err != nil {
+			return nil, deviceError("list devices", err)
+		}
+		for _, d := range result.Devices {
+			devices = append(devices, newDevice(d))
+		}
+		if result.PaginationToken == nil {
+			break
+		}
+		input.PaginationToken = result.PaginationToken
+	}
+
+	return devices, nil
+}
+
+// ForgetDevice stops tracking a device, so logins from it need MFA again
+// and its credentials stop working.
+func (s *CognitoService) ForgetDevice(ctx context.Context, accessToken, deviceKey string) error {
+	_, err := s.client.ForgetDevice(ctx, &cognito.ForgetDeviceInput{
+		AccessToken: aws.String(accessToken),
+		DeviceKey:   aws.String(deviceKey),
+	})
+	if err != nil {
+		return deviceError("forget device", err)
+	}
+
+	s.logger.Info("device forgotten", "device_key", deviceKey)
+	return nil
+}
+
+// deviceSRPAuth answers a DEVICE_SRP_AUTH challenge, proving the login
+// comes from a remembered device.
+func (s *CognitoService) deviceSRPAuth(ctx context.Context, challenge *cognito.InitiateAuthOutput, device *DeviceCredentials) (*cognito.InitiateAuthOutput, error) {
+	if device == nil {
+		return nil, errors.New("device challenge issued without device credentials")
+	}
+	username := challenge.ChallengeParameters["USERNAME"]
+
+	client, err := newSRPClient()
+	if err != nil {
+		return nil, err
+	}
+	verifierChallenge, err := s.client.RespondToAuthChallenge(ctx, &cognito.RespondToAuthChallengeInput{
+		ChallengeName: types.ChallengeNameTypeDeviceSrpAuth,
+		ClientId:      aws.String(s.cfg.ClientID),
+		Session:       challenge.Session,
+		ChallengeResponses: map[string]string{
+			"USERNAME":    username,
+			"DEVICE_KEY":  device.Key,
+			"SRP_A":       client.bigA.Text(16),
+			"SECRET_HASH": s.calculateSecretHash(username),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if verifierChallenge.ChallengeName != types.ChallengeNameTypeDevicePasswordVerifier {
+		return initiateAuthOutput(verifierChallenge), nil
+	}
+
+	claim, err := client.passwordClaim(verifierChallenge.ChallengeParameters, device.GroupKey, device.Key, device.Password)
+	if err != nil {
+		return nil, err
+	}
+	claim["USERNAME"] = username
+	claim["DEVICE_KEY"] = device.Key
+	claim["SECRET_HASH"] = s.calculateSecretHash(username)
+
+	result, err := s.client.RespondToAuthChallenge(ctx, &cognito.RespondToAuthChallengeInput{
+		ChallengeName:      types.ChallengeNameTypeDevicePasswordVerifier,
+		ClientId:           aws.String(s.cfg.ClientID),
+		Session:            verifierChallenge.Session,
+		ChallengeResponses: claim,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return initiateAuthOutput(result), nil
+}
+
+// deviceError maps errors from the device calls.
+func deviceError(op string, err error) error {
+	var resourceNotFound *types.ResourceNotFoundException
+	var notAuthorized *types.NotAuthorizedException
+
+	if errors.As(err, &resourceNotFound) {
+		return ErrDeviceNotFound
+	}
+	if errors.As(err, &notAuthorized) {
+		return ErrInvalidToken
+	}
+	return fmt.Errorf("cognito %s failed: %w", op, err)
+}
+
+// newDevice converts a Cognito device to a Device.
+func newDevice(d types.DeviceType) Device {
+	device := Device{
+		Key:                 aws.ToString(d.DeviceKey),
+		CreatedAt:           aws.ToTime(d.DeviceCreateDate),
+		LastAuthenticatedAt: aws.ToTime(d.DeviceLastAuthenticatedDate),
+	}
+	for _, attr := range d.DeviceAttributes {
+		switch aws.ToString(attr.Name) {
+		case "device_name":
+			device.Name = aws.ToString(attr.Value)
+		case "device_remembered_status":
+			device.Remembered = aws.ToString(attr.Value) == "remembered"
+		case "last_ip_used":
+			device.LastIPUsed = aws.ToString(attr.Value)
+		}
+	}
+	return device
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+var (
+	ErrGroupExists   = errors.New("group already exists")
+	ErrGroupNotFound = errors.New("group not found")
+	ErrUserNotFound  = errors.New("user not found")
+)
+
+// Group is a user pool group. Users' roles are the groups they belong to.
+type Group struct {
+	Name        string    `json:"name" example:"admin"`
+	Description string    `json:"description,omitempty" example:"Administrators"`
+	Precedence  *int32    `json:"precedence,omitempty" example:"0"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateGroup creates a group in the user pool.
+func (s *CognitoService) CreateGroup(ctx context.Context, name, description string, precedence *int32) (*Group, error) {
+	input := &cognito.CreateGroupInput{
+		UserPoolId: aws.String(s.cfg.UserPoolID),
+		GroupName:  aws.String(name),
+		Precedence: precedence,
+	}
+	if description != "" {
+		input.Description = aws.String(description)
+	}
+
+	result, err := s.client.CreateGroup(ctx, input)
+	if err != nil {
+		var groupExists *types.GroupExistsException
+		if errors.As(err, &groupExists) {
+			return nil, ErrGroupExists
+		}
+		return nil, fmt.Errorf("cognito create group failed: %w", err)
+	}
+
+	s.logger.Info("group created", "group", name)
+	return newGroup(result.Group), nil
+}
+
+// ListGroups returns all groups in the user pool.
+func (s *CognitoService) ListGroups(ctx context.Context) ([]Group, error) {
+	groups := []Group{}
+
+	paginator := cognito.NewListGroupsPaginator(s.client, &cognito.ListGroupsInput{
+		UserPoolId: aws.String(s.cfg.UserPoolID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cognito list groups failed: %w", err)
+		}
+		for i := range page.Groups {
+			groups = append(groups, *newGroup(&page.Groups[i]))
+		}
+	}
+
+	return groups, nil
+}
+
+// AddUserToGroup adds a user to a group. The user's tokens include the group
+// from their next login or token refresh.
+func (s *CognitoService) AddUserToGroup(ctx context.Context, email, group string) error {
+	_, err := s.client.AdminAddUserToGroup(ctx, &cognito.AdminAddUserToGroupInput{
+		UserPoolId: aws.String(s.cfg.UserPoolID),
+		Username:   aws.String(email),
+		GroupName:  aws.String(group),
+	})
+	if err != nil {
+		return groupMembershipError("add user to group", err)
+	}
+
+	s.logger.Info("user added to group", "email", email, "group", group)
+	return nil
+}
+
+// RemoveUserFromGroup removes a user from a group. Tokens already issued
+// keep the group until they expire.
+func (s *CognitoService) RemoveUserFromGroup(ctx context.Context, email, group string) error {
+	_, err := s.client.AdminRemoveUserFromGroup(ctx, &cognito.AdminRemoveUserFromGroupInput{
+		UserPoolId: aws.String(s.cfg.UserPoolID),
+		Username:   aws.String(email),
+		GroupName:  aws.String(group),
+	})
+	if err != nil {
+		return groupMembershipError("remove user from group", err)
+	}
+
+	s.logger.Info("user removed from group", "email", email, "group", group)
+	return nil
+}
+
+// groupMembershipError maps errors from the admin group membership calls.
+// Cognito reports a missing group as ResourceNotFoundException.
+func groupMembershipError(op string, err error) error {
+	var userNotFound *types.UserNotFoundException
+	var resourceNotFound *types.ResourceNotFoundException
+
+	if errors.As(err, &userNotFound) {
+		return ErrUserNotFound
+	}
+	if errors.As(err, &resourceNotFound) {
+		return ErrGroupNotFound
+	}
+	return fmt.Errorf("cognito %s failed: %w", op, err)
+}
+
+// newGroup converts a Cognito group to a Group.
+func newGroup(g *types.GroupType) *Group {
+	return &Group{
+		Name:        aws.ToString(g.GroupName),
+		Description: aws.ToString(g.Description),
+		Precedence:  g.Precedence,
+		CreatedAt:   aws.ToTime(g.CreationDate),
+	}
+}
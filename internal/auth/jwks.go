@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+)
+
+const (
+	// jwksCacheTTL is how long a fetched key set is considered fresh.
+	jwksCacheTTL = 1 * time.Hour
+	// jwksRefreshAhead is how long before expiry the background refresher fetches a new key set.
+	jwksRefreshAhead = 5 * time.Minute
+	// jwksFetchAttempts is how many times a single refresh tries the JWKS endpoint.
+	jwksFetchAttempts = 3
+	// jwksRetryBaseDelay is the base delay between fetch attempts within a refresh.
+	jwksRetryBaseDelay = 200 * time.Millisecond
+	// jwksRefreshBaseBackoff and jwksRefreshMaxBackoff bound how long failed
+	// refreshes are suppressed while a stale key set is being served.
+	jwksRefreshBaseBackoff = 5 * time.Second
+	jwksRefreshMaxBackoff  = 5 * time.Minute
+)
+
+// verificationKey is a parsed public key and the algorithm it may be used with.
+type verificationKey struct {
+	alg jwa.SignatureAlgorithm
+	key interface{}
+}
+
+// jwksSnapshot is an immutable set of verification keys indexed by key ID.
+// Snapshots are replaced wholesale on refresh, so readers need no locking.
+type jwksSnapshot struct {
+	keys      map[string]verificationKey
+	fetchedAt time.Time
+	expiresAt time.Time
+}
+
+// newJWKSSnapshot parses every key in the set up front so token validation
+// doesn't repeat the work on each request.
+func newJWKSSnapshot(set jwk.Set, now time.Time) (*jwksSnapshot, error) {
+	keys := make(map[string]verificationKey, set.Len())
+	for i := 0; i < set.Len(); i++ {
+		key, ok := set.Key(i)
+		if !ok {
+			continue
+		}
+
+		// Cognito always publishes RS256 keys, as do most OIDC providers;
+		// default to it if alg is omitted.
+		alg := jwa.RS256
+		if key.Algorithm().String() != "" {
+			if err := alg.Accept(key.Algorithm().String()); err != nil {
+				return nil, fmt.Errorf("key %q: %w", key.KeyID(), err)
+			}
+		}
+
+		var raw interface{}
+		if err := key.Raw(&raw); err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.KeyID(), err)
+		}
+
+		keys[key.KeyID()] = verificationKey{alg: alg, key: raw}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("key set contains no usable keys")
+	}
+
+	return &jwksSnapshot{
+		keys:      keys,
+		fetchedAt: now,
+		expiresAt: now.Add(jwksCacheTTL),
+	}, nil
+}
+
+// FetchKeys implements jws.KeyProvider by looking up the token's key ID.
+// Each key is only offered with its own algorithm, so a token can't pick a
+// weaker one through its header.
+func (s *jwksSnapshot) FetchKeys(_ context.Context, sink jws.KeySink, sig *jws.Signature, _ *jws.Message) error {
+	kid := sig.ProtectedHeaders().KeyID()
+	key, ok := s.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown key ID %q", kid)
+	}
+	sink.Key(key.alg, key.key)
+	return nil
+}
+
+// jwksCache holds an identity provider's token verification keys, refreshing
+// them before they expire and serving the previous set for a while if the
+// JWKS endpoint is unreachable.
+type jwksCache struct {
+	url          string
+	maxStaleness time.Duration
+	logger       *slog.Logger
+
+	// jwks holds the current verification keys. Token validation only loads
+	// this pointer, so it never contends with refreshes.
+	jwks atomic.Pointer[jwksSnapshot]
+
+	// mu serializes refreshes and protects the backoff bookkeeping below.
+	mu          sync.Mutex
+	nextAttempt time.Time
+	failures    int
+}
+
+// newJWKSCache creates a cache for the key set at url. A previously fetched
+// key set may be used for up to maxStaleness while the endpoint is down.
+func newJWKSCache(url string, maxStaleness time.Duration, logger *slog.Logger) *jwksCache {
+	return &jwksCache{url: url, maxStaleness: maxStaleness, logger: logger}
+}
+
+// start refreshes the key set in the background shortly before it expires,
+// so token validation never waits on the JWKS endpoint in steady state. It
+// returns immediately; the refresher stops when ctx is cancelled.
+func (c *jwksCache) start(ctx context.Context) {
+	go func() {
+		for {
+			wait := c.nextRefreshDelay()
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if _, err := c.refreshJWKS(ctx, true); err != nil && ctx.Err() == nil {
+				c.logger.Error("background JWKS refresh failed", "error", err)
+			}
+		}
+	}()
+}
+
+// nextRefreshDelay returns how long the background refresher should sleep
+// before its next attempt.
+func (c *jwksCache) nextRefreshDelay() time.Duration {
+	c.mu.Lock()
+	nextAttempt := c.nextAttempt
+	c.mu.Unlock()
+
+	next := nextAttempt
+	if snapshot := c.jwks.Load(); snapshot != nil {
+		if refreshAt := snapshot.expiresAt.Add(-jwksRefreshAhead); refreshAt.After(next) {
+			next = refreshAt
+		}
+	}
+	return max(time.Until(next), 0)
+}
+
+// currentKeys returns the current key set, refreshing it if it's expired or not
+// yet loaded. With the background refresher running, this is a single atomic load.
+func (c *jwksCache) currentKeys(ctx context.Context) (*jwksSnapshot, error) {
+	if snapshot := c.jwks.Load(); snapshot != nil && time.Now().Before(snapshot.expiresAt) {
+		return snapshot, nil
+	}
+	return c.refreshJWKS(ctx, false)
+}
+
+// refreshJWKS fetches a new key set unless the current one is still fresh (or
+// force is set). When the JWKS endpoint is unreachable, the previous key set keeps
+// being served until it is older than the configured staleness budget, and further
+// refreshes back off with jitter.
+func (c *jwksCache) refreshJWKS(ctx context.Context, force bool) (*jwksSnapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	current := c.jwks.Load()
+
+	// Another request may have refreshed while we waited.
+	if !force && current != nil && now.Before(current.expiresAt) {
+		return current, nil
+	}
+
+	usable := current != nil && now.Sub(current.fetchedAt) <= c.maxStaleness
+
+	// Don't hit the endpoint again until the backoff expires.
+	if now.Before(c.nextAttempt) {
+		if usable {
+			return current, nil
+		}
+		return nil, fmt.Errorf("JWKS endpoint unavailable, next attempt at %s", c.nextAttempt.Format(time.RFC3339))
+	}
+
+	snapshot, err := c.fetchJWKS(ctx)
+	now = time.Now()
+	if err != nil {
+		c.failures++
+		c.nextAttempt = now.Add(jitter(backoff(jwksRefreshBaseBackoff, jwksRefreshMaxBackoff, c.failures-1)))
+
+		if usable {
+			c.logger.Warn("JWKS refresh failed, serving stale key set",
+				"error", err,
+				"age", now.Sub(current.fetchedAt).String(),
+				"failures", c.failures,
+				"next_attempt", c.nextAttempt,
+			)
+			return current, nil
+		}
+		return nil, fmt.Errorf("failed to refresh JWKS: %w", err)
+	}
+
+	c.jwks.Store(snapshot)
+	c.failures = 0
+	c.nextAttempt = time.Time{}
+
+	c.logger.Info("JWKS cache refreshed", "keys", len(snapshot.keys))
+	return snapshot, nil
+}
+
+// fetchJWKS fetches and parses the key set, retrying transient failures with
+// jittered exponential backoff.
+func (c *jwksCache) fetchJWKS(ctx context.Context) (*jwksSnapshot, error) {
+	var lastErr error
+	for attempt := 0; attempt < jwksFetchAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(jitter(backoff(jwksRetryBaseDelay, jwksRefreshBaseBackoff, attempt-1))):
+			}
+		}
+
+		keySet, err := jwk.Fetch(ctx, c.url)
+		if err == nil {
+			return newJWKSSnapshot(keySet, time.Now())
+		}
+		lastErr = err
+		c.logger.Warn("JWKS fetch attempt failed", "attempt", attempt+1, "error", err)
+	}
+	return nil, lastErr
+}
+
+// backoff returns base doubled n times, capped at limit.
+func backoff(base, limit time.Duration, n int) time.Duration {
+	d := base
+	for i := 0; i < n && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
+
+// jitter returns a random duration in [d/2, d) so retries from many instances spread out.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(half)
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// benchmarkKeys is the number of keys in the benchmark's key set. Cognito
+// publishes two; providers rotating keys often publish a few more.
+const benchmarkKeys = 4
+
+// newBenchmarkKeySet returns a public key set of benchmarkKeys RSA keys and
+// the private key of the last one, which tokens are signed with.
+func newBenchmarkKeySet(b *testing.B) (jwk.Set, jwk.Key) {
+	b.Helper()
+
+	set := jwk.NewSet()
+	var signer jwk.Key
+	for i := 0; i < benchmarkKeys; i++ {
+		raw, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			b.Fatal(err)
+		}
+		private, err := jwk.FromRaw(raw)
+		if err != nil {
+			b.Fatal(err)
+		}
+		kid := fmt.Sprintf("key-%d", i)
+		if err := private.Set(jwk.KeyIDKey, kid); err != nil {
+			b.Fatal(err)
+		}
+		if err := private.Set(jwk.AlgorithmKey, jwa.RS256); err != nil {
+			b.Fatal(err)
+		}
+		public, err := private.PublicKey()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := set.AddKey(public); err != nil {
+			b.Fatal(err)
+		}
+		signer = private
+	}
+	return set, signer
+}
+
+// newBenchmarkToken returns an access token for cfg's user pool signed with
+// key.
+func newBenchmarkToken(b *testing.B, cfg config.CognitoConfig, key jwk.Key) string {
+	b.Helper()
+
+	now := time.Now()
+	token, err := jwt.NewBuilder().
+		Issuer(fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", cfg.Region, cfg.UserPoolID)).
+		Subject("0c9a1f4e-6b1d-4a8e-9f59-3f1f3c1e2d7a").
+		IssuedAt(now).
+		Expiration(now.Add(time.Hour)).
+		Claim("token_use", "access").
+		Claim("cognito:username", "bench").
+		Claim("cognito:groups", []string{"editor"}).
+		Claim("scope", "aws.cognito.signin.user.admin").
+		Build()
+	if err != nil {
+		b.Fatal(err)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return string(signed)
+}
+
+// BenchmarkValidateToken measures token validation from many goroutines at
+// once. "snapshot" is ValidateToken, which loads the precomputed kid-to-key
+// map with a single atomic load. "keyset" is the approach it replaced: the
+// jwk.Set is read under a lock and its keys are parsed on every request.
+func BenchmarkValidateToken(b *testing.B) {
+	cfg := config.CognitoConfig{Region: "us-east-1", UserPoolID: "us-east-1_bench", ClientID: "bench"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	set, signer := newBenchmarkKeySet(b)
+	token := newBenchmarkToken(b, cfg, signer)
+
+	b.Run("snapshot", func(b *testing.B) {
+		s := NewCognitoService(nil, cfg, logger)
+		snapshot, err := newJWKSSnapshot(set, time.Now())
+		if err != nil {
+			b.Fatal(err)
+		}
+		s.keys.jwks.Store(snapshot)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			ctx := context.Background()
+			for pb.Next() {
+				if _, err := s.ValidateToken(ctx, token); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("keyset", func(b *testing.B) {
+		var mu sync.RWMutex
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				mu.RLock()
+				keySet := set
+				mu.RUnlock()
+				if _, err := jwt.Parse([]byte(token), jwt.WithKeySet(keySet), jwt.WithValidate(true)); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
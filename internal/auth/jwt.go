@@ -104,29 +104,14 @@ func (s *JWTService) generateRefreshToken(userID string, duration time.Duration)
 	return tokenString, expiresAt, nil
 }
 
-// ValidateToken validates a JWT token and returns the claims.
+// ValidateToken validates a JWT access token and returns the claims.
+// Refresh tokens are rejected.
 func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.secretKey, nil
-	})
-
+	claims, err := s.parse(tokenString)
 	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrExpiredToken
-		}
-		return nil, ErrInvalidToken
+		return nil, err
 	}
-
-	if !token.Valid {
-		return nil, ErrInvalidToken
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
+	if claims["type"] == "refresh" {
 		return nil, ErrInvalidToken
 	}
 
@@ -173,6 +158,51 @@ func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	return userClaims, nil
 }
 
+// ValidateRefreshToken validates a refresh token and returns its user ID.
+func (s *JWTService) ValidateRefreshToken(tokenString string) (string, error) {
+	claims, err := s.parse(tokenString)
+	if err != nil {
+		return "", err
+	}
+	if claims["type"] != "refresh" {
+		return "", ErrInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	return userID, nil
+}
+
+// parse verifies a token's signature and expiry and returns its claims.
+func (s *JWTService) parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Verify signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return s.secretKey, nil
+	}, jwt.WithIssuer(s.issuer))
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
 // ClaimsToUser converts JWT claims to a User object.
 func (s *JWTService) ClaimsToUser(claims *Claims) *User {
 	return &User{
@@ -0,0 +1,415 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// localAccessTokenTTL and localRefreshTokenTTL match Cognito's defaults.
+	localAccessTokenTTL  = 1 * time.Hour
+	localRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// LocalProvider is a built-in identity provider for development and tests,
+// so the server can run without Cognito or an OIDC provider. Users come from
+// configuration or sign-up and are kept in memory; tokens are HS256 JWTs.
+// Sign-ups are confirmed immediately, and flows that need email or SMS
+// delivery return ErrNotSupported.
+type LocalProvider struct {
+	tokens *JWTService
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	users map[string]*localUser // Keyed by lowercase email
+	// revoked holds revoked refresh tokens until they would have expired.
+	revoked map[string]time.Time
+}
+
+type localUser struct {
+	id           string
+	email        string
+	passwordHash []byte
+	roles        []string
+	attributes   map[string]string
+}
+
+// NewLocalProvider creates a local identity provider with the configured users.
+func NewLocalProvider(cfg config.LocalAuthConfig, logger *slog.Logger) *LocalProvider {
+	p := &LocalProvider{
+		tokens:  NewJWTService(cfg.Secret, localAccessTokenTTL, localRefreshTokenTTL),
+		logger:  logger,
+		users:   make(map[string]*localUser),
+		revoked: make(map[string]time.Time),
+	}
+
+	for _, u := range cfg.Users {
+		hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		if err != nil {
+			logger.Error("failed to add local user", "error", err, "email", u.Email)
+			continue
+		}
+		p.users[strings.ToLower(u.Email)] = &localUser{
+			id:           newLocalUserID(),
+			email:        u.Email,
+			passwordHash: hash,
+			roles:        u.Roles,
+			attributes:   make(map[string]string),
+		}
+	}
+
+	logger.Info("local identity provider loaded", "users", len(p.users))
+	return p
+}
+
+// Start implements IdentityProvider; the local provider has no background work.
+func (p *LocalProvider) Start(ctx context.Context) {}
+
+// SignUp creates a user. Local users don't need to confirm their email.
+func (p *LocalProvider) SignUp(ctx context.Context, email, password, name string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return ErrInvalidPassword
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := strings.ToLower(email)
+	if _, exists := p.users[key]; exists {
+		return ErrUserAlreadyExists
+	}
+	p.users[key] = &localUser{
+		id:           newLocalUserID(),
+		email:        email,
+		passwordHash: hash,
+		attributes:   map[string]string{"name": name},
+	}
+
+	p.logger.Info("user signed up successfully", "email", email)
+	return nil
+}
+
+// ConfirmSignUp accepts any code, since local users are confirmed at sign-up.
+func (p *LocalProvider) ConfirmSignUp(ctx context.Context, email, code string) error {
+	if _, ok := p.user(email); !ok {
+		return ErrInvalidVerification
+	}
+	return nil
+}
+
+// Login authenticates a user and issues tokens. Local users have no MFA,
+// so device credentials are ignored.
+func (p *LocalProvider) Login(ctx context.Context, email, password string, device *DeviceCredentials) (*Tokens, *Challenge, error) {
+	user, ok := p.user(email)
+	if !ok || bcrypt.CompareHashAndPassword(user.passwordHash, []byte(password)) != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	tokens, err := p.issueTokens(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.logger.Info("user logged in successfully", "email", email)
+	return tokens, nil, nil
+}
+
+// RefreshToken issues a new access token. Like Cognito, it doesn't rotate
+// the refresh token.
+func (p *LocalProvider) RefreshToken(ctx context.Context, refreshToken, email, deviceKey string) (*Tokens, error) {
+	userID, err := p.tokens.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.RLock()
+	_, revoked := p.revoked[refreshToken]
+	p.mu.RUnlock()
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+	user, ok := p.userByID(userID)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	tokens, err := p.issueTokens(user)
+	if err != nil {
+		return nil, err
+	}
+	tokens.RefreshToken = ""
+
+	p.logger.Info("token refreshed successfully")
+	return tokens, nil
+}
+
+// RevokeToken stops a refresh token from issuing new access tokens.
+// Revoking an invalid or expired token succeeds, as with Cognito.
+func (p *LocalProvider) RevokeToken(ctx context.Context, refreshToken string) error {
+	if _, err := p.tokens.ValidateRefreshToken(refreshToken); err != nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for token, expiresAt := range p.revoked {
+		if now.After(expiresAt) {
+			delete(p.revoked, token)
+		}
+	}
+	p.revoked[refreshToken] = now.Add(localRefreshTokenTTL)
+
+	p.logger.Info("refresh token revoked")
+	return nil
+}
+
+// ValidateToken validates an access token issued by this provider.
+func (p *LocalProvider) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	return p.tokens.ValidateToken(tokenString)
+}
+
+// ChangePassword changes the signed-in user's password.
+func (p *LocalProvider) ChangePassword(ctx context.Context, accessToken, currentPassword, newPassword string) error {
+	claims, err := p.tokens.ValidateToken(accessToken)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	user := p.userByIDLocked(claims.UserID)
+	if user == nil {
+		return ErrInvalidToken
+	}
+	if bcrypt.CompareHashAndPassword(user.passwordHash, []byte(currentPassword)) != nil {
+		return ErrIncorrectPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return ErrInvalidPassword
+	}
+	user.passwordHash = hash
+
+	p.logger.Info("password changed successfully", "user_id", user.id)
+	return nil
+}
+
+// UpdateUserAttributes updates the signed-in user's attributes. Email
+// changes take effect immediately; nothing needs verification.
+func (p *LocalProvider) UpdateUserAttributes(ctx context.Context, accessToken string, attributes map[string]string) ([]string, error) {
+	claims, err := p.tokens.ValidateToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	user := p.userByIDLocked(claims.UserID)
+	if user == nil {
+		return nil, ErrInvalidToken
+	}
+
+	if email, ok := attributes["email"]; ok && !strings.EqualFold(email, user.email) {
+		if _, taken := p.users[strings.ToLower(email)]; taken {
+			return nil, ErrEmailInUse
+		}
+		delete(p.users, strings.ToLower(user.email))
+		user.email = email
+		p.users[strings.ToLower(email)] = user
+	}
+	for name, value := range attributes {
+		if name != "email" {
+			user.attributes[name] = value
+		}
+	}
+
+	p.logger.Info("user attributes updated", "user_id", user.id)
+	return nil, nil
+}
+
+// RespondToSMSMFA is not supported; local users have no MFA.
+func (p *LocalProvider) RespondToSMSMFA(ctx context.Context, email, session, code string) (*Tokens, error) {
+	return nil, ErrNotSupported
+}
+
+// RespondToNewPasswordRequired is not supported; local users never have
+// temporary passwords.
+func (p *LocalProvider) RespondToNewPasswordRequired(ctx context.Context, email, session, newPassword string, attributes map[string]string) (*Tokens, *Challenge, error) {
+	return nil, nil, ErrNotSupported
+}
+
+// ForgotPassword is not supported; the local provider can't send reset codes.
+func (p *LocalProvider) ForgotPassword(ctx context.Context, email string) error {
+	return ErrNotSupported
+}
+
+// ConfirmForgotPassword is not supported; the local provider can't send reset codes.
+func (p *LocalProvider) ConfirmForgotPassword(ctx context.Context, email, code, newPassword string) error {
+	return ErrNotSupported
+}
+
+// VerifyUserAttribute is not supported; local attribute changes need no verification.
+func (p *LocalProvider) VerifyUserAttribute(ctx context.Context, accessToken, attribute, code string) error {
+	return ErrNotSupported
+}
+
+// ClientCredentialsToken is not supported; the local provider has no
+// service clients.
+func (p *LocalProvider) ClientCredentialsToken(ctx context.Context, clientID, clientSecret, scope string) (*Tokens, error) {
+	return nil, ErrNotSupported
+}
+
+// PasswordPolicy returns DefaultPasswordPolicy; the local provider has no
+// policy of its own.
+func (p *LocalProvider) PasswordPolicy(ctx context.Context) (*PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy
+	return &policy, nil
+}
+
+// LookupUser returns the user with an email address.
+func (p *LocalProvider) LookupUser(ctx context.Context, email string) (*User, error) {
+	user, ok := p.user(email)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &User{
+		ID:       user.id,
+		Email:    user.email,
+		Username: user.email,
+		Name:     user.attributes["name"],
+		Roles:    user.roles,
+		IsAdmin:  slices.Contains(user.roles, "admin"),
+	}, nil
+}
+
+// LambdaTriggers is not supported; the local provider has no triggers.
+func (p *LocalProvider) LambdaTriggers(ctx context.Context) (*LambdaTriggers, error) {
+	return nil, ErrNotSupported
+}
+
+// UpdateLambdaTriggers is not supported; the local provider has no triggers.
+func (p *LocalProvider) UpdateLambdaTriggers(ctx context.Context, triggers LambdaTriggers) (*LambdaTriggers, error) {
+	return nil, ErrNotSupported
+}
+
+// CreateUser is not supported; local users come from configuration or sign-up.
+func (p *LocalProvider) CreateUser(ctx context.Context, user NewUser) (*AdminUser, error) {
+	return nil, ErrNotSupported
+}
+
+// CreateGroup is not supported; local users' roles come from configuration.
+func (p *LocalProvider) CreateGroup(ctx context.Context, name, description string, precedence *int32) (*Group, error) {
+	return nil, ErrNotSupported
+}
+
+// ListGroups is not supported; local users' roles come from configuration.
+func (p *LocalProvider) ListGroups(ctx context.Context) ([]Group, error) {
+	return nil, ErrNotSupported
+}
+
+// AddUserToGroup is not supported; local users' roles come from configuration.
+func (p *LocalProvider) AddUserToGroup(ctx context.Context, email, group string) error {
+	return ErrNotSupported
+}
+
+// RemoveUserFromGroup is not supported; local users' roles come from configuration.
+func (p *LocalProvider) RemoveUserFromGroup(ctx context.Context, email, group string) error {
+	return ErrNotSupported
+}
+
+// AuthorizationURL is not supported; local users sign in with a password.
+func (p *LocalProvider) AuthorizationURL(ctx context.Context, provider, redirectURI, state, codeChallenge string) (string, error) {
+	return "", ErrNotSupported
+}
+
+// ExchangeAuthorizationCode is not supported; local users sign in with a password.
+func (p *LocalProvider) ExchangeAuthorizationCode(ctx context.Context, code, redirectURI, codeVerifier string) (*Tokens, error) {
+	return nil, ErrNotSupported
+}
+
+// RememberDevice is not supported; local users have no MFA to skip.
+func (p *LocalProvider) RememberDevice(ctx context.Context, accessToken string, device NewDevice, name string) (*DeviceCredentials, error) {
+	return nil, ErrNotSupported
+}
+
+// ListDevices is not supported; local users have no MFA to skip.
+func (p *LocalProvider) ListDevices(ctx context.Context, accessToken string) ([]Device, error) {
+	return nil, ErrNotSupported
+}
+
+// ForgetDevice is not supported; local users have no MFA to skip.
+func (p *LocalProvider) ForgetDevice(ctx context.Context, accessToken, deviceKey string) error {
+	return ErrNotSupported
+}
+
+// issueTokens creates an access and refresh token for a user.
+func (p *LocalProvider) issueTokens(user localUser) (*Tokens, error) {
+	pair, err := p.tokens.GenerateTokenPair(&User{
+		ID:       user.id,
+		Email:    user.email,
+		Username: user.email,
+		Roles:    user.roles,
+		IsAdmin:  slices.Contains(user.roles, "admin"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    int32(localAccessTokenTTL.Seconds()),
+		TokenType:    pair.TokenType,
+	}, nil
+}
+
+// user returns a copy of the user with an email address.
+func (p *LocalProvider) user(email string) (localUser, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	user, ok := p.users[strings.ToLower(email)]
+	if !ok {
+		return localUser{}, false
+	}
+	return *user, true
+}
+
+// userByID returns a copy of the user with an ID.
+func (p *LocalProvider) userByID(id string) (localUser, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	user := p.userByIDLocked(id)
+	if user == nil {
+		return localUser{}, false
+	}
+	return *user, true
+}
+
+// userByIDLocked is userByID for callers holding p.mu.
+func (p *LocalProvider) userByIDLocked(id string) *localUser {
+	for _, user := range p.users {
+		if user.id == id {
+			return user
+		}
+	}
+	return nil
+}
+
+// newLocalUserID returns a random user ID.
+func newLocalUserID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+// LegacyDirectory checks credentials against an existing authentication
+// system, such as LDAP or a legacy user database, so users who aren't in
+// Cognito yet can be migrated the first time they log in.
+type LegacyDirectory interface {
+	// Authenticate returns the user if the credentials are valid, or
+	// ErrInvalidCredentials if the user is unknown or the password is wrong.
+	Authenticate(ctx context.Context, email, password string) (*LegacyUser, error)
+}
+
+// LegacyUser is a user found in a legacy directory.
+type LegacyUser struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	// Attributes are extra Cognito attributes to set, e.g. "custom:tenant".
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// SetLegacyDirectory enables migrating users from dir on login. Users that
+// Cognito doesn't know are looked up in dir and, if their credentials are
+// valid there, created in the user pool with the same password.
+func (s *CognitoService) SetLegacyDirectory(dir LegacyDirectory) {
+	s.legacy = dir
+}
+
+// migrateUser copies a user from the legacy directory into the user pool,
+// returning ErrInvalidCredentials if the directory rejects the credentials.
+func (s *CognitoService) migrateUser(ctx context.Context, email, password string) error {
+	user, err := s.legacy.Authenticate(ctx, email, password)
+	if err != nil {
+		return err
+	}
+
+	attributes := []types.AttributeType{
+		{Name: aws.String("email"), Value: aws.String(email)},
+		// The legacy system already verified the address.
+		{Name: aws.String("email_verified"), Value: aws.String("true")},
+	}
+	if user.Name != "" {
+		attributes = append(attributes, types.AttributeType{Name: aws.String("name"), Value: aws.String(user.Name)})
+	}
+	for name, value := range user.Attributes {
+		attributes = append(attributes, types.AttributeType{Name: aws.String(name), Value: aws.String(value)})
+	}
+
+	_, err = s.client.AdminCreateUser(ctx, &cognito.AdminCreateUserInput{
+		UserPoolId:     aws.String(s.cfg.UserPoolID),
+		Username:       aws.String(email),
+		UserAttributes: attributes,
+		// Don't send a welcome email with a temporary password.
+		MessageAction: types.MessageActionTypeSuppress,
+	})
+	if err != nil {
+		var usernameExists *types.UsernameExistsException
+		if errors.As(err, &usernameExists) {
+			// Another login migrated the user first.
+			return nil
+		}
+		return fmt.Errorf("cognito admin create user failed: %w", err)
+	}
+
+	_, err = s.client.AdminSetUserPassword(ctx, &cognito.AdminSetUserPasswordInput{
+		UserPoolId: aws.String(s.cfg.UserPoolID),
+		Username:   aws.String(email),
+		Password:   aws.String(password),
+		Permanent:  true,
+	})
+	if err != nil {
+		var invalidPassword *types.InvalidPasswordException
+		if !errors.As(err, &invalidPassword) {
+			return fmt.Errorf("cognito admin set user password failed: %w", err)
+		}
+
+		// The legacy password doesn't meet the pool's policy, so the user
+		// has to choose a new one before they can log in.
+		s.logger.Info("migrated user's password does not meet the password policy", "email", email)
+		if _, err := s.client.AdminResetUserPassword(ctx, &cognito.AdminResetUserPasswordInput{
+			UserPoolId: aws.String(s.cfg.UserPoolID),
+			Username:   aws.String(email),
+		}); err != nil {
+			return fmt.Errorf("cognito admin reset user password failed: %w", err)
+		}
+		return ErrPasswordResetRequired
+	}
+
+	s.logger.Info("user migrated from legacy directory", "email", email)
+	return nil
+}
+
+// HTTPDoer sends HTTP requests, e.g. *http.Client or *egress.Client.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// HTTPLegacyDirectory authenticates users against a legacy system's HTTP
+// endpoint. It POSTs {"email", "password"} as JSON and expects 200 with a
+// LegacyUser body for valid credentials, or 401, 403, or 404 otherwise.
+type HTTPLegacyDirectory struct {
+	url    string
+	client HTTPDoer
+}
+
+// NewHTTPLegacyDirectory creates a directory backed by the endpoint at url.
+func NewHTTPLegacyDirectory(url string, client HTTPDoer) *HTTPLegacyDirectory {
+	return &HTTPLegacyDirectory{url: url, client: client}
+}
+
+// Authenticate implements LegacyDirectory.
+func (d *HTTPLegacyDirectory) Authenticate(ctx context.Context, email, password string) (*LegacyUser, error) {
+	body, err := json.Marshal(map[string]string{"email": email, "password": password})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create legacy auth request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("legacy auth request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return nil, ErrInvalidCredentials
+	default:
+		return nil, fmt.Errorf("legacy auth returned status %d", resp.StatusCode)
+	}
+
+	var user LegacyUser
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("decode legacy user: %w", err)
+	}
+	return &user, nil
+}
@@ -1,6 +1,11 @@
 package auth
 
-import "time"
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+)
 
 // User represents an authenticated user.
 type User struct {
@@ -9,6 +14,20 @@ type User struct {
 	Username string   `json:"username"`
 	Roles    []string `json:"roles"`
 	IsAdmin  bool     `json:"is_admin"`
+	// Provider is the social identity provider the user signed in with, e.g.
+	// "Google", or empty for users of the identity provider itself.
+	Provider string `json:"provider,omitempty"`
+	// Name is the user's display name, when the token carries it.
+	Name string `json:"name,omitempty"`
+	// Scopes are the OAuth scopes the access token was granted, e.g.
+	// "aws.s3/read" for a Cognito resource server.
+	Scopes []string `json:"scopes,omitempty"`
+	// Client is true for tokens a service client got with the client
+	// credentials grant. They act for no user, so ID is the client's ID.
+	Client bool `json:"client,omitempty"`
+	// ImpersonatedBy is the ID of the admin acting as the user, when the
+	// request carries an impersonation token.
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
 }
 
 // Claims represents JWT token claims.
@@ -18,8 +37,19 @@ type Claims struct {
 	Username string   `json:"username"`
 	Roles    []string `json:"roles"`
 	IsAdmin  bool     `json:"is_admin"`
-	IssuedAt int64    `json:"iat"`
-	ExpiresAt int64   `json:"exp"`
+	Provider string   `json:"provider,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	// TokenUse is "id" for ID tokens; empty or "access" for access tokens.
+	TokenUse string `json:"token_use,omitempty"`
+	// Scopes are the OAuth scopes from the token's space-separated scope claim.
+	Scopes []string `json:"scopes,omitempty"`
+	// Client is true for client credentials tokens, which name no user.
+	Client bool `json:"client,omitempty"`
+	// ImpersonatedBy is the ID of the admin an impersonation token was
+	// issued to.
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+	IssuedAt       int64  `json:"iat"`
+	ExpiresAt      int64  `json:"exp"`
 }
 
 // TokenPair represents access and refresh tokens.
@@ -38,8 +68,8 @@ type LoginRequest struct {
 
 // LoginResponse represents a login response.
 type LoginResponse struct {
-	User   User       `json:"user"`
-	Tokens TokenPair  `json:"tokens"`
+	User   User      `json:"user"`
+	Tokens TokenPair `json:"tokens"`
 }
 
 // Permission represents an authorization permission.
@@ -52,15 +82,43 @@ const (
 	PermissionAWSRead     Permission = "aws:read"
 	PermissionAWSWrite    Permission = "aws:write"
 	PermissionAdmin       Permission = "admin:*"
+	// PermissionAIInvoke allows invoking Bedrock models, which are billed
+	// per token.
+	PermissionAIInvoke Permission = "ai:invoke"
+	// PermissionKMSDecrypt allows decrypting data and generating plaintext
+	// data keys with the server's KMS keys.
+	PermissionKMSDecrypt Permission = "kms:decrypt"
+	// PermissionAthenaQuery allows running Athena queries, which read
+	// whatever the server's IAM principal can, and reading their results.
+	PermissionAthenaQuery Permission = "athena:query"
 )
 
+// OAuth scopes of the server's resource server in the identity provider.
+// Service clients, whose tokens have scopes instead of groups, need them to
+// call the S3, DynamoDB and SQS routes.
+const (
+	ScopeS3Read        = "aws.s3/read"
+	ScopeS3Write       = "aws.s3/write"
+	ScopeDynamoDBRead  = "aws.dynamodb/read"
+	ScopeDynamoDBWrite = "aws.dynamodb/write"
+	ScopeSQSRead       = "aws.sqs/read"
+	ScopeSQSWrite      = "aws.sqs/write"
+)
+
+// AssumeRolePermission returns the permission to send a request's S3 and
+// DynamoDB calls as the configured AWS role name, with the X-AWS-Role
+// header.
+func AssumeRolePermission(name string) Permission {
+	return Permission("aws:assume:" + name)
+}
+
 // Role represents a user role with permissions.
 type Role struct {
 	Name        string
 	Permissions []Permission
 }
 
-// Predefined roles
+// Predefined roles, used when permissions aren't managed in DynamoDB.
 var (
 	RoleUser = Role{
 		Name: "user",
@@ -85,43 +143,68 @@ var (
 			PermissionDeleteItems,
 			PermissionAWSRead,
 			PermissionAWSWrite,
+			PermissionAIInvoke,
+			PermissionKMSDecrypt,
+			PermissionAthenaQuery,
 			PermissionAdmin,
 		},
 	}
 )
 
-// GetRolePermissions returns permissions for a role name.
-func GetRolePermissions(roleName string) []Permission {
-	switch roleName {
-	case "admin":
-		return RoleAdmin.Permissions
-	case "editor":
-		return RoleEditor.Permissions
-	case "user":
-		return RoleUser.Permissions
-	default:
-		return []Permission{}
-	}
+// RoleStore looks up the permissions a role grants.
+type RoleStore interface {
+	RolePermissions(ctx context.Context, role string) ([]Permission, error)
+}
+
+// StaticRoles is a fixed set of roles, keyed by name.
+type StaticRoles map[string][]Permission
+
+// DefaultRoles are the predefined roles.
+var DefaultRoles = StaticRoles{
+	RoleUser.Name:   RoleUser.Permissions,
+	RoleEditor.Name: RoleEditor.Permissions,
+	RoleAdmin.Name:  RoleAdmin.Permissions,
 }
 
-// HasPermission checks if a user has a specific permission.
-func (u *User) HasPermission(perm Permission) bool {
+// RolePermissions returns the permissions role grants, or none for
+// unknown roles.
+func (r StaticRoles) RolePermissions(ctx context.Context, role string) ([]Permission, error) {
+	return r[role], nil
+}
+
+// HasPermission checks if a user has a specific permission through any of
+// their roles.
+func (u *User) HasPermission(ctx context.Context, perm Permission, roles RoleStore) (bool, error) {
 	// Admin has all permissions
 	if u.IsAdmin {
-		return true
+		return true, nil
 	}
 
 	// Check all roles
 	for _, role := range u.Roles {
-		permissions := GetRolePermissions(role)
+		permissions, err := roles.RolePermissions(ctx, role)
+		if err != nil {
+			return false, err
+		}
 		for _, p := range permissions {
 			if p == perm || p == PermissionAdmin {
-				return true
+				return true, nil
 			}
 		}
 	}
 
-	return false
+	return false, nil
+}
+
+// HasScope checks if the user's access token was granted scope.
+func (u *User) HasScope(scope string) bool {
+	return slices.Contains(u.Scopes, scope)
+}
+
+// tokenScopes returns the scopes in a token's space-separated scope claim.
+func tokenScopes(scope interface{}) []string {
+	s, _ := scope.(string)
+	return strings.Fields(s)
 }
 
 // HasAnyRole checks if user has any of the specified roles.
@@ -0,0 +1,513 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// OIDCProvider authenticates users against a generic OpenID Connect
+// provider, such as Keycloak, with the resource owner password grant.
+// Accounts are managed in the provider itself, so sign-up, password resets,
+// and attribute changes return ErrNotSupported.
+type OIDCProvider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+	logger *slog.Logger
+
+	// mu guards discovery, which happens once, on Start or first use.
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      *jwksCache
+}
+
+// oidcDiscovery is the subset of the discovery document the provider uses.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcTokenResponse is a token endpoint response.
+type oidcTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int32  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NewOIDCProvider creates an OpenID Connect identity provider.
+func NewOIDCProvider(cfg config.OIDCConfig, logger *slog.Logger) *OIDCProvider {
+	return &OIDCProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		logger: logger,
+	}
+}
+
+// Start discovers the provider's endpoints, retrying until it succeeds, and
+// then keeps the token verification keys warm until ctx is cancelled.
+func (p *OIDCProvider) Start(ctx context.Context) {
+	go func() {
+		for attempt := 0; ; attempt++ {
+			_, keys, err := p.discover(ctx)
+			if err == nil {
+				keys.start(ctx)
+				return
+			}
+			p.logger.Error("OIDC discovery failed", "error", err, "issuer", p.cfg.IssuerURL)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jitter(backoff(jwksRefreshBaseBackoff, jwksRefreshMaxBackoff, attempt))):
+			}
+		}
+	}()
+}
+
+// discover loads the provider's discovery document, once.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, *jwksCache, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, p.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.IssuerURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch discovery document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("fetch discovery document: status %d", resp.StatusCode)
+	}
+
+	var d oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, nil, fmt.Errorf("decode discovery document: %w", err)
+	}
+	if d.Issuer != p.cfg.IssuerURL {
+		return nil, nil, fmt.Errorf("discovery document issuer %q does not match %q", d.Issuer, p.cfg.IssuerURL)
+	}
+	if d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, nil, fmt.Errorf("discovery document is missing token_endpoint or jwks_uri")
+	}
+
+	p.discovery = &d
+	p.keys = newJWKSCache(d.JWKSURI, p.cfg.JWKSMaxStaleness, p.logger)
+	p.logger.Info("OIDC provider discovered", "issuer", d.Issuer)
+	return p.discovery, p.keys, nil
+}
+
+// Login authenticates a user with the password grant. Devices are tracked
+// by the OIDC provider, if at all, so device credentials are ignored.
+func (p *OIDCProvider) Login(ctx context.Context, email, password string, device *DeviceCredentials) (*Tokens, *Challenge, error) {
+	result, err := p.requestToken(ctx, url.Values{
+		"grant_type": {"password"},
+		"username":   {email},
+		"password":   {password},
+		"scope":      {"openid email profile"},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc login failed: %w", err)
+	}
+	if result.Error == "invalid_grant" {
+		return nil, nil, ErrInvalidCredentials
+	}
+	if result.Error != "" {
+		return nil, nil, fmt.Errorf("oidc login failed: %s: %s", result.Error, result.ErrorDescription)
+	}
+
+	p.logger.Info("user logged in successfully", "email", email)
+	return result.tokens(), nil, nil
+}
+
+// RefreshToken gets new tokens with a refresh token.
+func (p *OIDCProvider) RefreshToken(ctx context.Context, refreshToken, email, deviceKey string) (*Tokens, error) {
+	result, err := p.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("oidc refresh token failed: %w", err)
+	}
+	if result.Error == "invalid_grant" {
+		return nil, ErrInvalidToken
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("oidc refresh token failed: %s: %s", result.Error, result.ErrorDescription)
+	}
+
+	p.logger.Info("token refreshed successfully")
+	return result.tokens(), nil
+}
+
+// RevokeToken revokes a refresh token at the provider's revocation
+// endpoint (RFC 7009), if it has one.
+func (p *OIDCProvider) RevokeToken(ctx context.Context, refreshToken string) error {
+	d, _, err := p.discover(ctx)
+	if err != nil {
+		return err
+	}
+	if d.RevocationEndpoint == "" {
+		return ErrNotSupported
+	}
+
+	form := url.Values{
+		"token":           {refreshToken},
+		"token_type_hint": {"refresh_token"},
+		"client_id":       {p.cfg.ClientID},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.RevocationEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("oidc revoke token failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Invalid tokens are reported as success, so only the status matters.
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc revoke token failed: status %d", resp.StatusCode)
+	}
+
+	p.logger.Info("refresh token revoked")
+	return nil
+}
+
+// AuthorizationURL returns the provider's authorization endpoint URL for
+// signing in with the authorization code flow. provider is passed as the
+// kc_idp_hint parameter, which brokers such as Keycloak use to send the
+// user straight to that identity provider; others ignore it.
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, provider, redirectURI, state, codeChallenge string) (string, error) {
+	d, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	if d.AuthorizationEndpoint == "" {
+		return "", ErrNotSupported
+	}
+
+	query := url.Values{
+		"kc_idp_hint":           {provider},
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// ExchangeAuthorizationCode exchanges an authorization code for tokens.
+func (p *OIDCProvider) ExchangeAuthorizationCode(ctx context.Context, code, redirectURI, codeVerifier string) (*Tokens, error) {
+	result, err := p.requestToken(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange failed: %w", err)
+	}
+	if result.Error == "invalid_grant" {
+		return nil, ErrInvalidAuthorizationCode
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("oidc token exchange failed: %s: %s", result.Error, result.ErrorDescription)
+	}
+
+	p.logger.Info("federated user signed in")
+	return result.tokens(), nil
+}
+
+// requestToken posts a grant to the token endpoint. OAuth errors are
+// returned in the response rather than as an error.
+func (p *OIDCProvider) requestToken(ctx context.Context, form url.Values) (*oidcTokenResponse, error) {
+	d, _, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form.Set("client_id", p.cfg.ClientID)
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result oidcTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK && result.Error == "" {
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	return &result, nil
+}
+
+// tokens converts a successful token response to Tokens.
+func (r *oidcTokenResponse) tokens() *Tokens {
+	return &Tokens{
+		AccessToken:  r.AccessToken,
+		IDToken:      r.IDToken,
+		RefreshToken: r.RefreshToken,
+		ExpiresIn:    r.ExpiresIn,
+		TokenType:    r.TokenType,
+	}
+}
+
+// ValidateToken validates an access token issued to the configured client.
+func (p *OIDCProvider) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	d, cache, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := cache.currentKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh JWKS cache: %w", err)
+	}
+
+	token, err := jwt.Parse(
+		[]byte(tokenString),
+		jwt.WithKeyProvider(keys),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(d.Issuer),
+	)
+	if err != nil {
+		p.logger.Error("token validation failed", "error", err)
+		return nil, ErrInvalidToken
+	}
+
+	// Only accept tokens issued to this client. Keycloak access tokens name
+	// the client in azp; others list it in aud.
+	azp, _ := token.Get("azp")
+	if azp != p.cfg.ClientID && !slices.Contains(token.Audience(), p.cfg.ClientID) {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &Claims{
+		UserID:    token.Subject(),
+		Username:  token.Subject(),
+		ExpiresAt: token.Expiration().Unix(),
+	}
+	if iat := token.IssuedAt(); !iat.IsZero() {
+		claims.IssuedAt = iat.Unix()
+	}
+	if scope, ok := token.Get("scope"); ok {
+		claims.Scopes = tokenScopes(scope)
+	}
+	if username, ok := token.Get("preferred_username"); ok {
+		if usernameStr, ok := username.(string); ok {
+			claims.Username = usernameStr
+		}
+	}
+	if email, ok := token.Get("email"); ok {
+		if emailStr, ok := email.(string); ok {
+			claims.Email = emailStr
+		}
+	}
+	// Brokers such as Okta and Entra ID name the upstream identity provider
+	// of federated users in idp; Keycloak can be configured to with a mapper.
+	if idp, ok := token.Get("idp"); ok {
+		if idpStr, ok := idp.(string); ok {
+			claims.Provider = idpStr
+		}
+	}
+
+	claims.Roles = p.roles(token)
+	claims.IsAdmin = slices.Contains(claims.Roles, "admin")
+
+	return claims, nil
+}
+
+// roles reads the roles claim, following a dotted path through nested
+// objects such as Keycloak's "realm_access.roles".
+func (p *OIDCProvider) roles(token jwt.Token) []string {
+	path := strings.Split(p.cfg.RolesClaim, ".")
+	value, ok := token.Get(path[0])
+	for _, key := range path[1:] {
+		if !ok {
+			break
+		}
+		var obj map[string]interface{}
+		obj, ok = value.(map[string]interface{})
+		if ok {
+			value, ok = obj[key]
+		}
+	}
+	if !ok {
+		return nil
+	}
+
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	roles := make([]string, 0, len(values))
+	for _, v := range values {
+		if role, ok := v.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// SignUp is not supported; users register with the OIDC provider.
+func (p *OIDCProvider) SignUp(ctx context.Context, email, password, name string) error {
+	return ErrNotSupported
+}
+
+// ConfirmSignUp is not supported; users register with the OIDC provider.
+func (p *OIDCProvider) ConfirmSignUp(ctx context.Context, email, code string) error {
+	return ErrNotSupported
+}
+
+// RespondToSMSMFA is not supported; the password grant has no challenges.
+func (p *OIDCProvider) RespondToSMSMFA(ctx context.Context, email, session, code string) (*Tokens, error) {
+	return nil, ErrNotSupported
+}
+
+// RespondToNewPasswordRequired is not supported; the password grant has no challenges.
+func (p *OIDCProvider) RespondToNewPasswordRequired(ctx context.Context, email, session, newPassword string, attributes map[string]string) (*Tokens, *Challenge, error) {
+	return nil, nil, ErrNotSupported
+}
+
+// ForgotPassword is not supported; users reset passwords with the OIDC provider.
+func (p *OIDCProvider) ForgotPassword(ctx context.Context, email string) error {
+	return ErrNotSupported
+}
+
+// ConfirmForgotPassword is not supported; users reset passwords with the OIDC provider.
+func (p *OIDCProvider) ConfirmForgotPassword(ctx context.Context, email, code, newPassword string) error {
+	return ErrNotSupported
+}
+
+// ChangePassword is not supported; users change passwords with the OIDC provider.
+func (p *OIDCProvider) ChangePassword(ctx context.Context, accessToken, currentPassword, newPassword string) error {
+	return ErrNotSupported
+}
+
+// UpdateUserAttributes is not supported; profiles are managed by the OIDC provider.
+func (p *OIDCProvider) UpdateUserAttributes(ctx context.Context, accessToken string, attributes map[string]string) ([]string, error) {
+	return nil, ErrNotSupported
+}
+
+// VerifyUserAttribute is not supported; profiles are managed by the OIDC provider.
+func (p *OIDCProvider) VerifyUserAttribute(ctx context.Context, accessToken, attribute, code string) error {
+	return ErrNotSupported
+}
+
+// ClientCredentialsToken is not supported; tokens issued to other clients
+// don't pass ValidateToken. Service clients can get tokens from the
+// provider directly if the server's client is in their audience.
+func (p *OIDCProvider) ClientCredentialsToken(ctx context.Context, clientID, clientSecret, scope string) (*Tokens, error) {
+	return nil, ErrNotSupported
+}
+
+// PasswordPolicy is not supported; passwords are set at the provider.
+func (p *OIDCProvider) PasswordPolicy(ctx context.Context) (*PasswordPolicy, error) {
+	return nil, ErrNotSupported
+}
+
+// LookupUser is not supported; users are managed at the provider.
+func (p *OIDCProvider) LookupUser(ctx context.Context, email string) (*User, error) {
+	return nil, ErrNotSupported
+}
+
+// LambdaTriggers is not supported; the provider has no Lambda triggers.
+func (p *OIDCProvider) LambdaTriggers(ctx context.Context) (*LambdaTriggers, error) {
+	return nil, ErrNotSupported
+}
+
+// UpdateLambdaTriggers is not supported; the provider has no Lambda triggers.
+func (p *OIDCProvider) UpdateLambdaTriggers(ctx context.Context, triggers LambdaTriggers) (*LambdaTriggers, error) {
+	return nil, ErrNotSupported
+}
+
+// CreateUser is not supported; users are managed by the OIDC provider.
+func (p *OIDCProvider) CreateUser(ctx context.Context, user NewUser) (*AdminUser, error) {
+	return nil, ErrNotSupported
+}
+
+// CreateGroup is not supported; groups are managed by the OIDC provider.
+func (p *OIDCProvider) CreateGroup(ctx context.Context, name, description string, precedence *int32) (*Group, error) {
+	return nil, ErrNotSupported
+}
+
+// ListGroups is not supported; groups are managed by the OIDC provider.
+func (p *OIDCProvider) ListGroups(ctx context.Context) ([]Group, error) {
+	return nil, ErrNotSupported
+}
+
+// AddUserToGroup is not supported; groups are managed by the OIDC provider.
+func (p *OIDCProvider) AddUserToGroup(ctx context.Context, email, group string) error {
+	return ErrNotSupported
+}
+
+// RemoveUserFromGroup is not supported; groups are managed by the OIDC provider.
+func (p *OIDCProvider) RemoveUserFromGroup(ctx context.Context, email, group string) error {
+	return ErrNotSupported
+}
+
+// RememberDevice is not supported; devices are managed by the OIDC provider.
+func (p *OIDCProvider) RememberDevice(ctx context.Context, accessToken string, device NewDevice, name string) (*DeviceCredentials, error) {
+	return nil, ErrNotSupported
+}
+
+// ListDevices is not supported; devices are managed by the OIDC provider.
+func (p *OIDCProvider) ListDevices(ctx context.Context, accessToken string) ([]Device, error) {
+	return nil, ErrNotSupported
+}
+
+// ForgetDevice is not supported; devices are managed by the OIDC provider.
+func (p *OIDCProvider) ForgetDevice(ctx context.Context, accessToken, deviceKey string) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// passwordPolicyTTL is how long the user pool's password policy is trusted
+// without describing the pool again.
+const passwordPolicyTTL = 10 * time.Minute
+
+// passwordSymbols are the characters Cognito counts as symbols.
+const passwordSymbols = "^$*.[]{}()?\"!@#%&/\\,><':;|_~`=+- "
+
+// PasswordPolicy is the rules new passwords must follow.
+type PasswordPolicy struct {
+	MinimumLength    int  `json:"minimum_length" example:"8"`
+	RequireUppercase bool `json:"require_uppercase"`
+	RequireLowercase bool `json:"require_lowercase"`
+	RequireNumbers   bool `json:"require_numbers"`
+	RequireSymbols   bool `json:"require_symbols"`
+	// TemporaryPasswordValidityDays is how long an admin-created user has
+	// to replace their temporary password, when the provider limits it.
+	TemporaryPasswordValidityDays int `json:"temporary_password_validity_days,omitempty" example:"7"`
+}
+
+// DefaultPasswordPolicy is used by providers that don't publish a policy.
+var DefaultPasswordPolicy = PasswordPolicy{MinimumLength: 8}
+
+// Check returns why password breaks the policy, or "" if it doesn't.
+func (p PasswordPolicy) Check(password string) string {
+	if utf8.RuneCountInString(password) < p.MinimumLength {
+		return fmt.Sprintf("password must be at least %d characters", p.MinimumLength)
+	}
+	if p.RequireUppercase && !strings.ContainsFunc(password, unicode.IsUpper) {
+		return "password must contain an uppercase letter"
+	}
+	if p.RequireLowercase && !strings.ContainsFunc(password, unicode.IsLower) {
+		return "password must contain a lowercase letter"
+	}
+	if p.RequireNumbers && !strings.ContainsFunc(password, unicode.IsDigit) {
+		return "password must contain a number"
+	}
+	if p.RequireSymbols && !strings.ContainsAny(password, passwordSymbols) {
+		return "password must contain a symbol"
+	}
+	return ""
+}
+
+// PasswordPolicy returns the user pool's password policy. It is cached, and
+// the last known policy is returned if the pool can't be described.
+func (s *CognitoService) PasswordPolicy(ctx context.Context) (*PasswordPolicy, error) {
+	s.policyMu.Lock()
+	defer s.policyMu.Unlock()
+
+	if s.policy != nil && time.Since(s.policyLoadedAt) < passwordPolicyTTL {
+		return s.policy, nil
+	}
+
+	pool, err := s.describeUserPool(ctx)
+	if err != nil {
+		if s.policy != nil {
+			s.logger.Warn("failed to describe user pool, using cached password policy", "error", err)
+			return s.policy, nil
+		}
+		return nil, err
+	}
+
+	policy := DefaultPasswordPolicy
+	if pool.Policies != nil && pool.Policies.PasswordPolicy != nil {
+		p := pool.Policies.PasswordPolicy
+		policy = PasswordPolicy{
+			MinimumLength:                 int(aws.ToInt32(p.MinimumLength)),
+			RequireUppercase:              p.RequireUppercase,
+			RequireLowercase:              p.RequireLowercase,
+			RequireNumbers:                p.RequireNumbers,
+			RequireSymbols:                p.RequireSymbols,
+			TemporaryPasswordValidityDays: int(p.TemporaryPasswordValidityDays),
+		}
+	}
+
+	s.policy = &policy
+	s.policyLoadedAt = time.Now()
+	return s.policy, nil
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotSupported is returned for operations the configured identity
+// provider doesn't offer, such as self-service sign-up with a generic OIDC
+// provider.
+var ErrNotSupported = errors.New("operation not supported by the identity provider")
+
+// IdentityProvider authenticates users and manages their accounts.
+// CognitoService is the default implementation; OIDCProvider and
+// LocalProvider let the server run without Cognito. Operations a provider
+// doesn't offer return ErrNotSupported.
+type IdentityProvider interface {
+	SignUp(ctx context.Context, email, password, name string) error
+	ConfirmSignUp(ctx context.Context, email, code string) error
+	Login(ctx context.Context, email, password string, device *DeviceCredentials) (*Tokens, *Challenge, error)
+	RespondToSMSMFA(ctx context.Context, email, session, code string) (*Tokens, error)
+	RespondToNewPasswordRequired(ctx context.Context, email, session, newPassword string, attributes map[string]string) (*Tokens, *Challenge, error)
+	RefreshToken(ctx context.Context, refreshToken, email, deviceKey string) (*Tokens, error)
+	RevokeToken(ctx context.Context, refreshToken string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ConfirmForgotPassword(ctx context.Context, email, code, newPassword string) error
+	ChangePassword(ctx context.Context, accessToken, currentPassword, newPassword string) error
+	UpdateUserAttributes(ctx context.Context, accessToken string, attributes map[string]string) ([]string, error)
+	VerifyUserAttribute(ctx context.Context, accessToken, attribute, code string) error
+	ValidateToken(ctx context.Context, token string) (*Claims, error)
+	// PasswordPolicy returns the rules new passwords must follow.
+	PasswordPolicy(ctx context.Context) (*PasswordPolicy, error)
+
+	// Federated sign-in through social identity providers, with the OAuth
+	// authorization code flow and PKCE.
+	AuthorizationURL(ctx context.Context, provider, redirectURI, state, codeChallenge string) (string, error)
+	ExchangeAuthorizationCode(ctx context.Context, code, redirectURI, codeVerifier string) (*Tokens, error)
+
+	// ClientCredentialsToken gets an access token for a service client,
+	// which acts without a user.
+	ClientCredentialsToken(ctx context.Context, clientID, clientSecret, scope string) (*Tokens, error)
+
+	// CreateUser provisions a user with a temporary password, for admins.
+	CreateUser(ctx context.Context, user NewUser) (*AdminUser, error)
+	// LookupUser returns a user as their tokens describe them, for admins.
+	LookupUser(ctx context.Context, email string) (*User, error)
+	// Lambda triggers customizing sign-up, tokens, and messages, for admins.
+	LambdaTriggers(ctx context.Context) (*LambdaTriggers, error)
+	UpdateLambdaTriggers(ctx context.Context, triggers LambdaTriggers) (*LambdaTriggers, error)
+
+	// Group management, for admins. Groups become users' roles.
+	CreateGroup(ctx context.Context, name, description string, precedence *int32) (*Group, error)
+	ListGroups(ctx context.Context) ([]Group, error)
+	AddUserToGroup(ctx context.Context, email, group string) error
+	RemoveUserFromGroup(ctx context.Context, email, group string) error
+
+	// Remembered devices, which skip MFA on login.
+	RememberDevice(ctx context.Context, accessToken string, device NewDevice, name string) (*DeviceCredentials, error)
+	ListDevices(ctx context.Context, accessToken string) ([]Device, error)
+	ForgetDevice(ctx context.Context, accessToken, deviceKey string) error
+
+	// Start runs background work, such as refreshing signing keys, until
+	// ctx is cancelled. It returns immediately.
+	Start(ctx context.Context)
+}
+
+// Tokens are the tokens issued when a user logs in.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int32  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+	// NewDevice is set when Cognito starts tracking the device the user
+	// logged in from, which can then be remembered.
+	NewDevice *NewDevice `json:"new_device,omitempty"`
+}
+
+// Challenge is an extra step the identity provider requires before it
+// issues tokens.
+type Challenge struct {
+	// Name is the challenge name, e.g. "SMS_MFA".
+	Name string `json:"name" example:"SMS_MFA"`
+	// Session identifies the login attempt when answering the challenge.
+	Session string `json:"session"`
+	// Destination is where the code was sent, masked.
+	Destination string `json:"destination,omitempty" example:"+*******0100"`
+	// RequiredAttributes lists attributes that must be supplied with a new
+	// password, e.g. "name".
+	RequiredAttributes []string `json:"required_attributes,omitempty"`
+}
@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+// srpN is the 3072-bit prime from RFC 3526 that Cognito uses for SRP, with
+// generator srpG.
+const srpN = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+	"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+	"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+	"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+	"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+	"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+	"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+	"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+	"15728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64" +
+	"ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+	"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6B" +
+	"F12FFA06D98A0864D87602733EC86A64521F2B18177B200C" +
+	"BBE117577A615D6C770988C0BAD946E208E24FA074E5AB31" +
+	"43DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF"
+
+var (
+	srpG = big.NewInt(2)
+	// srpK is the SRP-6a multiplier, H(N | g).
+	srpK = new(big.Int).SetBytes(srpHash(srpPad(srpPrime()), srpPad(srpG)))
+)
+
+// srpTimestampFormat is the TIMESTAMP format Cognito expects, with the day
+// of the month unpadded.
+const srpTimestampFormat = "Mon Jan 2 15:04:05 UTC 2006"
+
+// srpPrime returns N.
+func srpPrime() *big.Int {
+	n, _ := new(big.Int).SetString(srpN, 16)
+	return n
+}
+
+// srpAuth logs a user in with USER_SRP_AUTH. The password never leaves the
+// server: Cognito sends a salt and its public value B, and the server
+// answers the PASSWORD_VERIFIER challenge with a signature only someone
+// who knows the password can compute. The result holds either tokens or
+// the next challenge, as with USER_PASSWORD_AUTH.
+func (s *CognitoService) srpAuth(ctx context.Context, email, password string, device *DeviceCredentials) (*cognito.InitiateAuthOutput, error) {
+	client, err := newSRPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{
+		"USERNAME":    email,
+		"SRP_A":       client.bigA.Text(16),
+		"SECRET_HASH": s.calculateSecretHash(email),
+	}
+	if device != nil {
+		params["DEVICE_KEY"] = device.Key
+	}
+	initiated, err := s.client.InitiateAuth(ctx, &cognito.InitiateAuthInput{
+		AuthFlow:       types.AuthFlowTypeUserSrpAuth,
+		ClientId:       aws.String(s.cfg.ClientID),
+		AuthParameters: params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if initiated.ChallengeName != types.ChallengeNameTypePasswordVerifier {
+		return initiated, nil
+	}
+
+	userID := initiated.ChallengeParameters["USER_ID_FOR_SRP"]
+	_, poolName, _ := strings.Cut(s.cfg.UserPoolID, "_")
+	claim, err := client.passwordClaim(initiated.ChallengeParameters, poolName, userID, password)
+	if err != nil {
+		return nil, err
+	}
+	claim["USERNAME"] = userID
+	claim["SECRET_HASH"] = s.calculateSecretHash(userID)
+	if device != nil {
+		claim["DEVICE_KEY"] = device.Key
+	}
+
+	responded, err := s.client.RespondToAuthChallenge(ctx, &cognito.RespondToAuthChallengeInput{
+		ChallengeName:      types.ChallengeNameTypePasswordVerifier,
+		ClientId:           aws.String(s.cfg.ClientID),
+		Session:            initiated.Session,
+		ChallengeResponses: claim,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return initiateAuthOutput(responded), nil
+}
+
+// srpClient is the client side of one SRP exchange: the private value a
+// and public value A = g^a mod N.
+type srpClient struct {
+	a, bigA *big.Int
+}
+
+// newSRPClient picks a random private value.
+func newSRPClient() (*srpClient, error) {
+	n := srpPrime()
+	a, err := rand.Int(rand.Reader, n)
+	if err != nil {
+		return nil, fmt.Errorf("generate SRP private value: %w", err)
+	}
+	return &srpClient{a: a, bigA: new(big.Int).Exp(srpG, a, n)}, nil
+}
+
+// passwordClaim answers a PASSWORD_VERIFIER or DEVICE_PASSWORD_VERIFIER
+// challenge, returning the PASSWORD_CLAIM_* and TIMESTAMP responses. For
+// users, poolName is the part of the user pool ID after the region; for
+// devices, it is the device group key and userID the device key.
+func (c *srpClient) passwordClaim(params map[string]string, poolName, userID, password string) (map[string]string, error) {
+	secretBlock, err := base64.StdEncoding.DecodeString(params["SECRET_BLOCK"])
+	if err != nil {
+		return nil, fmt.Errorf("decode SRP secret block: %w", err)
+	}
+	salt, ok := new(big.Int).SetString(params["SALT"], 16)
+	if !ok {
+		return nil, errors.New("invalid SRP salt")
+	}
+	bigB, ok := new(big.Int).SetString(params["SRP_B"], 16)
+	if !ok || new(big.Int).Mod(bigB, srpPrime()).Sign() == 0 {
+		return nil, errors.New("invalid SRP_B")
+	}
+
+	key, err := srpPasswordKey(poolName, userID, password, c.a, c.bigA, bigB, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := time.Now().UTC().Format(srpTimestampFormat)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(poolName))
+	mac.Write([]byte(userID))
+	mac.Write(secretBlock)
+	mac.Write([]byte(timestamp))
+
+	return map[string]string{
+		"PASSWORD_CLAIM_SECRET_BLOCK": params["SECRET_BLOCK"],
+		"PASSWORD_CLAIM_SIGNATURE":    base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		"TIMESTAMP":                   timestamp,
+	}, nil
+}
+
+// initiateAuthOutput converts a challenge response to the InitiateAuth
+// output it continues, so multi-step logins end with the same shape.
+func initiateAuthOutput(out *cognito.RespondToAuthChallengeOutput) *cognito.InitiateAuthOutput {
+	return &cognito.InitiateAuthOutput{
+		AuthenticationResult: out.AuthenticationResult,
+		ChallengeName:        out.ChallengeName,
+		ChallengeParameters:  out.ChallengeParameters,
+		Session:              out.Session,
+	}
+}
+
+// srpVerifier returns the verifier g^x mod N that Cognito stores for a
+// password, and the random salt it was derived with, for ConfirmDevice.
+func srpVerifier(poolName, userID, password string) (verifier, salt *big.Int, err error) {
+	saltBytes := make([]byte, 16)
+	if _, err := rand.Read(saltBytes); err != nil {
+		return nil, nil, fmt.Errorf("generate SRP salt: %w", err)
+	}
+	salt = new(big.Int).SetBytes(saltBytes)
+
+	identity := srpHash([]byte(poolName + userID + ":" + password))
+	x := new(big.Int).SetBytes(srpHash(srpPad(salt), identity))
+	return new(big.Int).Exp(srpG, x, srpPrime()), salt, nil
+}
+
+// srpPasswordKey derives the key that signs the PASSWORD_VERIFIER response
+// from the shared secret S = (B - k*g^x)^(a + u*x) mod N.
+func srpPasswordKey(poolName, userID, password string, a, bigA, bigB, salt *big.Int) ([]byte, error) {
+	n := srpPrime()
+
+	u := new(big.Int).SetBytes(srpHash(srpPad(bigA), srpPad(bigB)))
+	if u.Sign() == 0 {
+		return nil, errors.New("invalid SRP scrambling parameter")
+	}
+
+	identity := srpHash([]byte(poolName + userID + ":" + password))
+	x := new(big.Int).SetBytes(srpHash(srpPad(salt), identity))
+
+	gx := new(big.Int).Exp(srpG, x, n)
+	base := new(big.Int).Sub(bigB, new(big.Int).Mul(srpK, gx))
+	base.Mod(base, n)
+	exp := new(big.Int).Add(a, new(big.Int).Mul(u, x))
+	secret := new(big.Int).Exp(base, exp, n)
+
+	return hkdf.Key(sha256.New, srpPad(secret), srpPad(u), "Caldera Derived Key", 16)
+}
+
+// srpHash returns the SHA-256 hash of the concatenated parts.
+func srpHash(parts ...[]byte) []byte {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// srpPad returns n as big-endian bytes, with a leading zero byte when the
+// high bit is set so it reads as positive, as Cognito's clients do.
+func srpPad(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
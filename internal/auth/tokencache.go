@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// TokenValidator validates bearer tokens.
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (*Claims, error)
+}
+
+// TokenCache remembers the claims of recently validated tokens until they
+// expire, so a client reusing a token doesn't pay for signature
+// verification on every request. It holds at most size tokens, evicting
+// the least recently used. Failed validations are not cached.
+type TokenCache struct {
+	next TokenValidator
+	size int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List // Front is most recently used
+}
+
+// tokenCacheEntry is a cached token's claims, keyed by the token's hash.
+type tokenCacheEntry struct {
+	key    [sha256.Size]byte
+	claims *Claims
+}
+
+// NewTokenCache returns a TokenCache in front of next holding up to size
+// tokens.
+func NewTokenCache(next TokenValidator, size int) *TokenCache {
+	return &TokenCache{
+		next:    next,
+		size:    size,
+		entries: make(map[[sha256.Size]byte]*list.Element, size),
+		lru:     list.New(),
+	}
+}
+
+// ValidateToken returns the cached claims for token, or validates it with
+// the wrapped validator and caches the result until the token expires.
+func (c *TokenCache) ValidateToken(ctx context.Context, token string) (*Claims, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now().Unix()
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*tokenCacheEntry)
+		if now < entry.claims.ExpiresAt {
+			c.lru.MoveToFront(elem)
+			claims := *entry.claims
+			c.mu.Unlock()
+			return &claims, nil
+		}
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+
+	claims, err := c.next.ValidateToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt <= now {
+		return claims, nil
+	}
+
+	cached := *claims
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		// Another request validated the same token meanwhile.
+		c.lru.MoveToFront(elem)
+		return claims, nil
+	}
+	c.entries[key] = c.lru.PushFront(&tokenCacheEntry{key: key, claims: &cached})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tokenCacheEntry).key)
+	}
+
+	return claims, nil
+}
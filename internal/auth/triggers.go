@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+// ErrInvalidLambdaTrigger is returned when Cognito rejects a Lambda trigger,
+// e.g. because the function doesn't exist.
+var ErrInvalidLambdaTrigger = errors.New("invalid lambda trigger")
+
+// LambdaTriggers are the Lambda functions the user pool invokes during
+// sign-up, token issuing, and message sending, by ARN. Empty means no
+// trigger.
+type LambdaTriggers struct {
+	PreSignUp          string `json:"pre_sign_up,omitempty" example:"arn:aws:lambda:us-east-1:123456789012:function:pre-sign-up"`
+	PreTokenGeneration string `json:"pre_token_generation,omitempty" example:"arn:aws:lambda:us-east-1:123456789012:function:pre-token-generation"`
+	// PreTokenGenerationVersion is the pre token generation event version:
+	// V1_0 customizes ID tokens, V2_0 and V3_0 access tokens too, which
+	// needs the Essentials or Plus feature plan.
+	PreTokenGenerationVersion string `json:"pre_token_generation_version,omitempty" example:"V2_0" enums:"V1_0,V2_0,V3_0"`
+	CustomMessage             string `json:"custom_message,omitempty" example:"arn:aws:lambda:us-east-1:123456789012:function:custom-message"`
+}
+
+// LambdaTriggers returns the user pool's pre sign-up, pre token generation,
+// and custom message triggers.
+func (s *CognitoService) LambdaTriggers(ctx context.Context) (*LambdaTriggers, error) {
+	pool, err := s.describeUserPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newLambdaTriggers(pool.LambdaConfig), nil
+}
+
+// UpdateLambdaTriggers replaces the user pool's pre sign-up, pre token
+// generation, and custom message triggers. Its other triggers and settings
+// are kept. Cognito must be allowed to invoke the functions.
+func (s *CognitoService) UpdateLambdaTriggers(ctx context.Context, triggers LambdaTriggers) (*LambdaTriggers, error) {
+	pool, err := s.describeUserPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lambdaConfig := &types.LambdaConfigType{}
+	if pool.LambdaConfig != nil {
+		lambdaConfig = pool.LambdaConfig
+	}
+	lambdaConfig.PreSignUp = optionalString(triggers.PreSignUp)
+	lambdaConfig.CustomMessage = optionalString(triggers.CustomMessage)
+	lambdaConfig.PreTokenGeneration = optionalString(triggers.PreTokenGeneration)
+	lambdaConfig.PreTokenGenerationConfig = nil
+	if triggers.PreTokenGeneration != "" {
+		version := types.PreTokenGenerationLambdaVersionTypeV10
+		if triggers.PreTokenGenerationVersion != "" {
+			version = types.PreTokenGenerationLambdaVersionType(triggers.PreTokenGenerationVersion)
+		}
+		lambdaConfig.PreTokenGenerationConfig = &types.PreTokenGenerationVersionConfigType{
+			LambdaArn:     aws.String(triggers.PreTokenGeneration),
+			LambdaVersion: version,
+		}
+	}
+
+	// UpdateUserPool resets every setting it isn't given, so the pool's
+	// current settings are sent back with the new triggers.
+	adminCreateUserConfig := pool.AdminCreateUserConfig
+	if adminCreateUserConfig != nil {
+		// Deprecated in favor of the password policy's
+		// TemporaryPasswordValidityDays, and rejected alongside it.
+		adminCreateUserConfig.UnusedAccountValidityDays = 0
+	}
+	_, err = s.client.UpdateUserPool(ctx, &cognito.UpdateUserPoolInput{
+		UserPoolId:                  aws.String(s.cfg.UserPoolID),
+		PoolName:                    pool.Name,
+		AccountRecoverySetting:      pool.AccountRecoverySetting,
+		AdminCreateUserConfig:       adminCreateUserConfig,
+		AutoVerifiedAttributes:      pool.AutoVerifiedAttributes,
+		DeletionProtection:          pool.DeletionProtection,
+		DeviceConfiguration:         pool.DeviceConfiguration,
+		EmailConfiguration:          pool.EmailConfiguration,
+		EmailVerificationMessage:    pool.EmailVerificationMessage,
+		EmailVerificationSubject:    pool.EmailVerificationSubject,
+		LambdaConfig:                lambdaConfig,
+		MfaConfiguration:            pool.MfaConfiguration,
+		Policies:                    pool.Policies,
+		SmsAuthenticationMessage:    pool.SmsAuthenticationMessage,
+		SmsConfiguration:            pool.SmsConfiguration,
+		SmsVerificationMessage:      pool.SmsVerificationMessage,
+		UserAttributeUpdateSettings: pool.UserAttributeUpdateSettings,
+		UserPoolAddOns:              pool.UserPoolAddOns,
+		UserPoolTags:                pool.UserPoolTags,
+		UserPoolTier:                pool.UserPoolTier,
+		VerificationMessageTemplate: pool.VerificationMessageTemplate,
+	})
+	if err != nil {
+		var invalidParameter *types.InvalidParameterException
+		if errors.As(err, &invalidParameter) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidLambdaTrigger, aws.ToString(invalidParameter.Message))
+		}
+		return nil, fmt.Errorf("cognito update user pool failed: %w", err)
+	}
+
+	s.logger.Info("lambda triggers updated",
+		"pre_sign_up", triggers.PreSignUp,
+		"pre_token_generation", triggers.PreTokenGeneration,
+		"pre_token_generation_version", triggers.PreTokenGenerationVersion,
+		"custom_message", triggers.CustomMessage,
+	)
+	return newLambdaTriggers(lambdaConfig), nil
+}
+
+// describeUserPool returns the user pool's settings.
+func (s *CognitoService) describeUserPool(ctx context.Context) (*types.UserPoolType, error) {
+	result, err := s.client.DescribeUserPool(ctx, &cognito.DescribeUserPoolInput{
+		UserPoolId: aws.String(s.cfg.UserPoolID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cognito describe user pool failed: %w", err)
+	}
+	return result.UserPool, nil
+}
+
+// newLambdaTriggers converts a user pool's Lambda configuration to
+// LambdaTriggers.
+func newLambdaTriggers(c *types.LambdaConfigType) *LambdaTriggers {
+	triggers := &LambdaTriggers{}
+	if c == nil {
+		return triggers
+	}
+	triggers.PreSignUp = aws.ToString(c.PreSignUp)
+	triggers.CustomMessage = aws.ToString(c.CustomMessage)
+	triggers.PreTokenGeneration = aws.ToString(c.PreTokenGeneration)
+	if c.PreTokenGenerationConfig != nil {
+		triggers.PreTokenGeneration = aws.ToString(c.PreTokenGenerationConfig.LambdaArn)
+		triggers.PreTokenGenerationVersion = string(c.PreTokenGenerationConfig.LambdaVersion)
+	}
+	return triggers
+}
+
+// optionalString returns nil for an empty string, which the SDK omits.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+)
+
+// Invitation emails for admin-created users.
+const (
+	// InvitationSend emails the user their temporary password.
+	InvitationSend = ""
+	// InvitationSuppress creates the user without emailing them; the admin
+	// passes the temporary password on.
+	InvitationSuppress = "suppress"
+	// InvitationResend emails an existing user who hasn't logged in yet a
+	// new temporary password, resetting its expiry.
+	InvitationResend = "resend"
+)
+
+// NewUser is a user an admin creates.
+type NewUser struct {
+	Email string
+	Name  string
+	// TemporaryPassword is the password for the first login, which must be
+	// replaced in the NEW_PASSWORD_REQUIRED challenge. The identity
+	// provider generates one when it is empty.
+	TemporaryPassword string
+	// Invitation is InvitationSend, InvitationSuppress, or InvitationResend.
+	Invitation string
+}
+
+// AdminUser is a user as admins see it.
+type AdminUser struct {
+	Username string `json:"username" example:"a1b2c3d4-5678-90ab-cdef-EXAMPLE11111"`
+	Email    string `json:"email" example:"user@example.com"`
+	Name     string `json:"name,omitempty" example:"Jane Doe"`
+	// Status is the account status, e.g. FORCE_CHANGE_PASSWORD until the
+	// user replaces their temporary password.
+	Status    string    `json:"status" example:"FORCE_CHANGE_PASSWORD"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateUser creates a user with a temporary password. Their email is
+// marked verified, so they can reset a forgotten password. On first login
+// they get a NEW_PASSWORD_REQUIRED challenge.
+func (s *CognitoService) CreateUser(ctx context.Context, user NewUser) (*AdminUser, error) {
+	input := &cognito.AdminCreateUserInput{
+		UserPoolId: aws.String(s.cfg.UserPoolID),
+		Username:   aws.String(user.Email),
+		UserAttributes: []types.AttributeType{
+			{Name: aws.String("email"), Value: aws.String(user.Email)},
+			{Name: aws.String("email_verified"), Value: aws.String("true")},
+		},
+		DesiredDeliveryMediums: []types.DeliveryMediumType{types.DeliveryMediumTypeEmail},
+	}
+	if user.Name != "" {
+		input.UserAttributes = append(input.UserAttributes, types.AttributeType{
+			Name:  aws.String("name"),
+			Value: aws.String(user.Name),
+		})
+	}
+	if user.TemporaryPassword != "" {
+		input.TemporaryPassword = aws.String(user.TemporaryPassword)
+	}
+	switch user.Invitation {
+	case InvitationSuppress:
+		input.MessageAction = types.MessageActionTypeSuppress
+	case InvitationResend:
+		input.MessageAction = types.MessageActionTypeResend
+		// Attributes can't be changed when resending.
+		input.UserAttributes = nil
+	}
+
+	result, err := s.client.AdminCreateUser(ctx, input)
+	if err != nil {
+		var usernameExists *types.UsernameExistsException
+		var userNotFound *types.UserNotFoundException
+		var invalidPassword *types.InvalidPasswordException
+		var unsupportedUserState *types.UnsupportedUserStateException
+
+		switch {
+		case errors.As(err, &usernameExists):
+			return nil, ErrUserAlreadyExists
+		case errors.As(err, &userNotFound):
+			return nil, ErrUserNotFound
+		case errors.As(err, &invalidPassword):
+			return nil, ErrInvalidPassword
+		case errors.As(err, &unsupportedUserState):
+			// Only users who haven't logged in yet can be sent a new invitation.
+			return nil, ErrUserAlreadyExists
+		}
+		return nil, fmt.Errorf("cognito admin create user failed: %w", err)
+	}
+
+	s.logger.Info("user created by admin", "email", user.Email, "invitation", user.Invitation)
+	return newAdminUser(result.User), nil
+}
+
+// LookupUser returns the user with an email address as their access tokens
+// describe them, with their groups as roles.
+func (s *CognitoService) LookupUser(ctx context.Context, email string) (*User, error) {
+	result, err := s.client.AdminGetUser(ctx, &cognito.AdminGetUserInput{
+		UserPoolId: aws.String(s.cfg.UserPoolID),
+		Username:   aws.String(email),
+	})
+	if err != nil {
+		var userNotFound *types.UserNotFoundException
+		if errors.As(err, &userNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("cognito admin get user failed: %w", err)
+	}
+
+	user := &User{Username: aws.ToString(result.Username)}
+	for _, attr := range result.UserAttributes {
+		switch aws.ToString(attr.Name) {
+		case "sub":
+			user.ID = aws.ToString(attr.Value)
+		case "email":
+			user.Email = aws.ToString(attr.Value)
+		case "name":
+			user.Name = aws.ToString(attr.Value)
+		}
+	}
+
+	paginator := cognito.NewAdminListGroupsForUserPaginator(s.client, &cognito.AdminListGroupsForUserInput{
+		UserPoolId: aws.String(s.cfg.UserPoolID),
+		Username:   aws.String(email),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cognito admin list groups for user failed: %w", err)
+		}
+		for _, g := range page.Groups {
+			// As in ValidateToken, the federated identity provider group
+			// names the provider rather than a role.
+			group := aws.ToString(g.GroupName)
+			if provider, ok := strings.CutPrefix(group, s.cfg.UserPoolID+"_"); ok {
+				user.Provider = provider
+				continue
+			}
+			user.Roles = append(user.Roles, group)
+		}
+	}
+	user.IsAdmin = slices.Contains(user.Roles, "admin")
+
+	return user, nil
+}
+
+// newAdminUser converts a Cognito user to an AdminUser.
+func newAdminUser(u *types.UserType) *AdminUser {
+	user := &AdminUser{
+		Username:  aws.ToString(u.Username),
+		Status:    string(u.UserStatus),
+		Enabled:   u.Enabled,
+		CreatedAt: aws.ToTime(u.UserCreateDate),
+	}
+	for _, attr := range u.Attributes {
+		switch aws.ToString(attr.Name) {
+		case "email":
+			user.Email = aws.ToString(attr.Value)
+		case "name":
+			user.Name = aws.ToString(attr.Value)
+		}
+	}
+	return user
+}
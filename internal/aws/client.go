@@ -2,27 +2,103 @@ package aws
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/comprehend"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 
+	"github.com/pmollerus23/go-aws-server/internal/awscalls"
 	appConfig "github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/requestid"
 )
 
 // Clients holds all AWS service clients.
 type Clients struct {
-	Config   aws.Config
-	S3       *s3.Client
-	DynamoDB *dynamodb.Client
-	Cognito  *cognito.Client
+	Config     aws.Config
+	S3         *s3.Client
+	S3Control  *s3control.Client
+	DynamoDB   *dynamodb.Client
+	Cognito    *cognito.Client
+	SQS        *sqs.Client
+	SNS        *sns.Client
+	Lambda     *lambda.Client
+	CloudTrail *cloudtrail.Client
+	SSM        *ssm.Client
+	// SecretsManager reads access keys for SigV4 authentication.
+	SecretsManager *secretsmanager.Client
+	// Route53 answers ACME DNS challenges.
+	Route53 *route53.Client
+	// DynamoDBStreams reads table changes for live updates.
+	DynamoDBStreams *dynamodbstreams.Client
+	// EventBridge receives the server's domain events.
+	EventBridge *eventbridge.Client
+	// Kinesis takes clickstream-style records and feeds them to live
+	// updates.
+	Kinesis *kinesis.Client
+	// KMS encrypts data for clients and envelope-encrypts uploads.
+	KMS *kms.Client
+	// Athena runs analytics queries over data exported to S3.
+	Athena *athena.Client
+	// Rekognition analyzes uploaded images.
+	Rekognition *rekognition.Client
+	// Textract extracts text, forms, and tables from documents.
+	Textract *textract.Client
+	// Bedrock invokes foundation models.
+	Bedrock *bedrockruntime.Client
+	// Comprehend analyzes the sentiment, entities, and PII in text.
+	Comprehend *comprehend.Client
+	// CloudFormation reports the status of the stacks the server runs on.
+	CloudFormation *cloudformation.Client
+	// CostExplorer reports what the account spends.
+	CostExplorer *costexplorer.Client
+	// Regions hands out S3, DynamoDB, and Cognito clients for other
+	// regions.
+	Regions *RegionPool
+	// CloudWatch reads alarms and metrics.
+	CloudWatch *cloudwatch.Client
+	// AppConfigData reads feature flags.
+	AppConfigData *appconfigdata.Client
+	// STS reports the identity the other clients call AWS as.
+	STS *sts.Client
+	// InternalDynamoDB reaches the server's own tables: API keys, roles,
+	// the audit log, items, and image labels. Unlike DynamoDB it never
+	// takes on the role a request selects.
+	InternalDynamoDB *dynamodb.Client
 }
 
-// NewClients creates and initializes AWS service clients.
-func NewClients(ctx context.Context, logger *slog.Logger, awsConfig appConfig.AWSConfig) (*Clients, error) {
+// NewClients creates and initializes AWS service clients. The Cognito
+// client is created in the user pool's region, which may differ from the
+// others'.
+func NewClients(ctx context.Context, logger *slog.Logger, appCfg *appConfig.Config) (*Clients, error) {
+	awsConfig := appCfg.AWS
+
 	// Load AWS configuration
 	// This will use the default credential chain:
 	// 1. Environment variables (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN)
@@ -38,22 +114,130 @@ func NewClients(ctx context.Context, logger *slog.Logger, awsConfig appConfig.AW
 		configOpts = append(configOpts, config.WithSharedConfigProfile(awsConfig.Profile))
 	}
 
+	// Retry throttling and transient errors up to MaxAttempts times in all.
+	// Adaptive mode also holds calls back while AWS is throttling them
+	configOpts = append(configOpts,
+		config.WithRetryMode(aws.RetryMode(awsConfig.RetryMode)),
+		config.WithRetryMaxAttempts(awsConfig.MaxAttempts),
+	)
+
 	cfg, err := config.LoadDefaultConfig(ctx, configOpts...)
 	if err != nil {
 		logger.Error("failed to load AWS config", "error", err)
 		return nil, err
 	}
 
+	// Send every service to a local emulator such as LocalStack or MinIO,
+	// unless it has an endpoint of its own
+	if awsConfig.EndpointURL != "" {
+		cfg.BaseEndpoint = aws.String(awsConfig.EndpointURL)
+	}
+	endpoint := func(service string) *string {
+		if url, ok := awsConfig.Endpoints[service]; ok {
+			return aws.String(url)
+		}
+		return cfg.BaseEndpoint
+	}
+
+	// Count calls per HTTP request so fan-outs can be logged and capped
+	cfg.APIOptions = append(cfg.APIOptions, awscalls.Count)
+	// Bound every call, so a hung connection can't hold a request forever
+	cfg.APIOptions = append(cfg.APIOptions, awscalls.Timeout(awsConfig.CallTimeout, awsConfig.CallTimeouts))
+	// Tag calls with the request ID for correlation with the server's logs
+	cfg.APIOptions = append(cfg.APIOptions, requestid.Propagate)
+	// Trace calls as children of the request's span
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+
+	// Assume the configured roles with the default chain's identity. Every
+	// client takes on AssumeRole, and S3, DynamoDB, and STS calls may be
+	// sent as any role named in their context. InternalDynamoDB's never are
+	stsClient := sts.NewFromConfig(cfg, func(o *sts.Options) { o.BaseEndpoint = endpoint("STS") })
+	roles := make(map[string]aws.CredentialsProvider, len(awsConfig.Roles))
+	for name, role := range awsConfig.Roles {
+		roles[name] = assumeRoleProvider(stsClient, role)
+	}
+	if awsConfig.AssumeRole != "" {
+		cfg.Credentials = roles[awsConfig.AssumeRole]
+	}
+	selectRole := func(credentials *aws.CredentialsProvider) {
+		if len(roles) > 0 {
+			*credentials = roleCredentials{base: *credentials, roles: roles}
+		}
+	}
+
 	logger.Info("AWS config loaded",
 		"region", cfg.Region,
+		"assume_role", awsConfig.AssumeRole,
+		"roles", len(roles),
+		"endpoint_url", awsConfig.EndpointURL,
+		"endpoints", awsConfig.Endpoints,
+		"retry_mode", awsConfig.RetryMode,
+		"max_attempts", awsConfig.MaxAttempts,
+		"call_timeout", awsConfig.CallTimeout,
 	)
 
-	// Create service clients
+	// Create service clients. S3, DynamoDB, and Cognito can be used in
+	// other regions too, so their clients come from the region pool
+	regional := func(region string) *RegionalClients {
+		return &RegionalClients{
+			Region: region,
+			S3: s3.NewFromConfig(cfg, func(o *s3.Options) {
+				o.Region = region
+				o.BaseEndpoint = endpoint("S3")
+				o.UsePathStyle = awsConfig.S3UsePathStyle
+				selectRole(&o.Credentials)
+			}),
+			DynamoDB: dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+				o.Region = region
+				o.BaseEndpoint = endpoint("DYNAMODB")
+				selectRole(&o.Credentials)
+			}),
+			Cognito: cognito.NewFromConfig(cfg, func(o *cognito.Options) {
+				o.Region = region
+				o.BaseEndpoint = endpoint("COGNITO_IDENTITY_PROVIDER")
+			}),
+		}
+	}
+	regions := newRegionPool(regional(cfg.Region), awsConfig.RegionPoolSize, awsConfig.DataResidency, regional)
+	cognitoClients, err := regions.get(appCfg.Cognito.Region)
+	if err != nil {
+		return nil, fmt.Errorf("AWS_COGNITO_REGION: %w", err)
+	}
+
 	clients := &Clients{
-		Config:   cfg,
-		S3:       s3.NewFromConfig(cfg),
-		DynamoDB: dynamodb.NewFromConfig(cfg),
-		Cognito:  cognito.NewFromConfig(cfg),
+		Config:     cfg,
+		Regions:    regions,
+		S3:         regions.Home().S3,
+		DynamoDB:   regions.Home().DynamoDB,
+		Cognito:    cognitoClients.Cognito,
+		S3Control:  s3control.NewFromConfig(cfg, func(o *s3control.Options) { o.BaseEndpoint = endpoint("S3_CONTROL") }),
+		SQS:        sqs.NewFromConfig(cfg, func(o *sqs.Options) { o.BaseEndpoint = endpoint("SQS") }),
+		SNS:        sns.NewFromConfig(cfg, func(o *sns.Options) { o.BaseEndpoint = endpoint("SNS") }),
+		Lambda:     lambda.NewFromConfig(cfg, func(o *lambda.Options) { o.BaseEndpoint = endpoint("LAMBDA") }),
+		CloudTrail: cloudtrail.NewFromConfig(cfg, func(o *cloudtrail.Options) { o.BaseEndpoint = endpoint("CLOUDTRAIL") }),
+		SSM:        ssm.NewFromConfig(cfg, func(o *ssm.Options) { o.BaseEndpoint = endpoint("SSM") }),
+
+		SecretsManager: secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) { o.BaseEndpoint = endpoint("SECRETS_MANAGER") }),
+		Route53:        route53.NewFromConfig(cfg, func(o *route53.Options) { o.BaseEndpoint = endpoint("ROUTE_53") }),
+
+		DynamoDBStreams: dynamodbstreams.NewFromConfig(cfg, func(o *dynamodbstreams.Options) { o.BaseEndpoint = endpoint("DYNAMODB_STREAMS") }),
+		EventBridge:     eventbridge.NewFromConfig(cfg, func(o *eventbridge.Options) { o.BaseEndpoint = endpoint("EVENTBRIDGE") }),
+		Kinesis:         kinesis.NewFromConfig(cfg, func(o *kinesis.Options) { o.BaseEndpoint = endpoint("KINESIS") }),
+		KMS:             kms.NewFromConfig(cfg, func(o *kms.Options) { o.BaseEndpoint = endpoint("KMS") }),
+		Athena:          athena.NewFromConfig(cfg, func(o *athena.Options) { o.BaseEndpoint = endpoint("ATHENA") }),
+		Rekognition:     rekognition.NewFromConfig(cfg, func(o *rekognition.Options) { o.BaseEndpoint = endpoint("REKOGNITION") }),
+		Textract:        textract.NewFromConfig(cfg, func(o *textract.Options) { o.BaseEndpoint = endpoint("TEXTRACT") }),
+		Bedrock:         bedrockruntime.NewFromConfig(cfg, func(o *bedrockruntime.Options) { o.BaseEndpoint = endpoint("BEDROCK_RUNTIME") }),
+		Comprehend:      comprehend.NewFromConfig(cfg, func(o *comprehend.Options) { o.BaseEndpoint = endpoint("COMPREHEND") }),
+		CloudFormation:  cloudformation.NewFromConfig(cfg, func(o *cloudformation.Options) { o.BaseEndpoint = endpoint("CLOUDFORMATION") }),
+		CostExplorer:    costexplorer.NewFromConfig(cfg, func(o *costexplorer.Options) { o.BaseEndpoint = endpoint("COST_EXPLORER") }),
+		CloudWatch:      cloudwatch.NewFromConfig(cfg, func(o *cloudwatch.Options) { o.BaseEndpoint = endpoint("CLOUDWATCH") }),
+		AppConfigData:   appconfigdata.NewFromConfig(cfg, func(o *appconfigdata.Options) { o.BaseEndpoint = endpoint("APPCONFIGDATA") }),
+		STS: sts.NewFromConfig(cfg, func(o *sts.Options) {
+			o.BaseEndpoint = endpoint("STS")
+			selectRole(&o.Credentials)
+		}),
+		InternalDynamoDB: dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) { o.BaseEndpoint = endpoint("DYNAMODB") }),
 	}
 
 	return clients, nil
@@ -0,0 +1,187 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+
+	appConfig "github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// secretKeyTTL is how long an access key read from Secrets Manager, or the
+// absence of one, is remembered.
+const secretKeyTTL = 5 * time.Minute
+
+// StaticKeys is a KeyProvider holding a fixed set of access keys, keyed by
+// access key ID.
+type StaticKeys map[string]Credential
+
+// NewStaticKeys returns the access keys in keys.
+func NewStaticKeys(keys []appConfig.IAMKey) StaticKeys {
+	static := make(StaticKeys, len(keys))
+	for _, key := range keys {
+		static[key.AccessKeyID] = Credential{
+			AccessKeyID:     key.AccessKeyID,
+			SecretAccessKey: key.SecretAccessKey,
+			UserID:          key.UserID,
+			Roles:           key.Roles,
+		}
+	}
+	return static
+}
+
+// Credential returns the access key with ID accessKeyID.
+func (s StaticKeys) Credential(ctx context.Context, accessKeyID string) (*Credential, error) {
+	cred, ok := s[accessKeyID]
+	if !ok {
+		return nil, ErrUnknownAccessKey
+	}
+	return &cred, nil
+}
+
+// secretKey is the JSON document an access key is stored as in Secrets
+// Manager.
+type secretKey struct {
+	SecretAccessKey string   `json:"secret_access_key"`
+	UserID          string   `json:"user_id"`
+	Roles           []string `json:"roles"`
+}
+
+// cachedKey is an access key read from Secrets Manager; cred is nil if
+// there was no such key.
+type cachedKey struct {
+	cred     *Credential
+	cachedAt time.Time
+}
+
+// SecretsManagerKeys is a KeyProvider that reads access keys from Secrets
+// Manager. The key with ID AKID is the secret named prefix+AKID, a JSON
+// document with secret_access_key, user_id, and roles.
+type SecretsManagerKeys struct {
+	client *secretsmanager.Client
+	prefix string
+
+	mu    sync.Mutex
+	cache map[string]cachedKey
+}
+
+// NewSecretsManagerKeys returns a SecretsManagerKeys reading secrets named
+// prefix+AKID.
+func NewSecretsManagerKeys(client *secretsmanager.Client, prefix string) *SecretsManagerKeys {
+	return &SecretsManagerKeys{
+		client: client,
+		prefix: prefix,
+		cache:  make(map[string]cachedKey),
+	}
+}
+
+// Credential returns the access key with ID accessKeyID.
+func (s *SecretsManagerKeys) Credential(ctx context.Context, accessKeyID string) (*Credential, error) {
+	if !validAccessKeyID(accessKeyID) {
+		return nil, ErrUnknownAccessKey
+	}
+
+	s.mu.Lock()
+	cached, ok := s.cache[accessKeyID]
+	s.mu.Unlock()
+	if ok && time.Since(cached.cachedAt) < secretKeyTTL {
+		if cached.cred == nil {
+			return nil, ErrUnknownAccessKey
+		}
+		return cached.cred, nil
+	}
+
+	cred, err := s.load(ctx, accessKeyID)
+	if err != nil && !errors.Is(err, ErrUnknownAccessKey) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[accessKeyID] = cachedKey{cred: cred, cachedAt: time.Now()}
+	s.mu.Unlock()
+	return cred, err
+}
+
+// load reads the access key with ID accessKeyID from Secrets Manager.
+func (s *SecretsManagerKeys) load(ctx context.Context, accessKeyID string) (*Credential, error) {
+	out, err := s.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(s.prefix + accessKeyID),
+	})
+	if err != nil {
+		var notFound *smtypes.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return nil, ErrUnknownAccessKey
+		}
+		return nil, fmt.Errorf("read access key secret: %w", err)
+	}
+
+	var secret secretKey
+	if err := json.Unmarshal([]byte(aws.ToString(out.SecretString)), &secret); err != nil {
+		return nil, fmt.Errorf("access key secret %s is not valid JSON: %w", aws.ToString(out.Name), err)
+	}
+	if secret.SecretAccessKey == "" || secret.UserID == "" {
+		return nil, fmt.Errorf("access key secret %s must have secret_access_key and user_id", aws.ToString(out.Name))
+	}
+
+	return &Credential{
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secret.SecretAccessKey,
+		UserID:          secret.UserID,
+		Roles:           secret.Roles,
+	}, nil
+}
+
+// KeyProviders is a KeyProvider that looks access keys up in each of its
+// providers in turn.
+type KeyProviders []KeyProvider
+
+// Credential returns the access key with ID accessKeyID from the first
+// provider that has it.
+func (p KeyProviders) Credential(ctx context.Context, accessKeyID string) (*Credential, error) {
+	for _, provider := range p {
+		cred, err := provider.Credential(ctx, accessKeyID)
+		if errors.Is(err, ErrUnknownAccessKey) {
+			continue
+		}
+		return cred, err
+	}
+	return nil, ErrUnknownAccessKey
+}
+
+// validAccessKeyID reports whether id can be an access key ID, which are
+// 16 to 128 uppercase letters and digits. Anything else can't name a
+// secret.
+func validAccessKeyID(id string) bool {
+	if len(id) < 16 || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !('A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewIAMKeyProvider returns the KeyProvider cfg configures, or nil if
+// SigV4 authentication is disabled.
+func NewIAMKeyProvider(cfg appConfig.IAMAuthConfig, client *secretsmanager.Client) KeyProvider {
+	var providers KeyProviders
+	if len(cfg.Keys) > 0 {
+		providers = append(providers, NewStaticKeys(cfg.Keys))
+	}
+	if cfg.SecretPrefix != "" {
+		providers = append(providers, NewSecretsManagerKeys(client, cfg.SecretPrefix))
+	}
+	if len(providers) == 0 {
+		return nil
+	}
+	return providers
+}
@@ -0,0 +1,109 @@
+package aws
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+
+	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	appConfig "github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// ErrInvalidRegion is returned for names that aren't AWS regions.
+var ErrInvalidRegion = errors.New("invalid AWS region")
+
+// ErrRegionNotAllowed is returned for regions the data residency policy
+// blocks.
+var ErrRegionNotAllowed = errors.New("region not allowed by data residency policy")
+
+// regionName matches AWS region names, such as us-east-1 or us-gov-west-1.
+var regionName = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// RegionalClients are the clients, for one region, of the services that can
+// be used outside the server's own region.
+type RegionalClients struct {
+	Region   string
+	S3       *s3.Client
+	DynamoDB *dynamodb.Client
+	Cognito  *cognito.Client
+}
+
+// RegionPool hands out RegionalClients, creating them on first use. It
+// keeps the server's own region's clients and the size most recently used
+// others, and refuses regions the data residency policy blocks. It is safe
+// for concurrent use.
+type RegionPool struct {
+	home      *RegionalClients
+	size      int
+	residency appConfig.DataResidencyPolicy
+	build     func(region string) *RegionalClients
+
+	mu     sync.Mutex
+	recent *list.List // Of *RegionalClients, most recently used first
+	byName map[string]*list.Element
+}
+
+// newRegionPool creates a pool around the home region's clients that
+// creates others with build and hands out only regions residency allows.
+func newRegionPool(home *RegionalClients, size int, residency appConfig.DataResidencyPolicy, build func(region string) *RegionalClients) *RegionPool {
+	return &RegionPool{
+		home:      home,
+		size:      size,
+		residency: residency,
+		build:     build,
+		recent:    list.New(),
+		byName:    make(map[string]*list.Element),
+	}
+}
+
+// Home returns the clients for the server's own region.
+func (p *RegionPool) Home() *RegionalClients {
+	return p.home
+}
+
+// Residency returns the data residency policy the pool enforces.
+func (p *RegionPool) Residency() appConfig.DataResidencyPolicy {
+	return p.residency
+}
+
+// Get returns the clients for region, or the server's own region's if
+// region is empty. It returns ErrInvalidRegion if region isn't a region
+// name and ErrRegionNotAllowed if the data residency policy blocks it.
+func (p *RegionPool) Get(region string) (*RegionalClients, error) {
+	if region != "" && regionName.MatchString(region) && !p.residency.Allows(region) {
+		return nil, fmt.Errorf("%w: %q", ErrRegionNotAllowed, region)
+	}
+	return p.get(region)
+}
+
+// get is Get without the data residency policy, for the server's own
+// configuration rather than regions requests ask for.
+func (p *RegionPool) get(region string) (*RegionalClients, error) {
+	if region == "" || region == p.home.Region {
+		return p.home, nil
+	}
+	if !regionName.MatchString(region) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRegion, region)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.byName[region]; ok {
+		p.recent.MoveToFront(e)
+		return e.Value.(*RegionalClients), nil
+	}
+
+	clients := p.build(region)
+	p.byName[region] = p.recent.PushFront(clients)
+	if p.recent.Len() > p.size {
+		oldest := p.recent.Back()
+		p.recent.Remove(oldest)
+		delete(p.byName, oldest.Value.(*RegionalClients).Region)
+	}
+	return clients, nil
+}
@@ -0,0 +1,79 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+
+	appConfig "github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// RoleHeader is the request header naming the role, one of the configured
+// AWS_ROLES_<NAME>, that a request's S3 and DynamoDB calls are sent as.
+const RoleHeader = "X-AWS-Role"
+
+// roleSessionName identifies the server's sessions in the roles' CloudTrail
+// logs.
+const roleSessionName = "go-aws-server"
+
+type roleContextKey struct{}
+
+// WithRole returns a copy of ctx whose S3 and DynamoDB calls are sent as the
+// named role.
+func WithRole(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, roleContextKey{}, name)
+}
+
+// RoleFromContext returns the role ctx's S3 and DynamoDB calls are sent as,
+// or "" for the server's own identity.
+func RoleFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(roleContextKey{}).(string)
+	return name
+}
+
+// assumeRoleProvider returns cached credentials for role, assumed with the
+// identity of client.
+func assumeRoleProvider(client *sts.Client, role appConfig.AssumeRole) aws.CredentialsProvider {
+	return aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, role.ARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = roleSessionName
+		if role.ExternalID != "" {
+			o.ExternalID = aws.String(role.ExternalID)
+		}
+
+		// Sorted, so the session's tags are the same on every refresh
+		keys := make([]string, 0, len(role.SessionTags))
+		for key := range role.SessionTags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			o.Tags = append(o.Tags, ststypes.Tag{Key: aws.String(key), Value: aws.String(role.SessionTags[key])})
+		}
+	}))
+}
+
+// roleCredentials picks the credentials for each call by the role in its
+// context, falling back to the server's own.
+type roleCredentials struct {
+	base  aws.CredentialsProvider
+	roles map[string]aws.CredentialsProvider
+}
+
+// Retrieve returns the credentials of the role in ctx, or the server's own
+// if it names none.
+func (p roleCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	name := RoleFromContext(ctx)
+	if name == "" {
+		return p.base.Retrieve(ctx)
+	}
+	provider, ok := p.roles[name]
+	if !ok {
+		return aws.Credentials{}, fmt.Errorf("role %q is not configured", name)
+	}
+	return provider.Retrieve(ctx)
+}
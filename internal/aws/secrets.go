@@ -0,0 +1,75 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// ReadSecret returns the current version of the Secrets Manager secret id.
+// If the secret is a JSON object, the value of its field named key is
+// returned instead of the whole document.
+func ReadSecret(ctx context.Context, client *secretsmanager.Client, id, key string) (string, error) {
+	out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", fmt.Errorf("read secret %s: %w", id, err)
+	}
+
+	value := aws.ToString(out.SecretString)
+	if strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(value), &fields); err != nil {
+			return "", fmt.Errorf("secret %s is not valid JSON: %w", id, err)
+		}
+		field, ok := fields[key].(string)
+		if !ok {
+			return "", fmt.Errorf("secret %s has no string %s field", id, key)
+		}
+		value = field
+	}
+	if value == "" {
+		return "", fmt.Errorf("secret %s is empty", id)
+	}
+	return value, nil
+}
+
+// WatchSecret reads the secret id every interval, as ReadSecret does, and
+// calls onChange with its value whenever it differs from the last one seen,
+// starting with current. Rotating the secret in Secrets Manager thus takes
+// effect on the next read. A failed read keeps the last value. It returns
+// immediately; polling stops when ctx is cancelled.
+func WatchSecret(ctx context.Context, client *secretsmanager.Client, id, key, current string, interval time.Duration, logger *slog.Logger, onChange func(string)) {
+	go func() {
+		last := current
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			value, err := ReadSecret(ctx, client, id, key)
+			switch {
+			case err != nil:
+				if ctx.Err() == nil {
+					logger.Error("failed to refresh secret", "error", err, "secret", id)
+				}
+			case value != last:
+				last = value
+				onChange(value)
+				logger.Info("secret rotated", "secret", id)
+			}
+		}
+	}()
+}
@@ -0,0 +1,127 @@
+// Package awscalls counts the AWS SDK calls made on behalf of each HTTP
+// request and optionally caps them, so pathological fan-outs such as
+// unbounded pagination fail fast with a clear error instead of running up
+// latency and cost. It also bounds how long each call may wait for AWS.
+package awscalls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// ErrBudgetExceeded is returned by SDK calls made after a request has used
+// up its call budget.
+var ErrBudgetExceeded = errors.New("AWS call budget exceeded")
+
+type contextKey struct{}
+
+// Counter tallies the AWS calls made for one request. Calls are counted per
+// operation, not per attempt, so SDK retries don't count against the budget.
+type Counter struct {
+	limit int
+
+	mu         sync.Mutex
+	calls      int
+	exceeded   bool
+	operations map[string]int // Keyed by "Service.Operation"
+}
+
+// NewCounter creates a counter that allows limit calls, or any number of
+// calls if limit is 0.
+func NewCounter(limit int) *Counter {
+	return &Counter{limit: limit, operations: make(map[string]int)}
+}
+
+// NewContext returns a copy of ctx in which AWS calls are counted by c.
+func NewContext(ctx context.Context, c *Counter) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the counter for ctx, or nil if calls aren't counted.
+func FromContext(ctx context.Context) *Counter {
+	c, _ := ctx.Value(contextKey{}).(*Counter)
+	return c
+}
+
+// Detach returns a copy of ctx whose calls aren't counted. Use it for work
+// that outlives the request, such as background jobs.
+func Detach(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, (*Counter)(nil))
+}
+
+// Limit returns the call budget, or 0 if there is none.
+func (c *Counter) Limit() int {
+	return c.limit
+}
+
+// Calls returns the number of calls made so far.
+func (c *Counter) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// Exceeded reports whether a call was rejected for exceeding the budget.
+func (c *Counter) Exceeded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exceeded
+}
+
+// Operations returns the calls made so far as "Service.Operation=N" pairs,
+// busiest first.
+func (c *Counter) Operations() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ops := make([]string, 0, len(c.operations))
+	for op := range c.operations {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if c.operations[ops[i]] != c.operations[ops[j]] {
+			return c.operations[ops[i]] > c.operations[ops[j]]
+		}
+		return ops[i] < ops[j]
+	})
+	for i, op := range ops {
+		ops[i] = fmt.Sprintf("%s=%d", op, c.operations[op])
+	}
+	return ops
+}
+
+// add records a call, or returns ErrBudgetExceeded if the budget is spent.
+func (c *Counter) add(operation string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.limit > 0 && c.calls >= c.limit {
+		c.exceeded = true
+		return fmt.Errorf("%w: %s would be call %d of %d", ErrBudgetExceeded, operation, c.calls+1, c.limit)
+	}
+	c.calls++
+	c.operations[operation]++
+	return nil
+}
+
+// Count is an SDK API option that counts every call against the counter in
+// its context. Add it to aws.Config.APIOptions.
+func Count(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CountAWSCalls",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			if c := FromContext(ctx); c != nil {
+				operation := awsmiddleware.GetServiceID(ctx) + "." + awsmiddleware.GetOperationName(ctx)
+				if err := c.add(operation); err != nil {
+					return middleware.InitializeOutput{}, middleware.Metadata{}, err
+				}
+			}
+			return next.HandleInitialize(ctx, in)
+		},
+	), middleware.After)
+}
@@ -0,0 +1,54 @@
+package awscalls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// ErrTimeout is returned by SDK calls that got no response within their
+// service's timeout.
+var ErrTimeout = errors.New("AWS call timed out")
+
+// Timeout returns an SDK API option that fails calls, retries included,
+// that haven't received a response within the timeout for their service.
+// timeouts is keyed like AWS_ENDPOINT_URL_<SERVICE>, by the service ID in
+// uppercase with underscores for spaces, such as S3, DYNAMODB, or
+// BEDROCK_RUNTIME; other services get defaultTimeout. A timeout of 0 means
+// none. The deadline ends with the response, so streamed response bodies,
+// such as S3 downloads, may take longer. Add it to aws.Config.APIOptions.
+func Timeout(defaultTimeout time.Duration, timeouts map[string]time.Duration) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("AWSCallTimeout",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				service := awsmiddleware.GetServiceID(ctx)
+				timeout, ok := timeouts[strings.ToUpper(strings.ReplaceAll(service, " ", "_"))]
+				if !ok {
+					timeout = defaultTimeout
+				}
+				if timeout <= 0 {
+					return next.HandleInitialize(ctx, in)
+				}
+
+				// A deadline would also cut off the response body, so cancel
+				// the call only if no response arrives in time
+				ctx, cancel := context.WithCancelCause(ctx)
+				timer := time.AfterFunc(timeout, func() { cancel(ErrTimeout) })
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				timer.Stop()
+				if err != nil {
+					if errors.Is(context.Cause(ctx), ErrTimeout) {
+						err = fmt.Errorf("%w: %s.%s got no response within %s", ErrTimeout, service, awsmiddleware.GetOperationName(ctx), timeout)
+					}
+					cancel(nil)
+				}
+				return out, metadata, err
+			},
+		), middleware.After)
+	}
+}
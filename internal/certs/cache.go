@@ -0,0 +1,61 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// errCacheMiss is returned by cache.get for keys that aren't stored.
+var errCacheMiss = errors.New("not in certificate cache")
+
+// cache stores the account key, certificates, and pending HTTP challenges
+// as objects under a prefix of an S3 bucket, so every instance shares them.
+type cache struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// get returns the object stored under key.
+func (c *cache) get(ctx context.Context, key string) ([]byte, error) {
+	result, err := c.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(c.prefix + key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, errCacheMiss
+		}
+		return nil, err
+	}
+	defer result.Body.Close()
+	return io.ReadAll(result.Body)
+}
+
+// put stores data under key, encrypted at rest since it may hold private
+// keys.
+func (c *cache) put(ctx context.Context, key string, data []byte) error {
+	_, err := c.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(c.bucket),
+		Key:                  aws.String(c.prefix + key),
+		Body:                 bytes.NewReader(data),
+		ServerSideEncryption: types.ServerSideEncryptionAes256,
+	})
+	return err
+}
+
+// delete removes the object stored under key.
+func (c *cache) delete(ctx context.Context, key string) error {
+	_, err := c.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(c.prefix + key),
+	})
+	return err
+}
@@ -0,0 +1,438 @@
+// Package certs obtains and renews TLS certificates from an ACME CA such as
+// Let's Encrypt. The account key, certificates, and pending HTTP challenges
+// are kept in S3, so instances behind a load balancer share one certificate
+// per domain and can answer each other's challenges.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/crypto/acme"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+const (
+	// renewBefore is how long before expiry certificates are renewed.
+	renewBefore = 30 * 24 * time.Hour
+	// renewInterval is how often certificates are checked for renewal.
+	renewInterval = 12 * time.Hour
+
+	// accountKeyName is the cache key of the ACME account key.
+	accountKeyName = "account.key"
+	// challengePrefix prefixes the cache keys of pending HTTP challenges.
+	challengePrefix = "http-01/"
+	// challengePath is the path the CA requests HTTP challenge tokens at.
+	challengePath = "/.well-known/acme-challenge/"
+)
+
+// challengeToken matches ACME challenge tokens, which are base64url.
+var challengeToken = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Manager serves certificates for the configured domains, obtaining them
+// when they are missing and renewing them before they expire.
+type Manager struct {
+	domains   []string
+	email     string
+	directory string
+	challenge string
+	cache     *cache
+	dns       *route53Solver
+	logger    *slog.Logger
+
+	// issueMu serializes obtaining certificates, and guards client.
+	issueMu sync.Mutex
+	client  *acme.Client
+
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate
+	// tokens maps the pending HTTP challenge tokens to their responses.
+	tokens map[string]string
+}
+
+// New returns a Manager, or nil if ACME is disabled.
+func New(cfg config.ACMEConfig, s3Client *s3.Client, route53Client *route53.Client, logger *slog.Logger) *Manager {
+	if !cfg.Enabled() {
+		return nil
+	}
+
+	m := &Manager{
+		domains:   cfg.Domains,
+		email:     cfg.Email,
+		directory: cfg.DirectoryURL,
+		challenge: cfg.Challenge,
+		cache:     &cache{client: s3Client, bucket: cfg.CacheBucket, prefix: cfg.CachePrefix},
+		logger:    logger,
+		certs:     make(map[string]*tls.Certificate),
+		tokens:    make(map[string]string),
+	}
+	if cfg.Challenge == config.ACMEChallengeDNS {
+		m.dns = &route53Solver{client: route53Client, zoneID: cfg.HostedZoneID}
+	}
+	return m
+}
+
+// Start obtains any missing certificates, then renews them every
+// renewInterval until ctx is done.
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(renewInterval)
+		defer ticker.Stop()
+
+		for {
+			for _, domain := range m.domains {
+				if _, err := m.certificate(ctx, domain, renewBefore); err != nil {
+					m.logger.ErrorContext(ctx, "failed to renew certificate", "domain", domain, "error", err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// GetCertificate returns the certificate for the server name a TLS client
+// asked for, for use as tls.Config.GetCertificate.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name == "" {
+		// Clients without SNI, such as health checks by IP address
+		name = strings.TrimPrefix(m.domains[0], "*.")
+	}
+
+	domain, ok := m.match(name)
+	if !ok {
+		return nil, fmt.Errorf("no certificate for %q", name)
+	}
+	return m.certificate(hello.Context(), domain, 0)
+}
+
+// HTTPHandler answers HTTP challenges, and passes every other request to
+// fallback.
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.URL.Path, challengePath)
+		if !ok {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		response, err := m.challengeResponse(r.Context(), token)
+		if err != nil {
+			problem.Error(w, r, "challenge not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, response)
+	})
+}
+
+// match returns the configured domain whose certificate covers name.
+func (m *Manager) match(name string) (string, bool) {
+	if slices.Contains(m.domains, name) {
+		return name, true
+	}
+	if _, parent, ok := strings.Cut(name, "."); ok && slices.Contains(m.domains, "*."+parent) {
+		return "*." + parent, true
+	}
+	return "", false
+}
+
+// certificate returns the certificate for domain, loading it from the
+// cache or obtaining a new one if the one in memory expires within
+// minValid.
+func (m *Manager) certificate(ctx context.Context, domain string, minValid time.Duration) (*tls.Certificate, error) {
+	if cert := m.cached(domain); validFor(cert, minValid) {
+		return cert, nil
+	}
+
+	m.issueMu.Lock()
+	defer m.issueMu.Unlock()
+
+	// Another caller may have obtained it while we waited
+	if cert := m.cached(domain); validFor(cert, minValid) {
+		return cert, nil
+	}
+
+	// Another instance may have obtained it
+	cert, err := m.load(ctx, domain)
+	if err != nil && !errors.Is(err, errCacheMiss) {
+		m.logger.WarnContext(ctx, "failed to load cached certificate", "domain", domain, "error", err)
+	}
+	if !validFor(cert, minValid) {
+		if cert, err = m.obtain(ctx, domain); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	m.certs[domain] = cert
+	m.mu.Unlock()
+	return cert, nil
+}
+
+// cached returns the certificate in memory for domain, or nil.
+func (m *Manager) cached(domain string) *tls.Certificate {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.certs[domain]
+}
+
+// validFor reports whether cert is valid for at least d longer.
+func validFor(cert *tls.Certificate, d time.Duration) bool {
+	return cert != nil && time.Until(cert.Leaf.NotAfter) > d
+}
+
+// load reads the certificate for domain from the cache.
+func (m *Manager) load(ctx context.Context, domain string) (*tls.Certificate, error) {
+	data, err := m.cache.get(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	// The key and chain are stored in one PEM file
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, fmt.Errorf("cached certificate for %s: %w", domain, err)
+	}
+	return &cert, nil
+}
+
+// obtain orders a certificate for domain from the CA and caches it. It is
+// called with issueMu held.
+func (m *Manager) obtain(ctx context.Context, domain string) (*tls.Certificate, error) {
+	m.logger.InfoContext(ctx, "obtaining certificate", "domain", domain, "challenge", m.challenge)
+
+	client, err := m.acmeClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return nil, fmt.Errorf("order certificate for %s: %w", domain, err)
+	}
+	for _, u := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, u); err != nil {
+			return nil, err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("order certificate for %s: %w", domain, err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{domain}}, key)
+	if err != nil {
+		return nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("issue certificate for %s: %w", domain, err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var data bytes.Buffer
+	pem.Encode(&data, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for _, der := range chain {
+		pem.Encode(&data, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	cert, err := tls.X509KeyPair(data.Bytes(), data.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("issued certificate for %s: %w", domain, err)
+	}
+
+	// Other instances would obtain their own if caching fails, so it isn't
+	// fatal
+	if err := m.cache.put(ctx, domain, data.Bytes()); err != nil {
+		m.logger.WarnContext(ctx, "failed to cache certificate", "domain", domain, "error", err)
+	}
+
+	m.logger.InfoContext(ctx, "obtained certificate", "domain", domain, "expires", cert.Leaf.NotAfter)
+	return &cert, nil
+}
+
+// authorize proves control of the domain of the authorization at url with
+// the configured challenge, unless it is already proven.
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return fmt.Errorf("get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	domain := authz.Identifier.Value
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == m.challenge {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("CA offers no %s challenge for %s", m.challenge, domain)
+	}
+
+	switch m.challenge {
+	case config.ACMEChallengeDNS:
+		record, err := client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return err
+		}
+		if err := m.dns.present(ctx, domain, record); err != nil {
+			return err
+		}
+		defer func() {
+			if err := m.dns.cleanup(context.WithoutCancel(ctx), domain, record); err != nil {
+				m.logger.WarnContext(ctx, "failed to delete challenge record", "domain", domain, "error", err)
+			}
+		}()
+	default:
+		response, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return err
+		}
+		if err := m.putChallenge(ctx, challenge.Token, response); err != nil {
+			return err
+		}
+		defer m.deleteChallenge(context.WithoutCancel(ctx), challenge.Token)
+	}
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("accept %s challenge for %s: %w", m.challenge, domain, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorize %s: %w", domain, err)
+	}
+	return nil
+}
+
+// acmeClient returns the client registered with the CA, registering the
+// account the first time. It is called with issueMu held.
+func (m *Manager) acmeClient(ctx context.Context) (*acme.Client, error) {
+	if m.client != nil {
+		return m.client, nil
+	}
+
+	key, err := m.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: m.directory}
+
+	var contact []string
+	if m.email != "" {
+		contact = append(contact, "mailto:"+m.email)
+	}
+	if _, err := client.Register(ctx, &acme.Account{Contact: contact}, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("register ACME account: %w", err)
+	}
+
+	m.client = client
+	return client, nil
+}
+
+// accountKey returns the ACME account key from the cache, generating and
+// caching one if there is none.
+func (m *Manager) accountKey(ctx context.Context) (crypto.Signer, error) {
+	data, err := m.cache.get(ctx, accountKeyName)
+	switch {
+	case err == nil:
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "EC PRIVATE KEY" {
+			return nil, fmt.Errorf("cached ACME account key is not a PEM EC private key")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	case !errors.Is(err, errCacheMiss):
+		return nil, fmt.Errorf("read ACME account key: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.cache.put(ctx, accountKeyName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, fmt.Errorf("store ACME account key: %w", err)
+	}
+	return key, nil
+}
+
+// putChallenge stores the response to an HTTP challenge, in the cache too
+// so whichever instance the CA reaches can answer it.
+func (m *Manager) putChallenge(ctx context.Context, token, response string) error {
+	m.mu.Lock()
+	m.tokens[token] = response
+	m.mu.Unlock()
+
+	if err := m.cache.put(ctx, challengePrefix+token, []byte(response)); err != nil {
+		return fmt.Errorf("store HTTP challenge: %w", err)
+	}
+	return nil
+}
+
+// deleteChallenge removes the response putChallenge stored.
+func (m *Manager) deleteChallenge(ctx context.Context, token string) {
+	m.mu.Lock()
+	delete(m.tokens, token)
+	m.mu.Unlock()
+
+	if err := m.cache.delete(ctx, challengePrefix+token); err != nil {
+		m.logger.WarnContext(ctx, "failed to delete HTTP challenge", "error", err)
+	}
+}
+
+// challengeResponse returns the response to the HTTP challenge token.
+func (m *Manager) challengeResponse(ctx context.Context, token string) (string, error) {
+	if !challengeToken.MatchString(token) {
+		return "", errCacheMiss
+	}
+
+	m.mu.RLock()
+	response, ok := m.tokens[token]
+	m.mu.RUnlock()
+	if ok {
+		return response, nil
+	}
+
+	data, err := m.cache.get(ctx, challengePrefix+token)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,65 @@
+package certs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+)
+
+// dnsPropagationTimeout is how long a challenge record may take to reach
+// every Route 53 name server.
+const dnsPropagationTimeout = 2 * time.Minute
+
+// route53Solver answers DNS challenges with TXT records in a Route 53
+// hosted zone.
+type route53Solver struct {
+	client *route53.Client
+	zoneID string
+}
+
+// present writes the TXT record value for domain's challenge and waits for
+// Route 53 to serve it.
+func (s *route53Solver) present(ctx context.Context, domain, value string) error {
+	out, err := s.client.ChangeResourceRecordSets(ctx, s.change(types.ChangeActionUpsert, domain, value))
+	if err != nil {
+		return fmt.Errorf("write challenge record for %s: %w", domain, err)
+	}
+
+	err = route53.NewResourceRecordSetsChangedWaiter(s.client).Wait(ctx, &route53.GetChangeInput{
+		Id: out.ChangeInfo.Id,
+	}, dnsPropagationTimeout)
+	if err != nil {
+		return fmt.Errorf("wait for challenge record for %s: %w", domain, err)
+	}
+	return nil
+}
+
+// cleanup deletes the TXT record present wrote.
+func (s *route53Solver) cleanup(ctx context.Context, domain, value string) error {
+	_, err := s.client.ChangeResourceRecordSets(ctx, s.change(types.ChangeActionDelete, domain, value))
+	return err
+}
+
+// change returns the change to the challenge record of domain.
+func (s *route53Solver) change(action types.ChangeAction, domain, value string) *route53.ChangeResourceRecordSetsInput {
+	return &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(s.zoneID),
+		ChangeBatch: &types.ChangeBatch{
+			Comment: aws.String("ACME challenge"),
+			Changes: []types.Change{{
+				Action: action,
+				ResourceRecordSet: &types.ResourceRecordSet{
+					Name:            aws.String("_acme-challenge." + domain + "."),
+					Type:            types.RRTypeTxt,
+					TTL:             aws.Int64(60),
+					ResourceRecords: []types.ResourceRecord{{Value: aws.String(strconv.Quote(value))}},
+				},
+			}},
+		},
+	}
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// fileSettings holds the settings read from the config file, keyed by
+// environment variable name. Environment variables take precedence over
+// them. read records the settings Load looked up, so misspelled ones in the
+// file can be reported.
+var fileSettings struct {
+	path   string
+	values map[string]string
+	read   map[string]bool
+}
+
+// lookupEnv returns the setting key from the environment, or from the
+// config file if the environment variable is unset or empty.
+func lookupEnv(key string) string {
+	if fileSettings.read != nil {
+		fileSettings.read[key] = true
+	}
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileSettings.values[key]
+}
+
+// lookupPrefix returns the settings whose names start with prefix, from the
+// environment and the config file, keyed by the rest of their names.
+// Environment variables take precedence.
+func lookupPrefix(prefix string) map[string]string {
+	settings := make(map[string]string)
+	for key, value := range fileSettings.values {
+		if name, ok := strings.CutPrefix(key, prefix); ok && name != "" {
+			fileSettings.read[key] = true
+			settings[name] = value
+		}
+	}
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if name, ok := strings.CutPrefix(key, prefix); ok && name != "" && value != "" {
+			settings[name] = value
+		}
+	}
+	return settings
+}
+
+// loadFile reads the YAML config file at path. Its keys are environment
+// variable names, in any case, and may be nested at underscores, so
+//
+//	server:
+//	  port: 8443
+//
+// sets SERVER_PORT. Lists are joined with commas.
+func loadFile(path string) error {
+	fileSettings.path, fileSettings.values, fileSettings.read = path, nil, nil
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flattenSettings(values, "", doc); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	fileSettings.values = values
+	fileSettings.read = make(map[string]bool)
+	return nil
+}
+
+// flattenSettings adds the settings in doc to values, prefixing their
+// names with prefix.
+func flattenSettings(values map[string]string, prefix string, doc map[string]any) error {
+	for name, value := range doc {
+		key := prefix + strings.ToUpper(name)
+		if nested, ok := value.(map[string]any); ok {
+			if err := flattenSettings(values, key+"_", nested); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// "a: {b_c: 1}" and "a_b: {c: 1}" both name A_B_C
+		if _, dup := values[key]; dup {
+			return fmt.Errorf("%s is set more than once", key)
+		}
+		switch v := value.(type) {
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				switch item.(type) {
+				case map[string]any, []any:
+					return fmt.Errorf("%s: list items must be values", key)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return nil
+}
+
+// checkFileSettings returns an error naming the settings in the config
+// file that Load never looked up, which are most likely misspelled.
+func checkFileSettings() error {
+	var unknown []string
+	for key := range fileSettings.values {
+		if !fileSettings.read[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	slices.Sort(unknown)
+	return fmt.Errorf("config file %s has unknown settings: %s", fileSettings.path, strings.Join(unknown, ", "))
+}
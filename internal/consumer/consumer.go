@@ -0,0 +1,383 @@
+// Package consumer receives messages from an SQS queue and runs the Go
+// handler registered for each message's type on it.
+//
+// A message is deleted once its handler succeeds. When the handler fails it
+// is left on the queue and received again after its visibility timeout,
+// until it has been received MaxReceives times or the failure is Permanent;
+// it is then moved to the dead-letter queue, if one is configured.
+//
+// The number of workers receiving messages adapts to the queue's backlog
+// and to how often receives and handlers fail; see scaling.go.
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// TypeAttribute is the message attribute naming the handler a message is
+// for.
+const TypeAttribute = "type"
+
+// ErrorAttribute is the message attribute that records, on messages moved
+// to the dead-letter queue, why they failed.
+const ErrorAttribute = "error"
+
+// waitTime is how long each receive waits for messages to arrive, the most
+// SQS allows, so an idle queue costs few requests.
+const waitTime = 20 * time.Second
+
+// retryDelay is how long a worker waits after a failed receive.
+const retryDelay = 5 * time.Second
+
+// maxErrorLength bounds the error recorded on dead-lettered messages.
+const maxErrorLength = 256
+
+// ErrShutdown is the cause of the context cancellation of handlers cut off
+// by shutdown.
+var ErrShutdown = errors.New("server shutting down")
+
+// Message is a message received from the queue.
+type Message struct {
+	ID   string
+	Body string
+	// Attributes are the message's string attributes.
+	Attributes map[string]string
+	// ReceiveCount is how many times the message has been received,
+	// including this time.
+	ReceiveCount int
+}
+
+// Handler handles a message. Returning an error leaves the message to be
+// retried, unless the error is Permanent. The context is cancelled when the
+// message's visibility timeout is about to expire.
+type Handler func(ctx context.Context, msg Message) error
+
+// permanentError is a failure retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that retrying won't fix, such as a
+// malformed message, so the message is dead-lettered at once.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Consumer runs handlers on the messages of a queue.
+type Consumer struct {
+	client *sqs.Client
+	cfg    config.ConsumerConfig
+	logger *slog.Logger
+
+	mu       sync.RWMutex // Protects handlers
+	handlers map[string]Handler
+
+	// workers holds a cancel function for each running worker, which stops
+	// it receiving messages.
+	workersMu sync.Mutex
+	workers   []context.CancelFunc
+	// attempts counts receives and handled messages since the workers were
+	// last adjusted, and failures those that failed.
+	attempts atomic.Int64
+	failures atomic.Int64
+
+	running sync.WaitGroup
+	// stopped is the parent of the handlers' contexts; Drain cancels it
+	// once ctx is done.
+	stopped context.Context
+	stop    context.CancelCauseFunc
+	// stopReceiving stops the workers receiving messages.
+	stopReceiving context.CancelFunc
+}
+
+// New creates a consumer for cfg's queue, or returns nil if no queue is
+// configured.
+func New(client *sqs.Client, cfg config.ConsumerConfig, logger *slog.Logger) *Consumer {
+	if cfg.QueueURL == "" {
+		return nil
+	}
+	stopped, stop := context.WithCancelCause(context.Background())
+	return &Consumer{
+		client:        client,
+		cfg:           cfg,
+		logger:        logger.With("queue_url", cfg.QueueURL),
+		handlers:      make(map[string]Handler),
+		stopped:       stopped,
+		stop:          stop,
+		stopReceiving: func() {},
+	}
+}
+
+// Handle registers h for messages whose type attribute is messageType.
+func (c *Consumer) Handle(messageType string, h Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[messageType] = h
+}
+
+// Start starts the workers, which receive and handle messages until ctx is
+// done or Drain is called. It starts MinConcurrency workers and adjusts
+// their number between MinConcurrency and MaxConcurrency as it goes.
+func (c *Consumer) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	c.stopReceiving = cancel
+
+	c.logger.Info("SQS consumer starting",
+		"min_concurrency", c.cfg.MinConcurrency,
+		"max_concurrency", c.cfg.MaxConcurrency,
+	)
+	c.resize(ctx, c.cfg.MinConcurrency)
+
+	// Counted as running so workers it adds before Drain's wait begins are
+	// waited for too
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		c.scale(ctx)
+	}()
+}
+
+// Workers returns how many workers are receiving messages, or 0 on a nil
+// Consumer.
+func (c *Consumer) Workers() int {
+	if c == nil {
+		return 0
+	}
+	c.workersMu.Lock()
+	defer c.workersMu.Unlock()
+	return len(c.workers)
+}
+
+// resize starts or stops workers until n are running. A stopped worker
+// finishes the message it is handling first. No workers are started once
+// ctx is done.
+func (c *Consumer) resize(ctx context.Context, n int) {
+	c.workersMu.Lock()
+	defer c.workersMu.Unlock()
+
+	for len(c.workers) < n && ctx.Err() == nil {
+		workerCtx, stop := context.WithCancel(ctx)
+		c.workers = append(c.workers, stop)
+		c.running.Add(1)
+		go func() {
+			defer c.running.Done()
+			c.work(workerCtx)
+		}()
+	}
+	for len(c.workers) > n {
+		last := len(c.workers) - 1
+		c.workers[last]()
+		c.workers = c.workers[:last]
+	}
+}
+
+// Drain stops receiving messages and waits for the handlers in progress to
+// finish. Handlers still running when ctx is done are cancelled, with cause
+// ErrShutdown; their messages return to the queue when their visibility
+// timeout expires. It does nothing on a nil Consumer.
+func (c *Consumer) Drain(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	c.stopReceiving()
+
+	done := make(chan struct{})
+	go func() {
+		c.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+	c.logger.Warn("cancelling SQS message handlers at shutdown")
+	c.stop(ErrShutdown)
+	<-done
+}
+
+// work receives and handles one message at a time until ctx is done.
+func (c *Consumer) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		output, err := c.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(c.cfg.QueueURL),
+			MaxNumberOfMessages:         1,
+			WaitTimeSeconds:             int32(waitTime.Seconds()),
+			VisibilityTimeout:           int32(c.cfg.VisibilityTimeout.Seconds()),
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.record(false)
+			c.logger.Error("failed to receive SQS messages", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+		c.record(true)
+
+		for _, msg := range output.Messages {
+			c.process(msg)
+		}
+	}
+}
+
+// process runs msg's handler and deletes, dead-letters, or leaves msg
+// depending on the outcome.
+func (c *Consumer) process(raw types.Message) {
+	received := time.Now()
+	msg := newMessage(raw)
+	logger := c.logger.With("message_id", msg.ID, "type", msg.Attributes[TypeAttribute], "receive_count", msg.ReceiveCount)
+
+	// Stop before the message becomes visible to other consumers, leaving a
+	// little time to delete it
+	ctx, cancel := context.WithDeadline(c.stopped, received.Add(c.cfg.VisibilityTimeout*9/10))
+	defer cancel()
+
+	err := c.dispatch(ctx, msg)
+	c.record(err == nil)
+	if err == nil {
+		if err := c.delete(raw); err != nil {
+			logger.Error("failed to delete handled SQS message", "error", err)
+			return
+		}
+		logger.Info("SQS message handled", "duration", time.Since(received))
+		return
+	}
+
+	var permanent permanentError
+	if !errors.As(err, &permanent) && msg.ReceiveCount < c.cfg.MaxReceives {
+		logger.Warn("SQS message handler failed, will retry", "error", err)
+		return
+	}
+	if c.cfg.DeadLetterQueueURL == "" {
+		logger.Error("SQS message handler failed and there is no dead-letter queue", "error", err)
+		return
+	}
+	if err := c.deadLetter(raw, err); err != nil {
+		logger.Error("failed to move SQS message to the dead-letter queue", "error", err)
+		return
+	}
+	logger.Error("moved SQS message to the dead-letter queue", "error", err)
+}
+
+// record counts a receive or handled message for the error rate the
+// workers are adjusted by.
+func (c *Consumer) record(ok bool) {
+	c.attempts.Add(1)
+	if !ok {
+		c.failures.Add(1)
+	}
+}
+
+// dispatch runs the handler for msg's type, turning a panic into an error.
+func (c *Consumer) dispatch(ctx context.Context, msg Message) (err error) {
+	messageType := msg.Attributes[TypeAttribute]
+	c.mu.RLock()
+	h, ok := c.handlers[messageType]
+	c.mu.RUnlock()
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for message type %q", messageType))
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+	}()
+	return h(ctx, msg)
+}
+
+// delete removes msg from the queue. It isn't cancelled at shutdown, so a
+// handled message isn't handled again.
+func (c *Consumer) delete(msg types.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := c.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.cfg.QueueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	return err
+}
+
+// deadLetter sends msg to the dead-letter queue, recording cause, and
+// deletes it from the queue.
+func (c *Consumer) deadLetter(msg types.Message, cause error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	attributes := make(map[string]types.MessageAttributeValue, len(msg.MessageAttributes)+1)
+	for name, value := range msg.MessageAttributes {
+		attributes[name] = value
+	}
+	// SQS allows 10 attributes per message
+	if len(attributes) < 10 {
+		reason := cause.Error()
+		if len(reason) > maxErrorLength {
+			reason = reason[:maxErrorLength]
+		}
+		attributes[ErrorAttribute] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(reason),
+		}
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(c.cfg.DeadLetterQueueURL),
+		MessageBody:       msg.Body,
+		MessageAttributes: attributes,
+	}
+	if strings.HasSuffix(c.cfg.DeadLetterQueueURL, ".fifo") {
+		input.MessageGroupId = aws.String(msg.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)])
+		if *input.MessageGroupId == "" {
+			input.MessageGroupId = msg.MessageId
+		}
+		input.MessageDeduplicationId = msg.MessageId
+	}
+	if _, err := c.client.SendMessage(ctx, input); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	if err := c.delete(msg); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	return nil
+}
+
+// newMessage converts a received SQS message.
+func newMessage(msg types.Message) Message {
+	m := Message{
+		ID:         aws.ToString(msg.MessageId),
+		Body:       aws.ToString(msg.Body),
+		Attributes: make(map[string]string, len(msg.MessageAttributes)),
+	}
+	for name, value := range msg.MessageAttributes {
+		if value.StringValue != nil {
+			m.Attributes[name] = *value.StringValue
+		}
+	}
+	m.ReceiveCount, _ = strconv.Atoi(msg.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	return m
+}
@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// scaleInterval is how often the number of workers is adjusted.
+const scaleInterval = 15 * time.Second
+
+// maxErrorRate is the share of failed receives and handlers above which the
+// number of workers is halved.
+const maxErrorRate = 0.1
+
+// scale adjusts the number of workers every scaleInterval until ctx is
+// done, based on the queue's backlog and the error rate since the last
+// adjustment.
+func (c *Consumer) scale(ctx context.Context) {
+	ticker := time.NewTicker(scaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		backlog, err := c.backlog(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logger.Warn("failed to read SQS queue backlog", "error", err)
+			backlog = -1
+		}
+		var errorRate float64
+		if attempts, failures := c.attempts.Swap(0), c.failures.Swap(0); attempts > 0 {
+			errorRate = float64(failures) / float64(attempts)
+		}
+
+		current := c.Workers()
+		next := nextWorkers(current, c.cfg.MinConcurrency, c.cfg.MaxConcurrency, backlog, errorRate)
+		if next == current {
+			continue
+		}
+		c.logger.Info("adjusting SQS consumer concurrency",
+			"from", current,
+			"to", next,
+			"backlog", backlog,
+			"error_rate", errorRate,
+		)
+		c.resize(ctx, next)
+	}
+}
+
+// backlog returns the approximate number of messages waiting on the queue.
+func (c *Consumer) backlog(ctx context.Context) (int, error) {
+	output, err := c.client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(c.cfg.QueueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(output.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+}
+
+// nextWorkers returns how many workers to run after current, between lo
+// and hi: half as many when more than maxErrorRate of receives and
+// handlers failed, one more while more messages wait than there are
+// workers, and one fewer once none wait (additive increase, multiplicative
+// decrease). A negative backlog is unknown and only errors change the
+// count.
+func nextWorkers(current, lo, hi, backlog int, errorRate float64) int {
+	switch {
+	case errorRate > maxErrorRate:
+		return max(lo, current/2)
+	case backlog < 0:
+		return current
+	case backlog > current:
+		return min(hi, current+1)
+	case backlog == 0:
+		return max(lo, current-1)
+	}
+	return current
+}
@@ -0,0 +1,141 @@
+// Package database connects to the Postgres database items and records can
+// be kept in instead of DynamoDB, such as an RDS or Aurora database, and
+// keeps its schema up to date.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// migrationLock is the advisory lock held while migrating, so instances
+// starting together don't apply the same migration twice.
+const migrationLock = 7_265_001
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open returns a pool of connections to the database cfg configures. No
+// connection is made until one is needed. With IAM authentication, each new
+// connection gets a fresh token, since tokens expire after 15 minutes.
+func Open(cfg config.PostgresConfig, awsCfg aws.Config) (*sql.DB, error) {
+	connConfig, err := pgx.ParseConfig(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse POSTGRES_URL: %w", err)
+	}
+
+	var opts []stdlib.OptionOpenDB
+	if cfg.IAMAuth {
+		opts = append(opts, stdlib.OptionBeforeConnect(func(ctx context.Context, cc *pgx.ConnConfig) error {
+			endpoint := net.JoinHostPort(cc.Host, strconv.Itoa(int(cc.Port)))
+			token, err := auth.BuildAuthToken(ctx, endpoint, awsCfg.Region, cc.User, awsCfg.Credentials)
+			if err != nil {
+				return fmt.Errorf("build IAM auth token: %w", err)
+			}
+			cc.Password = token
+			return nil
+		}))
+	}
+
+	db := stdlib.OpenDB(*connConfig, opts...)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
+
+// Migrate applies the migrations the database doesn't have yet, in order,
+// each in its own transaction, and records them in schema_migrations.
+func Migrate(ctx context.Context, db *sql.DB, logger *slog.Logger) error {
+	// Session-level advisory locks belong to a connection, so hold one
+	// for the whole migration
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLock); err != nil {
+		return fmt.Errorf("lock migrations: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version text PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	applied := make(map[string]bool)
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("read schema_migrations: %w", err)
+	}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return fmt.Errorf("read schema_migrations: %w", err)
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read schema_migrations: %w", err)
+	}
+
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	slices.Sort(files)
+	for _, file := range files {
+		version := path.Base(file)
+		if applied[version] {
+			continue
+		}
+		script, err := migrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := apply(ctx, conn, version, string(script)); err != nil {
+			return fmt.Errorf("apply migration %s: %w", version, err)
+		}
+		logger.InfoContext(ctx, "applied database migration", "version", version)
+	}
+	return nil
+}
+
+// apply runs a migration script and records it, or neither.
+func apply(ctx context.Context, conn *sql.Conn, version, script string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,6 @@
+-- Records of the /api/v1/aws/dynamodb/records endpoints, kept as the same
+-- JSON documents DynamoDB would hold.
+CREATE TABLE records (
+    id text PRIMARY KEY,
+    doc jsonb NOT NULL
+);
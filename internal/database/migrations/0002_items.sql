@@ -0,0 +1,6 @@
+-- Items of the /api/v1/items endpoints.
+CREATE TABLE items (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT ''
+);
@@ -0,0 +1,54 @@
+// Package diagnostics collects runtime information used to troubleshoot a running server.
+package diagnostics
+
+import (
+	"sync"
+)
+
+// LogBuffer keeps the most recent log lines in memory. It implements io.Writer
+// so it can sit behind a slog handler alongside stdout; slog writes each record
+// with a single Write call, so each write is kept as one line.
+type LogBuffer struct {
+	mu    sync.Mutex
+	lines [][]byte
+	next  int
+	full  bool
+}
+
+// NewLogBuffer creates a buffer that retains the last size log lines.
+func NewLogBuffer(size int) *LogBuffer {
+	return &LogBuffer{lines: make([][]byte, size)}
+}
+
+// Write records p as a log line, evicting the oldest line when the buffer is full.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.lines) == 0 {
+		return len(p), nil
+	}
+
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+	return len(p), nil
+}
+
+// Lines returns the retained log lines, oldest first.
+func (b *LogBuffer) Lines() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([][]byte(nil), b.lines[:b.next]...)
+	}
+	lines := make([][]byte, 0, len(b.lines))
+	lines = append(lines, b.lines[b.next:]...)
+	return append(lines, b.lines[:b.next]...)
+}
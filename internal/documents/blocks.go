@@ -0,0 +1,130 @@
+package documents
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	textracttypes "github.com/aws/aws-sdk-go-v2/service/textract/types"
+)
+
+// Document is what Textract extracted from a document.
+type Document struct {
+	Pages int `json:"pages" example:"2"`
+	// Text is the document's lines of text, in reading order.
+	Text   string  `json:"text" example:"INVOICE\nInvoice number: 1042"`
+	Fields []Field `json:"fields"`
+	Tables []Table `json:"tables"`
+}
+
+// Field is a key-value pair found in a form.
+type Field struct {
+	Key string `json:"key" example:"Invoice number:"`
+	// Value is empty if the key has none; checkboxes have SELECTED or
+	// NOT_SELECTED.
+	Value      string  `json:"value" example:"1042"`
+	Page       int     `json:"page" example:"1"`
+	Confidence float64 `json:"confidence" example:"96.4"`
+}
+
+// Table is a table found in a document.
+type Table struct {
+	Page int `json:"page" example:"1"`
+	// Rows holds the text of each cell, row by row.
+	Rows       [][]string `json:"rows"`
+	Confidence float64    `json:"confidence" example:"99.1"`
+}
+
+// parse builds a document from the blocks Textract returned for it.
+func parse(blocks []textracttypes.Block, pages int) *Document {
+	byID := make(map[string]textracttypes.Block, len(blocks))
+	for _, b := range blocks {
+		byID[aws.ToString(b.Id)] = b
+	}
+
+	doc := &Document{Pages: pages, Fields: []Field{}, Tables: []Table{}}
+	var lines []string
+	for _, b := range blocks {
+		switch b.BlockType {
+		case textracttypes.BlockTypeLine:
+			lines = append(lines, aws.ToString(b.Text))
+
+		case textracttypes.BlockTypeKeyValueSet:
+			if !slices.Contains(b.EntityTypes, textracttypes.EntityTypeKey) {
+				continue
+			}
+			field := Field{
+				Key:        text(byID, b),
+				Page:       int(aws.ToInt32(b.Page)),
+				Confidence: float64(aws.ToFloat32(b.Confidence)),
+			}
+			for _, id := range related(b, textracttypes.RelationshipTypeValue) {
+				field.Value = text(byID, byID[id])
+			}
+			doc.Fields = append(doc.Fields, field)
+
+		case textracttypes.BlockTypeTable:
+			doc.Tables = append(doc.Tables, table(byID, b))
+		}
+	}
+	doc.Text = strings.Join(lines, "\n")
+	return doc
+}
+
+// table builds the table of b from its cells.
+func table(byID map[string]textracttypes.Block, b textracttypes.Block) Table {
+	var cells []textracttypes.Block
+	rows, columns := 0, 0
+	for _, id := range related(b, textracttypes.RelationshipTypeChild) {
+		cell, ok := byID[id]
+		if !ok || cell.BlockType != textracttypes.BlockTypeCell {
+			continue
+		}
+		cells = append(cells, cell)
+		rows = max(rows, int(aws.ToInt32(cell.RowIndex)))
+		columns = max(columns, int(aws.ToInt32(cell.ColumnIndex)))
+	}
+
+	t := Table{
+		Page:       int(aws.ToInt32(b.Page)),
+		Rows:       make([][]string, rows),
+		Confidence: float64(aws.ToFloat32(b.Confidence)),
+	}
+	for i := range t.Rows {
+		t.Rows[i] = make([]string, columns)
+	}
+	for _, cell := range cells {
+		// Row and column indexes start at 1
+		row, column := int(aws.ToInt32(cell.RowIndex))-1, int(aws.ToInt32(cell.ColumnIndex))-1
+		if row >= 0 && column >= 0 {
+			t.Rows[row][column] = text(byID, cell)
+		}
+	}
+	return t
+}
+
+// text joins the words and selection marks that are children of b.
+func text(byID map[string]textracttypes.Block, b textracttypes.Block) string {
+	var words []string
+	for _, id := range related(b, textracttypes.RelationshipTypeChild) {
+		child := byID[id]
+		switch child.BlockType {
+		case textracttypes.BlockTypeWord:
+			words = append(words, aws.ToString(child.Text))
+		case textracttypes.BlockTypeSelectionElement:
+			words = append(words, string(child.SelectionStatus))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// related returns the IDs of the blocks b has relationship kind with.
+func related(b textracttypes.Block, kind textracttypes.RelationshipType) []string {
+	var ids []string
+	for _, r := range b.Relationships {
+		if r.Type == kind {
+			ids = append(ids, r.Ids...)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,170 @@
+// Package documents extracts the text, form fields, and tables of
+// documents stored in S3 with Textract.
+//
+// Images are small enough to analyze while the request waits. PDFs and
+// TIFFs can run to thousands of pages, so they are analyzed in jobs: the
+// caller polls the job, and if an SNS topic is configured, Textract
+// announces when it is done.
+package documents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/textract"
+	textracttypes "github.com/aws/aws-sdk-go-v2/service/textract/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// maxJobResults is the most blocks GetDocumentAnalysis returns at once.
+const maxJobResults = 1000
+
+// ErrUnsupported is returned for objects Textract can't analyze.
+var ErrUnsupported = errors.New("only JPEG, PNG, PDF, and TIFF documents can be analyzed")
+
+// Features Textract can extract. Text is always extracted.
+const (
+	FeatureForms  = string(textracttypes.FeatureTypeForms)
+	FeatureTables = string(textracttypes.FeatureTypeTables)
+)
+
+// StatusInProgress is the status of jobs that haven't finished.
+const StatusInProgress = string(textracttypes.JobStatusInProgress)
+
+// Job is the state of a document analysis job.
+type Job struct {
+	ID string `json:"jobId" example:"0a1b2c3d4e5f67890a1b2c3d4e5f67890a1b2c3d4e5f67890a1b2c3d4e5f6789"`
+	// Status is IN_PROGRESS, SUCCEEDED, PARTIAL_SUCCESS, or FAILED.
+	Status        string `json:"status" example:"SUCCEEDED"`
+	StatusMessage string `json:"statusMessage,omitempty" example:""`
+	// Document is set once the job has succeeded, even partially.
+	Document *Document `json:"document,omitempty"`
+}
+
+// Extractor runs Textract on documents in S3.
+type Extractor struct {
+	textract *textract.Client
+	sqs      *sqs.Client
+	cfg      config.TextractConfig
+	logger   *slog.Logger
+}
+
+// New creates an extractor.
+func New(textractClient *textract.Client, sqsClient *sqs.Client, cfg config.TextractConfig, logger *slog.Logger) *Extractor {
+	return &Extractor{
+		textract: textractClient,
+		sqs:      sqsClient,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// Async reports whether key names a document that must be analyzed in a
+// job. It returns ErrUnsupported for documents Textract can't analyze.
+func Async(key string) (bool, error) {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg", ".png":
+		return false, nil
+	case ".pdf", ".tif", ".tiff":
+		return true, nil
+	}
+	return false, ErrUnsupported
+}
+
+// Analyze extracts features from the single-page image at key in bucket.
+func (e *Extractor) Analyze(ctx context.Context, bucket, key string, features []string) (*Document, error) {
+	result, err := e.textract.AnalyzeDocument(ctx, &textract.AnalyzeDocumentInput{
+		Document:     &textracttypes.Document{S3Object: s3Object(bucket, key)},
+		FeatureTypes: featureTypes(features),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("analyze document: %w", err)
+	}
+	return parse(result.Blocks, pages(result.DocumentMetadata)), nil
+}
+
+// Start starts a job extracting features from the document at key in
+// bucket, returning its ID.
+func (e *Extractor) Start(ctx context.Context, bucket, key string, features []string) (string, error) {
+	input := &textract.StartDocumentAnalysisInput{
+		DocumentLocation: &textracttypes.DocumentLocation{S3Object: s3Object(bucket, key)},
+		FeatureTypes:     featureTypes(features),
+	}
+	if e.cfg.TopicARN != "" {
+		input.NotificationChannel = &textracttypes.NotificationChannel{
+			SNSTopicArn: aws.String(e.cfg.TopicARN),
+			RoleArn:     aws.String(e.cfg.RoleARN),
+		}
+	}
+	result, err := e.textract.StartDocumentAnalysis(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("start document analysis: %w", err)
+	}
+	return aws.ToString(result.JobId), nil
+}
+
+// Job returns the state of the job id, with the document it extracted once
+// it has succeeded.
+func (e *Extractor) Job(ctx context.Context, id string) (Job, error) {
+	var (
+		blocks    []textracttypes.Block
+		nextToken *string
+		job       = Job{ID: id}
+		pageCount int
+	)
+	for {
+		result, err := e.textract.GetDocumentAnalysis(ctx, &textract.GetDocumentAnalysisInput{
+			JobId:      aws.String(id),
+			MaxResults: aws.Int32(maxJobResults),
+			NextToken:  nextToken,
+		})
+		if err != nil {
+			return Job{}, fmt.Errorf("get document analysis: %w", err)
+		}
+		job.Status = string(result.JobStatus)
+		job.StatusMessage = aws.ToString(result.StatusMessage)
+		switch result.JobStatus {
+		case textracttypes.JobStatusSucceeded, textracttypes.JobStatusPartialSuccess:
+		default:
+			return job, nil
+		}
+
+		blocks = append(blocks, result.Blocks...)
+		pageCount = max(pageCount, pages(result.DocumentMetadata))
+		nextToken = result.NextToken
+		if nextToken == nil {
+			break
+		}
+	}
+	job.Document = parse(blocks, pageCount)
+	return job, nil
+}
+
+// s3Object returns the Textract location of key in bucket.
+func s3Object(bucket, key string) *textracttypes.S3Object {
+	return &textracttypes.S3Object{Bucket: aws.String(bucket), Name: aws.String(key)}
+}
+
+// featureTypes converts features to Textract's feature types.
+func featureTypes(features []string) []textracttypes.FeatureType {
+	types := make([]textracttypes.FeatureType, len(features))
+	for i, feature := range features {
+		types[i] = textracttypes.FeatureType(feature)
+	}
+	return types
+}
+
+// pages returns the page count in metadata.
+func pages(metadata *textracttypes.DocumentMetadata) int {
+	if metadata == nil {
+		return 0
+	}
+	return int(aws.ToInt32(metadata.Pages))
+}
@@ -0,0 +1,117 @@
+package documents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// waitTime is how long each receive waits for announcements, the most SQS
+// allows.
+const waitTime = 20 * time.Second
+
+// retryDelay is how long to wait after a failed receive.
+const retryDelay = 5 * time.Second
+
+// Completion announces that a job has finished.
+type Completion struct {
+	JobID string `json:"jobId" example:"0a1b2c3d4e5f67890a1b2c3d4e5f67890a1b2c3d4e5f67890a1b2c3d4e5f6789"`
+	// Status is SUCCEEDED, PARTIAL_SUCCESS, or FAILED.
+	Status string `json:"status" example:"SUCCEEDED"`
+	Bucket string `json:"bucket" example:"uploads"`
+	Key    string `json:"key" example:"invoices/1042.pdf"`
+}
+
+// notification is the message Textract publishes to SNS.
+type notification struct {
+	JobID            string `json:"JobId"`
+	Status           string `json:"Status"`
+	DocumentLocation struct {
+		Bucket string `json:"S3Bucket"`
+		Key    string `json:"S3ObjectName"`
+	} `json:"DocumentLocation"`
+}
+
+// snsEnvelope wraps messages SNS delivers to SQS without raw message
+// delivery.
+type snsEnvelope struct {
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// WatchCompletions receives the announcements of finished jobs from the
+// configured queue and calls done with each, until ctx is done. Each
+// announcement is received by one instance only. It does nothing if no
+// queue is configured.
+func (e *Extractor) WatchCompletions(ctx context.Context, done func(Completion)) {
+	if e.cfg.QueueURL == "" {
+		return
+	}
+	logger := e.logger.With("queue_url", e.cfg.QueueURL)
+	go func() {
+		for ctx.Err() == nil {
+			output, err := e.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+				QueueUrl:            aws.String(e.cfg.QueueURL),
+				MaxNumberOfMessages: 10,
+				WaitTimeSeconds:     int32(waitTime.Seconds()),
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Error("failed to receive Textract announcements", "error", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryDelay):
+				}
+				continue
+			}
+
+			for _, msg := range output.Messages {
+				completion, err := parseCompletion(msg)
+				if err != nil {
+					// Deleted all the same, as it will never parse
+					logger.Warn("dropped malformed Textract announcement", "error", err, "message_id", aws.ToString(msg.MessageId))
+				} else {
+					done(completion)
+				}
+				_, err = e.sqs.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+					QueueUrl:      aws.String(e.cfg.QueueURL),
+					ReceiptHandle: msg.ReceiptHandle,
+				})
+				if err != nil && ctx.Err() == nil {
+					logger.Warn("failed to delete Textract announcement", "error", err, "message_id", aws.ToString(msg.MessageId))
+				}
+			}
+		}
+	}()
+}
+
+// parseCompletion decodes the announcement in msg, delivered raw or in an
+// SNS envelope.
+func parseCompletion(msg sqstypes.Message) (Completion, error) {
+	body := aws.ToString(msg.Body)
+	var envelope snsEnvelope
+	if err := json.Unmarshal([]byte(body), &envelope); err == nil && envelope.Type == "Notification" {
+		body = envelope.Message
+	}
+
+	var n notification
+	if err := json.Unmarshal([]byte(body), &n); err != nil {
+		return Completion{}, err
+	}
+	if n.JobID == "" {
+		return Completion{}, errors.New("announcement has no job ID")
+	}
+	return Completion{
+		JobID:  n.JobID,
+		Status: n.Status,
+		Bucket: n.DocumentLocation.Bucket,
+		Key:    n.DocumentLocation.Key,
+	}, nil
+}
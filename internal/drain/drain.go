@@ -0,0 +1,209 @@
+// Package drain tracks in-flight requests so the server can let them finish
+// when it shuts down, and cancels and logs the ones that don't finish in
+// time.
+package drain
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/requestid"
+)
+
+// ErrShutdown is the cause of the context cancellation of requests cut off
+// by shutdown.
+var ErrShutdown = errors.New("server shutting down")
+
+// request is a tracked in-flight request.
+type request struct {
+	tracker *Tracker
+	method  string
+	path    string
+	id      string
+	start   time.Time
+	// deadline is when the request's response can no longer be written,
+	// so there is no point waiting for it past then.
+	deadline time.Time
+	cancel   context.CancelCauseFunc
+	done     chan struct{}
+	// longLived requests, such as event streams, only end when cancelled.
+	longLived atomic.Bool
+	waited    bool // Protected by the tracker's mu
+}
+
+type contextKey struct{}
+
+// Tracker tracks in-flight requests.
+type Tracker struct {
+	logger  *slog.Logger
+	timeout time.Duration
+
+	mu       sync.Mutex // Protects requests and draining
+	requests map[*request]struct{}
+	draining bool
+}
+
+// New creates a tracker for requests that have timeout to write their
+// response, usually the server's write timeout.
+func New(logger *slog.Logger, timeout time.Duration) *Tracker {
+	return &Tracker{
+		logger:   logger,
+		timeout:  timeout,
+		requests: make(map[*request]struct{}),
+	}
+}
+
+// Middleware tracks each request until its handler returns. The request's
+// context is cancelled, with cause ErrShutdown, if it is still running when
+// the tracker gives up waiting for it.
+func (t *Tracker) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithCancelCause(r.Context())
+			defer cancel(nil)
+
+			now := time.Now()
+			req := &request{
+				tracker:  t,
+				method:   r.Method,
+				path:     r.URL.Path,
+				id:       requestid.FromContext(ctx),
+				start:    now,
+				deadline: now.Add(t.timeout),
+				cancel:   cancel,
+				done:     make(chan struct{}),
+			}
+			t.mu.Lock()
+			t.requests[req] = struct{}{}
+			t.mu.Unlock()
+			defer func() {
+				t.mu.Lock()
+				delete(t.requests, req)
+				t.mu.Unlock()
+				close(req.done)
+			}()
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, contextKey{}, req)))
+		})
+	}
+}
+
+// LongLived marks the request with ctx as one that only ends when it is
+// cancelled, such as an event stream, so draining cancels it right away
+// instead of waiting for it. It does nothing for untracked requests.
+func LongLived(ctx context.Context) {
+	req, ok := ctx.Value(contextKey{}).(*request)
+	if !ok {
+		return
+	}
+	req.longLived.Store(true)
+
+	t := req.tracker
+	t.mu.Lock()
+	draining := t.draining
+	t.mu.Unlock()
+	if draining {
+		req.cancel(ErrShutdown)
+	}
+}
+
+// InFlight returns how many requests are being served.
+func (t *Tracker) InFlight() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.requests)
+}
+
+// Drain waits for in-flight requests to finish. Long-lived requests are
+// cancelled at once; other requests are cancelled and logged when their
+// response deadline passes or ctx is done, whichever comes first. Requests
+// that arrive while draining are waited for too.
+func (t *Tracker) Drain(ctx context.Context) {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var finished, cancelled atomic.Int64
+	for {
+		pending := t.unwaited()
+		if len(pending) == 0 {
+			break
+		}
+		for _, req := range pending {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if t.wait(ctx, req) {
+					finished.Add(1)
+				} else {
+					cancelled.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	t.logger.Info("drained in-flight requests", "finished", finished.Load(), "cancelled", cancelled.Load())
+}
+
+// unwaited returns the in-flight requests Drain isn't waiting for yet.
+func (t *Tracker) unwaited() []*request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var pending []*request
+	for req := range t.requests {
+		if !req.waited {
+			req.waited = true
+			pending = append(pending, req)
+		}
+	}
+	return pending
+}
+
+// wait waits for req to finish, cancelling it if it doesn't in time. It
+// reports whether req finished on its own.
+func (t *Tracker) wait(ctx context.Context, req *request) bool {
+	if req.longLived.Load() {
+		req.cancel(ErrShutdown)
+		select {
+		case <-req.done:
+		case <-ctx.Done():
+		}
+		return true
+	}
+
+	timer := time.NewTimer(time.Until(req.deadline))
+	defer timer.Stop()
+
+	var reason string
+	select {
+	case <-req.done:
+		return true
+	case <-timer.C:
+		reason = "response deadline passed"
+	case <-ctx.Done():
+		reason = "shutdown timeout"
+	}
+
+	req.cancel(ErrShutdown)
+	t.logger.Warn("cancelled in-flight request",
+		"method", req.method,
+		"path", req.path,
+		"request_id", req.id,
+		"duration", time.Since(req.start),
+		"reason", reason,
+	)
+	// A handler that ignores its context is cut off when the server closes
+	// its connection
+	select {
+	case <-req.done:
+	case <-ctx.Done():
+	}
+	return false
+}
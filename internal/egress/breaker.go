@@ -0,0 +1,116 @@
+package egress
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a destination's circuit breaker.
+type CircuitState string
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects requests until the cooldown passes.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe through to test the destination.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// breaker stops calls to a destination after repeated failures so a down
+// host doesn't tie up callers with timeouts and retries.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex // Protects the fields below
+	current  CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newBreaker creates a closed breaker. A threshold below 1 disables it.
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		current:   CircuitClosed,
+	}
+}
+
+// allow reports whether a request may be sent. An open circuit moves to
+// half-open once the cooldown has passed and admits one probe.
+func (b *breaker) allow() bool {
+	if b.threshold < 1 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.current {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.current = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// success closes the circuit.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.current = CircuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// failure records a failed attempt and opens the circuit once the threshold
+// is reached, or immediately if the failed attempt was a probe.
+func (b *breaker) failure() {
+	if b.threshold < 1 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.current == CircuitHalfOpen || b.failures >= b.threshold {
+		b.current = CircuitOpen
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+// release gives up a probe slot taken by allow without recording an outcome.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// state returns the current circuit state.
+func (b *breaker) state() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == CircuitOpen && time.Since(b.openedAt) >= b.cooldown {
+		return CircuitHalfOpen
+	}
+	return b.current
+}
@@ -0,0 +1,337 @@
+// Package egress makes outbound HTTP calls to webhooks and external APIs.
+// Every call goes through one pooled transport and gets retries, a circuit
+// breaker, a rate limit, and optional request signing per destination host.
+package egress
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit open for destination")
+
+// maxRetryDelay caps both computed backoff and a destination's Retry-After.
+const maxRetryDelay = 30 * time.Second
+
+// Config holds the defaults applied to every destination.
+type Config struct {
+	// Timeout bounds a single attempt, including reading response headers.
+	Timeout time.Duration
+	// MaxAttempts is how many times a request is tried before giving up.
+	MaxAttempts int
+	// RetryBaseDelay is the delay before the first retry; it doubles per attempt.
+	RetryBaseDelay time.Duration
+	// RateLimit is the sustained requests per second allowed to each host.
+	// Zero disables rate limiting.
+	RateLimit float64
+	// Burst is how many requests may exceed RateLimit at once.
+	Burst int
+	// FailureThreshold is how many consecutive failed attempts open a host's circuit.
+	FailureThreshold int
+	// Cooldown is how long an open circuit rejects requests before letting one probe through.
+	Cooldown time.Duration
+}
+
+// Destination overrides the defaults for one host.
+type Destination struct {
+	// RateLimit and Burst replace Config.RateLimit and Config.Burst when RateLimit is non-zero.
+	RateLimit float64
+	Burst     int
+	// Signer, if set, signs every attempt sent to the host.
+	Signer Signer
+}
+
+// Stats counts calls to one host since the server started.
+type Stats struct {
+	Host     string `json:"host" example:"hooks.example.com"`
+	Requests int64  `json:"requests"`
+	// Attempts includes retries.
+	Attempts int64 `json:"attempts"`
+	Failures int64 `json:"failures"`
+	// Rejected counts requests refused because the circuit was open.
+	Rejected int64 `json:"rejected"`
+	// Throttled counts requests that waited on the rate limit.
+	Throttled    int64        `json:"throttled"`
+	Circuit      CircuitState `json:"circuit" enums:"closed,open,half-open"`
+	AvgLatencyMs float64      `json:"avgLatencyMs"`
+}
+
+// destination is the per-host state behind a Client.
+type destination struct {
+	breaker *breaker
+
+	mu           sync.Mutex // Protects the fields below
+	signer       Signer
+	limiter      *limiter
+	stats        Stats
+	totalLatency time.Duration
+}
+
+// Client sends outbound requests. It is safe for concurrent use.
+type Client struct {
+	http   *http.Client
+	cfg    Config
+	logger *slog.Logger
+
+	mu           sync.Mutex // Protects destinations
+	destinations map[string]*destination
+	overrides    map[string]Destination
+}
+
+// New creates a client with a shared connection pool.
+func New(cfg Config, logger *slog.Logger) *Client {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 10
+	transport.IdleConnTimeout = 90 * time.Second
+
+	return &Client{
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+		},
+		cfg:          cfg,
+		logger:       logger,
+		destinations: make(map[string]*destination),
+		overrides:    make(map[string]Destination),
+	}
+}
+
+// Configure sets the rate limit and signer used for host. It resets the
+// host's rate limiter but keeps its circuit state and stats.
+func (c *Client) Configure(host string, d Destination) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.overrides[host] = d
+	if dest, ok := c.destinations[host]; ok {
+		dest.mu.Lock()
+		dest.signer = d.Signer
+		dest.limiter = c.newLimiter(d)
+		dest.mu.Unlock()
+	}
+}
+
+// Do sends req, retrying on network errors, 429, and 5xx responses. The
+// request body is read into memory so it can be signed and replayed.
+// Requests are retried whatever their method, so webhook receivers must
+// tolerate duplicates.
+//
+// The caller must close the returned response's body. A response is returned
+// without error for any status, including the last retryable one.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	dest := c.destination(req.URL.Host)
+	dest.record(func(s *Stats) { s.Requests++ })
+
+	body, err := readBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	attempts := c.cfg.MaxAttempts
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if !dest.breaker.allow() {
+			dest.record(func(s *Stats) { s.Rejected++ })
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, req.URL.Host)
+		}
+
+		signer, lim := dest.settings()
+		if waited, err := lim.wait(ctx); err != nil {
+			dest.breaker.release()
+			return nil, err
+		} else if waited {
+			dest.record(func(s *Stats) { s.Throttled++ })
+		}
+
+		resp, err := c.attempt(ctx, req, body, signer, dest)
+		if err == nil && !retryable(resp.StatusCode) {
+			dest.breaker.success()
+			return resp, nil
+		}
+
+		dest.breaker.failure()
+		dest.record(func(s *Stats) { s.Failures++ })
+
+		delay := backoff(c.cfg.RetryBaseDelay, attempt)
+		if err != nil {
+			lastErr = err
+			c.logger.Warn("outbound request failed",
+				"host", req.URL.Host,
+				"method", req.Method,
+				"attempt", attempt+1,
+				"error", err,
+			)
+		} else {
+			c.logger.Warn("outbound request returned retryable status",
+				"host", req.URL.Host,
+				"method", req.Method,
+				"attempt", attempt+1,
+				"status", resp.StatusCode,
+			)
+			if attempt == attempts-1 {
+				return resp, nil
+			}
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if attempt == attempts-1 {
+			break
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, lastErr
+}
+
+// attempt sends one copy of req, signing it first if the destination has a signer.
+func (c *Client) attempt(ctx context.Context, req *http.Request, body []byte, signer Signer, dest *destination) (*http.Response, error) {
+	out := req.Clone(ctx)
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.ContentLength = int64(len(body))
+	}
+
+	if signer != nil {
+		if err := signer.Sign(ctx, out, body); err != nil {
+			return nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
+
+	start := time.Now()
+	resp, err := c.http.Do(out)
+	elapsed := time.Since(start)
+	dest.mu.Lock()
+	dest.stats.Attempts++
+	dest.totalLatency += elapsed
+	dest.mu.Unlock()
+
+	return resp, err
+}
+
+// Stats returns counters for every host called so far, sorted by host.
+func (c *Client) Stats() []Stats {
+	c.mu.Lock()
+	dests := make([]*destination, 0, len(c.destinations))
+	for _, d := range c.destinations {
+		dests = append(dests, d)
+	}
+	c.mu.Unlock()
+
+	stats := make([]Stats, 0, len(dests))
+	for _, d := range dests {
+		d.mu.Lock()
+		s := d.stats
+		if s.Attempts > 0 {
+			s.AvgLatencyMs = float64(d.totalLatency.Milliseconds()) / float64(s.Attempts)
+		}
+		d.mu.Unlock()
+		s.Circuit = d.breaker.state()
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Host < stats[j].Host
+	})
+	return stats
+}
+
+// destination returns the state for host, creating it on first use.
+func (c *Client) destination(host string) *destination {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d, ok := c.destinations[host]; ok {
+		return d
+	}
+	override := c.overrides[host]
+	d := &destination{
+		signer:  override.Signer,
+		limiter: c.newLimiter(override),
+		breaker: newBreaker(c.cfg.FailureThreshold, c.cfg.Cooldown),
+		stats:   Stats{Host: host},
+	}
+	c.destinations[host] = d
+	return d
+}
+
+// newLimiter builds a host's rate limiter from its override or the defaults.
+func (c *Client) newLimiter(d Destination) *limiter {
+	if d.RateLimit != 0 {
+		return newLimiter(d.RateLimit, d.Burst)
+	}
+	return newLimiter(c.cfg.RateLimit, c.cfg.Burst)
+}
+
+// settings returns the host's current signer and rate limiter.
+func (d *destination) settings() (Signer, *limiter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.signer, d.limiter
+}
+
+// record applies fn to the destination's counters.
+func (d *destination) record(fn func(*Stats)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(&d.stats)
+}
+
+// readBody returns the request body so it can be replayed on each attempt.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return io.ReadAll(req.Body)
+}
+
+// retryable reports whether a response status is worth retrying.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter parses a Retry-After header given in seconds.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return min(time.Duration(secs)*time.Second, maxRetryDelay), true
+}
+
+// backoff returns a jittered exponential delay for the given retry.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxRetryDelay)
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(half)
+}
@@ -0,0 +1,69 @@
+package egress
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket that holds up to burst tokens and refills at
+// rate tokens per second. A nil limiter never waits.
+type limiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex // Protects tokens and last
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter returns a full bucket, or nil if rate is not positive.
+func newLimiter(rate float64, burst int) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token, sleeping until one is available or ctx is done.
+// It reports whether the caller had to wait.
+func (l *limiter) wait(ctx context.Context) (bool, error) {
+	if l == nil {
+		return false, nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// Take the token now, even if it leaves the bucket negative, so
+	// concurrent waiters queue up behind each other instead of racing.
+	l.tokens--
+	if l.tokens >= 0 {
+		l.mu.Unlock()
+		return false, nil
+	}
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return true, ctx.Err()
+	}
+}
@@ -0,0 +1,131 @@
+// Package envelope encrypts data with a KMS data key before it is stored,
+// so it can't be read with access to the storage alone: reading it takes
+// kms:Decrypt on the key too.
+//
+// Each payload is encrypted with its own AES-256-GCM data key. The data
+// key, encrypted under the KMS key, travels with the payload in metadata,
+// along with the encryption context KMS binds it to.
+package envelope
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Metadata keys recording how a payload was sealed. They are S3 user
+// metadata keys, so they are lowercase.
+const (
+	MetaKey       = "envelope-key"
+	MetaAlgorithm = "envelope-alg"
+	MetaContext   = "envelope-context"
+)
+
+// algorithm is the only cipher payloads are sealed with.
+const algorithm = "AES-256-GCM"
+
+// ErrNotSealed is returned by Open for payloads without envelope metadata.
+var ErrNotSealed = errors.New("payload is not envelope-encrypted")
+
+// IsSealed reports whether metadata describes a sealed payload.
+func IsSealed(metadata map[string]string) bool {
+	return metadata[MetaKey] != ""
+}
+
+// Seal encrypts plaintext with a new data key from the KMS key keyID, bound
+// to encryptionContext. It returns the ciphertext, prefixed with its
+// nonce, and the metadata Open needs to decrypt it.
+func Seal(ctx context.Context, client *kms.Client, keyID string, encryptionContext map[string]string, plaintext []byte) ([]byte, map[string]string, error) {
+	dataKey, err := client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(keyID),
+		KeySpec:           kmstypes.DataKeySpecAes256,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate data key: %w", err)
+	}
+	defer clear(dataKey.Plaintext)
+
+	aead, err := newAEAD(dataKey.Plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+
+	encodedContext, err := json.Marshal(encryptionContext)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode encryption context: %w", err)
+	}
+	metadata := map[string]string{
+		MetaKey:       base64.StdEncoding.EncodeToString(dataKey.CiphertextBlob),
+		MetaAlgorithm: algorithm,
+		MetaContext:   string(encodedContext),
+	}
+	return sealed, metadata, nil
+}
+
+// Open decrypts a payload sealed by Seal, given the metadata it was stored
+// with. It returns ErrNotSealed if the metadata has no data key.
+func Open(ctx context.Context, client *kms.Client, metadata map[string]string, sealed []byte) ([]byte, error) {
+	if !IsSealed(metadata) {
+		return nil, ErrNotSealed
+	}
+	if alg := metadata[MetaAlgorithm]; alg != algorithm {
+		return nil, fmt.Errorf("unsupported envelope algorithm %q", alg)
+	}
+	encryptedKey, err := base64.StdEncoding.DecodeString(metadata[MetaKey])
+	if err != nil {
+		return nil, fmt.Errorf("decode data key: %w", err)
+	}
+	var encryptionContext map[string]string
+	if value := metadata[MetaContext]; value != "" {
+		if err := json.Unmarshal([]byte(value), &encryptionContext); err != nil {
+			return nil, fmt.Errorf("decode encryption context: %w", err)
+		}
+	}
+
+	dataKey, err := client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    encryptedKey,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decrypt data key: %w", err)
+	}
+	defer clear(dataKey.Plaintext)
+
+	aead, err := newAEAD(dataKey.Plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("payload is shorter than its nonce")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt payload: %w", err)
+	}
+	return plaintext, nil
+}
+
+// newAEAD returns AES-GCM with key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
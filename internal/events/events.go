@@ -0,0 +1,290 @@
+// Package events publishes domain events, such as a user signing up or an
+// item being created, to an EventBridge event bus, so other AWS services can
+// react to the API's activity through EventBridge rules.
+//
+// Publishing never waits on EventBridge: events are queued in an outbox and
+// sent in batches in the background. Entries EventBridge rejects, or that
+// fail to send, are retried with backoff up to MaxAttempts times. The outbox
+// is in memory, so events still queued when the process dies without
+// draining are lost; delivery is at most once in that case and at least
+// once otherwise.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// Event types, sent as the EventBridge detail type.
+const (
+	TypeUserSignedUp   = "user.signed_up"
+	TypeItemCreated    = "item.created"
+	TypeObjectUploaded = "object.uploaded"
+)
+
+// batchSize is the most entries PutEvents accepts at once.
+const batchSize = 10
+
+// maxEntrySize is the most an entry may take up, in bytes.
+const maxEntrySize = 256 * 1024
+
+// retryBaseDelay is how long a failed entry waits before its first retry;
+// the delay doubles with each attempt.
+const retryBaseDelay = time.Second
+
+// sendTimeout bounds each PutEvents call.
+const sendTimeout = 10 * time.Second
+
+// pending is an event in the outbox.
+type pending struct {
+	entry    types.PutEventsRequestEntry
+	attempts int
+	// notBefore is when a failed entry may be retried.
+	notBefore time.Time
+}
+
+// Publisher sends events to an EventBridge bus. A nil Publisher drops every
+// event.
+type Publisher struct {
+	client *eventbridge.Client
+	cfg    config.EventsConfig
+	logger *slog.Logger
+
+	outbox chan pending
+	// stopping is closed by Drain; the sender then flushes the outbox and
+	// closes done.
+	stopping chan struct{}
+	done     chan struct{}
+
+	published atomic.Int64
+	dropped   atomic.Int64
+}
+
+// New creates a publisher for cfg's bus, or returns nil if no bus is
+// configured.
+func New(client *eventbridge.Client, cfg config.EventsConfig, logger *slog.Logger) *Publisher {
+	if cfg.BusName == "" {
+		return nil
+	}
+	return &Publisher{
+		client:   client,
+		cfg:      cfg,
+		logger:   logger.With("event_bus", cfg.BusName),
+		outbox:   make(chan pending, cfg.OutboxSize),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Publish queues an event of eventType whose detail is data encoded as JSON.
+// Events that can't be encoded, or that arrive while the outbox is full, are
+// dropped and logged. It does nothing on a nil Publisher.
+func (p *Publisher) Publish(ctx context.Context, eventType string, data any) {
+	if p == nil {
+		return
+	}
+	detail, err := json.Marshal(data)
+	if err != nil {
+		p.drop(ctx, eventType, "encode detail", err)
+		return
+	}
+	entry := types.PutEventsRequestEntry{
+		EventBusName: aws.String(p.cfg.BusName),
+		Source:       aws.String(p.cfg.Source),
+		DetailType:   aws.String(eventType),
+		Detail:       aws.String(string(detail)),
+		Time:         aws.Time(time.Now().UTC()),
+	}
+	if entrySize(entry) > maxEntrySize {
+		p.drop(ctx, eventType, "event is larger than 256 KiB", nil)
+		return
+	}
+
+	select {
+	case p.outbox <- pending{entry: entry}:
+	default:
+		p.drop(ctx, eventType, "outbox is full", nil)
+	}
+}
+
+// Stats returns how many events have been published and dropped.
+func (p *Publisher) Stats() (published, dropped int64) {
+	if p == nil {
+		return 0, 0
+	}
+	return p.published.Load(), p.dropped.Load()
+}
+
+// Start sends queued events in the background until Drain is called.
+func (p *Publisher) Start() {
+	p.logger.Info("event publisher starting", "source", p.cfg.Source)
+	go p.run()
+}
+
+// Drain sends the events still queued, including those waiting to be
+// retried, and waits for them to be sent or for ctx to be done. It does
+// nothing on a nil Publisher.
+func (p *Publisher) Drain(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	close(p.stopping)
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		p.logger.Warn("events still queued at shutdown are lost", "queued", len(p.outbox))
+	}
+}
+
+// run sends batches of events until stopping is closed, then flushes the
+// outbox.
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	var retries []pending
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		batch, rest := due(retries, time.Now())
+		retries = rest
+		batch = p.fill(batch)
+
+		if len(batch) == 0 {
+			// Wait for a new event or the next retry
+			if len(retries) > 0 {
+				timer.Reset(time.Until(nextRetry(retries)))
+			} else {
+				timer.Reset(time.Hour)
+			}
+			select {
+			case e := <-p.outbox:
+				batch = append(batch, e)
+				batch = p.fill(batch)
+			case <-timer.C:
+				continue
+			case <-p.stopping:
+				p.flush(retries)
+				return
+			}
+		}
+
+		retries = append(retries, p.send(batch)...)
+	}
+}
+
+// fill adds queued events to batch until it is full or the outbox is empty.
+func (p *Publisher) fill(batch []pending) []pending {
+	for len(batch) < batchSize {
+		select {
+		case e := <-p.outbox:
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// flush sends retries and everything left in the outbox, without waiting
+// for backoff. Entries that still fail are dropped.
+func (p *Publisher) flush(retries []pending) {
+	for {
+		batch := p.fill(nil)
+		for len(batch) < batchSize && len(retries) > 0 {
+			batch, retries = append(batch, retries[0]), retries[1:]
+		}
+		if len(batch) == 0 {
+			return
+		}
+		for _, e := range p.send(batch) {
+			p.drop(context.Background(), aws.ToString(e.entry.DetailType), "not sent before shutdown", nil)
+		}
+	}
+}
+
+// send puts batch on the bus and returns the entries to retry, with their
+// attempts counted and backoff set. Entries out of attempts are dropped.
+func (p *Publisher) send(batch []pending) []pending {
+	entries := make([]types.PutEventsRequestEntry, len(batch))
+	for i, e := range batch {
+		entries[i] = e.entry
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	output, err := p.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries})
+
+	var failed []pending
+	for i, e := range batch {
+		reason := ""
+		switch {
+		case err != nil:
+			reason = err.Error()
+		case i < len(output.Entries) && output.Entries[i].ErrorCode != nil:
+			reason = aws.ToString(output.Entries[i].ErrorCode) + ": " + aws.ToString(output.Entries[i].ErrorMessage)
+		default:
+			p.published.Add(1)
+			continue
+		}
+
+		e.attempts++
+		if e.attempts >= p.cfg.MaxAttempts {
+			p.drop(ctx, aws.ToString(e.entry.DetailType), "out of attempts: "+reason, nil)
+			continue
+		}
+		e.notBefore = time.Now().Add(retryBaseDelay << (e.attempts - 1))
+		failed = append(failed, e)
+	}
+	if len(failed) > 0 {
+		p.logger.Warn("failed to publish events, will retry", "failed", len(failed), "batch", len(batch), "error", err)
+	}
+	return failed
+}
+
+// drop counts and logs an event that won't be published.
+func (p *Publisher) drop(ctx context.Context, eventType, reason string, err error) {
+	p.dropped.Add(1)
+	p.logger.ErrorContext(ctx, "dropped event", "type", eventType, "reason", reason, "error", err)
+}
+
+// due splits retries into up to batchSize entries whose backoff has passed
+// by now, and the rest.
+func due(retries []pending, now time.Time) (batch, rest []pending) {
+	for _, e := range retries {
+		if len(batch) < batchSize && !e.notBefore.After(now) {
+			batch = append(batch, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	return batch, rest
+}
+
+// nextRetry returns when the earliest of retries may be retried.
+func nextRetry(retries []pending) time.Time {
+	next := retries[0].notBefore
+	for _, e := range retries[1:] {
+		if e.notBefore.Before(next) {
+			next = e.notBefore
+		}
+	}
+	return next
+}
+
+// entrySize returns the size EventBridge counts an entry as.
+func entrySize(e types.PutEventsRequestEntry) int {
+	size := len(aws.ToString(e.Source)) + len(aws.ToString(e.DetailType)) + len(aws.ToString(e.Detail))
+	if e.Time != nil {
+		size += 14
+	}
+	return size
+}
@@ -0,0 +1,261 @@
+// Package features holds the feature flags that gate risky endpoints, such
+// as Bedrock model invocations, so they can be turned off without a
+// redeploy. Flags come from FEATURE_<NAME> settings, a local JSON file, and
+// AWS AppConfig, in increasing precedence; the file and AppConfig are
+// re-read while the server runs.
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/appconfigdata"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// Flags that gate endpoints.
+const (
+	// Bedrock gates POST /api/v1/aws/bedrock/invoke.
+	Bedrock = "bedrock"
+)
+
+// defaults are the flags' values when nothing sets them. Flags for
+// endpoints that already shipped stay on, so gating them changes nothing
+// until a flag is turned off.
+var defaults = map[string]bool{
+	Bedrock: true,
+}
+
+// Set is the value of every flag at one moment, by lowercase name.
+type Set map[string]bool
+
+// Enabled reports whether the flag name is on.
+func (s Set) Enabled(name string) bool {
+	return s[strings.ToLower(name)]
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the flags s.
+func NewContext(ctx context.Context, s Set) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the flags in ctx, or nil, in which every flag is
+// off, if there are none.
+func FromContext(ctx context.Context) Set {
+	s, _ := ctx.Value(contextKey{}).(Set)
+	return s
+}
+
+// Enabled reports whether the flag name is on in the flags in ctx.
+func Enabled(ctx context.Context, name string) bool {
+	return FromContext(ctx).Enabled(name)
+}
+
+// Flags holds the current flags. It is safe for concurrent use.
+type Flags struct {
+	configured config.FeatureFlags
+
+	mu        sync.RWMutex
+	file      map[string]bool
+	appConfig map[string]bool
+	current   Set
+}
+
+// New creates flags with the values configured with FEATURE_<NAME>.
+func New(configured config.FeatureFlags) *Flags {
+	f := &Flags{configured: configured}
+	f.merge()
+	return f
+}
+
+// Current returns the flags in effect. The set must not be modified.
+func (f *Flags) Current() Set {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.current
+}
+
+// Enabled reports whether the flag name is on.
+func (f *Flags) Enabled(name string) bool {
+	return f.Current().Enabled(name)
+}
+
+// setFile replaces the flags read from the file.
+func (f *Flags) setFile(flags map[string]bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.file = flags
+	f.merge()
+}
+
+// setAppConfig replaces the flags read from AppConfig.
+func (f *Flags) setAppConfig(flags map[string]bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.appConfig = flags
+	f.merge()
+}
+
+// merge rebuilds the current set from its sources. The caller must hold
+// f.mu, unless f isn't shared yet.
+func (f *Flags) merge() {
+	current := make(Set)
+	maps.Copy(current, defaults)
+	maps.Copy(current, f.configured)
+	maps.Copy(current, f.file)
+	maps.Copy(current, f.appConfig)
+	f.current = current
+}
+
+// WatchFile reads flags from the JSON file at path now, and again every
+// interval when the file has changed. A file that is missing or invalid
+// keeps the flags last read from it. It returns after the first read;
+// polling stops when ctx is cancelled.
+func (f *Flags) WatchFile(ctx context.Context, path string, interval time.Duration, logger *slog.Logger) {
+	var modified time.Time
+	read := func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			logger.Error("failed to read feature flags file", "error", err, "path", path)
+			return
+		}
+		if info.ModTime().Equal(modified) {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error("failed to read feature flags file", "error", err, "path", path)
+			return
+		}
+		flags, err := parse(data)
+		if err != nil {
+			logger.Error("invalid feature flags file", "error", err, "path", path)
+			return
+		}
+		modified = info.ModTime()
+		f.setFile(flags)
+		logger.Info("feature flags loaded", "source", "file", "path", path, "flags", flags)
+	}
+
+	read()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			read()
+		}
+	}()
+}
+
+// WatchAppConfig polls the AppConfig configuration cfg names for flags, at
+// cfg.PollInterval or the longer interval AppConfig asks for. A failed poll
+// keeps the flags last read, and the session is started again. It returns
+// immediately; polling stops when ctx is cancelled.
+func (f *Flags) WatchAppConfig(ctx context.Context, client *appconfigdata.Client, cfg config.FlagsConfig, logger *slog.Logger) {
+	go func() {
+		var token *string
+		for {
+			interval := cfg.PollInterval
+			next, wait, err := f.pollAppConfig(ctx, client, cfg, token, logger)
+			switch {
+			case err != nil:
+				if ctx.Err() == nil {
+					logger.Error("failed to read feature flags from AppConfig", "error", err,
+						"application", cfg.Application, "environment", cfg.Environment, "profile", cfg.Profile)
+				}
+				// Tokens expire after a day, so start over
+				token = nil
+			default:
+				token = next
+				interval = max(interval, wait)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// pollAppConfig reads the latest configuration with token, starting a
+// session if token is nil, and applies it if it changed. It returns the
+// token for the next poll and how long AppConfig asks to wait for it.
+func (f *Flags) pollAppConfig(ctx context.Context, client *appconfigdata.Client, cfg config.FlagsConfig, token *string, logger *slog.Logger) (*string, time.Duration, error) {
+	if token == nil {
+		session, err := client.StartConfigurationSession(ctx, &appconfigdata.StartConfigurationSessionInput{
+			ApplicationIdentifier:                aws.String(cfg.Application),
+			EnvironmentIdentifier:                aws.String(cfg.Environment),
+			ConfigurationProfileIdentifier:       aws.String(cfg.Profile),
+			RequiredMinimumPollIntervalInSeconds: aws.Int32(int32(cfg.PollInterval.Seconds())),
+		})
+		if err != nil {
+			return nil, 0, fmt.Errorf("start configuration session: %w", err)
+		}
+		token = session.InitialConfigurationToken
+	}
+
+	result, err := client.GetLatestConfiguration(ctx, &appconfigdata.GetLatestConfigurationInput{
+		ConfigurationToken: token,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("get latest configuration: %w", err)
+	}
+
+	// An empty configuration means it hasn't changed since the last poll
+	if len(result.Configuration) > 0 {
+		flags, err := parse(result.Configuration)
+		if err != nil {
+			return nil, 0, err
+		}
+		f.setAppConfig(flags)
+		logger.Info("feature flags loaded", "source", "appconfig", "version", aws.ToString(result.VersionLabel), "flags", flags)
+	}
+	return result.NextPollConfigurationToken, time.Duration(result.NextPollIntervalInSeconds) * time.Second, nil
+}
+
+// parse reads flags from a JSON object whose values are booleans, or
+// objects with an "enabled" boolean, as AppConfig feature flag profiles
+// return them:
+//
+//	{"bedrock": {"enabled": false}, "new_uploads": true}
+func parse(data []byte) (map[string]bool, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("feature flags must be a JSON object: %w", err)
+	}
+
+	flags := make(map[string]bool, len(raw))
+	for name, value := range raw {
+		var enabled bool
+		if err := json.Unmarshal(value, &enabled); err != nil {
+			var flag struct {
+				Enabled *bool `json:"enabled"`
+			}
+			if err := json.Unmarshal(value, &flag); err != nil || flag.Enabled == nil {
+				return nil, fmt.Errorf("feature flag %q must be true, false, or an object with an enabled field", name)
+			}
+			enabled = *flag.Enabled
+		}
+		flags[strings.ToLower(name)] = enabled
+	}
+	return flags, nil
+}
@@ -0,0 +1,108 @@
+// Package forwarded works out the client address and scheme of requests
+// that reach the server through load balancers and proxies, from the
+// X-Forwarded-For and X-Forwarded-Proto headers of the proxies it trusts.
+// Headers from anyone else are ignored, since clients can set them to
+// anything.
+package forwarded
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Proxies are the address ranges of trusted proxies.
+type Proxies []netip.Prefix
+
+// Request is what trusted proxies say about a request.
+type Request struct {
+	// Client is the address of the client that connected to the first
+	// trusted proxy.
+	Client netip.Addr
+	// Proto is the scheme the request reached the proxies over, "http" or
+	// "https", or "" if they didn't say.
+	Proto string
+}
+
+type contextKey struct{}
+
+// Trusts reports whether addr is a trusted proxy.
+func (p Proxies) Trusts(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns what r's proxies say about it, or false if r didn't come
+// from a trusted proxy. The client is the address closest to the server in
+// X-Forwarded-For that isn't a trusted proxy, as proxies append the address
+// they received the request from and anything to its left may be forged.
+func (p Proxies) Resolve(r *http.Request) (Request, bool) {
+	peer, ok := remoteAddr(r.RemoteAddr)
+	if !ok || !p.Trusts(peer) {
+		return Request{}, false
+	}
+
+	forwarded := Request{Client: peer}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed hop can't be trusted, nor can anything before it
+			break
+		}
+		forwarded.Client = addr.Unmap()
+		if !p.Trusts(addr) {
+			break
+		}
+	}
+
+	// The nearest proxy's value; earlier ones may have come from the client
+	protos := r.Header.Values("X-Forwarded-Proto")
+	if len(protos) > 0 {
+		values := strings.Split(protos[len(protos)-1], ",")
+		switch proto := strings.ToLower(strings.TrimSpace(values[len(values)-1])); proto {
+		case "http", "https":
+			forwarded.Proto = proto
+		}
+	}
+	return forwarded, true
+}
+
+// NewContext returns a copy of ctx carrying what proxies said about its
+// request.
+func NewContext(ctx context.Context, forwarded Request) context.Context {
+	return context.WithValue(ctx, contextKey{}, forwarded)
+}
+
+// Secure reports whether the client sent r over HTTPS, either to the
+// server itself or to a trusted proxy in front of it.
+func Secure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	forwarded, _ := r.Context().Value(contextKey{}).(Request)
+	return forwarded.Proto == "https"
+}
+
+// remoteAddr parses an http.Request RemoteAddr.
+func remoteAddr(value string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(value)
+	if err != nil {
+		host = value
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/pmollerus23/go-aws-server/internal/accessgrants"
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// validPermission reports whether permission is an S3 Access Grants permission.
+func validPermission(permission string) bool {
+	switch types.Permission(permission) {
+	case types.PermissionRead, types.PermissionWrite, types.PermissionReadwrite:
+		return true
+	}
+	return false
+}
+
+// DataAccessRequest represents a request for temporary S3 credentials.
+type DataAccessRequest struct {
+	// Prefix is relative to the caller's home; empty means the whole home.
+	Prefix     string `json:"prefix" example:"reports/"`
+	Permission string `json:"permission" example:"READ"`
+}
+
+// Valid validates the data access request.
+func (r DataAccessRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if !validPermission(r.Permission) {
+		problems["permission"] = "permission must be READ, WRITE, or READWRITE"
+	}
+
+	return problems
+}
+
+// CreateAccessGrantRequest represents a request to grant a user access to a prefix.
+type CreateAccessGrantRequest struct {
+	UserID string `json:"user_id" example:"12345678-1234-1234-1234-123456789012"`
+	// Prefix is relative to the user's home; empty means the whole home.
+	Prefix     string `json:"prefix" example:"reports/"`
+	Permission string `json:"permission" example:"READ"`
+}
+
+// Valid validates the create access grant request.
+func (r CreateAccessGrantRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.UserID == "" {
+		problems["user_id"] = "user_id is required"
+	} else if strings.ContainsAny(r.UserID, "/*") {
+		problems["user_id"] = "user_id must not contain / or *"
+	}
+	if !validPermission(r.Permission) {
+		problems["permission"] = "permission must be READ, WRITE, or READWRITE"
+	}
+
+	return problems
+}
+
+// ListAccessGrantsResponse represents the list access grants response.
+type ListAccessGrantsResponse struct {
+	Grants []accessgrants.Grant `json:"grants"`
+}
+
+// HandleS3DataAccess returns a handler that vends temporary S3 credentials
+// for a prefix in the caller's home, users/{userID}/, so the SPA can access
+// S3 directly.
+//
+//	@Summary		Get temporary S3 credentials
+//	@Description	Vend temporary credentials scoped to a prefix in the caller's home (users/{userID}/) through S3 Access Grants. An admin must have granted the caller access to the prefix or one containing it.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		DataAccessRequest	true	"Prefix and permission"
+//	@Success		200		{object}	accessgrants.Credentials
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"No access grant covers the prefix"
+//	@Failure		503		{object}	problem.Details	"S3 access grants are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/s3/access [post]
+func HandleS3DataAccess(logger *slog.Logger, grants *accessgrants.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grants == nil {
+			problem.Error(w, r, "S3 access grants are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		userID, err := auth.GetUserID(r.Context())
+		if err != nil {
+			problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, problems, err := decodeValid[DataAccessRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode data access request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		creds, err := grants.GetDataAccess(r.Context(), userID, req.Prefix, types.Permission(req.Permission))
+		if err != nil {
+			if errors.Is(err, accessgrants.ErrInvalidPrefix) {
+				problem.Validation(w, r, map[string]string{"prefix": err.Error()})
+				return
+			}
+			if errors.Is(err, accessgrants.ErrNoGrant) {
+				problem.Error(w, r, "No access grant covers the prefix", http.StatusForbidden)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to get data access", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if err := encode(w, r, http.StatusOK, creds); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleListAccessGrants returns a handler that lists users' access grants.
+//
+//	@Summary		List S3 access grants
+//	@Description	List the access grants for users' S3 prefixes, optionally for one user.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			user_id	query		string	false	"Only list this user's grants"
+//	@Success		200		{object}	ListAccessGrantsResponse
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Failure		503		{object}	problem.Details	"S3 access grants are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/s3/access-grants [get]
+func HandleListAccessGrants(logger *slog.Logger, grants *accessgrants.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grants == nil {
+			problem.Error(w, r, "S3 access grants are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		list, err := grants.ListGrants(r.Context(), r.URL.Query().Get("user_id"))
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to list access grants", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, ListAccessGrantsResponse{Grants: list}); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleCreateAccessGrant returns a handler that grants a user access to a
+// prefix in their home.
+//
+//	@Summary		Create S3 access grant
+//	@Description	Let a user get temporary credentials for a prefix in their home (users/{userID}/).
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateAccessGrantRequest	true	"Grant"
+//	@Success		201		{object}	accessgrants.Grant
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Failure		503		{object}	problem.Details	"S3 access grants are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/s3/access-grants [post]
+func HandleCreateAccessGrant(logger *slog.Logger, grants *accessgrants.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grants == nil {
+			problem.Error(w, r, "S3 access grants are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		req, problems, err := decodeValid[CreateAccessGrantRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode create access grant request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		grant, err := grants.CreateGrant(r.Context(), req.UserID, req.Prefix, types.Permission(req.Permission))
+		if err != nil {
+			if errors.Is(err, accessgrants.ErrInvalidPrefix) {
+				problem.Validation(w, r, map[string]string{"prefix": err.Error()})
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to create access grant", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := encode(w, r, http.StatusCreated, grant); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleDeleteAccessGrant returns a handler that deletes an access grant.
+//
+//	@Summary		Delete S3 access grant
+//	@Description	Delete an access grant. Credentials already vended for it stay valid until they expire.
+//	@Tags			admin
+//	@Param			id	path	string	true	"Access grant ID"
+//	@Success		204
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		404	{object}	problem.Details	"Access grant not found"
+//	@Failure		503	{object}	problem.Details	"S3 access grants are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/s3/access-grants/{id} [delete]
+func HandleDeleteAccessGrant(logger *slog.Logger, grants *accessgrants.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grants == nil {
+			problem.Error(w, r, "S3 access grants are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := grants.DeleteGrant(r.Context(), r.PathValue("id")); err != nil {
+			if errors.Is(err, accessgrants.ErrGrantNotFound) {
+				problem.Error(w, r, "Access grant not found", http.StatusNotFound)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to delete access grant", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
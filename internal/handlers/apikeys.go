@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/apikeys"
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// CreateAPIKeyRequest represents a request to mint an API key.
+type CreateAPIKeyRequest struct {
+	Name  string   `json:"name" example:"nightly-export"`
+	Roles []string `json:"roles" example:"editor"`
+	// ExpiresAt is when the key stops working; omit for no expiry.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Valid validates the create API key request.
+func (r CreateAPIKeyRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Name == "" {
+		problems["name"] = "name is required"
+	} else if len(r.Name) > 128 {
+		problems["name"] = "name must be 128 characters or less"
+	}
+	if len(r.Roles) == 0 {
+		problems["roles"] = "at least one role is required"
+	}
+	for _, role := range r.Roles {
+		if role == "" || strings.ContainsAny(role, " \t\r\n") {
+			problems["roles"] = "roles must be non-empty and contain no whitespace"
+			break
+		}
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		problems["expires_at"] = "expires_at must be in the future"
+	}
+
+	return problems
+}
+
+// CreateAPIKeyResponse represents a minted API key.
+type CreateAPIKeyResponse struct {
+	// Key is the full API key, to send in the X-API-Key header. It is only
+	// shown once.
+	Key    string       `json:"key" example:"ak_01J9Z6M3T4V5W6X7Y8Z9A0B1C2.ABCDEFGHIJKLMNOPQRSTUVWXYZ"`
+	APIKey *apikeys.Key `json:"api_key"`
+}
+
+// ListAPIKeysResponse represents the list API keys response.
+type ListAPIKeysResponse struct {
+	APIKeys []apikeys.Key `json:"api_keys"`
+}
+
+// HandleListAPIKeys returns a handler that lists API keys.
+//
+//	@Summary		List API keys
+//	@Description	List API keys, including revoked and expired ones. Secrets are never returned.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	ListAPIKeysResponse
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		503	{object}	problem.Details	"API keys are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/api-keys [get]
+func HandleListAPIKeys(logger *slog.Logger, keys *apikeys.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keys == nil {
+			problem.Error(w, r, "API keys are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		list, err := keys.List(r.Context())
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to list API keys", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, ListAPIKeysResponse{APIKeys: list}); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleCreateAPIKey returns a handler that mints an API key.
+//
+//	@Summary		Create API key
+//	@Description	Mint an API key for a machine client. Requests sending it in the X-API-Key header are authenticated with the key's roles. The key is only returned once.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateAPIKeyRequest	true	"API key"
+//	@Success		201		{object}	CreateAPIKeyResponse
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Failure		503		{object}	problem.Details	"API keys are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/api-keys [post]
+func HandleCreateAPIKey(logger *slog.Logger, keys *apikeys.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keys == nil {
+			problem.Error(w, r, "API keys are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		req, problems, err := decodeValid[CreateAPIKeyRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode create API key request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		userID, _ := auth.GetUserID(r.Context())
+		key, secret, err := keys.Mint(r.Context(), req.Name, req.Roles, req.ExpiresAt, userID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to mint API key", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if err := encode(w, r, http.StatusCreated, CreateAPIKeyResponse{Key: secret, APIKey: key}); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleRevokeAPIKey returns a handler that revokes an API key.
+//
+//	@Summary		Revoke API key
+//	@Description	Revoke an API key. Other server instances may accept it for up to a minute.
+//	@Tags			admin
+//	@Param			id	path	string	true	"API key ID"
+//	@Success		204
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		404	{object}	problem.Details	"API key not found"
+//	@Failure		503	{object}	problem.Details	"API keys are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/api-keys/{id} [delete]
+func HandleRevokeAPIKey(logger *slog.Logger, keys *apikeys.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if keys == nil {
+			problem.Error(w, r, "API keys are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := keys.Revoke(r.Context(), r.PathValue("id")); err != nil {
+			if errors.Is(err, apikeys.ErrKeyNotFound) {
+				problem.Error(w, r, "API key not found", http.StatusNotFound)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to revoke API key", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,498 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	athenatypes "github.com/aws/aws-sdk-go-v2/service/athena/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// maxAthenaQueryLength is the longest query string Athena accepts.
+const maxAthenaQueryLength = 262144
+
+// maxAthenaResults is the most rows GetQueryResults returns at once.
+const maxAthenaResults = 1000
+
+// StartAthenaQueryRequest represents a query to run.
+type StartAthenaQueryRequest struct {
+	Query string `json:"query" example:"SELECT id, name FROM records WHERE created_at > ?"`
+	// Database defaults to the server's ATHENA_DATABASE.
+	Database string `json:"database,omitempty" example:"exports"`
+	// Parameters fill the query's ? placeholders, in order, as SQL
+	// literals.
+	Parameters []string `json:"parameters,omitempty" example:"'2024-01-01'"`
+}
+
+// Valid validates the start query request.
+func (r StartAthenaQueryRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	if strings.TrimSpace(r.Query) == "" {
+		problems["query"] = "query is required and cannot be empty"
+	} else if len(r.Query) > maxAthenaQueryLength {
+		problems["query"] = "query must be at most 256 KiB"
+	}
+	for i, param := range r.Parameters {
+		if param == "" {
+			problems["parameters["+strconv.Itoa(i)+"]"] = "parameters cannot be empty"
+		}
+	}
+	return problems
+}
+
+// AthenaQuery is the status of a query.
+type AthenaQuery struct {
+	ID    string `json:"queryExecutionId" example:"a1b2c3d4-5678-90ab-cdef-EXAMPLE11111"`
+	Query string `json:"query,omitempty" example:"SELECT id, name FROM records"`
+	// State is QUEUED, RUNNING, SUCCEEDED, FAILED, or CANCELLED.
+	State string `json:"state" example:"SUCCEEDED"`
+	// Reason explains a failed or cancelled query.
+	Reason           string     `json:"reason,omitempty"`
+	Database         string     `json:"database,omitempty" example:"exports"`
+	Workgroup        string     `json:"workgroup,omitempty" example:"primary"`
+	SubmittedAt      *time.Time `json:"submittedAt,omitempty"`
+	CompletedAt      *time.Time `json:"completedAt,omitempty"`
+	DataScannedBytes int64      `json:"dataScannedBytes" example:"10485760"`
+	ExecutionTimeMs  int64      `json:"executionTimeMs" example:"1520"`
+	// OutputLocation is the S3 object holding the full results as CSV.
+	OutputLocation string `json:"outputLocation,omitempty" example:"s3://athena-results/a1b2c3d4-5678-90ab-cdef-EXAMPLE11111.csv"`
+}
+
+// athenaRow is a result row. It encodes as an object with its columns in
+// query order, so CSV columns keep that order too.
+type athenaRow struct {
+	columns []string
+	values  []any
+}
+
+func (row athenaRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range row.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(row.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// athenaResults converts a page of results to rows. The first page of a
+// SELECT query starts with a row of column names, which is skipped.
+func athenaResults(results *athenatypes.ResultSet, first bool) []athenaRow {
+	if results == nil || results.ResultSetMetadata == nil {
+		return []athenaRow{}
+	}
+	columns := make([]string, len(results.ResultSetMetadata.ColumnInfo))
+	types := make([]string, len(columns))
+	for i, info := range results.ResultSetMetadata.ColumnInfo {
+		columns[i], types[i] = aws.ToString(info.Name), aws.ToString(info.Type)
+	}
+
+	data := results.Rows
+	if first && len(data) > 0 && isHeaderRow(data[0], columns) {
+		data = data[1:]
+	}
+	rows := make([]athenaRow, 0, len(data))
+	for _, d := range data {
+		row := athenaRow{columns: columns, values: make([]any, len(columns))}
+		for i := range columns {
+			if i < len(d.Data) {
+				row.values[i] = athenaValue(types[i], d.Data[i].VarCharValue)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// isHeaderRow reports whether row holds the column names.
+func isHeaderRow(row athenatypes.Row, columns []string) bool {
+	if len(row.Data) != len(columns) {
+		return false
+	}
+	for i, d := range row.Data {
+		if aws.ToString(d.VarCharValue) != columns[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// athenaValue converts a result value, which Athena returns as text, to a
+// JSON value of its column's type. NULL is nil; decimals and types without
+// a JSON equivalent stay text.
+func athenaValue(columnType string, value *string) any {
+	if value == nil {
+		return nil
+	}
+	switch columnType {
+	case "tinyint", "smallint", "integer", "bigint":
+		if n, err := strconv.ParseInt(*value, 10, 64); err == nil {
+			return n
+		}
+	case "float", "real", "double":
+		if f, err := strconv.ParseFloat(*value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(*value); err == nil {
+			return b
+		}
+	}
+	return *value
+}
+
+// writeAthenaResultsError replies to r with the error of a GetQueryResults
+// call, which fails with InvalidRequestException until the query succeeds.
+func writeAthenaResultsError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRequestException" {
+		problem.Error(w, r, "Query has no results: it is still running, or it failed or was cancelled", http.StatusConflict)
+		return
+	}
+	writeAWSError(w, r, err, "Failed to get query results")
+}
+
+// HandleAthenaStartQuery returns a handler that starts an Athena query.
+//
+//	@Summary		Start an Athena query
+//	@Description	Start a SQL query in the server's Athena workgroup. Poll the returned query's status until it is SUCCEEDED, then page through its results. Requires the athena:query permission, as do the other query endpoints.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		StartAthenaQueryRequest	true	"Query"
+//	@Success		202		{object}	AthenaQuery
+//	@Header			202		{string}	Location	"URL of the query's status"
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Missing athena:query"
+//	@Failure		429		{object}	problem.Details	"Too many queries running"
+//	@Failure		500		{object}	problem.Details	"Failed to start query"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/athena/queries [post]
+func HandleAthenaStartQuery(logger *slog.Logger, athenaClient *athena.Client, cfg config.AthenaConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[StartAthenaQueryRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode start query request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		input := &athena.StartQueryExecutionInput{
+			QueryString:         aws.String(req.Query),
+			ExecutionParameters: req.Parameters,
+		}
+		if cfg.Workgroup != "" {
+			input.WorkGroup = aws.String(cfg.Workgroup)
+		}
+		database := req.Database
+		if database == "" {
+			database = cfg.Database
+		}
+		if database != "" {
+			input.QueryExecutionContext = &athenatypes.QueryExecutionContext{Database: aws.String(database)}
+		}
+		if cfg.OutputLocation != "" {
+			input.ResultConfiguration = &athenatypes.ResultConfiguration{OutputLocation: aws.String(cfg.OutputLocation)}
+		}
+
+		result, err := athenaClient.StartQueryExecution(r.Context(), input)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to start Athena query", "error", err, "workgroup", cfg.Workgroup)
+			writeAWSError(w, r, err, "Failed to start query")
+			return
+		}
+
+		id := aws.ToString(result.QueryExecutionId)
+		logger.InfoContext(r.Context(), "started Athena query", "query_execution_id", id, "workgroup", cfg.Workgroup)
+
+		w.Header().Set("Location", "/api/v1/aws/athena/queries/"+id)
+		resp := AthenaQuery{
+			ID:        id,
+			Query:     req.Query,
+			State:     string(athenatypes.QueryExecutionStateQueued),
+			Database:  database,
+			Workgroup: cfg.Workgroup,
+		}
+		if err := encode(w, r, http.StatusAccepted, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleAthenaGetQuery returns a handler that reports a query's status.
+//
+//	@Summary		Get an Athena query
+//	@Description	Get the state of a query, and once it has finished, how much data it scanned and where its results are
+//	@Tags			aws
+//	@Produce		json
+//	@Param			id	path		string	true	"Query execution ID"
+//	@Success		200	{object}	AthenaQuery
+//	@Failure		400	{object}	problem.Details	"Invalid query execution ID"
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Missing athena:query"
+//	@Failure		500	{object}	problem.Details	"Failed to get query"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/athena/queries/{id} [get]
+func HandleAthenaGetQuery(logger *slog.Logger, athenaClient *athena.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		result, err := athenaClient.GetQueryExecution(r.Context(), &athena.GetQueryExecutionInput{
+			QueryExecutionId: aws.String(id),
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get Athena query", "error", err, "query_execution_id", id)
+			writeAWSError(w, r, err, "Failed to get query")
+			return
+		}
+
+		execution := result.QueryExecution
+		resp := AthenaQuery{
+			ID:        aws.ToString(execution.QueryExecutionId),
+			Query:     aws.ToString(execution.Query),
+			Workgroup: aws.ToString(execution.WorkGroup),
+		}
+		if execution.QueryExecutionContext != nil {
+			resp.Database = aws.ToString(execution.QueryExecutionContext.Database)
+		}
+		if status := execution.Status; status != nil {
+			resp.State = string(status.State)
+			resp.Reason = aws.ToString(status.StateChangeReason)
+			resp.SubmittedAt = status.SubmissionDateTime
+			resp.CompletedAt = status.CompletionDateTime
+		}
+		if stats := execution.Statistics; stats != nil {
+			resp.DataScannedBytes = aws.ToInt64(stats.DataScannedInBytes)
+			resp.ExecutionTimeMs = aws.ToInt64(stats.EngineExecutionTimeInMillis)
+		}
+		if execution.ResultConfiguration != nil {
+			resp.OutputLocation = aws.ToString(execution.ResultConfiguration.OutputLocation)
+		}
+
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleAthenaStopQuery returns a handler that cancels a query.
+//
+//	@Summary		Cancel an Athena query
+//	@Description	Cancel a queued or running query. Cancelling a finished query does nothing.
+//	@Tags			aws
+//	@Param			id	path	string	true	"Query execution ID"
+//	@Success		204
+//	@Failure		400	{object}	problem.Details	"Invalid query execution ID"
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Missing athena:query"
+//	@Failure		500	{object}	problem.Details	"Failed to cancel query"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/athena/queries/{id} [delete]
+func HandleAthenaStopQuery(logger *slog.Logger, athenaClient *athena.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		_, err := athenaClient.StopQueryExecution(r.Context(), &athena.StopQueryExecutionInput{
+			QueryExecutionId: aws.String(id),
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to cancel Athena query", "error", err, "query_execution_id", id)
+			writeAWSError(w, r, err, "Failed to cancel query")
+			return
+		}
+		logger.InfoContext(r.Context(), "cancelled Athena query", "query_execution_id", id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// HandleAthenaQueryResults returns a handler that pages through a query's
+// results.
+//
+//	@Summary		Get Athena query results
+//	@Description	Get a page of a succeeded query's rows, as objects keyed by column. Numbers and booleans are typed; other values are text and NULL is null. Pass nextToken back for the next page.
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			id			path		string	true	"Query execution ID"
+//	@Param			limit		query		int		false	"Rows per page (1-1000, default 100)"
+//	@Param			nextToken	query		string	false	"Token from the previous page"
+//	@Success		200			{object}	pageResponse
+//	@Failure		400			{object}	problem.Details	"Invalid paging parameters"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		403			{object}	problem.Details	"Missing athena:query"
+//	@Failure		409			{object}	problem.Details	"Query hasn't succeeded"
+//	@Failure		500			{object}	problem.Details	"Failed to get query results"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/athena/queries/{id}/results [get]
+func HandleAthenaQueryResults(logger *slog.Logger, athenaClient *athena.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := parsePage(r)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := r.PathValue("id")
+		first := p.token == ""
+		limit := p.limit
+		if first {
+			// Make room for the header row
+			limit = min(limit+1, maxAthenaResults)
+		}
+		input := &athena.GetQueryResultsInput{
+			QueryExecutionId: aws.String(id),
+			MaxResults:       aws.Int32(int32(limit)),
+		}
+		if !first {
+			input.NextToken = aws.String(p.token)
+		}
+		result, err := athenaClient.GetQueryResults(r.Context(), input)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get Athena query results", "error", err, "query_execution_id", id)
+			writeAthenaResultsError(w, r, err)
+			return
+		}
+
+		rows := athenaResults(result.ResultSet, first)
+		resp := newPageResponse(w, r, rows, len(rows), aws.ToString(result.NextToken))
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleAthenaExportResults returns a handler that streams all of a query's
+// results.
+//
+//	@Summary		Export Athena query results
+//	@Description	Stream every row of a succeeded query as CSV, or as NDJSON when the client prefers application/x-ndjson. Rows are written as Athena returns them, so large results don't have to fit in memory.
+//	@Tags			aws
+//	@Produce		text/csv,application/x-ndjson
+//	@Param			id	path		string			true	"Query execution ID"
+//	@Success		200	{file}		file			"Query results"
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Missing athena:query"
+//	@Failure		409	{object}	problem.Details	"Query hasn't succeeded"
+//	@Failure		500	{object}	problem.Details	"Failed to get query results"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/athena/queries/{id}/results/export [get]
+func HandleAthenaExportResults(logger *slog.Logger, athenaClient *athena.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		ndjson := negotiateMediaType(r.Header.Get("Accept"), []any{}) == mediaTypeNDJSON
+		rc := http.NewResponseController(w)
+
+		var cw *csv.Writer
+		started := false
+		paginator := athena.NewGetQueryResultsPaginator(athenaClient, &athena.GetQueryResultsInput{
+			QueryExecutionId: aws.String(id),
+			MaxResults:       aws.Int32(maxAthenaResults),
+		})
+		for first := true; paginator.HasMorePages(); first = false {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to get Athena query results", "error", err, "query_execution_id", id, "started", started)
+				if !started {
+					writeAthenaResultsError(w, r, err)
+				}
+				// Otherwise the response is cut short, which clients see
+				// as a truncated body
+				return
+			}
+			rows := athenaResults(page.ResultSet, first)
+
+			if !started {
+				started = true
+				w.Header().Add("Vary", "Accept")
+				if ndjson {
+					w.Header().Set("Content-Type", mediaTypeNDJSON)
+					w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".ndjson"))
+				} else {
+					w.Header().Set("Content-Type", mediaTypeCSV+"; charset=utf-8")
+					w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".csv"))
+					cw = csv.NewWriter(w)
+					if page.ResultSet != nil && page.ResultSet.ResultSetMetadata != nil {
+						var columns []string
+						for _, info := range page.ResultSet.ResultSetMetadata.ColumnInfo {
+							columns = append(columns, aws.ToString(info.Name))
+						}
+						cw.Write(columns)
+					}
+				}
+				w.WriteHeader(http.StatusOK)
+			}
+
+			if err := writeAthenaRows(w, cw, rows); err != nil {
+				logger.WarnContext(r.Context(), "failed to write Athena query results", "error", err, "query_execution_id", id)
+				return
+			}
+			rc.Flush()
+		}
+	})
+}
+
+// writeAthenaRows writes rows as CSV records to cw, or as NDJSON to w if cw
+// is nil.
+func writeAthenaRows(w http.ResponseWriter, cw *csv.Writer, rows []athenaRow) error {
+	if cw == nil {
+		raw, err := rawRows(rows)
+		if err != nil {
+			return err
+		}
+		return writeNDJSON(w, raw)
+	}
+	for _, row := range rows {
+		record := make([]string, len(row.values))
+		for i, value := range row.values {
+			switch v := value.(type) {
+			case nil:
+			case string:
+				record[i] = v
+			default:
+				b, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				record[i] = string(b)
+			}
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -5,18 +5,31 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/pmollerus23/go-aws-server/internal/audit"
 	"github.com/pmollerus23/go-aws-server/internal/auth"
+	domainevents "github.com/pmollerus23/go-aws-server/internal/events"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/throttle"
 )
 
 // AuthService defines the interface for authentication operations.
 type AuthService interface {
 	SignUp(ctx context.Context, email, password, name string) error
 	ConfirmSignUp(ctx context.Context, email, code string) error
-	Login(ctx context.Context, email, password string) (*auth.CognitoTokens, error)
-	RefreshToken(ctx context.Context, refreshToken, email string) (*auth.CognitoTokens, error)
+	Login(ctx context.Context, email, password string, device *auth.DeviceCredentials) (*auth.Tokens, *auth.Challenge, error)
+	RespondToSMSMFA(ctx context.Context, email, session, code string) (*auth.Tokens, error)
+	RespondToNewPasswordRequired(ctx context.Context, email, session, newPassword string, attributes map[string]string) (*auth.Tokens, *auth.Challenge, error)
+	RefreshToken(ctx context.Context, refreshToken, email, deviceKey string) (*auth.Tokens, error)
+	RevokeToken(ctx context.Context, refreshToken string) error
 	ForgotPassword(ctx context.Context, email string) error
 	ConfirmForgotPassword(ctx context.Context, email, code, newPassword string) error
+	ChangePassword(ctx context.Context, accessToken, currentPassword, newPassword string) error
+	UpdateUserAttributes(ctx context.Context, accessToken string, attributes map[string]string) ([]string, error)
+	VerifyUserAttribute(ctx context.Context, accessToken, attribute, code string) error
+	PasswordPolicy(ctx context.Context) (*auth.PasswordPolicy, error)
 }
 
 // SignUpRequest represents the signup request payload.
@@ -35,9 +48,8 @@ func (r SignUpRequest) Valid(ctx context.Context) map[string]string {
 	}
 	if r.Password == "" {
 		problems["password"] = "password is required"
-	}
-	if len(r.Password) < 8 {
-		problems["password"] = "password must be at least 8 characters"
+	} else if problem := passwordPolicy(ctx).Check(r.Password); problem != "" {
+		problems["password"] = problem
 	}
 
 	return problems
@@ -52,45 +64,51 @@ type SignUpResponse struct {
 // HandleSignUp handles user registration.
 //
 //	@Summary		Sign up a new user
-//	@Description	Register a new user account with email and password
+//	@Description	Register a new user account with email and password. The password must follow GET /api/v1/auth/password-policy.
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
 //	@Param			request	body		SignUpRequest	true	"Signup request"
 //	@Success		201		{object}	SignUpResponse
-//	@Failure		400		{object}	map[string]interface{}
-//	@Failure		409		{object}	map[string]interface{}
-//	@Failure		500		{object}	map[string]interface{}
+//	@Failure		400		{object}	problem.Details
+//	@Failure		409		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
 //	@Router			/api/v1/auth/signup [post]
-func HandleSignUp(logger *slog.Logger, authService AuthService) http.Handler {
+func HandleSignUp(logger *slog.Logger, authService AuthService, events *audit.Log, bus *domainevents.Publisher) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withPasswordPolicy(r, authService, logger)
 		req, problems, err := decodeValid[SignUpRequest](r)
 		if err != nil {
-			logger.Error("failed to decode signup request", "error", err)
+			logger.ErrorContext(r.Context(), "failed to decode signup request", "error", err)
 			if len(problems) > 0 {
-				encode(w, r, http.StatusBadRequest, map[string]interface{}{
-					"error":    "validation failed",
-					"problems": problems,
-				})
+				problem.Validation(w, r, problems)
 				return
 			}
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
 		err = authService.SignUp(r.Context(), req.Email, req.Password, req.Name)
+		events.Record(r, audit.NewEvent(audit.EventSignUp, req.Email, err))
 		if err != nil {
 			if errors.Is(err, auth.ErrUserAlreadyExists) {
-				encode(w, r, http.StatusConflict, map[string]interface{}{
-					"error": "user already exists",
-				})
+				problem.Error(w, r, "user already exists", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, auth.ErrNotSupported) {
+				problem.Error(w, r, "sign-up is not supported by the identity provider", http.StatusNotImplemented)
 				return
 			}
-			logger.Error("signup failed", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "signup failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
+		bus.Publish(r.Context(), domainevents.TypeUserSignedUp, map[string]string{
+			"email": req.Email,
+			"name":  req.Name,
+		})
+
 		resp := SignUpResponse{
 			Message: "User registered successfully. Please check your email for verification code.",
 			Email:   req.Email,
@@ -134,35 +152,34 @@ type ConfirmSignUpResponse struct {
 //	@Produce		json
 //	@Param			request	body		ConfirmSignUpRequest	true	"Confirmation request"
 //	@Success		200		{object}	ConfirmSignUpResponse
-//	@Failure		400		{object}	map[string]interface{}
-//	@Failure		500		{object}	map[string]interface{}
+//	@Failure		400		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
 //	@Router			/api/v1/auth/confirm [post]
 func HandleConfirmSignUp(logger *slog.Logger, authService AuthService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req, problems, err := decodeValid[ConfirmSignUpRequest](r)
 		if err != nil {
-			logger.Error("failed to decode confirm request", "error", err)
+			logger.ErrorContext(r.Context(), "failed to decode confirm request", "error", err)
 			if len(problems) > 0 {
-				encode(w, r, http.StatusBadRequest, map[string]interface{}{
-					"error":    "validation failed",
-					"problems": problems,
-				})
+				problem.Validation(w, r, problems)
 				return
 			}
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
 		err = authService.ConfirmSignUp(r.Context(), req.Email, req.Code)
 		if err != nil {
 			if errors.Is(err, auth.ErrInvalidVerification) {
-				encode(w, r, http.StatusBadRequest, map[string]interface{}{
-					"error": "invalid or expired verification code",
-				})
+				problem.Error(w, r, "invalid or expired verification code", http.StatusBadRequest)
 				return
 			}
-			logger.Error("confirm signup failed", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			if errors.Is(err, auth.ErrNotSupported) {
+				problem.Error(w, r, "sign-up confirmation is not supported by the identity provider", http.StatusNotImplemented)
+				return
+			}
+			logger.ErrorContext(r.Context(), "confirm signup failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
@@ -178,6 +195,8 @@ func HandleConfirmSignUp(logger *slog.Logger, authService AuthService) http.Hand
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Device holds the credentials of a remembered device, which skip MFA.
+	Device *auth.DeviceCredentials `json:"device,omitempty"`
 }
 
 // Valid validates the login request.
@@ -190,64 +209,264 @@ func (r LoginRequest) Valid(ctx context.Context) map[string]string {
 	if r.Password == "" {
 		problems["password"] = "password is required"
 	}
+	if r.Device != nil && (r.Device.Key == "" || r.Device.GroupKey == "" || r.Device.Password == "") {
+		problems["device"] = "device_key, device_group_key, and device_password are required"
+	}
 
 	return problems
 }
 
-// LoginResponse represents the login response.
+// LoginResponse represents the login response. When Cognito requires
+// another step, such as an SMS MFA code, Tokens is omitted and Challenge
+// describes the step to complete.
 type LoginResponse struct {
-	Message string               `json:"message"`
-	Tokens  *auth.CognitoTokens `json:"tokens"`
+	Message   string          `json:"message"`
+	Tokens    *auth.Tokens    `json:"tokens,omitempty"`
+	Challenge *auth.Challenge `json:"challenge,omitempty"`
 }
 
 // HandleLogin handles user authentication.
 //
 //	@Summary		Login
-//	@Description	Authenticate user and receive JWT tokens
+//	@Description	Authenticate user and receive JWT tokens. If Cognito requires another step, the response carries a challenge instead: complete SMS_MFA with POST /api/v1/auth/mfa/respond and NEW_PASSWORD_REQUIRED with POST /api/v1/auth/new-password. Send a remembered device's credentials as "device" to skip MFA.
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
 //	@Param			request	body		LoginRequest	true	"Login credentials"
 //	@Success		200		{object}	LoginResponse
-//	@Failure		400		{object}	map[string]interface{}
-//	@Failure		401		{object}	map[string]interface{}
-//	@Failure		500		{object}	map[string]interface{}
+//	@Failure		400		{object}	problem.Details
+//	@Failure		401		{object}	problem.Details
+//	@Failure		429		{object}	problem.Details	"Too many failed logins"
+//	@Failure		500		{object}	problem.Details
 //	@Router			/api/v1/auth/login [post]
-func HandleLogin(logger *slog.Logger, authService AuthService) http.Handler {
+func HandleLogin(logger *slog.Logger, authService AuthService, limiter *throttle.Limiter, events *audit.Log) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req, problems, err := decodeValid[LoginRequest](r)
 		if err != nil {
-			logger.Error("failed to decode login request", "error", err)
+			logger.ErrorContext(r.Context(), "failed to decode login request", "error", err)
 			if len(problems) > 0 {
-				encode(w, r, http.StatusBadRequest, map[string]interface{}{
-					"error":    "validation failed",
-					"problems": problems,
-				})
+				problem.Validation(w, r, problems)
 				return
 			}
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		tokens, err := authService.Login(r.Context(), req.Email, req.Password)
+		key := throttle.Key(r, req.Email)
+		if retryAfter := limiter.Locked(key); retryAfter > 0 {
+			events.Record(r, audit.Event{Type: audit.EventLogin, Email: req.Email, Outcome: audit.OutcomeFailure, Reason: "locked out"})
+			encodeTooManyAttempts(w, r, retryAfter)
+			return
+		}
+
+		tokens, challenge, err := authService.Login(r.Context(), req.Email, req.Password, req.Device)
 		if err != nil {
+			events.Record(r, audit.NewEvent(audit.EventLogin, req.Email, err))
 			if errors.Is(err, auth.ErrInvalidCredentials) {
-				encode(w, r, http.StatusUnauthorized, map[string]interface{}{
-					"error": "invalid email or password",
-				})
+				limiter.Fail(key)
+				problem.Error(w, r, "invalid email or password", http.StatusUnauthorized)
 				return
 			}
 			if errors.Is(err, auth.ErrUserNotConfirmed) {
-				encode(w, r, http.StatusUnauthorized, map[string]interface{}{
-					"error": "email not verified. Please check your email for verification code.",
-				})
+				problem.Error(w, r, "email not verified. Please check your email for verification code.", http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, auth.ErrPasswordResetRequired) {
+				problem.Error(w, r, "password reset required. Please check your email for a reset code.", http.StatusUnauthorized)
+				return
+			}
+			logger.ErrorContext(r.Context(), "login failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		limiter.Reset(key)
+
+		if challenge != nil {
+			events.Record(r, audit.Event{Type: audit.EventLogin, Email: req.Email, Outcome: audit.OutcomeChallenge, Reason: challenge.Name})
+			resp := LoginResponse{
+				Message:   "Additional verification required",
+				Challenge: challenge,
+			}
+			encode(w, r, http.StatusOK, resp)
+			return
+		}
+
+		events.Record(r, audit.NewEvent(audit.EventLogin, req.Email, nil))
+		resp := LoginResponse{
+			Message: "Login successful",
+			Tokens:  tokens,
+		}
+
+		encode(w, r, http.StatusOK, resp)
+	})
+}
+
+// MFARespondRequest represents the MFA challenge response request.
+type MFARespondRequest struct {
+	Email   string `json:"email"`
+	Session string `json:"session"`
+	Code    string `json:"code"`
+}
+
+// Valid validates the MFA challenge response request.
+func (r MFARespondRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Email == "" {
+		problems["email"] = "email is required"
+	}
+	if r.Session == "" {
+		problems["session"] = "session is required"
+	}
+	if r.Code == "" {
+		problems["code"] = "MFA code is required"
+	}
+
+	return problems
+}
+
+// HandleMFARespond completes a login that returned an SMS MFA challenge.
+//
+//	@Summary		Respond to MFA challenge
+//	@Description	Complete an SMS MFA login with the session from POST /api/v1/auth/login and the code texted to the user
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		MFARespondRequest	true	"Challenge session and MFA code"
+//	@Success		200		{object}	LoginResponse
+//	@Failure		400		{object}	problem.Details
+//	@Failure		401		{object}	problem.Details
+//	@Failure		429		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
+//	@Router			/api/v1/auth/mfa/respond [post]
+func HandleMFARespond(logger *slog.Logger, authService AuthService, events *audit.Log) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[MFARespondRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode MFA respond request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := authService.RespondToSMSMFA(r.Context(), req.Email, req.Session, req.Code)
+		events.Record(r, audit.NewEvent(audit.EventLogin, req.Email, err))
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidVerification):
+				problem.Error(w, r, "invalid or expired MFA code", http.StatusUnauthorized)
+			case errors.Is(err, auth.ErrSessionExpired):
+				problem.Error(w, r, "session expired, log in again", http.StatusUnauthorized)
+			case errors.Is(err, auth.ErrTooManyAttempts):
+				problem.Error(w, r, "too many attempts, try again later", http.StatusTooManyRequests)
+			case errors.Is(err, auth.ErrNotSupported):
+				problem.Error(w, r, "MFA is not supported by the identity provider", http.StatusNotImplemented)
+			default:
+				logger.ErrorContext(r.Context(), "MFA respond failed", "error", err)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		resp := LoginResponse{
+			Message: "Login successful",
+			Tokens:  tokens,
+		}
+
+		encode(w, r, http.StatusOK, resp)
+	})
+}
+
+// NewPasswordRequest represents the request to answer a NEW_PASSWORD_REQUIRED challenge.
+type NewPasswordRequest struct {
+	Email       string `json:"email"`
+	Session     string `json:"session"`
+	NewPassword string `json:"new_password"`
+	// Attributes supplies the challenge's required_attributes, e.g. {"name": "Jane Doe"}.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Valid validates the new password request.
+func (r NewPasswordRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Email == "" {
+		problems["email"] = "email is required"
+	}
+	if r.Session == "" {
+		problems["session"] = "session is required"
+	}
+	if r.NewPassword == "" {
+		problems["new_password"] = "new password is required"
+	} else if problem := passwordPolicy(ctx).Check(r.NewPassword); problem != "" {
+		problems["new_password"] = problem
+	}
+
+	return problems
+}
+
+// HandleNewPassword completes a login that returned a NEW_PASSWORD_REQUIRED
+// challenge, as logins with an admin-issued temporary password do.
+//
+//	@Summary		Set new password
+//	@Description	Replace a temporary password with the session from POST /api/v1/auth/login. The new password must follow GET /api/v1/auth/password-policy. Returns tokens, or another challenge such as SMS_MFA.
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		NewPasswordRequest	true	"Challenge session and new password"
+//	@Success		200		{object}	LoginResponse
+//	@Failure		400		{object}	problem.Details
+//	@Failure		401		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
+//	@Router			/api/v1/auth/new-password [post]
+func HandleNewPassword(logger *slog.Logger, authService AuthService, events *audit.Log) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withPasswordPolicy(r, authService, logger)
+		req, problems, err := decodeValid[NewPasswordRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode new password request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
 				return
 			}
-			logger.Error("login failed", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		tokens, challenge, err := authService.RespondToNewPasswordRequired(r.Context(), req.Email, req.Session, req.NewPassword, req.Attributes)
+		if err != nil {
+			events.Record(r, audit.NewEvent(audit.EventLogin, req.Email, err))
+			switch {
+			case errors.Is(err, auth.ErrInvalidPassword):
+				problem.Error(w, r, "password does not meet the password policy", http.StatusBadRequest)
+			case errors.Is(err, auth.ErrInvalidAttribute):
+				problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, auth.ErrSessionExpired):
+				problem.Error(w, r, "session expired, log in again", http.StatusUnauthorized)
+			case errors.Is(err, auth.ErrNotSupported):
+				problem.Error(w, r, "new password challenges are not supported by the identity provider", http.StatusNotImplemented)
+			default:
+				logger.ErrorContext(r.Context(), "new password challenge failed", "error", err)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if challenge != nil {
+			events.Record(r, audit.Event{Type: audit.EventLogin, Email: req.Email, Outcome: audit.OutcomeChallenge, Reason: challenge.Name})
+			resp := LoginResponse{
+				Message:   "Additional verification required",
+				Challenge: challenge,
+			}
+			encode(w, r, http.StatusOK, resp)
 			return
 		}
 
+		events.Record(r, audit.NewEvent(audit.EventLogin, req.Email, nil))
 		resp := LoginResponse{
 			Message: "Login successful",
 			Tokens:  tokens,
@@ -261,6 +480,11 @@ func HandleLogin(logger *slog.Logger, authService AuthService) http.Handler {
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 	Email        string `json:"email"`
+	// Username replaces Email for federated users, who refresh with the
+	// username returned by federated sign-in.
+	Username string `json:"username,omitempty"`
+	// DeviceKey is required for tokens issued to a tracked device.
+	DeviceKey string `json:"device_key,omitempty"`
 }
 
 // Valid validates the refresh token request.
@@ -270,7 +494,7 @@ func (r RefreshTokenRequest) Valid(ctx context.Context) map[string]string {
 	if r.RefreshToken == "" {
 		problems["refresh_token"] = "refresh token is required"
 	}
-	if r.Email == "" {
+	if r.Email == "" && r.Username == "" {
 		problems["email"] = "email is required"
 	}
 
@@ -279,8 +503,8 @@ func (r RefreshTokenRequest) Valid(ctx context.Context) map[string]string {
 
 // RefreshTokenResponse represents the refresh token response.
 type RefreshTokenResponse struct {
-	Message string               `json:"message"`
-	Tokens  *auth.CognitoTokens `json:"tokens"`
+	Message string       `json:"message"`
+	Tokens  *auth.Tokens `json:"tokens"`
 }
 
 // HandleRefreshToken handles token refresh.
@@ -292,32 +516,33 @@ type RefreshTokenResponse struct {
 //	@Produce		json
 //	@Param			request	body		RefreshTokenRequest	true	"Refresh token request"
 //	@Success		200		{object}	RefreshTokenResponse
-//	@Failure		400		{object}	map[string]interface{}
-//	@Failure		401		{object}	map[string]interface{}
-//	@Failure		500		{object}	map[string]interface{}
+//	@Failure		400		{object}	problem.Details
+//	@Failure		401		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
 //	@Router			/api/v1/auth/refresh [post]
-func HandleRefreshToken(logger *slog.Logger, authService AuthService) http.Handler {
+func HandleRefreshToken(logger *slog.Logger, authService AuthService, events *audit.Log) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req, problems, err := decodeValid[RefreshTokenRequest](r)
 		if err != nil {
-			logger.Error("failed to decode refresh request", "error", err)
+			logger.ErrorContext(r.Context(), "failed to decode refresh request", "error", err)
 			if len(problems) > 0 {
-				encode(w, r, http.StatusBadRequest, map[string]interface{}{
-					"error":    "validation failed",
-					"problems": problems,
-				})
+				problem.Validation(w, r, problems)
 				return
 			}
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		tokens, err := authService.RefreshToken(r.Context(), req.RefreshToken, req.Email)
+		username := req.Email
+		if req.Username != "" {
+			username = req.Username
+		}
+
+		tokens, err := authService.RefreshToken(r.Context(), req.RefreshToken, username, req.DeviceKey)
+		events.Record(r, audit.NewEvent(audit.EventRefresh, username, err))
 		if err != nil {
-			logger.Error("token refresh failed", "error", err)
-			encode(w, r, http.StatusUnauthorized, map[string]interface{}{
-				"error": "invalid refresh token",
-			})
+			logger.ErrorContext(r.Context(), "token refresh failed", "error", err)
+			problem.Error(w, r, "invalid refresh token", http.StatusUnauthorized)
 			return
 		}
 
@@ -330,6 +555,75 @@ func HandleRefreshToken(logger *slog.Logger, authService AuthService) http.Handl
 	})
 }
 
+// RevokeTokenRequest represents the revoke token request.
+type RevokeTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Valid validates the revoke token request.
+func (r RevokeTokenRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.RefreshToken == "" {
+		problems["refresh_token"] = "refresh token is required"
+	}
+
+	return problems
+}
+
+// RevokeTokenResponse represents the revoke token response.
+type RevokeTokenResponse struct {
+	Message string `json:"message"`
+}
+
+// HandleRevokeToken handles refresh token revocation.
+//
+//	@Summary		Revoke refresh token
+//	@Description	Revoke a refresh token so it can't issue new tokens, without signing the user out of other devices. Access tokens already issued with it remain valid here until they expire.
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		RevokeTokenRequest	true	"Refresh token to revoke"
+//	@Success		200		{object}	RevokeTokenResponse
+//	@Failure		400		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
+//	@Failure		501		{object}	problem.Details	"Not supported by the identity provider"
+//	@Router			/api/v1/auth/revoke [post]
+func HandleRevokeToken(logger *slog.Logger, authService AuthService, events *audit.Log) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[RevokeTokenRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode revoke request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		err = authService.RevokeToken(r.Context(), req.RefreshToken)
+		events.Record(r, audit.NewEvent(audit.EventLogout, "", err))
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) {
+				problem.Error(w, r, "only refresh tokens can be revoked", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, auth.ErrNotSupported) {
+				problem.Error(w, r, "token revocation is not supported by the identity provider", http.StatusNotImplemented)
+				return
+			}
+			logger.ErrorContext(r.Context(), "token revocation failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		encode(w, r, http.StatusOK, RevokeTokenResponse{
+			Message: "Token revoked successfully",
+		})
+	})
+}
+
 // ForgotPasswordRequest represents the forgot password request.
 type ForgotPasswordRequest struct {
 	Email string `json:"email"`
@@ -360,28 +654,40 @@ type ForgotPasswordResponse struct {
 //	@Produce		json
 //	@Param			request	body		ForgotPasswordRequest	true	"Forgot password request"
 //	@Success		200		{object}	ForgotPasswordResponse
-//	@Failure		400		{object}	map[string]interface{}
-//	@Failure		500		{object}	map[string]interface{}
+//	@Failure		400		{object}	problem.Details
+//	@Failure		429		{object}	problem.Details	"Too many requests"
+//	@Failure		500		{object}	problem.Details
 //	@Router			/api/v1/auth/forgot-password [post]
-func HandleForgotPassword(logger *slog.Logger, authService AuthService) http.Handler {
+func HandleForgotPassword(logger *slog.Logger, authService AuthService, limiter *throttle.Limiter, events *audit.Log) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req, problems, err := decodeValid[ForgotPasswordRequest](r)
 		if err != nil {
-			logger.Error("failed to decode forgot password request", "error", err)
+			logger.ErrorContext(r.Context(), "failed to decode forgot password request", "error", err)
 			if len(problems) > 0 {
-				encode(w, r, http.StatusBadRequest, map[string]interface{}{
-					"error":    "validation failed",
-					"problems": problems,
-				})
+				problem.Validation(w, r, problems)
 				return
 			}
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
+		// Every request sends a code, so each one counts against the limit.
+		key := "forgot-password|" + throttle.Key(r, req.Email)
+		if retryAfter := limiter.Locked(key); retryAfter > 0 {
+			events.Record(r, audit.Event{Type: audit.EventForgotPassword, Email: req.Email, Outcome: audit.OutcomeFailure, Reason: "locked out"})
+			encodeTooManyAttempts(w, r, retryAfter)
+			return
+		}
+		limiter.Fail(key)
+
 		err = authService.ForgotPassword(r.Context(), req.Email)
+		events.Record(r, audit.NewEvent(audit.EventForgotPassword, req.Email, err))
 		if err != nil {
-			logger.Error("forgot password failed", "error", err)
+			if errors.Is(err, auth.ErrNotSupported) {
+				problem.Error(w, r, "password reset is not supported by the identity provider", http.StatusNotImplemented)
+				return
+			}
+			logger.ErrorContext(r.Context(), "forgot password failed", "error", err)
 			// Don't reveal if user exists or not
 		}
 
@@ -412,9 +718,8 @@ func (r ConfirmForgotPasswordRequest) Valid(ctx context.Context) map[string]stri
 	}
 	if r.NewPassword == "" {
 		problems["new_password"] = "new password is required"
-	}
-	if len(r.NewPassword) < 8 {
-		problems["new_password"] = "password must be at least 8 characters"
+	} else if problem := passwordPolicy(ctx).Check(r.NewPassword); problem != "" {
+		problems["new_password"] = problem
 	}
 
 	return problems
@@ -428,41 +733,42 @@ type ConfirmForgotPasswordResponse struct {
 // HandleConfirmForgotPassword handles password reset confirmation.
 //
 //	@Summary		Reset password
-//	@Description	Reset password with verification code
+//	@Description	Reset password with verification code. The new password must follow GET /api/v1/auth/password-policy.
 //	@Tags			auth
 //	@Accept			json
 //	@Produce		json
 //	@Param			request	body		ConfirmForgotPasswordRequest	true	"Reset password request"
 //	@Success		200		{object}	ConfirmForgotPasswordResponse
-//	@Failure		400		{object}	map[string]interface{}
-//	@Failure		500		{object}	map[string]interface{}
+//	@Failure		400		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
 //	@Router			/api/v1/auth/reset-password [post]
-func HandleConfirmForgotPassword(logger *slog.Logger, authService AuthService) http.Handler {
+func HandleConfirmForgotPassword(logger *slog.Logger, authService AuthService, events *audit.Log) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withPasswordPolicy(r, authService, logger)
 		req, problems, err := decodeValid[ConfirmForgotPasswordRequest](r)
 		if err != nil {
-			logger.Error("failed to decode reset password request", "error", err)
+			logger.ErrorContext(r.Context(), "failed to decode reset password request", "error", err)
 			if len(problems) > 0 {
-				encode(w, r, http.StatusBadRequest, map[string]interface{}{
-					"error":    "validation failed",
-					"problems": problems,
-				})
+				problem.Validation(w, r, problems)
 				return
 			}
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
 		err = authService.ConfirmForgotPassword(r.Context(), req.Email, req.Code, req.NewPassword)
+		events.Record(r, audit.NewEvent(audit.EventResetPassword, req.Email, err))
 		if err != nil {
 			if errors.Is(err, auth.ErrInvalidVerification) {
-				encode(w, r, http.StatusBadRequest, map[string]interface{}{
-					"error": "invalid or expired verification code",
-				})
+				problem.Error(w, r, "invalid or expired verification code", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, auth.ErrNotSupported) {
+				problem.Error(w, r, "password reset is not supported by the identity provider", http.StatusNotImplemented)
 				return
 			}
-			logger.Error("reset password failed", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "reset password failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
@@ -473,3 +779,107 @@ func HandleConfirmForgotPassword(logger *slog.Logger, authService AuthService) h
 		encode(w, r, http.StatusOK, resp)
 	})
 }
+
+// ChangePasswordRequest represents the change password request.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// Valid validates the change password request.
+func (r ChangePasswordRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.CurrentPassword == "" {
+		problems["current_password"] = "current password is required"
+	}
+	if r.NewPassword == "" {
+		problems["new_password"] = "new password is required"
+	} else if problem := passwordPolicy(ctx).Check(r.NewPassword); problem != "" {
+		problems["new_password"] = problem
+	}
+	if r.NewPassword != "" && r.NewPassword == r.CurrentPassword {
+		problems["new_password"] = "new password must differ from the current password"
+	}
+
+	return problems
+}
+
+// ChangePasswordResponse represents the change password response.
+type ChangePasswordResponse struct {
+	Message string `json:"message"`
+}
+
+// HandleChangePassword handles password changes for the signed-in user.
+//
+//	@Summary		Change password
+//	@Description	Change the signed-in user's password. Requires the current password; the new password must follow GET /api/v1/auth/password-policy.
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		ChangePasswordRequest	true	"Change password request"
+//	@Success		200		{object}	ChangePasswordResponse
+//	@Failure		400		{object}	problem.Details
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		429		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
+//	@Security		BearerAuth
+//	@Router			/api/v1/auth/change-password [post]
+func HandleChangePassword(logger *slog.Logger, authService AuthService, events *audit.Log) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, err := auth.GetAccessToken(r.Context())
+		if err != nil {
+			problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		r = withPasswordPolicy(r, authService, logger)
+		req, problems, err := decodeValid[ChangePasswordRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode change password request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		err = authService.ChangePassword(r.Context(), accessToken, req.CurrentPassword, req.NewPassword)
+		// Access tokens don't carry the email; the event has the user ID.
+		events.Record(r, audit.NewEvent(audit.EventChangePassword, "", err))
+		if err != nil {
+			if errors.Is(err, auth.ErrIncorrectPassword) {
+				problem.Error(w, r, "current password is incorrect", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, auth.ErrInvalidPassword) {
+				problem.Error(w, r, "new password does not meet the password policy", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, auth.ErrTooManyAttempts) {
+				problem.Error(w, r, "too many attempts, try again later", http.StatusTooManyRequests)
+				return
+			}
+			if errors.Is(err, auth.ErrNotSupported) {
+				problem.Error(w, r, "changing passwords is not supported by the identity provider", http.StatusNotImplemented)
+				return
+			}
+			logger.ErrorContext(r.Context(), "change password failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := ChangePasswordResponse{
+			Message: "Password changed successfully.",
+		}
+
+		encode(w, r, http.StatusOK, resp)
+	})
+}
+
+// encodeTooManyAttempts reports that the client is locked out for retryAfter.
+func encodeTooManyAttempts(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())))
+	problem.Error(w, r, "too many attempts, try again later", http.StatusTooManyRequests)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/audit"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// maxAuthEvents caps the number of auth events a single query returns.
+const maxAuthEvents = 500
+
+// ListAuthEventsResponse represents the list auth events response.
+type ListAuthEventsResponse struct {
+	Date   string        `json:"date" example:"2026-10-16"`
+	Events []audit.Event `json:"events"`
+	Count  int           `json:"count"`
+}
+
+// HandleListAuthEvents returns a handler that queries the authentication
+// audit log.
+//
+//	@Summary		List auth events
+//	@Description	Get one day's signups, logins, token refreshes, logouts, and password resets, newest first, optionally filtered.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			date	query		string	false	"UTC date, YYYY-MM-DD (default: today)"
+//	@Param			email	query		string	false	"Email the attempt was for"
+//	@Param			ip		query		string	false	"Client IP"
+//	@Param			type	query		string	false	"Event type"	Enums(signup, login, refresh, logout, forgot_password, reset_password, change_password)
+//	@Param			outcome	query		string	false	"Outcome"		Enums(success, failure, challenge)
+//	@Param			limit	query		int		false	"Maximum number of events to return (default 100, max 500)"
+//	@Success		200		{object}	ListAuthEventsResponse
+//	@Failure		400		{object}	problem.Details	"Invalid request"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Failure		503		{object}	problem.Details	"Auth audit log is not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/auth-events [get]
+func HandleListAuthEvents(logger *slog.Logger, events *audit.Log) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !events.Enabled() {
+			problem.Error(w, r, "Auth audit log is not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := audit.Filter{
+			Date:    time.Now().UTC(),
+			Email:   query.Get("email"),
+			IP:      query.Get("ip"),
+			Type:    audit.EventType(query.Get("type")),
+			Outcome: query.Get("outcome"),
+		}
+		if v := query.Get("date"); v != "" {
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				problem.Error(w, r, "date must be YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			filter.Date = t
+		}
+
+		limit := 100
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxAuthEvents {
+				problem.Error(w, r, "limit must be between 1 and 500", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		list, err := events.Query(r.Context(), filter, limit)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to query auth events", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, ListAuthEventsResponse{
+			Date:   filter.Date.Format(time.DateOnly),
+			Events: list,
+			Count:  len(list),
+		}); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
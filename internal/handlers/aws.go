@@ -1,21 +1,33 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/envelope"
+	"github.com/pmollerus23/go-aws-server/internal/events"
+	"github.com/pmollerus23/go-aws-server/internal/imaging"
+	"github.com/pmollerus23/go-aws-server/internal/live"
 	"github.com/pmollerus23/go-aws-server/internal/models"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/sandbox"
+	"github.com/pmollerus23/go-aws-server/internal/store"
 
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	// "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 // HandleS3ListBuckets returns a handler that lists all S3 buckets.
@@ -23,20 +35,33 @@ import (
 //	@Summary		List S3 buckets
 //	@Description	Get a list of all S3 buckets in the AWS account
 //	@Tags			aws
-//	@Produce		json
-//	@Success		200	{object}	map[string]interface{}	"buckets and count"
-//	@Failure		401	{string}	string					"Unauthorized"
-//	@Failure		500	{string}	string					"Failed to list S3 buckets"
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			region	query		string					false	"Only list buckets in this AWS region"
+//	@Success		200		{object}	map[string]interface{}	"buckets and count"
+//	@Failure		401		{object}	problem.Details			"Unauthorized"
+//	@Failure		451		{object}	ResidencyError			"Region blocked by the data residency policy"
+//	@Failure		500		{object}	problem.Details			"Failed to list S3 buckets"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/s3/buckets [get]
-func HandleS3ListBuckets(logger *slog.Logger, s3Client *s3.Client) http.Handler {
+func HandleS3ListBuckets(logger *slog.Logger, regions *awsclients.RegionPool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Info("listing S3 buckets")
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		s3Client := clients.S3
+
+		logger.InfoContext(r.Context(), "listing S3 buckets")
+
+		input := &s3.ListBucketsInput{}
+		if region := r.URL.Query().Get("region"); region != "" {
+			input.BucketRegion = aws.String(region)
+		}
 
-		result, err := s3Client.ListBuckets(context.TODO(), &s3.ListBucketsInput{})
+		result, err := s3Client.ListBuckets(r.Context(), input)
 		if err != nil {
-			logger.Error("failed to list S3 buckets", "error", err)
-			http.Error(w, "Failed to list S3 buckets", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to list S3 buckets", "error", err)
+			writeAWSError(w, r, err, "Failed to list S3 buckets")
 			return
 		}
 
@@ -49,14 +74,11 @@ func HandleS3ListBuckets(logger *slog.Logger, s3Client *s3.Client) http.Handler
 			})
 		}
 
-		response := map[string]interface{}{
-			"buckets": buckets,
-			"count":   len(buckets),
-		}
+		response := newListResponse("buckets", buckets, len(buckets))
 
 		if err := encode(w, r, http.StatusOK, response); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
@@ -67,31 +89,93 @@ func HandleS3ListBuckets(logger *slog.Logger, s3Client *s3.Client) http.Handler
 //	@Summary		List DynamoDB tables
 //	@Description	Get a list of all DynamoDB tables in the AWS account
 //	@Tags			aws
-//	@Produce		json
-//	@Success		200	{object}	map[string]interface{}	"tables and count"
-//	@Failure		401	{string}	string					"Unauthorized"
-//	@Failure		500	{string}	string					"Failed to list DynamoDB tables"
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			region	query		string					false	"AWS region to list tables in (default: the server's)"
+//	@Success		200		{object}	map[string]interface{}	"tables and count"
+//	@Failure		401		{object}	problem.Details			"Unauthorized"
+//	@Failure		451		{object}	ResidencyError			"Region blocked by the data residency policy"
+//	@Failure		500		{object}	problem.Details			"Failed to list DynamoDB tables"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/dynamodb/tables [get]
-func HandleDynamoDBListTables(logger *slog.Logger, dynamoDBClient *dynamodb.Client) http.Handler {
+func HandleDynamoDBListTables(logger *slog.Logger, regions *awsclients.RegionPool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Info("listing DynamoDB tables")
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		dynamoDBClient := clients.DynamoDB
+
+		logger.InfoContext(r.Context(), "listing DynamoDB tables")
 
-		result, err := dynamoDBClient.ListTables(context.TODO(), &dynamodb.ListTablesInput{})
+		result, err := dynamoDBClient.ListTables(r.Context(), &dynamodb.ListTablesInput{})
 		if err != nil {
-			logger.Error("failed to list DynamoDB tables", "error", err)
-			http.Error(w, "Failed to list DynamoDB tables", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to list DynamoDB tables", "error", err)
+			writeAWSError(w, r, err, "Failed to list DynamoDB tables")
 			return
 		}
 
-		response := map[string]interface{}{
-			"tables": result.TableNames,
-			"count":  len(result.TableNames),
+		response := newListResponse("tables", result.TableNames, len(result.TableNames))
+
+		if err := encode(w, r, http.StatusOK, response); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleDynamoDBListTablesV2 returns a handler that lists DynamoDB tables a
+// page at a time.
+//
+//	@Summary		List DynamoDB tables
+//	@Description	Get a page of the DynamoDB tables in the AWS account. Pass the response's nextToken to get the next page.
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			limit		query		int				false	"Tables per page (1-100)"	default(100)
+//	@Param			nextToken	query		string			false	"Token from the previous page"
+//	@Param			region		query		string			false	"AWS region to list tables in (default: the server's)"
+//	@Success		200			{object}	pageResponse	"items, count, and nextToken"
+//	@Failure		400			{object}	problem.Details	"Invalid query parameter"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		451			{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500			{object}	problem.Details	"Failed to list DynamoDB tables"
+//	@Security		BearerAuth
+//	@Router			/api/v2/aws/dynamodb/tables [get]
+func HandleDynamoDBListTablesV2(logger *slog.Logger, regions *awsclients.RegionPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		dynamoDBClient := clients.DynamoDB
+
+		p, err := parsePage(r)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// DynamoDB returns at most 100 tables per call
+		if p.limit > 100 {
+			problem.Error(w, r, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+
+		input := &dynamodb.ListTablesInput{Limit: aws.Int32(int32(p.limit))}
+		if p.token != "" {
+			input.ExclusiveStartTableName = aws.String(p.token)
+		}
+		result, err := dynamoDBClient.ListTables(r.Context(), input)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to list DynamoDB tables", "error", err)
+			writeAWSError(w, r, err, "Failed to list DynamoDB tables")
+			return
 		}
 
+		response := newPageResponse(w, r, result.TableNames, len(result.TableNames), aws.ToString(result.LastEvaluatedTableName))
+
 		if err := encode(w, r, http.StatusOK, response); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
@@ -100,48 +184,165 @@ func HandleDynamoDBListTables(logger *slog.Logger, dynamoDBClient *dynamodb.Clie
 // HandleDynamoDBListRecords returns a handler that lists all records from a DynamoDB table.
 //
 //	@Summary		List DynamoDB records
-//	@Description	Get a list of all records from a DynamoDB table
+//	@Description	Get a list of all records from a DynamoDB table. Use fields to return only the listed top-level attributes.
 //	@Tags			aws
-//	@Produce		json
-//	@Success		200	{object}	map[string]interface{}	"records and count"
-//	@Failure		401	{string}	string					"Unauthorized"
-//	@Failure		500	{string}	string					"Failed to list records"
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			fields		query		string					false	"Comma-separated attributes to return (e.g. id,name)"
+//	@Param			consistent	query		bool					false	"Use strongly consistent reads"
+//	@Param			filter		query		[]string				false	"Filters as field:op:value (ops: eq, ne, lt, le, gt, ge, begins_with, contains)"	collectionFormat(multi)
+//	@Success		200			{object}	map[string]interface{}	"records and count"
+//	@Failure		400			{object}	problem.Details			"Invalid query parameter"
+//	@Failure		401			{object}	problem.Details			"Unauthorized"
+//	@Failure		500			{object}	problem.Details			"Failed to list records"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/dynamodb/records [get]
-func HandleDynamoDBListRecords(logger *slog.Logger, dynamoDBClient *dynamodb.Client) http.Handler {
+func HandleDynamoDBListRecords(logger *slog.Logger, records store.Repository[models.DynamoDBRecord]) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Info("Listing records from DynamoDB table")
+		logger.InfoContext(r.Context(), "Listing records from DynamoDB table")
 
-		tableName := "Phil_Go_App_Database"
-		result, err := dynamoDBClient.Scan(context.TODO(), &dynamodb.ScanInput{
-			TableName: aws.String(tableName),
-		})
+		opts, err := readOptions(r)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		filters, err := parseFilters(r.URL.Query()["filter"])
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := records.Query(r.Context(), store.Query{ReadOptions: opts, Filters: filters})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "Failed to query records", "error", err)
+			writeAWSError(w, r, err, "Failed to list records")
+			return
+		}
+
+		logger.InfoContext(r.Context(), "Successfully retrieved records", "count", len(result))
+
+		// A projected record only carries the requested attributes, so return
+		// it as a plain map instead of zero-filling the rest of the model.
+		var body interface{} = result
+		if len(opts.Fields) > 0 {
+			body, err = selectFields(result, opts.Fields)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "Failed to project records", "error", err)
+				problem.Error(w, r, "Failed to process records", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		response := newListResponse("records", body, len(result))
+
+		if err := encode(w, r, http.StatusOK, response); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
 
+// HandleDynamoDBCountRecords returns a handler that counts records in a DynamoDB table.
+//
+//	@Summary		Count DynamoDB records
+//	@Description	Count the records matching the filters without transferring them. Uses a Select=COUNT scan.
+//	@Tags			aws
+//	@Produce		json
+//	@Param			filter		query		[]string				false	"Filters as field:op:value (ops: eq, ne, lt, le, gt, ge, begins_with, contains)"	collectionFormat(multi)
+//	@Param			consistent	query		bool					false	"Use strongly consistent reads"
+//	@Success		200			{object}	map[string]interface{}	"count"
+//	@Failure		400			{object}	problem.Details			"Invalid query parameter"
+//	@Failure		401			{object}	problem.Details			"Unauthorized"
+//	@Failure		500			{object}	problem.Details			"Failed to count records"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/dynamodb/records/count [get]
+func HandleDynamoDBCountRecords(logger *slog.Logger, records store.Repository[models.DynamoDBRecord]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opts, err := readOptions(r)
 		if err != nil {
-			logger.Error("Failed to scan DynamoDB table", "error", err, "table", tableName)
-			http.Error(w, "Failed to list records", http.StatusInternalServerError)
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		// Unmarshal the items into our model
-		var records []models.DynamoDBRecord
-		err = attributevalue.UnmarshalListOfMaps(result.Items, &records)
+		filters, err := parseFilters(r.URL.Query()["filter"])
 		if err != nil {
-			logger.Error("Failed to unmarshal DynamoDB items", "error", err)
-			http.Error(w, "Failed to process records", http.StatusInternalServerError)
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		logger.Info("Successfully retrieved records", "count", len(records))
+		count, err := records.Count(r.Context(), store.Query{ReadOptions: opts, Filters: filters})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to count records", "error", err)
+			writeAWSError(w, r, err, "Failed to count records")
+			return
+		}
 
 		response := map[string]interface{}{
-			"records": records,
-			"count":   len(records),
+			"count": count,
 		}
 
 		if err := encode(w, r, http.StatusOK, response); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleDynamoDBGetRecord returns a handler that retrieves a single record from a DynamoDB table.
+//
+//	@Summary		Get DynamoDB record
+//	@Description	Get a single record by ID. Use consistent=true for read-after-write guarantees.
+//	@Tags			aws
+//	@Produce		json
+//	@Param			id			path		string	true	"Record ID"
+//	@Param			fields		query		string	false	"Comma-separated attributes to return (e.g. id,name)"
+//	@Param			consistent	query		bool	false	"Use a strongly consistent read"
+//	@Success		200			{object}	models.DynamoDBRecord
+//	@Failure		400			{object}	problem.Details	"Invalid query parameter"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		404			{object}	problem.Details	"Record not found"
+//	@Failure		500			{object}	problem.Details	"Failed to get record"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/dynamodb/records/{id} [get]
+func HandleDynamoDBGetRecord(logger *slog.Logger, records store.Repository[models.DynamoDBRecord]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		opts, err := readOptions(r)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "getting record from DynamoDB table", "id", id, "consistent", opts.ConsistentRead)
+
+		record, err := records.Get(r.Context(), id, opts)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				problem.Error(w, r, "Record not found", http.StatusNotFound)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to get record", "error", err, "id", id)
+			writeAWSError(w, r, err, "Failed to get record")
+			return
+		}
+
+		var body interface{} = record
+		if len(opts.Fields) > 0 {
+			selected, err := selectFields([]models.DynamoDBRecord{record}, opts.Fields)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to project record", "error", err)
+				problem.Error(w, r, "Failed to process record", http.StatusInternalServerError)
+				return
+			}
+			body = selected[0]
+		}
+
+		if err := encode(w, r, http.StatusOK, body); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
@@ -150,84 +351,108 @@ func HandleDynamoDBListRecords(logger *slog.Logger, dynamoDBClient *dynamodb.Cli
 // HandleDynamoDBUpsertTable returns a handler that inserts or updates a record in a DynamoDB table.
 //
 //	@Summary		Upsert DynamoDB record
-//	@Description	Insert or update a record in a DynamoDB table
+//	@Description	Insert or update a record in a DynamoDB table. A ULID is generated when id is omitted; created_at and updated_at are set by the server. In sandbox mode the id is prefixed and expires_at is set.
 //	@Tags			aws
 //	@Accept			json
 //	@Produce		json
-//	@Param			record	body		models.DynamoDBRecord		true	"Record to upsert"
-//	@Success		201		{object}	map[string]interface{}		"result metadata"
-//	@Failure		400		{string}	string						"Invalid request body"
-//	@Failure		401		{string}	string						"Unauthorized"
-//	@Failure		500		{string}	string						"Failed to upsert record"
+//	@Param			record	body		models.DynamoDBRecord	true	"Record to upsert"
+//	@Success		201		{object}	models.DynamoDBRecord	"The stored record"
+//	@Failure		400		{object}	problem.Details			"Invalid request body"
+//	@Failure		401		{object}	problem.Details			"Unauthorized"
+//	@Failure		500		{object}	problem.Details			"Failed to upsert record"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/dynamodb/tables [post]
-func HandleDynamoDBUpsertTable(logger *slog.Logger, dynamoDBClient *dynamodb.Client) http.Handler {
+func HandleDynamoDBUpsertTable(logger *slog.Logger, records store.Repository[models.DynamoDBRecord], sb *sandbox.Sandbox) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger.Info("Upserting record into DynamoDB table")
+		logger.InfoContext(r.Context(), "Upserting record into DynamoDB table")
 
 		// Decode the JSON payload from the request body
 		var record models.DynamoDBRecord
 		if err := decode(r, &record); err != nil {
-			logger.Error("Failed to decode request body", "error", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			logger.ErrorContext(r.Context(), "Failed to decode request body", "error", err)
+			problem.Error(w, r, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
-		logger.Info("Decoded record", "id", record.ID, "name", record.Name, "updated_at", record.UpdatedAt)
-
-		item, err := attributevalue.MarshalMap(record)
-		if err != nil {
-			logger.Error("Failed to marshal user request record into DynamoDB object", "error", err)
-			http.Error(w, "Failed to marshal user request record into DynamoDB object", http.StatusInternalServerError)
-			return
+		now := time.Now()
+		record.CreatedAt = now.Unix()
+		record.UpdatedAt = now.Unix()
+		record.ExpiresAt = 0
+		if sb != nil {
+			record.ExpiresAt = sb.ExpiresAt(now).Unix()
 		}
 
-		logger.Info("Marshaled item", "item", item)
+		if record.ID == "" {
+			record.ID = sb.Name(store.NewULID())
+		} else {
+			record.ID = sb.Name(record.ID)
 
-		tableName := "Phil_Go_App_Database"
-		logger.Info("Putting item to DynamoDB", "table", tableName)
+			// Keep the original creation time when replacing an existing record.
+			existing, err := records.Get(r.Context(), record.ID, store.ReadOptions{
+				Fields:         []string{"created_at"},
+				ConsistentRead: true,
+			})
+			switch {
+			case err == nil && existing.CreatedAt != 0:
+				record.CreatedAt = existing.CreatedAt
+			case err != nil && !errors.Is(err, store.ErrNotFound):
+				logger.ErrorContext(r.Context(), "Failed to get existing record", "error", err, "id", record.ID)
+				writeAWSError(w, r, err, "Failed to upsert record")
+				return
+			}
+		}
 
-		result, err := dynamoDBClient.PutItem(context.TODO(), &dynamodb.PutItemInput{
-			TableName: aws.String(tableName),
-			Item:      item,
-		})
+		logger.InfoContext(r.Context(), "Decoded record", "id", record.ID, "name", record.Name)
 
-		if err != nil {
-			logger.Error("Failed to put record in DynamoDB", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if err := records.Put(r.Context(), record); err != nil {
+			logger.ErrorContext(r.Context(), "Failed to put record in DynamoDB", "error", err)
+			writeAWSError(w, r, err, "Failed to upsert record")
 			return
 		}
 
-		logger.Info("Successfully put item to DynamoDB", "result", result)
+		logger.InfoContext(r.Context(), "Successfully put item to DynamoDB", "id", record.ID)
 
-		response := map[string]interface{}{
-			"result_attributes": result.Attributes,
-			"success":           true,
-		}
-
-		if err := encode(w, r, int(http.StatusCreated), response); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if err := encode(w, r, int(http.StatusCreated), record); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
 }
 
+// ResidencyError is the problem returned when the data residency policy
+// blocks a region.
+type ResidencyError struct {
+	problem.Details
+	Region string                     `json:"region" example:"us-east-1"`
+	Policy config.DataResidencyPolicy `json:"policy"`
+}
+
+// writeResidencyError writes the 451 response for a region policy blocks.
+func writeResidencyError(w http.ResponseWriter, r *http.Request, region string, policy config.DataResidencyPolicy) {
+	problem.Write(w, http.StatusUnavailableForLegalReasons, ResidencyError{
+		Details: problem.New(r, http.StatusUnavailableForLegalReasons, "region not allowed by data residency policy"),
+		Region:  region,
+		Policy:  policy,
+	})
+}
+
 // HandleS3CreateBucket creates a new S3 bucket.
 //
 //	@Summary		Create S3 bucket
-//	@Description	Create a new S3 bucket
+//	@Description	Create a new S3 bucket. In sandbox mode the name is prefixed and the bucket is tagged to expire.
 //	@Tags			aws
 //	@Accept			json
 //	@Produce		json
-//	@Param			request	body		map[string]string	true	"Bucket name"
+//	@Param			request	body		map[string]string	true	"Bucket name and region (default us-east-1)"
 //	@Success		201		{object}	map[string]interface{}
-//	@Failure		400		{string}	string	"Invalid request"
-//	@Failure		401		{string}	string	"Unauthorized"
-//	@Failure		500		{string}	string	"Failed to create bucket"
+//	@Failure		400		{object}	problem.Details	"Invalid request or region"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		451		{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500		{object}	problem.Details	"Failed to create bucket"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/s3/buckets [post]
-func HandleS3CreateBucket(logger *slog.Logger, s3Client *s3.Client) http.Handler {
+func HandleS3CreateBucket(logger *slog.Logger, regions *awsclients.RegionPool, sb *sandbox.Sandbox) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			BucketName string `json:"bucketName"`
@@ -235,17 +460,41 @@ func HandleS3CreateBucket(logger *slog.Logger, s3Client *s3.Client) http.Handler
 		}
 
 		if err := decode(r, &req); err != nil {
-			logger.Error("failed to decode request", "error", err)
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			logger.ErrorContext(r.Context(), "failed to decode request", "error", err)
+			problem.Error(w, r, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
 		if req.BucketName == "" {
-			http.Error(w, "Bucket name is required", http.StatusBadRequest)
+			problem.Error(w, r, "Bucket name is required", http.StatusBadRequest)
+			return
+		}
+		req.BucketName = sb.Name(req.BucketName)
+
+		// Buckets created without a location constraint land in us-east-1
+		region := req.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		// Send the request to the bucket's region, or S3 redirects it
+		clients, err := regions.Get(region)
+		if errors.Is(err, awsclients.ErrRegionNotAllowed) {
+			logger.WarnContext(r.Context(), "bucket creation blocked by data residency policy",
+				"bucket", req.BucketName,
+				"region", region,
+				"policy", regions.Residency().Name,
+			)
+			writeResidencyError(w, r, region, regions.Residency())
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, "region must be an AWS region, such as us-east-1", http.StatusBadRequest)
 			return
 		}
+		s3Client := clients.S3
 
-		logger.Info("creating S3 bucket", "bucket", req.BucketName, "region", req.Region)
+		logger.InfoContext(r.Context(), "creating S3 bucket", "bucket", req.BucketName, "region", req.Region)
 
 		input := &s3.CreateBucketInput{
 			Bucket: aws.String(req.BucketName),
@@ -258,11 +507,34 @@ func HandleS3CreateBucket(logger *slog.Logger, s3Client *s3.Client) http.Handler
 			}
 		}
 
-		_, err := s3Client.CreateBucket(context.TODO(), input)
+		_, err = s3Client.CreateBucket(r.Context(), input)
 		if err != nil {
-			logger.Error("failed to create S3 bucket", "error", err)
-			http.Error(w, fmt.Sprintf("Failed to create bucket: %v", err), http.StatusInternalServerError)
-			return
+			logger.ErrorContext(r.Context(), "failed to create S3 bucket", "error", err)
+			writeAWSError(w, r, err, "Failed to create bucket")
+			return
+		}
+
+		if sb != nil {
+			// The bucket exists now, so tag it, or delete it, even if the
+			// client goes away
+			ctx := context.WithoutCancel(r.Context())
+			expiresAt := sb.ExpiresAt(time.Now())
+			_, err := s3Client.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+				Bucket: aws.String(req.BucketName),
+				Tagging: &types.Tagging{TagSet: []types.Tag{{
+					Key:   aws.String(sandbox.ExpiresTag),
+					Value: aws.String(expiresAt.Format(time.RFC3339)),
+				}}},
+			})
+			if err != nil {
+				// An untagged bucket would never be cleaned up, so don't keep it.
+				logger.ErrorContext(r.Context(), "failed to tag sandbox bucket", "error", err, "bucket", req.BucketName)
+				if _, err := s3Client.DeleteBucket(ctx, &s3.DeleteBucketInput{Bucket: aws.String(req.BucketName)}); err != nil {
+					logger.ErrorContext(r.Context(), "failed to delete untagged sandbox bucket", "error", err, "bucket", req.BucketName)
+				}
+				writeAWSError(w, r, err, "Failed to create bucket")
+				return
+			}
 		}
 
 		response := map[string]interface{}{
@@ -271,8 +543,8 @@ func HandleS3CreateBucket(logger *slog.Logger, s3Client *s3.Client) http.Handler
 		}
 
 		if err := encode(w, r, http.StatusCreated, response); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
@@ -285,29 +557,37 @@ func HandleS3CreateBucket(logger *slog.Logger, s3Client *s3.Client) http.Handler
 //	@Tags			aws
 //	@Produce		json
 //	@Param			bucketName	path		string	true	"Bucket name"
+//	@Param			region		query		string	false	"AWS region of the bucket (default: the server's)"
 //	@Success		200			{object}	map[string]interface{}
-//	@Failure		400			{string}	string	"Invalid request"
-//	@Failure		401			{string}	string	"Unauthorized"
-//	@Failure		500			{string}	string	"Failed to delete bucket"
+//	@Failure		400			{object}	problem.Details	"Invalid request"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		451			{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500			{object}	problem.Details	"Failed to delete bucket"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/s3/buckets/{bucketName} [delete]
-func HandleS3DeleteBucket(logger *slog.Logger, s3Client *s3.Client) http.Handler {
+func HandleS3DeleteBucket(logger *slog.Logger, regions *awsclients.RegionPool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		s3Client := clients.S3
+
 		bucketName := r.PathValue("bucketName")
 		if bucketName == "" {
-			http.Error(w, "Bucket name is required", http.StatusBadRequest)
+			problem.Error(w, r, "Bucket name is required", http.StatusBadRequest)
 			return
 		}
 
-		logger.Info("deleting S3 bucket", "bucket", bucketName)
+		logger.InfoContext(r.Context(), "deleting S3 bucket", "bucket", bucketName)
 
-		_, err := s3Client.DeleteBucket(context.TODO(), &s3.DeleteBucketInput{
+		_, err := s3Client.DeleteBucket(r.Context(), &s3.DeleteBucketInput{
 			Bucket: aws.String(bucketName),
 		})
 
 		if err != nil {
-			logger.Error("failed to delete S3 bucket", "error", err)
-			http.Error(w, fmt.Sprintf("Failed to delete bucket: %v", err), http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to delete S3 bucket", "error", err)
+			writeAWSError(w, r, err, "Failed to delete bucket")
 			return
 		}
 
@@ -317,8 +597,8 @@ func HandleS3DeleteBucket(logger *slog.Logger, s3Client *s3.Client) http.Handler
 		}
 
 		if err := encode(w, r, http.StatusOK, response); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
@@ -329,31 +609,39 @@ func HandleS3DeleteBucket(logger *slog.Logger, s3Client *s3.Client) http.Handler
 //	@Summary		List objects in S3 bucket
 //	@Description	Get a list of all objects in an S3 bucket
 //	@Tags			aws
-//	@Produce		json
+//	@Produce		json,application/x-ndjson,text/csv
 //	@Param			bucketName	path		string	true	"Bucket name"
+//	@Param			region		query		string	false	"AWS region of the bucket (default: the server's)"
 //	@Success		200			{object}	map[string]interface{}
-//	@Failure		400			{string}	string	"Invalid request"
-//	@Failure		401			{string}	string	"Unauthorized"
-//	@Failure		500			{string}	string	"Failed to list objects"
+//	@Failure		400			{object}	problem.Details	"Invalid request"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		451			{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500			{object}	problem.Details	"Failed to list objects"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/s3/buckets/{bucketName}/objects [get]
-func HandleS3ListObjects(logger *slog.Logger, s3Client *s3.Client) http.Handler {
+func HandleS3ListObjects(logger *slog.Logger, regions *awsclients.RegionPool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		s3Client := clients.S3
+
 		bucketName := r.PathValue("bucketName")
 		if bucketName == "" {
-			http.Error(w, "Bucket name is required", http.StatusBadRequest)
+			problem.Error(w, r, "Bucket name is required", http.StatusBadRequest)
 			return
 		}
 
-		logger.Info("listing objects in S3 bucket", "bucket", bucketName)
+		logger.InfoContext(r.Context(), "listing objects in S3 bucket", "bucket", bucketName)
 
-		result, err := s3Client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
+		result, err := s3Client.ListObjectsV2(r.Context(), &s3.ListObjectsV2Input{
 			Bucket: aws.String(bucketName),
 		})
 
 		if err != nil {
-			logger.Error("failed to list objects", "error", err)
-			http.Error(w, fmt.Sprintf("Failed to list objects: %v", err), http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to list objects", "error", err)
+			writeAWSError(w, r, err, "Failed to list objects")
 			return
 		}
 
@@ -366,14 +654,80 @@ func HandleS3ListObjects(logger *slog.Logger, s3Client *s3.Client) http.Handler
 			})
 		}
 
-		response := map[string]interface{}{
-			"objects": objects,
-			"count":   len(objects),
+		response := newListResponse("objects", objects, len(objects))
+
+		if err := encode(w, r, http.StatusOK, response); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
+	})
+}
+
+// HandleS3ListObjectsV2 lists objects in an S3 bucket a page at a time.
+//
+//	@Summary		List objects in S3 bucket
+//	@Description	Get a page of the objects in an S3 bucket, in key order. Pass the response's nextToken to get the next page.
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			bucketName	path		string			true	"Bucket name"
+//	@Param			prefix		query		string			false	"Only list keys starting with prefix"
+//	@Param			limit		query		int				false	"Objects per page (1-1000)"	default(100)
+//	@Param			nextToken	query		string			false	"Token from the previous page"
+//	@Param			region		query		string			false	"AWS region of the bucket (default: the server's)"
+//	@Success		200			{object}	pageResponse	"items, count, and nextToken"
+//	@Failure		400			{object}	problem.Details	"Invalid request"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		451			{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500			{object}	problem.Details	"Failed to list objects"
+//	@Security		BearerAuth
+//	@Router			/api/v2/aws/s3/buckets/{bucketName}/objects [get]
+func HandleS3ListObjectsV2(logger *slog.Logger, regions *awsclients.RegionPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		s3Client := clients.S3
+
+		bucketName := r.PathValue("bucketName")
+		p, err := parsePage(r)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		input := &s3.ListObjectsV2Input{
+			Bucket:  aws.String(bucketName),
+			MaxKeys: aws.Int32(int32(p.limit)),
+		}
+		if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+			input.Prefix = aws.String(prefix)
+		}
+		if p.token != "" {
+			input.ContinuationToken = aws.String(p.token)
+		}
+		result, err := s3Client.ListObjectsV2(r.Context(), input)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to list objects", "error", err, "bucket", bucketName)
+			writeAWSError(w, r, err, "Failed to list objects")
+			return
+		}
+
+		objects := make([]map[string]interface{}, 0, len(result.Contents))
+		for _, obj := range result.Contents {
+			objects = append(objects, map[string]interface{}{
+				"key":          aws.ToString(obj.Key),
+				"size":         aws.ToInt64(obj.Size),
+				"lastModified": obj.LastModified,
+			})
+		}
+
+		response := newPageResponse(w, r, objects, len(objects), aws.ToString(result.NextContinuationToken))
 
 		if err := encode(w, r, http.StatusOK, response); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
@@ -382,37 +736,47 @@ func HandleS3ListObjects(logger *slog.Logger, s3Client *s3.Client) http.Handler
 // HandleS3UploadObject uploads an object to S3.
 //
 //	@Summary		Upload object to S3
-//	@Description	Upload a file to an S3 bucket
+//	@Description	Upload a file to an S3 bucket. JPEG and PNG images are analyzed with Rekognition in the background when IMAGE_ANALYSIS_ON_UPLOAD is set. With encrypt=true, the file is encrypted with a KMS data key before it is stored, so reading it takes access to the server's KMS key as well as the bucket; downloads through the API decrypt it.
 //	@Tags			aws
 //	@Accept			multipart/form-data
 //	@Produce		json
 //	@Param			bucketName	path		string	true	"Bucket name"
 //	@Param			file		formData	file	true	"File to upload"
+//	@Param			key			formData	string	false	"Object key (defaults to the file name)"
+//	@Param			encrypt		formData	boolean	false	"Envelope-encrypt the file with the server's KMS key"
+//	@Param			region		query		string	false	"AWS region of the bucket (default: the server's)"
 //	@Success		201			{object}	map[string]interface{}
-//	@Failure		400			{string}	string	"Invalid request"
-//	@Failure		401			{string}	string	"Unauthorized"
-//	@Failure		500			{string}	string	"Failed to upload file"
+//	@Failure		400			{object}	problem.Details	"Invalid request"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		451			{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500			{object}	problem.Details	"Failed to upload file"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/s3/buckets/{bucketName}/objects [post]
-func HandleS3UploadObject(logger *slog.Logger, s3Client *s3.Client) http.Handler {
+func HandleS3UploadObject(logger *slog.Logger, regions *awsclients.RegionPool, kmsClient *kms.Client, kmsKeyID string, images *imaging.Analyzer, hub *live.Hub, bus *events.Publisher) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		s3Client := clients.S3
+
 		bucketName := r.PathValue("bucketName")
 		if bucketName == "" {
-			http.Error(w, "Bucket name is required", http.StatusBadRequest)
+			problem.Error(w, r, "Bucket name is required", http.StatusBadRequest)
 			return
 		}
 
 		// Parse multipart form (32MB max)
 		if err := r.ParseMultipartForm(32 << 20); err != nil {
-			logger.Error("failed to parse multipart form", "error", err)
-			http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+			logger.ErrorContext(r.Context(), "failed to parse multipart form", "error", err)
+			problem.Error(w, r, "Failed to parse form data", http.StatusBadRequest)
 			return
 		}
 
 		file, header, err := r.FormFile("file")
 		if err != nil {
-			logger.Error("failed to get file from form", "error", err)
-			http.Error(w, "File is required", http.StatusBadRequest)
+			logger.ErrorContext(r.Context(), "failed to get file from form", "error", err)
+			problem.Error(w, r, "File is required", http.StatusBadRequest)
 			return
 		}
 		defer file.Close()
@@ -423,29 +787,69 @@ func HandleS3UploadObject(logger *slog.Logger, s3Client *s3.Client) http.Handler
 			key = header.Filename
 		}
 
-		logger.Info("uploading file to S3", "bucket", bucketName, "key", key, "size", header.Size)
+		encrypt, _ := strconv.ParseBool(r.FormValue("encrypt"))
+		if encrypt && kmsKeyID == "" {
+			problem.Error(w, r, "Encrypted uploads are not enabled: no KMS key is configured", http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "uploading file to S3", "bucket", bucketName, "key", key, "size", header.Size, "encrypted", encrypt)
 
-		_, err = s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+		input := &s3.PutObjectInput{
 			Bucket: aws.String(bucketName),
 			Key:    aws.String(key),
 			Body:   file,
-		})
+		}
+		if encrypt {
+			plaintext, err := io.ReadAll(file)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to read uploaded file", "error", err)
+				problem.Error(w, r, "Failed to read file", http.StatusBadRequest)
+				return
+			}
+			sealed, metadata, err := envelope.Seal(r.Context(), kmsClient, kmsKeyID, map[string]string{"bucket": bucketName, "key": key}, plaintext)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to encrypt upload", "error", err)
+				writeAWSError(w, r, err, "Failed to encrypt file")
+				return
+			}
+			input.Body = bytes.NewReader(sealed)
+			input.Metadata = metadata
+		}
+
+		_, err = s3Client.PutObject(r.Context(), input)
 
 		if err != nil {
-			logger.Error("failed to upload object", "error", err)
-			http.Error(w, fmt.Sprintf("Failed to upload file: %v", err), http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to upload object", "error", err)
+			writeAWSError(w, r, err, "Failed to upload file")
 			return
 		}
+		if !encrypt && clients.Region == regions.Home().Region {
+			// Rekognition can't read encrypted images, or buckets in
+			// other regions
+			images.AnalyzeUpload(r.Context(), bucketName, key)
+		}
+		hub.Publish(live.TopicS3, "uploaded", map[string]interface{}{
+			"bucket": bucketName,
+			"key":    key,
+			"size":   header.Size,
+		})
+		bus.Publish(r.Context(), events.TypeObjectUploaded, map[string]interface{}{
+			"bucket": bucketName,
+			"key":    key,
+			"size":   header.Size,
+		})
 
 		response := map[string]interface{}{
-			"success": true,
-			"key":     key,
-			"bucket":  bucketName,
+			"success":   true,
+			"key":       key,
+			"bucket":    bucketName,
+			"encrypted": encrypt,
 		}
 
 		if err := encode(w, r, http.StatusCreated, response); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
@@ -459,35 +863,43 @@ func HandleS3UploadObject(logger *slog.Logger, s3Client *s3.Client) http.Handler
 //	@Produce		json
 //	@Param			bucketName	path		string	true	"Bucket name"
 //	@Param			key			path		string	true	"Object key"
+//	@Param			region		query		string	false	"AWS region of the bucket (default: the server's)"
 //	@Success		200			{object}	map[string]interface{}
-//	@Failure		400			{string}	string	"Invalid request"
-//	@Failure		401			{string}	string	"Unauthorized"
-//	@Failure		500			{string}	string	"Failed to delete object"
+//	@Failure		400			{object}	problem.Details	"Invalid request"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		451			{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500			{object}	problem.Details	"Failed to delete object"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/s3/buckets/{bucketName}/objects/{key} [delete]
-func HandleS3DeleteObject(logger *slog.Logger, s3Client *s3.Client) http.Handler {
+func HandleS3DeleteObject(logger *slog.Logger, regions *awsclients.RegionPool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		s3Client := clients.S3
+
 		bucketName := r.PathValue("bucketName")
 		key := r.PathValue("key")
 
 		if bucketName == "" || key == "" {
-			http.Error(w, "Bucket name and key are required", http.StatusBadRequest)
+			problem.Error(w, r, "Bucket name and key are required", http.StatusBadRequest)
 			return
 		}
 
 		// Decode URL-encoded key
 		key = strings.ReplaceAll(key, "%2F", "/")
 
-		logger.Info("deleting object from S3", "bucket", bucketName, "key", key)
+		logger.InfoContext(r.Context(), "deleting object from S3", "bucket", bucketName, "key", key)
 
-		_, err := s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		_, err := s3Client.DeleteObject(r.Context(), &s3.DeleteObjectInput{
 			Bucket: aws.String(bucketName),
 			Key:    aws.String(key),
 		})
 
 		if err != nil {
-			logger.Error("failed to delete object", "error", err)
-			http.Error(w, fmt.Sprintf("Failed to delete object: %v", err), http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to delete object", "error", err)
+			writeAWSError(w, r, err, "Failed to delete object")
 			return
 		}
 
@@ -498,8 +910,8 @@ func HandleS3DeleteObject(logger *slog.Logger, s3Client *s3.Client) http.Handler
 		}
 
 		if err := encode(w, r, http.StatusOK, response); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
@@ -508,56 +920,85 @@ func HandleS3DeleteObject(logger *slog.Logger, s3Client *s3.Client) http.Handler
 // HandleS3GetObject downloads an object from S3.
 //
 //	@Summary		Download object from S3
-//	@Description	Download a file from an S3 bucket
+//	@Description	Download a file from an S3 bucket. Files uploaded with encrypt=true are decrypted.
 //	@Tags			aws
 //	@Produce		octet-stream
 //	@Param			bucketName	path		string	true	"Bucket name"
 //	@Param			key			path		string	true	"Object key"
+//	@Param			region		query		string	false	"AWS region of the bucket (default: the server's)"
 //	@Success		200			{file}		binary
-//	@Failure		400			{string}	string	"Invalid request"
-//	@Failure		401			{string}	string	"Unauthorized"
-//	@Failure		404			{string}	string	"Object not found"
-//	@Failure		500			{string}	string	"Failed to download object"
+//	@Failure		400			{object}	problem.Details	"Invalid request"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		404			{object}	problem.Details	"Object not found"
+//	@Failure		451			{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500			{object}	problem.Details	"Failed to download object"
 //	@Security		BearerAuth
 //	@Router			/api/v1/aws/s3/buckets/{bucketName}/download/{key} [get]
-func HandleS3GetObject(logger *slog.Logger, s3Client *s3.Client) http.Handler {
+func HandleS3GetObject(logger *slog.Logger, regions *awsclients.RegionPool, kmsClient *kms.Client) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		s3Client := clients.S3
+
 		bucketName := r.PathValue("bucketName")
 		key := r.PathValue("key")
 
 		if bucketName == "" || key == "" {
-			http.Error(w, "Bucket name and key are required", http.StatusBadRequest)
+			problem.Error(w, r, "Bucket name and key are required", http.StatusBadRequest)
 			return
 		}
 
 		// Decode URL-encoded key
 		key = strings.ReplaceAll(key, "%2F", "/")
 
-		logger.Info("downloading object from S3", "bucket", bucketName, "key", key)
+		logger.InfoContext(r.Context(), "downloading object from S3", "bucket", bucketName, "key", key)
 
-		result, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+		result, err := s3Client.GetObject(r.Context(), &s3.GetObjectInput{
 			Bucket: aws.String(bucketName),
 			Key:    aws.String(key),
 		})
 
 		if err != nil {
-			logger.Error("failed to get object", "error", err)
-			http.Error(w, fmt.Sprintf("Failed to download object: %v", err), http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to get object", "error", err)
+			writeAWSError(w, r, err, "Failed to download object")
 			return
 		}
 		defer result.Body.Close()
 
+		body, length := io.Reader(result.Body), result.ContentLength
+		if envelope.IsSealed(result.Metadata) {
+			sealed, err := io.ReadAll(result.Body)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to read encrypted object", "error", err)
+				problem.Error(w, r, "Failed to download object", http.StatusInternalServerError)
+				return
+			}
+			plaintext, err := envelope.Open(r.Context(), kmsClient, result.Metadata, sealed)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to decrypt object", "error", err, "bucket", bucketName, "key", key)
+				writeAWSError(w, r, err, "Failed to decrypt object")
+				return
+			}
+			body, length = bytes.NewReader(plaintext), aws.Int64(int64(len(plaintext)))
+		}
+
 		// Set headers for file download
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", key))
 		w.Header().Set("Content-Type", "application/octet-stream")
-		if result.ContentLength != nil {
-			w.Header().Set("Content-Length", fmt.Sprintf("%d", *result.ContentLength))
+		if length != nil {
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", *length))
 		}
 
 		// Stream the file to the response
-		_, err = io.Copy(w, result.Body)
+		_, err = io.Copy(w, body)
 		if err != nil {
-			logger.Error("failed to stream object", "error", err)
+			if r.Context().Err() != nil {
+				logger.WarnContext(r.Context(), "download cancelled", "error", context.Cause(r.Context()), "bucket", bucketName, "key", key)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to stream object", "error", err)
 			return
 		}
 	})
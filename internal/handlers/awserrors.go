@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/pmollerus23/go-aws-server/internal/awscalls"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// throttleRetryAfter is how long clients are told to wait when AWS throttles
+// the request.
+const throttleRetryAfter = time.Second
+
+// awsErrorStatus is the response for an AWS error code. The detail is safe
+// to show clients, unlike the AWS error message, which can name accounts,
+// ARNs, and policies.
+type awsErrorStatus struct {
+	status int
+	detail string
+}
+
+// awsErrorStatuses maps AWS error codes to responses. Throttling codes are
+// recognized separately, from the SDK's retry list.
+var awsErrorStatuses = map[string]awsErrorStatus{
+	// S3
+	"NoSuchBucket":            {http.StatusNotFound, "bucket not found"},
+	"NoSuchKey":               {http.StatusNotFound, "object not found"},
+	"NoSuchUpload":            {http.StatusNotFound, "upload not found"},
+	"NotFound":                {http.StatusNotFound, "not found"},
+	"AccessDenied":            {http.StatusForbidden, "access denied"},
+	"AllAccessDisabled":       {http.StatusForbidden, "access denied"},
+	"BucketAlreadyExists":     {http.StatusConflict, "bucket name is already taken"},
+	"BucketAlreadyOwnedByYou": {http.StatusConflict, "bucket already exists"},
+	"BucketNotEmpty":          {http.StatusConflict, "bucket is not empty"},
+	"OperationAborted":        {http.StatusConflict, "a conflicting operation is in progress"},
+	"InvalidBucketName":       {http.StatusBadRequest, "invalid bucket name"},
+	"InvalidObjectState":      {http.StatusConflict, "object is archived and must be restored first"},
+	"PreconditionFailed":      {http.StatusPreconditionFailed, "precondition failed"},
+
+	// DynamoDB and most JSON-protocol services
+	"ResourceNotFoundException":       {http.StatusNotFound, "resource not found"},
+	"TableNotFoundException":          {http.StatusNotFound, "table not found"},
+	"AccessDeniedException":           {http.StatusForbidden, "access denied"},
+	"UnrecognizedClientException":     {http.StatusForbidden, "access denied"},
+	"ResourceInUseException":          {http.StatusConflict, "resource is in use"},
+	"ConditionalCheckFailedException": {http.StatusConflict, "condition check failed"},
+	"TransactionConflictException":    {http.StatusConflict, "conflicting transaction in progress"},
+	"TransactionCanceledException":    {http.StatusConflict, "transaction cancelled"},
+	"ValidationException":             {http.StatusBadRequest, "invalid request"},
+
+	// SQS, which reports some codes under its query protocol names
+	"QueueDoesNotExist":                       {http.StatusNotFound, "queue not found"},
+	"AWS.SimpleQueueService.NonExistentQueue": {http.StatusNotFound, "queue not found"},
+	"ReceiptHandleIsInvalid":                  {http.StatusBadRequest, "invalid receipt handle"},
+	"InvalidMessageContents":                  {http.StatusBadRequest, "message contains characters SQS doesn't allow"},
+	"InvalidParameterValue":                   {http.StatusBadRequest, "invalid request"},
+	"MissingParameter":                        {http.StatusBadRequest, "invalid request"},
+
+	// Athena
+	"InvalidRequestException": {http.StatusBadRequest, "invalid request"},
+
+	// KMS
+	"NotFoundException":          {http.StatusNotFound, "not found"},
+	"DisabledException":          {http.StatusConflict, "key is disabled"},
+	"KMSInvalidStateException":   {http.StatusConflict, "key is not in a usable state"},
+	"InvalidCiphertextException": {http.StatusBadRequest, "ciphertext or encryption context is invalid"},
+	"IncorrectKeyException":      {http.StatusBadRequest, "ciphertext was not encrypted under the given key"},
+	"InvalidKeyUsageException":   {http.StatusBadRequest, "key can't be used for this operation"},
+
+	// Kinesis
+	"InvalidArgumentException": {http.StatusBadRequest, "invalid request"},
+	"KMSAccessDeniedException": {http.StatusForbidden, "access denied"},
+
+	// Rekognition
+	"InvalidImageFormatException": {http.StatusBadRequest, "image format is not supported"},
+	"ImageTooLargeException":      {http.StatusBadRequest, "image is too large to analyze"},
+	"InvalidS3ObjectException":    {http.StatusNotFound, "object not found or not readable"},
+
+	// Textract
+	"InvalidJobIdException":        {http.StatusNotFound, "job not found"},
+	"UnsupportedDocumentException": {http.StatusBadRequest, "document format is not supported"},
+	"BadDocumentException":         {http.StatusBadRequest, "document can't be read"},
+	"DocumentTooLargeException":    {http.StatusBadRequest, "document is too large to analyze"},
+	"LimitExceededException":       {http.StatusTooManyRequests, "limit exceeded"},
+
+	// Bedrock
+	"ModelNotReadyException":        {http.StatusServiceUnavailable, "model is not ready, try again later"},
+	"ModelTimeoutException":         {http.StatusGatewayTimeout, "model timed out"},
+	"ModelErrorException":           {http.StatusBadGateway, "model failed to process the request"},
+	"ModelStreamErrorException":     {http.StatusBadGateway, "model failed to process the request"},
+	"ServiceQuotaExceededException": {http.StatusTooManyRequests, "service quota exceeded"},
+
+	// Comprehend
+	"TextSizeLimitExceededException": {http.StatusBadRequest, "text is too long"},
+	"UnsupportedLanguageException":   {http.StatusBadRequest, "language is not supported"},
+
+	// CloudFormation, which also reports missing stacks this way
+	"ValidationError": {http.StatusBadRequest, "invalid request"},
+
+	// CloudWatch
+	"InvalidParameterCombination": {http.StatusBadRequest, "invalid combination of parameters"},
+	"InvalidNextToken":            {http.StatusBadRequest, "invalid page token"},
+
+	// Route 53
+	"NoSuchHostedZone":        {http.StatusNotFound, "hosted zone not found"},
+	"NoSuchChange":            {http.StatusNotFound, "change not found"},
+	"InvalidInput":            {http.StatusBadRequest, "invalid request"},
+	"PriorRequestNotComplete": {http.StatusConflict, "another change to the hosted zone is still being applied"},
+}
+
+// writeAWSError replies to r with the status err calls for if it is an AWS
+// error clients can act on: missing resources get 404, denied access 403,
+// conflicts 409, and throttling 429 with Retry-After. Calls cancelled with
+// the request get 503. Other errors get 500 with fallback as the detail.
+func writeAWSError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		// The client went away, or shutdown cut the request off, in which
+		// case the client can try again on another instance
+		problem.Error(w, r, "request was cancelled", http.StatusServiceUnavailable)
+		return
+	}
+	status, detail := awsErrorResponse(err)
+	if status == 0 {
+		problem.Error(w, r, fallback, http.StatusInternalServerError)
+		return
+	}
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", strconv.Itoa(int(throttleRetryAfter.Seconds())))
+	}
+	problem.Error(w, r, detail, status)
+}
+
+// awsErrorResponse returns the status and detail for err, or 0 if it isn't
+// an AWS error with a status of its own.
+func awsErrorResponse(err error) (int, string) {
+	if errors.Is(err, awscalls.ErrTimeout) {
+		return http.StatusGatewayTimeout, "AWS didn't respond in time, try again later"
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return 0, ""
+	}
+
+	code := apiErr.ErrorCode()
+	if _, ok := retry.DefaultThrottleErrorCodes[code]; ok {
+		return http.StatusTooManyRequests, "AWS is throttling requests, try again later"
+	}
+	if s, ok := awsErrorStatuses[code]; ok {
+		return s.status, s.detail
+	}
+
+	// Errors to HEAD requests have no body, so no code, only a status
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return http.StatusNotFound, "not found"
+		case http.StatusForbidden:
+			return http.StatusForbidden, "access denied"
+		}
+	}
+	return 0, ""
+}
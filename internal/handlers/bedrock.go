@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	bedrocktypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/sse"
+)
+
+// maxBedrockPromptLength bounds prompts, well above what models accept, so
+// oversized requests fail before they are sent.
+const maxBedrockPromptLength = 1 << 20
+
+// Event names sent by streamed invocations.
+const (
+	bedrockEventDelta = "delta"
+	bedrockEventChunk = "chunk"
+	bedrockEventDone  = "done"
+	bedrockEventError = "error"
+)
+
+// BedrockInvokeRequest represents a model invocation. Send either a prompt,
+// which works the same for every model, or a body in the model's own
+// request format.
+type BedrockInvokeRequest struct {
+	// ModelID is a model ID or inference profile. Without one, the
+	// server's BEDROCK_MODEL_ID is used.
+	ModelID string `json:"modelId,omitempty" example:"anthropic.claude-3-haiku-20240307-v1:0"`
+	Prompt  string `json:"prompt,omitempty" example:"Summarize this support ticket in one sentence: ..."`
+	// System is the system prompt sent with Prompt.
+	System string `json:"system,omitempty" example:"You are a concise assistant."`
+	// MaxTokens and Temperature apply to Prompt; put them in Body
+	// otherwise.
+	MaxTokens   int      `json:"maxTokens,omitempty" example:"512"`
+	Temperature *float64 `json:"temperature,omitempty" example:"0.2"`
+	// Body is passed to the model as is.
+	Body json.RawMessage `json:"body,omitempty" swaggertype:"object"`
+	// Stream sends the response as Server-Sent Events as it is generated.
+	Stream bool `json:"stream,omitempty" example:"false"`
+}
+
+// Valid validates the invoke request.
+func (r BedrockInvokeRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	switch {
+	case r.Prompt == "" && len(r.Body) == 0:
+		problems["prompt"] = "prompt or body is required"
+	case r.Prompt != "" && len(r.Body) != 0:
+		problems["prompt"] = "send either prompt or body, not both"
+	case len(r.Prompt) > maxBedrockPromptLength:
+		problems["prompt"] = "prompt must be at most 1 MiB"
+	}
+	if len(r.Body) != 0 && (r.System != "" || r.MaxTokens != 0 || r.Temperature != nil) {
+		problems["body"] = "system, maxTokens, and temperature only apply to prompt; put them in body"
+	}
+	if r.MaxTokens < 0 {
+		problems["maxTokens"] = "maxTokens must not be negative"
+	}
+	if t := r.Temperature; t != nil && (*t < 0 || *t > 1) {
+		problems["temperature"] = "temperature must be between 0 and 1"
+	}
+	return problems
+}
+
+// BedrockInvokeResponse represents a model's answer to a prompt.
+type BedrockInvokeResponse struct {
+	ModelID string `json:"modelId" example:"anthropic.claude-3-haiku-20240307-v1:0"`
+	// Text is omitted from the done event of streams, which sent it in
+	// deltas.
+	Text string `json:"text,omitempty" example:"The customer can't reset their password."`
+	// StopReason is why the model stopped, such as end_turn or max_tokens.
+	StopReason string       `json:"stopReason" example:"end_turn"`
+	Usage      BedrockUsage `json:"usage"`
+}
+
+// BedrockUsage is the tokens an invocation was billed for.
+type BedrockUsage struct {
+	InputTokens  int `json:"inputTokens" example:"42"`
+	OutputTokens int `json:"outputTokens" example:"17"`
+}
+
+// bedrockDelta is a piece of streamed text.
+type bedrockDelta struct {
+	Text string `json:"text"`
+}
+
+// HandleBedrockInvoke returns a handler that invokes a Bedrock model.
+//
+//	@Summary		Invoke a Bedrock model
+//	@Description	Invoke a Bedrock model with a prompt, answered with the model's text, or with a body in the model's own format, answered with the model's own response. With stream=true the response is sent as Server-Sent Events as it is generated: "delta" events ({"text":"..."}) for prompts or "chunk" events (the model's own chunks) for bodies, then a "done" event, or an "error" event ({"detail":"..."}) if the model fails part way. Requires the ai:invoke permission.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json,text/event-stream
+//	@Param			request	body		BedrockInvokeRequest	true	"Invocation"
+//	@Success		200		{object}	BedrockInvokeResponse
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Missing ai:invoke, or access to the model denied"
+//	@Failure		404		{object}	problem.Details	"Model not found"
+//	@Failure		429		{object}	problem.Details	"Throttled"
+//	@Failure		500		{object}	problem.Details	"Failed to invoke model"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/bedrock/invoke [post]
+func HandleBedrockInvoke(logger *slog.Logger, bedrockClient *bedrockruntime.Client, cfg config.BedrockConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[BedrockInvokeRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode invoke request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		modelID := req.ModelID
+		if modelID == "" {
+			modelID = cfg.DefaultModel
+		}
+		if modelID == "" {
+			problem.Validation(w, r, map[string]string{"modelId": "modelId is required, as no default model is configured"})
+			return
+		}
+		if len(cfg.AllowedModels) > 0 && !slices.Contains(cfg.AllowedModels, modelID) {
+			problem.Validation(w, r, map[string]string{"modelId": "modelId must be one of " + strings.Join(cfg.AllowedModels, ", ")})
+			return
+		}
+		logger := logger.With("model_id", modelID, "stream", req.Stream)
+
+		switch {
+		case req.Prompt != "" && req.Stream:
+			streamBedrockConverse(w, r, logger, bedrockClient, modelID, req)
+		case req.Prompt != "":
+			bedrockConverse(w, r, logger, bedrockClient, modelID, req)
+		case req.Stream:
+			streamBedrockInvoke(w, r, logger, bedrockClient, modelID, req.Body)
+		default:
+			bedrockInvoke(w, r, logger, bedrockClient, modelID, req.Body)
+		}
+	})
+}
+
+// bedrockConverse answers r with the model's reply to req's prompt.
+func bedrockConverse(w http.ResponseWriter, r *http.Request, logger *slog.Logger, client *bedrockruntime.Client, modelID string, req BedrockInvokeRequest) {
+	messages, system, inference := bedrockConversation(req)
+	result, err := client.Converse(r.Context(), &bedrockruntime.ConverseInput{
+		ModelId:         aws.String(modelID),
+		Messages:        messages,
+		System:          system,
+		InferenceConfig: inference,
+	})
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to invoke Bedrock model", "error", err)
+		writeAWSError(w, r, err, "Failed to invoke model")
+		return
+	}
+
+	resp := BedrockInvokeResponse{
+		ModelID:    modelID,
+		StopReason: string(result.StopReason),
+		Usage:      bedrockUsage(result.Usage),
+	}
+	if message, ok := result.Output.(*bedrocktypes.ConverseOutputMemberMessage); ok {
+		var text strings.Builder
+		for _, block := range message.Value.Content {
+			if t, ok := block.(*bedrocktypes.ContentBlockMemberText); ok {
+				text.WriteString(t.Value)
+			}
+		}
+		resp.Text = text.String()
+	}
+	logger.InfoContext(r.Context(), "invoked Bedrock model", "input_tokens", resp.Usage.InputTokens, "output_tokens", resp.Usage.OutputTokens)
+
+	if err := encode(w, r, http.StatusOK, resp); err != nil {
+		logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+		problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// streamBedrockConverse streams the model's reply to req's prompt to r.
+func streamBedrockConverse(w http.ResponseWriter, r *http.Request, logger *slog.Logger, client *bedrockruntime.Client, modelID string, req BedrockInvokeRequest) {
+	messages, system, inference := bedrockConversation(req)
+	result, err := client.ConverseStream(r.Context(), &bedrockruntime.ConverseStreamInput{
+		ModelId:         aws.String(modelID),
+		Messages:        messages,
+		System:          system,
+		InferenceConfig: inference,
+	})
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to invoke Bedrock model", "error", err)
+		writeAWSError(w, r, err, "Failed to invoke model")
+		return
+	}
+	events := result.GetStream()
+	defer events.Close()
+
+	stream, err := sse.Start(w, r)
+	if err != nil {
+		logger.WarnContext(r.Context(), "failed to start Bedrock stream", "error", err)
+		return
+	}
+	done := BedrockInvokeResponse{ModelID: modelID}
+	for event := range events.Events() {
+		switch e := event.(type) {
+		case *bedrocktypes.ConverseStreamOutputMemberContentBlockDelta:
+			if delta, ok := e.Value.Delta.(*bedrocktypes.ContentBlockDeltaMemberText); ok {
+				err = stream.Send(sse.Event{Name: bedrockEventDelta, Data: bedrockDelta{Text: delta.Value}})
+			}
+		case *bedrocktypes.ConverseStreamOutputMemberMessageStop:
+			done.StopReason = string(e.Value.StopReason)
+		case *bedrocktypes.ConverseStreamOutputMemberMetadata:
+			done.Usage = bedrockUsage(e.Value.Usage)
+		}
+		if err != nil {
+			logger.WarnContext(r.Context(), "Bedrock stream ended", "error", err)
+			return
+		}
+	}
+	finishBedrockStream(r, logger, stream, events.Err(), done)
+	logger.InfoContext(r.Context(), "invoked Bedrock model", "input_tokens", done.Usage.InputTokens, "output_tokens", done.Usage.OutputTokens)
+}
+
+// bedrockInvoke answers r with the model's own response to body.
+func bedrockInvoke(w http.ResponseWriter, r *http.Request, logger *slog.Logger, client *bedrockruntime.Client, modelID string, body []byte) {
+	result, err := client.InvokeModel(r.Context(), &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(modelID),
+		Body:        body,
+		ContentType: aws.String("application/json"),
+		Accept:      aws.String("application/json"),
+	})
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to invoke Bedrock model", "error", err)
+		writeAWSError(w, r, err, "Failed to invoke model")
+		return
+	}
+	logger.InfoContext(r.Context(), "invoked Bedrock model", "response_bytes", len(result.Body))
+
+	w.Header().Set("Content-Type", aws.ToString(result.ContentType))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(result.Body); err != nil {
+		logger.WarnContext(r.Context(), "failed to write Bedrock response", "error", err)
+	}
+}
+
+// streamBedrockInvoke streams the model's own response chunks to body to r.
+func streamBedrockInvoke(w http.ResponseWriter, r *http.Request, logger *slog.Logger, client *bedrockruntime.Client, modelID string, body []byte) {
+	result, err := client.InvokeModelWithResponseStream(r.Context(), &bedrockruntime.InvokeModelWithResponseStreamInput{
+		ModelId:     aws.String(modelID),
+		Body:        body,
+		ContentType: aws.String("application/json"),
+		Accept:      aws.String("application/json"),
+	})
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to invoke Bedrock model", "error", err)
+		writeAWSError(w, r, err, "Failed to invoke model")
+		return
+	}
+	events := result.GetStream()
+	defer events.Close()
+
+	stream, err := sse.Start(w, r)
+	if err != nil {
+		logger.WarnContext(r.Context(), "failed to start Bedrock stream", "error", err)
+		return
+	}
+	for event := range events.Events() {
+		chunk, ok := event.(*bedrocktypes.ResponseStreamMemberChunk)
+		if !ok {
+			continue
+		}
+		if err := stream.Send(sse.Event{Name: bedrockEventChunk, Data: json.RawMessage(chunk.Value.Bytes)}); err != nil {
+			logger.WarnContext(r.Context(), "Bedrock stream ended", "error", err)
+			return
+		}
+	}
+	finishBedrockStream(r, logger, stream, events.Err(), struct{}{})
+	logger.InfoContext(r.Context(), "invoked Bedrock model")
+}
+
+// finishBedrockStream sends the done event, or an error event if the model
+// failed part way.
+func finishBedrockStream(r *http.Request, logger *slog.Logger, stream *sse.Stream, err error, done any) {
+	event := sse.Event{Name: bedrockEventDone, Data: done}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Bedrock stream failed", "error", err)
+		detail := "Failed to invoke model"
+		if status, d := awsErrorResponse(err); status != 0 {
+			detail = d
+		}
+		event = sse.Event{Name: bedrockEventError, Data: map[string]string{"detail": detail}}
+	}
+	if err := stream.Send(event); err != nil {
+		logger.WarnContext(r.Context(), "Bedrock stream ended", "error", err)
+	}
+}
+
+// bedrockConversation returns the Converse API messages, system prompt, and
+// inference settings for req's prompt.
+func bedrockConversation(req BedrockInvokeRequest) ([]bedrocktypes.Message, []bedrocktypes.SystemContentBlock, *bedrocktypes.InferenceConfiguration) {
+	messages := []bedrocktypes.Message{{
+		Role:    bedrocktypes.ConversationRoleUser,
+		Content: []bedrocktypes.ContentBlock{&bedrocktypes.ContentBlockMemberText{Value: req.Prompt}},
+	}}
+	var system []bedrocktypes.SystemContentBlock
+	if req.System != "" {
+		system = append(system, &bedrocktypes.SystemContentBlockMemberText{Value: req.System})
+	}
+	inference := &bedrocktypes.InferenceConfiguration{}
+	if req.MaxTokens > 0 {
+		inference.MaxTokens = aws.Int32(int32(req.MaxTokens))
+	}
+	if req.Temperature != nil {
+		inference.Temperature = aws.Float32(float32(*req.Temperature))
+	}
+	return messages, system, inference
+}
+
+// bedrockUsage converts Bedrock's token usage.
+func bedrockUsage(usage *bedrocktypes.TokenUsage) BedrockUsage {
+	if usage == nil {
+		return BedrockUsage{}
+	}
+	return BedrockUsage{
+		InputTokens:  int(aws.ToInt32(usage.InputTokens)),
+		OutputTokens: int(aws.ToInt32(usage.OutputTokens)),
+	}
+}
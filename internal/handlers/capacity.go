@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// TableCapacity describes the billing mode and throughput of a DynamoDB table.
+type TableCapacity struct {
+	TableName          string          `json:"tableName" example:"Phil_Go_App_Database"`
+	Status             string          `json:"status" example:"ACTIVE"`
+	BillingMode        string          `json:"billingMode" example:"PROVISIONED"`
+	ReadCapacityUnits  int64           `json:"readCapacityUnits,omitempty" example:"5"`
+	WriteCapacityUnits int64           `json:"writeCapacityUnits,omitempty" example:"5"`
+	Indexes            []IndexCapacity `json:"indexes,omitempty"`
+}
+
+// IndexCapacity describes the status and throughput of a global secondary index.
+type IndexCapacity struct {
+	IndexName          string `json:"indexName"`
+	Status             string `json:"status"`
+	ReadCapacityUnits  int64  `json:"readCapacityUnits,omitempty"`
+	WriteCapacityUnits int64  `json:"writeCapacityUnits,omitempty"`
+}
+
+// UpdateCapacityRequest represents a request to change a table's billing mode or throughput.
+type UpdateCapacityRequest struct {
+	BillingMode        string `json:"billingMode" example:"PROVISIONED" enums:"PAY_PER_REQUEST,PROVISIONED"`
+	ReadCapacityUnits  int64  `json:"readCapacityUnits,omitempty" example:"5"`
+	WriteCapacityUnits int64  `json:"writeCapacityUnits,omitempty" example:"5"`
+}
+
+// Valid validates the update capacity request.
+func (r UpdateCapacityRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	switch ddbtypes.BillingMode(r.BillingMode) {
+	case ddbtypes.BillingModePayPerRequest:
+		if r.ReadCapacityUnits != 0 || r.WriteCapacityUnits != 0 {
+			problems["billingMode"] = "capacity units cannot be set with PAY_PER_REQUEST billing"
+		}
+	case ddbtypes.BillingModeProvisioned:
+		if r.ReadCapacityUnits < 1 {
+			problems["readCapacityUnits"] = "readCapacityUnits must be at least 1 with PROVISIONED billing"
+		}
+		if r.WriteCapacityUnits < 1 {
+			problems["writeCapacityUnits"] = "writeCapacityUnits must be at least 1 with PROVISIONED billing"
+		}
+	default:
+		problems["billingMode"] = "billingMode must be PAY_PER_REQUEST or PROVISIONED"
+	}
+
+	return problems
+}
+
+// HandleDynamoDBGetCapacity returns a handler that reports a table's billing mode, throughput, and status.
+//
+//	@Summary		Get DynamoDB table capacity
+//	@Description	Get the billing mode, provisioned throughput, and status of a table and its global secondary indexes. Poll this endpoint after an update until status returns to ACTIVE.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			tableName	path		string	true	"Table name"
+//	@Param			region		query		string	false	"AWS region of the table (default: the server's)"
+//	@Success		200			{object}	TableCapacity
+//	@Failure		400			{object}	problem.Details	"Invalid region"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		403			{object}	problem.Details	"Forbidden"
+//	@Failure		404			{object}	problem.Details	"Table not found"
+//	@Failure		451			{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500			{object}	problem.Details	"Failed to describe table"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/dynamodb/tables/{tableName}/capacity [get]
+func HandleDynamoDBGetCapacity(logger *slog.Logger, regions *awsclients.RegionPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		dynamoDBClient := clients.DynamoDB
+
+		tableName := r.PathValue("tableName")
+
+		table, err := describeTable(r.Context(), dynamoDBClient, tableName)
+		if err != nil {
+			var notFound *ddbtypes.ResourceNotFoundException
+			if errors.As(err, &notFound) {
+				problem.Error(w, r, "Table not found", http.StatusNotFound)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to describe table", "error", err, "table", tableName)
+			writeAWSError(w, r, err, "Failed to describe table")
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, tableCapacity(table)); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleDynamoDBUpdateCapacity returns a handler that switches a table's billing mode or updates its throughput.
+//
+//	@Summary		Update DynamoDB table capacity
+//	@Description	Switch a table between PAY_PER_REQUEST and PROVISIONED billing, or change its provisioned throughput. When switching to PROVISIONED, the same throughput is applied to every global secondary index. The update runs asynchronously; poll the capacity endpoint for status.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			tableName	path		string					true	"Table name"
+//	@Param			request		body		UpdateCapacityRequest	true	"Capacity settings"
+//	@Param			region		query		string					false	"AWS region of the table (default: the server's)"
+//	@Success		202			{object}	TableCapacity
+//	@Failure		400			{object}	problem.Details	"Validation error"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		403			{object}	problem.Details	"Forbidden"
+//	@Failure		404			{object}	problem.Details	"Table not found"
+//	@Failure		409			{object}	problem.Details	"Table is not ACTIVE"
+//	@Failure		451			{object}	ResidencyError	"Region blocked by the data residency policy"
+//	@Failure		500			{object}	problem.Details	"Failed to update table"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/dynamodb/tables/{tableName}/capacity [put]
+func HandleDynamoDBUpdateCapacity(logger *slog.Logger, regions *awsclients.RegionPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients := regionalClients(w, r, regions)
+		if clients == nil {
+			return
+		}
+		dynamoDBClient := clients.DynamoDB
+
+		tableName := r.PathValue("tableName")
+
+		req, problems, err := decodeValid[UpdateCapacityRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode capacity request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		table, err := describeTable(r.Context(), dynamoDBClient, tableName)
+		if err != nil {
+			var notFound *ddbtypes.ResourceNotFoundException
+			if errors.As(err, &notFound) {
+				problem.Error(w, r, "Table not found", http.StatusNotFound)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to describe table", "error", err, "table", tableName)
+			writeAWSError(w, r, err, "Failed to describe table")
+			return
+		}
+
+		if table.TableStatus != ddbtypes.TableStatusActive {
+			problem.Error(w, r, fmt.Sprintf("Table is %s; wait until it is ACTIVE", table.TableStatus), http.StatusConflict)
+			return
+		}
+
+		input := updateTableInput(table, req)
+		if input == nil {
+			// DynamoDB rejects no-op updates, so report the current settings instead.
+			if err := encode(w, r, http.StatusOK, tableCapacity(table)); err != nil {
+				logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			}
+			return
+		}
+
+		logger.InfoContext(r.Context(), "updating table capacity",
+			"table", tableName,
+			"billing_mode", req.BillingMode,
+			"read_capacity_units", req.ReadCapacityUnits,
+			"write_capacity_units", req.WriteCapacityUnits,
+		)
+
+		result, err := dynamoDBClient.UpdateTable(r.Context(), input)
+		if err != nil {
+			var limitExceeded *ddbtypes.LimitExceededException
+			var inUse *ddbtypes.ResourceInUseException
+			if errors.As(err, &limitExceeded) || errors.As(err, &inUse) {
+				// Billing mode switches are limited per 24 hours and throughput
+				// decreases per day; DynamoDB's message explains which applied.
+				problem.Error(w, r, fmt.Sprintf("Failed to update table: %v", err), http.StatusConflict)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to update table capacity", "error", err, "table", tableName)
+			writeAWSError(w, r, err, "Failed to update table")
+			return
+		}
+
+		if err := encode(w, r, http.StatusAccepted, tableCapacity(result.TableDescription)); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// describeTable fetches the description of a table.
+func describeTable(ctx context.Context, dynamoDBClient *dynamodb.Client, tableName string) (*ddbtypes.TableDescription, error) {
+	result, err := dynamoDBClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Table, nil
+}
+
+// updateTableInput builds the UpdateTable call for a capacity request.
+// It returns nil when the table already has the requested settings.
+func updateTableInput(table *ddbtypes.TableDescription, req UpdateCapacityRequest) *dynamodb.UpdateTableInput {
+	current := currentBillingMode(table)
+	target := ddbtypes.BillingMode(req.BillingMode)
+
+	if target == current {
+		if target == ddbtypes.BillingModePayPerRequest {
+			return nil
+		}
+		if table.ProvisionedThroughput != nil &&
+			aws.ToInt64(table.ProvisionedThroughput.ReadCapacityUnits) == req.ReadCapacityUnits &&
+			aws.ToInt64(table.ProvisionedThroughput.WriteCapacityUnits) == req.WriteCapacityUnits {
+			return nil
+		}
+	}
+
+	input := &dynamodb.UpdateTableInput{
+		TableName: table.TableName,
+	}
+
+	if target != current {
+		input.BillingMode = target
+	}
+
+	if target == ddbtypes.BillingModeProvisioned {
+		throughput := &ddbtypes.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(req.ReadCapacityUnits),
+			WriteCapacityUnits: aws.Int64(req.WriteCapacityUnits),
+		}
+		input.ProvisionedThroughput = throughput
+
+		// Indexes need explicit throughput when leaving on-demand billing.
+		if current != ddbtypes.BillingModeProvisioned {
+			for _, index := range table.GlobalSecondaryIndexes {
+				input.GlobalSecondaryIndexUpdates = append(input.GlobalSecondaryIndexUpdates, ddbtypes.GlobalSecondaryIndexUpdate{
+					Update: &ddbtypes.UpdateGlobalSecondaryIndexAction{
+						IndexName:             index.IndexName,
+						ProvisionedThroughput: throughput,
+					},
+				})
+			}
+		}
+	}
+
+	return input
+}
+
+// currentBillingMode returns a table's billing mode. Tables created before
+// on-demand billing existed report no summary and are provisioned.
+func currentBillingMode(table *ddbtypes.TableDescription) ddbtypes.BillingMode {
+	if table.BillingModeSummary != nil && table.BillingModeSummary.BillingMode != "" {
+		return table.BillingModeSummary.BillingMode
+	}
+	return ddbtypes.BillingModeProvisioned
+}
+
+// tableCapacity converts a table description to its capacity response.
+func tableCapacity(table *ddbtypes.TableDescription) TableCapacity {
+	capacity := TableCapacity{
+		TableName:   aws.ToString(table.TableName),
+		Status:      string(table.TableStatus),
+		BillingMode: string(currentBillingMode(table)),
+	}
+
+	if table.ProvisionedThroughput != nil {
+		capacity.ReadCapacityUnits = aws.ToInt64(table.ProvisionedThroughput.ReadCapacityUnits)
+		capacity.WriteCapacityUnits = aws.ToInt64(table.ProvisionedThroughput.WriteCapacityUnits)
+	}
+
+	for _, index := range table.GlobalSecondaryIndexes {
+		indexCapacity := IndexCapacity{
+			IndexName: aws.ToString(index.IndexName),
+			Status:    string(index.IndexStatus),
+		}
+		if index.ProvisionedThroughput != nil {
+			indexCapacity.ReadCapacityUnits = aws.ToInt64(index.ProvisionedThroughput.ReadCapacityUnits)
+			indexCapacity.WriteCapacityUnits = aws.ToInt64(index.ProvisionedThroughput.WriteCapacityUnits)
+		}
+		capacity.Indexes = append(capacity.Indexes, indexCapacity)
+	}
+
+	return capacity
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// ClientCredentialsService defines the interface for issuing tokens to
+// service clients.
+type ClientCredentialsService interface {
+	ClientCredentialsToken(ctx context.Context, clientID, clientSecret, scope string) (*auth.Tokens, error)
+}
+
+// ClientCredentialsRequest represents a service client's token request. The
+// client ID and secret may instead be sent with HTTP Basic authentication.
+type ClientCredentialsRequest struct {
+	ClientID     string `json:"client_id" example:"4a1b2c3d4e5f6g7h8i9j0k1l2m"`
+	ClientSecret string `json:"client_secret"`
+	// Scope is a space-separated list of scopes; omit it for all of the
+	// client's scopes.
+	Scope string `json:"scope,omitempty" example:"https://api.example.com/items.read"`
+}
+
+// Valid validates the client credentials request.
+func (r ClientCredentialsRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.ClientID == "" {
+		problems["client_id"] = "client_id is required"
+	}
+	if r.ClientSecret == "" {
+		problems["client_secret"] = "client_secret is required"
+	}
+
+	return problems
+}
+
+// ClientCredentialsResponse represents an access token issued to a service
+// client.
+type ClientCredentialsResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int32  `json:"expires_in" example:"3600"`
+	TokenType   string `json:"token_type" example:"Bearer"`
+}
+
+// HandleClientCredentialsToken returns a handler that issues access tokens
+// to service clients with the client credentials grant.
+//
+//	@Summary		Get service client token
+//	@Description	Exchange a service client's ID and secret for an access token carrying the client's scopes, with no user. Credentials go in the body or in HTTP Basic authentication. Needs a Cognito domain.
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		ClientCredentialsRequest	true	"Client credentials"
+//	@Success		200		{object}	ClientCredentialsResponse
+//	@Failure		400		{object}	problem.Details	"Validation error or invalid scope"
+//	@Failure		401		{object}	problem.Details	"Invalid client credentials"
+//	@Failure		501		{object}	problem.Details	"Not supported by the identity provider"
+//	@Router			/api/v1/auth/token [post]
+func HandleClientCredentialsToken(logger *slog.Logger, clients ClientCredentialsService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ClientCredentialsRequest
+		if r.ContentLength != 0 {
+			if err := decode(r, &req); err != nil {
+				logger.ErrorContext(r.Context(), "failed to decode client credentials request", "error", err)
+				problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+				return
+			}
+		}
+		if id, secret, ok := r.BasicAuth(); ok {
+			req.ClientID, req.ClientSecret = id, secret
+		}
+		if problems := req.Valid(r.Context()); len(problems) > 0 {
+			problem.Validation(w, r, problems)
+			return
+		}
+
+		tokens, err := clients.ClientCredentialsToken(r.Context(), req.ClientID, req.ClientSecret, req.Scope)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidClient):
+				logger.WarnContext(r.Context(), "client credentials rejected", "client_id", req.ClientID)
+				problem.Error(w, r, "invalid client credentials", http.StatusUnauthorized)
+			case errors.Is(err, auth.ErrInvalidScope):
+				problem.Error(w, r, "invalid scope", http.StatusBadRequest)
+			case errors.Is(err, auth.ErrNotSupported):
+				problem.Error(w, r, "service client tokens are not supported by the identity provider", http.StatusNotImplemented)
+			default:
+				logger.ErrorContext(r.Context(), "client credentials token failed", "error", err, "client_id", req.ClientID)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		resp := ClientCredentialsResponse{
+			AccessToken: tokens.AccessToken,
+			ExpiresIn:   tokens.ExpiresIn,
+			TokenType:   tokens.TokenType,
+		}
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+	cloudformationtypes "github.com/aws/aws-sdk-go-v2/service/cloudformation/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// Stack events returned by default and at most.
+const (
+	defaultStackEvents = 50
+	maxStackEvents     = 500
+)
+
+// CloudFormationStack summarizes a stack.
+type CloudFormationStack struct {
+	Name string `json:"name" example:"go-aws-server"`
+	ID   string `json:"id" example:"arn:aws:cloudformation:us-east-1:123456789012:stack/go-aws-server/1a2b3c4d-5678-90ab-cdef-EXAMPLE11111"`
+	// Status is CREATE_COMPLETE, UPDATE_IN_PROGRESS, UPDATE_ROLLBACK_COMPLETE,
+	// and so on.
+	Status       string     `json:"status" example:"UPDATE_COMPLETE"`
+	StatusReason string     `json:"statusReason,omitempty" example:""`
+	Description  string     `json:"description,omitempty" example:"API server and its tables"`
+	CreatedAt    *time.Time `json:"createdAt,omitempty" example:"2024-01-15T10:30:00Z"`
+	UpdatedAt    *time.Time `json:"updatedAt,omitempty" example:"2024-03-02T08:12:45Z"`
+}
+
+// CloudFormationStackDetail is a stack with its outputs, parameters, and
+// tags.
+type CloudFormationStackDetail struct {
+	CloudFormationStack
+	Outputs []CloudFormationOutput `json:"outputs"`
+	// Parameters maps parameter names to values; NoEcho parameters are
+	// masked.
+	Parameters map[string]string `json:"parameters"`
+	Tags       map[string]string `json:"tags"`
+}
+
+// CloudFormationOutput is a value a stack exports.
+type CloudFormationOutput struct {
+	Key         string `json:"key" example:"ApiUrl"`
+	Value       string `json:"value" example:"https://api.example.com"`
+	Description string `json:"description,omitempty" example:"Public URL of the API"`
+	ExportName  string `json:"exportName,omitempty" example:""`
+}
+
+// CloudFormationResource is a resource of a stack.
+type CloudFormationResource struct {
+	LogicalID    string     `json:"logicalId" example:"RecordsTable"`
+	PhysicalID   string     `json:"physicalId,omitempty" example:"Phil_Go_App_Database"`
+	Type         string     `json:"type" example:"AWS::DynamoDB::Table"`
+	Status       string     `json:"status" example:"UPDATE_COMPLETE"`
+	StatusReason string     `json:"statusReason,omitempty" example:""`
+	UpdatedAt    *time.Time `json:"updatedAt,omitempty" example:"2024-03-02T08:12:45Z"`
+}
+
+// CloudFormationEvent is a change in the status of a stack or one of its
+// resources.
+type CloudFormationEvent struct {
+	ID           string     `json:"id" example:"RecordsTable-UPDATE_COMPLETE-2024-03-02T08:12:45.123Z"`
+	LogicalID    string     `json:"logicalId" example:"RecordsTable"`
+	PhysicalID   string     `json:"physicalId,omitempty" example:"Phil_Go_App_Database"`
+	Type         string     `json:"type" example:"AWS::DynamoDB::Table"`
+	Status       string     `json:"status" example:"UPDATE_COMPLETE"`
+	StatusReason string     `json:"statusReason,omitempty" example:""`
+	Time         *time.Time `json:"time" example:"2024-03-02T08:12:45Z"`
+}
+
+// writeStackError replies to r for err from a call about a stack. Missing
+// stacks, which CloudFormation reports as validation errors, get 404.
+func writeStackError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ValidationError" && strings.Contains(apiErr.ErrorMessage(), "does not exist") {
+		problem.Error(w, r, "Stack not found", http.StatusNotFound)
+		return
+	}
+	writeAWSError(w, r, err, fallback)
+}
+
+// HandleCloudFormationListStacks returns a handler that lists stacks.
+//
+//	@Summary		List CloudFormation stacks
+//	@Description	Get the CloudFormation stacks in the region and their status, excluding deleted stacks unless status asks for them
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			status	query		string					false	"Comma-separated statuses to list, e.g. UPDATE_ROLLBACK_COMPLETE,ROLLBACK_COMPLETE"
+//	@Success		200		{object}	map[string]interface{}	"stacks and count"
+//	@Failure		400		{object}	problem.Details			"Unknown status"
+//	@Failure		401		{object}	problem.Details			"Unauthorized"
+//	@Failure		403		{object}	problem.Details			"Missing aws:read"
+//	@Failure		500		{object}	problem.Details			"Failed to list stacks"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/cloudformation/stacks [get]
+func HandleCloudFormationListStacks(logger *slog.Logger, cloudFormationClient *cloudformation.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var statuses []cloudformationtypes.StackStatus
+		if value := r.URL.Query().Get("status"); value != "" {
+			known := cloudformationtypes.StackStatus("").Values()
+			for _, s := range strings.Split(value, ",") {
+				status := cloudformationtypes.StackStatus(strings.ToUpper(strings.TrimSpace(s)))
+				if !slices.Contains(known, status) {
+					problem.Error(w, r, "Unknown stack status "+strconv.Quote(s), http.StatusBadRequest)
+					return
+				}
+				statuses = append(statuses, status)
+			}
+		} else {
+			for _, status := range cloudformationtypes.StackStatus("").Values() {
+				if status != cloudformationtypes.StackStatusDeleteComplete {
+					statuses = append(statuses, status)
+				}
+			}
+		}
+
+		stacks := []CloudFormationStack{}
+		paginator := cloudformation.NewListStacksPaginator(cloudFormationClient, &cloudformation.ListStacksInput{StackStatusFilter: statuses})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to list CloudFormation stacks", "error", err)
+				writeAWSError(w, r, err, "Failed to list stacks")
+				return
+			}
+			for _, s := range page.StackSummaries {
+				stacks = append(stacks, CloudFormationStack{
+					Name:         aws.ToString(s.StackName),
+					ID:           aws.ToString(s.StackId),
+					Status:       string(s.StackStatus),
+					StatusReason: aws.ToString(s.StackStatusReason),
+					Description:  aws.ToString(s.TemplateDescription),
+					CreatedAt:    s.CreationTime,
+					UpdatedAt:    s.LastUpdatedTime,
+				})
+			}
+		}
+
+		if err := encode(w, r, http.StatusOK, newListResponse("stacks", stacks, len(stacks))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleCloudFormationGetStack returns a handler that describes a stack.
+//
+//	@Summary		Get a CloudFormation stack
+//	@Description	Get a stack's status, outputs, parameters, and tags
+//	@Tags			aws
+//	@Produce		json
+//	@Param			stackName	path		string	true	"Stack name or ID"
+//	@Success		200			{object}	CloudFormationStackDetail
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		403			{object}	problem.Details	"Missing aws:read"
+//	@Failure		404			{object}	problem.Details	"Stack not found"
+//	@Failure		500			{object}	problem.Details	"Failed to get stack"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/cloudformation/stacks/{stackName} [get]
+func HandleCloudFormationGetStack(logger *slog.Logger, cloudFormationClient *cloudformation.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stackName := r.PathValue("stackName")
+
+		result, err := cloudFormationClient.DescribeStacks(r.Context(), &cloudformation.DescribeStacksInput{StackName: aws.String(stackName)})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to describe CloudFormation stack", "error", err, "stack", stackName)
+			writeStackError(w, r, err, "Failed to get stack")
+			return
+		}
+		if len(result.Stacks) == 0 {
+			problem.Error(w, r, "Stack not found", http.StatusNotFound)
+			return
+		}
+		s := result.Stacks[0]
+
+		resp := CloudFormationStackDetail{
+			CloudFormationStack: CloudFormationStack{
+				Name:         aws.ToString(s.StackName),
+				ID:           aws.ToString(s.StackId),
+				Status:       string(s.StackStatus),
+				StatusReason: aws.ToString(s.StackStatusReason),
+				Description:  aws.ToString(s.Description),
+				CreatedAt:    s.CreationTime,
+				UpdatedAt:    s.LastUpdatedTime,
+			},
+			Outputs:    make([]CloudFormationOutput, 0, len(s.Outputs)),
+			Parameters: make(map[string]string, len(s.Parameters)),
+			Tags:       make(map[string]string, len(s.Tags)),
+		}
+		for _, o := range s.Outputs {
+			resp.Outputs = append(resp.Outputs, CloudFormationOutput{
+				Key:         aws.ToString(o.OutputKey),
+				Value:       aws.ToString(o.OutputValue),
+				Description: aws.ToString(o.Description),
+				ExportName:  aws.ToString(o.ExportName),
+			})
+		}
+		for _, p := range s.Parameters {
+			resp.Parameters[aws.ToString(p.ParameterKey)] = aws.ToString(p.ParameterValue)
+		}
+		for _, t := range s.Tags {
+			resp.Tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+		}
+
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleCloudFormationListResources returns a handler that lists a stack's
+// resources.
+//
+//	@Summary		List CloudFormation stack resources
+//	@Description	Get the resources of a stack, with their physical IDs and status
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			stackName	path		string					true	"Stack name or ID"
+//	@Success		200			{object}	map[string]interface{}	"resources and count"
+//	@Failure		401			{object}	problem.Details			"Unauthorized"
+//	@Failure		403			{object}	problem.Details			"Missing aws:read"
+//	@Failure		404			{object}	problem.Details			"Stack not found"
+//	@Failure		500			{object}	problem.Details			"Failed to list stack resources"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/cloudformation/stacks/{stackName}/resources [get]
+func HandleCloudFormationListResources(logger *slog.Logger, cloudFormationClient *cloudformation.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stackName := r.PathValue("stackName")
+
+		resources := []CloudFormationResource{}
+		paginator := cloudformation.NewListStackResourcesPaginator(cloudFormationClient, &cloudformation.ListStackResourcesInput{StackName: aws.String(stackName)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to list CloudFormation stack resources", "error", err, "stack", stackName)
+				writeStackError(w, r, err, "Failed to list stack resources")
+				return
+			}
+			for _, res := range page.StackResourceSummaries {
+				resources = append(resources, CloudFormationResource{
+					LogicalID:    aws.ToString(res.LogicalResourceId),
+					PhysicalID:   aws.ToString(res.PhysicalResourceId),
+					Type:         aws.ToString(res.ResourceType),
+					Status:       string(res.ResourceStatus),
+					StatusReason: aws.ToString(res.ResourceStatusReason),
+					UpdatedAt:    res.LastUpdatedTimestamp,
+				})
+			}
+		}
+
+		if err := encode(w, r, http.StatusOK, newListResponse("resources", resources, len(resources))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleCloudFormationListEvents returns a handler that lists a stack's
+// recent events.
+//
+//	@Summary		List CloudFormation stack events
+//	@Description	Get a stack's most recent events, newest first, to follow a deploy or find why it failed
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			stackName	path		string					true	"Stack name or ID"
+//	@Param			limit		query		int						false	"Events to return, up to 500 (default 50)"
+//	@Success		200			{object}	map[string]interface{}	"events and count"
+//	@Failure		400			{object}	problem.Details			"Invalid limit"
+//	@Failure		401			{object}	problem.Details			"Unauthorized"
+//	@Failure		403			{object}	problem.Details			"Missing aws:read"
+//	@Failure		404			{object}	problem.Details			"Stack not found"
+//	@Failure		500			{object}	problem.Details			"Failed to list stack events"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/cloudformation/stacks/{stackName}/events [get]
+func HandleCloudFormationListEvents(logger *slog.Logger, cloudFormationClient *cloudformation.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stackName := r.PathValue("stackName")
+		limit := defaultStackEvents
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxStackEvents {
+				problem.Error(w, r, "limit must be between 1 and 500", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		events := []CloudFormationEvent{}
+		paginator := cloudformation.NewDescribeStackEventsPaginator(cloudFormationClient, &cloudformation.DescribeStackEventsInput{StackName: aws.String(stackName)})
+		for paginator.HasMorePages() && len(events) < limit {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to list CloudFormation stack events", "error", err, "stack", stackName)
+				writeStackError(w, r, err, "Failed to list stack events")
+				return
+			}
+			for _, e := range page.StackEvents {
+				if len(events) == limit {
+					break
+				}
+				events = append(events, CloudFormationEvent{
+					ID:           aws.ToString(e.EventId),
+					LogicalID:    aws.ToString(e.LogicalResourceId),
+					PhysicalID:   aws.ToString(e.PhysicalResourceId),
+					Type:         aws.ToString(e.ResourceType),
+					Status:       string(e.ResourceStatus),
+					StatusReason: aws.ToString(e.ResourceStatusReason),
+					Time:         e.Timestamp,
+				})
+			}
+		}
+
+		if err := encode(w, r, http.StatusOK, newListResponse("events", events, len(events))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"cmp"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+const (
+	// defaultMetricWindow is how far back metric data goes when no start is
+	// given.
+	defaultMetricWindow = 3 * time.Hour
+	// defaultMetricPeriod is the length, in seconds, of each data point when
+	// no period is given.
+	defaultMetricPeriod = 300
+	// maxMetricStats caps the statistics fetched for a metric at once.
+	maxMetricStats = 10
+)
+
+// metricStat matches the statistics CloudWatch computes: the basic ones and
+// percentiles such as p99 or p99.9.
+var metricStat = regexp.MustCompile(`^(Average|Sum|Minimum|Maximum|SampleCount|p\d{1,2}(\.\d+)?)$`)
+
+// CloudWatchAlarm is a metric or composite alarm and its state.
+type CloudWatchAlarm struct {
+	Name string `json:"name" example:"records-table-throttled"`
+	ARN  string `json:"arn" example:"arn:aws:cloudwatch:us-east-1:123456789012:alarm:records-table-throttled"`
+	// Type is metric or composite.
+	Type        string `json:"type" example:"metric"`
+	Description string `json:"description,omitempty" example:"Reads on the records table are throttled"`
+	// State is OK, ALARM, or INSUFFICIENT_DATA.
+	State          string     `json:"state" example:"ALARM"`
+	StateReason    string     `json:"stateReason,omitempty" example:"Threshold Crossed: 1 datapoint [12.0] was greater than the threshold (0.0)."`
+	StateUpdatedAt *time.Time `json:"stateUpdatedAt,omitempty" example:"2024-03-02T08:12:45Z"`
+	ActionsEnabled bool       `json:"actionsEnabled" example:"true"`
+	// The metric and threshold of metric alarms.
+	Namespace          string            `json:"namespace,omitempty" example:"AWS/DynamoDB"`
+	MetricName         string            `json:"metricName,omitempty" example:"ReadThrottleEvents"`
+	Dimensions         map[string]string `json:"dimensions,omitempty"`
+	Statistic          string            `json:"statistic,omitempty" example:"Sum"`
+	Period             int32             `json:"period,omitempty" example:"60"`
+	ComparisonOperator string            `json:"comparisonOperator,omitempty" example:"GreaterThanThreshold"`
+	Threshold          *float64          `json:"threshold,omitempty" example:"0"`
+	// Rule combines the alarms a composite alarm watches.
+	Rule string `json:"rule,omitempty" example:"ALARM(records-table-throttled) OR ALARM(api-5xx)"`
+}
+
+// CloudWatchMetric is a metric CloudWatch has data for.
+type CloudWatchMetric struct {
+	Namespace  string            `json:"namespace" example:"AWS/DynamoDB"`
+	MetricName string            `json:"metricName" example:"ConsumedReadCapacityUnits"`
+	Dimensions map[string]string `json:"dimensions"`
+}
+
+// MetricData is a metric's data points over a time range, one series per
+// statistic.
+type MetricData struct {
+	Namespace  string            `json:"namespace" example:"AWS/DynamoDB"`
+	MetricName string            `json:"metricName" example:"ConsumedReadCapacityUnits"`
+	Dimensions map[string]string `json:"dimensions"`
+	Start      time.Time         `json:"start" example:"2024-03-02T05:00:00Z"`
+	End        time.Time         `json:"end" example:"2024-03-02T08:00:00Z"`
+	Period     int32             `json:"period" example:"300"`
+	Series     []MetricSeries    `json:"series"`
+}
+
+// MetricSeries is one statistic of a metric over time.
+type MetricSeries struct {
+	Stat  string `json:"stat" example:"Sum"`
+	Label string `json:"label" example:"ConsumedReadCapacityUnits"`
+	// Status is Complete, or PartialData if CloudWatch returned fewer points
+	// than the range holds.
+	Status string        `json:"status" example:"Complete"`
+	Points []MetricPoint `json:"points"`
+}
+
+// MetricPoint is a statistic's value over the period starting at Timestamp.
+type MetricPoint struct {
+	Timestamp time.Time `json:"timestamp" example:"2024-03-02T05:00:00Z"`
+	Value     float64   `json:"value" example:"42"`
+}
+
+// metricDimensions parses dimension parameters, given as Name=Value.
+func metricDimensions(values []string) ([]cwtypes.Dimension, bool) {
+	dimensions := make([]cwtypes.Dimension, 0, len(values))
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, false
+		}
+		dimensions = append(dimensions, cwtypes.Dimension{Name: aws.String(name), Value: aws.String(value)})
+	}
+	return dimensions, true
+}
+
+// dimensionMap converts CloudWatch dimensions to a map of names to values.
+func dimensionMap(dimensions []cwtypes.Dimension) map[string]string {
+	m := make(map[string]string, len(dimensions))
+	for _, d := range dimensions {
+		m[aws.ToString(d.Name)] = aws.ToString(d.Value)
+	}
+	return m
+}
+
+// HandleCloudWatchListAlarms returns a handler that lists alarms and their
+// state.
+//
+//	@Summary		List CloudWatch alarms
+//	@Description	Get the metric and composite alarms in the region and their state, those in ALARM first
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			state	query		string					false	"OK, ALARM, or INSUFFICIENT_DATA"
+//	@Param			prefix	query		string					false	"Alarm name prefix"
+//	@Success		200		{object}	map[string]interface{}	"alarms and count"
+//	@Failure		400		{object}	problem.Details			"Invalid request"
+//	@Failure		401		{object}	problem.Details			"Unauthorized"
+//	@Failure		403		{object}	problem.Details			"Missing aws:read"
+//	@Failure		500		{object}	problem.Details			"Failed to list alarms"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/cloudwatch/alarms [get]
+func HandleCloudWatchListAlarms(logger *slog.Logger, cloudWatchClient *cloudwatch.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		input := &cloudwatch.DescribeAlarmsInput{
+			AlarmTypes: []cwtypes.AlarmType{cwtypes.AlarmTypeMetricAlarm, cwtypes.AlarmTypeCompositeAlarm},
+		}
+		if v := query.Get("state"); v != "" {
+			state := cwtypes.StateValue(strings.ToUpper(v))
+			if !slices.Contains(state.Values(), state) {
+				problem.Error(w, r, "state must be OK, ALARM, or INSUFFICIENT_DATA", http.StatusBadRequest)
+				return
+			}
+			input.StateValue = state
+		}
+		if v := query.Get("prefix"); v != "" {
+			input.AlarmNamePrefix = aws.String(v)
+		}
+
+		alarms := []CloudWatchAlarm{}
+		paginator := cloudwatch.NewDescribeAlarmsPaginator(cloudWatchClient, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to list CloudWatch alarms", "error", err)
+				writeAWSError(w, r, err, "Failed to list alarms")
+				return
+			}
+			for _, a := range page.MetricAlarms {
+				alarms = append(alarms, CloudWatchAlarm{
+					Name:               aws.ToString(a.AlarmName),
+					ARN:                aws.ToString(a.AlarmArn),
+					Type:               "metric",
+					Description:        aws.ToString(a.AlarmDescription),
+					State:              string(a.StateValue),
+					StateReason:        aws.ToString(a.StateReason),
+					StateUpdatedAt:     a.StateUpdatedTimestamp,
+					ActionsEnabled:     aws.ToBool(a.ActionsEnabled),
+					Namespace:          aws.ToString(a.Namespace),
+					MetricName:         aws.ToString(a.MetricName),
+					Dimensions:         dimensionMap(a.Dimensions),
+					Statistic:          cmp.Or(string(a.Statistic), aws.ToString(a.ExtendedStatistic)),
+					Period:             aws.ToInt32(a.Period),
+					ComparisonOperator: string(a.ComparisonOperator),
+					Threshold:          a.Threshold,
+				})
+			}
+			for _, a := range page.CompositeAlarms {
+				alarms = append(alarms, CloudWatchAlarm{
+					Name:           aws.ToString(a.AlarmName),
+					ARN:            aws.ToString(a.AlarmArn),
+					Type:           "composite",
+					Description:    aws.ToString(a.AlarmDescription),
+					State:          string(a.StateValue),
+					StateReason:    aws.ToString(a.StateReason),
+					StateUpdatedAt: a.StateUpdatedTimestamp,
+					ActionsEnabled: aws.ToBool(a.ActionsEnabled),
+					Rule:           aws.ToString(a.AlarmRule),
+				})
+			}
+		}
+		slices.SortStableFunc(alarms, func(a, b CloudWatchAlarm) int {
+			return cmp.Compare(alarmStateOrder(a.State), alarmStateOrder(b.State))
+		})
+
+		if err := encode(w, r, http.StatusOK, newListResponse("alarms", alarms, len(alarms))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// alarmStateOrder orders alarms in ALARM before those lacking data, and
+// those before OK ones.
+func alarmStateOrder(state string) int {
+	switch cwtypes.StateValue(state) {
+	case cwtypes.StateValueAlarm:
+		return 0
+	case cwtypes.StateValueInsufficientData:
+		return 1
+	}
+	return 2
+}
+
+// HandleCloudWatchListMetrics returns a handler that lists the metrics of a
+// namespace.
+//
+//	@Summary		List CloudWatch metrics
+//	@Description	Get the metrics CloudWatch has data for in a namespace, with their dimensions, to find what can be graphed
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			namespace	query		string					true	"Namespace, e.g. AWS/DynamoDB"
+//	@Param			metricName	query		string					false	"Metric name"
+//	@Param			dimension	query		[]string				false	"Dimension as Name=Value, repeatable"	collectionFormat(multi)
+//	@Param			recent		query		bool					false	"Only metrics with data in the past 3 hours"
+//	@Success		200			{object}	map[string]interface{}	"metrics and count"
+//	@Failure		400			{object}	problem.Details			"Invalid request"
+//	@Failure		401			{object}	problem.Details			"Unauthorized"
+//	@Failure		403			{object}	problem.Details			"Missing aws:read"
+//	@Failure		500			{object}	problem.Details			"Failed to list metrics"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/cloudwatch/metrics [get]
+func HandleCloudWatchListMetrics(logger *slog.Logger, cloudWatchClient *cloudwatch.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		namespace := query.Get("namespace")
+		if namespace == "" {
+			problem.Error(w, r, "namespace is required", http.StatusBadRequest)
+			return
+		}
+		dimensions, ok := metricDimensions(query["dimension"])
+		if !ok {
+			problem.Error(w, r, "dimension must be Name=Value", http.StatusBadRequest)
+			return
+		}
+
+		input := &cloudwatch.ListMetricsInput{Namespace: aws.String(namespace)}
+		if v := query.Get("metricName"); v != "" {
+			input.MetricName = aws.String(v)
+		}
+		for _, d := range dimensions {
+			input.Dimensions = append(input.Dimensions, cwtypes.DimensionFilter{Name: d.Name, Value: d.Value})
+		}
+		if query.Get("recent") == "true" {
+			input.RecentlyActive = cwtypes.RecentlyActivePt3h
+		}
+
+		metrics := []CloudWatchMetric{}
+		paginator := cloudwatch.NewListMetricsPaginator(cloudWatchClient, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to list CloudWatch metrics", "error", err, "namespace", namespace)
+				writeAWSError(w, r, err, "Failed to list metrics")
+				return
+			}
+			for _, m := range page.Metrics {
+				metrics = append(metrics, CloudWatchMetric{
+					Namespace:  aws.ToString(m.Namespace),
+					MetricName: aws.ToString(m.MetricName),
+					Dimensions: dimensionMap(m.Dimensions),
+				})
+			}
+		}
+
+		if err := encode(w, r, http.StatusOK, newListResponse("metrics", metrics, len(metrics))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleCloudWatchGetMetricData returns a handler that fetches a metric's
+// data points for graphing.
+//
+//	@Summary		Get CloudWatch metric data
+//	@Description	Get a metric's statistics over a time range, oldest first, one series per statistic
+//	@Tags			aws
+//	@Produce		json
+//	@Param			namespace	query		string		true	"Namespace, e.g. AWS/DynamoDB"
+//	@Param			metricName	query		string		true	"Metric name, e.g. ConsumedReadCapacityUnits"
+//	@Param			dimension	query		[]string	false	"Dimension as Name=Value, repeatable"	collectionFormat(multi)
+//	@Param			stat		query		string		false	"Comma-separated statistics: Average (default), Sum, Minimum, Maximum, SampleCount, or a percentile such as p99"
+//	@Param			period		query		int			false	"Seconds per data point, a multiple of 60 or 1, 5, 10, or 30 (default 300)"
+//	@Param			start		query		string		false	"Start time in RFC 3339 format (default: 3 hours ago)"
+//	@Param			end			query		string		false	"End time in RFC 3339 format (default: now)"
+//	@Success		200			{object}	MetricData
+//	@Failure		400			{object}	problem.Details	"Invalid request"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		403			{object}	problem.Details	"Missing aws:read"
+//	@Failure		429			{object}	problem.Details	"Throttled"
+//	@Failure		500			{object}	problem.Details	"Failed to get metric data"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/cloudwatch/metrics/data [get]
+func HandleCloudWatchGetMetricData(logger *slog.Logger, cloudWatchClient *cloudwatch.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		namespace, metricName := query.Get("namespace"), query.Get("metricName")
+		if namespace == "" || metricName == "" {
+			problem.Error(w, r, "namespace and metricName are required", http.StatusBadRequest)
+			return
+		}
+		dimensions, ok := metricDimensions(query["dimension"])
+		if !ok {
+			problem.Error(w, r, "dimension must be Name=Value", http.StatusBadRequest)
+			return
+		}
+
+		stats := []string{"Average"}
+		if v := query.Get("stat"); v != "" {
+			stats = strings.Split(v, ",")
+			if len(stats) > maxMetricStats {
+				problem.Error(w, r, "at most 10 statistics can be fetched at once", http.StatusBadRequest)
+				return
+			}
+			for _, stat := range stats {
+				if !metricStat.MatchString(stat) {
+					problem.Error(w, r, "Unknown statistic "+strconv.Quote(stat), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		period := int32(defaultMetricPeriod)
+		if v := query.Get("period"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n%60 != 0 && n != 1 && n != 5 && n != 10 && n != 30 {
+				problem.Error(w, r, "period must be a multiple of 60, or 1, 5, 10, or 30", http.StatusBadRequest)
+				return
+			}
+			period = int32(n)
+		}
+
+		end := time.Now()
+		if v := query.Get("end"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				problem.Error(w, r, "end must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			end = t
+		}
+
+		start := end.Add(-defaultMetricWindow)
+		if v := query.Get("start"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				problem.Error(w, r, "start must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			start = t
+		}
+
+		if !start.Before(end) {
+			problem.Error(w, r, "start must be before end", http.StatusBadRequest)
+			return
+		}
+
+		metric := &cwtypes.Metric{
+			Namespace:  aws.String(namespace),
+			MetricName: aws.String(metricName),
+			Dimensions: dimensions,
+		}
+		input := &cloudwatch.GetMetricDataInput{
+			StartTime: aws.Time(start),
+			EndTime:   aws.Time(end),
+			ScanBy:    cwtypes.ScanByTimestampAscending,
+		}
+		series := make([]MetricSeries, len(stats))
+		for i, stat := range stats {
+			input.MetricDataQueries = append(input.MetricDataQueries, cwtypes.MetricDataQuery{
+				// Query IDs must start with a lowercase letter
+				Id: aws.String("m" + strconv.Itoa(i)),
+				MetricStat: &cwtypes.MetricStat{
+					Metric: metric,
+					Period: aws.Int32(period),
+					Stat:   aws.String(stat),
+				},
+			})
+			series[i] = MetricSeries{Stat: stat, Points: []MetricPoint{}}
+		}
+
+		logger.InfoContext(r.Context(), "getting CloudWatch metric data", "namespace", namespace, "metric", metricName, "stats", stats, "start", start, "end", end)
+
+		paginator := cloudwatch.NewGetMetricDataPaginator(cloudWatchClient, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to get CloudWatch metric data", "error", err, "namespace", namespace, "metric", metricName)
+				writeAWSError(w, r, err, "Failed to get metric data")
+				return
+			}
+			for _, result := range page.MetricDataResults {
+				i, err := strconv.Atoi(strings.TrimPrefix(aws.ToString(result.Id), "m"))
+				if err != nil || i < 0 || i >= len(series) {
+					continue
+				}
+				// Results continued on later pages carry on the same series
+				s := &series[i]
+				s.Label = aws.ToString(result.Label)
+				s.Status = string(result.StatusCode)
+				for j, ts := range result.Timestamps {
+					if j < len(result.Values) {
+						s.Points = append(s.Points, MetricPoint{Timestamp: ts, Value: result.Values[j]})
+					}
+				}
+			}
+		}
+
+		data := MetricData{
+			Namespace:  namespace,
+			MetricName: metricName,
+			Dimensions: dimensionMap(dimensions),
+			Start:      start,
+			End:        end,
+			Period:     period,
+			Series:     series,
+		}
+		if err := encode(w, r, http.StatusOK, data); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
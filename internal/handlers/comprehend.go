@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/comprehend"
+	comprehendtypes "github.com/aws/aws-sdk-go-v2/service/comprehend/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/models"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/store"
+)
+
+// maxComprehendTextSize is the most text entity and PII detection accept.
+// Sentiment detection accepts 5 KB and rejects more itself.
+const maxComprehendTextSize = 100000
+
+// defaultComprehendField is the record field analyzed when a request names
+// a record but no field.
+const defaultComprehendField = "name"
+
+// ComprehendRequest represents text to analyze: given as is, or as a
+// field of a record in the records table.
+type ComprehendRequest struct {
+	Text string `json:"text,omitempty" example:"The new dashboard is great, thanks Maria!"`
+	// RecordID names a record whose Field is analyzed instead of Text.
+	RecordID string `json:"recordId,omitempty" example:"01HZX3V8Q4K7M2N9P5R6S8T0W1"`
+	// Field is a string field of the record, name by default.
+	Field string `json:"field,omitempty" example:"name"`
+	// LanguageCode is the text's language, en by default. PII detection
+	// supports en and es.
+	LanguageCode string `json:"languageCode,omitempty" example:"en"`
+	// Redact also returns the text with the PII found replaced by its type,
+	// for PII detection.
+	Redact bool `json:"redact,omitempty" example:"false"`
+}
+
+// Valid validates the analysis request.
+func (r ComprehendRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	switch {
+	case r.Text == "" && r.RecordID == "":
+		problems["text"] = "text or recordId is required"
+	case r.Text != "" && r.RecordID != "":
+		problems["text"] = "send either text or recordId, not both"
+	case len(r.Text) > maxComprehendTextSize:
+		problems["text"] = "text must be at most 100 KB"
+	}
+	if r.Field != "" && r.RecordID == "" {
+		problems["field"] = "field only applies with recordId"
+	}
+	return problems
+}
+
+// ComprehendSentiment is the sentiment of a text.
+type ComprehendSentiment struct {
+	RecordID string `json:"recordId,omitempty" example:""`
+	// Sentiment is POSITIVE, NEGATIVE, NEUTRAL, or MIXED.
+	Sentiment string                   `json:"sentiment" example:"POSITIVE"`
+	Scores    ComprehendSentimentScore `json:"scores"`
+}
+
+// ComprehendSentimentScore is Comprehend's confidence, from 0 to 1, in each
+// sentiment.
+type ComprehendSentimentScore struct {
+	Positive float64 `json:"positive" example:"0.98"`
+	Negative float64 `json:"negative" example:"0.01"`
+	Neutral  float64 `json:"neutral" example:"0.01"`
+	Mixed    float64 `json:"mixed" example:"0"`
+}
+
+// ComprehendEntity is an entity, or piece of PII, found in a text.
+type ComprehendEntity struct {
+	Text string `json:"text" example:"Maria"`
+	// Type is PERSON, LOCATION, ORGANIZATION, DATE, and so on for
+	// entities, or EMAIL, PHONE, NAME, and so on for PII.
+	Type  string  `json:"type" example:"PERSON"`
+	Score float64 `json:"score" example:"0.99"`
+	// BeginOffset and EndOffset are the entity's position in the text, in
+	// characters.
+	BeginOffset int `json:"beginOffset" example:"35"`
+	EndOffset   int `json:"endOffset" example:"40"`
+}
+
+// ComprehendEntities are the entities, or pieces of PII, found in a text.
+type ComprehendEntities struct {
+	RecordID string             `json:"recordId,omitempty" example:""`
+	Entities []ComprehendEntity `json:"entities"`
+	// Redacted is the text with each piece of PII replaced by its type in
+	// brackets, if redaction was asked for.
+	Redacted string `json:"redacted,omitempty" example:"The new dashboard is great, thanks [NAME]!"`
+}
+
+// comprehendInput decodes r and returns the text it asks to analyze and its
+// language. It answers r and returns ok false if it can't.
+func comprehendInput(w http.ResponseWriter, r *http.Request, logger *slog.Logger, records store.Repository[models.DynamoDBRecord]) (req ComprehendRequest, text string, ok bool) {
+	req, problems, err := decodeValid[ComprehendRequest](r)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to decode analysis request", "error", err)
+		if len(problems) > 0 {
+			problem.Validation(w, r, problems)
+			return req, "", false
+		}
+		problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+		return req, "", false
+	}
+	if req.LanguageCode == "" {
+		req.LanguageCode = string(comprehendtypes.LanguageCodeEn)
+	}
+	if req.RecordID == "" {
+		return req, req.Text, true
+	}
+
+	field := req.Field
+	if field == "" {
+		field = defaultComprehendField
+	}
+	record, err := records.Get(r.Context(), req.RecordID, store.ReadOptions{})
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Error(w, r, "Record not found", http.StatusNotFound)
+			return req, "", false
+		}
+		logger.ErrorContext(r.Context(), "failed to get record", "error", err, "id", req.RecordID)
+		writeAWSError(w, r, err, "Failed to get record")
+		return req, "", false
+	}
+	selected, err := selectFields([]models.DynamoDBRecord{record}, []string{field})
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to project record", "error", err)
+		problem.Error(w, r, "Failed to process record", http.StatusInternalServerError)
+		return req, "", false
+	}
+	text, _ = selected[0][field].(string)
+	switch {
+	case text == "":
+		problem.Validation(w, r, map[string]string{"field": "field must name a non-empty string field of the record"})
+		return req, "", false
+	case len(text) > maxComprehendTextSize:
+		problem.Validation(w, r, map[string]string{"field": "field must be at most 100 KB"})
+		return req, "", false
+	}
+	return req, text, true
+}
+
+// HandleComprehendSentiment returns a handler that detects the sentiment
+// of a text.
+//
+//	@Summary		Detect sentiment
+//	@Description	Detect whether a text, of up to 5 KB, is positive, negative, neutral, or mixed. Send the text, or a recordId and field to analyze a record's field.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		ComprehendRequest	true	"Text to analyze"
+//	@Success		200		{object}	ComprehendSentiment
+//	@Failure		400		{object}	problem.Details	"Validation error, text too long, or unsupported language"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		404		{object}	problem.Details	"Record not found"
+//	@Failure		500		{object}	problem.Details	"Failed to detect sentiment"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/comprehend/sentiment [post]
+func HandleComprehendSentiment(logger *slog.Logger, comprehendClient *comprehend.Client, records store.Repository[models.DynamoDBRecord]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, text, ok := comprehendInput(w, r, logger, records)
+		if !ok {
+			return
+		}
+
+		result, err := comprehendClient.DetectSentiment(r.Context(), &comprehend.DetectSentimentInput{
+			Text:         aws.String(text),
+			LanguageCode: comprehendtypes.LanguageCode(req.LanguageCode),
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to detect sentiment", "error", err)
+			writeAWSError(w, r, err, "Failed to detect sentiment")
+			return
+		}
+
+		resp := ComprehendSentiment{RecordID: req.RecordID, Sentiment: string(result.Sentiment)}
+		if s := result.SentimentScore; s != nil {
+			resp.Scores = ComprehendSentimentScore{
+				Positive: float64(aws.ToFloat32(s.Positive)),
+				Negative: float64(aws.ToFloat32(s.Negative)),
+				Neutral:  float64(aws.ToFloat32(s.Neutral)),
+				Mixed:    float64(aws.ToFloat32(s.Mixed)),
+			}
+		}
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleComprehendEntities returns a handler that detects the entities in a
+// text.
+//
+//	@Summary		Detect entities
+//	@Description	Detect the people, places, organizations, dates, quantities, and other entities in a text. Send the text, or a recordId and field to analyze a record's field.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		ComprehendRequest	true	"Text to analyze"
+//	@Success		200		{object}	ComprehendEntities
+//	@Failure		400		{object}	problem.Details	"Validation error or unsupported language"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		404		{object}	problem.Details	"Record not found"
+//	@Failure		500		{object}	problem.Details	"Failed to detect entities"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/comprehend/entities [post]
+func HandleComprehendEntities(logger *slog.Logger, comprehendClient *comprehend.Client, records store.Repository[models.DynamoDBRecord]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, text, ok := comprehendInput(w, r, logger, records)
+		if !ok {
+			return
+		}
+
+		result, err := comprehendClient.DetectEntities(r.Context(), &comprehend.DetectEntitiesInput{
+			Text:         aws.String(text),
+			LanguageCode: comprehendtypes.LanguageCode(req.LanguageCode),
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to detect entities", "error", err)
+			writeAWSError(w, r, err, "Failed to detect entities")
+			return
+		}
+
+		resp := ComprehendEntities{RecordID: req.RecordID, Entities: make([]ComprehendEntity, 0, len(result.Entities))}
+		for _, e := range result.Entities {
+			resp.Entities = append(resp.Entities, ComprehendEntity{
+				Text:        aws.ToString(e.Text),
+				Type:        string(e.Type),
+				Score:       float64(aws.ToFloat32(e.Score)),
+				BeginOffset: int(aws.ToInt32(e.BeginOffset)),
+				EndOffset:   int(aws.ToInt32(e.EndOffset)),
+			})
+		}
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleComprehendPII returns a handler that detects the personally
+// identifiable information in a text.
+//
+//	@Summary		Detect PII
+//	@Description	Detect the names, email addresses, phone numbers, card numbers, and other PII in an English or Spanish text, and with redact=true, return the text with each replaced by its type. Send the text, or a recordId and field to analyze a record's field.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		ComprehendRequest	true	"Text to analyze"
+//	@Success		200		{object}	ComprehendEntities
+//	@Failure		400		{object}	problem.Details	"Validation error or unsupported language"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		404		{object}	problem.Details	"Record not found"
+//	@Failure		500		{object}	problem.Details	"Failed to detect PII"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/comprehend/pii [post]
+func HandleComprehendPII(logger *slog.Logger, comprehendClient *comprehend.Client, records store.Repository[models.DynamoDBRecord]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, text, ok := comprehendInput(w, r, logger, records)
+		if !ok {
+			return
+		}
+
+		result, err := comprehendClient.DetectPiiEntities(r.Context(), &comprehend.DetectPiiEntitiesInput{
+			Text:         aws.String(text),
+			LanguageCode: comprehendtypes.LanguageCode(req.LanguageCode),
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to detect PII", "error", err)
+			writeAWSError(w, r, err, "Failed to detect PII")
+			return
+		}
+
+		// PII entities come with offsets only
+		runes := []rune(text)
+		resp := ComprehendEntities{RecordID: req.RecordID, Entities: make([]ComprehendEntity, 0, len(result.Entities))}
+		for _, e := range result.Entities {
+			begin, end := int(aws.ToInt32(e.BeginOffset)), int(aws.ToInt32(e.EndOffset))
+			if begin < 0 || end > len(runes) || begin > end {
+				continue
+			}
+			resp.Entities = append(resp.Entities, ComprehendEntity{
+				Text:        string(runes[begin:end]),
+				Type:        string(e.Type),
+				Score:       float64(aws.ToFloat32(e.Score)),
+				BeginOffset: begin,
+				EndOffset:   end,
+			})
+		}
+		if req.Redact {
+			resp.Redacted = redactPII(runes, resp.Entities)
+		}
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// redactPII replaces each of entities in text with its type in brackets.
+// Entities overlapping an earlier one are skipped.
+func redactPII(text []rune, entities []ComprehendEntity) string {
+	entities = slices.Clone(entities)
+	slices.SortFunc(entities, func(a, b ComprehendEntity) int { return a.BeginOffset - b.BeginOffset })
+
+	var b strings.Builder
+	last := 0
+	for _, e := range entities {
+		if e.BeginOffset < last {
+			continue
+		}
+		b.WriteString(string(text[last:e.BeginOffset]))
+		b.WriteString("[" + e.Type + "]")
+		last = e.EndOffset
+	}
+	b.WriteString(string(text[last:]))
+	return b.String()
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	cetypes "github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// costDateLayout is the date format Cost Explorer takes.
+const costDateLayout = "2006-01-02"
+
+// untaggedCostGroup names the group of costs without the tag grouped by.
+const untaggedCostGroup = "(untagged)"
+
+// costDimensions are the dimensions costs can be grouped by, keyed by the
+// groupBy parameter's value.
+var costDimensions = map[string]cetypes.Dimension{
+	"service":        cetypes.DimensionService,
+	"region":         cetypes.DimensionRegion,
+	"usage-type":     cetypes.DimensionUsageType,
+	"linked-account": cetypes.DimensionLinkedAccount,
+}
+
+// costMetrics are the metrics summaries can report.
+var costMetrics = []string{"UnblendedCost", "AmortizedCost", "BlendedCost", "NetUnblendedCost", "NetAmortizedCost", "UsageQuantity"}
+
+// CostSummary is what was spent over a time range.
+type CostSummary struct {
+	Start       string `json:"start" example:"2024-02-01"`
+	End         string `json:"end" example:"2024-03-16"`
+	Granularity string `json:"granularity" example:"MONTHLY"`
+	Metric      string `json:"metric" example:"UnblendedCost"`
+	GroupBy     string `json:"groupBy" example:"service"`
+	// Total sums the periods.
+	Total   CostAmount   `json:"total"`
+	Periods []CostPeriod `json:"periods"`
+}
+
+// CostPeriod is what was spent in a day or month.
+type CostPeriod struct {
+	Start string `json:"start" example:"2024-02-01"`
+	End   string `json:"end" example:"2024-03-01"`
+	// Estimated is set for periods whose costs aren't final yet.
+	Estimated bool       `json:"estimated" example:"false"`
+	Total     CostAmount `json:"total"`
+	// Groups break the total down, largest first, unless groupBy is none.
+	Groups []CostGroup `json:"groups,omitempty"`
+}
+
+// CostGroup is what a service, tag value, or other group cost in a period.
+type CostGroup struct {
+	Key    string     `json:"key" example:"Amazon Simple Storage Service"`
+	Amount CostAmount `json:"amount"`
+}
+
+// CostAmount is an amount of money, or of usage for UsageQuantity.
+type CostAmount struct {
+	Amount float64 `json:"amount" example:"12.34"`
+	Unit   string  `json:"unit" example:"USD"`
+}
+
+// add adds v to a.
+func (a *CostAmount) add(v CostAmount) {
+	a.Amount += v.Amount
+	if a.Unit == "" {
+		a.Unit = v.Unit
+	}
+}
+
+// costAmount converts a Cost Explorer metric value.
+func costAmount(v cetypes.MetricValue) CostAmount {
+	amount, _ := strconv.ParseFloat(aws.ToString(v.Amount), 64)
+	return CostAmount{Amount: amount, Unit: aws.ToString(v.Unit)}
+}
+
+// HandleCostAndUsage returns a handler that summarizes the account's costs.
+//
+//	@Summary		Get cost and usage
+//	@Description	Get what the AWS account spent over a time range, by day or month, grouped by service, a cost allocation tag, or another dimension. Cost Explorer charges for every request, so summaries are cached for COST_CACHE_TTL.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			start		query		string	false	"First day, YYYY-MM-DD (default: first day of last month)"
+//	@Param			end			query		string	false	"Day after the last day, YYYY-MM-DD (default: tomorrow)"
+//	@Param			granularity	query		string	false	"DAILY or MONTHLY (default MONTHLY)"
+//	@Param			groupBy		query		string	false	"service (default), region, usage-type, linked-account, tag:<key>, or none"
+//	@Param			metric		query		string	false	"UnblendedCost (default), AmortizedCost, BlendedCost, NetUnblendedCost, NetAmortizedCost, or UsageQuantity"
+//	@Param			service		query		string	false	"Comma-separated services to include, e.g. Amazon Simple Storage Service,Amazon DynamoDB"
+//	@Success		200			{object}	CostSummary
+//	@Failure		400			{object}	problem.Details	"Invalid request"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		403			{object}	problem.Details	"Forbidden"
+//	@Failure		500			{object}	problem.Details	"Failed to get costs"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/costs [get]
+func HandleCostAndUsage(logger *slog.Logger, costExplorerClient *costexplorer.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		end := today.AddDate(0, 0, 1)
+		if v := query.Get("end"); v != "" {
+			t, err := time.Parse(costDateLayout, v)
+			if err != nil {
+				problem.Error(w, r, "end must be a YYYY-MM-DD date", http.StatusBadRequest)
+				return
+			}
+			end = t
+		}
+		start := time.Date(today.Year(), today.Month()-1, 1, 0, 0, 0, 0, time.UTC)
+		if v := query.Get("start"); v != "" {
+			t, err := time.Parse(costDateLayout, v)
+			if err != nil {
+				problem.Error(w, r, "start must be a YYYY-MM-DD date", http.StatusBadRequest)
+				return
+			}
+			start = t
+		}
+		if !start.Before(end) {
+			problem.Error(w, r, "start must be before end", http.StatusBadRequest)
+			return
+		}
+
+		granularity := cetypes.GranularityMonthly
+		if v := query.Get("granularity"); v != "" {
+			granularity = cetypes.Granularity(strings.ToUpper(v))
+			if granularity != cetypes.GranularityDaily && granularity != cetypes.GranularityMonthly {
+				problem.Error(w, r, "granularity must be DAILY or MONTHLY", http.StatusBadRequest)
+				return
+			}
+		}
+
+		metric := "UnblendedCost"
+		if v := query.Get("metric"); v != "" {
+			if !slices.Contains(costMetrics, v) {
+				problem.Error(w, r, "metric must be one of "+strings.Join(costMetrics, ", "), http.StatusBadRequest)
+				return
+			}
+			metric = v
+		}
+
+		groupBy := query.Get("groupBy")
+		if groupBy == "" {
+			groupBy = "service"
+		}
+		var groups []cetypes.GroupDefinition
+		tagKey, byTag := strings.CutPrefix(groupBy, "tag:")
+		switch {
+		case byTag && tagKey != "":
+			groups = []cetypes.GroupDefinition{{Type: cetypes.GroupDefinitionTypeTag, Key: aws.String(tagKey)}}
+		case groupBy == "none":
+		default:
+			dimension, ok := costDimensions[groupBy]
+			if !ok {
+				problem.Error(w, r, "groupBy must be service, region, usage-type, linked-account, tag:<key>, or none", http.StatusBadRequest)
+				return
+			}
+			groups = []cetypes.GroupDefinition{{Type: cetypes.GroupDefinitionTypeDimension, Key: aws.String(string(dimension))}}
+		}
+
+		input := &costexplorer.GetCostAndUsageInput{
+			TimePeriod: &cetypes.DateInterval{
+				Start: aws.String(start.Format(costDateLayout)),
+				End:   aws.String(end.Format(costDateLayout)),
+			},
+			Granularity: granularity,
+			Metrics:     []string{metric},
+			GroupBy:     groups,
+		}
+		if v := query.Get("service"); v != "" {
+			input.Filter = &cetypes.Expression{Dimensions: &cetypes.DimensionValues{
+				Key:    cetypes.DimensionService,
+				Values: strings.Split(v, ","),
+			}}
+		}
+
+		logger.InfoContext(r.Context(), "getting cost and usage", "start", start, "end", end, "granularity", granularity, "group_by", groupBy)
+
+		summary := CostSummary{
+			Start:       start.Format(costDateLayout),
+			End:         end.Format(costDateLayout),
+			Granularity: string(granularity),
+			Metric:      metric,
+			GroupBy:     groupBy,
+			Periods:     []CostPeriod{},
+		}
+		for {
+			result, err := costExplorerClient.GetCostAndUsage(r.Context(), input)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to get cost and usage", "error", err)
+				writeAWSError(w, r, err, "Failed to get costs")
+				return
+			}
+			for _, rt := range result.ResultsByTime {
+				// Pages split periods with many groups, so a period may
+				// continue the previous page's last one
+				var period *CostPeriod
+				start := ""
+				if rt.TimePeriod != nil {
+					start = aws.ToString(rt.TimePeriod.Start)
+				}
+				if n := len(summary.Periods); n > 0 && summary.Periods[n-1].Start == start {
+					period = &summary.Periods[n-1]
+				} else {
+					summary.Periods = append(summary.Periods, CostPeriod{Start: start, Estimated: rt.Estimated})
+					period = &summary.Periods[len(summary.Periods)-1]
+					if rt.TimePeriod != nil {
+						period.End = aws.ToString(rt.TimePeriod.End)
+					}
+				}
+
+				if len(groups) == 0 {
+					period.Total = costAmount(rt.Total[metric])
+				}
+				for _, g := range rt.Groups {
+					key := strings.Join(g.Keys, "/")
+					if byTag {
+						// Tag groups are keyed "<key>$<value>"
+						_, key, _ = strings.Cut(key, "$")
+						if key == "" {
+							key = untaggedCostGroup
+						}
+					}
+					amount := costAmount(g.Metrics[metric])
+					period.Total.add(amount)
+					period.Groups = append(period.Groups, CostGroup{Key: key, Amount: amount})
+				}
+			}
+
+			if result.NextPageToken == nil {
+				break
+			}
+			input.NextPageToken = result.NextPageToken
+		}
+
+		for i := range summary.Periods {
+			period := &summary.Periods[i]
+			slices.SortFunc(period.Groups, func(a, b CostGroup) int {
+				switch {
+				case a.Amount.Amount > b.Amount.Amount:
+					return -1
+				case a.Amount.Amount < b.Amount.Amount:
+					return 1
+				}
+				return strings.Compare(a.Key, b.Key)
+			})
+			summary.Total.add(period.Total)
+		}
+
+		if err := encode(w, r, http.StatusOK, summary); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
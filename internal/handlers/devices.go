@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// DeviceService defines the interface for managing the signed-in user's
+// remembered devices.
+type DeviceService interface {
+	RememberDevice(ctx context.Context, accessToken string, device auth.NewDevice, name string) (*auth.DeviceCredentials, error)
+	ListDevices(ctx context.Context, accessToken string) ([]auth.Device, error)
+	ForgetDevice(ctx context.Context, accessToken, deviceKey string) error
+}
+
+// RememberDeviceRequest represents a request to remember the device a login
+// returned in tokens.new_device.
+type RememberDeviceRequest struct {
+	DeviceKey      string `json:"device_key" example:"us-east-1_a1b2c3d4-5678-90ab-cdef-EXAMPLE11111"`
+	DeviceGroupKey string `json:"device_group_key" example:"-abcdEFGH"`
+	Name           string `json:"name,omitempty" example:"Firefox on Linux"`
+}
+
+// Valid validates the remember device request.
+func (r RememberDeviceRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.DeviceKey == "" {
+		problems["device_key"] = "device_key is required"
+	}
+	if r.DeviceGroupKey == "" {
+		problems["device_group_key"] = "device_group_key is required"
+	}
+	if len(r.Name) > 256 {
+		problems["name"] = "name must be 256 characters or less"
+	}
+
+	return problems
+}
+
+// RememberDeviceResponse represents the remember device response.
+type RememberDeviceResponse struct {
+	Message string `json:"message"`
+	// Device must be stored by the client and sent with later logins.
+	Device *auth.DeviceCredentials `json:"device"`
+}
+
+// ListDevicesResponse represents the list devices response.
+type ListDevicesResponse struct {
+	Devices []auth.Device `json:"devices"`
+}
+
+// HandleRememberDevice returns a handler that remembers the device the
+// signed-in user logged in from.
+//
+//	@Summary		Remember this device
+//	@Description	Remember the device a login returned in tokens.new_device. Store the returned credentials and send them as "device" with later logins to skip MFA, and send device_key when refreshing tokens.
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		RememberDeviceRequest	true	"Device from the login response"
+//	@Success		200		{object}	RememberDeviceResponse
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		404		{object}	problem.Details	"Device not found"
+//	@Failure		501		{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/me/devices [post]
+func HandleRememberDevice(logger *slog.Logger, deviceService DeviceService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, err := auth.GetAccessToken(r.Context())
+		if err != nil {
+			problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, problems, err := decodeValid[RememberDeviceRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode remember device request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		device := auth.NewDevice{DeviceKey: req.DeviceKey, DeviceGroupKey: req.DeviceGroupKey}
+		creds, err := deviceService.RememberDevice(r.Context(), accessToken, device, req.Name)
+		if err != nil {
+			handleDeviceError(w, r, logger, "remember device", err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if err := encode(w, r, http.StatusOK, RememberDeviceResponse{
+			Message: "Device remembered",
+			Device:  creds,
+		}); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleListDevices returns a handler that lists the signed-in user's devices.
+//
+//	@Summary		List my devices
+//	@Description	List the devices tracked for the signed-in user and whether each is remembered.
+//	@Tags			auth
+//	@Produce		json
+//	@Success		200	{object}	ListDevicesResponse
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		501	{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/me/devices [get]
+func HandleListDevices(logger *slog.Logger, deviceService DeviceService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, err := auth.GetAccessToken(r.Context())
+		if err != nil {
+			problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		devices, err := deviceService.ListDevices(r.Context(), accessToken)
+		if err != nil {
+			handleDeviceError(w, r, logger, "list devices", err)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, ListDevicesResponse{Devices: devices}); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleForgetDevice returns a handler that forgets one of the signed-in
+// user's devices.
+//
+//	@Summary		Forget a device
+//	@Description	Stop tracking a device. Logins from it need MFA again and its stored credentials stop working.
+//	@Tags			auth
+//	@Param			deviceKey	path	string	true	"Device key"
+//	@Success		204
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		404	{object}	problem.Details	"Device not found"
+//	@Failure		501	{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/me/devices/{deviceKey} [delete]
+func HandleForgetDevice(logger *slog.Logger, deviceService DeviceService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, err := auth.GetAccessToken(r.Context())
+		if err != nil {
+			problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := deviceService.ForgetDevice(r.Context(), accessToken, r.PathValue("deviceKey")); err != nil {
+			handleDeviceError(w, r, logger, "forget device", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleDeviceError writes the response for a failed device operation.
+func handleDeviceError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, op string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrDeviceNotFound):
+		problem.Error(w, r, "device not found", http.StatusNotFound)
+	case errors.Is(err, auth.ErrInvalidToken):
+		problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrNotSupported):
+		problem.Error(w, r, "remembered devices are not supported by the identity provider", http.StatusNotImplemented)
+	default:
+		logger.ErrorContext(r.Context(), op+" failed", "error", err)
+		problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
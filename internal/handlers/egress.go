@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/egress"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// HandleEgressStats returns a handler that reports outbound call counters per destination.
+//
+//	@Summary		Get outbound call stats
+//	@Description	Get request, retry, and failure counts, circuit breaker state, and average latency for every host the server has called out to since it started.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		egress.Stats
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/egress [get]
+func HandleEgressStats(logger *slog.Logger, client *egress.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := encode(w, r, http.StatusOK, client.Stats()); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/forwarded"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+const (
+	// oauthStateCookie holds the state and PKCE code verifier of a federated
+	// sign-in between the redirect to the identity provider and the code
+	// exchange.
+	oauthStateCookie = "oauth_state"
+	// oauthStateTTL is how long a user has to finish signing in.
+	oauthStateTTL = 10 * time.Minute
+)
+
+// FederationService defines the interface for federated sign-in.
+type FederationService interface {
+	AuthorizationURL(ctx context.Context, provider, redirectURI, state, codeChallenge string) (string, error)
+	ExchangeAuthorizationCode(ctx context.Context, code, redirectURI, codeVerifier string) (*auth.Tokens, error)
+	ValidateToken(ctx context.Context, token string) (*auth.Claims, error)
+}
+
+// OAuthTokenRequest represents the authorization code returned to the
+// redirect URI.
+type OAuthTokenRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// Valid validates the OAuth token request.
+func (r OAuthTokenRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Code == "" {
+		problems["code"] = "code is required"
+	}
+	if r.State == "" {
+		problems["state"] = "state is required"
+	}
+
+	return problems
+}
+
+// OAuthTokenResponse represents the federated sign-in response.
+type OAuthTokenResponse struct {
+	Message string       `json:"message"`
+	Tokens  *auth.Tokens `json:"tokens"`
+	// Username identifies the user when refreshing tokens, e.g.
+	// "Google_110169484474386276334".
+	Username string `json:"username" example:"Google_110169484474386276334"`
+	Provider string `json:"provider,omitempty" example:"Google"`
+}
+
+// HandleOAuthAuthorize returns a handler that starts federated sign-in by
+// redirecting to a social identity provider.
+//
+//	@Summary		Start federated sign-in
+//	@Description	Redirect to a social identity provider, such as Google, to sign in. The provider redirects back to the configured redirect URI with a code and state to exchange at /api/v1/auth/oauth/token.
+//	@Tags			auth
+//	@Param			provider	path	string	true	"Identity provider, e.g. Google"
+//	@Success		302
+//	@Failure		404	{object}	problem.Details	"Unknown identity provider"
+//	@Failure		501	{object}	problem.Details	"Not supported by the identity provider"
+//	@Router			/api/v1/auth/oauth/{provider} [get]
+func HandleOAuthAuthorize(logger *slog.Logger, federation FederationService, cfg config.FederationConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider := r.PathValue("provider")
+		if !slices.Contains(cfg.Providers, provider) {
+			problem.Error(w, r, "unknown identity provider", http.StatusNotFound)
+			return
+		}
+
+		state := rand.Text()
+		verifier := rand.Text() + rand.Text()
+		challenge := sha256.Sum256([]byte(verifier))
+
+		authURL, err := federation.AuthorizationURL(r.Context(), provider, cfg.RedirectURI, state,
+			base64.RawURLEncoding.EncodeToString(challenge[:]))
+		if err != nil {
+			if errors.Is(err, auth.ErrNotSupported) {
+				encodeFederationNotSupported(w, r)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to build authorization URL", "error", err, "provider", provider)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthStateCookie,
+			Value:    state + "." + verifier,
+			Path:     "/api/v1/auth/oauth",
+			MaxAge:   int(oauthStateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   secureCookie(r, cfg),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// HandleOAuthToken returns a handler that finishes federated sign-in by
+// exchanging the authorization code for tokens.
+//
+//	@Summary		Finish federated sign-in
+//	@Description	Exchange the code and state the identity provider sent to the redirect URI for tokens. Must be called from the browser that started sign-in. Federated users refresh tokens with the returned username.
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		OAuthTokenRequest	true	"Authorization code and state"
+//	@Success		200		{object}	OAuthTokenResponse
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Invalid state or authorization code"
+//	@Failure		501		{object}	problem.Details	"Not supported by the identity provider"
+//	@Router			/api/v1/auth/oauth/token [post]
+func HandleOAuthToken(logger *slog.Logger, federation FederationService, cfg config.FederationConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[OAuthTokenRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode oauth token request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		// The state must match the cookie set when sign-in started, so a
+		// code can't be injected into another browser's session.
+		var state, verifier string
+		if cookie, err := r.Cookie(oauthStateCookie); err == nil {
+			state, verifier, _ = strings.Cut(cookie.Value, ".")
+		}
+		if verifier == "" || subtle.ConstantTimeCompare([]byte(state), []byte(req.State)) != 1 {
+			problem.Error(w, r, "invalid or expired sign-in state, start again", http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthStateCookie,
+			Path:     "/api/v1/auth/oauth",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   secureCookie(r, cfg),
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		tokens, err := federation.ExchangeAuthorizationCode(r.Context(), req.Code, cfg.RedirectURI, verifier)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidAuthorizationCode) {
+				problem.Error(w, r, "invalid authorization code", http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, auth.ErrNotSupported) {
+				encodeFederationNotSupported(w, r)
+				return
+			}
+			logger.ErrorContext(r.Context(), "authorization code exchange failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		claims, err := federation.ValidateToken(r.Context(), tokens.AccessToken)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "federated access token rejected", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "federated sign-in succeeded", "user_id", claims.UserID, "provider", claims.Provider)
+
+		resp := OAuthTokenResponse{
+			Message:  "Sign-in successful",
+			Tokens:   tokens,
+			Username: claims.Username,
+			Provider: claims.Provider,
+		}
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// encodeFederationNotSupported reports that the identity provider can't
+// sign users in through social identity providers.
+func encodeFederationNotSupported(w http.ResponseWriter, r *http.Request) {
+	problem.Error(w, r, "federated sign-in is not supported by the identity provider", http.StatusNotImplemented)
+}
+
+// secureCookie reports whether the sign-in state cookie should be Secure:
+// when the request came over HTTPS, directly or through a trusted proxy, or
+// the identity provider sends users back to an HTTPS redirect URI.
+func secureCookie(r *http.Request, cfg config.FederationConfig) bool {
+	return forwarded.Secure(r) || strings.HasPrefix(cfg.RedirectURI, "https://")
+}
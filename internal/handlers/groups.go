@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// GroupService defines the interface for managing user groups.
+type GroupService interface {
+	CreateGroup(ctx context.Context, name, description string, precedence *int32) (*auth.Group, error)
+	ListGroups(ctx context.Context) ([]auth.Group, error)
+	AddUserToGroup(ctx context.Context, email, group string) error
+	RemoveUserFromGroup(ctx context.Context, email, group string) error
+}
+
+// CreateGroupRequest represents a request to create a group.
+type CreateGroupRequest struct {
+	Name        string `json:"name" example:"editors"`
+	Description string `json:"description,omitempty" example:"Can edit items"`
+	Precedence  *int32 `json:"precedence,omitempty" example:"10"`
+}
+
+// Valid validates the create group request.
+func (r CreateGroupRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Name == "" {
+		problems["name"] = "name is required"
+	} else if len(r.Name) > 128 {
+		problems["name"] = "name must be 128 characters or less"
+	} else if strings.ContainsAny(r.Name, " \t\r\n") {
+		problems["name"] = "name must not contain whitespace"
+	}
+	if len(r.Description) > 2048 {
+		problems["description"] = "description must be 2048 characters or less"
+	}
+	if r.Precedence != nil && *r.Precedence < 0 {
+		problems["precedence"] = "precedence must not be negative"
+	}
+
+	return problems
+}
+
+// ListGroupsResponse represents the list groups response.
+type ListGroupsResponse struct {
+	Groups []auth.Group `json:"groups"`
+}
+
+// HandleListGroups returns a handler that lists user groups.
+//
+//	@Summary		List groups
+//	@Description	List the user pool's groups. A user's roles are the groups they belong to.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	ListGroupsResponse
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		501	{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/groups [get]
+func HandleListGroups(logger *slog.Logger, groupService GroupService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groups, err := groupService.ListGroups(r.Context())
+		if err != nil {
+			if errors.Is(err, auth.ErrNotSupported) {
+				encodeGroupsNotSupported(w, r)
+				return
+			}
+			logger.ErrorContext(r.Context(), "list groups failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, ListGroupsResponse{Groups: groups}); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleCreateGroup returns a handler that creates a user group.
+//
+//	@Summary		Create group
+//	@Description	Create a user pool group. Members get the group name as a role, so a group named "admin" grants admin access.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateGroupRequest	true	"Group"
+//	@Success		201		{object}	auth.Group
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Failure		409		{object}	problem.Details	"Group already exists"
+//	@Failure		501		{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/groups [post]
+func HandleCreateGroup(logger *slog.Logger, groupService GroupService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[CreateGroupRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode create group request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		group, err := groupService.CreateGroup(r.Context(), req.Name, req.Description, req.Precedence)
+		if err != nil {
+			if errors.Is(err, auth.ErrGroupExists) {
+				problem.Error(w, r, "group already exists", http.StatusConflict)
+				return
+			}
+			if errors.Is(err, auth.ErrNotSupported) {
+				encodeGroupsNotSupported(w, r)
+				return
+			}
+			logger.ErrorContext(r.Context(), "create group failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		userID, _ := auth.GetUserID(r.Context())
+		logger.InfoContext(r.Context(), "group created by admin", "group", group.Name, "user_id", userID)
+
+		if err := encode(w, r, http.StatusCreated, group); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleAddGroupMember returns a handler that adds a user to a group.
+//
+//	@Summary		Add user to group
+//	@Description	Add a user to a group. The user gets the role from their next login or token refresh.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			groupName	path	string	true	"Group name"
+//	@Param			email		path	string	true	"User email"
+//	@Success		204
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		404	{object}	problem.Details	"Group or user not found"
+//	@Failure		501	{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/groups/{groupName}/members/{email} [put]
+func HandleAddGroupMember(logger *slog.Logger, groupService GroupService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := r.PathValue("groupName")
+		email := r.PathValue("email")
+
+		if err := groupService.AddUserToGroup(r.Context(), email, group); err != nil {
+			handleGroupMembershipError(w, r, logger, "add user to group", err)
+			return
+		}
+
+		userID, _ := auth.GetUserID(r.Context())
+		logger.InfoContext(r.Context(), "user added to group by admin", "group", group, "email", email, "user_id", userID)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// HandleRemoveGroupMember returns a handler that removes a user from a group.
+//
+//	@Summary		Remove user from group
+//	@Description	Remove a user from a group. Access tokens already issued keep the role until they expire.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			groupName	path	string	true	"Group name"
+//	@Param			email		path	string	true	"User email"
+//	@Success		204
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		404	{object}	problem.Details	"Group or user not found"
+//	@Failure		501	{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/groups/{groupName}/members/{email} [delete]
+func HandleRemoveGroupMember(logger *slog.Logger, groupService GroupService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := r.PathValue("groupName")
+		email := r.PathValue("email")
+
+		if err := groupService.RemoveUserFromGroup(r.Context(), email, group); err != nil {
+			handleGroupMembershipError(w, r, logger, "remove user from group", err)
+			return
+		}
+
+		userID, _ := auth.GetUserID(r.Context())
+		logger.InfoContext(r.Context(), "user removed from group by admin", "group", group, "email", email, "user_id", userID)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// handleGroupMembershipError writes the response for a failed membership change.
+func handleGroupMembershipError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, op string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrGroupNotFound):
+		problem.Error(w, r, "group not found", http.StatusNotFound)
+	case errors.Is(err, auth.ErrUserNotFound):
+		problem.Error(w, r, "user not found", http.StatusNotFound)
+	case errors.Is(err, auth.ErrNotSupported):
+		encodeGroupsNotSupported(w, r)
+	default:
+		logger.ErrorContext(r.Context(), op+" failed", "error", err)
+		problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// encodeGroupsNotSupported reports that the identity provider has no groups to manage.
+func encodeGroupsNotSupported(w http.ResponseWriter, r *http.Request) {
+	problem.Error(w, r, "managing groups is not supported by the identity provider", http.StatusNotImplemented)
+}
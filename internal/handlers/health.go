@@ -23,7 +23,7 @@ type HealthResponse struct {
 //	@Router			/healthz [get]
 func HandleHealthz(logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger.Debug("health check")
+		logger.DebugContext(r.Context(), "health check")
 
 		response := HealthResponse{
 			Status:    "healthy",
@@ -34,7 +34,7 @@ func HandleHealthz(logger *slog.Logger) http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			logger.Error("failed to encode health response", "error", err)
+			logger.ErrorContext(r.Context(), "failed to encode health response", "error", err)
 		}
 	}
 }
@@ -4,7 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/store"
 )
 
 // Validator is an interface for validating request payloads.
@@ -12,11 +19,29 @@ type Validator interface {
 	Valid(ctx context.Context) map[string]string
 }
 
-// encode encodes a value as JSON and writes it to the response.
+// encode writes a value to the response in the media type the request's
+// Accept header prefers: JSON, or for lists NDJSON or CSV.
 func encode[T any](w http.ResponseWriter, r *http.Request, status int, v T) error {
-	w.Header().Set("Content-Type", "application/json")
+	mediaType := negotiateMediaType(r.Header.Get("Accept"), v)
+	w.Header().Add("Vary", "Accept")
+	if mediaType == mediaTypeJSON {
+		w.Header().Set("Content-Type", mediaTypeJSON)
+		w.WriteHeader(status)
+		return json.NewEncoder(w).Encode(v)
+	}
+
+	rows, err := rawRows(rowsOf(v))
+	if err != nil {
+		return err
+	}
+	if mediaType == mediaTypeCSV {
+		w.Header().Set("Content-Type", mediaTypeCSV+"; charset=utf-8")
+		w.WriteHeader(status)
+		return writeCSV(w, rows)
+	}
+	w.Header().Set("Content-Type", mediaTypeNDJSON)
 	w.WriteHeader(status)
-	return json.NewEncoder(w).Encode(v)
+	return writeNDJSON(w, rows)
 }
 
 // decode decodes a request body into the provided type.
@@ -35,3 +60,121 @@ func decodeValid[T Validator](r *http.Request) (T, map[string]string, error) {
 	}
 	return v, nil, nil
 }
+
+// parseFields splits a comma-separated fields query parameter into attribute names.
+func parseFields(fields string) ([]string, error) {
+	var names []string
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !store.ValidFieldName(field) {
+			return nil, fmt.Errorf("invalid field name %q", field)
+		}
+		names = append(names, field)
+	}
+	return names, nil
+}
+
+// readOptions builds store read options from the fields and consistent query parameters.
+func readOptions(r *http.Request) (store.ReadOptions, error) {
+	query := r.URL.Query()
+
+	fields, err := parseFields(query.Get("fields"))
+	if err != nil {
+		return store.ReadOptions{}, err
+	}
+
+	var consistent bool
+	if v := query.Get("consistent"); v != "" {
+		consistent, err = strconv.ParseBool(v)
+		if err != nil {
+			return store.ReadOptions{}, fmt.Errorf("consistent must be true or false")
+		}
+	}
+
+	return store.ReadOptions{Fields: fields, ConsistentRead: consistent}, nil
+}
+
+// parseFilters parses filter query parameters of the form field:op:value, e.g.
+// name:begins_with:Sample or created_at:gt:1700000000. Values that look like
+// numbers are compared as numbers; wrap a value in double quotes to compare it
+// as a string.
+func parseFilters(params []string) ([]store.Filter, error) {
+	filters := make([]store.Filter, 0, len(params))
+	for _, param := range params {
+		field, rest, ok := strings.Cut(param, ":")
+		if !ok {
+			return nil, fmt.Errorf("filter %q must be field:op:value", param)
+		}
+		op, raw, ok := strings.Cut(rest, ":")
+		if !ok {
+			return nil, fmt.Errorf("filter %q must be field:op:value", param)
+		}
+		if !store.ValidFieldName(field) {
+			return nil, fmt.Errorf("invalid field name %q", field)
+		}
+
+		switch store.FilterOp(op) {
+		case store.OpEqual, store.OpNotEqual, store.OpLess, store.OpLessEqual,
+			store.OpGreater, store.OpGreaterEqual, store.OpBeginsWith, store.OpContains:
+		default:
+			return nil, fmt.Errorf("unknown filter operator %q", op)
+		}
+
+		var value any = raw
+		if unquoted, err := strconv.Unquote(raw); err == nil && strings.HasPrefix(raw, `"`) {
+			value = unquoted
+		} else if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			value = n
+		} else if f, err := strconv.ParseFloat(raw, 64); err == nil {
+			value = f
+		}
+
+		filters = append(filters, store.Filter{Field: field, Op: store.FilterOp(op), Value: value})
+	}
+	return filters, nil
+}
+
+// selectFields converts records to maps that hold only the listed JSON fields.
+func selectFields[T any](records []T, fields []string) ([]map[string]interface{}, error) {
+	selected := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]interface{}
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+
+		m := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if v, ok := all[field]; ok {
+				m[field] = v
+			}
+		}
+		selected = append(selected, m)
+	}
+	return selected, nil
+}
+
+// regionalClients returns the clients for the region the request's region
+// query parameter names, or the server's region if it has none. It writes a
+// 400 response and returns nil if the region isn't valid, or a 451 if the
+// data residency policy blocks it.
+func regionalClients(w http.ResponseWriter, r *http.Request, regions *awsclients.RegionPool) *awsclients.RegionalClients {
+	region := r.URL.Query().Get("region")
+	clients, err := regions.Get(region)
+	if errors.Is(err, awsclients.ErrRegionNotAllowed) {
+		writeResidencyError(w, r, region, regions.Residency())
+		return nil
+	}
+	if err != nil {
+		problem.Error(w, r, "region must be an AWS region, such as us-east-1", http.StatusBadRequest)
+		return nil
+	}
+	return clients
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/pmollerus23/go-aws-server/internal/imaging"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// HandleS3AnalyzeObject returns a handler that analyzes an image in S3 with
+// Rekognition.
+//
+//	@Summary		Analyze an image in S3
+//	@Description	Detect the labels and moderation labels of a JPEG or PNG object with Rekognition. With store=true, the results are also kept as the object's rekognition-labels and rekognition-moderation tags, or in the results table, as uploads' are.
+//	@Tags			aws
+//	@Produce		json
+//	@Param			bucketName	path		string	true	"Bucket name"
+//	@Param			key			path		string	true	"Object key"
+//	@Param			store		query		bool	false	"Store the results"
+//	@Success		200			{object}	imaging.Result
+//	@Failure		400			{object}	problem.Details	"Not a JPEG or PNG image"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		404			{object}	problem.Details	"Object not found"
+//	@Failure		500			{object}	problem.Details	"Failed to analyze image"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/s3/buckets/{bucketName}/analyze/{key} [post]
+func HandleS3AnalyzeObject(logger *slog.Logger, images *imaging.Analyzer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucketName, key := r.PathValue("bucketName"), r.PathValue("key")
+		store, _ := strconv.ParseBool(r.URL.Query().Get("store"))
+
+		result, err := images.Analyze(r.Context(), bucketName, key)
+		if err != nil {
+			if errors.Is(err, imaging.ErrNotImage) {
+				problem.Error(w, r, err.Error(), http.StatusBadRequest)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to analyze image", "error", err, "bucket", bucketName, "key", key)
+			writeAWSError(w, r, err, "Failed to analyze image")
+			return
+		}
+		if store {
+			if err := images.Store(r.Context(), result); err != nil {
+				logger.ErrorContext(r.Context(), "failed to store image analysis", "error", err, "bucket", bucketName, "key", key)
+				writeAWSError(w, r, err, "Failed to store image analysis")
+				return
+			}
+		}
+
+		if err := encode(w, r, http.StatusOK, result); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
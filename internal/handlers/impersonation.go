@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/audit"
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/impersonation"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// UserLookupService defines the interface for looking up users.
+type UserLookupService interface {
+	LookupUser(ctx context.Context, email string) (*auth.User, error)
+}
+
+// ImpersonateRequest represents a request to impersonate a user.
+type ImpersonateRequest struct {
+	// Reason is recorded in the audit log, e.g. a support ticket.
+	Reason string `json:"reason" example:"SUP-1234: records list is empty"`
+}
+
+// Valid validates the impersonate request.
+func (r ImpersonateRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Reason == "" {
+		problems["reason"] = "reason is required"
+	} else if len(r.Reason) > 512 {
+		problems["reason"] = "reason must be 512 characters or less"
+	}
+
+	return problems
+}
+
+// ImpersonateResponse represents an impersonation token.
+type ImpersonateResponse struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type" example:"Bearer"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	User        auth.User `json:"user"`
+}
+
+// HandleImpersonateUser returns a handler that issues an impersonation
+// token for a user.
+//
+//	@Summary		Impersonate user
+//	@Description	Issue a short-lived token that authenticates as the user, to reproduce problems only they see. Requests made with it have the user's roles, never admin rights, and can't call endpoints that act at the identity provider, such as changing the password. The token and every request made with it are logged with the admin's ID. Admins can't be impersonated.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			email	path		string				true	"User email"
+//	@Param			request	body		ImpersonateRequest	true	"Reason"
+//	@Success		201		{object}	ImpersonateResponse
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden, or the user is an admin"
+//	@Failure		404		{object}	problem.Details	"User not found"
+//	@Failure		501		{object}	problem.Details	"Not supported by the identity provider"
+//	@Failure		503		{object}	problem.Details	"Impersonation is not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/users/{email}/impersonate [post]
+func HandleImpersonateUser(logger *slog.Logger, users UserLookupService, tokens *impersonation.Service, events *audit.Log) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tokens == nil {
+			problem.Error(w, r, "Impersonation is not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		admin, err := auth.GetUser(r.Context())
+		if err != nil {
+			problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, problems, err := decodeValid[ImpersonateRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode impersonate request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		email := r.PathValue("email")
+		event := audit.Event{Type: audit.EventImpersonate, Email: email, Reason: req.Reason}
+
+		target, err := users.LookupUser(r.Context(), email)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrUserNotFound):
+				problem.Error(w, r, "user not found", http.StatusNotFound)
+			case errors.Is(err, auth.ErrNotSupported):
+				problem.Error(w, r, "impersonation is not supported by the identity provider", http.StatusNotImplemented)
+			default:
+				logger.ErrorContext(r.Context(), "failed to look up user", "error", err)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		token, err := tokens.Issue(target, admin, req.Reason)
+		if err != nil {
+			if errors.Is(err, impersonation.ErrAdminTarget) {
+				event.Outcome = audit.OutcomeFailure
+				event.Reason = err.Error()
+				events.Record(r, event)
+				problem.Error(w, r, "admins can't be impersonated", http.StatusForbidden)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to issue impersonation token", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		event.Outcome = audit.OutcomeSuccess
+		events.Record(r, event)
+
+		w.Header().Set("Cache-Control", "no-store")
+		resp := ImpersonateResponse{
+			AccessToken: token.Token,
+			TokenType:   "Bearer",
+			ExpiresAt:   token.ExpiresAt,
+			User:        *target,
+		}
+		if err := encode(w, r, http.StatusCreated, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pmollerus23/go-aws-server/internal/importer"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/sse"
+)
+
+// HandleDynamoDBImportCSV returns a handler that starts importing a CSV file into a DynamoDB table.
+//
+//	@Summary		Import CSV into DynamoDB
+//	@Description	Upload a CSV file whose first row is a header and write its rows to a table in the background. An optional mapping renames columns and sets their types (S, N, or BOOL); with a mapping, unlisted columns are skipped. Poll the returned job for progress.
+//	@Tags			aws
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			tableName	path		string	true	"Table name"
+//	@Param			file		formData	file	true	"CSV file"
+//	@Param			mapping		formData	string	false	"Column mapping, e.g. {\"columns\":{\"Price\":{\"attribute\":\"price\",\"type\":\"N\"}}}"
+//	@Success		202			{object}	importer.Progress
+//	@Failure		400			{object}	problem.Details	"Invalid file or mapping"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		404			{object}	problem.Details	"Table not found"
+//	@Failure		500			{object}	problem.Details	"Failed to start import"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/dynamodb/tables/{tableName}/import [post]
+func HandleDynamoDBImportCSV(logger *slog.Logger, imports *importer.Importer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tableName := r.PathValue("tableName")
+
+		// Parse multipart form (32MB max)
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			logger.ErrorContext(r.Context(), "failed to parse multipart form", "error", err)
+			problem.Error(w, r, "Failed to parse form data", http.StatusBadRequest)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			problem.Error(w, r, "File is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		var mapping *importer.Mapping
+		if v := r.FormValue("mapping"); v != "" {
+			mapping = &importer.Mapping{}
+			if err := json.Unmarshal([]byte(v), mapping); err != nil {
+				problem.Error(w, r, "mapping must be a JSON object", http.StatusBadRequest)
+				return
+			}
+		}
+
+		logger.InfoContext(r.Context(), "starting CSV import", "table", tableName, "filename", header.Filename, "size", header.Size)
+
+		job, err := imports.Start(r.Context(), tableName, file, mapping)
+		if err != nil {
+			var notFound *ddbtypes.ResourceNotFoundException
+			switch {
+			case errors.Is(err, importer.ErrInvalidInput):
+				problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			case errors.As(err, &notFound):
+				problem.Error(w, r, "Table not found", http.StatusNotFound)
+			default:
+				logger.ErrorContext(r.Context(), "failed to start CSV import", "error", err, "table", tableName)
+				problem.Error(w, r, "Failed to start import", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := encode(w, r, http.StatusAccepted, job.Progress()); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleDynamoDBGetImport returns a handler that reports the progress of a CSV import.
+//
+//	@Summary		Get CSV import progress
+//	@Description	Get the status and row counts of a CSV import job.
+//	@Tags			aws
+//	@Produce		json
+//	@Param			id	path		string	true	"Import job ID"
+//	@Success		200	{object}	importer.Progress
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		404	{object}	problem.Details	"Import not found"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/dynamodb/imports/{id} [get]
+func HandleDynamoDBGetImport(logger *slog.Logger, imports *importer.Importer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job, err := imports.Job(r.PathValue("id"))
+		if err != nil {
+			problem.Error(w, r, "Import not found", http.StatusNotFound)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, job.Progress()); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleDynamoDBImportEvents returns a handler that streams the progress of
+// a CSV import as Server-Sent Events.
+//
+//	@Summary		Stream CSV import progress
+//	@Description	Stream "progress" events with the import's status and row counts as they change, at most four times a second, then a final "done" event. Idle streams get a heartbeat comment every 15 seconds. Event IDs are progress versions: a client that reconnects with Last-Event-ID only gets an event once there is newer progress. EventSource can't send the Authorization header, so browsers need a fetch-based client.
+//	@Tags			aws
+//	@Produce		text/event-stream
+//	@Param			id				path		string	true	"Import job ID"
+//	@Param			Last-Event-ID	header		string	false	"ID of the last event received, when reconnecting"
+//	@Success		200				{object}	importer.Progress
+//	@Failure		401				{object}	problem.Details	"Unauthorized"
+//	@Failure		404				{object}	problem.Details	"Import not found"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/dynamodb/imports/{id}/events [get]
+func HandleDynamoDBImportEvents(logger *slog.Logger, imports *importer.Importer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job, err := imports.Job(r.PathValue("id"))
+		if err != nil {
+			problem.Error(w, r, "Import not found", http.StatusNotFound)
+			return
+		}
+
+		err = sse.ServeProgress(w, r, sse.SourceFunc(func() (any, uint64, bool, <-chan struct{}) {
+			progress, version, changed := job.Watch()
+			return progress, version, progress.Status != importer.StatusRunning, changed
+		}))
+		if err != nil {
+			logger.WarnContext(r.Context(), "import progress stream ended", "error", err, "job_id", job.Progress().ID)
+		}
+	})
+}
+
+// HandleDynamoDBImportErrors returns a handler that downloads the rejected rows of a CSV import.
+//
+//	@Summary		Download CSV import errors
+//	@Description	Download a CSV of the rows rejected so far, with the row number and reason followed by the original columns.
+//	@Tags			aws
+//	@Produce		text/csv
+//	@Param			id	path		string			true	"Import job ID"
+//	@Success		200	{file}		file			"Error report"
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		404	{object}	problem.Details	"Import not found"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/dynamodb/imports/{id}/errors [get]
+func HandleDynamoDBImportErrors(logger *slog.Logger, imports *importer.Importer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		job, err := imports.Job(id)
+		if err != nil {
+			problem.Error(w, r, "Import not found", http.StatusNotFound)
+			return
+		}
+
+		header, rejections := job.Rejections()
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "import-"+id+"-errors.csv"))
+		w.WriteHeader(http.StatusOK)
+
+		cw := csv.NewWriter(w)
+		cw.Write(append([]string{"row", "error"}, header...))
+		for _, rejection := range rejections {
+			cw.Write(append([]string{strconv.Itoa(rejection.Row), rejection.Reason}, rejection.Values...))
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			logger.ErrorContext(r.Context(), "failed to write import error report", "error", err, "id", id)
+		}
+	})
+}
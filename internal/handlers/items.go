@@ -1,24 +1,18 @@
 package handlers
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
-	"sync"
-)
-
-// Item represents an item in our system.
-type Item struct {
-	ID          int64  `json:"id" example:"1"`
-	Name        string `json:"name" example:"Sample Item"`
-	Description string `json:"description" example:"This is a sample item description"`
-}
+	"slices"
+	"strconv"
 
-// In-memory store for demo purposes
-var (
-	items    = make(map[int64]Item)
-	itemsMux sync.RWMutex // Protects items map and nextID
-	nextID   int64        = 1
+	"github.com/pmollerus23/go-aws-server/internal/events"
+	"github.com/pmollerus23/go-aws-server/internal/items"
+	"github.com/pmollerus23/go-aws-server/internal/live"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
 )
 
 // HandleItemsGet returns a handler that retrieves all items.
@@ -26,28 +20,83 @@ var (
 //	@Summary		List all items
 //	@Description	Get a list of all items in the system
 //	@Tags			items
-//	@Produce		json
-//	@Success		200	{array}		Item
-//	@Failure		401	{string}	string	"Unauthorized"
-//	@Failure		500	{string}	string	"Internal Server Error"
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Success		200	{array}		items.Item
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		500	{object}	problem.Details	"Internal Server Error"
 //	@Security		BearerAuth
 //	@Router			/api/v1/items [get]
-func HandleItemsGet(logger *slog.Logger) http.Handler {
+func HandleItemsGet(logger *slog.Logger, itemStore items.Store) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		itemsMux.RLock()
-		itemsCount := len(items)
-		// Convert map to slice
-		itemsList := make([]Item, 0, itemsCount)
-		for _, item := range items {
-			itemsList = append(itemsList, item)
+		itemsList, err := itemStore.List(r.Context())
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to list items", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
-		itemsMux.RUnlock()
 
-		logger.Info("retrieving all items", "count", itemsCount)
+		logger.InfoContext(r.Context(), "retrieving all items", "count", len(itemsList))
 
 		if err := encode(w, r, http.StatusOK, itemsList); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleItemsGetV2 returns a handler that lists items a page at a time, in
+// ID order.
+//
+//	@Summary		List items
+//	@Description	Get a page of items in ID order. Pass the response's nextToken to get the next page.
+//	@Tags			items
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			limit		query		int				false	"Items per page (1-1000)"	default(100)
+//	@Param			nextToken	query		string			false	"Token from the previous page"
+//	@Success		200			{object}	pageResponse	"items, count, and nextToken"
+//	@Failure		400			{object}	problem.Details	"Invalid query parameter"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		500			{object}	problem.Details	"Internal Server Error"
+//	@Security		BearerAuth
+//	@Router			/api/v2/items [get]
+func HandleItemsGetV2(logger *slog.Logger, itemStore items.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := parsePage(r)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var after int64
+		if p.token != "" {
+			if after, err = strconv.ParseInt(p.token, 10, 64); err != nil {
+				problem.Error(w, r, errInvalidPageToken.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		itemsList, err := itemStore.List(r.Context())
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to list items", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		slices.SortFunc(itemsList, func(a, b items.Item) int { return cmp.Compare(a.ID, b.ID) })
+		start, _ := slices.BinarySearchFunc(itemsList, after+1, func(item items.Item, id int64) int { return cmp.Compare(item.ID, id) })
+		itemsList = itemsList[start:]
+
+		var next string
+		if len(itemsList) > p.limit {
+			itemsList = itemsList[:p.limit]
+			next = strconv.FormatInt(itemsList[p.limit-1].ID, 10)
+		}
+
+		response := newPageResponse(w, r, itemsList, len(itemsList), next)
+
+		if err := encode(w, r, http.StatusOK, response); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
@@ -66,12 +115,6 @@ type CreateItemResponse struct {
 	Description string `json:"description" example:"Item description"`
 }
 
-// ValidationError represents validation error response
-type ValidationError struct {
-	Error    string            `json:"error" example:"validation failed"`
-	Problems map[string]string `json:"problems"`
-}
-
 // HandleItemsCreate returns a handler that creates a new item.
 //
 //	@Summary		Create a new item
@@ -81,40 +124,34 @@ type ValidationError struct {
 //	@Produce		json
 //	@Param			item	body		CreateItemRequest	true	"Item to create"
 //	@Success		201		{object}	CreateItemResponse
-//	@Failure		400		{object}	ValidationError	"Validation error"
-//	@Failure		401		{string}	string			"Unauthorized"
-//	@Failure		500		{string}	string			"Internal Server Error"
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		500		{object}	problem.Details	"Internal Server Error"
 //	@Security		BearerAuth
 //	@Router			/api/v1/items [post]
-func HandleItemsCreate(logger *slog.Logger) http.Handler {
+func HandleItemsCreate(logger *slog.Logger, itemStore items.Store, hub *live.Hub, bus *events.Publisher) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req, problems, err := decodeValid[CreateItemRequest](r)
 		if err != nil {
-			logger.Error("failed to decode request", "error", err)
+			logger.ErrorContext(r.Context(), "failed to decode request", "error", err)
 			if len(problems) > 0 {
-				encode(w, r, http.StatusBadRequest, map[string]interface{}{
-					"error":    "validation failed",
-					"problems": problems,
-				})
+				problem.Validation(w, r, problems)
 				return
 			}
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		// Create the item (protected by write lock)
-		itemsMux.Lock()
-		id := nextID
-		nextID++
-		item := Item{
-			ID:          id,
-			Name:        req.Name,
-			Description: req.Description,
+		item, err := itemStore.Create(r.Context(), req.Name, req.Description)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to create item", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
-		items[id] = item
-		itemsMux.Unlock()
 
-		logger.Info("item created", "id", id, "name", req.Name)
+		logger.InfoContext(r.Context(), "item created", "id", item.ID, "name", req.Name)
+		hub.Publish(live.TopicItems, "created", item)
+		bus.Publish(r.Context(), events.TypeItemCreated, item)
 
 		resp := CreateItemResponse{
 			ID:          item.ID,
@@ -123,13 +160,159 @@ func HandleItemsCreate(logger *slog.Logger) http.Handler {
 		}
 
 		if err := encode(w, r, http.StatusCreated, resp); err != nil {
-			logger.Error("failed to encode response", "error", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 	})
 }
 
+// HandleItemsUpdate returns a handler that replaces an item's name and description.
+//
+//	@Summary		Update an item
+//	@Description	Replace an item's name and description
+//	@Tags			items
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int					true	"Item ID"
+//	@Param			item	body		CreateItemRequest	true	"New item fields"
+//	@Success		200		{object}	items.Item
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		404		{object}	problem.Details	"Item not found"
+//	@Failure		409		{object}	problem.Details	"Item was modified concurrently"
+//	@Failure		500		{object}	problem.Details	"Internal Server Error"
+//	@Security		BearerAuth
+//	@Router			/api/v1/items/{id} [put]
+func HandleItemsUpdate(logger *slog.Logger, itemStore items.Store, hub *live.Hub) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			problem.Error(w, r, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		req, problems, err := decodeValid[CreateItemRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		item, err := itemStore.Update(r.Context(), items.Item{
+			ID:          id,
+			Name:        req.Name,
+			Description: req.Description,
+		})
+		if err != nil {
+			writeItemError(w, r, logger, err, id)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "item updated", "id", id, "name", req.Name)
+		hub.Publish(live.TopicItems, "updated", item)
+
+		if err := encode(w, r, http.StatusOK, item); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleItemsDelete returns a handler that deletes an item.
+//
+//	@Summary		Delete an item
+//	@Description	Delete an item by ID
+//	@Tags			items
+//	@Param			id	path	int	true	"Item ID"
+//	@Success		204
+//	@Failure		400	{object}	problem.Details	"Invalid item ID"
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		404	{object}	problem.Details	"Item not found"
+//	@Failure		409	{object}	problem.Details	"Item was modified concurrently"
+//	@Failure		500	{object}	problem.Details	"Internal Server Error"
+//	@Security		BearerAuth
+//	@Router			/api/v1/items/{id} [delete]
+func HandleItemsDelete(logger *slog.Logger, itemStore items.Store, hub *live.Hub) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			problem.Error(w, r, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := itemStore.Delete(r.Context(), id); err != nil {
+			writeItemError(w, r, logger, err, id)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "item deleted", "id", id)
+		hub.Publish(live.TopicItems, "deleted", items.Item{ID: id})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// HandleItemsHistory returns a handler that lists every change made to an item.
+//
+//	@Summary		Get item history
+//	@Description	Get the Created, Updated, and Deleted events recorded for an item, oldest first. Only available with the event-sourced item store.
+//	@Tags			items
+//	@Produce		json
+//	@Param			id	path		int	true	"Item ID"
+//	@Success		200	{array}		items.Event
+//	@Failure		400	{object}	problem.Details	"Invalid item ID"
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		404	{object}	problem.Details	"Item not found"
+//	@Failure		501	{object}	problem.Details	"Item history is not available"
+//	@Failure		500	{object}	problem.Details	"Internal Server Error"
+//	@Security		BearerAuth
+//	@Router			/api/v1/items/{id}/history [get]
+func HandleItemsHistory(logger *slog.Logger, itemStore items.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		history, ok := itemStore.(items.HistoryStore)
+		if !ok {
+			problem.Error(w, r, "Item history is not available with this item store", http.StatusNotImplemented)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			problem.Error(w, r, "Invalid item ID", http.StatusBadRequest)
+			return
+		}
+
+		events, err := history.History(r.Context(), id)
+		if err != nil {
+			writeItemError(w, r, logger, err, id)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, events); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// writeItemError maps item store errors to HTTP responses.
+func writeItemError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error, id int64) {
+	switch {
+	case errors.Is(err, items.ErrNotFound):
+		problem.Error(w, r, "Item not found", http.StatusNotFound)
+	case errors.Is(err, items.ErrConflict):
+		problem.Error(w, r, "Item was modified concurrently, retry the request", http.StatusConflict)
+	default:
+		logger.ErrorContext(r.Context(), "item store error", "error", err, "id", id)
+		problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
 // Valid implements the Validator interface for CreateItemRequest.
 func (r CreateItemRequest) Valid(ctx context.Context) map[string]string {
 	problems := make(map[string]string)
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/kpl"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// Kinesis limits on records and PutRecords requests.
+const (
+	maxKinesisRecordSize   = 1024 * 1024 // Data and partition key
+	maxKinesisBatchSize    = 5 * 1024 * 1024
+	maxKinesisBatchRecords = 500
+	maxPartitionKeyLength  = 256
+)
+
+// KinesisRecord is a record to put on a stream.
+type KinesisRecord struct {
+	// Data is the record's content. A JSON string is put as its text, and
+	// any other JSON value as it is written.
+	Data json.RawMessage `json:"data" swaggertype:"object"`
+	// PartitionKey picks the record's shard. Without one, the key is read
+	// from the request's partitionKeyField, or a random key is used.
+	PartitionKey    string `json:"partitionKey,omitempty" example:"user-123"`
+	ExplicitHashKey string `json:"explicitHashKey,omitempty"`
+}
+
+// bytes returns the data put on the stream for the record.
+func (r KinesisRecord) bytes() []byte {
+	var text string
+	if json.Unmarshal(r.Data, &text) == nil {
+		return []byte(text)
+	}
+	return r.Data
+}
+
+// partitionKey returns the record's partition key: PartitionKey, the value
+// of field in its data if that is a JSON object, or a random key.
+func (r KinesisRecord) partitionKey(field string) string {
+	if r.PartitionKey != "" {
+		return r.PartitionKey
+	}
+	if field != "" {
+		var object map[string]any
+		if json.Unmarshal(r.Data, &object) == nil {
+			switch v := object[field].(type) {
+			case string:
+				if v != "" && utf8.RuneCountInString(v) <= maxPartitionKeyLength {
+					return v
+				}
+			case float64:
+				return strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// problems adds what is wrong with the record to problems, keyed by field
+// under prefix.
+func (r KinesisRecord) problems(prefix string, problems map[string]string) {
+	if len(r.Data) == 0 || string(r.Data) == "null" || string(r.Data) == `""` {
+		problems[prefix+"data"] = "data is required and cannot be empty"
+	} else if len(r.bytes())+len(r.PartitionKey) > maxKinesisRecordSize {
+		problems[prefix+"data"] = "data must be at most 1 MiB"
+	}
+	if utf8.RuneCountInString(r.PartitionKey) > maxPartitionKeyLength {
+		problems[prefix+"partitionKey"] = "partitionKey must be at most 256 characters"
+	}
+}
+
+// PutKinesisRecordRequest represents a record to put on a stream.
+type PutKinesisRecordRequest struct {
+	KinesisRecord
+	// PartitionKeyField names the field of the data, a JSON object, whose
+	// value is the partition key when none is given.
+	PartitionKeyField string `json:"partitionKeyField,omitempty" example:"userId"`
+}
+
+// Valid validates the put record request.
+func (r PutKinesisRecordRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	r.KinesisRecord.problems("", problems)
+	return problems
+}
+
+// PutKinesisRecordsRequest represents records to put on a stream at once.
+type PutKinesisRecordsRequest struct {
+	Records []KinesisRecord `json:"records"`
+	// PartitionKeyField names the field of each record's data, a JSON
+	// object, whose value is its partition key when it has none.
+	PartitionKeyField string `json:"partitionKeyField,omitempty" example:"userId"`
+	// Aggregate packs the records into as few Kinesis records as possible,
+	// in the Kinesis Producer Library's format. Consumers must unpack them,
+	// as the Kinesis Client Library does.
+	Aggregate bool `json:"aggregate,omitempty"`
+}
+
+// Valid validates the put records request.
+func (r PutKinesisRecordsRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if len(r.Records) == 0 {
+		problems["records"] = "at least one record is required"
+	} else if !r.Aggregate && len(r.Records) > maxKinesisBatchRecords {
+		problems["records"] = "at most 500 records are allowed without aggregate"
+	}
+	size := 0
+	for i, record := range r.Records {
+		record.problems("records["+strconv.Itoa(i)+"].", problems)
+		size += len(record.bytes()) + len(record.PartitionKey)
+	}
+	if size > maxKinesisBatchSize {
+		problems["records"] = "records must add up to at most 5 MiB"
+	}
+
+	return problems
+}
+
+// KinesisPutResult is the outcome of putting a record.
+type KinesisPutResult struct {
+	PartitionKey   string `json:"partitionKey" example:"user-123"`
+	ShardID        string `json:"shardId,omitempty" example:"shardId-000000000000"`
+	SequenceNumber string `json:"sequenceNumber,omitempty" example:"49590338271490256608559692538361571095921575989136588898"`
+	// ErrorCode and ErrorMessage are set for records Kinesis didn't take,
+	// which may be retried.
+	ErrorCode    string `json:"errorCode,omitempty" example:"ProvisionedThroughputExceededException"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// PutKinesisRecordsResponse is the outcome of putting records at once.
+type PutKinesisRecordsResponse struct {
+	// Records are in the order of the request.
+	Records           []KinesisPutResult `json:"records"`
+	FailedRecordCount int                `json:"failedRecordCount" example:"0"`
+	// KinesisRecords is how many records were put on the stream, fewer
+	// than Records when they were aggregated.
+	KinesisRecords int `json:"kinesisRecords" example:"1"`
+}
+
+// HandleKinesisListStreams returns a handler that lists Kinesis streams.
+//
+//	@Summary		List Kinesis streams
+//	@Description	Get the names of the Kinesis data streams in the AWS account
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Success		200	{object}	map[string]interface{}	"streams and count"
+//	@Failure		401	{object}	problem.Details			"Unauthorized"
+//	@Failure		500	{object}	problem.Details			"Failed to list Kinesis streams"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/kinesis/streams [get]
+func HandleKinesisListStreams(logger *slog.Logger, kinesisClient *kinesis.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streams := []string{}
+		paginator := kinesis.NewListStreamsPaginator(kinesisClient, &kinesis.ListStreamsInput{})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to list Kinesis streams", "error", err)
+				writeAWSError(w, r, err, "Failed to list Kinesis streams")
+				return
+			}
+			streams = append(streams, page.StreamNames...)
+		}
+
+		if err := encode(w, r, http.StatusOK, newListResponse("streams", streams, len(streams))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleKinesisPutRecord returns a handler that puts a record on a stream.
+//
+//	@Summary		Put a Kinesis record
+//	@Description	Put a record on a Kinesis data stream. The partition key is the one given, the value of partitionKeyField in the data, or random.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			streamName	path		string					true	"Stream name"
+//	@Param			request		body		PutKinesisRecordRequest	true	"Record"
+//	@Success		201			{object}	KinesisPutResult
+//	@Failure		400			{object}	problem.Details	"Validation error"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		404			{object}	problem.Details	"Stream not found"
+//	@Failure		429			{object}	problem.Details	"Stream throughput exceeded"
+//	@Failure		500			{object}	problem.Details	"Failed to put record"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/kinesis/streams/{streamName}/records [post]
+func HandleKinesisPutRecord(logger *slog.Logger, kinesisClient *kinesis.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[PutKinesisRecordRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode put record request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		streamName := r.PathValue("streamName")
+		input := &kinesis.PutRecordInput{
+			StreamName:   aws.String(streamName),
+			Data:         req.bytes(),
+			PartitionKey: aws.String(req.partitionKey(req.PartitionKeyField)),
+		}
+		if req.ExplicitHashKey != "" {
+			input.ExplicitHashKey = aws.String(req.ExplicitHashKey)
+		}
+
+		result, err := kinesisClient.PutRecord(r.Context(), input)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to put Kinesis record", "error", err, "stream", streamName)
+			writeAWSError(w, r, err, "Failed to put record")
+			return
+		}
+
+		resp := KinesisPutResult{
+			PartitionKey:   aws.ToString(input.PartitionKey),
+			ShardID:        aws.ToString(result.ShardId),
+			SequenceNumber: aws.ToString(result.SequenceNumber),
+		}
+		if err := encode(w, r, http.StatusCreated, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleKinesisPutRecords returns a handler that puts records on a stream
+// at once.
+//
+//	@Summary		Put Kinesis records
+//	@Description	Put up to 500 records, of up to 5 MiB in all, on a Kinesis data stream. Records Kinesis doesn't take, such as when the stream's throughput is exceeded, are reported with an errorCode and may be sent again. With aggregate=true, records are packed into as few Kinesis records as possible in the Kinesis Producer Library's format; each packed record goes to the shard of the first record in it.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			streamName	path		string						true	"Stream name"
+//	@Param			request		body		PutKinesisRecordsRequest	true	"Records"
+//	@Success		200			{object}	PutKinesisRecordsResponse
+//	@Failure		400			{object}	problem.Details	"Validation error"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		404			{object}	problem.Details	"Stream not found"
+//	@Failure		500			{object}	problem.Details	"Failed to put records"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/kinesis/streams/{streamName}/records/batch [post]
+func HandleKinesisPutRecords(logger *slog.Logger, kinesisClient *kinesis.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[PutKinesisRecordsRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode put records request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		// Each entry is put as one Kinesis record; targets maps the
+		// request's records to the entry they are in
+		records := make([]kpl.Record, len(req.Records))
+		for i, record := range req.Records {
+			records[i] = kpl.Record{
+				PartitionKey:    record.partitionKey(req.PartitionKeyField),
+				ExplicitHashKey: record.ExplicitHashKey,
+				Data:            record.bytes(),
+			}
+		}
+		entries, targets := kinesisEntries(records, req.Aggregate)
+
+		streamName := r.PathValue("streamName")
+		result, err := kinesisClient.PutRecords(r.Context(), &kinesis.PutRecordsInput{
+			StreamName: aws.String(streamName),
+			Records:    entries,
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to put Kinesis records", "error", err, "stream", streamName)
+			writeAWSError(w, r, err, "Failed to put records")
+			return
+		}
+
+		resp := PutKinesisRecordsResponse{
+			Records:        make([]KinesisPutResult, len(records)),
+			KinesisRecords: len(entries),
+		}
+		for i, record := range records {
+			entry := result.Records[targets[i]]
+			resp.Records[i] = KinesisPutResult{
+				PartitionKey:   record.PartitionKey,
+				ShardID:        aws.ToString(entry.ShardId),
+				SequenceNumber: aws.ToString(entry.SequenceNumber),
+				ErrorCode:      aws.ToString(entry.ErrorCode),
+				ErrorMessage:   aws.ToString(entry.ErrorMessage),
+			}
+			if entry.ErrorCode != nil {
+				resp.FailedRecordCount++
+			}
+		}
+		if resp.FailedRecordCount > 0 {
+			logger.WarnContext(r.Context(), "Kinesis didn't take some records", "stream", streamName, "failed", resp.FailedRecordCount, "records", len(records))
+		}
+
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// kinesisEntries returns the PutRecords entries for records, aggregated if
+// aggregate is set, and the index of the entry each record is in.
+func kinesisEntries(records []kpl.Record, aggregate bool) ([]kinesistypes.PutRecordsRequestEntry, []int) {
+	entry := func(r kpl.Record) kinesistypes.PutRecordsRequestEntry {
+		e := kinesistypes.PutRecordsRequestEntry{Data: r.Data, PartitionKey: aws.String(r.PartitionKey)}
+		if r.ExplicitHashKey != "" {
+			e.ExplicitHashKey = aws.String(r.ExplicitHashKey)
+		}
+		return e
+	}
+
+	targets := make([]int, len(records))
+	var entries []kinesistypes.PutRecordsRequestEntry
+	if !aggregate {
+		for i, r := range records {
+			entries = append(entries, entry(r))
+			targets[i] = i
+		}
+		return entries, targets
+	}
+
+	var agg kpl.Aggregator
+	for i, r := range records {
+		if agg.Add(r) {
+			targets[i] = len(entries)
+			continue
+		}
+		if agg.Len() > 0 {
+			entries = append(entries, entry(agg.Flush()))
+			if agg.Add(r) {
+				targets[i] = len(entries)
+				continue
+			}
+		}
+		// Too large to aggregate, so put it on its own
+		targets[i] = len(entries)
+		entries = append(entries, entry(r))
+	}
+	if agg.Len() > 0 {
+		entries = append(entries, entry(agg.Flush()))
+	}
+	return entries, targets
+}
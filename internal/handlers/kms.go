@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// KMS limits on the data Encrypt and Decrypt take.
+const (
+	maxKMSPlaintextSize  = 4096
+	maxKMSCiphertextSize = 6144
+)
+
+// KMSEncryptRequest represents data to encrypt under a KMS key.
+type KMSEncryptRequest struct {
+	// KeyID is a key ID, ARN, or alias. Without one, the server's
+	// KMS_KEY_ID is used.
+	KeyID     string `json:"keyId,omitempty" example:"alias/go-aws-server"`
+	Plaintext []byte `json:"plaintext" swaggertype:"string" format:"base64" example:"aGVsbG8="`
+	// EncryptionContext must be given again to decrypt.
+	EncryptionContext map[string]string `json:"encryptionContext,omitempty"`
+}
+
+// Valid validates the encrypt request.
+func (r KMSEncryptRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	if len(r.Plaintext) == 0 {
+		problems["plaintext"] = "plaintext is required and cannot be empty"
+	} else if len(r.Plaintext) > maxKMSPlaintextSize {
+		problems["plaintext"] = "plaintext must be at most 4 KiB; use a data key for more"
+	}
+	return problems
+}
+
+// KMSEncryptResponse represents data encrypted under a KMS key.
+type KMSEncryptResponse struct {
+	KeyID      string `json:"keyId" example:"arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"`
+	Ciphertext []byte `json:"ciphertext" swaggertype:"string" format:"base64"`
+}
+
+// KMSDecryptRequest represents data to decrypt with KMS.
+type KMSDecryptRequest struct {
+	// KeyID, if given, must be the key the data was encrypted under.
+	KeyID             string            `json:"keyId,omitempty" example:"alias/go-aws-server"`
+	Ciphertext        []byte            `json:"ciphertext" swaggertype:"string" format:"base64"`
+	EncryptionContext map[string]string `json:"encryptionContext,omitempty"`
+}
+
+// Valid validates the decrypt request.
+func (r KMSDecryptRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	if len(r.Ciphertext) == 0 {
+		problems["ciphertext"] = "ciphertext is required and cannot be empty"
+	} else if len(r.Ciphertext) > maxKMSCiphertextSize {
+		problems["ciphertext"] = "ciphertext must be at most 6 KiB"
+	}
+	return problems
+}
+
+// KMSDecryptResponse represents data decrypted with KMS.
+type KMSDecryptResponse struct {
+	KeyID     string `json:"keyId" example:"arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"`
+	Plaintext []byte `json:"plaintext" swaggertype:"string" format:"base64" example:"aGVsbG8="`
+}
+
+// KMSDataKeyRequest represents a request for a data key.
+type KMSDataKeyRequest struct {
+	// KeyID is a key ID, ARN, or alias. Without one, the server's
+	// KMS_KEY_ID is used.
+	KeyID string `json:"keyId,omitempty" example:"alias/go-aws-server"`
+	// KeySpec is AES_256 (the default) or AES_128.
+	KeySpec           string            `json:"keySpec,omitempty" example:"AES_256"`
+	EncryptionContext map[string]string `json:"encryptionContext,omitempty"`
+}
+
+// Valid validates the data key request.
+func (r KMSDataKeyRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	switch kmstypes.DataKeySpec(r.KeySpec) {
+	case "", kmstypes.DataKeySpecAes256, kmstypes.DataKeySpecAes128:
+	default:
+		problems["keySpec"] = "keySpec must be AES_256 or AES_128"
+	}
+	return problems
+}
+
+// KMSDataKeyResponse represents a data key. Encrypt data locally with the
+// plaintext key, discard it, and store the ciphertext key with the data.
+type KMSDataKeyResponse struct {
+	KeyID      string `json:"keyId" example:"arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"`
+	Plaintext  []byte `json:"plaintext" swaggertype:"string" format:"base64"`
+	Ciphertext []byte `json:"ciphertext" swaggertype:"string" format:"base64"`
+}
+
+// kmsKeyID returns keyID, or defaultKeyID if it is empty. It answers r with
+// a validation error and returns "" if neither is set.
+func kmsKeyID(w http.ResponseWriter, r *http.Request, keyID, defaultKeyID string) string {
+	if keyID == "" {
+		keyID = defaultKeyID
+	}
+	if keyID == "" {
+		problem.Validation(w, r, map[string]string{"keyId": "keyId is required, as no default KMS key is configured"})
+	}
+	return keyID
+}
+
+// HandleKMSEncrypt returns a handler that encrypts data under a KMS key.
+//
+//	@Summary		Encrypt with KMS
+//	@Description	Encrypt up to 4 KiB of base64-encoded data under a KMS key, the server's KMS_KEY_ID by default
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		KMSEncryptRequest	true	"Data to encrypt"
+//	@Success		200		{object}	KMSEncryptResponse
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Access to the key denied"
+//	@Failure		404		{object}	problem.Details	"Key not found"
+//	@Failure		500		{object}	problem.Details	"Failed to encrypt"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/kms/encrypt [post]
+func HandleKMSEncrypt(logger *slog.Logger, kmsClient *kms.Client, defaultKeyID string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[KMSEncryptRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode encrypt request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		keyID := kmsKeyID(w, r, req.KeyID, defaultKeyID)
+		if keyID == "" {
+			return
+		}
+
+		result, err := kmsClient.Encrypt(r.Context(), &kms.EncryptInput{
+			KeyId:             aws.String(keyID),
+			Plaintext:         req.Plaintext,
+			EncryptionContext: req.EncryptionContext,
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to encrypt with KMS", "error", err, "key_id", keyID)
+			writeAWSError(w, r, err, "Failed to encrypt")
+			return
+		}
+
+		resp := KMSEncryptResponse{KeyID: aws.ToString(result.KeyId), Ciphertext: result.CiphertextBlob}
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleKMSDecrypt returns a handler that decrypts data with KMS.
+//
+//	@Summary		Decrypt with KMS
+//	@Description	Decrypt base64-encoded data encrypted under a KMS key, given the encryption context it was encrypted with. Requires the kms:decrypt permission.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		KMSDecryptRequest	true	"Data to decrypt"
+//	@Success		200		{object}	KMSDecryptResponse
+//	@Failure		400		{object}	problem.Details	"Validation error or invalid ciphertext"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Missing kms:decrypt, or access to the key denied"
+//	@Failure		500		{object}	problem.Details	"Failed to decrypt"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/kms/decrypt [post]
+func HandleKMSDecrypt(logger *slog.Logger, kmsClient *kms.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[KMSDecryptRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode decrypt request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		input := &kms.DecryptInput{
+			CiphertextBlob:    req.Ciphertext,
+			EncryptionContext: req.EncryptionContext,
+		}
+		if req.KeyID != "" {
+			input.KeyId = aws.String(req.KeyID)
+		}
+		result, err := kmsClient.Decrypt(r.Context(), input)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decrypt with KMS", "error", err)
+			writeAWSError(w, r, err, "Failed to decrypt")
+			return
+		}
+
+		resp := KMSDecryptResponse{KeyID: aws.ToString(result.KeyId), Plaintext: result.Plaintext}
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleKMSGenerateDataKey returns a handler that generates a data key.
+//
+//	@Summary		Generate a KMS data key
+//	@Description	Generate a data key for encrypting data locally, returned both in plaintext and encrypted under a KMS key, the server's KMS_KEY_ID by default. Requires the kms:decrypt permission.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		KMSDataKeyRequest	true	"Data key options"
+//	@Success		200		{object}	KMSDataKeyResponse
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Missing kms:decrypt, or access to the key denied"
+//	@Failure		404		{object}	problem.Details	"Key not found"
+//	@Failure		500		{object}	problem.Details	"Failed to generate data key"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/kms/data-key [post]
+func HandleKMSGenerateDataKey(logger *slog.Logger, kmsClient *kms.Client, defaultKeyID string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[KMSDataKeyRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode data key request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		keyID := kmsKeyID(w, r, req.KeyID, defaultKeyID)
+		if keyID == "" {
+			return
+		}
+		keySpec := kmstypes.DataKeySpec(req.KeySpec)
+		if keySpec == "" {
+			keySpec = kmstypes.DataKeySpecAes256
+		}
+
+		result, err := kmsClient.GenerateDataKey(r.Context(), &kms.GenerateDataKeyInput{
+			KeyId:             aws.String(keyID),
+			KeySpec:           keySpec,
+			EncryptionContext: req.EncryptionContext,
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to generate KMS data key", "error", err, "key_id", keyID)
+			writeAWSError(w, r, err, "Failed to generate data key")
+			return
+		}
+
+		resp := KMSDataKeyResponse{
+			KeyID:      aws.ToString(result.KeyId),
+			Plaintext:  result.Plaintext,
+			Ciphertext: result.CiphertextBlob,
+		}
+		if err := encode(w, r, http.StatusOK, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/latency"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// HandleSlowRequests returns a handler that reports request and slow
+// request counts per route.
+//
+//	@Summary		Get slow request stats
+//	@Description	Get, for every route requested since the server started, how many requests it served, how many were slower than SLOW_REQUEST_THRESHOLD, and the longest one, slowest routes first.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		latency.Stats
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		503	{object}	problem.Details	"Slow request tracking is disabled"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/slow-requests [get]
+func HandleSlowRequests(logger *slog.Logger, tracker *latency.Tracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tracker == nil {
+			problem.Error(w, r, "Slow request tracking is disabled", http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, tracker.Stats()); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
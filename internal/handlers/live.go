@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pmollerus23/go-aws-server/internal/live"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// HandleWebSocket returns a handler that upgrades the request to a WebSocket
+// and pushes live events to it.
+//
+//	@Summary		Live updates
+//	@Description	Open a WebSocket that receives item changes, S3 uploads, and DynamoDB stream records as JSON events ({"topic":"items","type":"updated","data":{...},"time":"..."}). Browsers authenticate by offering the subprotocols "live" and "bearer.<token>"; other clients may send the Authorization header. Clients receive every topic unless `topics` is given, and can change their subscriptions by sending {"action":"subscribe"|"unsubscribe","topics":["s3"]}.
+//	@Tags			live
+//	@Param			topics	query	string	false	"Comma-separated topics: items, s3, dynamodb, kinesis, documents"
+//	@Success		101
+//	@Failure		400	{object}	problem.Details	"Invalid request"
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		426	{object}	problem.Details	"WebSocket upgrade required"
+//	@Security		BearerAuth
+//	@Router			/api/v1/ws [get]
+func HandleWebSocket(logger *slog.Logger, hub *live.Hub) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topics := live.Topics
+		if value := r.URL.Query().Get("topics"); value != "" {
+			topics = strings.Split(value, ",")
+			if !live.ValidTopics(topics) {
+				problem.Error(w, r, "Unknown topic", http.StatusBadRequest)
+				return
+			}
+		}
+
+		conn, err := live.Upgrade(w, r)
+		if err != nil {
+			if errors.Is(err, live.ErrNotWebSocket) {
+				w.Header().Set("Upgrade", "websocket")
+				problem.Error(w, r, "WebSocket upgrade required", http.StatusUpgradeRequired)
+				return
+			}
+			logger.WarnContext(r.Context(), "websocket upgrade failed", "error", err)
+			problem.Error(w, r, "WebSocket upgrade failed", http.StatusBadRequest)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "live client connected", "topics", topics)
+		hub.Serve(conn, topics)
+		logger.InfoContext(r.Context(), "live client disconnected")
+	})
+}
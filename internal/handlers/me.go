@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"regexp"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+var (
+	// e164 matches phone numbers in the E.164 format Cognito requires.
+	e164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	// customAttributeName matches Cognito custom attribute names without the "custom:" prefix.
+	customAttributeName = regexp.MustCompile(`^[A-Za-z0-9_]{1,20}$`)
+)
+
+// UpdateMeRequest represents a request to update the signed-in user's
+// attributes. Omitted fields are left unchanged.
+type UpdateMeRequest struct {
+	Name        *string `json:"name,omitempty" example:"Jane Doe"`
+	PhoneNumber *string `json:"phone_number,omitempty" example:"+15555550100"`
+	// Email changes take effect once confirmed with POST /api/v1/me/verify-email.
+	Email *string `json:"email,omitempty" example:"jane@example.com"`
+	// Custom holds custom attributes by name, without the "custom:" prefix.
+	Custom map[string]string `json:"custom,omitempty"`
+}
+
+// Valid validates the update me request.
+func (r UpdateMeRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Name == nil && r.PhoneNumber == nil && r.Email == nil && len(r.Custom) == 0 {
+		problems["request"] = "at least one attribute must be provided"
+	}
+	if r.Name != nil && (*r.Name == "" || len(*r.Name) > 100) {
+		problems["name"] = "name must be between 1 and 100 characters"
+	}
+	if r.PhoneNumber != nil && !e164.MatchString(*r.PhoneNumber) {
+		problems["phone_number"] = "phone number must be in E.164 format, e.g. +15555550100"
+	}
+	if r.Email != nil {
+		if addr, err := mail.ParseAddress(*r.Email); err != nil || addr.Address != *r.Email {
+			problems["email"] = "email must be a valid email address"
+		}
+	}
+	for name, value := range r.Custom {
+		if !customAttributeName.MatchString(name) {
+			problems["custom."+name] = "custom attribute names must be 1-20 letters, digits, or underscores"
+		} else if len(value) > 2048 {
+			problems["custom."+name] = "custom attribute values must be 2048 characters or less"
+		}
+	}
+
+	return problems
+}
+
+// attributes returns the Cognito attributes the request changes.
+func (r UpdateMeRequest) attributes() map[string]string {
+	attributes := make(map[string]string)
+	if r.Name != nil {
+		attributes["name"] = *r.Name
+	}
+	if r.PhoneNumber != nil {
+		attributes["phone_number"] = *r.PhoneNumber
+	}
+	if r.Email != nil {
+		attributes["email"] = *r.Email
+	}
+	for name, value := range r.Custom {
+		attributes["custom:"+name] = value
+	}
+	return attributes
+}
+
+// UpdateMeResponse represents the update me response.
+type UpdateMeResponse struct {
+	Message string `json:"message"`
+	// VerificationRequired lists attributes that were sent a verification code,
+	// such as email after an address change.
+	VerificationRequired []string `json:"verification_required"`
+}
+
+// HandleUpdateMe updates the signed-in user's attributes.
+//
+//	@Summary		Update my attributes
+//	@Description	Update the signed-in user's name, phone number, email, or custom attributes. Changing the email sends a verification code to the new address; confirm it with POST /api/v1/me/verify-email.
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		UpdateMeRequest	true	"Attributes to update"
+//	@Success		200		{object}	UpdateMeResponse
+//	@Failure		400		{object}	problem.Details
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		409		{object}	problem.Details
+//	@Failure		429		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
+//	@Security		BearerAuth
+//	@Router			/api/v1/me [patch]
+func HandleUpdateMe(logger *slog.Logger, authService AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, err := auth.GetAccessToken(r.Context())
+		if err != nil {
+			problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, problems, err := decodeValid[UpdateMeRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode update me request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		pending, err := authService.UpdateUserAttributes(r.Context(), accessToken, req.attributes())
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidAttribute):
+				problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, auth.ErrEmailInUse):
+				problem.Error(w, r, "email is already in use", http.StatusConflict)
+			case errors.Is(err, auth.ErrTooManyAttempts):
+				problem.Error(w, r, "too many attempts, try again later", http.StatusTooManyRequests)
+			case errors.Is(err, auth.ErrNotSupported):
+				problem.Error(w, r, "updating attributes is not supported by the identity provider", http.StatusNotImplemented)
+			default:
+				logger.ErrorContext(r.Context(), "update user attributes failed", "error", err)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		resp := UpdateMeResponse{
+			Message:              "Attributes updated successfully.",
+			VerificationRequired: pending,
+		}
+		if len(pending) > 0 {
+			resp.Message = "Attributes updated. Check your inbox for a verification code to confirm the change."
+		}
+
+		encode(w, r, http.StatusOK, resp)
+	})
+}
+
+// VerifyEmailRequest represents the verify email request.
+type VerifyEmailRequest struct {
+	Code string `json:"code"`
+}
+
+// Valid validates the verify email request.
+func (r VerifyEmailRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Code == "" {
+		problems["code"] = "verification code is required"
+	}
+
+	return problems
+}
+
+// VerifyEmailResponse represents the verify email response.
+type VerifyEmailResponse struct {
+	Message string `json:"message"`
+}
+
+// HandleVerifyEmail confirms a changed email address.
+//
+//	@Summary		Verify new email
+//	@Description	Confirm a changed email address with the code sent to it
+//	@Tags			auth
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		VerifyEmailRequest	true	"Verification code"
+//	@Success		200		{object}	VerifyEmailResponse
+//	@Failure		400		{object}	problem.Details
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		429		{object}	problem.Details
+//	@Failure		500		{object}	problem.Details
+//	@Security		BearerAuth
+//	@Router			/api/v1/me/verify-email [post]
+func HandleVerifyEmail(logger *slog.Logger, authService AuthService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, err := auth.GetAccessToken(r.Context())
+		if err != nil {
+			problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req, problems, err := decodeValid[VerifyEmailRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode verify email request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		err = authService.VerifyUserAttribute(r.Context(), accessToken, "email", req.Code)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidVerification) {
+				problem.Error(w, r, "invalid or expired verification code", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, auth.ErrTooManyAttempts) {
+				problem.Error(w, r, "too many attempts, try again later", http.StatusTooManyRequests)
+				return
+			}
+			if errors.Is(err, auth.ErrNotSupported) {
+				problem.Error(w, r, "email verification is not supported by the identity provider", http.StatusNotImplemented)
+				return
+			}
+			logger.ErrorContext(r.Context(), "verify email failed", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := VerifyEmailResponse{
+			Message: "Email verified successfully.",
+		}
+
+		encode(w, r, http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/consumer"
+	"github.com/pmollerus23/go-aws-server/internal/egress"
+	"github.com/pmollerus23/go-aws-server/internal/events"
+	"github.com/pmollerus23/go-aws-server/internal/importer"
+	"github.com/pmollerus23/go-aws-server/internal/latency"
+)
+
+// startTime is when the process started, for the uptime metric.
+var startTime = time.Now()
+
+// HandleMetrics returns a handler that reports the server's runtime,
+// request, and outbound call stats, and the concurrency of CSV imports and
+// the SQS consumer, in the Prometheus text format. It is served on the admin
+// listener only, so it isn't part of the API docs. A nil tracker omits the
+// per-route request metrics. panics counts the panics recovered from
+// handlers. messages is nil when the consumer is disabled.
+func HandleMetrics(logger *slog.Logger, tracker *latency.Tracker, egressClient *egress.Client, panics *atomic.Int64, publisher *events.Publisher, imports *importer.Importer, messages *consumer.Consumer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m := &metricsWriter{w: bufio.NewWriter(w)}
+
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		m.metric("process_uptime_seconds", "gauge", "Seconds since the server started.")
+		m.sample("process_uptime_seconds", nil, time.Since(startTime).Seconds())
+		m.metric("go_goroutines", "gauge", "Goroutines that currently exist.")
+		m.sample("go_goroutines", nil, float64(runtime.NumGoroutine()))
+		m.metric("go_memstats_heap_alloc_bytes", "gauge", "Bytes of allocated heap objects.")
+		m.sample("go_memstats_heap_alloc_bytes", nil, float64(mem.HeapAlloc))
+		m.metric("go_gc_cycles_total", "counter", "Completed GC cycles.")
+		m.sample("go_gc_cycles_total", nil, float64(mem.NumGC))
+		m.metric("http_panics_total", "counter", "Panics recovered from request handlers.")
+		m.sample("http_panics_total", nil, float64(panics.Load()))
+
+		if tracker != nil {
+			stats := tracker.Stats()
+			m.metric("http_requests_total", "counter", "Requests served, by route.")
+			for _, s := range stats {
+				m.sample("http_requests_total", []string{"route", s.Route}, float64(s.Requests))
+			}
+			m.metric("http_slow_requests_total", "counter", "Requests slower than SLOW_REQUEST_THRESHOLD, by route.")
+			for _, s := range stats {
+				m.sample("http_slow_requests_total", []string{"route", s.Route}, float64(s.Slow))
+			}
+			m.metric("http_request_duration_max_seconds", "gauge", "Longest request, by route.")
+			for _, s := range stats {
+				m.sample("http_request_duration_max_seconds", []string{"route", s.Route}, float64(s.MaxMs)/1000)
+			}
+		}
+
+		stats := egressClient.Stats()
+		m.metric("egress_requests_total", "counter", "Outbound requests, by destination host.")
+		for _, s := range stats {
+			m.sample("egress_requests_total", []string{"host", s.Host}, float64(s.Requests))
+		}
+		m.metric("egress_attempts_total", "counter", "Outbound request attempts including retries, by destination host.")
+		for _, s := range stats {
+			m.sample("egress_attempts_total", []string{"host", s.Host}, float64(s.Attempts))
+		}
+		m.metric("egress_failures_total", "counter", "Failed outbound requests, by destination host.")
+		for _, s := range stats {
+			m.sample("egress_failures_total", []string{"host", s.Host}, float64(s.Failures))
+		}
+		m.metric("egress_rejected_total", "counter", "Outbound requests refused by an open circuit, by destination host.")
+		for _, s := range stats {
+			m.sample("egress_rejected_total", []string{"host", s.Host}, float64(s.Rejected))
+		}
+		m.metric("egress_circuit_open", "gauge", "Whether the destination's circuit breaker is open (1) or not (0).")
+		for _, s := range stats {
+			open := 0.0
+			if s.Circuit != egress.CircuitClosed {
+				open = 1
+			}
+			m.sample("egress_circuit_open", []string{"host", s.Host}, open)
+		}
+
+		published, dropped := publisher.Stats()
+		m.metric("events_published_total", "counter", "Domain events published to EventBridge.")
+		m.sample("events_published_total", nil, float64(published))
+		m.metric("events_dropped_total", "counter", "Domain events dropped after failing to publish or finding the outbox full.")
+		m.sample("events_dropped_total", nil, float64(dropped))
+
+		m.metric("csv_import_concurrency", "gauge", "Batches running CSV imports may write in parallel, summed over jobs.")
+		m.sample("csv_import_concurrency", nil, float64(imports.Concurrency()))
+		m.metric("sqs_consumer_concurrency", "gauge", "Workers receiving and handling SQS messages.")
+		m.sample("sqs_consumer_concurrency", nil, float64(messages.Workers()))
+
+		if err := m.w.Flush(); err != nil {
+			logger.ErrorContext(r.Context(), "failed to write metrics", "error", err)
+		}
+	})
+}
+
+// metricsWriter writes metrics in the Prometheus text format.
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+// metric writes the HELP and TYPE lines that precede name's samples.
+func (m *metricsWriter) metric(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one sample of name, with labels given as name-value pairs.
+func (m *metricsWriter) sample(name string, labels []string, value float64) {
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		m.w.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				m.w.WriteByte(',')
+			}
+			fmt.Fprintf(m.w, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		m.w.WriteByte('}')
+	}
+	m.w.WriteByte(' ')
+	m.w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	m.w.WriteByte('\n')
+}
+
+// labelEscaper escapes the characters the text format doesn't allow in
+// label values.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Response media types encode can write.
+const (
+	mediaTypeJSON   = "application/json"
+	mediaTypeNDJSON = "application/x-ndjson"
+	mediaTypeCSV    = "text/csv"
+)
+
+// tabular is a response with rows, which NDJSON and CSV responses write
+// instead of the response itself.
+type tabular interface {
+	rows() any
+}
+
+// listResponse is a response object holding a list under key, next to
+// fields such as its count. As NDJSON or CSV only the list is written.
+type listResponse struct {
+	key    string
+	fields map[string]interface{}
+}
+
+// newListResponse returns a response with list under key and a count.
+func newListResponse(key string, list any, count int) listResponse {
+	return listResponse{key: key, fields: map[string]interface{}{
+		key:     list,
+		"count": count,
+	}}
+}
+
+func (l listResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.fields)
+}
+
+func (l listResponse) rows() any {
+	return l.fields[l.key]
+}
+
+// negotiateMediaType returns the media type in the Accept header the client
+// prefers for v. Only lists can be NDJSON or CSV; everything else, and
+// anything the client doesn't accept, is JSON.
+func negotiateMediaType(accept string, v any) string {
+	if accept == "" || rowsOf(v) == nil {
+		return mediaTypeJSON
+	}
+
+	best, bestQ := mediaTypeJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case mediaTypeJSON, mediaTypeNDJSON, mediaTypeCSV:
+		case "*/*", "application/*":
+			mediaType = mediaTypeJSON
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// rowsOf returns v's rows: v itself if it is a slice, its rows if it is
+// tabular, and nil otherwise.
+func rowsOf(v any) any {
+	if t, ok := v.(tabular); ok {
+		return t.rows()
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		return v
+	}
+	return nil
+}
+
+// rawRows returns the JSON encoding of each of rows.
+func rawRows(rows any) ([]json.RawMessage, error) {
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// writeNDJSON writes rows as newline-delimited JSON, one row per line.
+func writeNDJSON(w io.Writer, rows []json.RawMessage) error {
+	for _, row := range rows {
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes rows as CSV. Object rows become records with a column per
+// attribute, in the order attributes first appear; other rows have a single
+// value column. Nested values are written as JSON.
+func writeCSV(w io.Writer, rows []json.RawMessage) error {
+	var columns []string
+	seen := make(map[string]bool)
+	records := make([]map[string]string, 0, len(rows))
+	for _, row := range rows {
+		attrs, err := csvAttributes(row)
+		if err != nil {
+			return err
+		}
+		for _, attr := range attrs {
+			if !seen[attr.name] {
+				seen[attr.name] = true
+				columns = append(columns, attr.name)
+			}
+		}
+		record := make(map[string]string, len(attrs))
+		for _, attr := range attrs {
+			record[attr.name] = attr.value
+		}
+		records = append(records, record)
+	}
+
+	cw := csv.NewWriter(w)
+	if len(columns) > 0 {
+		cw.Write(columns)
+	}
+	line := make([]string, len(columns))
+	for _, record := range records {
+		for i, column := range columns {
+			line[i] = record[column]
+		}
+		cw.Write(line)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvAttribute is one cell of a CSV row.
+type csvAttribute struct {
+	name  string
+	value string
+}
+
+// csvAttributes returns the cells of a JSON row, keeping the order of an
+// object's attributes.
+func csvAttributes(row json.RawMessage) ([]csvAttribute, error) {
+	dec := json.NewDecoder(bytes.NewReader(row))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return []csvAttribute{{name: "value", value: csvValue(row)}}, nil
+	}
+
+	var attrs []csvAttribute
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected JSON token %v", tok)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, csvAttribute{name: name, value: csvValue(value)})
+	}
+	return attrs, nil
+}
+
+// csvValue returns the CSV cell for a JSON value: strings unquoted, null
+// empty, and anything else as JSON.
+func csvValue(value json.RawMessage) string {
+	var s string
+	switch {
+	case json.Unmarshal(value, &s) == nil:
+		return s
+	case string(value) == "null":
+		return ""
+	default:
+		return string(value)
+	}
+}
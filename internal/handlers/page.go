@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Page sizes for /api/v2 lists.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+var errInvalidPageToken = errors.New("invalid nextToken")
+
+// page is the slice of a list a /api/v2 request asks for.
+type page struct {
+	limit int
+	// token is where the page starts, decoded from the previous page's
+	// nextToken, or empty for the first page.
+	token string
+}
+
+// parsePage reads the limit and nextToken query parameters.
+func parsePage(r *http.Request) (page, error) {
+	query := r.URL.Query()
+	p := page{limit: defaultPageSize}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return page{}, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		p.limit = limit
+	}
+
+	if value := query.Get("nextToken"); value != "" {
+		token, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(token) == 0 {
+			return page{}, errInvalidPageToken
+		}
+		p.token = string(token)
+	}
+
+	return p, nil
+}
+
+// pageResponse is the /api/v2 list envelope. NextToken is set when there are
+// more items, and is passed back as the nextToken query parameter to get
+// them. As NDJSON or CSV only the items are written; the next page is also
+// linked from the Link header.
+type pageResponse struct {
+	Items     any    `json:"items"`
+	Count     int    `json:"count" example:"100"`
+	NextToken string `json:"nextToken,omitempty" example:"aXRlbS0xMDA"`
+}
+
+func (p pageResponse) rows() any {
+	return p.Items
+}
+
+// newPageResponse returns the envelope for items, which are followed by the
+// page starting at next, or are the last page if next is empty. It links the
+// next page from w's Link header.
+func newPageResponse(w http.ResponseWriter, r *http.Request, items any, count int, next string) pageResponse {
+	response := pageResponse{Items: items, Count: count}
+	if next == "" {
+		return response
+	}
+	response.NextToken = base64.RawURLEncoding.EncodeToString([]byte(next))
+
+	query := r.URL.Query()
+	query.Set("nextToken", response.NextToken)
+	link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"next\"", link.String()))
+	return response
+}
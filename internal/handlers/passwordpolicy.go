@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// PasswordPolicyService defines the interface for reading the password policy.
+type PasswordPolicyService interface {
+	PasswordPolicy(ctx context.Context) (*auth.PasswordPolicy, error)
+}
+
+// passwordPolicyContextKey holds the password policy request validation
+// checks new passwords against.
+type passwordPolicyContextKey struct{}
+
+// withPasswordPolicy returns r with the identity provider's password policy
+// in its context, for Valid methods to check passwords against. The default
+// policy is used if the provider has none or it can't be read.
+func withPasswordPolicy(r *http.Request, policies PasswordPolicyService, logger *slog.Logger) *http.Request {
+	policy, err := policies.PasswordPolicy(r.Context())
+	if err != nil {
+		if !errors.Is(err, auth.ErrNotSupported) {
+			logger.WarnContext(r.Context(), "failed to load password policy, using default", "error", err)
+		}
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), passwordPolicyContextKey{}, policy))
+}
+
+// passwordPolicy returns the password policy in ctx, or the default policy.
+func passwordPolicy(ctx context.Context) auth.PasswordPolicy {
+	if policy, ok := ctx.Value(passwordPolicyContextKey{}).(*auth.PasswordPolicy); ok {
+		return *policy
+	}
+	return auth.DefaultPasswordPolicy
+}
+
+// HandlePasswordPolicy returns a handler that describes the password policy.
+//
+//	@Summary		Get password policy
+//	@Description	Get the rules new passwords must follow, so clients can check them before signing up or resetting a password.
+//	@Tags			auth
+//	@Produce		json
+//	@Success		200	{object}	auth.PasswordPolicy
+//	@Failure		501	{object}	problem.Details	"Not supported by the identity provider"
+//	@Router			/api/v1/auth/password-policy [get]
+func HandlePasswordPolicy(logger *slog.Logger, policies PasswordPolicyService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy, err := policies.PasswordPolicy(r.Context())
+		if err != nil {
+			if errors.Is(err, auth.ErrNotSupported) {
+				problem.Error(w, r, "passwords are managed by the identity provider", http.StatusNotImplemented)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to load password policy", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, policy); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/readonly"
+)
+
+// SetReadOnlyRequest represents a request to turn read-only mode on or off.
+type SetReadOnlyRequest struct {
+	Enabled *bool  `json:"enabled" example:"true"`
+	Reason  string `json:"reason,omitempty" example:"Database migration in progress"`
+}
+
+// Valid validates the set read-only request.
+func (r SetReadOnlyRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Enabled == nil {
+		problems["enabled"] = "enabled is required"
+	}
+	if len(r.Reason) > 200 {
+		problems["reason"] = "reason must be 200 characters or less"
+	}
+
+	return problems
+}
+
+// HandleGetReadOnly returns a handler that reports whether read-only mode is enabled.
+//
+//	@Summary		Get read-only mode
+//	@Description	Get whether the server is rejecting mutating requests, and who turned it on.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	readonly.Status
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/read-only [get]
+func HandleGetReadOnly(logger *slog.Logger, sw *readonly.Switch) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := encode(w, r, http.StatusOK, sw.Status()); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleSetReadOnly returns a handler that turns read-only mode on or off.
+//
+//	@Summary		Set read-only mode
+//	@Description	Turn read-only mode on or off. While enabled, POST, PUT, PATCH, and DELETE requests are rejected with 503 except login, token refresh, and this endpoint.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		SetReadOnlyRequest	true	"Read-only settings"
+//	@Success		200		{object}	readonly.Status
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/read-only [put]
+func HandleSetReadOnly(logger *slog.Logger, sw *readonly.Switch) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[SetReadOnlyRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode read-only request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		status := sw.Set(*req.Enabled, req.Reason, readonly.SourceAdmin)
+
+		userID, _ := auth.GetUserID(r.Context())
+		logger.WarnContext(r.Context(), "read-only mode changed",
+			"enabled", status.Enabled,
+			"reason", status.Reason,
+			"source", status.Source,
+			"user_id", userID,
+		)
+
+		if err := encode(w, r, http.StatusOK, status); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/rbac"
+)
+
+// PutRoleRequest represents a request to create or replace a role.
+type PutRoleRequest struct {
+	Description string            `json:"description,omitempty" example:"Can edit items"`
+	Permissions []auth.Permission `json:"permissions" example:"items:read,items:write"`
+}
+
+// Valid validates the put role request.
+func (r PutRoleRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Permissions == nil {
+		problems["permissions"] = "permissions is required"
+	}
+	for _, p := range r.Permissions {
+		resource, action, ok := strings.Cut(string(p), ":")
+		if !ok || resource == "" || action == "" {
+			problems["permissions"] = "permissions must have the form resource:action, e.g. items:read"
+			break
+		}
+	}
+	if len(r.Description) > 2048 {
+		problems["description"] = "description must be 2048 characters or less"
+	}
+
+	return problems
+}
+
+// ListRolesResponse represents the list roles response.
+type ListRolesResponse struct {
+	Roles []rbac.Role `json:"roles"`
+}
+
+// HandleListRoles returns a handler that lists roles and their permissions.
+//
+//	@Summary		List roles
+//	@Description	List the roles stored in DynamoDB and the permissions each grants.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	ListRolesResponse
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		503	{object}	problem.Details	"Roles are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/roles [get]
+func HandleListRoles(logger *slog.Logger, roles *rbac.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if roles == nil {
+			problem.Error(w, r, "Roles are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		list, err := roles.List(r.Context())
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to list roles", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, ListRolesResponse{Roles: list}); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandlePutRole returns a handler that creates a role or replaces its
+// permissions.
+//
+//	@Summary		Create or replace role
+//	@Description	Set the permissions a role grants. Users get a role by belonging to the group of the same name. Other server instances pick up the change within a minute.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string			true	"Role name"
+//	@Param			request	body		PutRoleRequest	true	"Role"
+//	@Success		200		{object}	rbac.Role
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Failure		503		{object}	problem.Details	"Roles are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/roles/{name} [put]
+func HandlePutRole(logger *slog.Logger, roles *rbac.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if roles == nil {
+			problem.Error(w, r, "Roles are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		req, problems, err := decodeValid[PutRoleRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode put role request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		userID, _ := auth.GetUserID(r.Context())
+		role, err := roles.Put(r.Context(), rbac.Role{
+			Name:        r.PathValue("name"),
+			Description: req.Description,
+			Permissions: req.Permissions,
+			UpdatedBy:   userID,
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to put role", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, role); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleDeleteRole returns a handler that deletes a role.
+//
+//	@Summary		Delete role
+//	@Description	Delete a role. Members of its group keep the group but get no permissions from it.
+//	@Tags			admin
+//	@Param			name	path	string	true	"Role name"
+//	@Success		204
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		404	{object}	problem.Details	"Role not found"
+//	@Failure		503	{object}	problem.Details	"Roles are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/roles/{name} [delete]
+func HandleDeleteRole(logger *slog.Logger, roles *rbac.Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if roles == nil {
+			problem.Error(w, r, "Roles are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		if err := roles.Delete(r.Context(), r.PathValue("name")); err != nil {
+			if errors.Is(err, rbac.ErrRoleNotFound) {
+				problem.Error(w, r, "Role not found", http.StatusNotFound)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to delete role", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	r53types "github.com/aws/aws-sdk-go-v2/service/route53/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+const (
+	// defaultRecordTTL is the TTL of records upserted without one.
+	defaultRecordTTL = 300
+	// maxRecordValues caps the values of a record set.
+	maxRecordValues = 100
+	// dnsChangeTimeout bounds how long wait=true waits for a change to reach
+	// every Route 53 name server.
+	dnsChangeTimeout = 2 * time.Minute
+)
+
+// HostedZone is a Route 53 hosted zone.
+type HostedZone struct {
+	ID          string `json:"id" example:"Z0123456789ABCDEFGHIJ"`
+	Name        string `json:"name" example:"example.com."`
+	Private     bool   `json:"private" example:"false"`
+	RecordCount int64  `json:"recordCount" example:"12"`
+	Comment     string `json:"comment,omitempty" example:"Public zone for the API"`
+}
+
+// DNSRecord is a record set in a hosted zone.
+type DNSRecord struct {
+	Name string `json:"name" example:"_acme-challenge.example.com."`
+	Type string `json:"type" example:"TXT"`
+	TTL  int64  `json:"ttl,omitempty" example:"60"`
+	// Values are the record's values; TXT values are in quotes.
+	Values []string `json:"values,omitempty"`
+	// AliasTarget is the DNS name alias records point to instead of values.
+	AliasTarget string `json:"aliasTarget,omitempty" example:"dualstack.my-alb-123456.us-east-1.elb.amazonaws.com."`
+	// SetIdentifier tells apart records of a weighted, latency, or other
+	// routing policy.
+	SetIdentifier string `json:"setIdentifier,omitempty" example:""`
+}
+
+// DNSChange is a change to a hosted zone and whether Route 53 serves it yet.
+type DNSChange struct {
+	ID string `json:"id" example:"C2682N5HXP0BZ4"`
+	// Status is PENDING until every Route 53 name server serves the change,
+	// then INSYNC.
+	Status      string     `json:"status" example:"PENDING"`
+	SubmittedAt *time.Time `json:"submittedAt,omitempty" example:"2024-03-02T08:12:45Z"`
+}
+
+// UpsertRecordRequest represents a request to create or replace a record
+// set.
+type UpsertRecordRequest struct {
+	Name string `json:"name" example:"_acme-challenge.example.com"`
+	Type string `json:"type" example:"TXT"`
+	// TTL defaults to 300 seconds.
+	TTL int64 `json:"ttl,omitempty" example:"60"`
+	// Values of TXT records are quoted unless they already are.
+	Values []string `json:"values" example:"gfj9Xq...Rg85nM"`
+}
+
+// Valid validates the upsert record request.
+func (r UpsertRecordRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if strings.TrimSuffix(r.Name, ".") == "" {
+		problems["name"] = "name is required"
+	}
+	if !slices.Contains(r53types.RRType("").Values(), r53types.RRType(strings.ToUpper(r.Type))) {
+		problems["type"] = "type must be a DNS record type such as A, CNAME, or TXT"
+	}
+	if r.TTL < 0 || r.TTL > 2147483647 {
+		problems["ttl"] = "ttl must be between 0 and 2147483647"
+	}
+	switch {
+	case len(r.Values) == 0:
+		problems["values"] = "values must have at least one value"
+	case len(r.Values) > maxRecordValues:
+		problems["values"] = "values can have at most 100 values"
+	case slices.Contains(r.Values, ""):
+		problems["values"] = "values cannot be empty"
+	}
+
+	return problems
+}
+
+// hostedZoneID strips the /hostedzone/ prefix Route 53 returns zone IDs
+// with.
+func hostedZoneID(id *string) string {
+	return strings.TrimPrefix(aws.ToString(id), "/hostedzone/")
+}
+
+// dnsChange converts a Route 53 change.
+func dnsChange(info *r53types.ChangeInfo) DNSChange {
+	return DNSChange{
+		ID:          strings.TrimPrefix(aws.ToString(info.Id), "/change/"),
+		Status:      string(info.Status),
+		SubmittedAt: info.SubmittedAt,
+	}
+}
+
+// dnsRecord converts a Route 53 record set. Route 53 returns the * of
+// wildcard names escaped as \052.
+func dnsRecord(set r53types.ResourceRecordSet) DNSRecord {
+	record := DNSRecord{
+		Name:          strings.ReplaceAll(aws.ToString(set.Name), `\052`, "*"),
+		Type:          string(set.Type),
+		TTL:           aws.ToInt64(set.TTL),
+		SetIdentifier: aws.ToString(set.SetIdentifier),
+	}
+	for _, rr := range set.ResourceRecords {
+		record.Values = append(record.Values, aws.ToString(rr.Value))
+	}
+	if set.AliasTarget != nil {
+		record.AliasTarget = aws.ToString(set.AliasTarget.DNSName)
+	}
+	return record
+}
+
+// fqdn returns name with the trailing dot Route 53 returns names with.
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+// writeDNSChangeError replies to r for err from a change to a hosted zone.
+// Route 53's message explains why a change batch was rejected, so it is
+// passed on.
+func writeDNSChangeError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *r53types.InvalidChangeBatch
+	if errors.As(err, &invalid) {
+		problem.Error(w, r, "Invalid change: "+strings.Join(invalid.Messages, "; "), http.StatusBadRequest)
+		return
+	}
+	writeAWSError(w, r, err, "Failed to change records")
+}
+
+// writeDNSChange replies to r with change, after waiting for Route 53 to
+// serve it if r asks with wait=true. Changes still pending get 202 with the
+// change's URL in Location.
+func writeDNSChange(w http.ResponseWriter, r *http.Request, logger *slog.Logger, route53Client *route53.Client, info *r53types.ChangeInfo) {
+	if r.URL.Query().Get("wait") == "true" && info.Status != r53types.ChangeStatusInsync {
+		out, err := route53.NewResourceRecordSetsChangedWaiter(route53Client).WaitForOutput(r.Context(), &route53.GetChangeInput{
+			Id: info.Id,
+		}, dnsChangeTimeout)
+		switch {
+		case err == nil:
+			info = out.ChangeInfo
+		case r.Context().Err() != nil:
+			return
+		default:
+			// The change was made; it just isn't served everywhere yet
+			logger.WarnContext(r.Context(), "stopped waiting for DNS change", "error", err, "change", aws.ToString(info.Id))
+		}
+	}
+
+	change := dnsChange(info)
+	status := http.StatusOK
+	if info.Status != r53types.ChangeStatusInsync {
+		status = http.StatusAccepted
+		w.Header().Set("Location", "/api/v1/admin/route53/changes/"+change.ID)
+	}
+	if err := encode(w, r, status, change); err != nil {
+		logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+		problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleRoute53ListZones returns a handler that lists hosted zones.
+//
+//	@Summary		List Route 53 hosted zones
+//	@Description	Get the account's public and private hosted zones
+//	@Tags			admin
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Success		200	{object}	map[string]interface{}	"zones and count"
+//	@Failure		401	{object}	problem.Details			"Unauthorized"
+//	@Failure		403	{object}	problem.Details			"Forbidden"
+//	@Failure		500	{object}	problem.Details			"Failed to list hosted zones"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/route53/zones [get]
+func HandleRoute53ListZones(logger *slog.Logger, route53Client *route53.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zones := []HostedZone{}
+		paginator := route53.NewListHostedZonesPaginator(route53Client, &route53.ListHostedZonesInput{})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to list hosted zones", "error", err)
+				writeAWSError(w, r, err, "Failed to list hosted zones")
+				return
+			}
+			for _, z := range page.HostedZones {
+				zone := HostedZone{
+					ID:          hostedZoneID(z.Id),
+					Name:        aws.ToString(z.Name),
+					RecordCount: aws.ToInt64(z.ResourceRecordSetCount),
+				}
+				if z.Config != nil {
+					zone.Private = z.Config.PrivateZone
+					zone.Comment = aws.ToString(z.Config.Comment)
+				}
+				zones = append(zones, zone)
+			}
+		}
+
+		if err := encode(w, r, http.StatusOK, newListResponse("zones", zones, len(zones))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleRoute53ListRecords returns a handler that lists the record sets of a
+// hosted zone.
+//
+//	@Summary		List Route 53 records
+//	@Description	Get the record sets of a hosted zone, optionally only those with a name or type
+//	@Tags			admin
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			zoneId	path		string					true	"Hosted zone ID"
+//	@Param			name	query		string					false	"Record name, e.g. _acme-challenge.example.com"
+//	@Param			type	query		string					false	"Record type, e.g. TXT"
+//	@Success		200		{object}	map[string]interface{}	"records and count"
+//	@Failure		401		{object}	problem.Details			"Unauthorized"
+//	@Failure		403		{object}	problem.Details			"Forbidden"
+//	@Failure		404		{object}	problem.Details			"Hosted zone not found"
+//	@Failure		500		{object}	problem.Details			"Failed to list records"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/route53/zones/{zoneId}/records [get]
+func HandleRoute53ListRecords(logger *slog.Logger, route53Client *route53.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zoneID := r.PathValue("zoneId")
+		name, recordType := r.URL.Query().Get("name"), strings.ToUpper(r.URL.Query().Get("type"))
+
+		sets, err := listRecordSets(r.Context(), route53Client, zoneID, name, recordType)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to list records", "error", err, "zone", zoneID)
+			writeAWSError(w, r, err, "Failed to list records")
+			return
+		}
+		records := make([]DNSRecord, 0, len(sets))
+		for _, set := range sets {
+			records = append(records, dnsRecord(set))
+		}
+
+		if err := encode(w, r, http.StatusOK, newListResponse("records", records, len(records))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// listRecordSets lists the record sets of a hosted zone, only those named
+// name if it isn't empty, and only those of recordType if that isn't.
+// Route 53 lists records sorted by name, so the listing starts at name and
+// stops past it.
+func listRecordSets(ctx context.Context, route53Client *route53.Client, zoneID, name, recordType string) ([]r53types.ResourceRecordSet, error) {
+	input := &route53.ListResourceRecordSetsInput{HostedZoneId: aws.String(zoneID)}
+	if name != "" {
+		name = fqdn(name)
+		input.StartRecordName = aws.String(name)
+	}
+
+	var sets []r53types.ResourceRecordSet
+	for {
+		page, err := route53Client.ListResourceRecordSets(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, set := range page.ResourceRecordSets {
+			if name != "" && !strings.EqualFold(dnsRecord(set).Name, name) {
+				return sets, nil
+			}
+			if recordType == "" || string(set.Type) == recordType {
+				sets = append(sets, set)
+			}
+		}
+		if !page.IsTruncated {
+			return sets, nil
+		}
+		input.StartRecordName = page.NextRecordName
+		input.StartRecordType = page.NextRecordType
+		input.StartRecordIdentifier = page.NextRecordIdentifier
+	}
+}
+
+// HandleRoute53UpsertRecord returns a handler that creates or replaces a
+// record set.
+//
+//	@Summary		Upsert a Route 53 record
+//	@Description	Create a record set, or replace the one with the same name and type. Route 53 takes a while to serve the change everywhere: the response is 202 with the change to poll in Location, or with wait=true, the request waits up to 2 minutes for it. For the ACME dns-01 challenge, upsert a TXT record named _acme-challenge.<domain>.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			zoneId	path		string				true	"Hosted zone ID"
+//	@Param			wait	query		bool				false	"Wait until every Route 53 name server serves the change"
+//	@Param			request	body		UpsertRecordRequest	true	"Record set"
+//	@Success		200		{object}	DNSChange			"Change is served everywhere"
+//	@Success		202		{object}	DNSChange			"Change is pending"
+//	@Failure		400		{object}	problem.Details		"Validation error or invalid change"
+//	@Failure		401		{object}	problem.Details		"Unauthorized"
+//	@Failure		403		{object}	problem.Details		"Forbidden"
+//	@Failure		404		{object}	problem.Details		"Hosted zone not found"
+//	@Failure		409		{object}	problem.Details		"Another change to the zone is in progress"
+//	@Failure		500		{object}	problem.Details		"Failed to change records"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/route53/zones/{zoneId}/records [put]
+func HandleRoute53UpsertRecord(logger *slog.Logger, route53Client *route53.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zoneID := r.PathValue("zoneId")
+
+		req, problems, err := decodeValid[UpsertRecordRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode record request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		recordType := r53types.RRType(strings.ToUpper(req.Type))
+		ttl := req.TTL
+		if ttl == 0 {
+			ttl = defaultRecordTTL
+		}
+		set := &r53types.ResourceRecordSet{
+			Name: aws.String(fqdn(req.Name)),
+			Type: recordType,
+			TTL:  aws.Int64(ttl),
+		}
+		for _, value := range req.Values {
+			if recordType == r53types.RRTypeTxt && !strings.HasPrefix(value, `"`) {
+				value = strconv.Quote(value)
+			}
+			set.ResourceRecords = append(set.ResourceRecords, r53types.ResourceRecord{Value: aws.String(value)})
+		}
+
+		logger.InfoContext(r.Context(), "upserting DNS record", "zone", zoneID, "name", aws.ToString(set.Name), "type", recordType)
+
+		result, err := route53Client.ChangeResourceRecordSets(r.Context(), &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(zoneID),
+			ChangeBatch: &r53types.ChangeBatch{
+				Changes: []r53types.Change{{Action: r53types.ChangeActionUpsert, ResourceRecordSet: set}},
+			},
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to upsert DNS record", "error", err, "zone", zoneID, "name", req.Name)
+			writeDNSChangeError(w, r, err)
+			return
+		}
+
+		writeDNSChange(w, r, logger, route53Client, result.ChangeInfo)
+	})
+}
+
+// HandleRoute53DeleteRecord returns a handler that deletes a record set.
+//
+//	@Summary		Delete a Route 53 record
+//	@Description	Delete the record set with a name and type, or with setIdentifier, the one of a routing policy. Like upserts, the response is 202 with the change to poll in Location, unless wait=true.
+//	@Tags			admin
+//	@Produce		json
+//	@Param			zoneId			path		string			true	"Hosted zone ID"
+//	@Param			name			path		string			true	"Record name"
+//	@Param			type			path		string			true	"Record type"
+//	@Param			setIdentifier	query		string			false	"Set identifier of a routing policy's record"
+//	@Param			wait			query		bool			false	"Wait until every Route 53 name server serves the change"
+//	@Success		200				{object}	DNSChange		"Change is served everywhere"
+//	@Success		202				{object}	DNSChange		"Change is pending"
+//	@Failure		400				{object}	problem.Details	"Invalid change"
+//	@Failure		401				{object}	problem.Details	"Unauthorized"
+//	@Failure		403				{object}	problem.Details	"Forbidden"
+//	@Failure		404				{object}	problem.Details	"Hosted zone or record not found"
+//	@Failure		409				{object}	problem.Details	"Another change to the zone is in progress"
+//	@Failure		500				{object}	problem.Details	"Failed to change records"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/route53/zones/{zoneId}/records/{name}/{type} [delete]
+func HandleRoute53DeleteRecord(logger *slog.Logger, route53Client *route53.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zoneID := r.PathValue("zoneId")
+		name, recordType := r.PathValue("name"), strings.ToUpper(r.PathValue("type"))
+		setIdentifier := r.URL.Query().Get("setIdentifier")
+
+		// Route 53 deletes a record set only if given exactly as it is
+		sets, err := listRecordSets(r.Context(), route53Client, zoneID, name, recordType)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to list records", "error", err, "zone", zoneID)
+			writeAWSError(w, r, err, "Failed to list records")
+			return
+		}
+		i := slices.IndexFunc(sets, func(set r53types.ResourceRecordSet) bool {
+			return aws.ToString(set.SetIdentifier) == setIdentifier
+		})
+		if i < 0 {
+			problem.Error(w, r, "Record not found", http.StatusNotFound)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "deleting DNS record", "zone", zoneID, "name", name, "type", recordType)
+
+		result, err := route53Client.ChangeResourceRecordSets(r.Context(), &route53.ChangeResourceRecordSetsInput{
+			HostedZoneId: aws.String(zoneID),
+			ChangeBatch: &r53types.ChangeBatch{
+				Changes: []r53types.Change{{Action: r53types.ChangeActionDelete, ResourceRecordSet: &sets[i]}},
+			},
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to delete DNS record", "error", err, "zone", zoneID, "name", name)
+			writeDNSChangeError(w, r, err)
+			return
+		}
+
+		writeDNSChange(w, r, logger, route53Client, result.ChangeInfo)
+	})
+}
+
+// HandleRoute53GetChange returns a handler that reports whether a change to a
+// hosted zone is served yet.
+//
+//	@Summary		Get a Route 53 change
+//	@Description	Get whether every Route 53 name server serves a change yet (INSYNC) or not (PENDING)
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		string	true	"Change ID"
+//	@Success		200	{object}	DNSChange
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		404	{object}	problem.Details	"Change not found"
+//	@Failure		500	{object}	problem.Details	"Failed to get change"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/route53/changes/{id} [get]
+func HandleRoute53GetChange(logger *slog.Logger, route53Client *route53.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		result, err := route53Client.GetChange(r.Context(), &route53.GetChangeInput{Id: aws.String(id)})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get DNS change", "error", err, "change", id)
+			writeAWSError(w, r, err, "Failed to get change")
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, dnsChange(result.ChangeInfo)); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// maxMessageSize is the largest message body SQS accepts.
+const maxMessageSize = 256 * 1024
+
+// SendMessageRequest represents a message to send to a queue.
+type SendMessageRequest struct {
+	Body string `json:"body" example:"{\"name\":\"Sample Item\"}"`
+	// DelaySeconds hides the message for up to 15 minutes after it is sent.
+	DelaySeconds int32 `json:"delaySeconds,omitempty" example:"0"`
+	// Attributes are string message attributes, such as the type the
+	// server's consumer dispatches on.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// GroupID and DeduplicationID are for FIFO queues.
+	GroupID         string `json:"groupId,omitempty" example:"orders"`
+	DeduplicationID string `json:"deduplicationId,omitempty"`
+}
+
+// Valid validates the send message request.
+func (r SendMessageRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Body == "" {
+		problems["body"] = "body is required and cannot be empty"
+	} else if len(r.Body) > maxMessageSize {
+		problems["body"] = "body must be at most 256 KiB"
+	}
+	if r.DelaySeconds < 0 || r.DelaySeconds > 900 {
+		problems["delaySeconds"] = "delaySeconds must be between 0 and 900"
+	}
+	if len(r.Attributes) > 10 {
+		problems["attributes"] = "at most 10 attributes are allowed"
+	}
+
+	return problems
+}
+
+// SendMessageResponse represents a message sent to a queue.
+type SendMessageResponse struct {
+	MessageID string `json:"messageId" example:"5fea7756-0ea4-451a-a703-a558b933e274"`
+	// SequenceNumber is set for FIFO queues.
+	SequenceNumber string `json:"sequenceNumber,omitempty"`
+}
+
+// QueueMessage is a message received from a queue.
+type QueueMessage struct {
+	MessageID    string            `json:"messageId" example:"5fea7756-0ea4-451a-a703-a558b933e274"`
+	Body         string            `json:"body" example:"{\"name\":\"Sample Item\"}"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	ReceiveCount int               `json:"receiveCount" example:"1"`
+	SentAt       *time.Time        `json:"sentAt,omitempty"`
+	// ReceiptHandle deletes the message. Peeked messages have none.
+	ReceiptHandle string `json:"receiptHandle,omitempty"`
+}
+
+// HandleSQSListQueues returns a handler that lists SQS queues.
+//
+//	@Summary		List SQS queues
+//	@Description	Get the URLs of the SQS queues in the AWS account, optionally only those whose name starts with prefix
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			prefix	query		string					false	"Queue name prefix"
+//	@Success		200		{object}	map[string]interface{}	"queues and count"
+//	@Failure		401		{object}	problem.Details			"Unauthorized"
+//	@Failure		500		{object}	problem.Details			"Failed to list SQS queues"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/sqs/queues [get]
+func HandleSQSListQueues(logger *slog.Logger, sqsClient *sqs.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		input := &sqs.ListQueuesInput{}
+		if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+			input.QueueNamePrefix = aws.String(prefix)
+		}
+
+		queues := []string{}
+		paginator := sqs.NewListQueuesPaginator(sqsClient, input)
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(r.Context())
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to list SQS queues", "error", err)
+				writeAWSError(w, r, err, "Failed to list SQS queues")
+				return
+			}
+			queues = append(queues, page.QueueUrls...)
+		}
+
+		if err := encode(w, r, http.StatusOK, newListResponse("queues", queues, len(queues))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleSQSSendMessage returns a handler that sends a message to a queue.
+//
+//	@Summary		Send an SQS message
+//	@Description	Send a message to a queue. Set the "type" attribute for messages meant for the server's own consumer.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			queueName	path		string				true	"Queue name"
+//	@Param			request		body		SendMessageRequest	true	"Message"
+//	@Success		201			{object}	SendMessageResponse
+//	@Failure		400			{object}	problem.Details	"Validation error"
+//	@Failure		401			{object}	problem.Details	"Unauthorized"
+//	@Failure		404			{object}	problem.Details	"Queue not found"
+//	@Failure		500			{object}	problem.Details	"Failed to send message"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/sqs/queues/{queueName}/messages [post]
+func HandleSQSSendMessage(logger *slog.Logger, sqsClient *sqs.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[SendMessageRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode send message request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		queueName := r.PathValue("queueName")
+		queueURL, err := sqsQueueURL(r.Context(), sqsClient, queueName)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get SQS queue URL", "error", err, "queue", queueName)
+			writeAWSError(w, r, err, "Failed to send message")
+			return
+		}
+
+		input := &sqs.SendMessageInput{
+			QueueUrl:     aws.String(queueURL),
+			MessageBody:  aws.String(req.Body),
+			DelaySeconds: req.DelaySeconds,
+		}
+		if len(req.Attributes) > 0 {
+			input.MessageAttributes = make(map[string]sqstypes.MessageAttributeValue, len(req.Attributes))
+			for name, value := range req.Attributes {
+				input.MessageAttributes[name] = sqstypes.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(value),
+				}
+			}
+		}
+		if req.GroupID != "" {
+			input.MessageGroupId = aws.String(req.GroupID)
+		}
+		if req.DeduplicationID != "" {
+			input.MessageDeduplicationId = aws.String(req.DeduplicationID)
+		}
+
+		result, err := sqsClient.SendMessage(r.Context(), input)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to send SQS message", "error", err, "queue", queueName)
+			writeAWSError(w, r, err, "Failed to send message")
+			return
+		}
+
+		logger.InfoContext(r.Context(), "SQS message sent", "queue", queueName, "message_id", aws.ToString(result.MessageId))
+		resp := SendMessageResponse{
+			MessageID:      aws.ToString(result.MessageId),
+			SequenceNumber: aws.ToString(result.SequenceNumber),
+		}
+		if err := encode(w, r, http.StatusCreated, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleSQSReceiveMessages returns a handler that receives or peeks at a
+// queue's messages.
+//
+//	@Summary		Receive SQS messages
+//	@Description	Receive up to max messages from a queue. Received messages are hidden from other consumers for visibilityTimeout seconds, and deleted with their receiptHandle. With peek=true, messages are made visible again at once and have no receipt handle; peeking still counts as a receive towards the queue's redrive policy.
+//	@Tags			aws
+//	@Produce		json,application/x-ndjson,text/csv
+//	@Param			queueName			path		string					true	"Queue name"
+//	@Param			max					query		int						false	"Messages to receive (1-10)"			default(1)
+//	@Param			wait				query		int						false	"Seconds to wait for messages (0-20)"	default(0)
+//	@Param			visibilityTimeout	query		int						false	"Seconds received messages are hidden (1-43200); defaults to the queue's setting"
+//	@Param			peek				query		bool					false	"Leave the messages visible"
+//	@Success		200					{object}	map[string]interface{}	"messages and count"
+//	@Failure		400					{object}	problem.Details			"Invalid query parameter"
+//	@Failure		401					{object}	problem.Details			"Unauthorized"
+//	@Failure		404					{object}	problem.Details			"Queue not found"
+//	@Failure		500					{object}	problem.Details			"Failed to receive messages"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/sqs/queues/{queueName}/messages [get]
+func HandleSQSReceiveMessages(logger *slog.Logger, sqsClient *sqs.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		input := &sqs.ReceiveMessageInput{
+			MaxNumberOfMessages:         1,
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{sqstypes.MessageSystemAttributeNameAll},
+		}
+
+		problems := make(map[string]string)
+		if value := query.Get("max"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 10 {
+				problems["max"] = "max must be between 1 and 10"
+			}
+			input.MaxNumberOfMessages = int32(n)
+		}
+		if value := query.Get("wait"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n > 20 {
+				problems["wait"] = "wait must be between 0 and 20"
+			}
+			input.WaitTimeSeconds = int32(n)
+		}
+		if value := query.Get("visibilityTimeout"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 43200 {
+				problems["visibilityTimeout"] = "visibilityTimeout must be between 1 and 43200"
+			}
+			input.VisibilityTimeout = int32(n)
+		}
+		peek := false
+		if value := query.Get("peek"); value != "" {
+			var err error
+			if peek, err = strconv.ParseBool(value); err != nil {
+				problems["peek"] = "peek must be true or false"
+			}
+		}
+		if len(problems) > 0 {
+			problem.Validation(w, r, problems)
+			return
+		}
+
+		queueName := r.PathValue("queueName")
+		queueURL, err := sqsQueueURL(r.Context(), sqsClient, queueName)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get SQS queue URL", "error", err, "queue", queueName)
+			writeAWSError(w, r, err, "Failed to receive messages")
+			return
+		}
+		input.QueueUrl = aws.String(queueURL)
+
+		result, err := sqsClient.ReceiveMessage(r.Context(), input)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to receive SQS messages", "error", err, "queue", queueName)
+			writeAWSError(w, r, err, "Failed to receive messages")
+			return
+		}
+
+		if peek && len(result.Messages) > 0 {
+			// A receive with no visibility timeout uses the queue's, so
+			// make the messages visible again right after
+			if err := releaseMessages(r.Context(), sqsClient, queueURL, result.Messages); err != nil {
+				logger.WarnContext(r.Context(), "failed to release peeked SQS messages", "error", err, "queue", queueName)
+			}
+		}
+
+		messages := make([]QueueMessage, 0, len(result.Messages))
+		for _, msg := range result.Messages {
+			m := queueMessage(msg)
+			if peek {
+				m.ReceiptHandle = ""
+			}
+			messages = append(messages, m)
+		}
+
+		if err := encode(w, r, http.StatusOK, newListResponse("messages", messages, len(messages))); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleSQSDeleteMessage returns a handler that deletes a received message.
+//
+//	@Summary		Delete an SQS message
+//	@Description	Delete a message received from a queue, by the receipt handle it was received with
+//	@Tags			aws
+//	@Param			queueName		path	string	true	"Queue name"
+//	@Param			receiptHandle	query	string	true	"Receipt handle from receiving the message"
+//	@Success		204
+//	@Failure		400	{object}	problem.Details	"Missing or invalid receipt handle"
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		404	{object}	problem.Details	"Queue not found"
+//	@Failure		500	{object}	problem.Details	"Failed to delete message"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/sqs/queues/{queueName}/messages [delete]
+func HandleSQSDeleteMessage(logger *slog.Logger, sqsClient *sqs.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receiptHandle := r.URL.Query().Get("receiptHandle")
+		if receiptHandle == "" {
+			problem.Validation(w, r, map[string]string{"receiptHandle": "receiptHandle is required"})
+			return
+		}
+
+		queueName := r.PathValue("queueName")
+		queueURL, err := sqsQueueURL(r.Context(), sqsClient, queueName)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get SQS queue URL", "error", err, "queue", queueName)
+			writeAWSError(w, r, err, "Failed to delete message")
+			return
+		}
+
+		_, err = sqsClient.DeleteMessage(r.Context(), &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(queueURL),
+			ReceiptHandle: aws.String(receiptHandle),
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to delete SQS message", "error", err, "queue", queueName)
+			writeAWSError(w, r, err, "Failed to delete message")
+			return
+		}
+
+		logger.InfoContext(r.Context(), "SQS message deleted", "queue", queueName)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// sqsQueueURL returns the URL of the queue named name.
+func sqsQueueURL(ctx context.Context, sqsClient *sqs.Client, name string) (string, error) {
+	result, err := sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(result.QueueUrl), nil
+}
+
+// releaseMessages makes received messages visible to consumers again.
+func releaseMessages(ctx context.Context, sqsClient *sqs.Client, queueURL string, messages []sqstypes.Message) error {
+	entries := make([]sqstypes.ChangeMessageVisibilityBatchRequestEntry, len(messages))
+	for i, msg := range messages {
+		entries[i] = sqstypes.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			ReceiptHandle:     msg.ReceiptHandle,
+			VisibilityTimeout: 0,
+		}
+	}
+	result, err := sqsClient.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		return err
+	}
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d of %d messages stay hidden: %s", len(result.Failed), len(entries), aws.ToString(result.Failed[0].Message))
+	}
+	return nil
+}
+
+// queueMessage converts a received SQS message.
+func queueMessage(msg sqstypes.Message) QueueMessage {
+	m := QueueMessage{
+		MessageID:     aws.ToString(msg.MessageId),
+		Body:          aws.ToString(msg.Body),
+		ReceiptHandle: aws.ToString(msg.ReceiptHandle),
+	}
+	for name, value := range msg.MessageAttributes {
+		if value.StringValue == nil {
+			continue
+		}
+		if m.Attributes == nil {
+			m.Attributes = make(map[string]string, len(msg.MessageAttributes))
+		}
+		m.Attributes[name] = *value.StringValue
+	}
+	m.ReceiveCount, _ = strconv.Atoi(msg.Attributes[string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount)])
+	if sent, err := strconv.ParseInt(msg.Attributes[string(sqstypes.MessageSystemAttributeNameSentTimestamp)], 10, 64); err == nil {
+		t := time.UnixMilli(sent).UTC()
+		m.SentAt = &t
+	}
+	return m
+}
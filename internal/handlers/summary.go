@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"golang.org/x/sync/singleflight"
+
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/awscalls"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// summaryCacheTTL is how long an account summary is served from memory.
+const summaryCacheTTL = 60 * time.Second
+
+// roleUnavailable explains why SQS, SNS, and Lambda aren't summarized when
+// X-AWS-Role selects a role: only S3, DynamoDB, and STS calls are sent as
+// it, so the server's own account would be described instead.
+const roleUnavailable = "not available with X-AWS-Role; only S3 and DynamoDB calls are sent as the selected role"
+
+// summaryBuildTimeout bounds building a summary, which outlives the request
+// that started it so the other requests waiting on it still get one.
+const summaryBuildTimeout = 30 * time.Second
+
+// AWSSummary represents an account-wide overview of AWS resources.
+type AWSSummary struct {
+	S3          S3Summary       `json:"s3"`
+	DynamoDB    DynamoDBSummary `json:"dynamodb"`
+	SQS         SQSSummary      `json:"sqs"`
+	SNS         SNSSummary      `json:"sns"`
+	Lambda      LambdaSummary   `json:"lambda"`
+	GeneratedAt time.Time       `json:"generatedAt"`
+	Cached      bool            `json:"cached"`
+}
+
+// S3Summary summarizes the S3 buckets in the account.
+type S3Summary struct {
+	Count   int             `json:"count"`
+	Buckets []BucketSummary `json:"buckets"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// BucketSummary holds key metadata for a single bucket.
+type BucketSummary struct {
+	Name         string     `json:"name"`
+	CreationDate *time.Time `json:"creationDate,omitempty"`
+}
+
+// DynamoDBSummary summarizes the DynamoDB tables in the account.
+type DynamoDBSummary struct {
+	Count  int      `json:"count"`
+	Tables []string `json:"tables"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// SQSSummary summarizes the SQS queues in the account.
+type SQSSummary struct {
+	Count  int      `json:"count"`
+	Queues []string `json:"queues"`
+	Error  string   `json:"error,omitempty"`
+	// Unavailable is why the service wasn't summarized, if it wasn't.
+	Unavailable string `json:"unavailable,omitempty"`
+}
+
+// SNSSummary summarizes the SNS topics in the account.
+type SNSSummary struct {
+	Count  int      `json:"count"`
+	Topics []string `json:"topics"`
+	Error  string   `json:"error,omitempty"`
+	// Unavailable is why the service wasn't summarized, if it wasn't.
+	Unavailable string `json:"unavailable,omitempty"`
+}
+
+// LambdaSummary summarizes the Lambda functions in the account.
+type LambdaSummary struct {
+	Count     int               `json:"count"`
+	Functions []FunctionSummary `json:"functions"`
+	Error     string            `json:"error,omitempty"`
+	// Unavailable is why the service wasn't summarized, if it wasn't.
+	Unavailable string `json:"unavailable,omitempty"`
+}
+
+// FunctionSummary holds key metadata for a single Lambda function.
+type FunctionSummary struct {
+	Name         string `json:"name"`
+	Runtime      string `json:"runtime,omitempty"`
+	MemorySize   int32  `json:"memorySize,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// summaryCache holds the most recently built summary for each AWS role,
+// since a role's summary describes another account. Concurrent requests for
+// a summary that isn't cached share one build.
+type summaryCache struct {
+	mu      sync.Mutex
+	entries map[string]summaryEntry // keyed by AWS role, "" for the server's own
+	builds  singleflight.Group
+}
+
+// summaryEntry is a cached summary and when it goes stale.
+type summaryEntry struct {
+	summary   *AWSSummary
+	expiresAt time.Time
+}
+
+// get returns role's summary if it hasn't gone stale.
+func (c *summaryCache) get(role string) (*AWSSummary, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[role]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.summary, true
+}
+
+// put caches role's summary for summaryCacheTTL.
+func (c *summaryCache) put(role string, summary *AWSSummary) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[role] = summaryEntry{summary: summary, expiresAt: summary.GeneratedAt.Add(summaryCacheTTL)}
+}
+
+// HandleAWSSummary returns a handler that aggregates resources across AWS services.
+//
+//	@Summary		AWS account summary
+//	@Description	Get counts and key metadata for S3, DynamoDB, SQS, SNS, and Lambda in a single call. Results are cached for 60 seconds, separately for each X-AWS-Role; failures in one service are reported in that service's error field, and summaries with failures aren't cached. With X-AWS-Role, only S3 and DynamoDB are summarized as the selected role; SQS, SNS, and Lambda report why they are unavailable instead.
+//	@Tags			aws
+//	@Produce		json
+//	@Success		200	{object}	AWSSummary
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		500	{object}	problem.Details	"Internal Server Error"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/summary [get]
+func HandleAWSSummary(logger *slog.Logger, clients *awsclients.Clients) http.Handler {
+	cache := &summaryCache{entries: make(map[string]summaryEntry)}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := awsclients.RoleFromContext(r.Context())
+		if cached, ok := cache.get(role); ok {
+			logger.InfoContext(r.Context(), "serving cached AWS summary", "generated_at", cached.GeneratedAt, "role", role)
+			response := *cached
+			response.Cached = true
+			if err := encode(w, r, http.StatusOK, response); err != nil {
+				logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			}
+			return
+		}
+
+		result, _, _ := cache.builds.Do(role, func() (any, error) {
+			// Build without the request's cancellation and call budget: the
+			// summary is shared, so one client going away or running out of
+			// calls mustn't spoil it for the others
+			ctx, cancel := context.WithTimeout(awscalls.Detach(context.WithoutCancel(r.Context())), summaryBuildTimeout)
+			defer cancel()
+
+			logger.InfoContext(ctx, "building AWS summary", "role", role)
+			summary := buildAWSSummary(ctx, logger, clients, role)
+			if summary.failed() {
+				logger.WarnContext(ctx, "not caching AWS summary with failed services", "role", role)
+			} else {
+				cache.put(role, summary)
+			}
+			return summary, nil
+		})
+		summary := result.(*AWSSummary)
+
+		if err := encode(w, r, http.StatusOK, summary); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// failed reports whether any service couldn't be summarized.
+func (s *AWSSummary) failed() bool {
+	return s.S3.Error != "" || s.DynamoDB.Error != "" || s.SQS.Error != "" || s.SNS.Error != "" || s.Lambda.Error != ""
+}
+
+// buildAWSSummary queries each service concurrently and collects the
+// results. With a role selected, only the services whose calls are sent as
+// it are queried.
+func buildAWSSummary(ctx context.Context, logger *slog.Logger, clients *awsclients.Clients, role string) *AWSSummary {
+	summary := &AWSSummary{}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		summary.S3 = summarizeS3(ctx, clients.S3)
+		if summary.S3.Error != "" {
+			logger.ErrorContext(ctx, "failed to summarize S3", "error", summary.S3.Error)
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		summary.DynamoDB = summarizeDynamoDB(ctx, clients.DynamoDB)
+		if summary.DynamoDB.Error != "" {
+			logger.ErrorContext(ctx, "failed to summarize DynamoDB", "error", summary.DynamoDB.Error)
+		}
+	}()
+
+	if role == "" {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			summary.SQS = summarizeSQS(ctx, clients.SQS)
+			if summary.SQS.Error != "" {
+				logger.ErrorContext(ctx, "failed to summarize SQS", "error", summary.SQS.Error)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			summary.SNS = summarizeSNS(ctx, clients.SNS)
+			if summary.SNS.Error != "" {
+				logger.ErrorContext(ctx, "failed to summarize SNS", "error", summary.SNS.Error)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			summary.Lambda = summarizeLambda(ctx, clients.Lambda)
+			if summary.Lambda.Error != "" {
+				logger.ErrorContext(ctx, "failed to summarize Lambda", "error", summary.Lambda.Error)
+			}
+		}()
+	} else {
+		summary.SQS = SQSSummary{Queues: []string{}, Unavailable: roleUnavailable}
+		summary.SNS = SNSSummary{Topics: []string{}, Unavailable: roleUnavailable}
+		summary.Lambda = LambdaSummary{Functions: []FunctionSummary{}, Unavailable: roleUnavailable}
+	}
+
+	wg.Wait()
+	summary.GeneratedAt = time.Now().UTC()
+
+	return summary
+}
+
+func summarizeS3(ctx context.Context, client *s3.Client) S3Summary {
+	result, err := client.ListBuckets(ctx, &s3.ListBucketsInput{})
+	if err != nil {
+		return S3Summary{Buckets: []BucketSummary{}, Error: err.Error()}
+	}
+
+	buckets := make([]BucketSummary, 0, len(result.Buckets))
+	for _, bucket := range result.Buckets {
+		buckets = append(buckets, BucketSummary{
+			Name:         aws.ToString(bucket.Name),
+			CreationDate: bucket.CreationDate,
+		})
+	}
+
+	return S3Summary{Count: len(buckets), Buckets: buckets}
+}
+
+func summarizeDynamoDB(ctx context.Context, client *dynamodb.Client) DynamoDBSummary {
+	tables := []string{}
+	paginator := dynamodb.NewListTablesPaginator(client, &dynamodb.ListTablesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return DynamoDBSummary{Tables: []string{}, Error: err.Error()}
+		}
+		tables = append(tables, page.TableNames...)
+	}
+
+	return DynamoDBSummary{Count: len(tables), Tables: tables}
+}
+
+func summarizeSQS(ctx context.Context, client *sqs.Client) SQSSummary {
+	queues := []string{}
+	paginator := sqs.NewListQueuesPaginator(client, &sqs.ListQueuesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return SQSSummary{Queues: []string{}, Error: err.Error()}
+		}
+		queues = append(queues, page.QueueUrls...)
+	}
+
+	return SQSSummary{Count: len(queues), Queues: queues}
+}
+
+func summarizeSNS(ctx context.Context, client *sns.Client) SNSSummary {
+	topics := []string{}
+	paginator := sns.NewListTopicsPaginator(client, &sns.ListTopicsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return SNSSummary{Topics: []string{}, Error: err.Error()}
+		}
+		for _, topic := range page.Topics {
+			topics = append(topics, aws.ToString(topic.TopicArn))
+		}
+	}
+
+	return SNSSummary{Count: len(topics), Topics: topics}
+}
+
+func summarizeLambda(ctx context.Context, client *lambda.Client) LambdaSummary {
+	functions := []FunctionSummary{}
+	paginator := lambda.NewListFunctionsPaginator(client, &lambda.ListFunctionsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return LambdaSummary{Functions: []FunctionSummary{}, Error: err.Error()}
+		}
+		for _, fn := range page.Functions {
+			functions = append(functions, FunctionSummary{
+				Name:         aws.ToString(fn.FunctionName),
+				Runtime:      string(fn.Runtime),
+				MemorySize:   aws.ToInt32(fn.MemorySize),
+				LastModified: aws.ToString(fn.LastModified),
+			})
+		}
+	}
+
+	return LambdaSummary{Count: len(functions), Functions: functions}
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/diagnostics"
+	"github.com/pmollerus23/go-aws-server/internal/importer"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/store"
+)
+
+const (
+	// supportBundleURLExpiry is how long the bundle download link stays valid.
+	supportBundleURLExpiry = 1 * time.Hour
+	// dependencyCheckTimeout bounds each dependency health check.
+	dependencyCheckTimeout = 5 * time.Second
+)
+
+// SupportBundleResponse describes an uploaded support bundle.
+type SupportBundleResponse struct {
+	Bucket      string    `json:"bucket"`
+	Key         string    `json:"key" example:"support-bundles/20240101T120000Z-01HZX3V8Q4K7M2N9P5R6S8T0W1.tar.gz"`
+	Size        int       `json:"size"`
+	DownloadURL string    `json:"downloadUrl"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// DependencyHealth is the result of checking a single dependency.
+type DependencyHealth struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HandleSupportBundle returns a handler that builds a diagnostic bundle and stores it in S3.
+//
+//	@Summary		Create support bundle
+//	@Description	Assemble a diagnostic archive (redacted config, version info, recent logs, dependency health, import jobs and their worker concurrency, goroutine dump), upload it to the configured S3 bucket, and return a time-limited download link.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		201	{object}	SupportBundleResponse
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		500	{object}	problem.Details	"Failed to create support bundle"
+//	@Failure		503	{object}	problem.Details	"Support bundles are not configured"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/support-bundle [post]
+func HandleSupportBundle(logger *slog.Logger, cfg *config.Config, clients *awsclients.Clients, logs *diagnostics.LogBuffer, imports *importer.Importer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket := cfg.AWS.SupportBundleBucket
+		if bucket == "" {
+			problem.Error(w, r, "Support bundles are not configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		now := time.Now().UTC()
+		archive, err := buildSupportBundle(r.Context(), cfg, clients, logs, imports, now)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to build support bundle", "error", err)
+			problem.Error(w, r, "Failed to create support bundle", http.StatusInternalServerError)
+			return
+		}
+
+		key := fmt.Sprintf("support-bundles/%s-%s.tar.gz", now.Format("20060102T150405Z"), store.NewULID())
+
+		_, err = clients.S3.PutObject(r.Context(), &s3.PutObjectInput{
+			Bucket:               aws.String(bucket),
+			Key:                  aws.String(key),
+			Body:                 bytes.NewReader(archive),
+			ContentType:          aws.String("application/gzip"),
+			ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to upload support bundle", "error", err, "bucket", bucket, "key", key)
+			problem.Error(w, r, "Failed to create support bundle", http.StatusInternalServerError)
+			return
+		}
+
+		presigned, err := s3.NewPresignClient(clients.S3).PresignGetObject(r.Context(), &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}, s3.WithPresignExpires(supportBundleURLExpiry))
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to presign support bundle", "error", err, "bucket", bucket, "key", key)
+			problem.Error(w, r, "Failed to create support bundle", http.StatusInternalServerError)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "support bundle created", "bucket", bucket, "key", key, "size", len(archive))
+
+		response := SupportBundleResponse{
+			Bucket:      bucket,
+			Key:         key,
+			Size:        len(archive),
+			DownloadURL: presigned.URL,
+			ExpiresAt:   now.Add(supportBundleURLExpiry),
+		}
+
+		if err := encode(w, r, http.StatusCreated, response); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// buildSupportBundle collects diagnostics and returns them as a gzipped tar archive.
+func buildSupportBundle(ctx context.Context, cfg *config.Config, clients *awsclients.Clients, logs *diagnostics.LogBuffer, imports *importer.Importer, now time.Time) ([]byte, error) {
+	var goroutines bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+		return nil, fmt.Errorf("dump goroutines: %w", err)
+	}
+
+	var logLines bytes.Buffer
+	for _, line := range logs.Lines() {
+		logLines.Write(line)
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"config.json", redactedConfig(cfg)},
+		{"version.json", versionInfo()},
+		{"health.json", checkDependencies(ctx, cfg, clients)},
+		{"imports.json", imports.Jobs()},
+		{"logs.jsonl", logLines.Bytes()},
+		{"goroutines.txt", goroutines.Bytes()},
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range files {
+		data, ok := f.data.([]byte)
+		if !ok {
+			var err error
+			data, err = json.MarshalIndent(f.data, "", "  ")
+			if err != nil {
+				return nil, fmt.Errorf("marshal %s: %w", f.name, err)
+			}
+		}
+
+		header := &tar.Header{
+			Name:    f.name,
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("write %s header: %w", f.name, err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, fmt.Errorf("write %s: %w", f.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("close tar: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("close gzip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// HandleConfigDump returns a handler that reports the running configuration
+// with secrets removed. It is served on the admin listener only, so it isn't
+// part of the API docs.
+func HandleConfigDump(logger *slog.Logger, cfg *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := encode(w, r, http.StatusOK, redactedConfig(cfg)); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// redactedConfig returns a copy of the configuration with secrets removed.
+func redactedConfig(cfg *config.Config) config.Config {
+	redacted := *cfg
+	redact(&redacted.Cognito.ClientSecret)
+	redact(&redacted.Cognito.LegacyAuthSecret)
+	redact(&redacted.Auth.OIDC.ClientSecret)
+	redact(&redacted.Auth.Local.Secret)
+	redact(&redacted.Auth.Impersonation.Secret)
+	if u, err := url.Parse(redacted.Postgres.URL); err == nil {
+		redacted.Postgres.URL = u.Redacted()
+	}
+
+	// Copy the slices so the redaction doesn't reach the live configuration
+	redacted.Auth.Local.Users = slices.Clone(redacted.Auth.Local.Users)
+	for i := range redacted.Auth.Local.Users {
+		redact(&redacted.Auth.Local.Users[i].Password)
+	}
+	redacted.Auth.IAM.Keys = slices.Clone(redacted.Auth.IAM.Keys)
+	for i := range redacted.Auth.IAM.Keys {
+		redact(&redacted.Auth.IAM.Keys[i].SecretAccessKey)
+	}
+	return redacted
+}
+
+// redact replaces the secret in s, if it is set.
+func redact(s *string) {
+	if *s != "" {
+		*s = "[REDACTED]"
+	}
+}
+
+// versionInfo describes the running binary and its build.
+func versionInfo() map[string]interface{} {
+	info := map[string]interface{}{
+		"goVersion":    runtime.Version(),
+		"os":           runtime.GOOS,
+		"arch":         runtime.GOARCH,
+		"numCPU":       runtime.NumCPU(),
+		"numGoroutine": runtime.NumGoroutine(),
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info["module"] = build.Main.Path
+	info["version"] = build.Main.Version
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision", "vcs.time", "vcs.modified":
+			info[setting.Key] = setting.Value
+		}
+	}
+
+	deps := make(map[string]string, len(build.Deps))
+	for _, dep := range build.Deps {
+		deps[dep.Path] = dep.Version
+	}
+	info["dependencies"] = deps
+
+	return info
+}
+
+// checkDependencies probes each external dependency concurrently.
+func checkDependencies(ctx context.Context, cfg *config.Config, clients *awsclients.Clients) []DependencyHealth {
+	checks := []struct {
+		name  string
+		check func(ctx context.Context) error
+	}{
+		{"dynamodb", func(ctx context.Context) error {
+			_, err := clients.DynamoDB.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+				TableName: aws.String(cfg.AWS.RecordsTable),
+			})
+			return err
+		}},
+		{"s3", func(ctx context.Context) error {
+			_, err := clients.S3.HeadBucket(ctx, &s3.HeadBucketInput{
+				Bucket: aws.String(cfg.AWS.SupportBundleBucket),
+			})
+			return err
+		}},
+		{"cognito", func(ctx context.Context) error {
+			_, err := clients.Cognito.DescribeUserPool(ctx, &cognito.DescribeUserPoolInput{
+				UserPoolId: aws.String(cfg.Cognito.UserPoolID),
+			})
+			return err
+		}},
+	}
+
+	results := make([]DependencyHealth, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.check(ctx)
+			results[i] = DependencyHealth{
+				Name:      c.name,
+				Status:    "ok",
+				LatencyMS: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				results[i].Status = "error"
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
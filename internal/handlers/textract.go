@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/pmollerus23/go-aws-server/internal/documents"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// TextractAnalyzeRequest represents a document in S3 to analyze.
+type TextractAnalyzeRequest struct {
+	Bucket string `json:"bucket" example:"uploads"`
+	Key    string `json:"key" example:"invoices/1042.pdf"`
+	// Features are FORMS and TABLES, both by default. Text is always
+	// extracted.
+	Features []string `json:"features,omitempty" example:"FORMS,TABLES"`
+}
+
+// Valid validates the analyze request.
+func (r TextractAnalyzeRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+	if r.Bucket == "" {
+		problems["bucket"] = "bucket is required and cannot be empty"
+	}
+	if r.Key == "" {
+		problems["key"] = "key is required and cannot be empty"
+	} else if _, err := documents.Async(r.Key); err != nil {
+		problems["key"] = err.Error()
+	}
+	for i, feature := range r.Features {
+		if feature != documents.FeatureForms && feature != documents.FeatureTables {
+			problems["features["+strconv.Itoa(i)+"]"] = "features must be FORMS or TABLES"
+		}
+	}
+	return problems
+}
+
+// HandleTextractAnalyze returns a handler that extracts text, form fields,
+// and tables from a document in S3.
+//
+//	@Summary		Analyze a document with Textract
+//	@Description	Extract the text, form key-value pairs, and tables of a document in S3. JPEG and PNG images are analyzed at once and answered with 200. PDFs and TIFFs are analyzed in a job and answered with 202; poll the job until it has succeeded, or subscribe to the documents topic of /api/v1/ws to be told when it is done.
+//	@Tags			aws
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		TextractAnalyzeRequest	true	"Document to analyze"
+//	@Success		200		{object}	documents.Document
+//	@Success		202		{object}	documents.Job
+//	@Header			202		{string}	Location	"URL of the job's status"
+//	@Failure		400		{object}	problem.Details	"Validation error or unreadable document"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		404		{object}	problem.Details	"Object not found"
+//	@Failure		429		{object}	problem.Details	"Too many jobs running"
+//	@Failure		500		{object}	problem.Details	"Failed to analyze document"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/textract/analyses [post]
+func HandleTextractAnalyze(logger *slog.Logger, extractor *documents.Extractor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[TextractAnalyzeRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode analyze request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		features := slices.Compact(slices.Sorted(slices.Values(req.Features)))
+		if len(features) == 0 {
+			features = []string{documents.FeatureForms, documents.FeatureTables}
+		}
+
+		// Valid has rejected documents Textract can't analyze
+		if async, _ := documents.Async(req.Key); !async {
+			doc, err := extractor.Analyze(r.Context(), req.Bucket, req.Key, features)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to analyze document", "error", err, "bucket", req.Bucket, "key", req.Key)
+				writeAWSError(w, r, err, "Failed to analyze document")
+				return
+			}
+			if err := encode(w, r, http.StatusOK, doc); err != nil {
+				logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		id, err := extractor.Start(r.Context(), req.Bucket, req.Key, features)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to start document analysis", "error", err, "bucket", req.Bucket, "key", req.Key)
+			writeAWSError(w, r, err, "Failed to start document analysis")
+			return
+		}
+		logger.InfoContext(r.Context(), "started document analysis", "job_id", id, "bucket", req.Bucket, "key", req.Key)
+
+		w.Header().Set("Location", "/api/v1/aws/textract/jobs/"+id)
+		resp := documents.Job{ID: id, Status: documents.StatusInProgress}
+		if err := encode(w, r, http.StatusAccepted, resp); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleTextractGetJob returns a handler that reports a document analysis
+// job's status and, once it has succeeded, what it extracted.
+//
+//	@Summary		Get a Textract job
+//	@Description	Get the status of a document analysis job, and once it has succeeded, the document's text, form key-value pairs, and tables
+//	@Tags			aws
+//	@Produce		json
+//	@Param			id	path		string	true	"Job ID"
+//	@Success		200	{object}	documents.Job
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		404	{object}	problem.Details	"Job not found"
+//	@Failure		500	{object}	problem.Details	"Failed to get job"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/textract/jobs/{id} [get]
+func HandleTextractGetJob(logger *slog.Logger, extractor *documents.Extractor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		job, err := extractor.Job(r.Context(), id)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get document analysis", "error", err, "job_id", id)
+			writeAWSError(w, r, err, "Failed to get job")
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, job); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
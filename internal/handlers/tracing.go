@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/tracing"
+)
+
+const (
+	// defaultOverrideDuration is how long forced tracing lasts when no duration is given.
+	defaultOverrideDuration = 1 * time.Hour
+	// maxOverrideDuration caps forced tracing so it isn't left on by accident.
+	maxOverrideDuration = 24 * time.Hour
+)
+
+// SetSamplingRateRequest represents a request to change the base sampling rate.
+type SetSamplingRateRequest struct {
+	Rate *float64 `json:"rate" example:"0.05"`
+}
+
+// Valid validates the set sampling rate request.
+func (r SetSamplingRateRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Rate == nil {
+		problems["rate"] = "rate is required"
+	} else if *r.Rate < 0 || *r.Rate > 1 {
+		problems["rate"] = "rate must be between 0 and 1"
+	}
+
+	return problems
+}
+
+// AddSamplingOverrideRequest represents a request to force tracing for a user or route.
+type AddSamplingOverrideRequest struct {
+	UserID   string `json:"userId,omitempty"`
+	Route    string `json:"route,omitempty" example:"GET /api/v1/aws/dynamodb/records"`
+	Reason   string `json:"reason,omitempty" example:"Investigating slow record listing"`
+	Duration string `json:"duration,omitempty" example:"30m"`
+}
+
+// Valid validates the add sampling override request.
+func (r AddSamplingOverrideRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if (r.UserID == "") == (r.Route == "") {
+		problems["userId"] = "exactly one of userId or route is required"
+	}
+	if len(r.Reason) > 200 {
+		problems["reason"] = "reason must be 200 characters or less"
+	}
+	if r.Duration != "" {
+		d, err := time.ParseDuration(r.Duration)
+		if err != nil || d <= 0 || d > maxOverrideDuration {
+			problems["duration"] = "duration must be a positive duration of at most 24h (e.g. 30m)"
+		}
+	}
+
+	return problems
+}
+
+// duration returns the requested override duration. It assumes Valid passed.
+func (r AddSamplingOverrideRequest) duration() time.Duration {
+	if r.Duration == "" {
+		return defaultOverrideDuration
+	}
+	d, _ := time.ParseDuration(r.Duration)
+	return d
+}
+
+// HandleGetSampling returns a handler that reports the tracing sampling configuration.
+//
+//	@Summary		Get tracing sampling
+//	@Description	Get the base trace sampling rate and the active forced-tracing overrides.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	tracing.SamplingConfig
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/tracing/sampling [get]
+func HandleGetSampling(logger *slog.Logger, sampler *tracing.Sampler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := encode(w, r, http.StatusOK, sampler.Config()); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleSetSamplingRate returns a handler that changes the base sampling rate.
+//
+//	@Summary		Set tracing sampling rate
+//	@Description	Change the fraction of requests traced when no override matches.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		SetSamplingRateRequest	true	"Sampling rate"
+//	@Success		200		{object}	tracing.SamplingConfig
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/tracing/sampling [put]
+func HandleSetSamplingRate(logger *slog.Logger, sampler *tracing.Sampler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[SetSamplingRateRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode sampling rate request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		sampler.SetRate(*req.Rate)
+
+		userID, _ := auth.GetUserID(r.Context())
+		logger.InfoContext(r.Context(), "tracing sampling rate changed", "rate", *req.Rate, "user_id", userID)
+
+		if err := encode(w, r, http.StatusOK, sampler.Config()); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleAddSamplingOverride returns a handler that forces tracing for a user or route.
+//
+//	@Summary		Force tracing for a user or route
+//	@Description	Trace every request from a user or to a route (a mux pattern such as "GET /api/v1/items") for a limited time, regardless of the sampling rate. Defaults to 1h; at most 24h.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		AddSamplingOverrideRequest	true	"Override"
+//	@Success		201		{object}	tracing.Override
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/tracing/sampling/overrides [post]
+func HandleAddSamplingOverride(logger *slog.Logger, sampler *tracing.Sampler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[AddSamplingOverrideRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode sampling override request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		override := sampler.AddOverride(tracing.Override{
+			UserID: req.UserID,
+			Route:  req.Route,
+			Reason: req.Reason,
+		}, req.duration())
+
+		userID, _ := auth.GetUserID(r.Context())
+		logger.InfoContext(r.Context(), "forced tracing enabled",
+			"override_id", override.ID,
+			"target_user_id", override.UserID,
+			"route", override.Route,
+			"expires_at", override.ExpiresAt,
+			"user_id", userID,
+		)
+
+		if err := encode(w, r, http.StatusCreated, override); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleRemoveSamplingOverride returns a handler that stops forced tracing.
+//
+//	@Summary		Remove forced tracing override
+//	@Description	Remove a forced-tracing override before it expires.
+//	@Tags			admin
+//	@Param			id	path	string	true	"Override ID"
+//	@Success		204
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		404	{object}	problem.Details	"Override not found"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/tracing/sampling/overrides/{id} [delete]
+func HandleRemoveSamplingOverride(logger *slog.Logger, sampler *tracing.Sampler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		if err := sampler.RemoveOverride(id); errors.Is(err, tracing.ErrOverrideNotFound) {
+			problem.Error(w, r, "Override not found", http.StatusNotFound)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "forced tracing removed", "override_id", id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// LambdaTriggerService defines the interface for managing the identity
+// provider's Lambda triggers.
+type LambdaTriggerService interface {
+	LambdaTriggers(ctx context.Context) (*auth.LambdaTriggers, error)
+	UpdateLambdaTriggers(ctx context.Context, triggers auth.LambdaTriggers) (*auth.LambdaTriggers, error)
+}
+
+// UpdateLambdaTriggersRequest represents a request to replace the Lambda
+// triggers. Omitted triggers are removed.
+type UpdateLambdaTriggersRequest struct {
+	PreSignUp          string `json:"pre_sign_up,omitempty" example:"arn:aws:lambda:us-east-1:123456789012:function:pre-sign-up"`
+	PreTokenGeneration string `json:"pre_token_generation,omitempty" example:"arn:aws:lambda:us-east-1:123456789012:function:pre-token-generation"`
+	// PreTokenGenerationVersion defaults to V1_0.
+	PreTokenGenerationVersion string `json:"pre_token_generation_version,omitempty" example:"V2_0" enums:"V1_0,V2_0,V3_0"`
+	CustomMessage             string `json:"custom_message,omitempty" example:"arn:aws:lambda:us-east-1:123456789012:function:custom-message"`
+}
+
+// Valid validates the update Lambda triggers request.
+func (r UpdateLambdaTriggersRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	for field, arn := range map[string]string{
+		"pre_sign_up":          r.PreSignUp,
+		"pre_token_generation": r.PreTokenGeneration,
+		"custom_message":       r.CustomMessage,
+	} {
+		if arn != "" && !isLambdaARN(arn) {
+			problems[field] = field + " must be a Lambda function ARN"
+		}
+	}
+	switch r.PreTokenGenerationVersion {
+	case "", "V1_0", "V2_0", "V3_0":
+	default:
+		problems["pre_token_generation_version"] = "pre_token_generation_version must be V1_0, V2_0, or V3_0"
+	}
+	if r.PreTokenGenerationVersion != "" && r.PreTokenGeneration == "" {
+		problems["pre_token_generation_version"] = "pre_token_generation_version requires pre_token_generation"
+	}
+
+	return problems
+}
+
+// isLambdaARN reports whether arn looks like a Lambda function ARN, e.g.
+// arn:aws:lambda:us-east-1:123456789012:function:name.
+func isLambdaARN(arn string) bool {
+	parts := strings.SplitN(arn, ":", 7)
+	return len(parts) == 7 && parts[0] == "arn" && parts[2] == "lambda" && parts[5] == "function" && parts[6] != ""
+}
+
+// HandleGetLambdaTriggers returns a handler that describes the Lambda
+// triggers.
+//
+//	@Summary		Get Lambda triggers
+//	@Description	Get the user pool's pre sign-up, pre token generation, and custom message Lambda triggers.
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	auth.LambdaTriggers
+//	@Failure		401	{object}	problem.Details	"Unauthorized"
+//	@Failure		403	{object}	problem.Details	"Forbidden"
+//	@Failure		501	{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/lambda-triggers [get]
+func HandleGetLambdaTriggers(logger *slog.Logger, triggers LambdaTriggerService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current, err := triggers.LambdaTriggers(r.Context())
+		if err != nil {
+			if errors.Is(err, auth.ErrNotSupported) {
+				encodeLambdaTriggersNotSupported(w, r)
+				return
+			}
+			logger.ErrorContext(r.Context(), "failed to get lambda triggers", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, current); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// HandleUpdateLambdaTriggers returns a handler that replaces the Lambda
+// triggers.
+//
+//	@Summary		Update Lambda triggers
+//	@Description	Replace the user pool's pre sign-up, pre token generation, and custom message Lambda triggers; omitted ones are removed. Other triggers and pool settings are kept. Cognito must be allowed to invoke the functions.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		UpdateLambdaTriggersRequest	true	"Lambda triggers"
+//	@Success		200		{object}	auth.LambdaTriggers
+//	@Failure		400		{object}	problem.Details	"Validation error or trigger rejected by Cognito"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Failure		501		{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/lambda-triggers [put]
+func HandleUpdateLambdaTriggers(logger *slog.Logger, triggers LambdaTriggerService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, problems, err := decodeValid[UpdateLambdaTriggersRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode update lambda triggers request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		updated, err := triggers.UpdateLambdaTriggers(r.Context(), auth.LambdaTriggers{
+			PreSignUp:                 req.PreSignUp,
+			PreTokenGeneration:        req.PreTokenGeneration,
+			PreTokenGenerationVersion: req.PreTokenGenerationVersion,
+			CustomMessage:             req.CustomMessage,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidLambdaTrigger):
+				problem.Error(w, r, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, auth.ErrNotSupported):
+				encodeLambdaTriggersNotSupported(w, r)
+			default:
+				logger.ErrorContext(r.Context(), "failed to update lambda triggers", "error", err)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if err := encode(w, r, http.StatusOK, updated); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// encodeLambdaTriggersNotSupported reports that the identity provider has
+// no Lambda triggers.
+func encodeLambdaTriggersNotSupported(w http.ResponseWriter, r *http.Request) {
+	problem.Error(w, r, "lambda triggers are not supported by the identity provider", http.StatusNotImplemented)
+}
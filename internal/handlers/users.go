@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// UserAdminService defines the interface for provisioning users.
+type UserAdminService interface {
+	PasswordPolicyService
+	CreateUser(ctx context.Context, user auth.NewUser) (*auth.AdminUser, error)
+}
+
+// CreateUserRequest represents a request to create a user.
+type CreateUserRequest struct {
+	Email string `json:"email" example:"user@example.com"`
+	Name  string `json:"name,omitempty" example:"Jane Doe"`
+	// TemporaryPassword is generated by the identity provider if omitted.
+	TemporaryPassword string `json:"temporary_password,omitempty" example:"Temp1234!"`
+	// Invitation is "suppress" to skip the invitation email, or "resend"
+	// to send a new temporary password to a user who hasn't logged in yet.
+	Invitation string `json:"invitation,omitempty" example:"suppress" enums:"suppress,resend"`
+}
+
+// Valid validates the create user request.
+func (r CreateUserRequest) Valid(ctx context.Context) map[string]string {
+	problems := make(map[string]string)
+
+	if r.Email == "" {
+		problems["email"] = "email is required"
+	}
+	if r.TemporaryPassword != "" {
+		if problem := passwordPolicy(ctx).Check(r.TemporaryPassword); problem != "" {
+			problems["temporary_password"] = problem
+		}
+	}
+	switch r.Invitation {
+	case auth.InvitationSend, auth.InvitationSuppress, auth.InvitationResend:
+	default:
+		problems["invitation"] = "invitation must be suppress or resend"
+	}
+	if r.Invitation == auth.InvitationSuppress && r.TemporaryPassword == "" {
+		problems["temporary_password"] = "temporary_password is required when the invitation is suppressed"
+	}
+
+	return problems
+}
+
+// HandleCreateUser returns a handler that creates a user with a temporary
+// password.
+//
+//	@Summary		Create user
+//	@Description	Provision a user with a temporary password, which must follow GET /api/v1/auth/password-policy, emailed to them unless the invitation is suppressed. Their first login returns a NEW_PASSWORD_REQUIRED challenge, completed with POST /api/v1/auth/new-password. With invitation "resend", an existing user who hasn't logged in yet is sent a new temporary password.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		CreateUserRequest	true	"User"
+//	@Success		201		{object}	auth.AdminUser
+//	@Failure		400		{object}	problem.Details	"Validation error"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Forbidden"
+//	@Failure		404		{object}	problem.Details	"User to resend to not found"
+//	@Failure		409		{object}	problem.Details	"User already exists"
+//	@Failure		501		{object}	problem.Details	"Not supported by the identity provider"
+//	@Security		BearerAuth
+//	@Router			/api/v1/admin/users [post]
+func HandleCreateUser(logger *slog.Logger, userService UserAdminService) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withPasswordPolicy(r, userService, logger)
+		req, problems, err := decodeValid[CreateUserRequest](r)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode create user request", "error", err)
+			if len(problems) > 0 {
+				problem.Validation(w, r, problems)
+				return
+			}
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		user, err := userService.CreateUser(r.Context(), auth.NewUser{
+			Email:             req.Email,
+			Name:              req.Name,
+			TemporaryPassword: req.TemporaryPassword,
+			Invitation:        req.Invitation,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrUserAlreadyExists):
+				problem.Error(w, r, "user already exists", http.StatusConflict)
+			case errors.Is(err, auth.ErrUserNotFound):
+				problem.Error(w, r, "user not found", http.StatusNotFound)
+			case errors.Is(err, auth.ErrInvalidPassword):
+				problem.Error(w, r, "temporary password does not meet the password policy", http.StatusBadRequest)
+			case errors.Is(err, auth.ErrNotSupported):
+				problem.Error(w, r, "creating users is not supported by the identity provider", http.StatusNotImplemented)
+			default:
+				logger.ErrorContext(r.Context(), "create user failed", "error", err)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		userID, _ := auth.GetUserID(r.Context())
+		logger.InfoContext(r.Context(), "user created by admin", "email", user.Email, "user_id", userID)
+
+		if err := encode(w, r, http.StatusCreated, user); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// WebhookResponse acknowledges a webhook delivery.
+type WebhookResponse struct {
+	Status string `json:"status" example:"accepted"`
+}
+
+// webhookEventHeaders are headers senders name the event type in.
+var webhookEventHeaders = []string{"X-GitHub-Event", "X-Event-Type", "X-Amz-Sns-Message-Type"}
+
+// HandleWebhook returns a handler that accepts verified webhook deliveries
+// and logs them.
+//
+//	@Summary		Receive webhook
+//	@Description	Accept a delivery to a configured webhook. Deliveries must carry an HMAC-SHA256 signature, "sha256=<hex>", in the webhook's signature header: by default X-Signature-256, over "<timestamp>.<body>" with the Unix time in X-Signature-Timestamp, within 5 minutes of now and accepted once; with a custom header, such as GitHub's X-Hub-Signature-256, over the body.
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string	true	"Webhook name"
+//	@Success		202		{object}	WebhookResponse
+//	@Failure		401		{object}	problem.Details	"Invalid, expired or replayed signature"
+//	@Failure		404		{object}	problem.Details	"Unknown webhook"
+//	@Failure		503		{object}	problem.Details	"Webhooks are not configured"
+//	@Router			/api/v1/webhooks/{name} [post]
+func HandleWebhook(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, err := io.Copy(io.Discard, r.Body)
+		if err != nil {
+			problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		attrs := []any{"webhook", r.PathValue("name"), "bytes", size}
+		for _, header := range webhookEventHeaders {
+			if event := r.Header.Get(header); event != "" {
+				attrs = append(attrs, "event", event)
+				break
+			}
+		}
+		logger.InfoContext(r.Context(), "webhook received", attrs...)
+
+		if err := encode(w, r, http.StatusAccepted, WebhookResponse{Status: "accepted"}); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/preflight"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// AWSIdentity is the identity the server calls AWS as, and whether it can
+// use the resources the server is configured with.
+type AWSIdentity struct {
+	Account string `json:"account" example:"123456789012"`
+	ARN     string `json:"arn" example:"arn:aws:sts::123456789012:assumed-role/go-aws-server/i-0abc123def456"`
+	UserID  string `json:"userId" example:"AROAEXAMPLEID:i-0abc123def456"`
+	Region  string `json:"region" example:"us-east-1"`
+	// Role is the configured role the request's X-AWS-Role header named,
+	// if any.
+	Role string `json:"role,omitempty" example:""`
+	// Probes are the startup preflight checks, run again now.
+	Probes []preflight.Result `json:"probes,omitempty"`
+}
+
+// HandleAWSWhoAmI returns a handler that reports the AWS identity the
+// server runs as, and probes the permissions it needs.
+//
+//	@Summary		AWS caller identity
+//	@Description	Get the account, ARN, and user ID the server calls AWS as, from STS GetCallerIdentity, and check again that it can use the resources it's configured with. Probes report ok, missing, denied, or failed, with what to fix. Send X-AWS-Role to check a configured role instead.
+//	@Tags			aws
+//	@Produce		json
+//	@Param			probes	query		bool			false	"Run the permission probes (default true)"
+//	@Success		200		{object}	AWSIdentity
+//	@Failure		400		{object}	problem.Details	"Invalid probes"
+//	@Failure		401		{object}	problem.Details	"Unauthorized"
+//	@Failure		403		{object}	problem.Details	"Missing aws:read"
+//	@Failure		500		{object}	problem.Details	"Failed to get caller identity"
+//	@Security		BearerAuth
+//	@Router			/api/v1/aws/whoami [get]
+func HandleAWSWhoAmI(logger *slog.Logger, cfg *config.Config, clients *awsclients.Clients) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes := true
+		if value := r.URL.Query().Get("probes"); value != "" {
+			var err error
+			if probes, err = strconv.ParseBool(value); err != nil {
+				problem.Error(w, r, "probes must be true or false", http.StatusBadRequest)
+				return
+			}
+		}
+
+		result, err := clients.STS.GetCallerIdentity(r.Context(), &sts.GetCallerIdentityInput{})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get AWS caller identity", "error", err)
+			writeAWSError(w, r, err, "Failed to get caller identity; check the AWS credentials the server runs with")
+			return
+		}
+
+		identity := AWSIdentity{
+			Account: aws.ToString(result.Account),
+			ARN:     aws.ToString(result.Arn),
+			UserID:  aws.ToString(result.UserId),
+			Region:  clients.Config.Region,
+			Role:    awsclients.RoleFromContext(r.Context()),
+		}
+		if probes {
+			identity.Probes = preflight.Probe(r.Context(), logger, cfg, clients)
+		}
+
+		if err := encode(w, r, http.StatusOK, identity); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+		}
+	})
+}
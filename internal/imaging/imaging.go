@@ -0,0 +1,281 @@
+// Package imaging analyzes images stored in S3 with Rekognition, detecting
+// what they show and whether they need moderation, and keeps the results
+// next to the object: as object tags, or as items in a DynamoDB table.
+//
+// Uploads are analyzed in the background, after the upload has been
+// answered, so a slow or failing analysis never fails an upload.
+package imaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	rekognitiontypes "github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// Object tags results are stored in.
+const (
+	TagLabels     = "rekognition-labels"
+	TagModeration = "rekognition-moderation"
+)
+
+// maxTags is the most tags S3 allows on an object.
+const maxTags = 10
+
+// maxTagValue is the longest value S3 allows for a tag.
+const maxTagValue = 256
+
+// analyzeTimeout bounds the analysis of an upload.
+const analyzeTimeout = time.Minute
+
+// ErrNotImage is returned for objects Rekognition can't analyze.
+var ErrNotImage = errors.New("only JPEG and PNG images can be analyzed")
+
+// Label is something detected in an image.
+type Label struct {
+	Name string `json:"name" dynamodbav:"name" example:"Dog"`
+	// Parent is the broader category of moderation labels.
+	Parent     string  `json:"parent,omitempty" dynamodbav:"parent,omitempty" example:""`
+	Confidence float64 `json:"confidence" dynamodbav:"confidence" example:"98.2"`
+}
+
+// Result is the analysis of an image.
+type Result struct {
+	ID     string  `json:"-" dynamodbav:"id"`
+	Bucket string  `json:"bucket" dynamodbav:"bucket" example:"uploads"`
+	Key    string  `json:"key" dynamodbav:"key" example:"photos/dog.jpg"`
+	Labels []Label `json:"labels" dynamodbav:"labels"`
+	// Moderation lists unsafe content found, such as violence; empty if
+	// none was.
+	Moderation []Label   `json:"moderation" dynamodbav:"moderation"`
+	AnalyzedAt time.Time `json:"analyzedAt" dynamodbav:"analyzed_at"`
+}
+
+// Analyzer runs Rekognition on images in S3.
+type Analyzer struct {
+	rekognition *rekognition.Client
+	s3          *s3.Client
+	dynamoDB    *dynamodb.Client
+	cfg         config.ImagesConfig
+	logger      *slog.Logger
+
+	// slots bounds the uploads analyzed at once.
+	slots   chan struct{}
+	running sync.WaitGroup
+}
+
+// New creates an analyzer.
+func New(rekognitionClient *rekognition.Client, s3Client *s3.Client, dynamoDBClient *dynamodb.Client, cfg config.ImagesConfig, logger *slog.Logger) *Analyzer {
+	return &Analyzer{
+		rekognition: rekognitionClient,
+		s3:          s3Client,
+		dynamoDB:    dynamoDBClient,
+		cfg:         cfg,
+		logger:      logger,
+		slots:       make(chan struct{}, max(cfg.Concurrency, 1)),
+	}
+}
+
+// IsImage reports whether key names an image Rekognition can analyze.
+func IsImage(key string) bool {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// Analyze detects the labels and moderation labels of the image at key in
+// bucket.
+func (a *Analyzer) Analyze(ctx context.Context, bucket, key string) (Result, error) {
+	if !IsImage(key) {
+		return Result{}, ErrNotImage
+	}
+	image := &rekognitiontypes.Image{S3Object: &rekognitiontypes.S3Object{
+		Bucket: aws.String(bucket),
+		Name:   aws.String(key),
+	}}
+	minConfidence := aws.Float32(float32(a.cfg.MinConfidence))
+
+	labels, err := a.rekognition.DetectLabels(ctx, &rekognition.DetectLabelsInput{
+		Image:         image,
+		MaxLabels:     aws.Int32(int32(a.cfg.MaxLabels)),
+		MinConfidence: minConfidence,
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("detect labels: %w", err)
+	}
+	moderation, err := a.rekognition.DetectModerationLabels(ctx, &rekognition.DetectModerationLabelsInput{
+		Image:         image,
+		MinConfidence: minConfidence,
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("detect moderation labels: %w", err)
+	}
+
+	result := Result{
+		ID:         "s3://" + bucket + "/" + key,
+		Bucket:     bucket,
+		Key:        key,
+		Labels:     make([]Label, 0, len(labels.Labels)),
+		Moderation: make([]Label, 0, len(moderation.ModerationLabels)),
+		AnalyzedAt: time.Now().UTC(),
+	}
+	for _, l := range labels.Labels {
+		result.Labels = append(result.Labels, Label{
+			Name:       aws.ToString(l.Name),
+			Confidence: float64(aws.ToFloat32(l.Confidence)),
+		})
+	}
+	for _, l := range moderation.ModerationLabels {
+		result.Moderation = append(result.Moderation, Label{
+			Name:       aws.ToString(l.Name),
+			Parent:     aws.ToString(l.ParentName),
+			Confidence: float64(aws.ToFloat32(l.Confidence)),
+		})
+	}
+	return result, nil
+}
+
+// Store keeps result where the configuration says: as tags on the object,
+// replacing earlier results but keeping its other tags, or as an item in
+// the results table.
+func (a *Analyzer) Store(ctx context.Context, result Result) error {
+	if a.cfg.Store == config.ImageResultsDynamoDB {
+		item, err := attributevalue.MarshalMap(result)
+		if err != nil {
+			return fmt.Errorf("marshal result: %w", err)
+		}
+		_, err = a.dynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(a.cfg.Table),
+			Item:      item,
+		})
+		if err != nil {
+			return fmt.Errorf("put result: %w", err)
+		}
+		return nil
+	}
+
+	current, err := a.s3.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(result.Bucket),
+		Key:    aws.String(result.Key),
+	})
+	if err != nil {
+		return fmt.Errorf("get object tags: %w", err)
+	}
+	var tags []s3types.Tag
+	for _, tag := range current.TagSet {
+		switch aws.ToString(tag.Key) {
+		case TagLabels, TagModeration:
+		default:
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags)+2 > maxTags {
+		return fmt.Errorf("object already has %d tags, leaving no room for results", len(tags))
+	}
+	tags = append(tags,
+		s3types.Tag{Key: aws.String(TagLabels), Value: aws.String(tagValue(result.Labels))},
+		s3types.Tag{Key: aws.String(TagModeration), Value: aws.String(tagValue(result.Moderation))},
+	)
+
+	_, err = a.s3.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(result.Bucket),
+		Key:     aws.String(result.Key),
+		Tagging: &s3types.Tagging{TagSet: tags},
+	})
+	if err != nil {
+		return fmt.Errorf("put object tags: %w", err)
+	}
+	return nil
+}
+
+// tagValue joins labels' names with slashes, most confident first, as much
+// as fits in a tag value. Characters S3 doesn't allow in tags are dropped.
+func tagValue(labels []Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		name := strings.Map(func(r rune) rune {
+			if r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(" +-=._:@", r)) {
+				return r
+			}
+			return -1
+		}, l.Name)
+		if name == "" {
+			continue
+		}
+		entry := name + ":" + strconv.Itoa(int(l.Confidence))
+		if b.Len() > 0 {
+			entry = "/" + entry
+		}
+		if b.Len()+len(entry) > maxTagValue {
+			break
+		}
+		b.WriteString(entry)
+	}
+	return b.String()
+}
+
+// AnalyzeUpload analyzes and stores the results for an object just
+// uploaded, in the background, if uploads are to be analyzed and key is an
+// image. Values of ctx, such as the role the upload was made as, carry
+// over; its cancellation doesn't. It does nothing on a nil Analyzer.
+func (a *Analyzer) AnalyzeUpload(ctx context.Context, bucket, key string) {
+	if a == nil || !a.cfg.AnalyzeUploads || !IsImage(key) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	a.running.Add(1)
+	go func() {
+		defer a.running.Done()
+		a.slots <- struct{}{}
+		defer func() { <-a.slots }()
+
+		ctx, cancel := context.WithTimeout(ctx, analyzeTimeout)
+		defer cancel()
+		result, err := a.Analyze(ctx, bucket, key)
+		if err == nil {
+			err = a.Store(ctx, result)
+		}
+		if err != nil {
+			a.logger.ErrorContext(ctx, "failed to analyze uploaded image", "error", err, "bucket", bucket, "key", key)
+			return
+		}
+		a.logger.InfoContext(ctx, "analyzed uploaded image", "bucket", bucket, "key", key,
+			"labels", len(result.Labels), "moderation_labels", len(result.Moderation))
+	}()
+}
+
+// Drain waits for the uploads being analyzed, or for ctx to be done. It
+// does nothing on a nil Analyzer.
+func (a *Analyzer) Drain(ctx context.Context) {
+	if a == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		a.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		a.logger.Warn("image analyses still running at shutdown are abandoned")
+	}
+}
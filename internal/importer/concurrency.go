@@ -0,0 +1,68 @@
+package importer
+
+import "sync"
+
+// tuner limits how many batches a job writes at once and adapts the limit to
+// the table's throughput: it adds a worker after a full round of batches
+// goes through cleanly and halves the workers whenever DynamoDB throttles a
+// batch or a write fails (additive increase, multiplicative decrease).
+type tuner struct {
+	min, max int
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	limit     int // Current number of batches allowed in flight
+	inFlight  int
+	successes int // Clean batches since the limit last changed
+}
+
+// newTuner allows between lo and hi batches in flight, starting at lo.
+func newTuner(lo, hi int) *tuner {
+	lo = max(lo, 1)
+	hi = max(hi, lo)
+	t := &tuner{min: lo, max: hi, limit: lo}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire blocks until a batch may start.
+func (t *tuner) acquire() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.inFlight >= t.limit {
+		t.cond.Wait()
+	}
+	t.inFlight++
+}
+
+// release ends a batch and adjusts the limit based on whether it was throttled.
+func (t *tuner) release(throttled bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.inFlight--
+	if throttled {
+		t.limit = max(t.min, t.limit/2)
+		t.successes = 0
+	} else if t.successes++; t.successes >= t.limit && t.limit < t.max {
+		t.limit++
+		t.successes = 0
+	}
+	t.cond.Broadcast()
+}
+
+// wait blocks until no batches are in flight.
+func (t *tuner) wait() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.inFlight > 0 {
+		t.cond.Wait()
+	}
+}
+
+// current returns the number of batches allowed in flight.
+func (t *tuner) current() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
@@ -0,0 +1,660 @@
+// Package importer loads CSV files into DynamoDB tables as background jobs.
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"github.com/pmollerus23/go-aws-server/internal/awscalls"
+	"github.com/pmollerus23/go-aws-server/internal/store"
+)
+
+const (
+	// batchSize is the maximum number of items in a BatchWriteItem call.
+	batchSize = 25
+	// batchAttempts is how many times unprocessed items are retried before they are rejected.
+	batchAttempts = 5
+	// batchRetryDelay is the base delay between retries of unprocessed items.
+	batchRetryDelay = 100 * time.Millisecond
+	// jobRetention is how long finished jobs are kept for status and error reports.
+	jobRetention = 24 * time.Hour
+)
+
+var (
+	ErrJobNotFound  = errors.New("import job not found")
+	ErrInvalidInput = errors.New("invalid import")
+	// ErrShutdown fails jobs still running when the importer is drained.
+	ErrShutdown = errors.New("server shut down before the import finished")
+)
+
+// Attribute types supported in a column mapping.
+const (
+	TypeString = "S"
+	TypeNumber = "N"
+	TypeBool   = "BOOL"
+)
+
+// Column describes how a CSV column is stored.
+type Column struct {
+	// Attribute is the DynamoDB attribute name. Defaults to the column header.
+	Attribute string `json:"attribute,omitempty"`
+	// Type is S, N, or BOOL. Defaults to S.
+	Type string `json:"type,omitempty" enums:"S,N,BOOL"`
+}
+
+// Mapping maps CSV column headers to attributes. Without a mapping every column
+// is imported as a string attribute named after its header; with one, only the
+// listed columns are imported.
+type Mapping struct {
+	Columns map[string]Column `json:"columns"`
+}
+
+// Status values of an import job.
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Rejection records a row that could not be imported.
+type Rejection struct {
+	Row    int      // 1-based record number in the CSV, counting the header
+	Reason string   // Why the row was rejected
+	Values []string // The original row
+}
+
+// Progress is a point-in-time view of an import job.
+type Progress struct {
+	ID        string `json:"id"`
+	Table     string `json:"table"`
+	Status    string `json:"status" enums:"running,completed,failed"`
+	TotalRows int    `json:"totalRows"`
+	Processed int    `json:"processed"`
+	Written   int    `json:"written"`
+	Rejected  int    `json:"rejected"`
+	// Concurrency is how many batches the job is writing in parallel. It
+	// grows while the table keeps up and shrinks when writes are throttled.
+	Concurrency int        `json:"concurrency"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"startedAt"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Job is a running or finished import.
+type Job struct {
+	tuner *tuner
+
+	mu         sync.Mutex
+	progress   Progress
+	header     []string
+	rejections []Rejection
+	// version counts the changes to progress, and changed is closed at the
+	// next one.
+	version uint64
+	changed chan struct{}
+}
+
+// Progress returns the job's current progress.
+func (j *Job) Progress() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	progress := j.progress
+	if progress.Status == StatusRunning {
+		progress.Concurrency = j.tuner.current()
+	}
+	return progress
+}
+
+// Watch returns the job's current progress, its version, which starts at 1
+// and increases with every change, and a channel that is closed at the next
+// change.
+func (j *Job) Watch() (Progress, uint64, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	progress := j.progress
+	if progress.Status == StatusRunning {
+		progress.Concurrency = j.tuner.current()
+	}
+	return progress, j.version, j.changed
+}
+
+// changedLocked records a change to the job's progress. j.mu must be held.
+func (j *Job) changedLocked() {
+	j.version++
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// Rejections returns the CSV header and every rejected row so far.
+func (j *Job) Rejections() ([]string, []Rejection) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.header, append([]Rejection(nil), j.rejections...)
+}
+
+func (j *Job) reject(rows []row, reason string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, r := range rows {
+		j.rejections = append(j.rejections, Rejection{Row: r.line, Reason: reason, Values: r.values})
+	}
+	j.progress.Rejected += len(rows)
+	j.progress.Processed += len(rows)
+	j.changedLocked()
+}
+
+func (j *Job) written(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.progress.Written += n
+	j.progress.Processed += n
+	j.changedLocked()
+}
+
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.progress.FinishedAt = &now
+	j.progress.Status = StatusCompleted
+	if err != nil {
+		j.progress.Status = StatusFailed
+		j.progress.Error = err.Error()
+	}
+	j.changedLocked()
+}
+
+// row is a parsed CSV row ready to write.
+type row struct {
+	line   int
+	values []string
+	item   map[string]types.AttributeValue
+	key    string
+}
+
+// Importer runs CSV imports and keeps their results in memory.
+type Importer struct {
+	client     *dynamodb.Client
+	logger     *slog.Logger
+	minWorkers int
+	maxWorkers int
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+
+	// running counts the jobs being written, and stop cancels them.
+	running sync.WaitGroup
+	stopped context.Context
+	stop    context.CancelCauseFunc
+}
+
+// New creates an Importer whose jobs each write between minWorkers and
+// maxWorkers batches in parallel, adapting to the table's throughput.
+func New(client *dynamodb.Client, logger *slog.Logger, minWorkers, maxWorkers int) *Importer {
+	stopped, stop := context.WithCancelCause(context.Background())
+	return &Importer{
+		client:     client,
+		logger:     logger,
+		minWorkers: minWorkers,
+		maxWorkers: maxWorkers,
+		jobs:       make(map[string]*Job),
+		stopped:    stopped,
+		stop:       stop,
+	}
+}
+
+// Drain waits for running jobs to finish. Jobs still running when ctx is
+// done are cancelled and fail with ErrShutdown.
+func (im *Importer) Drain(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		im.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	for _, progress := range im.Jobs() {
+		if progress.Status == StatusRunning {
+			im.logger.Warn("cancelling CSV import at shutdown",
+				"job_id", progress.ID,
+				"table", progress.Table,
+				"processed", progress.Processed,
+				"total_rows", progress.TotalRows,
+			)
+		}
+	}
+	im.stop(ErrShutdown)
+	<-done
+}
+
+// Job returns the import job with the given ID or ErrJobNotFound.
+func (im *Importer) Job(id string) (*Job, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	job, ok := im.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// Jobs returns the progress of every retained job, newest first.
+func (im *Importer) Jobs() []Progress {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	jobs := make([]Progress, 0, len(im.jobs))
+	for _, job := range im.jobs {
+		jobs = append(jobs, job.Progress())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.After(jobs[j].StartedAt)
+	})
+	return jobs
+}
+
+// Concurrency returns how many batches the running jobs may write in
+// parallel, summed over the jobs.
+func (im *Importer) Concurrency() int {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	total := 0
+	for _, job := range im.jobs {
+		if progress := job.Progress(); progress.Status == StatusRunning {
+			total += progress.Concurrency
+		}
+	}
+	return total
+}
+
+// Start parses the CSV and begins writing it to the table in the background.
+// Errors in the file as a whole (no header, unknown mapped columns, missing key
+// columns) are returned immediately and wrap ErrInvalidInput; errors in
+// individual rows are recorded as rejections on the job.
+func (im *Importer) Start(ctx context.Context, tableName string, r io.Reader, mapping *Mapping) (*Job, error) {
+	keyNames, err := im.keySchema(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // rejected per row instead of failing the file
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading header: %v", ErrInvalidInput, err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	columns, err := resolveColumns(header, mapping, keyNames)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		tuner:   newTuner(im.minWorkers, im.maxWorkers),
+		header:  header,
+		version: 1,
+		changed: make(chan struct{}),
+		progress: Progress{
+			ID:        store.NewULID(),
+			Table:     tableName,
+			Status:    StatusRunning,
+			StartedAt: time.Now(),
+		},
+	}
+
+	// Parse the whole file up front so the total is known and malformed rows
+	// are rejected before anything is written.
+	var rows []row
+	for line := 2; ; line++ {
+		values, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				job.reject([]row{{line: line, values: values}}, parseErr.Err.Error())
+				continue
+			}
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+
+		parsed, err := parseRow(header, values, columns, keyNames)
+		if err != nil {
+			job.reject([]row{{line: line, values: values}}, err.Error())
+			continue
+		}
+		parsed.line = line
+		rows = append(rows, parsed)
+	}
+	job.progress.TotalRows = len(rows) + job.progress.Rejected
+
+	im.mu.Lock()
+	im.pruneLocked()
+	im.jobs[job.progress.ID] = job
+	im.mu.Unlock()
+
+	// The job outlives the request that started it, and its calls don't
+	// count against the request's AWS call budget. It is only cancelled if
+	// it is still running when the importer is drained.
+	jobCtx, cancel := context.WithCancelCause(awscalls.Detach(context.WithoutCancel(ctx)))
+	stopJob := context.AfterFunc(im.stopped, func() { cancel(context.Cause(im.stopped)) })
+	im.running.Add(1)
+	go func() {
+		defer im.running.Done()
+		defer stopJob()
+		defer cancel(nil)
+		im.run(jobCtx, job, tableName, keyNames, rows)
+	}()
+
+	return job, nil
+}
+
+// run writes rows in batches and records the outcome on the job. Batches are
+// written in parallel, up to the job's current concurrency.
+func (im *Importer) run(ctx context.Context, job *Job, tableName string, keyNames []string, rows []row) {
+	im.logger.Info("CSV import started", "job_id", job.progress.ID, "table", tableName, "rows", len(rows))
+
+	var (
+		errMu    sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return firstErr != nil
+	}
+	dispatch := func(batch []row) {
+		job.tuner.acquire()
+		go func() {
+			throttled, err := im.writeBatch(ctx, job, tableName, keyNames, batch)
+			if err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+			job.tuner.release(throttled || err != nil)
+		}()
+	}
+
+	batch := make([]row, 0, batchSize)
+	dispatched := make(map[string]bool)
+	for _, r := range rows {
+		if failed() {
+			break
+		}
+
+		// DynamoDB rejects a batch that writes the same key twice, and writes
+		// to one key must land in CSV order, so a repeated key waits for every
+		// earlier write to finish.
+		if dispatched[r.key] {
+			if len(batch) > 0 {
+				dispatch(batch)
+				batch = make([]row, 0, batchSize)
+			}
+			job.tuner.wait()
+			clear(dispatched)
+		}
+		if len(batch) == batchSize {
+			dispatch(batch)
+			batch = make([]row, 0, batchSize)
+		}
+		batch = append(batch, r)
+		dispatched[r.key] = true
+	}
+	if len(batch) > 0 && !failed() {
+		dispatch(batch)
+	}
+	job.tuner.wait()
+
+	if firstErr != nil {
+		if cause := context.Cause(ctx); cause != nil {
+			firstErr = cause
+		}
+		im.fail(job, firstErr)
+		return
+	}
+
+	job.finish(nil)
+	progress := job.Progress()
+	im.logger.Info("CSV import completed",
+		"job_id", progress.ID,
+		"table", tableName,
+		"written", progress.Written,
+		"rejected", progress.Rejected,
+	)
+}
+
+func (im *Importer) fail(job *Job, err error) {
+	job.finish(err)
+	im.logger.Error("CSV import failed", "job_id", job.Progress().ID, "error", err)
+}
+
+// writeBatch writes a batch, retrying unprocessed items. Rows that fail
+// validation or are still unprocessed after retries are rejected; other errors
+// abort the job. It reports whether DynamoDB left items unprocessed, which
+// means the table is throttling writes.
+func (im *Importer) writeBatch(ctx context.Context, job *Job, tableName string, keyNames []string, rows []row) (bool, error) {
+	pending := make(map[string]row, len(rows))
+	requests := make([]types.WriteRequest, 0, len(rows))
+	for _, r := range rows {
+		pending[r.key] = r
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: r.item}})
+	}
+
+	throttled := false
+	for attempt := 0; attempt < batchAttempts && len(requests) > 0; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return throttled, ctx.Err()
+			case <-time.After(batchRetryDelay << (attempt - 1)):
+			}
+		}
+
+		result, err := im.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{tableName: requests},
+		})
+		if err != nil {
+			// A validation error fails the whole batch, e.g. an attribute of
+			// the wrong type for the key schema.
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) && apiErr.ErrorCode() == "ValidationException" {
+				job.reject(rows, apiErr.ErrorMessage())
+				return throttled, nil
+			}
+			return throttled, fmt.Errorf("batch write to %s: %w", tableName, err)
+		}
+
+		requests = result.UnprocessedItems[tableName]
+		if len(requests) > 0 {
+			throttled = true
+		}
+	}
+
+	unprocessed := make(map[string]bool, len(requests))
+	for _, req := range requests {
+		unprocessed[itemKey(req.PutRequest.Item, keyNames)] = true
+	}
+
+	var written int
+	var rejected []row
+	for _, r := range rows {
+		if unprocessed[r.key] {
+			rejected = append(rejected, r)
+			continue
+		}
+		written++
+	}
+	job.written(written)
+	if len(rejected) > 0 {
+		job.reject(rejected, "not processed after retries (throughput exceeded)")
+	}
+	return throttled, nil
+}
+
+// pruneLocked drops finished jobs past their retention. im.mu must be held.
+func (im *Importer) pruneLocked() {
+	for id, job := range im.jobs {
+		progress := job.Progress()
+		if progress.FinishedAt != nil && time.Since(*progress.FinishedAt) > jobRetention {
+			delete(im.jobs, id)
+		}
+	}
+}
+
+// keySchema returns the names of the table's key attributes.
+func (im *Importer) keySchema(ctx context.Context, tableName string) ([]string, error) {
+	result, err := im.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe table %s: %w", tableName, err)
+	}
+
+	names := make([]string, 0, len(result.Table.KeySchema))
+	for _, key := range result.Table.KeySchema {
+		names = append(names, aws.ToString(key.AttributeName))
+	}
+	return names, nil
+}
+
+// resolveColumns returns the mapping to apply to each header position, with
+// nil for ignored columns.
+func resolveColumns(header []string, mapping *Mapping, keyNames []string) ([]*Column, error) {
+	columns := make([]*Column, len(header))
+	seen := make(map[string]bool, len(header))
+
+	for i, name := range header {
+		if name == "" {
+			return nil, fmt.Errorf("%w: column %d has an empty header", ErrInvalidInput, i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidInput, name)
+		}
+		seen[name] = true
+
+		column := Column{Attribute: name, Type: TypeString}
+		if mapping != nil {
+			mapped, ok := mapping.Columns[name]
+			if !ok {
+				continue
+			}
+			if mapped.Attribute != "" {
+				column.Attribute = mapped.Attribute
+			}
+			if mapped.Type != "" {
+				column.Type = mapped.Type
+			}
+		}
+
+		switch column.Type {
+		case TypeString, TypeNumber, TypeBool:
+		default:
+			return nil, fmt.Errorf("%w: column %q has unsupported type %q", ErrInvalidInput, name, column.Type)
+		}
+		columns[i] = &column
+	}
+
+	if mapping != nil {
+		for name := range mapping.Columns {
+			if !seen[name] {
+				return nil, fmt.Errorf("%w: mapped column %q is not in the file", ErrInvalidInput, name)
+			}
+		}
+	}
+
+	mapped := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		if column != nil {
+			mapped[column.Attribute] = true
+		}
+	}
+	for _, key := range keyNames {
+		if !mapped[key] {
+			return nil, fmt.Errorf("%w: no column maps to key attribute %q", ErrInvalidInput, key)
+		}
+	}
+
+	return columns, nil
+}
+
+// parseRow converts CSV values to a DynamoDB item. Empty cells are omitted.
+func parseRow(header, values []string, columns []*Column, keyNames []string) (row, error) {
+	if len(values) != len(header) {
+		return row{}, fmt.Errorf("expected %d columns, got %d", len(header), len(values))
+	}
+
+	item := make(map[string]types.AttributeValue, len(values))
+	for i, value := range values {
+		column := columns[i]
+		if column == nil || value == "" {
+			continue
+		}
+
+		switch column.Type {
+		case TypeNumber:
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return row{}, fmt.Errorf("column %q: %q is not a number", header[i], value)
+			}
+			item[column.Attribute] = &types.AttributeValueMemberN{Value: value}
+		case TypeBool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return row{}, fmt.Errorf("column %q: %q is not a boolean", header[i], value)
+			}
+			item[column.Attribute] = &types.AttributeValueMemberBOOL{Value: b}
+		default:
+			item[column.Attribute] = &types.AttributeValueMemberS{Value: value}
+		}
+	}
+
+	for _, key := range keyNames {
+		if _, ok := item[key]; !ok {
+			return row{}, fmt.Errorf("missing key attribute %q", key)
+		}
+	}
+
+	return row{values: values, item: item, key: itemKey(item, keyNames)}, nil
+}
+
+// itemKey returns a string identifying the item's primary key.
+func itemKey(item map[string]types.AttributeValue, keyNames []string) string {
+	var b strings.Builder
+	for _, name := range keyNames {
+		switch v := item[name].(type) {
+		case *types.AttributeValueMemberS:
+			b.WriteString("S:" + v.Value)
+		case *types.AttributeValueMemberN:
+			b.WriteString("N:" + v.Value)
+		case *types.AttributeValueMemberBOOL:
+			b.WriteString("BOOL:" + strconv.FormatBool(v.Value))
+		}
+		b.WriteByte(0)
+	}
+	return b.String()
+}
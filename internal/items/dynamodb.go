@@ -0,0 +1,190 @@
+package items
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// counterID is the reserved id of the row holding the next item ID in a
+// DynamoDBStore's table. Real item IDs start at 1.
+const counterID = 0
+
+// DynamoDBStore keeps items in a DynamoDB table whose partition key is id,
+// a number. Item IDs come from a counter kept in the same table, so every
+// instance of the server can share it.
+type DynamoDBStore struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoDBStore creates a store on table.
+func NewDynamoDBStore(client *dynamodb.Client, table string) *DynamoDBStore {
+	return &DynamoDBStore{client: client, table: table}
+}
+
+// List returns every item, oldest first.
+func (s *DynamoDBStore) List(ctx context.Context) ([]Item, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:        aws.String(s.table),
+		FilterExpression: aws.String("id <> :counter"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":counter": &types.AttributeValueMemberN{Value: strconv.Itoa(counterID)},
+		},
+	})
+
+	list := make([]Item, 0)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", s.table, err)
+		}
+
+		var pageItems []Item
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageItems); err != nil {
+			return nil, fmt.Errorf("unmarshal items: %w", err)
+		}
+		list = append(list, pageItems...)
+	}
+
+	slices.SortFunc(list, func(a, b Item) int { return cmp.Compare(a.ID, b.ID) })
+	return list, nil
+}
+
+// Get returns the item with the given ID or ErrNotFound.
+func (s *DynamoDBStore) Get(ctx context.Context, id int64) (Item, error) {
+	if id == counterID {
+		return Item{}, ErrNotFound
+	}
+
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            s.key(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Item{}, fmt.Errorf("get item %d: %w", id, err)
+	}
+	if result.Item == nil {
+		return Item{}, ErrNotFound
+	}
+
+	var item Item
+	if err := attributevalue.UnmarshalMap(result.Item, &item); err != nil {
+		return Item{}, fmt.Errorf("unmarshal item %d: %w", id, err)
+	}
+	return item, nil
+}
+
+// Create stores a new item with the next ID from the counter.
+func (s *DynamoDBStore) Create(ctx context.Context, name, description string) (Item, error) {
+	id, err := s.allocateID(ctx)
+	if err != nil {
+		return Item{}, err
+	}
+
+	item := Item{ID: id, Name: name, Description: description}
+	if err := s.put(ctx, item, "attribute_not_exists(id)"); err != nil {
+		if errors.Is(err, errConditionFailed) {
+			return Item{}, ErrConflict
+		}
+		return Item{}, fmt.Errorf("create item: %w", err)
+	}
+	return item, nil
+}
+
+// Update replaces an existing item's fields or returns ErrNotFound.
+func (s *DynamoDBStore) Update(ctx context.Context, item Item) (Item, error) {
+	if item.ID == counterID {
+		return Item{}, ErrNotFound
+	}
+
+	if err := s.put(ctx, item, "attribute_exists(id)"); err != nil {
+		if errors.Is(err, errConditionFailed) {
+			return Item{}, ErrNotFound
+		}
+		return Item{}, fmt.Errorf("update item %d: %w", item.ID, err)
+	}
+	return item, nil
+}
+
+// Delete removes an item or returns ErrNotFound.
+func (s *DynamoDBStore) Delete(ctx context.Context, id int64) error {
+	if id == counterID {
+		return ErrNotFound
+	}
+
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(s.table),
+		Key:                 s.key(id),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("delete item %d: %w", id, err)
+	}
+	return nil
+}
+
+// errConditionFailed is returned by put when its condition doesn't hold.
+var errConditionFailed = errors.New("condition failed")
+
+// put writes item if condition holds.
+func (s *DynamoDBStore) put(ctx context.Context, item Item, condition string) error {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return fmt.Errorf("marshal item: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.table),
+		Item:                av,
+		ConditionExpression: aws.String(condition),
+	})
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return errConditionFailed
+	}
+	return err
+}
+
+// allocateID atomically increments the ID counter.
+func (s *DynamoDBStore) allocateID(ctx context.Context) (int64, error) {
+	result, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.table),
+		Key:              s.key(counterID),
+		UpdateExpression: aws.String("ADD next_id :one"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("allocate item ID: %w", err)
+	}
+
+	var counter struct {
+		NextID int64 `dynamodbav:"next_id"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Attributes, &counter); err != nil {
+		return 0, fmt.Errorf("unmarshal item ID: %w", err)
+	}
+	return counter.NextID, nil
+}
+
+func (s *DynamoDBStore) key(id int64) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberN{Value: strconv.FormatInt(id, 10)},
+	}
+}
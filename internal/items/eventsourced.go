@@ -0,0 +1,446 @@
+package items
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+)
+
+// counterItemID is the reserved item_id of the row holding the next item ID in
+// the events table. Real item IDs start at 1.
+const counterItemID = 0
+
+// projection is the materialized current state of an item.
+type projection struct {
+	ID          int64     `dynamodbav:"id"`
+	Name        string    `dynamodbav:"name"`
+	Description string    `dynamodbav:"description"`
+	Version     int64     `dynamodbav:"version"`
+	UpdatedAt   time.Time `dynamodbav:"updated_at"`
+}
+
+func (p projection) item() Item {
+	return Item{ID: p.ID, Name: p.Name, Description: p.Description}
+}
+
+// EventStore is an event-sourced Store. Every change is appended as an
+// immutable event to the events table (partition key item_id, sort key
+// version, both numbers) and the item's current state is written to the
+// projection table (partition key id, a number) in the same transaction.
+// Reads are served from the projection; Rebuild regenerates it from the events.
+type EventStore struct {
+	client      *dynamodb.Client
+	eventsTable string
+	table       string
+}
+
+// NewEventStore creates an event-sourced store.
+func NewEventStore(client *dynamodb.Client, eventsTable, table string) *EventStore {
+	return &EventStore{
+		client:      client,
+		eventsTable: eventsTable,
+		table:       table,
+	}
+}
+
+// List returns every item from the projection.
+func (s *EventStore) List(ctx context.Context) ([]Item, error) {
+	projections, err := s.scanProjections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Item, 0, len(projections))
+	for _, p := range projections {
+		list = append(list, p.item())
+	}
+	return list, nil
+}
+
+// Get returns the item with the given ID or ErrNotFound.
+func (s *EventStore) Get(ctx context.Context, id int64) (Item, error) {
+	p, err := s.getProjection(ctx, id)
+	if err != nil {
+		return Item{}, err
+	}
+	return p.item(), nil
+}
+
+// Create appends a Created event for a new item.
+func (s *EventStore) Create(ctx context.Context, name, description string) (Item, error) {
+	id, err := s.allocateID(ctx)
+	if err != nil {
+		return Item{}, err
+	}
+
+	event := s.newEvent(ctx, EventCreated, Item{ID: id, Name: name, Description: description}, 1)
+	if err := s.append(ctx, event, 0); err != nil {
+		return Item{}, err
+	}
+	return Item{ID: id, Name: name, Description: description}, nil
+}
+
+// Update appends an Updated event or returns ErrNotFound.
+func (s *EventStore) Update(ctx context.Context, item Item) (Item, error) {
+	current, err := s.getProjection(ctx, item.ID)
+	if err != nil {
+		return Item{}, err
+	}
+
+	event := s.newEvent(ctx, EventUpdated, item, current.Version+1)
+	if err := s.append(ctx, event, current.Version); err != nil {
+		return Item{}, err
+	}
+	return item, nil
+}
+
+// Delete appends a Deleted event or returns ErrNotFound.
+func (s *EventStore) Delete(ctx context.Context, id int64) error {
+	current, err := s.getProjection(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	event := s.newEvent(ctx, EventDeleted, Item{ID: id}, current.Version+1)
+	return s.append(ctx, event, current.Version)
+}
+
+// History returns an item's events, oldest first, or ErrNotFound.
+func (s *EventStore) History(ctx context.Context, id int64) ([]Event, error) {
+	if id == counterItemID {
+		return nil, ErrNotFound
+	}
+
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.eventsTable),
+		KeyConditionExpression: aws.String("item_id = :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberN{Value: strconv.FormatInt(id, 10)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+
+	var events []Event
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", s.eventsTable, err)
+		}
+
+		var pageEvents []Event
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageEvents); err != nil {
+			return nil, fmt.Errorf("unmarshal events: %w", err)
+		}
+		events = append(events, pageEvents...)
+	}
+
+	if len(events) == 0 {
+		return nil, ErrNotFound
+	}
+	return events, nil
+}
+
+// RebuildResult summarizes a projection rebuild.
+type RebuildResult struct {
+	Events  int // Events replayed
+	Items   int // Items in the rebuilt projection
+	Removed int // Projection rows removed because their item was deleted or never existed
+}
+
+// Rebuild replays every event and rewrites the projection table to match.
+// Writes made while a rebuild runs may be overwritten, so run it while the
+// server is stopped or in read-only mode.
+func (s *EventStore) Rebuild(ctx context.Context) (RebuildResult, error) {
+	var result RebuildResult
+
+	byItem := make(map[int64][]Event)
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:      aws.String(s.eventsTable),
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return result, fmt.Errorf("scan %s: %w", s.eventsTable, err)
+		}
+
+		var events []Event
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &events); err != nil {
+			return result, fmt.Errorf("unmarshal events: %w", err)
+		}
+		for _, e := range events {
+			if e.ItemID == counterItemID {
+				continue
+			}
+			byItem[e.ItemID] = append(byItem[e.ItemID], e)
+			result.Events++
+		}
+	}
+
+	var writes []types.WriteRequest
+	live := make(map[int64]bool, len(byItem))
+	for id, events := range byItem {
+		p, ok := replay(events)
+		if !ok {
+			continue
+		}
+		live[id] = true
+
+		item, err := attributevalue.MarshalMap(p)
+		if err != nil {
+			return result, fmt.Errorf("marshal projection: %w", err)
+		}
+		writes = append(writes, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+	result.Items = len(live)
+
+	existing, err := s.scanProjections(ctx)
+	if err != nil {
+		return result, err
+	}
+	for _, p := range existing {
+		if live[p.ID] {
+			continue
+		}
+		writes = append(writes, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: s.projectionKey(p.ID)}})
+		result.Removed++
+	}
+
+	if err := s.batchWrite(ctx, writes); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// replay folds an item's events into its current state. It reports false if
+// the item ends up deleted.
+func replay(events []Event) (projection, bool) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Version < events[j].Version
+	})
+
+	var p projection
+	var exists bool
+	for _, e := range events {
+		switch e.Type {
+		case EventCreated, EventUpdated:
+			p = projection{
+				ID:          e.ItemID,
+				Name:        e.Name,
+				Description: e.Description,
+				Version:     e.Version,
+				UpdatedAt:   e.OccurredAt,
+			}
+			exists = true
+		case EventDeleted:
+			exists = false
+		}
+	}
+	return p, exists
+}
+
+// newEvent builds an event for a change to item made by the user in ctx.
+func (s *EventStore) newEvent(ctx context.Context, eventType EventType, item Item, version int64) Event {
+	userID, _ := auth.GetUserID(ctx)
+	return Event{
+		ItemID:      item.ID,
+		Version:     version,
+		Type:        eventType,
+		Name:        item.Name,
+		Description: item.Description,
+		UserID:      userID,
+		OccurredAt:  time.Now().UTC(),
+	}
+}
+
+// append writes the event and updates the projection in one transaction.
+// expectedVersion is the projection's current version (0 for a new item); if
+// another write got there first the transaction fails with ErrConflict.
+func (s *EventStore) append(ctx context.Context, event Event, expectedVersion int64) error {
+	eventItem, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	versionValues := map[string]types.AttributeValue{
+		":v": &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion, 10)},
+	}
+	versionNames := map[string]string{"#v": "version"}
+
+	var projectionWrite types.TransactWriteItem
+	switch {
+	case event.Type == EventDeleted:
+		projectionWrite.Delete = &types.Delete{
+			TableName:                 aws.String(s.table),
+			Key:                       s.projectionKey(event.ItemID),
+			ConditionExpression:       aws.String("#v = :v"),
+			ExpressionAttributeNames:  versionNames,
+			ExpressionAttributeValues: versionValues,
+		}
+	default:
+		item, err := attributevalue.MarshalMap(projection{
+			ID:          event.ItemID,
+			Name:        event.Name,
+			Description: event.Description,
+			Version:     event.Version,
+			UpdatedAt:   event.OccurredAt,
+		})
+		if err != nil {
+			return fmt.Errorf("marshal projection: %w", err)
+		}
+
+		put := &types.Put{
+			TableName: aws.String(s.table),
+			Item:      item,
+		}
+		if expectedVersion == 0 {
+			put.ConditionExpression = aws.String("attribute_not_exists(id)")
+		} else {
+			put.ConditionExpression = aws.String("#v = :v")
+			put.ExpressionAttributeNames = versionNames
+			put.ExpressionAttributeValues = versionValues
+		}
+		projectionWrite.Put = put
+	}
+
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(s.eventsTable),
+					Item:                eventItem,
+					ConditionExpression: aws.String("attribute_not_exists(version)"),
+				},
+			},
+			projectionWrite,
+		},
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			for _, reason := range canceled.CancellationReasons {
+				if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+					return ErrConflict
+				}
+			}
+		}
+		return fmt.Errorf("append %s event for item %d: %w", event.Type, event.ItemID, err)
+	}
+	return nil
+}
+
+// allocateID atomically increments the ID counter in the events table.
+func (s *EventStore) allocateID(ctx context.Context) (int64, error) {
+	result, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.eventsTable),
+		Key: map[string]types.AttributeValue{
+			"item_id": &types.AttributeValueMemberN{Value: strconv.Itoa(counterItemID)},
+			"version": &types.AttributeValueMemberN{Value: "0"},
+		},
+		UpdateExpression: aws.String("ADD next_id :one"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("allocate item ID: %w", err)
+	}
+
+	var counter struct {
+		NextID int64 `dynamodbav:"next_id"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Attributes, &counter); err != nil {
+		return 0, fmt.Errorf("unmarshal item ID: %w", err)
+	}
+	return counter.NextID, nil
+}
+
+// getProjection reads an item's current state or returns ErrNotFound.
+func (s *EventStore) getProjection(ctx context.Context, id int64) (projection, error) {
+	var p projection
+
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            s.projectionKey(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return p, fmt.Errorf("get item from %s: %w", s.table, err)
+	}
+	if result.Item == nil {
+		return p, ErrNotFound
+	}
+
+	if err := attributevalue.UnmarshalMap(result.Item, &p); err != nil {
+		return p, fmt.Errorf("unmarshal item: %w", err)
+	}
+	return p, nil
+}
+
+// scanProjections reads the whole projection table.
+func (s *EventStore) scanProjections(ctx context.Context) ([]projection, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(s.table),
+	})
+
+	projections := make([]projection, 0)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", s.table, err)
+		}
+
+		var pageProjections []projection
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageProjections); err != nil {
+			return nil, fmt.Errorf("unmarshal items: %w", err)
+		}
+		projections = append(projections, pageProjections...)
+	}
+	return projections, nil
+}
+
+// batchWrite applies writes to the projection table 25 at a time, retrying
+// unprocessed items.
+func (s *EventStore) batchWrite(ctx context.Context, writes []types.WriteRequest) error {
+	for start := 0; start < len(writes); start += 25 {
+		pending := writes[start:min(start+25, len(writes))]
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == 5 {
+				return fmt.Errorf("batch write to %s: %d items unprocessed after retries", s.table, len(pending))
+			}
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+				}
+			}
+
+			result, err := s.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]types.WriteRequest{s.table: pending},
+			})
+			if err != nil {
+				return fmt.Errorf("batch write to %s: %w", s.table, err)
+			}
+			pending = result.UnprocessedItems[s.table]
+		}
+	}
+	return nil
+}
+
+func (s *EventStore) projectionKey(id int64) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberN{Value: strconv.FormatInt(id, 10)},
+	}
+}
@@ -0,0 +1,61 @@
+// Package items stores the items managed through /api/v1/items.
+package items
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("item not found")
+	ErrConflict = errors.New("item was modified concurrently")
+)
+
+// Item represents an item in our system.
+type Item struct {
+	ID          int64  `json:"id" dynamodbav:"id" example:"1"`
+	Name        string `json:"name" dynamodbav:"name" example:"Sample Item"`
+	Description string `json:"description" dynamodbav:"description" example:"This is a sample item description"`
+}
+
+// Store persists items.
+type Store interface {
+	// List returns every item.
+	List(ctx context.Context) ([]Item, error)
+	// Get returns the item with the given ID or ErrNotFound.
+	Get(ctx context.Context, id int64) (Item, error)
+	// Create stores a new item and assigns its ID.
+	Create(ctx context.Context, name, description string) (Item, error)
+	// Update replaces an existing item's fields or returns ErrNotFound.
+	Update(ctx context.Context, item Item) (Item, error)
+	// Delete removes an item or returns ErrNotFound.
+	Delete(ctx context.Context, id int64) error
+}
+
+// EventType identifies a change recorded in an item's history.
+type EventType string
+
+const (
+	EventCreated EventType = "Created"
+	EventUpdated EventType = "Updated"
+	EventDeleted EventType = "Deleted"
+)
+
+// Event is an immutable change to an item. Created and Updated events carry
+// the item's full state after the change.
+type Event struct {
+	ItemID      int64     `json:"itemId" dynamodbav:"item_id"`
+	Version     int64     `json:"version" dynamodbav:"version"`
+	Type        EventType `json:"type" dynamodbav:"type" enums:"Created,Updated,Deleted"`
+	Name        string    `json:"name,omitempty" dynamodbav:"name,omitempty"`
+	Description string    `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	UserID      string    `json:"userId,omitempty" dynamodbav:"user_id,omitempty"`
+	OccurredAt  time.Time `json:"occurredAt" dynamodbav:"occurred_at"`
+}
+
+// HistoryStore is implemented by stores that keep every change to an item.
+type HistoryStore interface {
+	// History returns an item's events, oldest first, or ErrNotFound.
+	History(ctx context.Context, id int64) ([]Event, error)
+}
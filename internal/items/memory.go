@@ -0,0 +1,84 @@
+package items
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps items in memory. Items are lost on restart.
+type MemoryStore struct {
+	mu     sync.RWMutex // Protects items and nextID
+	items  map[int64]Item
+	nextID int64
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		items:  make(map[int64]Item),
+		nextID: 1,
+	}
+}
+
+// List returns every item.
+func (s *MemoryStore) List(ctx context.Context) ([]Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Item, 0, len(s.items))
+	for _, item := range s.items {
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+// Get returns the item with the given ID or ErrNotFound.
+func (s *MemoryStore) Get(ctx context.Context, id int64) (Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return Item{}, ErrNotFound
+	}
+	return item, nil
+}
+
+// Create stores a new item and assigns its ID.
+func (s *MemoryStore) Create(ctx context.Context, name, description string) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := Item{
+		ID:          s.nextID,
+		Name:        name,
+		Description: description,
+	}
+	s.nextID++
+	s.items[item.ID] = item
+	return item, nil
+}
+
+// Update replaces an existing item's fields or returns ErrNotFound.
+func (s *MemoryStore) Update(ctx context.Context, item Item) (Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[item.ID]; !ok {
+		return Item{}, ErrNotFound
+	}
+	s.items[item.ID] = item
+	return item, nil
+}
+
+// Delete removes an item or returns ErrNotFound.
+func (s *MemoryStore) Delete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.items, id)
+	return nil
+}
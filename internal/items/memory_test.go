@@ -0,0 +1,99 @@
+package items
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestMemoryStoreConcurrentCreateList hammers Create and List from many
+// goroutines at once. Run it with -race: besides the detector's checks, it
+// verifies that every item is stored exactly once under a unique ID and
+// that List never returns an item twice.
+func TestMemoryStoreConcurrentCreateList(t *testing.T) {
+	const (
+		writers   = 8
+		perWriter = 100
+		readers   = 4
+		perReader = 50
+	)
+
+	ctx := context.Background()
+	store := NewMemoryStore()
+	start := make(chan struct{})
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created = make(map[int64]Item, writers*perWriter)
+		dupes   []int64
+	)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < perWriter; i++ {
+				item, err := store.Create(ctx, fmt.Sprintf("item %d-%d", w, i), "")
+				if err != nil {
+					t.Errorf("Create: %v", err)
+					return
+				}
+				mu.Lock()
+				if _, ok := created[item.ID]; ok {
+					dupes = append(dupes, item.ID)
+				}
+				created[item.ID] = item
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < perReader; i++ {
+				list, err := store.List(ctx)
+				if err != nil {
+					t.Errorf("List: %v", err)
+					return
+				}
+				seen := make(map[int64]bool, len(list))
+				for _, item := range list {
+					if seen[item.ID] {
+						t.Errorf("List returned item %d twice", item.ID)
+						return
+					}
+					seen[item.ID] = true
+				}
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	if len(dupes) > 0 {
+		t.Fatalf("Create assigned IDs more than once: %v", dupes)
+	}
+	if want := writers * perWriter; len(created) != want {
+		t.Fatalf("created %d items, want %d", len(created), want)
+	}
+
+	list, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != len(created) {
+		t.Fatalf("List returned %d items, want %d", len(list), len(created))
+	}
+	for _, item := range list {
+		if want, ok := created[item.ID]; !ok || item != want {
+			t.Errorf("List returned %+v, want %+v", item, want)
+		}
+	}
+}
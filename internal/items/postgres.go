@@ -0,0 +1,90 @@
+package items
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// PostgresStore keeps items in the items table of a Postgres database.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+// NewPostgresStore creates a store on db, which must have the items table
+// database.Migrate creates.
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// List returns every item, oldest first.
+func (s *PostgresStore) List(ctx context.Context) ([]Item, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, description FROM items ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("list items: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]Item, 0)
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.ID, &item.Name, &item.Description); err != nil {
+			return nil, fmt.Errorf("list items: %w", err)
+		}
+		list = append(list, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list items: %w", err)
+	}
+	return list, nil
+}
+
+// Get returns the item with the given ID or ErrNotFound.
+func (s *PostgresStore) Get(ctx context.Context, id int64) (Item, error) {
+	item := Item{ID: id}
+	err := s.db.QueryRowContext(ctx, "SELECT name, description FROM items WHERE id = $1", id).
+		Scan(&item.Name, &item.Description)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Item{}, ErrNotFound
+	}
+	if err != nil {
+		return Item{}, fmt.Errorf("get item %d: %w", id, err)
+	}
+	return item, nil
+}
+
+// Create stores a new item and assigns its ID from the table's sequence.
+func (s *PostgresStore) Create(ctx context.Context, name, description string) (Item, error) {
+	item := Item{Name: name, Description: description}
+	err := s.db.QueryRowContext(ctx, "INSERT INTO items (name, description) VALUES ($1, $2) RETURNING id", name, description).
+		Scan(&item.ID)
+	if err != nil {
+		return Item{}, fmt.Errorf("create item: %w", err)
+	}
+	return item, nil
+}
+
+// Update replaces an existing item's fields or returns ErrNotFound.
+func (s *PostgresStore) Update(ctx context.Context, item Item) (Item, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE items SET name = $2, description = $3 WHERE id = $1", item.ID, item.Name, item.Description)
+	if err != nil {
+		return Item{}, fmt.Errorf("update item %d: %w", item.ID, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return Item{}, ErrNotFound
+	}
+	return item, nil
+}
+
+// Delete removes an item or returns ErrNotFound.
+func (s *PostgresStore) Delete(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM items WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete item %d: %w", id, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+// Package kpl reads and writes Kinesis records in the aggregated format of
+// the Kinesis Producer Library, which packs many small user records into one
+// Kinesis record. Kinesis charges and throttles per record, so aggregating
+// clickstream-sized records cuts both; the Kinesis Client Library, and
+// Lambda consumers using the aggregation library, unpack them again.
+//
+// An aggregated record is the magic number F3 89 9A C2, a protobuf
+// AggregatedRecord message, and the MD5 digest of the message.
+package kpl
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// magic starts every aggregated record.
+var magic = []byte{0xF3, 0x89, 0x9A, 0xC2}
+
+// MaxSize is the most data a Kinesis record holds, less room for its
+// partition key.
+const MaxSize = 1024*1024 - 256
+
+// Record is a user record.
+type Record struct {
+	PartitionKey string
+	// ExplicitHashKey, if set, overrides the hash of PartitionKey.
+	ExplicitHashKey string
+	Data            []byte
+}
+
+// Protobuf field numbers and wire types of the AggregatedRecord and Record
+// messages.
+const (
+	fieldPartitionKeyTable    = 1
+	fieldExplicitHashKeyTable = 2
+	fieldRecords              = 3
+
+	fieldPartitionKeyIndex    = 1
+	fieldExplicitHashKeyIndex = 2
+	fieldData                 = 3
+
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// Aggregator packs records into aggregated records of at most MaxSize
+// bytes. Each aggregated record is put with the partition key of its first
+// record, so all its records land on that key's shard.
+type Aggregator struct {
+	keys      []string
+	keyIndex  map[string]uint64
+	hashKeys  []string
+	hashIndex map[string]uint64
+	records   [][]byte // Encoded Record messages
+	first     Record
+	size      int
+}
+
+// Add adds r to the aggregated record and reports whether it fit. When it
+// doesn't, Flush the aggregator and add r again. A record too large for an
+// empty aggregator never fits.
+func (a *Aggregator) Add(r Record) bool {
+	var record []byte
+	keyIndex, newKey := a.index(&a.keys, &a.keyIndex, r.PartitionKey)
+	record = appendVarintField(record, fieldPartitionKeyIndex, keyIndex)
+	hashIndex, newHash := uint64(0), false
+	if r.ExplicitHashKey != "" {
+		hashIndex, newHash = a.index(&a.hashKeys, &a.hashIndex, r.ExplicitHashKey)
+		record = appendVarintField(record, fieldExplicitHashKeyIndex, hashIndex)
+	}
+	record = appendBytesField(record, fieldData, r.Data)
+
+	added := bytesFieldSize(fieldRecords, len(record))
+	if newKey {
+		added += bytesFieldSize(fieldPartitionKeyTable, len(r.PartitionKey))
+	}
+	if newHash {
+		added += bytesFieldSize(fieldExplicitHashKeyTable, len(r.ExplicitHashKey))
+	}
+	if len(magic)+a.size+added+md5.Size > MaxSize {
+		// Undo the table entries this record would have added
+		if newKey {
+			delete(a.keyIndex, r.PartitionKey)
+			a.keys = a.keys[:len(a.keys)-1]
+		}
+		if newHash {
+			delete(a.hashIndex, r.ExplicitHashKey)
+			a.hashKeys = a.hashKeys[:len(a.hashKeys)-1]
+		}
+		return false
+	}
+
+	if len(a.records) == 0 {
+		a.first = r
+	}
+	a.records = append(a.records, record)
+	a.size += added
+	return true
+}
+
+// Len returns how many records the aggregator holds.
+func (a *Aggregator) Len() int {
+	return len(a.records)
+}
+
+// Flush returns the aggregated record, with the partition key and explicit
+// hash key to put it with, and empties the aggregator. It returns a zero
+// Record if the aggregator is empty.
+func (a *Aggregator) Flush() Record {
+	if len(a.records) == 0 {
+		return Record{}
+	}
+
+	msg := make([]byte, 0, a.size)
+	for _, key := range a.keys {
+		msg = appendBytesField(msg, fieldPartitionKeyTable, []byte(key))
+	}
+	for _, key := range a.hashKeys {
+		msg = appendBytesField(msg, fieldExplicitHashKeyTable, []byte(key))
+	}
+	for _, record := range a.records {
+		msg = appendBytesField(msg, fieldRecords, record)
+	}
+	sum := md5.Sum(msg)
+
+	data := make([]byte, 0, len(magic)+len(msg)+len(sum))
+	data = append(data, magic...)
+	data = append(data, msg...)
+	data = append(data, sum[:]...)
+
+	out := Record{PartitionKey: a.first.PartitionKey, ExplicitHashKey: a.first.ExplicitHashKey, Data: data}
+	*a = Aggregator{}
+	return out
+}
+
+// index returns the index of key in table, adding it if it is new.
+func (a *Aggregator) index(table *[]string, indexes *map[string]uint64, key string) (uint64, bool) {
+	if *indexes == nil {
+		*indexes = make(map[string]uint64)
+	}
+	if i, ok := (*indexes)[key]; ok {
+		return i, false
+	}
+	i := uint64(len(*table))
+	*table = append(*table, key)
+	(*indexes)[key] = i
+	return i, true
+}
+
+// IsAggregated reports whether data is an aggregated record.
+func IsAggregated(data []byte) bool {
+	return len(data) >= len(magic)+md5.Size && bytes.Equal(data[:len(magic)], magic)
+}
+
+// Deaggregate returns the user records in an aggregated record. Records
+// that aren't aggregated are returned as they are, with partitionKey.
+func Deaggregate(data []byte, partitionKey string) ([]Record, error) {
+	if !IsAggregated(data) {
+		return []Record{{PartitionKey: partitionKey, Data: data}}, nil
+	}
+	msg := data[len(magic) : len(data)-md5.Size]
+	if sum := md5.Sum(msg); !bytes.Equal(sum[:], data[len(data)-md5.Size:]) {
+		// The KPL treats records whose digest doesn't match as plain data
+		return []Record{{PartitionKey: partitionKey, Data: data}}, nil
+	}
+
+	var keys, hashKeys []string
+	var raw [][]byte
+	err := readFields(msg, func(field int, value uint64, b []byte) error {
+		switch field {
+		case fieldPartitionKeyTable:
+			keys = append(keys, string(b))
+		case fieldExplicitHashKeyTable:
+			hashKeys = append(hashKeys, string(b))
+		case fieldRecords:
+			raw = append(raw, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("decode aggregated record: %w", err)
+	}
+
+	records := make([]Record, 0, len(raw))
+	for _, b := range raw {
+		var r Record
+		err := readFields(b, func(field int, value uint64, b []byte) error {
+			switch field {
+			case fieldPartitionKeyIndex:
+				if value >= uint64(len(keys)) {
+					return fmt.Errorf("partition key index %d out of range", value)
+				}
+				r.PartitionKey = keys[value]
+			case fieldExplicitHashKeyIndex:
+				if value >= uint64(len(hashKeys)) {
+					return fmt.Errorf("explicit hash key index %d out of range", value)
+				}
+				r.ExplicitHashKey = hashKeys[value]
+			case fieldData:
+				r.Data = b
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("decode aggregated record: %w", err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// appendVarintField appends a varint field to b.
+func appendVarintField(b []byte, field int, value uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|wireVarint))
+	return binary.AppendUvarint(b, value)
+}
+
+// appendBytesField appends a length-delimited field to b.
+func appendBytesField(b []byte, field int, value []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field<<3|wireBytes))
+	b = binary.AppendUvarint(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// bytesFieldSize returns the encoded size of a length-delimited field
+// holding n bytes.
+func bytesFieldSize(field, n int) int {
+	return varintSize(uint64(field<<3|wireBytes)) + varintSize(uint64(n)) + n
+}
+
+// varintSize returns the encoded size of v.
+func varintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+// errTruncated is returned for messages that end in the middle of a field.
+var errTruncated = errors.New("truncated message")
+
+// readFields calls fn with each varint and length-delimited field of msg.
+// Fields of other wire types are skipped.
+func readFields(msg []byte, fn func(field int, value uint64, b []byte) error) error {
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errTruncated
+		}
+		msg = msg[n:]
+		field, wire := int(tag>>3), tag&7
+
+		switch wire {
+		case wireVarint:
+			value, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return errTruncated
+			}
+			msg = msg[n:]
+			if err := fn(field, value, nil); err != nil {
+				return err
+			}
+		case wireBytes:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || length > uint64(len(msg)-n) {
+				return errTruncated
+			}
+			b := msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+			if err := fn(field, 0, b); err != nil {
+				return err
+			}
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return errTruncated
+			}
+			msg = msg[8:]
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return errTruncated
+			}
+			msg = msg[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Package latency counts requests per route and flags those slower than a
+// threshold, so tail latency regressions show up without tracing. Counts
+// are kept in memory since the server started.
+package latency
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats is the latency record of one route.
+type Stats struct {
+	Route    string `json:"route" example:"GET /api/v1/aws/s3/buckets"`
+	Requests int64  `json:"requests"`
+	// Slow counts requests that took longer than the threshold.
+	Slow       int64      `json:"slow"`
+	MaxMs      int64      `json:"maxMs"`
+	LastSlowAt *time.Time `json:"lastSlowAt,omitempty"`
+}
+
+// Tracker records request durations per route. A nil Tracker records
+// nothing.
+type Tracker struct {
+	threshold time.Duration
+
+	mu     sync.Mutex
+	routes map[string]*Stats
+}
+
+// New returns a Tracker flagging requests slower than threshold, or nil if
+// threshold is 0.
+func New(threshold time.Duration) *Tracker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &Tracker{
+		threshold: threshold,
+		routes:    make(map[string]*Stats),
+	}
+}
+
+// Threshold returns the duration above which requests are slow.
+func (t *Tracker) Threshold() time.Duration {
+	return t.threshold
+}
+
+// Record notes a request to route that took d, and reports whether it was
+// slow.
+func (t *Tracker) Record(route string, d time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.routes[route]
+	if !ok {
+		s = &Stats{Route: route}
+		t.routes[route] = s
+	}
+	s.Requests++
+	if ms := d.Milliseconds(); ms > s.MaxMs {
+		s.MaxMs = ms
+	}
+	if d <= t.threshold {
+		return false
+	}
+	s.Slow++
+	now := time.Now()
+	s.LastSlowAt = &now
+	return true
+}
+
+// Stats returns the stats of every route that has been requested, slowest
+// first.
+func (t *Tracker) Stats() []Stats {
+	t.mu.Lock()
+	stats := make([]Stats, 0, len(t.routes))
+	for _, s := range t.routes {
+		stats = append(stats, *s)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Slow != stats[j].Slow {
+			return stats[i].Slow > stats[j].Slow
+		}
+		return stats[i].Route < stats[j].Route
+	})
+	return stats
+}
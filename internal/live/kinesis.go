@@ -0,0 +1,198 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	kinesistypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+
+	"github.com/pmollerus23/go-aws-server/internal/kpl"
+)
+
+// KinesisRecord is a record read from a stream, published on TopicKinesis
+// with the type "record". Records aggregated in the Kinesis Producer
+// Library's format are published one by one.
+type KinesisRecord struct {
+	Stream         string `json:"stream" example:"clickstream"`
+	PartitionKey   string `json:"partitionKey" example:"user-123"`
+	SequenceNumber string `json:"sequenceNumber" example:"49590338271490256608559692538361571095921575989136588898"`
+	// Data is the record's content: as is if it is JSON, as a string if it
+	// is other text, and base64-encoded otherwise.
+	Data any `json:"data"`
+}
+
+// WatchKinesis publishes the records put on each Kinesis stream, from now
+// on, polling every interval until ctx is done. Every instance reads every
+// shard; Kinesis allows five reads per second per shard before throttling.
+func (h *Hub) WatchKinesis(ctx context.Context, streams []string, client *kinesis.Client, interval time.Duration) {
+	for _, stream := range streams {
+		go func() {
+			w := &kinesisWatcher{hub: h, client: client, stream: stream, shards: make(map[string]*shard)}
+			w.run(ctx, interval)
+		}()
+	}
+}
+
+// kinesisWatcher reads one Kinesis stream.
+type kinesisWatcher struct {
+	hub    *Hub
+	client *kinesis.Client
+	stream string
+	shards map[string]*shard
+}
+
+// run polls the stream until ctx is done.
+func (w *kinesisWatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var refreshed time.Time
+	first := true
+	for {
+		if time.Since(refreshed) >= shardRefreshInterval {
+			if err := w.refresh(ctx, first); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				w.hub.logger.Error("failed to list Kinesis stream shards", "error", err, "stream", w.stream)
+			} else {
+				refreshed, first = time.Now(), false
+			}
+		}
+
+		for id, s := range w.shards {
+			if s.iterator == "" {
+				continue
+			}
+			closed, err := w.poll(ctx, s)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				w.hub.logger.Warn("failed to read Kinesis stream shard", "error", err, "stream", w.stream, "shard", id)
+				// Resume from the last record once the shards are refreshed
+				s.iterator = ""
+				refreshed = time.Time{}
+			}
+			if closed {
+				// The shard's children are new shards
+				refreshed = time.Time{}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh opens iterators for new shards and for shards whose iterator was
+// lost. On the first refresh, only open shards are read, from their latest
+// record; shards found later were split off or merged since and are read in
+// full.
+func (w *kinesisWatcher) refresh(ctx context.Context, first bool) error {
+	input := &kinesis.ListShardsInput{StreamName: aws.String(w.stream)}
+	for {
+		out, err := w.client.ListShards(ctx, input)
+		if err != nil {
+			return err
+		}
+
+		for _, desc := range out.Shards {
+			id := aws.ToString(desc.ShardId)
+			s, ok := w.shards[id]
+			if !ok {
+				s = &shard{}
+				w.shards[id] = s
+				if first && desc.SequenceNumberRange != nil && desc.SequenceNumberRange.EndingSequenceNumber != nil {
+					s.done = true
+				}
+			}
+			if s.done || s.iterator != "" {
+				continue
+			}
+
+			iteratorInput := &kinesis.GetShardIteratorInput{
+				StreamName: aws.String(w.stream),
+				ShardId:    aws.String(id),
+			}
+			switch {
+			case s.last != "":
+				iteratorInput.ShardIteratorType = kinesistypes.ShardIteratorTypeAfterSequenceNumber
+				iteratorInput.StartingSequenceNumber = aws.String(s.last)
+			case first:
+				iteratorInput.ShardIteratorType = kinesistypes.ShardIteratorTypeLatest
+			default:
+				iteratorInput.ShardIteratorType = kinesistypes.ShardIteratorTypeTrimHorizon
+			}
+			iterator, err := w.client.GetShardIterator(ctx, iteratorInput)
+			if err != nil {
+				return fmt.Errorf("get iterator for shard %s: %w", id, err)
+			}
+			s.iterator = aws.ToString(iterator.ShardIterator)
+		}
+
+		if out.NextToken == nil {
+			return nil
+		}
+		// The stream name can't be given with a token
+		input = &kinesis.ListShardsInput{NextToken: out.NextToken}
+	}
+}
+
+// poll publishes the shard's new records and reports whether it has been
+// read to its end.
+func (w *kinesisWatcher) poll(ctx context.Context, s *shard) (closed bool, err error) {
+	out, err := w.client.GetRecords(ctx, &kinesis.GetRecordsInput{
+		ShardIterator: aws.String(s.iterator),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, record := range out.Records {
+		s.last = aws.ToString(record.SequenceNumber)
+		records := []kpl.Record{{PartitionKey: aws.ToString(record.PartitionKey), Data: record.Data}}
+		if kpl.IsAggregated(record.Data) {
+			records, err = kpl.Deaggregate(record.Data, aws.ToString(record.PartitionKey))
+			if err != nil {
+				w.hub.logger.Warn("skipping unreadable aggregated Kinesis record", "error", err, "stream", w.stream)
+				continue
+			}
+		}
+		for _, r := range records {
+			w.hub.Publish(TopicKinesis, "record", KinesisRecord{
+				Stream:         w.stream,
+				PartitionKey:   r.PartitionKey,
+				SequenceNumber: s.last,
+				Data:           recordData(r.Data),
+			})
+		}
+	}
+
+	if out.NextShardIterator == nil {
+		s.iterator, s.done = "", true
+		return true, nil
+	}
+	s.iterator = *out.NextShardIterator
+	return false, nil
+}
+
+// recordData returns data as a value that encodes to JSON as described on
+// KinesisRecord.Data.
+func recordData(data []byte) any {
+	switch {
+	case json.Valid(data):
+		return json.RawMessage(data)
+	case utf8.Valid(data):
+		return string(data)
+	default:
+		return data
+	}
+}
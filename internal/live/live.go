@@ -0,0 +1,168 @@
+// Package live pushes server events, such as item changes, S3 uploads, and
+// DynamoDB stream records, to clients connected over WebSocket, so they
+// don't have to poll.
+//
+// The hub is per process: clients only see events published by the
+// instance they are connected to, plus the stream records every instance
+// reads.
+package live
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Topics clients can subscribe to.
+const (
+	TopicItems    = "items"
+	TopicS3       = "s3"
+	TopicDynamoDB = "dynamodb"
+	TopicKinesis  = "kinesis"
+	// TopicDocuments announces finished Textract jobs, with the type
+	// "completed".
+	TopicDocuments = "documents"
+)
+
+// Topics lists every topic, which is what clients subscribe to by default.
+var Topics = []string{TopicItems, TopicS3, TopicDynamoDB, TopicKinesis, TopicDocuments}
+
+// clientBuffer is how many events a client may fall behind by before it is
+// disconnected.
+const clientBuffer = 64
+
+// Event is a change pushed to clients.
+type Event struct {
+	Topic string    `json:"topic,omitempty" example:"items"`
+	Type  string    `json:"type" example:"updated"`
+	Data  any       `json:"data,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// Hub fans events out to the clients subscribed to their topics. A nil Hub
+// drops every event.
+type Hub struct {
+	logger *slog.Logger
+
+	mu      sync.Mutex // Protects clients and closed
+	clients map[*client]struct{}
+	closed  bool
+}
+
+// client is a connected subscriber. events is closed when the hub drops it.
+type client struct {
+	events chan Event
+	topics map[string]bool // Protected by the hub's mu
+	// closeCode is the WebSocket close code to send when events is closed.
+	closeCode uint16
+}
+
+// New creates a hub with no clients.
+func New(logger *slog.Logger) *Hub {
+	return &Hub{
+		logger:  logger,
+		clients: make(map[*client]struct{}),
+	}
+}
+
+// Publish sends an event to every client subscribed to topic. Clients too
+// far behind to take it are disconnected rather than slowing the publisher.
+func (h *Hub) Publish(topic, eventType string, data any) {
+	if h == nil {
+		return
+	}
+	event := Event{Topic: topic, Type: eventType, Data: data, Time: time.Now().UTC()}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if !c.topics[topic] {
+			continue
+		}
+		select {
+		case c.events <- event:
+		default:
+			h.logger.Warn("disconnecting slow live client", "topic", topic)
+			h.drop(c, closePolicyViolation)
+		}
+	}
+}
+
+// Clients returns how many clients are connected.
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Close disconnects every client and refuses new ones. Hijacked connections
+// aren't closed by the HTTP server's shutdown, so this must be called when
+// the server stops.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.clients {
+		h.drop(c, closeGoingAway)
+	}
+}
+
+// subscribe adds a client for topics, or returns nil if the hub is closed.
+func (h *Hub) subscribe(topics []string) *client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+
+	c := &client{
+		events: make(chan Event, clientBuffer),
+		topics: make(map[string]bool),
+	}
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+	h.clients[c] = struct{}{}
+	return c
+}
+
+// unsubscribe removes c, if the hub hasn't already dropped it.
+func (h *Hub) unsubscribe(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.events)
+	}
+}
+
+// setTopics changes the topics c is subscribed to.
+func (h *Hub) setTopics(c *client, topics []string, subscribed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, topic := range topics {
+		if subscribed {
+			c.topics[topic] = true
+		} else {
+			delete(c.topics, topic)
+		}
+	}
+}
+
+// drop removes c, telling it why with code. h.mu must be held.
+func (h *Hub) drop(c *client, code uint16) {
+	delete(h.clients, c)
+	c.closeCode = code
+	close(c.events)
+}
+
+// ValidTopics reports whether every topic in topics exists.
+func ValidTopics(topics []string) bool {
+	for _, topic := range topics {
+		if !slices.Contains(Topics, topic) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package live
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions clients can send to change their subscriptions.
+const (
+	ActionSubscribe   = "subscribe"
+	ActionUnsubscribe = "unsubscribe"
+)
+
+// Request is a message from a client, such as
+// {"action":"subscribe","topics":["s3"]}.
+type Request struct {
+	Action string   `json:"action" enums:"subscribe,unsubscribe"`
+	Topics []string `json:"topics" example:"items,s3"`
+}
+
+// Serve pushes the events of topics to conn until the client disconnects,
+// falls too far behind, or the hub closes, then closes conn.
+func (h *Hub) Serve(conn *Conn, topics []string) {
+	c := h.subscribe(topics)
+	if c == nil {
+		conn.Close(closeGoingAway, "server is shutting down")
+		return
+	}
+	defer h.unsubscribe(c)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.readRequests(conn, c)
+	}()
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case event, ok := <-c.events:
+			if !ok {
+				conn.Close(c.closeCode, "")
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				conn.Close(closeGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			if err := conn.Ping(); err != nil {
+				conn.Close(closeGoingAway, "")
+				return
+			}
+		case <-done:
+			conn.Close(closeNormal, "")
+			return
+		}
+	}
+}
+
+// readRequests applies the client's subscription changes until it
+// disconnects. Invalid requests are answered with an "error" event.
+func (h *Hub) readRequests(conn *Conn, c *client) {
+	for {
+		message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req Request
+		if err := json.Unmarshal(message, &req); err != nil {
+			conn.WriteJSON(errorEvent("invalid JSON"))
+			continue
+		}
+		if !ValidTopics(req.Topics) {
+			conn.WriteJSON(errorEvent("unknown topic"))
+			continue
+		}
+		switch req.Action {
+		case ActionSubscribe:
+			h.setTopics(c, req.Topics, true)
+		case ActionUnsubscribe:
+			h.setTopics(c, req.Topics, false)
+		default:
+			conn.WriteJSON(errorEvent("unknown action"))
+		}
+	}
+}
+
+// errorEvent tells a client its request was rejected.
+func errorEvent(message string) Event {
+	return Event{Type: "error", Data: map[string]string{"message": message}, Time: time.Now().UTC()}
+}
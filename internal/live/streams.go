@@ -0,0 +1,221 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+)
+
+// shardRefreshInterval is how often the stream is described to find the
+// shards DynamoDB splits off as the table grows.
+const shardRefreshInterval = time.Minute
+
+// StreamRecord is a change to a table, published on TopicDynamoDB with the
+// stream event name (INSERT, MODIFY, or REMOVE) as its type. The images are
+// only set if the table's stream includes them.
+type StreamRecord struct {
+	Table    string         `json:"table" example:"records"`
+	Keys     map[string]any `json:"keys"`
+	NewImage map[string]any `json:"newImage,omitempty"`
+	OldImage map[string]any `json:"oldImage,omitempty"`
+}
+
+// shard is the read position in one shard of a stream.
+type shard struct {
+	iterator string
+	// last is the sequence number of the last record read, to resume from
+	// if the iterator expires.
+	last string
+	done bool // The shard is closed and fully read
+}
+
+// WatchStreams publishes the records of each table's DynamoDB stream, from
+// now on, polling every interval until ctx is done. Every instance reads
+// every shard; DynamoDB allows two readers per shard before throttling.
+func (h *Hub) WatchStreams(ctx context.Context, tables []string, ddb *dynamodb.Client, client *dynamodbstreams.Client, interval time.Duration) {
+	for _, table := range tables {
+		go func() {
+			w := &streamWatcher{hub: h, client: client, table: table, shards: make(map[string]*shard)}
+			if err := w.run(ctx, ddb, interval); err != nil && ctx.Err() == nil {
+				h.logger.Error("stopped watching DynamoDB stream", "error", err, "table", table)
+			}
+		}()
+	}
+}
+
+// streamWatcher reads one table's stream.
+type streamWatcher struct {
+	hub       *Hub
+	client    *dynamodbstreams.Client
+	table     string
+	streamARN string
+	shards    map[string]*shard
+}
+
+// run polls the stream until ctx is done. It returns an error if the table
+// can't be described or has no stream.
+func (w *streamWatcher) run(ctx context.Context, ddb *dynamodb.Client, interval time.Duration) error {
+	table, err := ddb.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(w.table)})
+	if err != nil {
+		return fmt.Errorf("describe table: %w", err)
+	}
+	if table.Table.LatestStreamArn == nil {
+		return errors.New("table has no stream enabled")
+	}
+	w.streamARN = *table.Table.LatestStreamArn
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var refreshed time.Time
+	first := true
+	for {
+		if time.Since(refreshed) >= shardRefreshInterval {
+			if err := w.refresh(ctx, first); err != nil {
+				w.hub.logger.Error("failed to describe DynamoDB stream", "error", err, "table", w.table)
+			} else {
+				refreshed, first = time.Now(), false
+			}
+		}
+
+		for id, s := range w.shards {
+			if s.iterator == "" {
+				continue
+			}
+			closed, err := w.poll(ctx, s)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				w.hub.logger.Warn("failed to read DynamoDB stream shard", "error", err, "table", w.table, "shard", id)
+				// Resume from the last record once the shards are refreshed
+				s.iterator = ""
+				refreshed = time.Time{}
+			}
+			if closed {
+				// The shard's children are new shards
+				refreshed = time.Time{}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh opens iterators for new shards and for shards whose iterator was
+// lost. On the first refresh, only open shards are read, from their latest
+// record; shards found later were split off since and are read in full.
+func (w *streamWatcher) refresh(ctx context.Context, first bool) error {
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(w.streamARN)}
+	for {
+		out, err := w.client.DescribeStream(ctx, input)
+		if err != nil {
+			return err
+		}
+
+		for _, desc := range out.StreamDescription.Shards {
+			id := aws.ToString(desc.ShardId)
+			s, ok := w.shards[id]
+			if !ok {
+				s = &shard{}
+				w.shards[id] = s
+				if first && desc.SequenceNumberRange != nil && desc.SequenceNumberRange.EndingSequenceNumber != nil {
+					s.done = true
+				}
+			}
+			if s.done || s.iterator != "" {
+				continue
+			}
+
+			iteratorInput := &dynamodbstreams.GetShardIteratorInput{
+				StreamArn: aws.String(w.streamARN),
+				ShardId:   aws.String(id),
+			}
+			switch {
+			case s.last != "":
+				iteratorInput.ShardIteratorType = streamtypes.ShardIteratorTypeAfterSequenceNumber
+				iteratorInput.SequenceNumber = aws.String(s.last)
+			case first:
+				iteratorInput.ShardIteratorType = streamtypes.ShardIteratorTypeLatest
+			default:
+				iteratorInput.ShardIteratorType = streamtypes.ShardIteratorTypeTrimHorizon
+			}
+			iterator, err := w.client.GetShardIterator(ctx, iteratorInput)
+			if err != nil {
+				return fmt.Errorf("get iterator for shard %s: %w", id, err)
+			}
+			s.iterator = aws.ToString(iterator.ShardIterator)
+		}
+
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			return nil
+		}
+		input.ExclusiveStartShardId = out.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// poll publishes the shard's new records and reports whether it has been
+// read to its end.
+func (w *streamWatcher) poll(ctx context.Context, s *shard) (closed bool, err error) {
+	out, err := w.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+		ShardIterator: aws.String(s.iterator),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, record := range out.Records {
+		if record.Dynamodb == nil {
+			continue
+		}
+		s.last = aws.ToString(record.Dynamodb.SequenceNumber)
+		change, err := w.streamRecord(record.Dynamodb)
+		if err != nil {
+			w.hub.logger.Warn("skipping unreadable DynamoDB stream record", "error", err, "table", w.table)
+			continue
+		}
+		w.hub.Publish(TopicDynamoDB, string(record.EventName), change)
+	}
+
+	if out.NextShardIterator == nil {
+		s.iterator, s.done = "", true
+		return true, nil
+	}
+	s.iterator = *out.NextShardIterator
+	return false, nil
+}
+
+// streamRecord converts a record's attribute values to plain JSON values.
+func (w *streamWatcher) streamRecord(record *streamtypes.StreamRecord) (StreamRecord, error) {
+	change := StreamRecord{Table: w.table}
+	for _, image := range []struct {
+		from map[string]streamtypes.AttributeValue
+		to   *map[string]any
+	}{
+		{record.Keys, &change.Keys},
+		{record.NewImage, &change.NewImage},
+		{record.OldImage, &change.OldImage},
+	} {
+		if image.from == nil {
+			continue
+		}
+		values, err := attributevalue.FromDynamoDBStreamsMap(image.from)
+		if err != nil {
+			return StreamRecord{}, err
+		}
+		if err := attributevalue.UnmarshalMap(values, image.to); err != nil {
+			return StreamRecord{}, err
+		}
+	}
+	return change, nil
+}
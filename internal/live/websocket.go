@@ -0,0 +1,312 @@
+package live
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/drain"
+)
+
+// Protocol is the WebSocket subprotocol clients must offer, if they offer
+// any. Browsers can't set headers on a WebSocket, so they send their token
+// as a second subprotocol, "bearer.<token>".
+const Protocol = "live"
+
+const (
+	// websocketGUID is appended to the client's key to prove the server
+	// speaks WebSocket (RFC 6455 section 1.3).
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// maxMessageSize bounds the messages clients may send.
+	maxMessageSize = 64 * 1024
+	// pingInterval is how often clients are pinged to keep the connection,
+	// and any proxies on the way, alive.
+	pingInterval = 30 * time.Second
+	// readTimeout is how long a client may send nothing, not even a pong.
+	readTimeout = 2 * pingInterval
+	// writeTimeout bounds writing a frame to a client.
+	writeTimeout = 10 * time.Second
+)
+
+// Frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close codes.
+const (
+	closeNormal          uint16 = 1000
+	closeGoingAway       uint16 = 1001
+	closeProtocolError   uint16 = 1002
+	closePolicyViolation uint16 = 1008
+	closeTooBig          uint16 = 1009
+)
+
+// ErrNotWebSocket is returned by Upgrade for requests that don't ask for a
+// WebSocket.
+var ErrNotWebSocket = errors.New("not a WebSocket handshake")
+
+var errMessageTooBig = errors.New("message too big")
+
+// Conn is a server-side WebSocket connection. Writes may be made
+// concurrently with reads.
+type Conn struct {
+	conn net.Conn
+	r    io.Reader
+
+	writeMu   sync.Mutex // Serializes frames and protects closeSent
+	closeSent bool
+}
+
+// Upgrade completes the WebSocket handshake for r and takes over its
+// connection. On error nothing has been written to w, so the caller can
+// still respond.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet || !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return nil, ErrNotWebSocket
+	}
+	if version := r.Header.Get("Sec-WebSocket-Version"); version != "13" {
+		return nil, fmt.Errorf("unsupported WebSocket version %q", version)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, errors.New("invalid Sec-WebSocket-Key")
+	}
+	var protocol string
+	if offered := headerTokens(r.Header, "Sec-WebSocket-Protocol"); len(offered) > 0 {
+		if !slices.Contains(offered, Protocol) {
+			return nil, fmt.Errorf("client doesn't offer the %q subprotocol", Protocol)
+		}
+		protocol = Protocol
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("take over connection: %w", err)
+	}
+	// The server's timeouts are for requests, not long-lived connections,
+	// and shutdown closes them through the hub rather than waiting
+	conn.SetDeadline(time.Time{})
+	drain.LongLived(r.Context())
+
+	header := w.Header().Clone()
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", acceptKey(key))
+	if protocol != "" {
+		header.Set("Sec-WebSocket-Protocol", protocol)
+	}
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	header.Write(rw)
+	rw.WriteString("\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("write handshake: %w", err)
+	}
+
+	// Bytes the client sent after the handshake may already be buffered
+	return &Conn{conn: conn, r: rw.Reader}, nil
+}
+
+// ReadMessage returns the next text or binary message from the client,
+// answering pings along the way. It returns io.EOF once the client closes
+// the connection.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := closeNormal
+			if len(payload) >= 2 {
+				code = binary.BigEndian.Uint16(payload)
+			}
+			c.Close(code, "")
+			return nil, io.EOF
+		case opText, opBinary:
+			if message != nil {
+				return nil, c.fail("new message before the last one finished")
+			}
+			message = append([]byte{}, payload...)
+		case opContinuation:
+			if message == nil {
+				return nil, c.fail("continuation without a message")
+			}
+			message = append(message, payload...)
+		default:
+			return nil, c.fail(fmt.Sprintf("unknown opcode %d", opcode))
+		}
+
+		if len(message) > maxMessageSize {
+			c.Close(closeTooBig, errMessageTooBig.Error())
+			return nil, errMessageTooBig
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// WriteJSON sends v to the client as a text message.
+func (c *Conn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(opText, data)
+}
+
+// Ping sends a ping, which the client answers with a pong.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// Close sends a close frame with code and reason, unless one was already
+// sent, and closes the connection.
+func (c *Conn) Close(code uint16, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	c.writeFrame(opClose, append(payload, reason...))
+	return c.conn.Close()
+}
+
+// readFrame reads one frame and unmasks its payload.
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.fail("reserved bits set")
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, c.fail("client frames must be masked")
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= opClose && (length > 125 || !fin) {
+		return false, 0, nil, c.fail("invalid control frame")
+	}
+	if length > maxMessageSize {
+		c.Close(closeTooBig, errMessageTooBig.Error())
+		return false, 0, nil, errMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends payload in a single unmasked frame.
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// fail closes the connection for a protocol violation and returns it as an
+// error.
+func (c *Conn) fail(problem string) error {
+	c.Close(closeProtocolError, problem)
+	return fmt.Errorf("websocket protocol error: %s", problem)
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value for the client's key.
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerTokens returns the comma-separated values of the header name.
+func headerTokens(header http.Header, name string) []string {
+	var tokens []string
+	for _, value := range header.Values(name) {
+		for token := range strings.SplitSeq(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// headerHasToken reports whether the header name lists token, ignoring case.
+func headerHasToken(header http.Header, name, token string) bool {
+	return slices.ContainsFunc(headerTokens(header, name), func(t string) bool {
+		return strings.EqualFold(t, token)
+	})
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/pmollerus23/go-aws-server/internal/apikeys"
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// APIKeyHeader is the header machine clients send their API key in.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyVerifier defines the interface for verifying API keys.
+type APIKeyVerifier interface {
+	Verify(ctx context.Context, key string) (*apikeys.Key, error)
+}
+
+// AuthenticateAPIKey is middleware that authenticates requests carrying an
+// X-API-Key header as the key's machine user, with the key's roles. Other
+// requests are authenticated by authenticate, e.g. with a bearer token.
+func AuthenticateAPIKey(keys APIKeyVerifier, authenticate func(http.Handler) http.Handler, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fallback := authenticate(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented := r.Header.Get(APIKeyHeader)
+			if presented == "" {
+				fallback.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := keys.Verify(r.Context(), presented)
+			if err != nil {
+				if !errors.Is(err, apikeys.ErrInvalidKey) {
+					logger.ErrorContext(r.Context(), "API key verification failed", "error", err)
+					problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				logger.WarnContext(r.Context(), "invalid API key",
+					"path", r.URL.Path,
+					"method", r.Method,
+				)
+				problem.Error(w, r, "Unauthorized: invalid API key", http.StatusUnauthorized)
+				return
+			}
+
+			user := &auth.User{
+				ID:       "apikey:" + key.ID,
+				Username: key.Name,
+				Roles:    key.Roles,
+				IsAdmin:  slices.Contains(key.Roles, "admin"),
+			}
+
+			logUser(r.Context(), user.ID)
+			logger.InfoContext(r.Context(), "request authenticated",
+				"user_id", user.ID,
+				"api_key", key.Name,
+				"path", r.URL.Path,
+				"method", r.Method,
+			)
+
+			next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+		})
+	}
+}
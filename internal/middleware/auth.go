@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
 )
 
 // AuthService defines the interface for authentication services.
@@ -14,29 +15,29 @@ type AuthService interface {
 	ValidateToken(ctx context.Context, token string) (*auth.Claims, error)
 }
 
-// Authenticate is middleware that validates JWT tokens from AWS Cognito.
+// Authenticate is middleware that validates JWT tokens from the identity provider.
 func Authenticate(authService AuthService, logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract token from Authorization header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				logger.Warn("missing authorization header",
+				logger.WarnContext(r.Context(), "missing authorization header",
 					"path", r.URL.Path,
 					"method", r.Method,
 				)
-				http.Error(w, "Unauthorized: missing authorization header", http.StatusUnauthorized)
+				problem.Error(w, r, "Unauthorized: missing authorization header", http.StatusUnauthorized)
 				return
 			}
 
 			// Check for Bearer token format
 			parts := strings.SplitN(authHeader, " ", 2)
 			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				logger.Warn("invalid authorization header format",
+				logger.WarnContext(r.Context(), "invalid authorization header format",
 					"path", r.URL.Path,
 					"method", r.Method,
 				)
-				http.Error(w, "Unauthorized: invalid authorization header format", http.StatusUnauthorized)
+				problem.Error(w, r, "Unauthorized: invalid authorization header format", http.StatusUnauthorized)
 				return
 			}
 
@@ -45,12 +46,12 @@ func Authenticate(authService AuthService, logger *slog.Logger) func(http.Handle
 			// Validate token
 			claims, err := authService.ValidateToken(r.Context(), token)
 			if err != nil {
-				logger.Warn("token validation failed",
+				logger.WarnContext(r.Context(), "token validation failed",
 					"error", err,
 					"path", r.URL.Path,
 					"method", r.Method,
 				)
-				http.Error(w, "Unauthorized: invalid token", http.StatusUnauthorized)
+				problem.Error(w, r, "Unauthorized: invalid token", http.StatusUnauthorized)
 				return
 			}
 
@@ -61,17 +62,39 @@ func Authenticate(authService AuthService, logger *slog.Logger) func(http.Handle
 				Username: claims.Username,
 				Roles:    claims.Roles,
 				IsAdmin:  claims.IsAdmin,
+				Provider: claims.Provider,
+				Name:     claims.Name,
+				Scopes:   claims.Scopes,
+				Client:   claims.Client,
+
+				ImpersonatedBy: claims.ImpersonatedBy,
 			}
 
-			// Add user to context
+			// Add user and token to context. ID and impersonation tokens
+			// can't act on behalf of the user at the identity provider, so
+			// handlers that need an access token reject them.
 			ctx := auth.WithUser(r.Context(), user)
+			if claims.TokenUse != "id" && claims.ImpersonatedBy == "" {
+				ctx = auth.WithAccessToken(ctx, token)
+			}
 
-			logger.Info("request authenticated",
-				"user_id", user.ID,
-				"email", user.Email,
-				"path", r.URL.Path,
-				"method", r.Method,
-			)
+			logUser(r.Context(), user.ID)
+			if user.ImpersonatedBy != "" {
+				logger.WarnContext(r.Context(), "request authenticated by impersonation",
+					"user_id", user.ID,
+					"email", user.Email,
+					"impersonated_by", user.ImpersonatedBy,
+					"path", r.URL.Path,
+					"method", r.Method,
+				)
+			} else {
+				logger.InfoContext(r.Context(), "request authenticated",
+					"user_id", user.ID,
+					"email", user.Email,
+					"path", r.URL.Path,
+					"method", r.Method,
+				)
+			}
 
 			// Call next handler with updated context
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -79,27 +102,34 @@ func Authenticate(authService AuthService, logger *slog.Logger) func(http.Handle
 	}
 }
 
-// RequirePermission is middleware that checks if the authenticated user has a specific permission.
-func RequirePermission(permission auth.Permission, logger *slog.Logger) func(http.Handler) http.Handler {
+// RequirePermission is middleware that checks if the authenticated user has
+// a specific permission through the roles in roles.
+func RequirePermission(permission auth.Permission, roles auth.RoleStore, logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, err := auth.GetUser(r.Context())
 			if err != nil {
-				logger.Warn("no user in context for permission check",
+				logger.WarnContext(r.Context(), "no user in context for permission check",
 					"permission", permission,
 					"path", r.URL.Path,
 				)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
-			if !user.HasPermission(permission) {
-				logger.Warn("user lacks required permission",
+			allowed, err := user.HasPermission(r.Context(), permission, roles)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to load role permissions", "error", err)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				logger.WarnContext(r.Context(), "user lacks required permission",
 					"user_id", user.ID,
 					"permission", permission,
 					"path", r.URL.Path,
 				)
-				http.Error(w, "Forbidden: insufficient permissions", http.StatusForbidden)
+				problem.Error(w, r, "Forbidden: insufficient permissions", http.StatusForbidden)
 				return
 			}
 
@@ -114,12 +144,12 @@ func RequireRole(roles ...string) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, err := auth.GetUser(r.Context())
 			if err != nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
 			if !user.HasAnyRole(roles...) {
-				http.Error(w, "Forbidden: insufficient role", http.StatusForbidden)
+				problem.Error(w, r, "Forbidden: insufficient role", http.StatusForbidden)
 				return
 			}
 
@@ -134,19 +164,84 @@ func RequireAdmin(logger *slog.Logger) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			user, err := auth.GetUser(r.Context())
 			if err != nil {
-				logger.Warn("no user in context for admin check",
+				logger.WarnContext(r.Context(), "no user in context for admin check",
 					"path", r.URL.Path,
 				)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
 			if !user.IsAdmin {
-				logger.Warn("non-admin user attempted admin access",
+				logger.WarnContext(r.Context(), "non-admin user attempted admin access",
 					"user_id", user.ID,
 					"path", r.URL.Path,
 				)
-				http.Error(w, "Forbidden: admin access required", http.StatusForbidden)
+				problem.Error(w, r, "Forbidden: admin access required", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope is middleware that checks if a service client's access token
+// was granted any of the specified OAuth scopes. Service clients carry
+// scopes instead of groups; requests for users pass, since their tokens
+// only carry the identity provider's own scopes.
+func RequireScope(logger *slog.Logger, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := auth.GetUser(r.Context())
+			if err != nil {
+				logger.WarnContext(r.Context(), "no user in context for scope check",
+					"path", r.URL.Path,
+				)
+				problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !user.Client {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, scope := range scopes {
+				if user.HasScope(scope) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			logger.WarnContext(r.Context(), "token lacks required scope",
+				"user_id", user.ID,
+				"scopes", scopes,
+				"path", r.URL.Path,
+			)
+			problem.Error(w, r, "Forbidden: insufficient scope", http.StatusForbidden)
+		})
+	}
+}
+
+// RequireUser is middleware that rejects service clients' tokens, which act
+// for no user, on routes only users may call.
+func RequireUser(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := auth.GetUser(r.Context())
+			if err != nil {
+				logger.WarnContext(r.Context(), "no user in context for user check",
+					"path", r.URL.Path,
+				)
+				problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if user.Client {
+				logger.WarnContext(r.Context(), "service client attempted user-only access",
+					"client_id", user.ID,
+					"path", r.URL.Path,
+				)
+				problem.Error(w, r, "Forbidden: route requires a user", http.StatusForbidden)
 				return
 			}
 
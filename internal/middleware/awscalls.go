@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/awscalls"
+)
+
+// AWSCalls creates a middleware that counts the AWS SDK calls each request
+// makes. With a budget above zero, calls past the budget fail and the
+// request is answered with a 500 explaining why, whatever the handler
+// would have written. Requests that exceed the budget are logged with a
+// breakdown of the calls they made.
+func AWSCalls(budget int, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counter := awscalls.NewCounter(budget)
+			bw := &budgetWriter{ResponseWriter: w, counter: counter}
+
+			h.ServeHTTP(bw, r.WithContext(awscalls.NewContext(r.Context(), counter)))
+
+			if counter.Exceeded() {
+				logger.WarnContext(r.Context(), "request exceeded AWS call budget",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"aws_call_budget", budget,
+					"aws_operations", counter.Operations(),
+				)
+			}
+		})
+	}
+}
+
+// budgetWriter replaces the handler's response once the request has run
+// out of AWS calls, since handlers report the resulting SDK errors as
+// generic failures.
+type budgetWriter struct {
+	http.ResponseWriter
+	counter     *awscalls.Counter
+	wroteHeader bool
+	replaced    bool
+}
+
+func (bw *budgetWriter) WriteHeader(code int) {
+	if bw.wroteHeader {
+		return
+	}
+	bw.wroteHeader = true
+
+	if code >= http.StatusInternalServerError && bw.counter.Exceeded() {
+		bw.replaced = true
+		http.Error(bw.ResponseWriter,
+			fmt.Sprintf("Internal Server Error: the request exceeded its budget of %d AWS calls", bw.counter.Limit()),
+			http.StatusInternalServerError)
+		return
+	}
+	bw.ResponseWriter.WriteHeader(code)
+}
+
+func (bw *budgetWriter) Write(b []byte) (int, error) {
+	if !bw.wroteHeader {
+		bw.WriteHeader(http.StatusOK)
+	}
+	if bw.replaced {
+		return len(b), nil
+	}
+	return bw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (bw *budgetWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// AWSRole creates a middleware that sends a request's S3 and DynamoDB calls
+// as the role its X-AWS-Role header names, so one deployment can reach the
+// buckets and tables of several accounts. It must run after authentication:
+// the user needs the aws:assume:<name> permission for the role, or the
+// request is rejected with 403. Requests naming a role that isn't in roles
+// are rejected with 400; requests without the header use the server's own
+// identity.
+func AWSRole(roles map[string]config.AssumeRole, permissions auth.RoleStore, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := strings.ToLower(strings.TrimSpace(r.Header.Get(awsclients.RoleHeader)))
+			if name == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if _, ok := roles[name]; !ok {
+				logger.InfoContext(r.Context(), "rejected request for unknown AWS role", "role", name)
+				problem.Error(w, r, "Bad Request: unknown AWS role in "+awsclients.RoleHeader, http.StatusBadRequest)
+				return
+			}
+
+			user, err := auth.GetUser(r.Context())
+			if err != nil {
+				logger.WarnContext(r.Context(), "no user in context for AWS role selection", "role", name, "path", r.URL.Path)
+				problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			allowed, err := user.HasPermission(r.Context(), auth.AssumeRolePermission(name), permissions)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to load role permissions", "error", err)
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				logger.WarnContext(r.Context(), "user may not assume AWS role",
+					"user_id", user.ID,
+					"role", name,
+					"path", r.URL.Path,
+				)
+				problem.Error(w, r, "Forbidden: not allowed to use AWS role "+name, http.StatusForbidden)
+				return
+			}
+
+			h.ServeHTTP(w, r.WithContext(awsclients.WithRole(r.Context(), name)))
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/respcache"
+)
+
+// CacheResponses creates a middleware that tags successful GET responses
+// with an ETag, answers requests whose If-None-Match matches it with 304
+// Not Modified, and serves the response from store for ttl. A ttl of 0
+// only tags responses.
+//
+// Cached responses are shared by every caller, so it must only wrap
+// handlers whose response doesn't depend on who is asking.
+func CacheResponses(store respcache.Store, ttl time.Duration, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			key := responseCacheKey(r.URL.Path, r.URL.RawQuery, r.Header.Get("Accept"), awsclients.RoleFromContext(r.Context()))
+			if ttl > 0 {
+				if entry, ok := store.Get(key); ok {
+					w.Header().Set("X-Cache", "HIT")
+					writeCachedResponse(w, r, entry)
+					return
+				}
+			}
+
+			buf := &bufferedResponse{header: make(http.Header)}
+			h.ServeHTTP(buf, r)
+
+			if buf.Status() != http.StatusOK {
+				buf.flush(w)
+				return
+			}
+
+			sum := sha256.Sum256(buf.body.Bytes())
+			entry := &respcache.Entry{
+				Header:    buf.header,
+				Body:      buf.body.Bytes(),
+				ETag:      `"` + hex.EncodeToString(sum[:16]) + `"`,
+				ExpiresAt: time.Now().Add(ttl),
+			}
+			if ttl > 0 {
+				store.Set(key, entry)
+				w.Header().Set("X-Cache", "MISS")
+				logger.DebugContext(r.Context(), "cached response", "path", r.URL.Path, "ttl", ttl)
+			}
+			writeCachedResponse(w, r, entry)
+		})
+	}
+}
+
+// InvalidateResponses creates a middleware that drops the cached responses
+// for paths, with any query, after a successful mutating request, so the
+// change is visible on the next read.
+func InvalidateResponses(store respcache.Store, paths ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &responseRecorder{ResponseWriter: w}
+			h.ServeHTTP(rec, r)
+
+			if status := rec.Status(); status >= 200 && status < 300 {
+				for _, path := range paths {
+					store.DeletePrefix(path + "?")
+				}
+			}
+		})
+	}
+}
+
+// responseCacheKey identifies a cached response. Responses vary by Accept
+// and by the AWS role the request is sent as, so they are part of the key.
+func responseCacheKey(path, query, accept, role string) string {
+	return path + "?" + query + "\x00" + accept + "\x00" + role
+}
+
+// writeCachedResponse writes entry, or 304 Not Modified if the request's
+// If-None-Match names its ETag.
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, entry *respcache.Entry) {
+	header := w.Header()
+	for name, values := range entry.Header {
+		header[name] = values
+	}
+	header.Set("ETag", entry.ETag)
+	// Clients revalidate on every use, which costs a 304 at most.
+	header.Set("Cache-Control", "private, no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), entry.ETag) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(entry.Body)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison RFC 9110 requires for it.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedResponse holds a response until the handler is done with it.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// Status returns the response's status code, which is 200 if the handler
+// wrote nothing.
+func (b *bufferedResponse) Status() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+// flush writes the buffered response to w as is.
+func (b *bufferedResponse) flush(w http.ResponseWriter) {
+	header := w.Header()
+	for name, values := range b.header {
+		header[name] = values
+	}
+	w.WriteHeader(b.Status())
+	w.Write(b.body.Bytes())
+}
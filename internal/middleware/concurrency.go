@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// ConcurrencyLimit creates a middleware that serves at most limit requests
+// at a time and sheds the rest with 503, rather than queueing them, so a
+// burst of slow requests can't hold memory and connections other requests
+// need. Requests to the exempt paths, such as health checks, are always
+// served. A limit of 0 serves everything.
+func ConcurrencyLimit(limit int, logger *slog.Logger, exempt ...string) func(http.Handler) http.Handler {
+	if limit <= 0 {
+		return func(h http.Handler) http.Handler { return h }
+	}
+
+	exemptPaths := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exemptPaths[path] = true
+	}
+	slots := make(chan struct{}, limit)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exemptPaths[r.URL.Path] {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				h.ServeHTTP(w, r)
+			default:
+				logger.WarnContext(r.Context(), "shed request over concurrency limit",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"limit", limit,
+				)
+				w.Header().Set("Retry-After", "1")
+				problem.Error(w, r, "Service Unavailable: too many concurrent requests", http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Deprecated is middleware that announces a route is deprecated, following
+// RFC 9745 and RFC 8594: the Deprecation header gives the time it was
+// deprecated, the Sunset header the time it will be removed, if sunset isn't
+// zero, and the Link header points to successor. Path wildcards in successor,
+// such as {bucketName}, are filled in from the request.
+func Deprecated(since, sunset time.Time, successor string) func(http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	var sunsetHeader string
+	if !sunset.IsZero() {
+		sunsetHeader = sunset.UTC().Format(http.TimeFormat)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			header.Set("Deprecation", deprecation)
+			if sunsetHeader != "" {
+				header.Set("Sunset", sunsetHeader)
+			}
+			header.Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successorPath(successor, r)))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// successorPath fills in the wildcards in pattern with the request's path
+// values.
+func successorPath(pattern string, r *http.Request) string {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		name, ok := strings.CutPrefix(segment, "{")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSuffix(name, "}")
+		if rest, ok := strings.CutSuffix(name, "..."); ok {
+			segments[i] = r.PathValue(rest)
+			continue
+		}
+		segments[i] = url.PathEscape(r.PathValue(name))
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/features"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// Features creates a middleware that puts the flags in effect when a
+// request arrives in its context, for features.Enabled, so a flag changing
+// midway can't split a request's behavior.
+func Features(flags *features.Flags) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r.WithContext(features.NewContext(r.Context(), flags.Current())))
+		})
+	}
+}
+
+// RequireFeature creates a middleware that answers 404 while the named flag
+// is off in the request's context, so a gated endpoint looks like it
+// doesn't exist.
+func RequireFeature(name string, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !features.Enabled(r.Context(), name) {
+				logger.InfoContext(r.Context(), "rejected request for disabled feature", "feature", name, "path", r.URL.Path)
+				problem.Error(w, r, "Not Found", http.StatusNotFound)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
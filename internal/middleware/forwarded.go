@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/netip"
+	"net/url"
+
+	"github.com/pmollerus23/go-aws-server/internal/forwarded"
+)
+
+// Forwarded creates a middleware that, for requests from trusted proxies,
+// replaces the request's RemoteAddr with the client's address from
+// X-Forwarded-For, so logging, login throttling, and auditing see the
+// client rather than the load balancer, and notes the scheme from
+// X-Forwarded-Proto for forwarded.Secure. With forceHTTPS, requests the
+// proxies received over plain HTTP are redirected to HTTPS.
+func Forwarded(proxies forwarded.Proxies, forceHTTPS bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(proxies) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req, ok := proxies.Resolve(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if forceHTTPS && req.Proto == "http" {
+				target := url.URL{Scheme: "https", Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+				status := http.StatusPermanentRedirect
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					status = http.StatusMovedPermanently
+				}
+				http.Redirect(w, r, target.String(), status)
+				return
+			}
+
+			r = r.WithContext(forwarded.NewContext(r.Context(), req))
+			// The client's port isn't forwarded
+			r.RemoteAddr = netip.AddrPortFrom(req.Client, 0).String()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
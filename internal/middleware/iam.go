@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// SigV4Verifier defines the interface for verifying AWS Signature Version 4
+// signatures.
+type SigV4Verifier interface {
+	Verify(r *http.Request) (*awsclients.Credential, error)
+}
+
+// AuthenticateIAM is middleware that authenticates requests signed with AWS
+// Signature Version 4 as the access key's user, with the key's roles. Other
+// requests are authenticated by authenticate, e.g. with a bearer token.
+func AuthenticateIAM(verifier SigV4Verifier, authenticate func(http.Handler) http.Handler, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fallback := authenticate(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !awsclients.IsSigV4(r) {
+				fallback.ServeHTTP(w, r)
+				return
+			}
+
+			cred, err := verifier.Verify(r)
+			if err != nil {
+				if !errors.Is(err, awsclients.ErrInvalidSignature) && !errors.Is(err, awsclients.ErrUnknownAccessKey) {
+					logger.ErrorContext(r.Context(), "SigV4 verification failed", "error", err)
+					problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				logger.WarnContext(r.Context(), "invalid SigV4 signature",
+					"error", err,
+					"path", r.URL.Path,
+					"method", r.Method,
+				)
+				problem.Error(w, r, "Unauthorized: invalid AWS signature", http.StatusUnauthorized)
+				return
+			}
+
+			user := &auth.User{
+				ID:       "iam:" + cred.UserID,
+				Username: cred.UserID,
+				Roles:    cred.Roles,
+				IsAdmin:  slices.Contains(cred.Roles, "admin"),
+			}
+
+			logUser(r.Context(), user.ID)
+			logger.InfoContext(r.Context(), "request authenticated",
+				"user_id", user.ID,
+				"access_key_id", cred.AccessKeyID,
+				"path", r.URL.Path,
+				"method", r.Method,
+			)
+
+			next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+		})
+	}
+}
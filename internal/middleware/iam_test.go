@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+)
+
+// fakeVerifier is a SigV4Verifier returning a fixed result.
+type fakeVerifier struct {
+	cred *awsclients.Credential
+	err  error
+}
+
+func (f fakeVerifier) Verify(r *http.Request) (*awsclients.Credential, error) {
+	return f.cred, f.err
+}
+
+func TestAuthenticateIAM(t *testing.T) {
+	const sigV4 = "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/execute-api/aws4_request, SignedHeaders=host;x-amz-date, Signature=0"
+
+	tests := []struct {
+		name          string
+		authorization string
+		verifier      fakeVerifier
+		wantStatus    int
+		wantUser      *auth.User // nil when the handler mustn't run
+	}{
+		{
+			name:          "bearer token falls through",
+			authorization: "Bearer token",
+			verifier:      fakeVerifier{err: errors.New("verifier must not be called")},
+			wantStatus:    http.StatusTeapot,
+		},
+		{
+			name:       "no authorization falls through",
+			verifier:   fakeVerifier{err: errors.New("verifier must not be called")},
+			wantStatus: http.StatusTeapot,
+		},
+		{
+			name:          "invalid signature",
+			authorization: sigV4,
+			verifier:      fakeVerifier{err: fmt.Errorf("%w: signature doesn't match", awsclients.ErrInvalidSignature)},
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "unknown access key",
+			authorization: sigV4,
+			verifier:      fakeVerifier{err: awsclients.ErrUnknownAccessKey},
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "key lookup failed",
+			authorization: sigV4,
+			verifier:      fakeVerifier{err: errors.New("dynamodb unavailable")},
+			wantStatus:    http.StatusInternalServerError,
+		},
+		{
+			name:          "valid signature",
+			authorization: sigV4,
+			verifier:      fakeVerifier{cred: &awsclients.Credential{AccessKeyID: "AKIDEXAMPLE", UserID: "batch", Roles: []string{"editor"}}},
+			wantStatus:    http.StatusOK,
+			wantUser:      &auth.User{ID: "iam:batch", Username: "batch"},
+		},
+		{
+			name:          "valid signature of an admin",
+			authorization: sigV4,
+			verifier:      fakeVerifier{cred: &awsclients.Credential{AccessKeyID: "AKIDEXAMPLE", UserID: "ops", Roles: []string{"editor", "admin"}}},
+			wantStatus:    http.StatusOK,
+			wantUser:      &auth.User{ID: "iam:ops", Username: "ops", IsAdmin: true},
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fallback := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *auth.User
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, err := auth.GetUser(r.Context())
+				if err != nil {
+					t.Errorf("GetUser: %v", err)
+				}
+				got = user
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/items", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			AuthenticateIAM(tt.verifier, fallback, logger)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantUser == nil {
+				if got != nil {
+					t.Fatalf("handler ran as %+v, want it not to run", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("handler didn't run")
+			}
+			if got.ID != tt.wantUser.ID || got.Username != tt.wantUser.Username || got.IsAdmin != tt.wantUser.IsAdmin {
+				t.Errorf("user = %+v, want %+v", got, tt.wantUser)
+			}
+			if len(got.Roles) != len(tt.verifier.cred.Roles) {
+				t.Errorf("user roles = %v, want %v", got.Roles, tt.verifier.cred.Roles)
+			}
+		})
+	}
+}
@@ -1,29 +1,104 @@
 package middleware
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/awscalls"
 )
 
-// Logging creates a middleware that logs HTTP requests and responses.
+// loggedUserKey holds where authentication middleware notes the user ID for
+// the access log. Authentication runs inside Logging and adds the user to a
+// derived context, which Logging never sees.
+type loggedUserKey struct{}
+
+// Logging creates a middleware that logs HTTP requests and responses. The
+// completed line has the response's status and size and the authenticated
+// user's ID; lines carry the request ID through the logger's handler.
 func Logging(logger *slog.Logger) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			logger.Info("request started",
+			logger.InfoContext(r.Context(), "request started",
 				"method", r.Method,
 				"path", r.URL.Path,
 				"remote_addr", r.RemoteAddr,
 			)
 
-			h.ServeHTTP(w, r)
+			var userID string
+			rec := &responseRecorder{ResponseWriter: w}
+			h.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), loggedUserKey{}, &userID)))
 
-			logger.Info("request completed",
+			attrs := []any{
 				"method", r.Method,
 				"path", r.URL.Path,
+				"status", rec.Status(),
+				"bytes", rec.bytes,
 				"duration_ms", time.Since(start).Milliseconds(),
-			)
+			}
+			if userID != "" {
+				attrs = append(attrs, "user_id", userID)
+			}
+			if counter := awscalls.FromContext(r.Context()); counter != nil {
+				attrs = append(attrs, "aws_calls", counter.Calls())
+			}
+			logger.InfoContext(r.Context(), "request completed", attrs...)
 		})
 	}
 }
+
+// logUser notes the ID of the user ctx's request is authenticated as for
+// the access log.
+func logUser(ctx context.Context, userID string) {
+	if p, ok := ctx.Value(loggedUserKey{}).(*string); ok {
+		*p = userID
+	}
+}
+
+// loggedUser returns the user ID noted for the access log of ctx's
+// request, or "" if it isn't authenticated.
+func loggedUser(ctx context.Context) string {
+	if p, ok := ctx.Value(loggedUserKey{}).(*string); ok {
+		return *p
+	}
+	return ""
+}
+
+// responseRecorder captures the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// Status returns the response's status code, which is 200 if the handler
+// wrote nothing.
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/readonly"
+)
+
+// ReadOnly creates a middleware that rejects mutating requests with 503 while
+// read-only mode is enabled. Requests to the exempt paths are always allowed,
+// so users can still log in and admins can turn read-only mode off.
+func ReadOnly(sw *readonly.Switch, logger *slog.Logger, exempt ...string) func(http.Handler) http.Handler {
+	exemptPaths := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exemptPaths[path] = true
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			status := sw.Status()
+			if !status.Enabled || exemptPaths[r.URL.Path] {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			logger.InfoContext(r.Context(), "rejected request in read-only mode", "method", r.Method, "path", r.URL.Path)
+
+			message := "Service Unavailable: the server is in read-only mode"
+			if status.Reason != "" {
+				message += " (" + status.Reason + ")"
+			}
+			w.Header().Set("Retry-After", "60")
+			problem.Error(w, r, message, http.StatusServiceUnavailable)
+		})
+	}
+}
@@ -1,32 +1,69 @@
 package middleware
 
 import (
-	"fmt"
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
 )
 
-// PanicRecovery creates a middleware that recovers from panics.
-func PanicRecovery(logger *slog.Logger) func(http.Handler) http.Handler {
+// representationHeaders describe a response body, so they are dropped when
+// a panic replaces the body the handler meant to write with a problem.
+var representationHeaders = []string{
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Content-Range",
+	"ETag",
+	"Last-Modified",
+}
+
+// PanicRecovery creates a middleware that recovers from panics, counting
+// them in panics, which may be nil. If the handler hasn't started the
+// response, the client gets a 500 problem with the request ID. Otherwise the
+// status has been sent and a 500 can't follow it, so the connection is
+// aborted instead, leaving the client with a truncated response rather than
+// one that looks complete.
+func PanicRecovery(logger *slog.Logger, panics *atomic.Int64) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &responseRecorder{ResponseWriter: w}
 			defer func() {
-				if err := recover(); err != nil {
-					logger.Error("panic recovered",
-						"error", err,
-						"method", r.Method,
-						"path", r.URL.Path,
-						"remote_addr", r.RemoteAddr,
-						"stack", string(debug.Stack()),
-					)
+				err := recover()
+				if err == nil {
+					return
+				}
+				if err == http.ErrAbortHandler {
+					// A deliberate abort, not a bug
+					panic(err)
+				}
+				if panics != nil {
+					panics.Add(1)
+				}
 
-					// Send 500 error to client
-					w.WriteHeader(http.StatusInternalServerError)
-					fmt.Fprintf(w, `{"error":"Internal server error"}`)
+				written := rec.status != 0
+				logger.ErrorContext(r.Context(), "panic recovered",
+					"error", err,
+					"method", r.Method,
+					"path", r.URL.Path,
+					"remote_addr", r.RemoteAddr,
+					"response_started", written,
+					"stack", string(debug.Stack()),
+				)
+
+				if written {
+					panic(http.ErrAbortHandler)
+				}
+				header := w.Header()
+				for _, name := range representationHeaders {
+					header.Del(name)
 				}
+				header.Set("Cache-Control", "no-store")
+				problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
 			}()
-			h.ServeHTTP(w, r)
+			h.ServeHTTP(rec, r)
 		})
 	}
 }
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/latency"
+)
+
+// SlowRequests creates a middleware that records each request's duration
+// in tracker under its route and logs a warning for requests slower than
+// the tracker's threshold. It must wrap the ServeMux directly, which sets
+// the route pattern on the request it is given. A nil tracker records
+// nothing.
+func SlowRequests(tracker *latency.Tracker, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if tracker == nil {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// WebSockets and event streams stay open as long as their
+			// clients do
+			if r.Header.Get("Upgrade") != "" || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			h.ServeHTTP(w, r)
+			duration := time.Since(start)
+
+			// Unmatched requests share one route, so 404 scans can't
+			// grow the stats without bound
+			route := r.Pattern
+			if route == "" {
+				route = "unmatched"
+			}
+			if !tracker.Record(route, duration) {
+				return
+			}
+
+			attrs := []any{
+				"route", route,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"duration_ms", duration.Milliseconds(),
+				"threshold_ms", tracker.Threshold().Milliseconds(),
+			}
+			if userID := loggedUser(r.Context()); userID != "" {
+				attrs = append(attrs, "user_id", userID)
+			}
+			logger.WarnContext(r.Context(), "slow request", attrs...)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName names the tracer of the spans this package starts itself.
+const tracerName = "github.com/pmollerus23/go-aws-server/internal/middleware"
+
+// Tracing creates a middleware that traces requests with OpenTelemetry,
+// continuing the trace a request's traceparent header carries. A request's
+// span is named after the route mux matches, such as
+// "GET /api/v1/aws/dynamodb/records", which the sampler matches against
+// per-route overrides. Requests no route matches share one span name.
+func Tracing(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return otelhttp.NewMiddleware("http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if _, route := mux.Handler(r); route != "" {
+				return route
+			}
+			return "unmatched"
+		}),
+	)
+}
+
+// TraceUser creates a middleware that traces an authenticated request on
+// its own when an override forces tracing for its user but the request's
+// span wasn't sampled, which happens because the user isn't known when that
+// span starts. The new trace links to the request's span. It must run after
+// authentication.
+func TraceUser(sampler *tracing.Sampler) func(http.Handler) http.Handler {
+	tracer := otel.Tracer(tracerName)
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := auth.GetUser(r.Context())
+			if err != nil || trace.SpanContextFromContext(r.Context()).IsSampled() || !sampler.Forced(r.Pattern, user.ID) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, span := tracer.Start(r.Context(), r.Pattern,
+				trace.WithNewRoot(),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithLinks(trace.LinkFromContext(r.Context())),
+				trace.WithAttributes(tracing.UserAttribute.String(user.ID)),
+			)
+			defer span.End()
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
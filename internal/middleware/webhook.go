@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+	"github.com/pmollerus23/go-aws-server/internal/webhooks"
+)
+
+// VerifyWebhook creates a middleware that only passes on webhook deliveries
+// whose HMAC signature verifies. The webhook is named by the route's {name}
+// path value. With no webhooks configured, every delivery gets 503.
+func VerifyWebhook(verifier *webhooks.Verifier, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if verifier == nil {
+				problem.Error(w, r, "Webhooks are not configured", http.StatusServiceUnavailable)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				problem.Error(w, r, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			name := r.PathValue("name")
+			if err := verifier.Verify(r.Context(), name, r.Header, body); err != nil {
+				switch {
+				case errors.Is(err, webhooks.ErrUnknownWebhook):
+					problem.Error(w, r, "Not Found", http.StatusNotFound)
+				case errors.Is(err, webhooks.ErrInvalidSignature):
+					logger.WarnContext(r.Context(), "rejected webhook delivery",
+						"webhook", name,
+						"error", err,
+						"remote_addr", r.RemoteAddr,
+					)
+					problem.Error(w, r, "Unauthorized: invalid signature", http.StatusUnauthorized)
+				default:
+					logger.ErrorContext(r.Context(), "failed to verify webhook delivery", "webhook", name, "error", err)
+					problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/webhooks"
+)
+
+// fakeSecrets is a webhooks.SecretReader holding secrets by ID.
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	secret, ok := f[aws.ToString(params.SecretId)]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(secret)}, nil
+}
+
+// signWebhook sets the headers of r, a delivery of body, signed with
+// secret at signedAt.
+func signWebhook(r *http.Request, secret, body string, signedAt time.Time) {
+	ts := strconv.FormatInt(signedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + body))
+	r.Header.Set(webhooks.TimestampHeader, ts)
+	r.Header.Set(config.DefaultWebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	const (
+		secret = "webhook-secret"
+		body   = `{"order":42}`
+	)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := config.WebhooksConfig{Endpoints: map[string]config.WebhookEndpoint{
+		"orders":  {SecretID: "webhooks/orders", SignatureHeader: config.DefaultWebhookSignatureHeader},
+		"billing": {SecretID: "webhooks/missing", SignatureHeader: config.DefaultWebhookSignatureHeader},
+	}}
+	now := time.Now()
+	replayed := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/orders", nil)
+	signWebhook(replayed, secret, body, now)
+
+	tests := []struct {
+		name       string
+		webhook    string
+		header     http.Header
+		body       string
+		wantStatus int
+	}{
+		{"valid", "orders", replayed.Header, body, http.StatusAccepted},
+		{"replayed", "orders", replayed.Header, body, http.StatusUnauthorized},
+		{"wrong secret", "orders", func() http.Header {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			signWebhook(r, "other-secret", body, now)
+			return r.Header
+		}(), body, http.StatusUnauthorized},
+		{"modified body", "orders", func() http.Header {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			signWebhook(r, secret, body, now.Add(time.Second))
+			return r.Header
+		}(), `{"order":43}`, http.StatusUnauthorized},
+		{"expired timestamp", "orders", func() http.Header {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			signWebhook(r, secret, body, now.Add(-10*time.Minute))
+			return r.Header
+		}(), body, http.StatusUnauthorized},
+		{"unknown webhook", "shipping", replayed.Header, body, http.StatusNotFound},
+		{"unreadable secret", "billing", replayed.Header, body, http.StatusInternalServerError},
+	}
+
+	// The cases share a verifier, so the second delivery of the first
+	// case's is a replay
+	verifier := webhooks.New(cfg, fakeSecrets{"webhooks/orders": secret}, logger)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("read body: %v", err)
+				}
+				received = string(b)
+				w.WriteHeader(http.StatusAccepted)
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/"+tt.webhook, strings.NewReader(tt.body))
+			r.SetPathValue("name", tt.webhook)
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+			w := httptest.NewRecorder()
+			VerifyWebhook(verifier, logger)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusAccepted && received != tt.body {
+				t.Errorf("handler read body %q, want %q", received, tt.body)
+			}
+			if tt.wantStatus != http.StatusAccepted && received != "" {
+				t.Errorf("handler ran for a rejected delivery")
+			}
+		})
+	}
+}
+
+func TestVerifyWebhookNotConfigured(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran without webhooks configured")
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/orders", strings.NewReader("{}"))
+	r.SetPathValue("name", "orders")
+	w := httptest.NewRecorder()
+	VerifyWebhook(nil, logger)(next).ServeHTTP(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
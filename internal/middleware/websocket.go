@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// websocketTokenPrefix marks the WebSocket subprotocol that carries a
+// bearer token.
+const websocketTokenPrefix = "bearer."
+
+// WebSocketToken is middleware that lets browsers authenticate WebSocket
+// handshakes, which can't carry an Authorization header. The token is
+// offered as the subprotocol "bearer.<token>" and moved into the
+// Authorization header, so the usual authentication applies.
+func WebSocketToken() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var protocols []string
+			for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+				for protocol := range strings.SplitSeq(value, ",") {
+					protocol = strings.TrimSpace(protocol)
+					if token, ok := strings.CutPrefix(protocol, websocketTokenPrefix); ok {
+						r.Header.Set("Authorization", "Bearer "+token)
+						continue
+					}
+					protocols = append(protocols, protocol)
+				}
+			}
+			// The token isn't a protocol the server can select
+			r.Header.Del("Sec-WebSocket-Protocol")
+			if len(protocols) > 0 {
+				r.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
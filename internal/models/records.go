@@ -2,7 +2,10 @@ package models
 
 // DynamoDBRecord represents a record to be stored in DynamoDB.
 type DynamoDBRecord struct {
-	ID        int    `json:"id" dynamodbav:"id" example:"1"`
+	ID        string `json:"id,omitempty" dynamodbav:"id" example:"01HZX3V8Q4K7M2N9P5R6S8T0W1"`
 	Name      string `json:"name" dynamodbav:"name" example:"Sample Record"`
-	UpdatedAt int64  `json:"updated_at" dynamodbav:"updated_at" example:"1699999999"`
+	CreatedAt int64  `json:"created_at,omitempty" dynamodbav:"created_at,omitempty" example:"1699999999"`
+	UpdatedAt int64  `json:"updated_at,omitempty" dynamodbav:"updated_at,omitempty" example:"1699999999"`
+	// ExpiresAt is set on records created in sandbox mode; they are deleted after it passes.
+	ExpiresAt int64 `json:"expires_at,omitempty" dynamodbav:"expires_at,omitempty" example:"1700086399"`
 }
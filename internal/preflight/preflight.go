@@ -0,0 +1,360 @@
+// Package preflight checks at startup that the AWS resources the server
+// depends on exist and that it may use them, so a misconfiguration stops
+// the server with an actionable message instead of failing the first
+// request that needs the resource.
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	cognito "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	awsclients "github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// checkTimeout bounds each check, so an unreachable endpoint doesn't hold
+// up startup for the SDK's full retry schedule.
+const checkTimeout = 10 * time.Second
+
+// ErrFailed is returned by Run when any check fails.
+var ErrFailed = errors.New("preflight checks failed")
+
+// check verifies one dependency. missing and denied tell the operator what
+// to fix when the resource doesn't exist or the server may not use it.
+type check struct {
+	name    string
+	missing string
+	denied  string
+	run     func(ctx context.Context) error
+}
+
+// Result is the outcome of one check, safe to show operators: it holds
+// what to fix, not the AWS error, which can name accounts and policies.
+type Result struct {
+	Check string `json:"check"`
+	// Status is "ok", "missing", "denied", or "failed".
+	Status string `json:"status"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// Run checks every dependency cfg configures, concurrently, and logs each
+// failure with what to fix. It returns ErrFailed if any check fails.
+func Run(ctx context.Context, logger *slog.Logger, cfg *config.Config, clients *awsclients.Clients) error {
+	checks := checks(cfg, clients)
+	failures := runChecks(ctx, checks)
+
+	failed := 0
+	for i, err := range failures {
+		c := checks[i]
+		if err == nil {
+			continue
+		}
+		failed++
+		logger.Error("preflight check failed", "check", c.name, "fix", c.fix(err), "error", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d failed, see the log for what to fix, or start with --skip-preflight", ErrFailed, failed, len(checks))
+	}
+
+	logger.Info("preflight checks passed", "checks", len(checks))
+	return nil
+}
+
+// Probe runs the same checks as Run on a running server, with the
+// credentials in ctx, and reports the outcome of each. Failures are logged
+// with their errors.
+func Probe(ctx context.Context, logger *slog.Logger, cfg *config.Config, clients *awsclients.Clients) []Result {
+	checks := checks(cfg, clients)
+	failures := runChecks(ctx, checks)
+
+	results := make([]Result, len(checks))
+	for i, err := range failures {
+		c := checks[i]
+		results[i] = Result{Check: c.name, Status: "ok"}
+		if err == nil {
+			continue
+		}
+		switch status(err) {
+		case http.StatusNotFound:
+			results[i].Status = "missing"
+		case http.StatusForbidden:
+			results[i].Status = "denied"
+		default:
+			results[i].Status = "failed"
+		}
+		results[i].Fix = c.fix(err)
+		logger.WarnContext(ctx, "AWS probe failed", "check", c.name, "error", err)
+	}
+	return results
+}
+
+// runChecks runs checks concurrently, each within checkTimeout, and returns
+// their errors in the same order.
+func runChecks(ctx context.Context, checks []check) []error {
+	failures := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			failures[i] = c.run(ctx)
+		}()
+	}
+	wg.Wait()
+	return failures
+}
+
+// fix returns what the operator should do about err.
+func (c check) fix(err error) string {
+	switch status(err) {
+	case http.StatusNotFound:
+		if c.missing != "" {
+			return c.missing
+		}
+	case http.StatusForbidden:
+		if c.denied != "" {
+			return c.denied
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "AWS didn't answer in time; check network access to the AWS endpoints, including proxies and VPC endpoints"
+	}
+	return "check the AWS credentials and region the server runs with"
+}
+
+// status classifies err as a missing resource (404), denied access (403),
+// or neither (0).
+func status(err error) int {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ResourceNotFoundException", "NoSuchBucket", "NotFound", "UserPoolNotFound", "QueueDoesNotExist", "AWS.SimpleQueueService.NonExistentQueue":
+			return http.StatusNotFound
+		case "AccessDenied", "AccessDeniedException", "NotAuthorizedException", "UnrecognizedClientException", "Forbidden":
+			return http.StatusForbidden
+		}
+	}
+	// Errors to HEAD requests have no body, so no code, only a status
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch code := respErr.HTTPStatusCode(); code {
+		case http.StatusNotFound, http.StatusForbidden:
+			return code
+		}
+	}
+	return 0
+}
+
+// checks returns the checks for the dependencies cfg configures.
+func checks(cfg *config.Config, clients *awsclients.Clients) []check {
+	var checks []check
+
+	if cfg.Auth.Provider == config.AuthProviderCognito {
+		poolID, clientID := cfg.Cognito.UserPoolID, cfg.Cognito.ClientID
+		checks = append(checks,
+			check{
+				name:    "cognito user pool",
+				missing: fmt.Sprintf("user pool %q doesn't exist in this region; check AWS_COGNITO_USER_POOL_ID and AWS_REGION", poolID),
+				denied:  fmt.Sprintf("allow cognito-idp:DescribeUserPool on user pool %q", poolID),
+				run: func(ctx context.Context) error {
+					_, err := clients.Cognito.DescribeUserPool(ctx, &cognito.DescribeUserPoolInput{
+						UserPoolId: aws.String(poolID),
+					})
+					return err
+				},
+			},
+			check{
+				name:    "cognito app client",
+				missing: fmt.Sprintf("app client %q doesn't exist in user pool %q; check AWS_COGNITO_CLIENT_ID", clientID, poolID),
+				denied:  fmt.Sprintf("allow cognito-idp:DescribeUserPoolClient on user pool %q", poolID),
+				run: func(ctx context.Context) error {
+					_, err := clients.Cognito.DescribeUserPoolClient(ctx, &cognito.DescribeUserPoolClientInput{
+						UserPoolId: aws.String(poolID),
+						ClientId:   aws.String(clientID),
+					})
+					return err
+				},
+			},
+		)
+	}
+
+	if cfg.AWS.RecordsStore == config.RecordsStoreDynamoDB {
+		table := cfg.AWS.RecordsTable
+		checks = append(checks, check{
+			name:    "dynamodb records table",
+			missing: fmt.Sprintf("table %q doesn't exist in this region; create it or set DYNAMODB_RECORDS_TABLE", table),
+			denied:  fmt.Sprintf("allow dynamodb:DescribeTable on table %q", table),
+			run: func(ctx context.Context) error {
+				result, err := clients.DynamoDB.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+					TableName: aws.String(table),
+				})
+				if err != nil {
+					return err
+				}
+				switch result.Table.TableStatus {
+				case types.TableStatusActive, types.TableStatusUpdating:
+					return nil
+				}
+				return fmt.Errorf("table is %s", result.Table.TableStatus)
+			},
+		})
+	}
+
+	checks = append(checks, check{
+		name:   "s3",
+		denied: "allow s3:ListAllMyBuckets, which the bucket list endpoints need",
+		run: func(ctx context.Context) error {
+			_, err := clients.S3.ListBuckets(ctx, &s3.ListBucketsInput{MaxBuckets: aws.Int32(1)})
+			return err
+		},
+	})
+
+	// Buckets the server reads or writes on its own, rather than ones
+	// clients name
+	var buckets []string
+	if cfg.AWS.SupportBundleBucket != "" {
+		buckets = append(buckets, cfg.AWS.SupportBundleBucket)
+	}
+	for _, site := range cfg.AWS.Sites {
+		buckets = append(buckets, site.Bucket)
+	}
+	slices.Sort(buckets)
+	for _, bucket := range slices.Compact(buckets) {
+		checks = append(checks, check{
+			name:    "s3 bucket " + bucket,
+			missing: fmt.Sprintf("bucket %q doesn't exist; check SUPPORT_BUNDLE_BUCKET and S3_SITES", bucket),
+			denied:  fmt.Sprintf("allow s3:ListBucket on bucket %q", bucket),
+			run: func(ctx context.Context) error {
+				_, err := clients.S3.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+				return err
+			},
+		})
+	}
+
+	// Queues the SQS consumer reads from and dead-letters to
+	for _, queue := range []struct{ name, url string }{
+		{"SQS_CONSUMER_QUEUE_URL", cfg.Consumer.QueueURL},
+		{"SQS_CONSUMER_DLQ_URL", cfg.Consumer.DeadLetterQueueURL},
+	} {
+		if queue.url == "" || cfg.Consumer.QueueURL == "" {
+			continue
+		}
+		checks = append(checks, check{
+			name:    "sqs queue " + queue.url,
+			missing: fmt.Sprintf("queue %q doesn't exist; check %s", queue.url, queue.name),
+			denied:  fmt.Sprintf("allow sqs:GetQueueAttributes, and the consumer's sqs:ReceiveMessage, sqs:DeleteMessage, and sqs:SendMessage, on queue %q", queue.url),
+			run: func(ctx context.Context) error {
+				_, err := clients.SQS.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+					QueueUrl:       aws.String(queue.url),
+					AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+				})
+				return err
+			},
+		})
+	}
+
+	// Event bus domain events are published to
+	if cfg.Events.BusName != "" {
+		checks = append(checks, check{
+			name:    "eventbridge bus " + cfg.Events.BusName,
+			missing: fmt.Sprintf("event bus %q doesn't exist; check EVENTS_BUS_NAME", cfg.Events.BusName),
+			denied:  fmt.Sprintf("allow events:DescribeEventBus and events:PutEvents on event bus %q", cfg.Events.BusName),
+			run: func(ctx context.Context) error {
+				_, err := clients.EventBridge.DescribeEventBus(ctx, &eventbridge.DescribeEventBusInput{Name: aws.String(cfg.Events.BusName)})
+				return err
+			},
+		})
+	}
+
+	if workgroup := cfg.AWS.Athena.Workgroup; workgroup != "" {
+		checks = append(checks, check{
+			name:    "athena workgroup " + workgroup,
+			missing: fmt.Sprintf("Athena workgroup %q doesn't exist in this region; check ATHENA_WORKGROUP", workgroup),
+			denied:  fmt.Sprintf("allow athena:GetWorkGroup, and athena:StartQueryExecution, athena:GetQueryExecution, athena:GetQueryResults, and athena:StopQueryExecution, on workgroup %q", workgroup),
+			run: func(ctx context.Context) error {
+				_, err := clients.Athena.GetWorkGroup(ctx, &athena.GetWorkGroupInput{WorkGroup: aws.String(workgroup)})
+				return err
+			},
+		})
+	}
+
+	if keyID := cfg.AWS.KMSKeyID; keyID != "" {
+		checks = append(checks, check{
+			name:    "kms key",
+			missing: fmt.Sprintf("KMS key %q doesn't exist in this region; check KMS_KEY_ID", keyID),
+			denied:  fmt.Sprintf("allow kms:DescribeKey, kms:Encrypt, kms:Decrypt, and kms:GenerateDataKey on key %q", keyID),
+			run: func(ctx context.Context) error {
+				_, err := clients.KMS.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: aws.String(keyID)})
+				return err
+			},
+		})
+	}
+
+	// Streams pushed to live clients
+	for _, stream := range cfg.Live.KinesisStreams {
+		checks = append(checks, check{
+			name:    "kinesis stream " + stream,
+			missing: fmt.Sprintf("stream %q doesn't exist in this region; check LIVE_KINESIS_STREAMS", stream),
+			denied:  fmt.Sprintf("allow kinesis:DescribeStreamSummary, kinesis:ListShards, kinesis:GetShardIterator, and kinesis:GetRecords on stream %q", stream),
+			run: func(ctx context.Context) error {
+				_, err := clients.Kinesis.DescribeStreamSummary(ctx, &kinesis.DescribeStreamSummaryInput{StreamName: aws.String(stream)})
+				return err
+			},
+		})
+	}
+
+	// Queue finished Textract jobs are announced on
+	if queueURL := cfg.AWS.Textract.QueueURL; queueURL != "" {
+		checks = append(checks, check{
+			name:    "textract queue " + queueURL,
+			missing: fmt.Sprintf("queue %q doesn't exist; check TEXTRACT_QUEUE_URL", queueURL),
+			denied:  fmt.Sprintf("allow sqs:GetQueueAttributes, sqs:ReceiveMessage, and sqs:DeleteMessage on queue %q", queueURL),
+			run: func(ctx context.Context) error {
+				_, err := clients.SQS.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+					QueueUrl:       aws.String(queueURL),
+					AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+				})
+				return err
+			},
+		})
+	}
+
+	// Table image analyses are stored in
+	if cfg.Images.Store == config.ImageResultsDynamoDB {
+		table := cfg.Images.Table
+		checks = append(checks, check{
+			name:    "image analysis table " + table,
+			missing: fmt.Sprintf("table %q doesn't exist; check IMAGE_ANALYSIS_TABLE", table),
+			denied:  fmt.Sprintf("allow dynamodb:DescribeTable and dynamodb:PutItem on table %q", table),
+			run: func(ctx context.Context) error {
+				_, err := clients.DynamoDB.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(table)})
+				return err
+			},
+		})
+	}
+
+	return checks
+}
@@ -0,0 +1,74 @@
+// Package problem writes error responses as RFC 7807 problem details, so
+// clients can parse every error the same way.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pmollerus23/go-aws-server/internal/requestid"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// Details is an RFC 7807 problem details object.
+type Details struct {
+	// Type identifies the kind of problem. It is about:blank, meaning the
+	// status says all there is to say about it, unless the problem is one
+	// clients are expected to handle specially.
+	Type   string `json:"type" example:"about:blank"`
+	Title  string `json:"title" example:"Bad Request"`
+	Status int    `json:"status" example:"400"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty" example:"validation failed"`
+	// Instance is the path of the request that failed.
+	Instance  string `json:"instance,omitempty" example:"/api/v1/items"`
+	RequestID string `json:"request_id,omitempty" example:"01J9ZX3K8Q2W4E6R8T0Y2U4I6O"`
+	// Problems maps each invalid field to what is wrong with it, for
+	// validation errors.
+	Problems map[string]string `json:"problems,omitempty"`
+}
+
+// New returns the problem for a request that failed with status, explained
+// by detail. A detail that only repeats the status text is left out.
+func New(r *http.Request, status int, detail string) Details {
+	title := http.StatusText(status)
+	if detail == title {
+		detail = ""
+	}
+	return Details{
+		Type:      "about:blank",
+		Title:     title,
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: requestid.FromContext(r.Context()),
+	}
+}
+
+// Write writes p, which is Details or a struct embedding it to add
+// extension members, as the response with status. Like http.Error, it leaves
+// any headers already set, other than the content type and length, in place.
+func Write(w http.ResponseWriter, status int, p any) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error replies to r with a problem for status, explained by detail. It is a
+// drop-in replacement for http.Error.
+func Error(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	Write(w, status, New(r, status, detail))
+}
+
+// Validation replies to r with a 400 problem listing the invalid fields in
+// problems.
+func Validation(w http.ResponseWriter, r *http.Request, problems map[string]string) {
+	p := New(r, http.StatusBadRequest, "validation failed")
+	p.Problems = problems
+	Write(w, p.Status, p)
+}
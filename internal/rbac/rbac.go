@@ -0,0 +1,174 @@
+// Package rbac stores the permissions each role grants in DynamoDB, so they
+// can be changed without redeploying. Roles are the groups users belong to;
+// this package only decides what each role may do.
+//
+// Every role is read from a table keyed by name and cached for a minute, so
+// changes reach other server instances within that time.
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+)
+
+// cacheTTL is how long the roles are trusted without reading the table again.
+const cacheTTL = time.Minute
+
+// ErrRoleNotFound is returned when deleting a role that doesn't exist.
+var ErrRoleNotFound = errors.New("role not found")
+
+// Role is the set of permissions granted to users with a role.
+type Role struct {
+	Name        string            `json:"name" dynamodbav:"name" example:"editor"`
+	Description string            `json:"description,omitempty" dynamodbav:"description,omitempty" example:"Can edit items"`
+	Permissions []auth.Permission `json:"permissions" dynamodbav:"permissions" example:"items:read,items:write"`
+	UpdatedBy   string            `json:"updated_by,omitempty" dynamodbav:"updated_by,omitempty"`
+	UpdatedAt   time.Time         `json:"updated_at" dynamodbav:"updated_at"`
+}
+
+// Service manages roles in one table. It implements auth.RoleStore.
+type Service struct {
+	client *dynamodb.Client
+	table  string
+	logger *slog.Logger
+
+	// mu serializes loads and guards the cached roles.
+	mu       sync.Mutex
+	roles    map[string]Role
+	loadedAt time.Time
+}
+
+// New returns a Service, or nil if roles aren't stored in DynamoDB.
+func New(client *dynamodb.Client, table string, logger *slog.Logger) *Service {
+	if table == "" {
+		return nil
+	}
+	return &Service{
+		client: client,
+		table:  table,
+		logger: logger,
+	}
+}
+
+// RolePermissions returns the permissions role grants, or none for roles
+// not in the table.
+func (s *Service) RolePermissions(ctx context.Context, role string) ([]auth.Permission, error) {
+	roles, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return roles[role].Permissions, nil
+}
+
+// List returns every role, sorted by name.
+func (s *Service) List(ctx context.Context) ([]Role, error) {
+	roles, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]Role, 0, len(roles))
+	for _, role := range roles {
+		list = append(list, role)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Put creates a role or replaces its permissions.
+func (s *Service) Put(ctx context.Context, role Role) (*Role, error) {
+	role.UpdatedAt = time.Now().UTC()
+
+	item, err := attributevalue.MarshalMap(role)
+	if err != nil {
+		return nil, fmt.Errorf("marshal role: %w", err)
+	}
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      item,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("put role to %s: %w", s.table, err)
+	}
+
+	s.invalidate()
+	s.logger.Info("role updated", "role", role.Name, "permissions", role.Permissions, "updated_by", role.UpdatedBy)
+	return &role, nil
+}
+
+// Delete removes a role. Users keep the role's group but it grants nothing.
+func (s *Service) Delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(s.table),
+		Key:                 map[string]types.AttributeValue{"name": &types.AttributeValueMemberS{Value: name}},
+		ConditionExpression: aws.String("attribute_exists(#name)"),
+		// name is a reserved word.
+		ExpressionAttributeNames: map[string]string{"#name": "name"},
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrRoleNotFound
+		}
+		return fmt.Errorf("delete role from %s: %w", s.table, err)
+	}
+
+	s.invalidate()
+	s.logger.Info("role deleted", "role", name)
+	return nil
+}
+
+// load returns the cached roles, reading the table if they're stale.
+func (s *Service) load(ctx context.Context) (map[string]Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.roles != nil && time.Since(s.loadedAt) < cacheTTL {
+		return s.roles, nil
+	}
+
+	roles := make(map[string]Role)
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(s.table),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			if s.roles != nil {
+				// Keep authorizing with the last known roles.
+				s.logger.Warn("failed to reload roles, using cached roles", "error", err)
+				return s.roles, nil
+			}
+			return nil, fmt.Errorf("scan %s: %w", s.table, err)
+		}
+		var pageRoles []Role
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageRoles); err != nil {
+			return nil, fmt.Errorf("unmarshal roles: %w", err)
+		}
+		for _, role := range pageRoles {
+			roles[role.Name] = role
+		}
+	}
+
+	s.roles = roles
+	s.loadedAt = time.Now()
+	return roles, nil
+}
+
+// invalidate makes the next lookup read the table.
+func (s *Service) invalidate() {
+	s.mu.Lock()
+	s.roles = nil
+	s.mu.Unlock()
+}
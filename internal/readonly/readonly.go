@@ -0,0 +1,133 @@
+// Package readonly provides a process-wide switch that puts the server into
+// read-only mode during migrations or incident containment.
+package readonly
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Sources of a read-only change.
+const (
+	SourceConfig = "config"
+	SourceSSM    = "ssm"
+	SourceAdmin  = "admin"
+)
+
+// Status describes the current read-only state.
+type Status struct {
+	Enabled   bool      `json:"enabled"`
+	Reason    string    `json:"reason,omitempty" example:"Database migration in progress"`
+	Source    string    `json:"source" enums:"config,ssm,admin"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// Switch holds the read-only state. It is safe for concurrent use.
+type Switch struct {
+	mu     sync.RWMutex
+	status Status
+}
+
+// New creates a switch with its initial state taken from configuration.
+func New(enabled bool, reason string) *Switch {
+	return &Switch{
+		status: Status{
+			Enabled:   enabled,
+			Reason:    reason,
+			Source:    SourceConfig,
+			ChangedAt: time.Now(),
+		},
+	}
+}
+
+// Status returns the current state.
+func (s *Switch) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// Set changes the state and records where the change came from.
+func (s *Switch) Set(enabled bool, reason, source string) Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = Status{
+		Enabled:   enabled,
+		Reason:    reason,
+		Source:    source,
+		ChangedAt: time.Now(),
+	}
+	return s.status
+}
+
+// WatchSSM polls an SSM parameter and applies its value whenever it changes.
+// The value is "true" or "false", optionally followed by a colon and a reason
+// (e.g. "true:Database migration in progress"). Only changes are applied, so a
+// toggle through the admin endpoint sticks until the parameter is edited. It
+// returns immediately; polling stops when ctx is cancelled.
+func (s *Switch) WatchSSM(ctx context.Context, client *ssm.Client, name string, interval time.Duration, logger *slog.Logger) {
+	go func() {
+		var last string
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			value, err := parameterValue(ctx, client, name)
+			switch {
+			case err != nil:
+				if ctx.Err() == nil {
+					logger.Error("failed to read read-only SSM parameter", "error", err, "parameter", name)
+				}
+			case value != last:
+				last = value
+				enabled, reason, err := parseParameter(value)
+				if err != nil {
+					logger.Error("invalid read-only SSM parameter", "error", err, "parameter", name)
+					break
+				}
+				s.Set(enabled, reason, SourceSSM)
+				logger.Warn("read-only mode changed", "enabled", enabled, "reason", reason, "source", SourceSSM)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// parameterValue reads the parameter, treating a missing parameter as "false".
+func parameterValue(ctx context.Context, client *ssm.Client, name string) (string, error) {
+	result, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		var notFound *ssmtypes.ParameterNotFound
+		if errors.As(err, &notFound) {
+			return "false", nil
+		}
+		return "", err
+	}
+	return aws.ToString(result.Parameter.Value), nil
+}
+
+// parseParameter splits a parameter value into its flag and reason.
+func parseParameter(value string) (bool, string, error) {
+	flag, reason, _ := strings.Cut(value, ":")
+	enabled, err := strconv.ParseBool(strings.TrimSpace(flag))
+	if err != nil {
+		return false, "", err
+	}
+	return enabled, strings.TrimSpace(reason), nil
+}
@@ -0,0 +1,108 @@
+// Package requestid identifies each HTTP request so its log lines, and the
+// AWS calls it makes, can be correlated across services.
+//
+// The ID comes from the client's X-Request-ID header, or is generated. It
+// travels in the request context: log lines written with a context get a
+// request_id attribute through Handler, and AWS calls send it in the
+// X-Request-ID header and the User-Agent, which CloudTrail records.
+package requestid
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/pmollerus23/go-aws-server/internal/store"
+)
+
+// Header is the header request IDs are read from and returned in.
+const Header = "X-Request-ID"
+
+// maxLength bounds inbound IDs, which end up in every log line.
+const maxLength = 128
+
+type contextKey struct{}
+
+// New returns a new request ID.
+func New() string {
+	return store.NewULID()
+}
+
+// Valid reports whether an inbound request ID can be used as is: 1 to 128
+// letters, digits, and the characters - _ . : /
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Handler is a slog.Handler that adds the request ID in the context of each
+// record as a request_id attribute. Only records logged with a context,
+// e.g. with InfoContext, can carry one.
+type Handler struct {
+	slog.Handler
+}
+
+// NewHandler returns a Handler writing to h.
+func NewHandler(h slog.Handler) *Handler {
+	return &Handler{Handler: h}
+}
+
+// Handle adds the request ID to r and passes it on.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if id := FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a Handler whose records also have attrs.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a Handler whose attributes are in the group name.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name)}
+}
+
+// Propagate is an SDK API option that sends the request ID in the context
+// of every call with it, in the X-Request-ID header and as a request-id
+// entry in the User-Agent. Add it to aws.Config.APIOptions.
+func Propagate(stack *middleware.Stack) error {
+	// After the SDK's user agent middleware, which builds the header.
+	return stack.Build.Add(middleware.BuildMiddlewareFunc("PropagateRequestID",
+		func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+			if id := FromContext(ctx); id != "" {
+				if req, ok := in.Request.(*smithyhttp.Request); ok {
+					req.Header.Set(Header, id)
+					if ua := req.Header.Get("User-Agent"); ua != "" {
+						req.Header.Set("User-Agent", ua+" request-id/"+id)
+					}
+				}
+			}
+			return next.HandleBuild(ctx, in)
+		},
+	), middleware.After)
+}
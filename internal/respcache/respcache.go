@@ -0,0 +1,108 @@
+// Package respcache stores HTTP response bodies for a short time, so
+// repeated reads of slow-changing AWS listings don't call AWS each time.
+//
+// Entries live behind the Store interface. MemoryStore keeps them per
+// server instance; a shared backend such as Redis can implement Store to
+// share them across instances.
+package respcache
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response.
+type Entry struct {
+	Header http.Header
+	Body   []byte
+	// ETag is the strong entity tag of Body, quoted.
+	ETag      string
+	ExpiresAt time.Time
+}
+
+// Store holds cached responses by key.
+type Store interface {
+	// Get returns the unexpired entry for key.
+	Get(key string) (*Entry, bool)
+	// Set stores entry under key until entry.ExpiresAt.
+	Set(key string, entry *Entry)
+	// DeletePrefix removes the entries whose keys start with prefix.
+	DeletePrefix(prefix string)
+}
+
+// MemoryStore is a Store in memory holding at most a fixed number of
+// entries; the one expiring soonest is evicted to make room.
+type MemoryStore struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+// NewMemoryStore returns a MemoryStore holding up to maxEntries entries.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*Entry),
+	}
+}
+
+// Get returns the unexpired entry for key.
+func (s *MemoryStore) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.ExpiresAt) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return entry, true
+}
+
+// Set stores entry under key until entry.ExpiresAt.
+func (s *MemoryStore) Set(key string, entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= s.maxEntries {
+		s.evict()
+	}
+	s.entries[key] = entry
+}
+
+// DeletePrefix removes the entries whose keys start with prefix.
+func (s *MemoryStore) DeletePrefix(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// evict removes expired entries, or else the one expiring soonest. s.mu
+// must be held.
+func (s *MemoryStore) evict() {
+	now := time.Now()
+	var soonest string
+	for key, entry := range s.entries {
+		if !now.Before(entry.ExpiresAt) {
+			delete(s.entries, key)
+			continue
+		}
+		if soonest == "" || entry.ExpiresAt.Before(s.entries[soonest].ExpiresAt) {
+			soonest = key
+		}
+	}
+	if len(s.entries) >= s.maxEntries && soonest != "" {
+		delete(s.entries, soonest)
+	}
+}
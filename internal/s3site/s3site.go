@@ -0,0 +1,137 @@
+// Package s3site serves static websites straight from S3, choosing the
+// bucket and key prefix by the request's Host header.
+package s3site
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// indexDocument is served for paths that end in a slash.
+const indexDocument = "index.html"
+
+// Route creates a middleware that serves requests for the configured
+// hostnames from S3 and passes every other request to the wrapped handler.
+// Only GET and HEAD are allowed on site hosts.
+func Route(sites map[string]config.S3Site, client *s3.Client, logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if len(sites) == 0 {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			site, ok := sites[normalizeHost(r.Host)]
+			if !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				w.Header().Set("Allow", "GET, HEAD")
+				problem.Error(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+
+			serveObject(w, r, client, logger, site, objectKey(site, r.URL.Path))
+		})
+	}
+}
+
+// serveObject streams one object to the client.
+func serveObject(w http.ResponseWriter, r *http.Request, client *s3.Client, logger *slog.Logger, site config.S3Site, key string) {
+	result, err := client.GetObject(r.Context(), &s3.GetObjectInput{
+		Bucket: aws.String(site.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			problem.Error(w, r, "Not Found", http.StatusNotFound)
+			return
+		}
+		logger.Error("failed to get site object", "error", err, "bucket", site.Bucket, "key", key)
+		problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer result.Body.Close()
+
+	contentType := aws.ToString(result.ContentType)
+	if contentType == "" || contentType == "binary/octet-stream" || contentType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(path.Ext(key)); byExt != "" {
+			contentType = byExt
+		}
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if result.ContentLength != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*result.ContentLength, 10))
+	}
+	if result.ETag != nil {
+		w.Header().Set("ETag", *result.ETag)
+	}
+	if result.LastModified != nil {
+		w.Header().Set("Last-Modified", result.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if result.CacheControl != nil {
+		w.Header().Set("Cache-Control", *result.CacheControl)
+	}
+
+	if notModified(r, result) {
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, result.Body); err != nil {
+		logger.Error("failed to stream site object", "error", err, "bucket", site.Bucket, "key", key)
+	}
+}
+
+// notModified reports whether the client's cached copy is still current.
+func notModified(r *http.Request, result *s3.GetObjectOutput) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return result.ETag != nil && inm == *result.ETag
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && result.LastModified != nil {
+		t, err := time.Parse(http.TimeFormat, ims)
+		return err == nil && !result.LastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// objectKey maps a URL path to an object key under the site's prefix.
+// Paths are cleaned first so "..", "//", and similar can't escape the prefix.
+func objectKey(site config.S3Site, urlPath string) string {
+	key := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if key == "" || strings.HasSuffix(urlPath, "/") {
+		key = path.Join(key, indexDocument)
+	}
+	return site.Prefix + key
+}
+
+// normalizeHost lowercases a Host header and strips the port and any
+// trailing dot so it can be matched against configured hostnames.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
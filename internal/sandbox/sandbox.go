@@ -0,0 +1,293 @@
+// Package sandbox namespaces resources created in sandbox mode and deletes
+// them once they expire, so experiments don't leave debris behind.
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/models"
+	"github.com/pmollerus23/go-aws-server/internal/store"
+)
+
+// ExpiresTag is the tag holding a sandbox resource's expiry time in RFC 3339.
+const ExpiresTag = "sandbox-expires-at"
+
+// Sandbox names and expires resources. A nil *Sandbox means sandbox mode is
+// off: names are returned unchanged and nothing expires.
+type Sandbox struct {
+	prefix string
+	ttl    time.Duration
+}
+
+// New returns a Sandbox, or nil if sandbox mode is disabled.
+func New(cfg config.SandboxConfig) *Sandbox {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Sandbox{prefix: cfg.Prefix, ttl: cfg.TTL}
+}
+
+// Name adds the sandbox prefix to name unless it already has it.
+func (s *Sandbox) Name(name string) string {
+	if s == nil || strings.HasPrefix(name, s.prefix) {
+		return name
+	}
+	return s.prefix + name
+}
+
+// ExpiresAt returns when a resource created at now expires, or the zero time
+// if sandbox mode is off.
+func (s *Sandbox) ExpiresAt(now time.Time) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	return now.Add(s.ttl).UTC().Truncate(time.Second)
+}
+
+// Cleaner deletes expired sandbox buckets, tables, and records.
+type Cleaner struct {
+	prefix   string
+	s3       *s3.Client
+	dynamodb *dynamodb.Client
+	records  store.Repository[models.DynamoDBRecord]
+	logger   *slog.Logger
+}
+
+// NewCleaner creates a cleaner for resources named with the sandbox prefix.
+func NewCleaner(cfg config.SandboxConfig, s3Client *s3.Client, ddbClient *dynamodb.Client, records store.Repository[models.DynamoDBRecord], logger *slog.Logger) *Cleaner {
+	return &Cleaner{
+		prefix:   cfg.Prefix,
+		s3:       s3Client,
+		dynamodb: ddbClient,
+		records:  records,
+		logger:   logger,
+	}
+}
+
+// Start runs a cleanup immediately and then every interval. It returns
+// immediately; cleanups stop when ctx is cancelled.
+func (c *Cleaner) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			c.Clean(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Clean deletes everything that has expired. Failures are logged and the
+// resource is retried on the next run.
+func (c *Cleaner) Clean(ctx context.Context) {
+	now := time.Now()
+	c.logger.Info("sandbox cleanup started", "prefix", c.prefix)
+
+	buckets, err := c.cleanBuckets(ctx, now)
+	if err != nil {
+		c.logger.Error("sandbox bucket cleanup failed", "error", err)
+	}
+	tables, err := c.cleanTables(ctx, now)
+	if err != nil {
+		c.logger.Error("sandbox table cleanup failed", "error", err)
+	}
+	records, err := c.cleanRecords(ctx, now)
+	if err != nil {
+		c.logger.Error("sandbox record cleanup failed", "error", err)
+	}
+
+	c.logger.Info("sandbox cleanup finished",
+		"buckets_deleted", buckets,
+		"tables_deleted", tables,
+		"records_deleted", records,
+	)
+}
+
+// cleanBuckets empties and deletes expired sandbox buckets.
+func (c *Cleaner) cleanBuckets(ctx context.Context, now time.Time) (int, error) {
+	result, err := c.s3.ListBuckets(ctx, &s3.ListBucketsInput{
+		Prefix: aws.String(c.prefix),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("list buckets: %w", err)
+	}
+
+	deleted := 0
+	for _, bucket := range result.Buckets {
+		name := aws.ToString(bucket.Name)
+
+		tagging, err := c.s3.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{
+			Bucket: aws.String(name),
+		})
+		if err != nil {
+			// Buckets without tags were not created by sandbox mode.
+			continue
+		}
+		if !expired(bucketTag(tagging.TagSet, ExpiresTag), now) {
+			continue
+		}
+
+		if err := c.deleteBucket(ctx, name); err != nil {
+			c.logger.Error("failed to delete sandbox bucket", "error", err, "bucket", name)
+			continue
+		}
+		c.logger.Info("deleted expired sandbox bucket", "bucket", name)
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// deleteBucket deletes every object in a bucket and then the bucket itself.
+func (c *Cleaner) deleteBucket(ctx context.Context, name string) error {
+	paginator := s3.NewListObjectsV2Paginator(c.s3, &s3.ListObjectsV2Input{
+		Bucket: aws.String(name),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("list objects: %w", err)
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+
+		objects := make([]s3types.ObjectIdentifier, 0, len(page.Contents))
+		for _, obj := range page.Contents {
+			objects = append(objects, s3types.ObjectIdentifier{Key: obj.Key})
+		}
+		if _, err := c.s3.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(name),
+			Delete: &s3types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		}); err != nil {
+			return fmt.Errorf("delete objects: %w", err)
+		}
+	}
+
+	if _, err := c.s3.DeleteBucket(ctx, &s3.DeleteBucketInput{
+		Bucket: aws.String(name),
+	}); err != nil {
+		return fmt.Errorf("delete bucket: %w", err)
+	}
+	return nil
+}
+
+// cleanTables deletes expired sandbox tables.
+func (c *Cleaner) cleanTables(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	paginator := dynamodb.NewListTablesPaginator(c.dynamodb, &dynamodb.ListTablesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deleted, fmt.Errorf("list tables: %w", err)
+		}
+
+		for _, name := range page.TableNames {
+			if !strings.HasPrefix(name, c.prefix) {
+				continue
+			}
+
+			ok, err := c.tableExpired(ctx, name, now)
+			if err != nil {
+				c.logger.Error("failed to read sandbox table tags", "error", err, "table", name)
+				continue
+			}
+			if !ok {
+				continue
+			}
+
+			if _, err := c.dynamodb.DeleteTable(ctx, &dynamodb.DeleteTableInput{
+				TableName: aws.String(name),
+			}); err != nil {
+				c.logger.Error("failed to delete sandbox table", "error", err, "table", name)
+				continue
+			}
+			c.logger.Info("deleted expired sandbox table", "table", name)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// tableExpired reports whether a table's expiry tag has passed.
+func (c *Cleaner) tableExpired(ctx context.Context, name string, now time.Time) (bool, error) {
+	desc, err := c.dynamodb.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(name),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	tags, err := c.dynamodb.ListTagsOfResource(ctx, &dynamodb.ListTagsOfResourceInput{
+		ResourceArn: desc.Table.TableArn,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, tag := range tags.Tags {
+		if aws.ToString(tag.Key) == ExpiresTag {
+			return expired(aws.ToString(tag.Value), now), nil
+		}
+	}
+	return false, nil
+}
+
+// cleanRecords deletes expired sandbox records from the records table.
+func (c *Cleaner) cleanRecords(ctx context.Context, now time.Time) (int, error) {
+	records, err := c.records.Query(ctx, store.Query{
+		ReadOptions: store.ReadOptions{Fields: []string{"id"}},
+		Filters: []store.Filter{
+			{Field: "id", Op: store.OpBeginsWith, Value: c.prefix},
+			{Field: "expires_at", Op: store.OpLessEqual, Value: now.Unix()},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("query records: %w", err)
+	}
+
+	deleted := 0
+	var errs []error
+	for _, record := range records {
+		if err := c.records.Delete(ctx, record.ID); err != nil {
+			errs = append(errs, fmt.Errorf("delete record %s: %w", record.ID, err))
+			continue
+		}
+		deleted++
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// bucketTag returns the value of an S3 tag, or "" if it is missing.
+func bucketTag(tags []s3types.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.ToString(tag.Key) == key {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
+
+// expired reports whether an RFC 3339 expiry time has passed. Missing or
+// malformed values never expire, so untagged resources are left alone.
+func expired(value string, now time.Time) bool {
+	t, err := time.Parse(time.RFC3339, value)
+	return err == nil && !now.Before(t)
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/auth"
+	"github.com/pmollerus23/go-aws-server/internal/middleware"
+)
+
+// accessLevel classifies who may call a route.
+type accessLevel int
+
+const (
+	accessPublic accessLevel = iota + 1
+	accessAuthenticated
+	accessScope
+	accessPermission
+	accessAdmin
+)
+
+// access is the authorization a route requires.
+type access struct {
+	level      accessLevel
+	scope      string          // For accessScope
+	permission auth.Permission // For accessPermission
+}
+
+var (
+	// public routes need no token.
+	public = access{level: accessPublic}
+	// authenticated routes need a valid token for a user. Service clients'
+	// tokens, which act for no user, are rejected.
+	authenticated = access{level: accessAuthenticated}
+	// admin routes need a valid token for an admin.
+	admin = access{level: accessAdmin}
+)
+
+// requires returns the access for routes that need a valid token for a user
+// with permission.
+func requires(permission auth.Permission) access {
+	return access{level: accessPermission, permission: permission}
+}
+
+// requiresScope returns the access for routes that need a valid token for a
+// user, or for a service client granted scope.
+func requiresScope(scope string) access {
+	return access{level: accessScope, scope: scope}
+}
+
+// routeAccess is the authorization every route requires, keyed by its mux
+// pattern. The router applies the matching middleware, and the server
+// refuses to start if a route is missing here, so a new endpoint can't be
+// exposed without deciding who may call it.
+var routeAccess = map[string]access{
+	"GET /healthz":  public,
+	"GET /swagger/": public,
+	"/":             public, // React SPA
+
+	// Webhooks verify their own HMAC signatures
+	"POST /api/v1/webhooks/{name}": public,
+
+	// Auth and account
+	"POST /api/v1/auth/signup":              public,
+	"POST /api/v1/auth/confirm":             public,
+	"POST /api/v1/auth/login":               public,
+	"POST /api/v1/auth/mfa/respond":         public,
+	"POST /api/v1/auth/new-password":        public,
+	"POST /api/v1/auth/refresh":             public,
+	"POST /api/v1/auth/revoke":              public,
+	"POST /api/v1/auth/forgot-password":     public,
+	"POST /api/v1/auth/reset-password":      public,
+	"GET /api/v1/auth/password-policy":      public,
+	"GET /api/v1/auth/oauth/{provider}":     public,
+	"POST /api/v1/auth/oauth/token":         public,
+	"POST /api/v1/auth/token":               public,
+	"POST /api/v1/auth/change-password":     authenticated,
+	"PATCH /api/v1/me":                      authenticated,
+	"POST /api/v1/me/verify-email":          authenticated,
+	"GET /api/v1/me/devices":                authenticated,
+	"POST /api/v1/me/devices":               authenticated,
+	"DELETE /api/v1/me/devices/{deviceKey}": authenticated,
+
+	// Items
+	"GET /api/v1/items":              authenticated,
+	"POST /api/v1/items":             authenticated,
+	"PUT /api/v1/items/{id}":         authenticated,
+	"DELETE /api/v1/items/{id}":      authenticated,
+	"GET /api/v1/items/{id}/history": authenticated,
+
+	// Live updates
+	"GET /api/v1/ws": authenticated,
+
+	// AWS
+	"GET /api/v1/aws/whoami":                                      requires(auth.PermissionAWSRead),
+	"GET /api/v1/aws/summary":                                     authenticated,
+	"GET /api/v1/aws/s3/buckets":                                  requiresScope(auth.ScopeS3Read),
+	"POST /api/v1/aws/s3/buckets":                                 requiresScope(auth.ScopeS3Write),
+	"DELETE /api/v1/aws/s3/buckets/{bucketName}":                  requiresScope(auth.ScopeS3Write),
+	"GET /api/v1/aws/s3/buckets/{bucketName}/objects":             requiresScope(auth.ScopeS3Read),
+	"POST /api/v1/aws/s3/buckets/{bucketName}/objects":            requiresScope(auth.ScopeS3Write),
+	"DELETE /api/v1/aws/s3/buckets/{bucketName}/objects/{key...}": requiresScope(auth.ScopeS3Write),
+	"POST /api/v1/aws/s3/buckets/{bucketName}/analyze/{key...}":   requiresScope(auth.ScopeS3Read),
+	"GET /api/v1/aws/s3/buckets/{bucketName}/download/{key...}":   requiresScope(auth.ScopeS3Read),
+	"POST /api/v1/aws/s3/access":                                  requiresScope(auth.ScopeS3Write),
+	"GET /api/v1/aws/dynamodb/tables":                             requiresScope(auth.ScopeDynamoDBRead),
+	"GET /api/v1/aws/dynamodb/records":                            requiresScope(auth.ScopeDynamoDBRead),
+	"GET /api/v1/aws/dynamodb/records/count":                      requiresScope(auth.ScopeDynamoDBRead),
+	"GET /api/v1/aws/dynamodb/records/{id}":                       requiresScope(auth.ScopeDynamoDBRead),
+	"POST /api/v1/aws/dynamodb/tables":                            requiresScope(auth.ScopeDynamoDBWrite),
+	"POST /api/v1/aws/dynamodb/tables/{tableName}/import":         requiresScope(auth.ScopeDynamoDBWrite),
+	"GET /api/v1/aws/dynamodb/imports/{id}":                       requiresScope(auth.ScopeDynamoDBRead),
+	"GET /api/v1/aws/dynamodb/imports/{id}/events":                requiresScope(auth.ScopeDynamoDBRead),
+	"GET /api/v1/aws/dynamodb/imports/{id}/errors":                requiresScope(auth.ScopeDynamoDBRead),
+	"GET /api/v1/aws/sqs/queues":                                  requiresScope(auth.ScopeSQSRead),
+	"POST /api/v1/aws/sqs/queues/{queueName}/messages":            requiresScope(auth.ScopeSQSWrite),
+	"GET /api/v1/aws/sqs/queues/{queueName}/messages":             requiresScope(auth.ScopeSQSRead),
+	"DELETE /api/v1/aws/sqs/queues/{queueName}/messages":          requiresScope(auth.ScopeSQSWrite),
+	"POST /api/v1/aws/kms/encrypt":                                authenticated,
+	"POST /api/v1/aws/kms/decrypt":                                requires(auth.PermissionKMSDecrypt),
+	"POST /api/v1/aws/kms/data-key":                               requires(auth.PermissionKMSDecrypt),
+	"POST /api/v1/aws/athena/queries":                             requires(auth.PermissionAthenaQuery),
+	"GET /api/v1/aws/athena/queries/{id}":                         requires(auth.PermissionAthenaQuery),
+	"DELETE /api/v1/aws/athena/queries/{id}":                      requires(auth.PermissionAthenaQuery),
+	"GET /api/v1/aws/athena/queries/{id}/results":                 requires(auth.PermissionAthenaQuery),
+	"GET /api/v1/aws/athena/queries/{id}/results/export":          requires(auth.PermissionAthenaQuery),
+	"POST /api/v1/aws/textract/analyses":                          authenticated,
+	"GET /api/v1/aws/cloudformation/stacks":                       requires(auth.PermissionAWSRead),
+	"GET /api/v1/aws/cloudformation/stacks/{stackName}":           requires(auth.PermissionAWSRead),
+	"GET /api/v1/aws/cloudformation/stacks/{stackName}/resources": requires(auth.PermissionAWSRead),
+	"GET /api/v1/aws/cloudformation/stacks/{stackName}/events":    requires(auth.PermissionAWSRead),
+	"GET /api/v1/aws/cloudwatch/alarms":                           requires(auth.PermissionAWSRead),
+	"GET /api/v1/aws/cloudwatch/metrics":                          requires(auth.PermissionAWSRead),
+	"GET /api/v1/aws/cloudwatch/metrics/data":                     requires(auth.PermissionAWSRead),
+	"POST /api/v1/aws/comprehend/sentiment":                       authenticated,
+	"POST /api/v1/aws/comprehend/entities":                        authenticated,
+	"POST /api/v1/aws/comprehend/pii":                             authenticated,
+	"POST /api/v1/aws/bedrock/invoke":                             requires(auth.PermissionAIInvoke),
+	"GET /api/v1/aws/textract/jobs/{id}":                          authenticated,
+	"GET /api/v1/aws/kinesis/streams":                             authenticated,
+	"POST /api/v1/aws/kinesis/streams/{streamName}/records":       authenticated,
+	"POST /api/v1/aws/kinesis/streams/{streamName}/records/batch": authenticated,
+
+	// Admin
+	"GET /api/v1/admin/dynamodb/tables/{tableName}/capacity":            admin,
+	"PUT /api/v1/admin/dynamodb/tables/{tableName}/capacity":            admin,
+	"GET /api/v1/admin/cloudtrail/events":                               admin,
+	"GET /api/v1/admin/route53/zones":                                   admin,
+	"GET /api/v1/admin/route53/zones/{zoneId}/records":                  admin,
+	"PUT /api/v1/admin/route53/zones/{zoneId}/records":                  admin,
+	"DELETE /api/v1/admin/route53/zones/{zoneId}/records/{name}/{type}": admin,
+	"GET /api/v1/admin/route53/changes/{id}":                            admin,
+	"GET /api/v1/admin/costs":                                           admin,
+	"GET /api/v1/admin/read-only":                                       admin,
+	"PUT /api/v1/admin/read-only":                                       admin,
+	"GET /api/v1/admin/tracing/sampling":                                admin,
+	"PUT /api/v1/admin/tracing/sampling":                                admin,
+	"POST /api/v1/admin/tracing/sampling/overrides":                     admin,
+	"DELETE /api/v1/admin/tracing/sampling/overrides/{id}":              admin,
+	"GET /api/v1/admin/egress":                                          admin,
+	"GET /api/v1/admin/slow-requests":                                   admin,
+	"POST /api/v1/admin/support-bundle":                                 admin,
+	"GET /api/v1/admin/s3/access-grants":                                admin,
+	"POST /api/v1/admin/s3/access-grants":                               admin,
+	"DELETE /api/v1/admin/s3/access-grants/{id}":                        admin,
+	"GET /api/v1/admin/groups":                                          admin,
+	"POST /api/v1/admin/groups":                                         admin,
+	"PUT /api/v1/admin/groups/{groupName}/members/{email}":              admin,
+	"DELETE /api/v1/admin/groups/{groupName}/members/{email}":           admin,
+	"POST /api/v1/admin/users":                                          admin,
+	"POST /api/v1/admin/users/{email}/impersonate":                      admin,
+	"GET /api/v1/admin/lambda-triggers":                                 admin,
+	"PUT /api/v1/admin/lambda-triggers":                                 admin,
+	"GET /api/v1/admin/auth-events":                                     admin,
+	"GET /api/v1/admin/roles":                                           admin,
+	"PUT /api/v1/admin/roles/{name}":                                    admin,
+	"DELETE /api/v1/admin/roles/{name}":                                 admin,
+	"GET /api/v1/admin/api-keys":                                        admin,
+	"POST /api/v1/admin/api-keys":                                       admin,
+	"DELETE /api/v1/admin/api-keys/{id}":                                admin,
+
+	// Version 2
+	"GET /api/v2/items":                               authenticated,
+	"GET /api/v2/aws/dynamodb/tables":                 requiresScope(auth.ScopeDynamoDBRead),
+	"GET /api/v2/aws/s3/buckets/{bucketName}/objects": requiresScope(auth.ScopeS3Read),
+}
+
+// router registers routes on a mux, wrapping each in the middleware its
+// entry in routeAccess calls for.
+type router struct {
+	mux          *http.ServeMux
+	adminMux     *http.ServeMux // takes the admin API routes, if set
+	access       map[string]access
+	authenticate func(http.Handler) http.Handler
+	roles        auth.RoleStore
+	logger       *slog.Logger
+	// awsRole, if set, lets authenticated requests pick the AWS role their
+	// S3 and DynamoDB calls are sent as. Public routes ignore the header.
+	awsRole func(http.Handler) http.Handler
+	// traceUser, if set, traces authenticated requests whose user an
+	// override forces tracing for.
+	traceUser func(http.Handler) http.Handler
+	// deprecated lists the deprecated routes, whose responses announce
+	// sunset as the time they are removed, if it isn't zero.
+	deprecated map[string]deprecation
+	sunset     time.Time
+
+	registered map[string]bool
+	missing    []string
+}
+
+// newRouter creates a router that authenticates requests with authenticate
+// and checks permissions against roles.
+func newRouter(mux *http.ServeMux, access map[string]access, authenticate func(http.Handler) http.Handler, roles auth.RoleStore, logger *slog.Logger) *router {
+	return &router{
+		mux:          mux,
+		access:       access,
+		authenticate: authenticate,
+		roles:        roles,
+		logger:       logger,
+		registered:   make(map[string]bool),
+	}
+}
+
+// handle registers h for pattern behind the middleware its access requires.
+// Routes missing from the manifest are recorded, not registered, and
+// reported by verify.
+func (rt *router) handle(pattern string, h http.Handler) {
+	a, ok := rt.access[pattern]
+	if !ok {
+		rt.missing = append(rt.missing, pattern)
+		return
+	}
+	rt.registered[pattern] = true
+
+	if a.level != accessPublic && rt.traceUser != nil {
+		h = rt.traceUser(h)
+	}
+	if a.level != accessPublic && rt.awsRole != nil {
+		h = rt.awsRole(h)
+	}
+	switch a.level {
+	case accessAuthenticated:
+		h = rt.authenticate(middleware.RequireUser(rt.logger)(h))
+	case accessScope:
+		h = rt.authenticate(middleware.RequireScope(rt.logger, a.scope)(h))
+	case accessPermission:
+		h = rt.authenticate(middleware.RequirePermission(a.permission, rt.roles, rt.logger)(h))
+	case accessAdmin:
+		h = rt.authenticate(middleware.RequireAdmin(rt.logger)(h))
+	}
+	if d, ok := rt.deprecated[pattern]; ok {
+		_, successor, _ := strings.Cut(d.successor, " ")
+		h = middleware.Deprecated(d.since, rt.sunset, successor)(h)
+	}
+
+	_, path, _ := strings.Cut(pattern, " ")
+	if rt.adminMux != nil && strings.HasPrefix(path, "/api/v1/admin/") {
+		rt.adminMux.Handle(pattern, h)
+		return
+	}
+	rt.mux.Handle(pattern, h)
+}
+
+// routeGroup registers routes that share a path prefix and middleware.
+// Their authorization still comes from routeAccess, by full pattern, and is
+// applied outside the group's middleware.
+type routeGroup struct {
+	rt         *router
+	prefix     string
+	middleware []func(http.Handler) http.Handler
+}
+
+// group returns a group of routes under prefix, each wrapped in mw, the
+// first outermost.
+func (rt *router) group(prefix string, mw ...func(http.Handler) http.Handler) *routeGroup {
+	return &routeGroup{rt: rt, prefix: prefix, middleware: mw}
+}
+
+// group returns a group of routes under g's prefix followed by prefix, each
+// wrapped in g's middleware and then mw.
+func (g *routeGroup) group(prefix string, mw ...func(http.Handler) http.Handler) *routeGroup {
+	return &routeGroup{
+		rt:         g.rt,
+		prefix:     g.prefix + prefix,
+		middleware: append(slices.Clip(g.middleware), mw...),
+	}
+}
+
+// handle registers h behind g's middleware for pattern, a method and a path
+// relative to g's prefix, such as "GET /{id}", or a method alone for the
+// prefix itself.
+func (g *routeGroup) handle(pattern string, h http.Handler) {
+	method, path, _ := strings.Cut(pattern, " ")
+	for i := len(g.middleware) - 1; i >= 0; i-- {
+		h = g.middleware[i](h)
+	}
+	g.rt.handle(method+" "+g.prefix+path, h)
+}
+
+// verify returns an error if any route was registered without an access
+// classification, the manifest lists routes that were never registered, or
+// a deprecated route or its successor was never registered.
+func (rt *router) verify() error {
+	var errs []error
+	for _, pattern := range rt.missing {
+		errs = append(errs, fmt.Errorf("route %q has no access classification", pattern))
+	}
+
+	var stale []string
+	for pattern, a := range rt.access {
+		if a.level == 0 || (a.level == accessScope && a.scope == "") || (a.level == accessPermission && a.permission == "") {
+			errs = append(errs, fmt.Errorf("route %q has an invalid access classification", pattern))
+		}
+		if !rt.registered[pattern] {
+			stale = append(stale, pattern)
+		}
+	}
+	sort.Strings(stale)
+	for _, pattern := range stale {
+		errs = append(errs, fmt.Errorf("route %q is classified but never registered", pattern))
+	}
+
+	for pattern, d := range rt.deprecated {
+		if !rt.registered[pattern] {
+			errs = append(errs, fmt.Errorf("deprecated route %q is never registered", pattern))
+		}
+		if !rt.registered[d.successor] {
+			errs = append(errs, fmt.Errorf("route %q is deprecated for %q, which is never registered", pattern, d.successor))
+		}
+	}
+
+	return errors.Join(errs...)
+}
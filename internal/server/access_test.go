@@ -0,0 +1,62 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRouteGroup checks that grouped routes are registered under the
+// group's prefix, behind its middleware and its parents', and behind the
+// authorization their full pattern has in the manifest.
+func TestRouteGroup(t *testing.T) {
+	var calls []string
+	tag := func(name string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler")
+	})
+
+	manifest := map[string]access{
+		"GET /api/v1/things":           public,
+		"GET /api/v1/things/{id}/more": authenticated,
+	}
+	mux := http.NewServeMux()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rt := newRouter(mux, manifest, tag("authenticate"), nil, logger)
+
+	things := rt.group("/api/v1/things", tag("outer"))
+	things.handle("GET", ok)
+	things.group("/{id}", tag("inner")).handle("GET /more", ok)
+	things.handle("DELETE /{id}", ok)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/api/v1/things", []string{"outer", "handler"}},
+		// The test's authenticate sets no user, so RequireUser rejects it
+		{"/api/v1/things/1/more", []string{"authenticate"}},
+	}
+	for _, tt := range tests {
+		calls = nil
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if strings.Join(calls, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("GET %s ran %v, want %v", tt.path, calls, tt.want)
+		}
+	}
+
+	err := rt.verify()
+	if err == nil || !strings.Contains(err.Error(), `"DELETE /api/v1/things/{id}" has no access classification`) {
+		t.Errorf("verify = %v, want the unclassified grouped route reported", err)
+	}
+}
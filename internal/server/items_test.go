@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/diagnostics"
+	"github.com/pmollerus23/go-aws-server/internal/handlers"
+	"github.com/pmollerus23/go-aws-server/internal/items"
+	"github.com/pmollerus23/go-aws-server/internal/tracing"
+)
+
+const (
+	testUserEmail    = "race@example.com"
+	testUserPassword = "Correct-Horse-9"
+)
+
+// newTestServer returns an HTTP server running the server's real routes and
+// middleware, with the local identity provider and in-memory items, and an
+// access token for a user of it.
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("AUTH_PROVIDER", config.AuthProviderLocal)
+	t.Setenv("LOCAL_AUTH_SECRET", "test-secret-that-is-at-least-32-bytes")
+	t.Setenv("LOCAL_USERS", testUserEmail+":"+testUserPassword)
+	t.Setenv("ITEMS_STORE", config.ItemsStoreMemory)
+	t.Setenv("ADMIN_PORT", "")
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := New(logger, cfg, &aws.Clients{}, diagnostics.NewLogBuffer(10), nil, tracing.NewSampler(0))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	handler, _, err := s.setupRoutes()
+	if err != nil {
+		t.Fatalf("setupRoutes: %v", err)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	tokens, _, err := s.authService.Login(context.Background(), testUserEmail, testUserPassword, nil)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return srv, tokens.AccessToken
+}
+
+// TestItemsConcurrentCreateList sends POST and GET /api/v1/items requests
+// from many goroutines at once through the real mux and middleware. Run it
+// with -race: besides the detector's checks, it verifies that every created
+// item gets a unique ID and that the final list holds each of them once.
+func TestItemsConcurrentCreateList(t *testing.T) {
+	const (
+		writers   = 8
+		perWriter = 25
+		readers   = 4
+		perReader = 25
+	)
+
+	srv, token := newTestServer(t)
+	client := srv.Client()
+
+	do := func(method string, body any, out any) error {
+		var reader io.Reader
+		if body != nil {
+			b, err := json.Marshal(body)
+			if err != nil {
+				return err
+			}
+			reader = bytes.NewReader(b)
+		}
+		req, err := http.NewRequest(method, srv.URL+"/api/v1/items", reader)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			msg, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("%s /api/v1/items: %s: %s", method, resp.Status, msg)
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	start := make(chan struct{})
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created = make(map[int64]handlers.CreateItemResponse, writers*perWriter)
+		dupes   []int64
+	)
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < perWriter; i++ {
+				var item handlers.CreateItemResponse
+				req := handlers.CreateItemRequest{Name: fmt.Sprintf("item %d-%d", w, i)}
+				if err := do(http.MethodPost, req, &item); err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if _, ok := created[item.ID]; ok {
+					dupes = append(dupes, item.ID)
+				}
+				created[item.ID] = item
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for i := 0; i < perReader; i++ {
+				var list []items.Item
+				if err := do(http.MethodGet, nil, &list); err != nil {
+					t.Error(err)
+					return
+				}
+				seen := make(map[int64]bool, len(list))
+				for _, item := range list {
+					if seen[item.ID] {
+						t.Errorf("GET /api/v1/items returned item %d twice", item.ID)
+						return
+					}
+					seen[item.ID] = true
+				}
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	if len(dupes) > 0 {
+		t.Fatalf("POST /api/v1/items assigned IDs more than once: %v", dupes)
+	}
+	if want := writers * perWriter; len(created) != want {
+		t.Fatalf("created %d items, want %d", len(created), want)
+	}
+
+	var list []items.Item
+	if err := do(http.MethodGet, nil, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != len(created) {
+		t.Fatalf("GET /api/v1/items returned %d items, want %d", len(list), len(created))
+	}
+	for _, item := range list {
+		want, ok := created[item.ID]
+		if !ok || item.Name != want.Name || item.Description != want.Description {
+			t.Errorf("GET /api/v1/items returned %+v, want %+v", item, want)
+		}
+	}
+}
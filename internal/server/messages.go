@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pmollerus23/go-aws-server/internal/consumer"
+	"github.com/pmollerus23/go-aws-server/internal/events"
+	"github.com/pmollerus23/go-aws-server/internal/handlers"
+	"github.com/pmollerus23/go-aws-server/internal/live"
+)
+
+// Message types the SQS consumer handles, set in the message's type
+// attribute.
+const (
+	// messageCreateItem creates an item from a JSON body like the one
+	// POST /api/v1/items takes.
+	messageCreateItem = "items.create"
+)
+
+// registerMessageHandlers registers the SQS consumer's handlers.
+func (s *Server) registerMessageHandlers(c *consumer.Consumer) {
+	c.Handle(messageCreateItem, s.handleCreateItemMessage)
+}
+
+// handleCreateItemMessage creates the item described by msg. SQS delivers
+// messages at least once, so a redelivered message creates another item.
+func (s *Server) handleCreateItemMessage(ctx context.Context, msg consumer.Message) error {
+	var req handlers.CreateItemRequest
+	if err := json.Unmarshal([]byte(msg.Body), &req); err != nil {
+		return consumer.Permanent(fmt.Errorf("decode item: %w", err))
+	}
+	if problems := req.Valid(ctx); len(problems) > 0 {
+		fields := slices.Sorted(maps.Keys(problems))
+		for i, field := range fields {
+			fields[i] = problems[field]
+		}
+		return consumer.Permanent(fmt.Errorf("invalid item: %s", strings.Join(fields, "; ")))
+	}
+
+	item, err := s.items.Create(ctx, req.Name, req.Description)
+	if err != nil {
+		return fmt.Errorf("create item: %w", err)
+	}
+	s.logger.InfoContext(ctx, "item created from SQS message", "id", item.ID, "message_id", msg.ID)
+	s.live.Publish(live.TopicItems, "created", item)
+	s.events.Publish(ctx, events.TypeItemCreated, item)
+	return nil
+}
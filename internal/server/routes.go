@@ -2,77 +2,185 @@ package server
 
 import (
 	"net/http"
-	"os"
-	"path/filepath"
 
+	"github.com/pmollerus23/go-aws-server/internal/features"
 	"github.com/pmollerus23/go-aws-server/internal/handlers"
 	"github.com/pmollerus23/go-aws-server/internal/middleware"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
-// registerRoutes registers all HTTP routes.
-func (s *Server) registerRoutes(mux *http.ServeMux) {
+// registerRoutes registers all HTTP routes. Each route's authorization
+// comes from its entry in routeAccess; groups only share a path prefix and
+// the middleware their routes run behind, such as webhook signature checks.
+func (s *Server) registerRoutes(rt *router) {
 	// Health check (public)
-	mux.HandleFunc("GET /healthz", handlers.HandleHealthz(s.logger))
+	rt.handle("GET /healthz", handlers.HandleHealthz(s.logger))
+
+	// Webhooks (public, authenticated by their HMAC signature)
+	webhooks := rt.group("/api/v1/webhooks", middleware.VerifyWebhook(s.webhooks, s.logger))
+	webhooks.handle("POST /{name}", handlers.HandleWebhook(s.logger))
 
 	// Auth endpoints (public)
-	mux.Handle("POST /api/v1/auth/signup", handlers.HandleSignUp(s.logger, s.authService))
-	mux.Handle("POST /api/v1/auth/confirm", handlers.HandleConfirmSignUp(s.logger, s.authService))
-	mux.Handle("POST /api/v1/auth/login", handlers.HandleLogin(s.logger, s.authService))
-	mux.Handle("POST /api/v1/auth/refresh", handlers.HandleRefreshToken(s.logger, s.authService))
-	mux.Handle("POST /api/v1/auth/forgot-password", handlers.HandleForgotPassword(s.logger, s.authService))
-	mux.Handle("POST /api/v1/auth/reset-password", handlers.HandleConfirmForgotPassword(s.logger, s.authService))
+	authAPI := rt.group("/api/v1/auth")
+	authAPI.handle("POST /signup", handlers.HandleSignUp(s.logger, s.authService, s.audit, s.events))
+	authAPI.handle("POST /confirm", handlers.HandleConfirmSignUp(s.logger, s.authService))
+	authAPI.handle("POST /login", handlers.HandleLogin(s.logger, s.authService, s.loginThrottle, s.audit))
+	authAPI.handle("POST /mfa/respond", handlers.HandleMFARespond(s.logger, s.authService, s.audit))
+	authAPI.handle("POST /new-password", handlers.HandleNewPassword(s.logger, s.authService, s.audit))
+	authAPI.handle("POST /refresh", handlers.HandleRefreshToken(s.logger, s.authService, s.audit))
+	authAPI.handle("POST /revoke", handlers.HandleRevokeToken(s.logger, s.authService, s.audit))
+	authAPI.handle("POST /forgot-password", handlers.HandleForgotPassword(s.logger, s.authService, s.loginThrottle, s.audit))
+	authAPI.handle("GET /password-policy", handlers.HandlePasswordPolicy(s.logger, s.authService))
+	authAPI.handle("POST /reset-password", handlers.HandleConfirmForgotPassword(s.logger, s.authService, s.audit))
+	authAPI.handle("GET /oauth/{provider}", handlers.HandleOAuthAuthorize(s.logger, s.authService, s.config.Auth.Federation))
+	authAPI.handle("POST /oauth/token", handlers.HandleOAuthToken(s.logger, s.authService, s.config.Auth.Federation))
+	authAPI.handle("POST /token", handlers.HandleClientCredentialsToken(s.logger, s.authService))
 
-	// Protected routes - apply authentication middleware
-	authMiddleware := middleware.Authenticate(s.authService, s.logger)
+	// Account endpoints (protected)
+	authAPI.handle("POST /change-password", handlers.HandleChangePassword(s.logger, s.authService, s.audit))
+	me := rt.group("/api/v1/me")
+	me.handle("PATCH", handlers.HandleUpdateMe(s.logger, s.authService))
+	me.handle("POST /verify-email", handlers.HandleVerifyEmail(s.logger, s.authService))
+	me.handle("GET /devices", handlers.HandleListDevices(s.logger, s.authService))
+	me.handle("POST /devices", handlers.HandleRememberDevice(s.logger, s.authService))
+	me.handle("DELETE /devices/{deviceKey}", handlers.HandleForgetDevice(s.logger, s.authService))
 
 	// Item CRUD operations (protected)
-	mux.Handle("GET /api/v1/items", authMiddleware(handlers.HandleItemsGet(s.logger)))
-	mux.Handle("POST /api/v1/items", authMiddleware(handlers.HandleItemsCreate(s.logger)))
+	items := rt.group("/api/v1/items")
+	items.handle("GET", handlers.HandleItemsGet(s.logger, s.items))
+	items.handle("POST", handlers.HandleItemsCreate(s.logger, s.items, s.live, s.events))
+	items.handle("PUT /{id}", handlers.HandleItemsUpdate(s.logger, s.items, s.live))
+	items.handle("DELETE /{id}", handlers.HandleItemsDelete(s.logger, s.items, s.live))
+	items.handle("GET /{id}/history", handlers.HandleItemsHistory(s.logger, s.items))
+	rt.handle("GET /api/v2/items", handlers.HandleItemsGetV2(s.logger, s.items))
+
+	// Live updates over WebSocket (protected)
+	rt.handle("GET /api/v1/ws", handlers.HandleWebSocket(s.logger, s.live))
+
+	// AWS account overview (protected)
+	aws := rt.group("/api/v1/aws")
+	aws.handle("GET /summary", handlers.HandleAWSSummary(s.logger, s.awsClients))
+	aws.handle("GET /whoami", handlers.HandleAWSWhoAmI(s.logger, s.config, s.awsClients))
+
+	// Listings are cached briefly; changes through the API drop them
+	cache := middleware.CacheResponses(s.responses, s.config.Server.ResponseCacheTTL, s.logger)
+	bucketsChanged := middleware.InvalidateResponses(s.responses, "/api/v1/aws/s3/buckets")
+	tablesChanged := middleware.InvalidateResponses(s.responses, "/api/v1/aws/dynamodb/tables", "/api/v2/aws/dynamodb/tables")
+
+	// Proxied downloads hold a connection to S3 each, so they get their own limit
+	downloads := middleware.ConcurrencyLimit(s.config.Server.MaxConcurrentDownloads, s.logger)
 
 	// AWS S3 service endpoints (protected)
-	mux.Handle("GET /api/v1/aws/s3/buckets", authMiddleware(handlers.HandleS3ListBuckets(s.logger, s.awsClients.S3)))
-	mux.Handle("POST /api/v1/aws/s3/buckets", authMiddleware(handlers.HandleS3CreateBucket(s.logger, s.awsClients.S3)))
-	mux.Handle("DELETE /api/v1/aws/s3/buckets/{bucketName}", authMiddleware(handlers.HandleS3DeleteBucket(s.logger, s.awsClients.S3)))
-	mux.Handle("GET /api/v1/aws/s3/buckets/{bucketName}/objects", authMiddleware(handlers.HandleS3ListObjects(s.logger, s.awsClients.S3)))
-	mux.Handle("POST /api/v1/aws/s3/buckets/{bucketName}/objects", authMiddleware(handlers.HandleS3UploadObject(s.logger, s.awsClients.S3)))
-	mux.Handle("DELETE /api/v1/aws/s3/buckets/{bucketName}/objects/{key...}", authMiddleware(handlers.HandleS3DeleteObject(s.logger, s.awsClients.S3)))
-	mux.Handle("GET /api/v1/aws/s3/buckets/{bucketName}/download/{key...}", authMiddleware(handlers.HandleS3GetObject(s.logger, s.awsClients.S3)))
+	s3 := aws.group("/s3")
+	bucketWrites := s3.group("/buckets", bucketsChanged)
+	s3.handle("GET /buckets", cache(handlers.HandleS3ListBuckets(s.logger, s.awsClients.Regions)))
+	bucketWrites.handle("POST", handlers.HandleS3CreateBucket(s.logger, s.awsClients.Regions, s.sandbox))
+	bucketWrites.handle("DELETE /{bucketName}", handlers.HandleS3DeleteBucket(s.logger, s.awsClients.Regions))
+	s3.handle("GET /buckets/{bucketName}/objects", handlers.HandleS3ListObjects(s.logger, s.awsClients.Regions))
+	rt.handle("GET /api/v2/aws/s3/buckets/{bucketName}/objects", handlers.HandleS3ListObjectsV2(s.logger, s.awsClients.Regions))
+	s3.handle("POST /buckets/{bucketName}/objects", handlers.HandleS3UploadObject(s.logger, s.awsClients.Regions, s.awsClients.KMS, s.config.AWS.KMSKeyID, s.images, s.live, s.events))
+	s3.handle("DELETE /buckets/{bucketName}/objects/{key...}", handlers.HandleS3DeleteObject(s.logger, s.awsClients.Regions))
+	s3.handle("POST /buckets/{bucketName}/analyze/{key...}", handlers.HandleS3AnalyzeObject(s.logger, s.images))
+	s3.handle("GET /buckets/{bucketName}/download/{key...}", downloads(handlers.HandleS3GetObject(s.logger, s.awsClients.Regions, s.awsClients.KMS)))
+	s3.handle("POST /access", handlers.HandleS3DataAccess(s.logger, s.grants))
 
 	// AWS DynamoDB service endpoints (protected)
-	mux.Handle("GET /api/v1/aws/dynamodb/tables", authMiddleware(handlers.HandleDynamoDBListTables(s.logger, s.awsClients.DynamoDB)))
-	mux.Handle("GET /api/v1/aws/dynamodb/records", authMiddleware(handlers.HandleDynamoDBListRecords(s.logger, s.awsClients.DynamoDB)))
-	mux.Handle("POST /api/v1/aws/dynamodb/tables", authMiddleware(handlers.HandleDynamoDBUpsertTable(s.logger, s.awsClients.DynamoDB)))
+	dynamodb := aws.group("/dynamodb")
+	dynamodb.handle("GET /tables", cache(handlers.HandleDynamoDBListTables(s.logger, s.awsClients.Regions)))
+	rt.handle("GET /api/v2/aws/dynamodb/tables", cache(handlers.HandleDynamoDBListTablesV2(s.logger, s.awsClients.Regions)))
+	dynamodb.handle("GET /records", handlers.HandleDynamoDBListRecords(s.logger, s.records))
+	dynamodb.handle("GET /records/count", handlers.HandleDynamoDBCountRecords(s.logger, s.records))
+	dynamodb.handle("GET /records/{id}", handlers.HandleDynamoDBGetRecord(s.logger, s.records))
+	dynamodb.handle("POST /tables", tablesChanged(handlers.HandleDynamoDBUpsertTable(s.logger, s.records, s.sandbox)))
+	dynamodb.handle("POST /tables/{tableName}/import", handlers.HandleDynamoDBImportCSV(s.logger, s.imports))
+	dynamodb.handle("GET /imports/{id}", handlers.HandleDynamoDBGetImport(s.logger, s.imports))
+	dynamodb.handle("GET /imports/{id}/events", handlers.HandleDynamoDBImportEvents(s.logger, s.imports))
+	dynamodb.handle("GET /imports/{id}/errors", handlers.HandleDynamoDBImportErrors(s.logger, s.imports))
+
+	// AWS SQS service endpoints (protected)
+	sqs := aws.group("/sqs")
+	sqs.handle("GET /queues", handlers.HandleSQSListQueues(s.logger, s.awsClients.SQS))
+	sqs.handle("POST /queues/{queueName}/messages", handlers.HandleSQSSendMessage(s.logger, s.awsClients.SQS))
+	sqs.handle("GET /queues/{queueName}/messages", handlers.HandleSQSReceiveMessages(s.logger, s.awsClients.SQS))
+	sqs.handle("DELETE /queues/{queueName}/messages", handlers.HandleSQSDeleteMessage(s.logger, s.awsClients.SQS))
+
+	// AWS KMS service endpoints (protected)
+	kms := aws.group("/kms")
+	kms.handle("POST /encrypt", handlers.HandleKMSEncrypt(s.logger, s.awsClients.KMS, s.config.AWS.KMSKeyID))
+	kms.handle("POST /decrypt", handlers.HandleKMSDecrypt(s.logger, s.awsClients.KMS))
+	kms.handle("POST /data-key", handlers.HandleKMSGenerateDataKey(s.logger, s.awsClients.KMS, s.config.AWS.KMSKeyID))
+
+	// AWS Athena service endpoints (protected)
+	athena := aws.group("/athena")
+	athena.handle("POST /queries", handlers.HandleAthenaStartQuery(s.logger, s.awsClients.Athena, s.config.AWS.Athena))
+	athena.handle("GET /queries/{id}", handlers.HandleAthenaGetQuery(s.logger, s.awsClients.Athena))
+	athena.handle("DELETE /queries/{id}", handlers.HandleAthenaStopQuery(s.logger, s.awsClients.Athena))
+	athena.handle("GET /queries/{id}/results", handlers.HandleAthenaQueryResults(s.logger, s.awsClients.Athena))
+	athena.handle("GET /queries/{id}/results/export", downloads(handlers.HandleAthenaExportResults(s.logger, s.awsClients.Athena)))
+	aws.handle("POST /textract/analyses", handlers.HandleTextractAnalyze(s.logger, s.documents))
+	aws.handle("GET /textract/jobs/{id}", handlers.HandleTextractGetJob(s.logger, s.documents))
+	aws.handle("GET /cloudformation/stacks", handlers.HandleCloudFormationListStacks(s.logger, s.awsClients.CloudFormation))
+	aws.handle("GET /cloudformation/stacks/{stackName}", handlers.HandleCloudFormationGetStack(s.logger, s.awsClients.CloudFormation))
+	aws.handle("GET /cloudformation/stacks/{stackName}/resources", handlers.HandleCloudFormationListResources(s.logger, s.awsClients.CloudFormation))
+	aws.handle("GET /cloudformation/stacks/{stackName}/events", handlers.HandleCloudFormationListEvents(s.logger, s.awsClients.CloudFormation))
+	aws.handle("GET /cloudwatch/alarms", handlers.HandleCloudWatchListAlarms(s.logger, s.awsClients.CloudWatch))
+	aws.handle("GET /cloudwatch/metrics", handlers.HandleCloudWatchListMetrics(s.logger, s.awsClients.CloudWatch))
+	aws.handle("GET /cloudwatch/metrics/data", handlers.HandleCloudWatchGetMetricData(s.logger, s.awsClients.CloudWatch))
+	aws.handle("POST /comprehend/sentiment", handlers.HandleComprehendSentiment(s.logger, s.awsClients.Comprehend, s.records))
+	aws.handle("POST /comprehend/entities", handlers.HandleComprehendEntities(s.logger, s.awsClients.Comprehend, s.records))
+	aws.handle("POST /comprehend/pii", handlers.HandleComprehendPII(s.logger, s.awsClients.Comprehend, s.records))
+	bedrock := aws.group("/bedrock", middleware.RequireFeature(features.Bedrock, s.logger))
+	bedrock.handle("POST /invoke", handlers.HandleBedrockInvoke(s.logger, s.awsClients.Bedrock, s.config.AWS.Bedrock))
+
+	// AWS Kinesis service endpoints (protected)
+	kinesis := aws.group("/kinesis")
+	kinesis.handle("GET /streams", handlers.HandleKinesisListStreams(s.logger, s.awsClients.Kinesis))
+	kinesis.handle("POST /streams/{streamName}/records", handlers.HandleKinesisPutRecord(s.logger, s.awsClients.Kinesis))
+	kinesis.handle("POST /streams/{streamName}/records/batch", handlers.HandleKinesisPutRecords(s.logger, s.awsClients.Kinesis))
+
+	// Admin endpoints (protected, admin only)
+	adminAPI := rt.group("/api/v1/admin")
+	adminAPI.handle("GET /dynamodb/tables/{tableName}/capacity", handlers.HandleDynamoDBGetCapacity(s.logger, s.awsClients.Regions))
+	adminAPI.handle("PUT /dynamodb/tables/{tableName}/capacity", handlers.HandleDynamoDBUpdateCapacity(s.logger, s.awsClients.Regions))
+	adminAPI.handle("GET /cloudtrail/events", handlers.HandleCloudTrailLookupEvents(s.logger, s.awsClients.CloudTrail))
+	adminAPI.handle("GET /route53/zones", handlers.HandleRoute53ListZones(s.logger, s.awsClients.Route53))
+	adminAPI.handle("GET /route53/zones/{zoneId}/records", handlers.HandleRoute53ListRecords(s.logger, s.awsClients.Route53))
+	adminAPI.handle("PUT /route53/zones/{zoneId}/records", handlers.HandleRoute53UpsertRecord(s.logger, s.awsClients.Route53))
+	adminAPI.handle("DELETE /route53/zones/{zoneId}/records/{name}/{type}", handlers.HandleRoute53DeleteRecord(s.logger, s.awsClients.Route53))
+	adminAPI.handle("GET /route53/changes/{id}", handlers.HandleRoute53GetChange(s.logger, s.awsClients.Route53))
+	// Cost Explorer charges per request, so summaries are cached longer
+	adminAPI.handle("GET /costs", middleware.CacheResponses(s.responses, s.config.Server.CostCacheTTL, s.logger)(handlers.HandleCostAndUsage(s.logger, s.awsClients.CostExplorer)))
+	adminAPI.handle("GET /read-only", handlers.HandleGetReadOnly(s.logger, s.readOnly))
+	adminAPI.handle("PUT /read-only", handlers.HandleSetReadOnly(s.logger, s.readOnly))
+	adminAPI.handle("GET /tracing/sampling", handlers.HandleGetSampling(s.logger, s.sampler))
+	adminAPI.handle("PUT /tracing/sampling", handlers.HandleSetSamplingRate(s.logger, s.sampler))
+	adminAPI.handle("POST /tracing/sampling/overrides", handlers.HandleAddSamplingOverride(s.logger, s.sampler))
+	adminAPI.handle("DELETE /tracing/sampling/overrides/{id}", handlers.HandleRemoveSamplingOverride(s.logger, s.sampler))
+	adminAPI.handle("GET /egress", handlers.HandleEgressStats(s.logger, s.egress))
+	adminAPI.handle("GET /slow-requests", handlers.HandleSlowRequests(s.logger, s.latency))
+	adminAPI.handle("POST /support-bundle", handlers.HandleSupportBundle(s.logger, s.config, s.awsClients, s.logs, s.imports))
+	adminAPI.handle("GET /s3/access-grants", handlers.HandleListAccessGrants(s.logger, s.grants))
+	adminAPI.handle("POST /s3/access-grants", handlers.HandleCreateAccessGrant(s.logger, s.grants))
+	adminAPI.handle("DELETE /s3/access-grants/{id}", handlers.HandleDeleteAccessGrant(s.logger, s.grants))
+	adminAPI.handle("POST /users", handlers.HandleCreateUser(s.logger, s.authService))
+	adminAPI.handle("GET /lambda-triggers", handlers.HandleGetLambdaTriggers(s.logger, s.authService))
+	adminAPI.handle("PUT /lambda-triggers", handlers.HandleUpdateLambdaTriggers(s.logger, s.authService))
+	adminAPI.handle("POST /users/{email}/impersonate", handlers.HandleImpersonateUser(s.logger, s.authService, s.impersonation, s.audit))
+	adminAPI.handle("GET /groups", handlers.HandleListGroups(s.logger, s.authService))
+	adminAPI.handle("POST /groups", handlers.HandleCreateGroup(s.logger, s.authService))
+	adminAPI.handle("PUT /groups/{groupName}/members/{email}", handlers.HandleAddGroupMember(s.logger, s.authService))
+	adminAPI.handle("DELETE /groups/{groupName}/members/{email}", handlers.HandleRemoveGroupMember(s.logger, s.authService))
+	adminAPI.handle("GET /auth-events", handlers.HandleListAuthEvents(s.logger, s.audit))
+	adminAPI.handle("GET /roles", handlers.HandleListRoles(s.logger, s.roles))
+	adminAPI.handle("PUT /roles/{name}", handlers.HandlePutRole(s.logger, s.roles))
+	adminAPI.handle("DELETE /roles/{name}", handlers.HandleDeleteRole(s.logger, s.roles))
+	adminAPI.handle("GET /api-keys", handlers.HandleListAPIKeys(s.logger, s.apiKeys))
+	adminAPI.handle("POST /api-keys", handlers.HandleCreateAPIKey(s.logger, s.apiKeys))
+	adminAPI.handle("DELETE /api-keys/{id}", handlers.HandleRevokeAPIKey(s.logger, s.apiKeys))
 
 	// Swagger documentation (public)
-	mux.Handle("GET /swagger/", http.StripPrefix("/swagger/", httpSwagger.WrapHandler))
+	rt.handle("GET /swagger/", http.StripPrefix("/swagger/", httpSwagger.WrapHandler))
 
 	// Serve static files from React app (must be last to act as fallback)
-	mux.Handle("/", s.spaHandler())
-}
-
-// spaHandler serves the React SPA from web/dist directory.
-// It handles client-side routing by serving index.html for routes that don't exist.
-func (s *Server) spaHandler() http.Handler {
-	spaDir := "web/dist"
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Build the path to the requested file
-		path := filepath.Join(spaDir, r.URL.Path)
-
-		// Check if file exists
-		_, err := os.Stat(path)
-		if os.IsNotExist(err) {
-			// File does not exist, serve index.html for client-side routing
-			http.ServeFile(w, r, filepath.Join(spaDir, "index.html"))
-			return
-		} else if err != nil {
-			// Error checking file
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
-
-		// Serve the requested file
-		http.FileServer(http.Dir(spaDir)).ServeHTTP(w, r)
-	})
+	rt.handle("/", s.spaHandler())
 }
@@ -2,41 +2,193 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"database/sql"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/http/pprof"
+	"net/url"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/pmollerus23/go-aws-server/internal/accessgrants"
+	"github.com/pmollerus23/go-aws-server/internal/apikeys"
+	"github.com/pmollerus23/go-aws-server/internal/audit"
 	"github.com/pmollerus23/go-aws-server/internal/auth"
 	"github.com/pmollerus23/go-aws-server/internal/aws"
+	"github.com/pmollerus23/go-aws-server/internal/certs"
 	"github.com/pmollerus23/go-aws-server/internal/config"
+	"github.com/pmollerus23/go-aws-server/internal/consumer"
+	"github.com/pmollerus23/go-aws-server/internal/diagnostics"
+	"github.com/pmollerus23/go-aws-server/internal/documents"
+	"github.com/pmollerus23/go-aws-server/internal/drain"
+	"github.com/pmollerus23/go-aws-server/internal/egress"
+	"github.com/pmollerus23/go-aws-server/internal/events"
+	"github.com/pmollerus23/go-aws-server/internal/features"
+	"github.com/pmollerus23/go-aws-server/internal/handlers"
+	"github.com/pmollerus23/go-aws-server/internal/imaging"
+	"github.com/pmollerus23/go-aws-server/internal/impersonation"
+	"github.com/pmollerus23/go-aws-server/internal/importer"
+	"github.com/pmollerus23/go-aws-server/internal/items"
+	"github.com/pmollerus23/go-aws-server/internal/latency"
+	"github.com/pmollerus23/go-aws-server/internal/live"
 	"github.com/pmollerus23/go-aws-server/internal/middleware"
+	"github.com/pmollerus23/go-aws-server/internal/mock"
+	"github.com/pmollerus23/go-aws-server/internal/models"
+	"github.com/pmollerus23/go-aws-server/internal/rbac"
+	"github.com/pmollerus23/go-aws-server/internal/readonly"
+	"github.com/pmollerus23/go-aws-server/internal/respcache"
+	"github.com/pmollerus23/go-aws-server/internal/s3site"
+	"github.com/pmollerus23/go-aws-server/internal/sandbox"
+	"github.com/pmollerus23/go-aws-server/internal/store"
+	"github.com/pmollerus23/go-aws-server/internal/throttle"
+	"github.com/pmollerus23/go-aws-server/internal/tracing"
+	"github.com/pmollerus23/go-aws-server/internal/webhooks"
+	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
 
+// responseCacheSize is how many responses the response cache holds.
+const responseCacheSize = 1024
+
 // Server represents the HTTP server.
 type Server struct {
-	logger      *slog.Logger
-	config      *config.Config
-	awsClients  *aws.Clients
-	authService *auth.CognitoService
-	httpServer  *http.Server
+	logger        *slog.Logger
+	config        *config.Config
+	awsClients    *aws.Clients
+	authService   auth.IdentityProvider
+	cognito       *auth.CognitoService // nil unless Cognito is the identity provider
+	records       store.Repository[models.DynamoDBRecord]
+	items         items.Store
+	imports       *importer.Importer
+	logs          *diagnostics.LogBuffer
+	readOnly      *readonly.Switch
+	flags         *features.Flags
+	sampler       *tracing.Sampler
+	egress        *egress.Client
+	sandbox       *sandbox.Sandbox
+	grants        *accessgrants.Service
+	apiKeys       *apikeys.Service
+	iamAuth       *aws.SigV4Verifier
+	loginThrottle *throttle.Limiter
+	roles         *rbac.Service
+	audit         *audit.Log
+	impersonation *impersonation.Service
+	responses     respcache.Store
+	webhooks      *webhooks.Verifier
+	latency       *latency.Tracker
+	live          *live.Hub
+	requests      *drain.Tracker
+	panics        atomic.Int64 // Panics recovered from handlers
+	consumer      *consumer.Consumer
+	events        *events.Publisher
+	images        *imaging.Analyzer
+	documents     *documents.Extractor
+	certificates  *certs.Manager
+	httpServer    *http.Server
 }
 
-// New creates a new Server instance.
-func New(logger *slog.Logger, cfg *config.Config, awsClients *aws.Clients) *Server {
-	// Initialize Cognito authentication service
-	authService := auth.NewCognitoService(awsClients.Cognito, cfg.Cognito, logger)
+// New creates a new Server instance. db is the Postgres database items or
+// records are kept in, if the configuration asks for it, and nil otherwise.
+// sampler decides which requests are traced; the admin API adjusts it.
+func New(logger *slog.Logger, cfg *config.Config, awsClients *aws.Clients, logs *diagnostics.LogBuffer, db *sql.DB, sampler *tracing.Sampler) (*Server, error) {
+	// Initialize outbound HTTP client for webhooks and external APIs
+	egressClient := egress.New(egress.Config{
+		Timeout:          cfg.Egress.Timeout,
+		MaxAttempts:      cfg.Egress.MaxAttempts,
+		RetryBaseDelay:   200 * time.Millisecond,
+		RateLimit:        cfg.Egress.RateLimit,
+		Burst:            cfg.Egress.Burst,
+		FailureThreshold: cfg.Egress.BreakerThreshold,
+		Cooldown:         cfg.Egress.BreakerCooldown,
+	}, logger)
 
-	return &Server{
-		logger:      logger,
-		config:      cfg,
-		awsClients:  awsClients,
-		authService: authService,
+	// Initialize identity provider
+	var authService auth.IdentityProvider
+	var cognitoService *auth.CognitoService
+	switch cfg.Auth.Provider {
+	case config.AuthProviderOIDC:
+		authService = auth.NewOIDCProvider(cfg.Auth.OIDC, logger)
+	case config.AuthProviderLocal:
+		logger.Warn("using the local identity provider; users are kept in memory and it is not meant for production")
+		authService = auth.NewLocalProvider(cfg.Auth.Local, logger)
+	default:
+		cognitoService = auth.NewCognitoService(awsClients.Cognito, cfg.Cognito, logger)
+		if cfg.Cognito.LegacyAuthURL != "" {
+			if cfg.Cognito.LegacyAuthSecret != "" {
+				u, err := url.Parse(cfg.Cognito.LegacyAuthURL)
+				if err != nil {
+					return nil, fmt.Errorf("parse legacy auth URL: %w", err)
+				}
+				egressClient.Configure(u.Host, egress.Destination{
+					Signer: egress.HMACSigner{Secret: []byte(cfg.Cognito.LegacyAuthSecret)},
+				})
+			}
+			cognitoService.SetLegacyDirectory(auth.NewHTTPLegacyDirectory(cfg.Cognito.LegacyAuthURL, egressClient))
+		}
+		authService = cognitoService
+	}
+
+	// Initialize SigV4 authentication for machine clients
+	var iamAuth *aws.SigV4Verifier
+	if keys := aws.NewIAMKeyProvider(cfg.Auth.IAM, awsClients.SecretsManager); keys != nil {
+		iamAuth = aws.NewSigV4Verifier(keys, awsClients.Config.Region, cfg.Auth.IAM.Service)
+	}
+
+	// Initialize storage
+	var records store.Repository[models.DynamoDBRecord] = store.NewDynamoDBRepository[models.DynamoDBRecord](awsClients.DynamoDB, cfg.AWS.RecordsTable, "id", ddbtypes.ScalarAttributeTypeS)
+	if cfg.AWS.RecordsStore == config.RecordsStorePostgres {
+		records = store.NewPostgresRepository[models.DynamoDBRecord](db, "records", "id")
 	}
+
+	var itemStore items.Store = items.NewMemoryStore()
+	switch cfg.Items.Store {
+	case config.ItemsStoreDynamoDB:
+		itemStore = items.NewDynamoDBStore(awsClients.InternalDynamoDB, cfg.Items.Table)
+	case config.ItemsStoreEventSourced:
+		itemStore = items.NewEventStore(awsClients.InternalDynamoDB, cfg.Items.EventsTable, cfg.Items.Table)
+	case config.ItemsStorePostgres:
+		itemStore = items.NewPostgresStore(db)
+	}
+
+	return &Server{
+		logger:        logger,
+		config:        cfg,
+		awsClients:    awsClients,
+		authService:   authService,
+		cognito:       cognitoService,
+		records:       records,
+		items:         itemStore,
+		imports:       importer.New(awsClients.DynamoDB, logger, cfg.Import.MinConcurrency, cfg.Import.MaxConcurrency),
+		logs:          logs,
+		readOnly:      readonly.New(cfg.Server.ReadOnly, cfg.Server.ReadOnlyReason),
+		flags:         features.New(cfg.Features),
+		sampler:       sampler,
+		egress:        egressClient,
+		sandbox:       sandbox.New(cfg.Sandbox),
+		grants:        accessgrants.New(awsClients.S3Control, cfg.AWS.AccessGrants, logger),
+		apiKeys:       apikeys.New(awsClients.InternalDynamoDB, cfg.Auth.APIKeys.Table, logger),
+		iamAuth:       iamAuth,
+		loginThrottle: throttle.New(cfg.Auth.LoginThrottle, logger),
+		roles:         rbac.New(awsClients.InternalDynamoDB, cfg.Auth.RolesTable, logger),
+		audit:         audit.New(awsClients.InternalDynamoDB, cfg.Auth.Audit, logger),
+		impersonation: impersonation.New(cfg.Auth.Impersonation, logger),
+		responses:     respcache.NewMemoryStore(responseCacheSize),
+		webhooks:      webhooks.New(cfg.Webhooks, awsClients.SecretsManager, logger),
+		latency:       latency.New(cfg.Server.SlowRequestThreshold),
+		live:          live.New(logger),
+		requests:      drain.New(logger, cfg.Server.WriteTimeout),
+		certificates:  certs.New(cfg.Server.TLS.ACME, awsClients.S3, awsClients.Route53, logger),
+		consumer:      consumer.New(awsClients.SQS, cfg.Consumer, logger),
+		events:        events.New(awsClients.EventBridge, cfg.Events, logger),
+		images:        imaging.New(awsClients.Rekognition, awsClients.S3, awsClients.InternalDynamoDB, cfg.Images, logger),
+		documents:     documents.New(awsClients.Textract, awsClients.SQS, cfg.AWS.Textract, logger),
+	}, nil
 }
 
 // Run starts the HTTP server and handles graceful shutdown.
@@ -44,57 +196,385 @@ func (s *Server) Run(ctx context.Context) error {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancel()
 
-	// Create HTTP handler
-	handler := s.setupRoutes()
+	// Keep the identity provider's token verification keys warm so requests
+	// never wait on its JWKS endpoint
+	s.authService.Start(ctx)
+
+	// Pick up rotations of the Cognito client secret in Secrets Manager
+	if s.cognito != nil && s.config.Cognito.ClientSecretARN != "" && s.config.Cognito.ClientSecretRefreshInterval > 0 {
+		aws.WatchSecret(ctx, s.awsClients.SecretsManager, s.config.Cognito.ClientSecretARN, config.CognitoClientSecretKey,
+			s.config.Cognito.ClientSecret, s.config.Cognito.ClientSecretRefreshInterval, s.logger, s.cognito.SetClientSecret)
+	}
+
+	// Follow the read-only SSM parameter, if configured
+	if s.config.Server.ReadOnlyParameter != "" {
+		s.readOnly.WatchSSM(ctx, s.awsClients.SSM, s.config.Server.ReadOnlyParameter, s.config.Server.ReadOnlyPollInterval, s.logger)
+	}
+
+	// Refresh feature flags from their file and AppConfig, if configured
+	if s.config.Flags.File != "" {
+		s.flags.WatchFile(ctx, s.config.Flags.File, s.config.Flags.PollInterval, s.logger)
+	}
+	if s.config.Flags.AppConfigEnabled() {
+		s.flags.WatchAppConfig(ctx, s.awsClients.AppConfigData, s.config.Flags, s.logger)
+	}
+
+	// Delete expired sandbox resources
+	if s.config.Sandbox.Enabled {
+		sandbox.NewCleaner(s.config.Sandbox, s.awsClients.S3, s.awsClients.DynamoDB, s.records, s.logger).
+			Start(ctx, s.config.Sandbox.CleanupInterval)
+	}
+
+	// Push DynamoDB stream records to live clients, and disconnect them on
+	// shutdown, which the HTTP server doesn't do for WebSockets
+	if tables := s.config.Live.StreamTables; len(tables) > 0 {
+		s.live.WatchStreams(ctx, tables, s.awsClients.DynamoDB, s.awsClients.DynamoDBStreams, s.config.Live.StreamPollInterval)
+	}
+	if streams := s.config.Live.KinesisStreams; len(streams) > 0 {
+		s.live.WatchKinesis(ctx, streams, s.awsClients.Kinesis, s.config.Live.StreamPollInterval)
+	}
+	s.documents.WatchCompletions(ctx, func(c documents.Completion) {
+		s.live.Publish(live.TopicDocuments, "completed", c)
+	})
+	context.AfterFunc(ctx, s.live.Close)
+
+	// Publish domain events to EventBridge, if configured
+	if s.events != nil {
+		s.events.Start()
+	}
+
+	// Handle messages from the SQS queue, if configured
+	if s.consumer != nil {
+		s.registerMessageHandlers(s.consumer)
+		s.consumer.Start(ctx)
+	}
+
+	// Obtain and renew ACME certificates, if configured
+	if s.certificates != nil {
+		s.certificates.Start(ctx)
+	}
+
+	// Create HTTP handlers
+	handler, admin, err := s.setupRoutes()
+	if err != nil {
+		return err
+	}
 
 	// Create HTTP server
-	s.httpServer = &http.Server{
-		Addr:         net.JoinHostPort(s.config.Server.Host, s.config.Server.Port),
+	s.httpServer, err = newHTTPServer(s.config.Server, handler, s.certificates)
+	if err != nil {
+		return err
+	}
+
+	return serve(ctx, s.logger, s.httpServer, newRedirectServer(s.config.Server, s.certificates), newAdminServer(s.config.Server, admin), s.config.Server.ShutdownTimeout, s.requests, s.imports, s.consumer, s.events, s.images)
+}
+
+// RunMock serves the API from its OpenAPI document with example responses
+// instead of calling AWS, until ctx is cancelled or an interrupt arrives.
+func RunMock(ctx context.Context, logger *slog.Logger, cfg config.ServerConfig, doc []byte) error {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+
+	api, err := mock.New(doc, logger)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", api)
+	mux.Handle("GET /healthz", handlers.HandleHealthz(logger))
+	mux.Handle("GET /swagger/", http.StripPrefix("/swagger/", httpSwagger.WrapHandler))
+
+	var handler http.Handler = mux
+	handler = middleware.Logging(logger)(handler)
+	handler = middleware.PanicRecovery(logger, nil)(handler)
+	handler = middleware.RequestID()(handler)
+
+	logger.Warn("running in mock mode: responses are generated from the OpenAPI document and no AWS calls are made")
+	httpServer, err := newHTTPServer(cfg, handler, nil)
+	if err != nil {
+		return err
+	}
+	return serve(ctx, logger, httpServer, nil, nil, cfg.ShutdownTimeout)
+}
+
+// newHTTPServer creates the HTTP server for the configured address. It
+// serves HTTPS with certificates from certificates if it isn't nil, or from
+// the configured certificate, failing if it can't be loaded.
+func newHTTPServer(cfg config.ServerConfig, handler http.Handler, certificates *certs.Manager) (*http.Server, error) {
+	httpServer := &http.Server{
+		Addr:         net.JoinHostPort(cfg.Host, cfg.Port),
 		Handler:      handler,
-		ReadTimeout:  15 * time.Second, // Time to read request headers and body
-		WriteTimeout: 15 * time.Second, // Time to write response
-		IdleTimeout:  60 * time.Second, // Time to keep connection alive when idle
+		ReadTimeout:  cfg.ReadTimeout,  // Time to read request headers and body
+		WriteTimeout: cfg.WriteTimeout, // Time to write response
+		IdleTimeout:  cfg.IdleTimeout,  // Time to keep connection alive when idle
 	}
 
+	// HTTP/2 is only negotiated over TLS; h2c serves it in plaintext
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(cfg.HTTP2)
+	protocols.SetUnencryptedHTTP2(cfg.H2C)
+	httpServer.Protocols = protocols
+	httpServer.HTTP2 = &http.HTTP2Config{MaxConcurrentStreams: cfg.HTTP2MaxConcurrentStreams}
+
+	switch {
+	case certificates != nil:
+		httpServer.TLSConfig = &tls.Config{
+			GetCertificate: certificates.GetCertificate,
+			MinVersion:     cfg.TLS.MinVersion,
+			CipherSuites:   cfg.TLS.CipherSuites,
+		}
+	case cfg.TLS.CertFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load TLS certificate: %w", err)
+		}
+		httpServer.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   cfg.TLS.MinVersion,
+			CipherSuites: cfg.TLS.CipherSuites,
+		}
+	}
+
+	return httpServer, nil
+}
+
+// newRedirectServer creates the plaintext server that redirects requests to
+// HTTPS, or returns nil if none is configured. It also answers the ACME HTTP
+// challenges of certificates, if it isn't nil.
+func newRedirectServer(cfg config.ServerConfig, certificates *certs.Manager) *http.Server {
+	if cfg.TLS.RedirectPort == "" {
+		return nil
+	}
+
+	handler := redirectToHTTPS(cfg.Port)
+	if certificates != nil {
+		handler = certificates.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:         net.JoinHostPort(cfg.Host, cfg.TLS.RedirectPort),
+		Handler:      handler,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+}
+
+// newAdminServer creates the plaintext server for the admin listener, or
+// returns nil if none is configured.
+func newAdminServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	if handler == nil {
+		return nil
+	}
+	return &http.Server{
+		Addr:         net.JoinHostPort(cfg.AdminHost, cfg.AdminPort),
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+}
+
+// redirectToHTTPS redirects every request to the same host and path on the
+// HTTPS port. GET and HEAD get 301; other methods get 308 so clients repeat
+// them with their body.
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, target.String(), status)
+	})
+}
+
+// drainer has work in progress to finish, or cancel, before the process
+// exits.
+type drainer interface {
+	Drain(ctx context.Context)
+}
+
+// serve runs httpServer, and redirectServer and adminServer if they aren't
+// nil, until ctx is done. It then stops accepting connections and waits up
+// to shutdownTimeout for in-flight requests and for drainers, such as
+// request trackers and background jobs, before closing the connections that
+// are left.
+func serve(ctx context.Context, logger *slog.Logger, httpServer, redirectServer, adminServer *http.Server, shutdownTimeout time.Duration, drainers ...drainer) error {
 	// Start server in goroutine
 	go func() {
-		s.logger.Info("server starting", "addr", s.httpServer.Addr)
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if httpServer.TLSConfig != nil {
+			logger.Info("server starting", "addr", httpServer.Addr, "tls", true)
+			// The certificate is already in TLSConfig
+			if err := httpServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "error listening and serving: %s\n", err)
+			}
+			return
+		}
+		logger.Info("server starting", "addr", httpServer.Addr)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			fmt.Fprintf(os.Stderr, "error listening and serving: %s\n", err)
 		}
 	}()
+	servers := map[string]*http.Server{"http": httpServer}
+	if redirectServer != nil {
+		servers["redirect"] = redirectServer
+		go func() {
+			logger.Info("HTTPS redirect starting", "addr", redirectServer.Addr)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "error listening and serving redirects: %s\n", err)
+			}
+		}()
+	}
+	if adminServer != nil {
+		servers["admin"] = adminServer
+		go func() {
+			logger.Info("admin listener starting", "addr", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "error listening and serving admin requests: %s\n", err)
+			}
+		}()
+	}
 
 	// Wait for shutdown signal
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		<-ctx.Done()
-		s.logger.Info("server shutting down")
-		shutdownCtx := context.Background()
-		shutdownCtx, cancel := context.WithTimeout(shutdownCtx, 10*time.Second)
-		defer cancel()
-		if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
-			fmt.Fprintf(os.Stderr, "error shutting down http server: %s\n", err)
-		}
-	}()
+	<-ctx.Done()
+	logger.Info("server shutting down", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
+	// Shutdown closes the listeners at once, then waits for connections to
+	// go idle, while the drainers wait for or cancel the work on them
+	var wg sync.WaitGroup
+	for name, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				logger.Warn("closing connections still open at shutdown timeout", "server", name, "error", err)
+				server.Close()
+			}
+		}()
+	}
+	for _, d := range drainers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.Drain(shutdownCtx)
+		}()
+	}
 	wg.Wait()
+
+	logger.Info("server stopped")
 	return nil
 }
 
-// setupRoutes configures all routes and middleware.
-func (s *Server) setupRoutes() http.Handler {
+// setupRoutes configures all routes and middleware. It fails if a route's
+// authorization isn't declared in routeAccess. The admin handler is nil
+// unless there is an admin listener.
+func (s *Server) setupRoutes() (handler, admin http.Handler, err error) {
 	mux := http.NewServeMux()
+	var adminMux *http.ServeMux
+	if s.config.Server.AdminPort != "" {
+		adminMux = http.NewServeMux()
+	}
 
 	// Register routes
-	s.registerRoutes(mux)
+	var tokens auth.TokenValidator = s.authService
+	if s.impersonation != nil {
+		tokens = s.impersonation.Wrap(tokens)
+	}
+	if size := s.config.Auth.TokenCacheSize; size > 0 {
+		tokens = auth.NewTokenCache(tokens, size)
+	}
+	authenticate := middleware.Authenticate(tokens, s.logger)
+	if s.apiKeys != nil {
+		authenticate = middleware.AuthenticateAPIKey(s.apiKeys, authenticate, s.logger)
+	}
+	if s.iamAuth != nil {
+		authenticate = middleware.AuthenticateIAM(s.iamAuth, authenticate, s.logger)
+	}
+	var roles auth.RoleStore = auth.DefaultRoles
+	if s.roles != nil {
+		roles = s.roles
+	}
+	rt := newRouter(mux, routeAccess, authenticate, roles, s.logger)
+	rt.adminMux = adminMux
+	rt.awsRole = middleware.AWSRole(s.config.AWS.Roles, roles, s.logger)
+	if s.config.Tracing.Enabled() {
+		rt.traceUser = middleware.TraceUser(s.sampler)
+	}
+	rt.deprecated, rt.sunset = routeDeprecations, s.config.Server.V1Sunset
+	s.registerRoutes(rt)
+	if err := rt.verify(); err != nil {
+		return nil, nil, fmt.Errorf("route access manifest: %w", err)
+	}
+
+	readOnly := middleware.ReadOnly(s.readOnly, s.logger,
+		"/api/v1/auth/login",
+		"/api/v1/auth/mfa/respond",
+		"/api/v1/auth/new-password",
+		"/api/v1/auth/refresh",
+		"/api/v1/auth/revoke",
+		"/api/v1/auth/oauth/token",
+		"/api/v1/auth/token",
+		"/api/v1/admin/read-only",
+	)
 
 	// Apply middleware in reverse order (last one wraps all others)
-	var handler http.Handler = mux
+	handler = mux
+	handler = middleware.SlowRequests(s.latency, s.logger)(handler)
+	handler = s3site.Route(s.config.AWS.Sites, s.awsClients.S3, s.logger)(handler)
+	handler = readOnly(handler)
+	handler = middleware.ConcurrencyLimit(s.config.Server.MaxConcurrentRequests, s.logger, "/healthz", "/api/v1/ws")(handler)
+	handler = middleware.CORS(s.config.Server.CORSOrigins)(handler)
+	handler = middleware.WebSocketToken()(handler)
 	handler = middleware.Logging(s.logger)(handler)
+	handler = middleware.AWSCalls(s.config.AWS.CallBudget, s.logger)(handler)
+	handler = middleware.Features(s.flags)(handler)
 	handler = middleware.RequestSizeLimit(10 * 1024 * 1024)(handler) // 10MB limit
-	handler = middleware.PanicRecovery(s.logger)(handler)
+	handler = middleware.PanicRecovery(s.logger, &s.panics)(handler)
+	handler = middleware.Forwarded(s.config.Server.TrustedProxies, s.config.Server.ForceHTTPS)(handler)
+	handler = s.requests.Middleware()(handler)
+	handler = middleware.RequestID()(handler)
+	handler = middleware.Tracing(mux)(handler)
+
+	if adminMux == nil {
+		return handler, nil, nil
+	}
+
+	// Operational endpoints have no access classification of their own: they
+	// exist only on the admin listener, which must not be reachable publicly
+	adminMux.Handle("GET /healthz", handlers.HandleHealthz(s.logger))
+	adminMux.Handle("GET /metrics", handlers.HandleMetrics(s.logger, s.latency, s.egress, &s.panics, s.events, s.imports, s.consumer))
+	adminMux.Handle("GET /debug/config", handlers.HandleConfigDump(s.logger, s.config))
+	adminMux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	adminMux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	adminMux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	adminMux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	adminMux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+
+	// The admin listener skips the static sites, CORS, and the public
+	// concurrency limit, so operators can still reach it under load
+	admin = adminMux
+	admin = middleware.SlowRequests(s.latency, s.logger)(admin)
+	admin = readOnly(admin)
+	admin = middleware.Logging(s.logger)(admin)
+	admin = middleware.AWSCalls(s.config.AWS.CallBudget, s.logger)(admin)
+	admin = middleware.Features(s.flags)(admin)
+	admin = middleware.RequestSizeLimit(10 * 1024 * 1024)(admin)
+	admin = middleware.PanicRecovery(s.logger, &s.panics)(admin)
+	admin = s.requests.Middleware()(admin)
+	admin = middleware.RequestID()(admin)
+	admin = middleware.Tracing(adminMux)(admin)
 
-	return handler
+	return handler, admin, nil
 }
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pmollerus23/go-aws-server/internal/problem"
+)
+
+// spaDir is the directory the React SPA is built into.
+const spaDir = "web/dist"
+
+// Cache-Control values for SPA files.
+const (
+	// cacheImmutable is for assets whose name has a content hash, which
+	// changes whenever they do.
+	cacheImmutable = "public, max-age=31536000, immutable"
+	// cacheRevalidate is for index.html and other files whose name doesn't
+	// change, so a new build is picked up at once.
+	cacheRevalidate = "no-cache"
+)
+
+// hashedAsset matches the files Vite emits with a content hash, such as
+// assets/index-BdA1x9_c.js.
+var hashedAsset = regexp.MustCompile(`^assets/.+-[A-Za-z0-9_-]{8,}\.[A-Za-z0-9]+$`)
+
+// precompressed are the encodings a file may be stored in next to itself,
+// as name.br or name.gz, in order of preference.
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// spaHandler serves the React SPA from spaDir. Paths that aren't files,
+// including directories, get index.html so client-side routes work. Files
+// are opened through an os.Root, so no path or symlink can reach outside
+// spaDir, and dotfiles other than .well-known are never served.
+func (s *Server) spaHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			problem.Error(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if strings.ContainsAny(name, "\\\x00") {
+			problem.Error(w, r, "Not Found", http.StatusNotFound)
+			return
+		}
+		for segment := range strings.SplitSeq(name, "/") {
+			if strings.HasPrefix(segment, ".") && segment != ".well-known" {
+				problem.Error(w, r, "Not Found", http.StatusNotFound)
+				return
+			}
+		}
+
+		root, err := os.OpenRoot(spaDir)
+		if errors.Is(err, fs.ErrNotExist) {
+			// The SPA hasn't been built
+			problem.Error(w, r, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "failed to open SPA directory", "error", err, "dir", spaDir)
+			problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer root.Close()
+
+		if info, err := root.Stat(name); name == "" || errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+			// Client-side route
+			name = "index.html"
+		} else if err != nil {
+			// Includes symlinks that point outside spaDir
+			s.logger.WarnContext(r.Context(), "refusing to serve SPA file", "error", err, "path", name)
+			problem.Error(w, r, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		serveSPAFile(w, r, root, name)
+	})
+}
+
+// serveSPAFile serves name from root with its cache headers, preferring a
+// precompressed copy the client accepts.
+func serveSPAFile(w http.ResponseWriter, r *http.Request, root *os.Root, name string) {
+	header := w.Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	if hashedAsset.MatchString(name) {
+		header.Set("Cache-Control", cacheImmutable)
+	} else {
+		header.Set("Cache-Control", cacheRevalidate)
+	}
+
+	// The content type is the original file's, not the compressed one's
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	header.Add("Vary", "Accept-Encoding")
+
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	for _, p := range precompressed {
+		if !acceptsEncoding(acceptEncoding, p.encoding) {
+			continue
+		}
+		f, err := root.Open(name + p.extension)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			f.Close()
+			continue
+		}
+		header.Set("Content-Encoding", p.encoding)
+		http.ServeContent(w, r, name, info.ModTime(), f)
+		f.Close()
+		return
+	}
+
+	f, err := root.Open(name)
+	if err != nil {
+		// index.html is missing: the SPA hasn't been built
+		problem.Error(w, r, "Not Found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		problem.Error(w, r, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows encoding
+// with a nonzero quality, by name or else through *.
+func acceptsEncoding(header, encoding string) bool {
+	wildcard := false
+	for part := range strings.SplitSeq(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, encoding) && coding != "*" {
+			continue
+		}
+		q := 1.0
+		for param := range strings.SplitSeq(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if coding != "*" {
+			return q > 0
+		}
+		wildcard = q > 0
+	}
+	return wildcard
+}
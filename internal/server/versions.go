@@ -0,0 +1,27 @@
+package server
+
+import "time"
+
+// The API is versioned by path. A breaking change to a route's contract,
+// such as a new response shape, ships as a new route under the next version
+// while the old route keeps its contract until it is sunset.
+
+// v2Released is when /api/v2 shipped, and so when the /api/v1 routes it
+// replaces were deprecated.
+var v2Released = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// deprecation marks a route that has been replaced by successor, another
+// route's mux pattern.
+type deprecation struct {
+	since     time.Time
+	successor string
+}
+
+// routeDeprecations lists the deprecated routes, keyed by mux pattern. Their
+// responses carry Deprecation, Sunset, and successor Link headers.
+var routeDeprecations = map[string]deprecation{
+	// /api/v2 lists are paginated and wrapped in {"items", "count", "nextToken"}
+	"GET /api/v1/items":                               {since: v2Released, successor: "GET /api/v2/items"},
+	"GET /api/v1/aws/dynamodb/tables":                 {since: v2Released, successor: "GET /api/v2/aws/dynamodb/tables"},
+	"GET /api/v1/aws/s3/buckets/{bucketName}/objects": {since: v2Released, successor: "GET /api/v2/aws/s3/buckets/{bucketName}/objects"},
+}
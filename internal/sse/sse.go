@@ -0,0 +1,165 @@
+// Package sse streams Server-Sent Events, used to report the progress of
+// long-running operations to browsers without polling.
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/drain"
+)
+
+const (
+	// HeartbeatInterval is how often an idle stream sends a comment, so
+	// proxies don't time it out.
+	HeartbeatInterval = 15 * time.Second
+	// MinInterval is the shortest time between progress events; changes in
+	// between are coalesced into the next one.
+	MinInterval = 250 * time.Millisecond
+	// retryDelay is how long browsers wait before reconnecting.
+	retryDelay = 3 * time.Second
+)
+
+// Event is one message on a stream.
+type Event struct {
+	// ID is sent back by the browser as Last-Event-ID when it reconnects.
+	ID   string
+	Name string
+	Data any // Encoded as JSON
+}
+
+// Stream writes events to a response.
+type Stream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+	// LastEventID is the ID of the last event the client received before it
+	// reconnected, or empty.
+	LastEventID string
+}
+
+// Start sends the response headers for an event stream. The server's write
+// timeout doesn't apply to the stream, and shutdown ends it by cancelling the
+// request's context rather than waiting for it.
+func Start(w http.ResponseWriter, r *http.Request) (*Stream, error) {
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return nil, fmt.Errorf("clear write deadline: %w", err)
+	}
+	drain.LongLived(r.Context())
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx and similar proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	s := &Stream{w: w, rc: rc, LastEventID: r.Header.Get("Last-Event-ID")}
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", retryDelay.Milliseconds()); err != nil {
+		return nil, err
+	}
+	return s, rc.Flush()
+}
+
+// Send writes event and flushes it to the client.
+func (s *Stream) Send(event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if event.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", event.ID)
+	}
+	if event.Name != "" {
+		fmt.Fprintf(&b, "event: %s\n", event.Name)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", data)
+	if _, err := s.w.Write([]byte(b.String())); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// Heartbeat writes a comment, which clients ignore.
+func (s *Stream) Heartbeat() error {
+	if _, err := s.w.Write([]byte(": heartbeat\n\n")); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// Source is an operation whose progress can be streamed.
+type Source interface {
+	// Snapshot returns the operation's current state, a version that starts
+	// at 1 and increases with every change, whether the operation has
+	// finished, and a channel that is closed at the next change.
+	Snapshot() (state any, version uint64, done bool, changed <-chan struct{})
+}
+
+// SourceFunc adapts a function to a Source.
+type SourceFunc func() (state any, version uint64, done bool, changed <-chan struct{})
+
+// Snapshot calls f.
+func (f SourceFunc) Snapshot() (any, uint64, bool, <-chan struct{}) {
+	return f()
+}
+
+// Event names sent by ServeProgress.
+const (
+	EventProgress = "progress"
+	EventDone     = "done"
+)
+
+// ServeProgress streams src's state as "progress" events until it finishes,
+// with a final "done" event, or the client goes away. A reconnecting client
+// only gets an event once there is a version newer than its Last-Event-ID,
+// unless the operation has finished.
+func ServeProgress(w http.ResponseWriter, r *http.Request, src Source) error {
+	stream, err := Start(w, r)
+	if err != nil {
+		return err
+	}
+
+	var last uint64
+	if id, err := strconv.ParseUint(stream.LastEventID, 10, 64); err == nil {
+		last = id
+	}
+	heartbeat := time.NewTicker(HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		state, version, done, changed := src.Snapshot()
+		if done {
+			return stream.Send(Event{ID: strconv.FormatUint(version, 10), Name: EventDone, Data: state})
+		}
+		if version > last {
+			if err := stream.Send(Event{ID: strconv.FormatUint(version, 10), Name: EventProgress, Data: state}); err != nil {
+				return err
+			}
+			last = version
+			heartbeat.Reset(HeartbeatInterval)
+		}
+
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-heartbeat.C:
+			if err := stream.Heartbeat(); err != nil {
+				return err
+			}
+		case <-changed:
+			// Coalesce bursts of changes
+			select {
+			case <-r.Context().Done():
+				return nil
+			case <-time.After(MinInterval):
+			}
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// DynamoDBRepository is a Repository backed by a DynamoDB table with a single partition key.
+type DynamoDBRepository[T any] struct {
+	client    *dynamodb.Client
+	tableName string
+	keyName   string
+	keyType   types.ScalarAttributeType
+}
+
+// NewDynamoDBRepository creates a repository for the given table. keyName and
+// keyType describe the table's partition key (e.g. "id", types.ScalarAttributeTypeS).
+func NewDynamoDBRepository[T any](client *dynamodb.Client, tableName, keyName string, keyType types.ScalarAttributeType) *DynamoDBRepository[T] {
+	return &DynamoDBRepository[T]{
+		client:    client,
+		tableName: tableName,
+		keyName:   keyName,
+		keyType:   keyType,
+	}
+}
+
+// TableName returns the name of the backing table.
+func (r *DynamoDBRepository[T]) TableName() string {
+	return r.tableName
+}
+
+// Get returns the record with the given ID or ErrNotFound.
+func (r *DynamoDBRepository[T]) Get(ctx context.Context, id string, opts ReadOptions) (T, error) {
+	var record T
+
+	projection, names, err := projectionExpression(opts.Fields)
+	if err != nil {
+		return record, err
+	}
+
+	result, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:                aws.String(r.tableName),
+		Key:                      r.key(id),
+		ProjectionExpression:     projection,
+		ExpressionAttributeNames: names,
+		ConsistentRead:           aws.Bool(opts.ConsistentRead),
+	})
+	if err != nil {
+		return record, fmt.Errorf("get item from %s: %w", r.tableName, err)
+	}
+	if result.Item == nil {
+		return record, ErrNotFound
+	}
+
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return record, fmt.Errorf("unmarshal item: %w", err)
+	}
+	return record, nil
+}
+
+// Put inserts the record, replacing any existing record with the same ID.
+func (r *DynamoDBRepository[T]) Put(ctx context.Context, record T) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("marshal item: %w", err)
+	}
+
+	_, err = r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("put item to %s: %w", r.tableName, err)
+	}
+	return nil
+}
+
+// Query scans the table and returns every record matching the filters.
+func (r *DynamoDBRepository[T]) Query(ctx context.Context, q Query) ([]T, error) {
+	projection, names, err := projectionExpression(q.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, filterNames, values, err := filterExpression(q.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName:                 aws.String(r.tableName),
+		ProjectionExpression:      projection,
+		FilterExpression:          filter,
+		ExpressionAttributeNames:  mergeNames(names, filterNames),
+		ExpressionAttributeValues: values,
+		ConsistentRead:            aws.Bool(q.ConsistentRead),
+	})
+
+	records := make([]T, 0)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", r.tableName, err)
+		}
+
+		var pageRecords []T
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageRecords); err != nil {
+			return nil, fmt.Errorf("unmarshal items: %w", err)
+		}
+		records = append(records, pageRecords...)
+	}
+
+	return records, nil
+}
+
+// Count scans the table with Select=COUNT, so only the number of matching
+// records is returned rather than the records themselves.
+func (r *DynamoDBRepository[T]) Count(ctx context.Context, q Query) (int, error) {
+	filter, names, values, err := filterExpression(q.Filters)
+	if err != nil {
+		return 0, err
+	}
+
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName:                 aws.String(r.tableName),
+		Select:                    types.SelectCount,
+		FilterExpression:          filter,
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ConsistentRead:            aws.Bool(q.ConsistentRead),
+	})
+
+	var count int
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("count %s: %w", r.tableName, err)
+		}
+		count += int(page.Count)
+	}
+
+	return count, nil
+}
+
+// Delete removes the record with the given ID.
+func (r *DynamoDBRepository[T]) Delete(ctx context.Context, id string) error {
+	_, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableName),
+		Key:       r.key(id),
+	})
+	if err != nil {
+		return fmt.Errorf("delete item from %s: %w", r.tableName, err)
+	}
+	return nil
+}
+
+// key builds the primary key attribute map for an ID.
+func (r *DynamoDBRepository[T]) key(id string) map[string]types.AttributeValue {
+	var value types.AttributeValue = &types.AttributeValueMemberS{Value: id}
+	if r.keyType == types.ScalarAttributeTypeN {
+		value = &types.AttributeValueMemberN{Value: id}
+	}
+	return map[string]types.AttributeValue{r.keyName: value}
+}
+
+// projectionExpression builds a DynamoDB ProjectionExpression from a list of
+// top-level attribute names. Every name is aliased through
+// ExpressionAttributeNames so reserved words like "name" can be selected.
+// It returns nil values when fields is empty.
+func projectionExpression(fields []string) (*string, map[string]string, error) {
+	names := make(map[string]string)
+	placeholders := make([]string, 0, len(fields))
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		if seen[field] {
+			continue
+		}
+		if !ValidFieldName(field) {
+			return nil, nil, fmt.Errorf("%w: %q", ErrInvalidField, field)
+		}
+		seen[field] = true
+
+		placeholder := fmt.Sprintf("#f%d", len(placeholders))
+		names[placeholder] = field
+		placeholders = append(placeholders, placeholder)
+	}
+
+	if len(placeholders) == 0 {
+		return nil, nil, nil
+	}
+
+	return aws.String(strings.Join(placeholders, ", ")), names, nil
+}
+
+// filterExpression builds a DynamoDB FilterExpression that ANDs the filters
+// together. Names and values use their own placeholders so they can be
+// combined with a projection. It returns nil values when filters is empty.
+func filterExpression(filters []Filter) (*string, map[string]string, map[string]types.AttributeValue, error) {
+	if len(filters) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	names := make(map[string]string, len(filters))
+	values := make(map[string]types.AttributeValue, len(filters))
+	conditions := make([]string, 0, len(filters))
+	for i, filter := range filters {
+		if !ValidFieldName(filter.Field) {
+			return nil, nil, nil, fmt.Errorf("%w: %q", ErrInvalidField, filter.Field)
+		}
+
+		value, err := attributevalue.Marshal(filter.Value)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%w: value for %q: %v", ErrInvalidFilter, filter.Field, err)
+		}
+
+		name := fmt.Sprintf("#c%d", i)
+		placeholder := fmt.Sprintf(":c%d", i)
+		names[name] = filter.Field
+		values[placeholder] = value
+
+		var condition string
+		switch filter.Op {
+		case OpEqual:
+			condition = name + " = " + placeholder
+		case OpNotEqual:
+			condition = name + " <> " + placeholder
+		case OpLess:
+			condition = name + " < " + placeholder
+		case OpLessEqual:
+			condition = name + " <= " + placeholder
+		case OpGreater:
+			condition = name + " > " + placeholder
+		case OpGreaterEqual:
+			condition = name + " >= " + placeholder
+		case OpBeginsWith:
+			condition = "begins_with(" + name + ", " + placeholder + ")"
+		case OpContains:
+			condition = "contains(" + name + ", " + placeholder + ")"
+		default:
+			return nil, nil, nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, filter.Op)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return aws.String(strings.Join(conditions, " AND ")), names, values, nil
+}
+
+// mergeNames combines ExpressionAttributeNames maps, returning nil if both are empty.
+func mergeNames(a, b map[string]string) map[string]string {
+	if len(a) == 0 {
+		return b
+	}
+	for k, v := range b {
+		a[k] = v
+	}
+	return a
+}
+
+// ValidFieldName reports whether name is a plain attribute name made of
+// letters, digits, underscores, hyphens, and dots.
+func ValidFieldName(name string) bool {
+	if name == "" || len(name) > 255 {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_' || c == '-' || c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PostgresRepository is a Repository backed by a Postgres table of JSON
+// documents: an id text primary key and a jsonb doc column holding the
+// record marshaled with encoding/json. Fields and filters name the
+// record's JSON attributes.
+type PostgresRepository[T any] struct {
+	db        *sql.DB
+	tableName string
+	keyName   string
+}
+
+// NewPostgresRepository creates a repository for the given table. keyName
+// is the JSON attribute of records holding their ID.
+func NewPostgresRepository[T any](db *sql.DB, tableName, keyName string) *PostgresRepository[T] {
+	return &PostgresRepository[T]{
+		db:        db,
+		tableName: tableName,
+		keyName:   keyName,
+	}
+}
+
+// TableName returns the name of the backing table.
+func (r *PostgresRepository[T]) TableName() string {
+	return r.tableName
+}
+
+// Get returns the record with the given ID or ErrNotFound. Reads are always
+// consistent, so opts.ConsistentRead has no effect.
+func (r *PostgresRepository[T]) Get(ctx context.Context, id string, opts ReadOptions) (T, error) {
+	var record T
+
+	var doc []byte
+	err := r.db.QueryRowContext(ctx, "SELECT doc FROM "+r.tableName+" WHERE id = $1", id).Scan(&doc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return record, ErrNotFound
+	}
+	if err != nil {
+		return record, fmt.Errorf("get row from %s: %w", r.tableName, err)
+	}
+
+	return unmarshalDocument[T](doc, opts.Fields)
+}
+
+// Put inserts the record, replacing any existing record with the same ID.
+func (r *PostgresRepository[T]) Put(ctx context.Context, record T) error {
+	doc, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+	var attributes map[string]any
+	if err := json.Unmarshal(doc, &attributes); err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+	id, ok := attributes[r.keyName]
+	if !ok {
+		return fmt.Errorf("record has no %s", r.keyName)
+	}
+
+	_, err = r.db.ExecContext(ctx,
+		"INSERT INTO "+r.tableName+" (id, doc) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET doc = EXCLUDED.doc",
+		fmt.Sprint(id), doc)
+	if err != nil {
+		return fmt.Errorf("put row to %s: %w", r.tableName, err)
+	}
+	return nil
+}
+
+// Query returns every record matching the filters.
+func (r *PostgresRepository[T]) Query(ctx context.Context, q Query) ([]T, error) {
+	for _, field := range q.Fields {
+		if !ValidFieldName(field) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidField, field)
+		}
+	}
+
+	where, args, err := whereClause(q.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, "SELECT doc FROM "+r.tableName+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", r.tableName, err)
+	}
+	defer rows.Close()
+
+	records := make([]T, 0)
+	for rows.Next() {
+		var doc []byte
+		if err := rows.Scan(&doc); err != nil {
+			return nil, fmt.Errorf("query %s: %w", r.tableName, err)
+		}
+		record, err := unmarshalDocument[T](doc, q.Fields)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query %s: %w", r.tableName, err)
+	}
+
+	return records, nil
+}
+
+// Count returns the number of records matching the filters.
+func (r *PostgresRepository[T]) Count(ctx context.Context, q Query) (int, error) {
+	where, args, err := whereClause(q.Filters)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, "SELECT count(*) FROM "+r.tableName+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count %s: %w", r.tableName, err)
+	}
+	return count, nil
+}
+
+// Delete removes the record with the given ID.
+func (r *PostgresRepository[T]) Delete(ctx context.Context, id string) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM "+r.tableName+" WHERE id = $1", id); err != nil {
+		return fmt.Errorf("delete row from %s: %w", r.tableName, err)
+	}
+	return nil
+}
+
+// unmarshalDocument decodes a record, keeping only fields if any are given.
+func unmarshalDocument[T any](doc []byte, fields []string) (T, error) {
+	var record T
+
+	if len(fields) > 0 {
+		var attributes map[string]json.RawMessage
+		if err := json.Unmarshal(doc, &attributes); err != nil {
+			return record, fmt.Errorf("unmarshal record: %w", err)
+		}
+		projected := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := attributes[field]; ok {
+				projected[field] = value
+			}
+		}
+		var err error
+		if doc, err = json.Marshal(projected); err != nil {
+			return record, fmt.Errorf("unmarshal record: %w", err)
+		}
+	}
+
+	if err := json.Unmarshal(doc, &record); err != nil {
+		return record, fmt.Errorf("unmarshal record: %w", err)
+	}
+	return record, nil
+}
+
+// whereClause builds a WHERE clause that ANDs the filters together, with
+// their arguments. Like DynamoDB filters, a filter only matches attributes
+// of its value's type. It returns an empty clause when filters is empty.
+func whereClause(filters []Filter) (string, []any, error) {
+	if len(filters) == 0 {
+		return "", nil, nil
+	}
+
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := make([]string, 0, len(filters))
+	for _, filter := range filters {
+		if !ValidFieldName(filter.Field) {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidField, filter.Field)
+		}
+		key := arg(filter.Field) + "::text"
+		attribute := "doc -> " + key
+
+		var jsonType, value, param string
+		switch v := filter.Value.(type) {
+		case string:
+			jsonType, value, param = "string", "(doc ->> "+key+")", arg(v)+"::text"
+		case int, int32, int64, float32, float64:
+			jsonType, value, param = "number", "(doc ->> "+key+")::numeric", arg(v)+"::numeric"
+		default:
+			return "", nil, fmt.Errorf("%w: value for %q must be a string or number", ErrInvalidFilter, filter.Field)
+		}
+		typed := "jsonb_typeof(" + attribute + ") = '" + jsonType + "'"
+		inArray := "jsonb_typeof(" + attribute + ") = 'array' AND " + attribute + " @> jsonb_build_array(" + param + ")"
+
+		var condition string
+		switch filter.Op {
+		case OpEqual:
+			condition = typed + " AND " + value + " = " + param
+		case OpNotEqual:
+			// DynamoDB's <> also matches records without the attribute
+			condition = "NOT coalesce(" + typed + " AND " + value + " = " + param + ", false)"
+		case OpLess:
+			condition = typed + " AND " + value + " < " + param
+		case OpLessEqual:
+			condition = typed + " AND " + value + " <= " + param
+		case OpGreater:
+			condition = typed + " AND " + value + " > " + param
+		case OpGreaterEqual:
+			condition = typed + " AND " + value + " >= " + param
+		case OpBeginsWith:
+			if jsonType != "string" {
+				return "", nil, fmt.Errorf("%w: begins_with needs a string value", ErrInvalidFilter)
+			}
+			condition = typed + " AND starts_with(" + value + ", " + param + ")"
+		case OpContains:
+			// Substrings of strings, or elements of arrays
+			condition = inArray
+			if jsonType == "string" {
+				condition = typed + " AND strpos(" + value + ", " + param + ") > 0 OR " + inArray
+			}
+		default:
+			return "", nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, filter.Op)
+		}
+		conditions = append(conditions, "("+condition+")")
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
@@ -0,0 +1,68 @@
+// Package store defines storage abstractions used by the HTTP handlers so the
+// backing database can be mocked in tests or swapped without touching handlers.
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrNotFound      = errors.New("record not found")
+	ErrInvalidField  = errors.New("invalid field name")
+	ErrInvalidFilter = errors.New("invalid filter")
+)
+
+// ReadOptions controls how records are read.
+type ReadOptions struct {
+	// Fields limits the attributes returned for each record. Attributes that
+	// are not listed are left at their zero value. Empty returns everything.
+	Fields []string
+	// ConsistentRead requests a strongly consistent read so writes that
+	// completed before the read are always reflected.
+	ConsistentRead bool
+}
+
+// FilterOp is a comparison applied by a Filter.
+type FilterOp string
+
+const (
+	OpEqual        FilterOp = "eq"
+	OpNotEqual     FilterOp = "ne"
+	OpLess         FilterOp = "lt"
+	OpLessEqual    FilterOp = "le"
+	OpGreater      FilterOp = "gt"
+	OpGreaterEqual FilterOp = "ge"
+	OpBeginsWith   FilterOp = "begins_with"
+	OpContains     FilterOp = "contains"
+)
+
+// Filter restricts a query to records whose top-level attribute Field compares
+// to Value with Op. Value is a string or a number; it only matches attributes
+// of the same type.
+type Filter struct {
+	Field string
+	Op    FilterOp
+	Value any
+}
+
+// Query describes a read across many records.
+type Query struct {
+	ReadOptions
+	// Filters are combined with AND. Empty matches every record.
+	Filters []Filter
+}
+
+// Repository provides basic persistence for records of type T keyed by a string ID.
+type Repository[T any] interface {
+	// Get returns the record with the given ID or ErrNotFound.
+	Get(ctx context.Context, id string, opts ReadOptions) (T, error)
+	// Put inserts the record, replacing any existing record with the same ID.
+	Put(ctx context.Context, record T) error
+	// Query returns every record matching the query.
+	Query(ctx context.Context, q Query) ([]T, error)
+	// Count returns the number of records matching the query's filters.
+	Count(ctx context.Context, q Query) (int, error)
+	// Delete removes the record with the given ID. Deleting a missing record is not an error.
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a new ULID: a 26-character, lexicographically sortable ID
+// made of a 48-bit millisecond timestamp followed by 80 random bits.
+func NewULID() string {
+	return newULID(time.Now())
+}
+
+func newULID(t time.Time) string {
+	var id [16]byte
+
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+	// crypto/rand.Read never returns an error.
+	rand.Read(id[6:])
+
+	// Encode 128 bits as 26 base32 characters, most significant first. The
+	// leading character only carries 3 bits.
+	var out [26]byte
+	var acc uint32
+	bits := 2 // pad to 130 bits so the groups of 5 line up
+	pos := 0
+	for _, b := range id {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[pos] = crockford[(acc>>bits)&0x1f]
+			pos++
+		}
+	}
+	return string(out[:])
+}
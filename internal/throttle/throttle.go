@@ -0,0 +1,140 @@
+// Package throttle locks out clients that fail to log in too often, on top
+// of whatever protection the identity provider has. Attempts are counted
+// in memory per email and client IP, so each server instance counts its
+// own.
+package throttle
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// attempts is the failure count for one key.
+type attempts struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// Limiter counts failed attempts per key and locks a key out once it
+// reaches the limit within the window. A nil Limiter allows everything.
+type Limiter struct {
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	logger      *slog.Logger
+
+	mu        sync.Mutex
+	keys      map[string]*attempts
+	lastSweep time.Time
+}
+
+// New returns a Limiter, or nil if throttling is disabled.
+func New(cfg config.LoginThrottleConfig, logger *slog.Logger) *Limiter {
+	if cfg.MaxFailures == 0 {
+		return nil
+	}
+	return &Limiter{
+		maxFailures: cfg.MaxFailures,
+		window:      cfg.Window,
+		lockout:     cfg.Lockout,
+		logger:      logger,
+		keys:        make(map[string]*attempts),
+		lastSweep:   time.Now(),
+	}
+}
+
+// Key returns the key for attempts on behalf of email from r's client.
+// Behind a load balancer that isn't a trusted proxy every client shares
+// its address, which leaves the key per email.
+func Key(r *http.Request, email string) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return strings.ToLower(email) + "|" + host
+}
+
+// Locked returns how long key remains locked out, or zero if it may try.
+func (l *Limiter) Locked(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.keys[key]
+	if !ok {
+		return 0
+	}
+	return max(time.Until(a.lockedUntil), 0)
+}
+
+// Fail records a failed attempt for key, locking it out when it reaches
+// the limit. Lockouts are logged for security review.
+func (l *Limiter) Fail(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	a, ok := l.keys[key]
+	if !ok || now.Sub(a.windowStart) > l.window {
+		a = &attempts{windowStart: now}
+		l.keys[key] = a
+	}
+	a.failures++
+
+	if a.failures >= l.maxFailures {
+		a.lockedUntil = now.Add(l.lockout)
+		email, ip, _ := strings.Cut(key, "|")
+		l.logger.Warn("login locked out",
+			"security_event", "lockout",
+			"email", email,
+			"ip", ip,
+			"failures", a.failures,
+			"locked_until", a.lockedUntil,
+		)
+		// Start a new count once the lockout ends.
+		a.failures = 0
+		a.windowStart = a.lockedUntil
+	}
+}
+
+// Reset clears key's failures after a successful attempt.
+func (l *Limiter) Reset(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, key)
+}
+
+// sweep drops keys whose window and lockout have passed, at most once per
+// window, so the map doesn't grow with every client ever seen.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, a := range l.keys {
+		if now.Sub(a.windowStart) > l.window && now.After(a.lockedUntil) {
+			delete(l.keys, key)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the service.name spans are exported under unless
+// OTEL_SERVICE_NAME overrides it.
+const ServiceName = "go-aws-server"
+
+// UserAttribute is the span attribute holding the authenticated user's ID,
+// which the sampler matches against per-user overrides.
+const UserAttribute = attribute.Key("enduser.id")
+
+// NewProvider creates a tracer provider that samples with s and exports
+// spans over OTLP/HTTP to the collector the OTEL_EXPORTER_OTLP_* variables
+// name. Shut it down to flush the spans it still buffers.
+func NewProvider(ctx context.Context, s *Sampler) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP trace exporter: %w", err)
+	}
+
+	// Later sources win, so OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	// override the default service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", ServiceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("describe trace resource: %w", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(s.OTel()),
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
+
+// OTel returns s as an OpenTelemetry sampler. Spans whose parent is in this
+// process follow their parent's decision. Other spans, such as a request's
+// server span, are sampled by s, taking the span's name as the route and its
+// UserAttribute as the user. An override forces tracing even when the
+// caller's trace context asks not to sample.
+func (s *Sampler) OTel() sdktrace.Sampler {
+	return otelSampler{s}
+}
+
+// otelSampler adapts a Sampler to OpenTelemetry's SDK.
+type otelSampler struct {
+	s *Sampler
+}
+
+func (o otelSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	parent := trace.SpanContextFromContext(p.ParentContext)
+
+	var sampled bool
+	switch {
+	case parent.IsValid() && !parent.IsRemote():
+		sampled = parent.IsSampled()
+	case parent.IsValid():
+		sampled = parent.IsSampled() || o.s.Forced(p.Name, spanUser(p.Attributes))
+	default:
+		sampled = o.s.ShouldSample(p.Name, spanUser(p.Attributes), p.TraceID)
+	}
+
+	result := sdktrace.SamplingResult{Decision: sdktrace.Drop, Tracestate: parent.TraceState()}
+	if sampled {
+		result.Decision = sdktrace.RecordAndSample
+	}
+	return result
+}
+
+func (otelSampler) Description() string {
+	return "tracing.Sampler"
+}
+
+// spanUser returns the UserAttribute among attrs, or "" if there is none.
+func spanUser(attrs []attribute.KeyValue) string {
+	for _, kv := range attrs {
+		if kv.Key == UserAttribute {
+			return kv.Value.AsString()
+		}
+	}
+	return ""
+}
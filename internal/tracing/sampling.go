@@ -0,0 +1,157 @@
+// Package tracing controls which requests are traced.
+package tracing
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pmollerus23/go-aws-server/internal/store"
+)
+
+var ErrOverrideNotFound = errors.New("sampling override not found")
+
+// Override forces tracing for every request from a user or to a route until it expires.
+type Override struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"userId,omitempty"`
+	Route     string    `json:"route,omitempty" example:"GET /api/v1/aws/dynamodb/records"`
+	Reason    string    `json:"reason,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SamplingConfig is the current sampling configuration.
+type SamplingConfig struct {
+	// Rate is the fraction of requests traced when no override matches, from 0 to 1.
+	Rate      float64    `json:"rate" example:"0.01"`
+	Overrides []Override `json:"overrides"`
+}
+
+// Sampler decides which requests are traced. The base rate and forced
+// overrides can be changed at runtime; it is safe for concurrent use.
+type Sampler struct {
+	mu        sync.RWMutex
+	rate      float64
+	overrides map[string]Override
+}
+
+// NewSampler creates a sampler with the given base rate.
+func NewSampler(rate float64) *Sampler {
+	return &Sampler{
+		rate:      clampRate(rate),
+		overrides: make(map[string]Override),
+	}
+}
+
+// Config returns the base rate and the active overrides, soonest to expire first.
+func (s *Sampler) Config() SamplingConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	overrides := make([]Override, 0, len(s.overrides))
+	for _, o := range s.overrides {
+		if now.Before(o.ExpiresAt) {
+			overrides = append(overrides, o)
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].ExpiresAt.Before(overrides[j].ExpiresAt)
+	})
+
+	return SamplingConfig{Rate: s.rate, Overrides: overrides}
+}
+
+// SetRate changes the base sampling rate. Values outside [0, 1] are clamped.
+func (s *Sampler) SetRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rate = clampRate(rate)
+}
+
+// AddOverride forces tracing for a user or route for the given duration and
+// returns the stored override.
+func (s *Sampler) AddOverride(o Override, d time.Duration) Override {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked()
+	o.ID = store.NewULID()
+	o.ExpiresAt = time.Now().Add(d)
+	s.overrides[o.ID] = o
+	return o
+}
+
+// RemoveOverride deletes an override or returns ErrOverrideNotFound.
+func (s *Sampler) RemoveOverride(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.overrides[id]; !ok {
+		return ErrOverrideNotFound
+	}
+	delete(s.overrides, id)
+	return nil
+}
+
+// ShouldSample reports whether a request should be traced. route is the
+// matched mux pattern (e.g. "GET /api/v1/items"), userID may be empty for
+// anonymous requests, and traceID is the request's 16-byte trace ID. Sampling
+// by trace ID keeps the decision consistent across services that share it.
+func (s *Sampler) ShouldSample(route, userID string, traceID [16]byte) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.forcedLocked(route, userID) {
+		return true
+	}
+
+	switch {
+	case s.rate >= 1:
+		return true
+	case s.rate <= 0:
+		return false
+	}
+
+	// Same scheme as OpenTelemetry's TraceIDRatioBased sampler.
+	bound := uint64(s.rate * (1 << 63))
+	return binary.BigEndian.Uint64(traceID[8:16])>>1 < bound
+}
+
+// Forced reports whether an active override forces tracing for route or
+// userID, either of which may be empty.
+func (s *Sampler) Forced(route, userID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.forcedLocked(route, userID)
+}
+
+// forcedLocked is Forced. s.mu must be held.
+func (s *Sampler) forcedLocked(route, userID string) bool {
+	now := time.Now()
+	for _, o := range s.overrides {
+		if !now.Before(o.ExpiresAt) {
+			continue
+		}
+		if (o.UserID != "" && o.UserID == userID) || (o.Route != "" && o.Route == route) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneLocked drops expired overrides. s.mu must be held for writing.
+func (s *Sampler) pruneLocked() {
+	now := time.Now()
+	for id, o := range s.overrides {
+		if !now.Before(o.ExpiresAt) {
+			delete(s.overrides, id)
+		}
+	}
+}
+
+func clampRate(rate float64) float64 {
+	return min(max(rate, 0), 1)
+}
@@ -0,0 +1,190 @@
+// Package webhooks verifies the HMAC signatures on inbound webhook
+// deliveries, so integrations such as GitHub hooks or services signing
+// with the egress client's scheme can be accepted safely. Each webhook's
+// key is read from Secrets Manager and re-read periodically, so keys can be
+// rotated without a restart.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+// TimestampHeader carries the Unix time a timestamped delivery was signed.
+const TimestampHeader = "X-Signature-Timestamp"
+
+// maxTimestampAge is how far a timestamped delivery's signing time may be
+// from now; older deliveries are treated as replays, as are deliveries
+// repeated within it.
+const maxTimestampAge = 5 * time.Minute
+
+// secretTTL is how long a webhook key is used before it is read again.
+const secretTTL = 5 * time.Minute
+
+var (
+	// ErrUnknownWebhook is returned for webhooks that aren't configured.
+	ErrUnknownWebhook = errors.New("unknown webhook")
+	// ErrInvalidSignature is returned for deliveries whose signature is
+	// missing, stale, replayed, or doesn't match.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// cachedSecret is a webhook key and when it was read.
+type cachedSecret struct {
+	key    []byte
+	readAt time.Time
+}
+
+// SecretReader reads webhook keys. *secretsmanager.Client implements it.
+type SecretReader interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// Verifier verifies webhook deliveries against the configured webhooks.
+type Verifier struct {
+	endpoints map[string]config.WebhookEndpoint
+	secrets   SecretReader
+	logger    *slog.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+	// seen holds the webhook and signature of each timestamped delivery
+	// accepted, until its timestamp is too old to be accepted again
+	seen map[string]time.Time
+}
+
+// New returns a Verifier, or nil if no webhooks are configured.
+func New(cfg config.WebhooksConfig, secrets SecretReader, logger *slog.Logger) *Verifier {
+	if len(cfg.Endpoints) == 0 {
+		return nil
+	}
+	return &Verifier{
+		endpoints: cfg.Endpoints,
+		secrets:   secrets,
+		logger:    logger,
+		cache:     make(map[string]cachedSecret),
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// Verify checks the signature in header on a delivery of body to the
+// webhook name. A timestamped delivery is accepted once: sent again, it is
+// rejected as a replay. Only deliveries this Verifier has seen are known,
+// so with several replicas a replay reaching another one isn't caught.
+func (v *Verifier) Verify(ctx context.Context, name string, header http.Header, body []byte) error {
+	endpoint, ok := v.endpoints[name]
+	if !ok {
+		return ErrUnknownWebhook
+	}
+
+	signature, ok := strings.CutPrefix(header.Get(endpoint.SignatureHeader), "sha256=")
+	if !ok {
+		return fmt.Errorf("%w: missing %s", ErrInvalidSignature, endpoint.SignatureHeader)
+	}
+	provided, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: malformed %s", ErrInvalidSignature, endpoint.SignatureHeader)
+	}
+
+	var (
+		signed  []byte
+		expires time.Time
+	)
+	if endpoint.Timestamped() {
+		ts := header.Get(TimestampHeader)
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: missing or malformed %s", ErrInvalidSignature, TimestampHeader)
+		}
+		if age := time.Since(time.Unix(unix, 0)); age > maxTimestampAge || age < -maxTimestampAge {
+			return fmt.Errorf("%w: signed more than %s ago", ErrInvalidSignature, maxTimestampAge)
+		}
+		signed = []byte(ts + ".")
+		expires = time.Unix(unix, 0).Add(maxTimestampAge)
+	}
+
+	key, err := v.secret(ctx, name, endpoint.SecretID)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signed)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), provided) {
+		return fmt.Errorf("%w: signature doesn't match", ErrInvalidSignature)
+	}
+	if endpoint.Timestamped() && !v.accept(name, provided, expires) {
+		return fmt.Errorf("%w: delivery was already received", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// accept records the signature of a delivery to the webhook name until
+// expires, and reports whether it wasn't already recorded.
+func (v *Verifier) accept(name string, signature []byte, expires time.Time) bool {
+	key := name + "/" + hex.EncodeToString(signature)
+	now := time.Now()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for k, until := range v.seen {
+		if now.After(until) {
+			delete(v.seen, k)
+		}
+	}
+	if _, ok := v.seen[key]; ok {
+		return false
+	}
+	v.seen[key] = expires
+	return true
+}
+
+// secret returns the key of the webhook name, reading it from secretID if
+// it hasn't been read recently. The last key read is used if reading fails.
+func (v *Verifier) secret(ctx context.Context, name, secretID string) ([]byte, error) {
+	v.mu.Lock()
+	cached, ok := v.cache[name]
+	v.mu.Unlock()
+	if ok && time.Since(cached.readAt) < secretTTL {
+		return cached.key, nil
+	}
+
+	out, err := v.secrets.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretID),
+	})
+	if err != nil {
+		if ok {
+			v.logger.WarnContext(ctx, "failed to read webhook secret, using cached key", "webhook", name, "error", err)
+			return cached.key, nil
+		}
+		return nil, fmt.Errorf("read webhook secret %s: %w", secretID, err)
+	}
+
+	key := []byte(aws.ToString(out.SecretString))
+	if len(key) == 0 {
+		key = out.SecretBinary
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("webhook secret %s is empty", secretID)
+	}
+
+	v.mu.Lock()
+	v.cache[name] = cachedSecret{key: key, readAt: time.Now()}
+	v.mu.Unlock()
+	return key, nil
+}
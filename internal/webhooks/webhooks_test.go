@@ -0,0 +1,163 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/pmollerus23/go-aws-server/internal/config"
+)
+
+const testSecret = "webhook-secret"
+
+// fakeSecrets is a SecretReader holding secrets by ID.
+type fakeSecrets map[string]string
+
+func (f fakeSecrets) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	secret, ok := f[aws.ToString(params.SecretId)]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(secret)}, nil
+}
+
+// newTestVerifier returns a Verifier with a timestamped webhook, "orders",
+// and one signed GitHub's way, "github", both keyed with testSecret.
+func newTestVerifier() *Verifier {
+	cfg := config.WebhooksConfig{Endpoints: map[string]config.WebhookEndpoint{
+		"orders": {SecretID: "webhooks/orders", SignatureHeader: config.DefaultWebhookSignatureHeader},
+		"github": {SecretID: "webhooks/github", SignatureHeader: "X-Hub-Signature-256"},
+	}}
+	secrets := fakeSecrets{"webhooks/orders": testSecret, "webhooks/github": testSecret}
+	return New(cfg, secrets, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// signTimestamped returns the headers of a delivery of body signed with
+// secret at signedAt, as the egress client signs.
+func signTimestamped(secret, body string, signedAt time.Time) http.Header {
+	ts := strconv.FormatInt(signedAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + body))
+
+	header := http.Header{}
+	header.Set(TimestampHeader, ts)
+	header.Set(config.DefaultWebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+// signGitHub returns the headers of a delivery of body signed with secret
+// as GitHub signs.
+func signGitHub(secret, body string) http.Header {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+
+	header := http.Header{}
+	header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	const body = `{"order":42}`
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		webhook string
+		header  http.Header
+		body    string
+		want    error
+	}{
+		{"valid", "orders", signTimestamped(testSecret, body, now), body, nil},
+		{"valid with a clock ahead", "orders", signTimestamped(testSecret, body, now.Add(4*time.Minute)), body, nil},
+		{"valid 4m old", "orders", signTimestamped(testSecret, body, now.Add(-4*time.Minute)), body, nil},
+		{"valid without a timestamp", "github", signGitHub(testSecret, body), body, nil},
+		{"wrong secret", "orders", signTimestamped("other-secret", body, now), body, ErrInvalidSignature},
+		{"wrong secret without a timestamp", "github", signGitHub("other-secret", body), body, ErrInvalidSignature},
+		{"modified body", "orders", signTimestamped(testSecret, body, now), `{"order":43}`, ErrInvalidSignature},
+		{"modified body without a timestamp", "github", signGitHub(testSecret, body), `{"order":43}`, ErrInvalidSignature},
+		{"expired timestamp", "orders", signTimestamped(testSecret, body, now.Add(-6*time.Minute)), body, ErrInvalidSignature},
+		{"timestamp too far ahead", "orders", signTimestamped(testSecret, body, now.Add(6*time.Minute)), body, ErrInvalidSignature},
+		{"modified timestamp", "orders", func() http.Header {
+			header := signTimestamped(testSecret, body, now)
+			header.Set(TimestampHeader, strconv.FormatInt(now.Unix()+1, 10))
+			return header
+		}(), body, ErrInvalidSignature},
+		{"missing timestamp", "orders", func() http.Header {
+			header := signTimestamped(testSecret, body, now)
+			header.Del(TimestampHeader)
+			return header
+		}(), body, ErrInvalidSignature},
+		{"missing signature", "orders", http.Header{TimestampHeader: {strconv.FormatInt(now.Unix(), 10)}}, body, ErrInvalidSignature},
+		{"malformed signature", "orders", func() http.Header {
+			header := signTimestamped(testSecret, body, now)
+			header.Set(config.DefaultWebhookSignatureHeader, "sha256=not-hex")
+			return header
+		}(), body, ErrInvalidSignature},
+		{"unknown webhook", "billing", signTimestamped(testSecret, body, now), body, ErrUnknownWebhook},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestVerifier().Verify(context.Background(), tt.webhook, tt.header, []byte(tt.body))
+			if tt.want == nil && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	const body = `{"order":42}`
+	ctx := context.Background()
+	v := newTestVerifier()
+	header := signTimestamped(testSecret, body, time.Now())
+
+	if err := v.Verify(ctx, "orders", header, []byte(body)); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := v.Verify(ctx, "orders", header, []byte(body)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify of a replayed delivery = %v, want ErrInvalidSignature", err)
+	}
+
+	// The same body signed again, as a retry is, is a new delivery
+	retry := signTimestamped(testSecret, body, time.Now().Add(time.Second))
+	if err := v.Verify(ctx, "orders", retry, []byte(body)); err != nil {
+		t.Fatalf("Verify of a re-signed delivery: %v", err)
+	}
+
+	// A delivery whose signature didn't verify isn't recorded
+	forged := signTimestamped("other-secret", body, time.Now().Add(2*time.Second))
+	if err := v.Verify(ctx, "orders", forged, []byte(body)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify of a forged delivery = %v, want ErrInvalidSignature", err)
+	}
+	if len(v.seen) != 2 {
+		t.Errorf("recorded %d deliveries, want 2", len(v.seen))
+	}
+}
+
+func TestVerifyForgetsExpiredDeliveries(t *testing.T) {
+	v := newTestVerifier()
+	v.seen["orders/00"] = time.Now().Add(-time.Second)
+
+	header := signTimestamped(testSecret, "{}", time.Now())
+	if err := v.Verify(context.Background(), "orders", header, []byte("{}")); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if _, ok := v.seen["orders/00"]; ok {
+		t.Error("expired delivery is still recorded")
+	}
+}